@@ -0,0 +1,133 @@
+// Package audit writes a JSON line for every tool call routed through the
+// gateway, so what agents did on their own can be reviewed afterwards.
+// Arguments are written with the values of secrets redacted.
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Outcomes of a tool call
+const (
+	StatusOK        = "ok"         // The tool returned a result
+	StatusToolError = "tool_error" // The tool ran and reported an error (isError)
+	StatusError     = "error"      // The call failed or was refused with a JSON-RPC error
+)
+
+// Redacted replaces the value of a redacted argument
+const Redacted = "[REDACTED]"
+
+// DefaultRedact names the arguments whose values are always redacted. A name
+// matches every argument whose name contains it, ignoring case, so "token"
+// covers access_token and githubToken alike.
+var DefaultRedact = []string{
+	"password", "passwd", "secret", "token", "api_key", "apikey",
+	"authorization", "credential", "private_key", "cookie",
+}
+
+// Record is one audited tool call
+type Record struct {
+	Time       time.Time       `json:"time"`
+	Client     string          `json:"client,omitempty"`  // Configured client the call authenticated as
+	Session    string          `json:"session,omitempty"` // Session of the network server modes
+	RequestID  interface{}     `json:"request_id,omitempty"`
+	Server     string          `json:"server,omitempty"` // Upstream the call was sent to, if any
+	Tool       string          `json:"tool"`
+	Arguments  json.RawMessage `json:"arguments,omitempty"`
+	Status     string          `json:"status"`
+	ErrorCode  int             `json:"error_code,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	DurationMS float64         `json:"duration_ms"`
+}
+
+// Log writes records to a writer as JSON lines
+type Log struct {
+	redact []string
+
+	mutex  sync.Mutex
+	writer io.Writer
+}
+
+// New returns a log writing to w that redacts the arguments named by
+// DefaultRedact and redact
+func New(w io.Writer, redact []string) *Log {
+	names := make([]string, 0, len(DefaultRedact)+len(redact))
+	for _, name := range slices.Concat(DefaultRedact, redact) {
+		names = append(names, strings.ToLower(strings.TrimSpace(name)))
+	}
+	return &Log{redact: names, writer: w}
+}
+
+// Write appends record as one line, redacting its arguments first
+func (l *Log) Write(record Record) error {
+	record.Arguments = l.Redact(record.Arguments)
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit record: %w", err)
+	}
+	line = append(line, '\n')
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if _, err := l.writer.Write(line); err != nil {
+		return fmt.Errorf("failed to write audit record: %w", err)
+	}
+	return nil
+}
+
+// Redact returns args with the value of every redacted name replaced, in
+// nested objects and arrays too. Arguments that are not valid JSON cannot be
+// inspected, so they are replaced whole.
+func (l *Log) Redact(args json.RawMessage) json.RawMessage {
+	if len(args) == 0 {
+		return args
+	}
+	decoder := json.NewDecoder(bytes.NewReader(args))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return json.RawMessage(`"` + Redacted + `"`)
+	}
+	redacted, err := json.Marshal(l.redactValue(value))
+	if err != nil {
+		return json.RawMessage(`"` + Redacted + `"`)
+	}
+	return redacted
+}
+
+// redactValue replaces the values of redacted names within value
+func (l *Log) redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for name, field := range v {
+			if l.redacts(name) {
+				v[name] = Redacted
+			} else {
+				v[name] = l.redactValue(field)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = l.redactValue(item)
+		}
+	}
+	return value
+}
+
+// redacts reports whether the value of the argument called name is redacted
+func (l *Log) redacts(name string) bool {
+	name = strings.ToLower(name)
+	for _, redacted := range l.redact {
+		if strings.Contains(name, redacted) {
+			return true
+		}
+	}
+	return false
+}
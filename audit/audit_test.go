@@ -0,0 +1,88 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLog_Write(t *testing.T) {
+	var buf bytes.Buffer
+	log := New(&buf, []string{"SSN"})
+
+	records := []Record{
+		{
+			Time:       time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+			Client:     "ci",
+			Session:    "abc",
+			RequestID:  7,
+			Server:     "github",
+			Tool:       "create_issue",
+			Arguments:  json.RawMessage(`{"title":"Bug","github_token":"ghp_x","count":12345678901234567890}`),
+			Status:     StatusOK,
+			DurationMS: 12.5,
+		},
+		{Tool: "missing", Status: StatusError, ErrorCode: -32601, Error: "Tool not found"},
+	}
+	for _, record := range records {
+		if err := log.Write(record); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected one line per record, got %q", buf.String())
+	}
+	var first map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+		t.Fatalf("Expected a JSON record, got %q: %v", lines[0], err)
+	}
+	for key, value := range map[string]interface{}{
+		"client":      "ci",
+		"session":     "abc",
+		"request_id":  float64(7),
+		"server":      "github",
+		"tool":        "create_issue",
+		"status":      StatusOK,
+		"duration_ms": 12.5,
+		"time":        "2024-05-01T12:00:00Z",
+	} {
+		if first[key] != value {
+			t.Errorf("Expected %s=%v, got %v", key, value, first[key])
+		}
+	}
+	if want := `"arguments":{"count":12345678901234567890,"github_token":"[REDACTED]","title":"Bug"}`; !strings.Contains(lines[0], want) {
+		t.Errorf("Expected redacted arguments %s, got %s", want, lines[0])
+	}
+	if strings.Contains(lines[1], "arguments") || !strings.Contains(lines[1], `"error_code":-32601`) {
+		t.Errorf("Expected an error record without arguments, got %s", lines[1])
+	}
+}
+
+func TestLog_Redact(t *testing.T) {
+	log := New(&bytes.Buffer{}, []string{"ssn"})
+
+	tests := []struct {
+		name string
+		args string
+		want string
+	}{
+		{"flat", `{"user":"a","Password":"p"}`, `{"Password":"[REDACTED]","user":"a"}`},
+		{"nested", `{"auth":{"apiKey":"k","Authorization":"Bearer x"},"items":[{"customer_ssn":"1"}]}`,
+			`{"auth":{"Authorization":"[REDACTED]","apiKey":"[REDACTED]"},"items":[{"customer_ssn":"[REDACTED]"}]}`},
+		{"whole object", `{"credentials":{"user":"a"}}`, `{"credentials":"[REDACTED]"}`},
+		{"not an object", `["token"]`, `["token"]`},
+		{"invalid", `{"password":`, `"[REDACTED]"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(log.Redact(json.RawMessage(tt.args))); got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/j4ng5y/mcpgate/config"
+	"github.com/j4ng5y/mcpgate/logging"
+)
+
+// logStartupBanner writes a summary of the running gateway to the log (stderr),
+// keeping stdout reserved for the protocol stream: one record for the gateway,
+// then one for each configured server
+func logStartupBanner(cfg *config.Config, configPath string, listeners []string) {
+	if abs, err := filepath.Abs(configPath); err == nil {
+		configPath = abs
+	}
+
+	enabled := 0
+	for _, srv := range cfg.Servers {
+		if srv.Enabled {
+			enabled++
+		}
+	}
+
+	attrs := []interface{}{
+		"version", Version,
+		"commit", Commit,
+		"built", Date,
+		"config", configPath,
+		"platform", runtime.GOOS + "/" + runtime.GOARCH,
+		"go", runtime.Version(),
+		"pid", os.Getpid(),
+		"log_level", cfg.Gateway.LogLevel,
+		"listeners", listeners,
+		"servers", len(cfg.Servers),
+		"enabled", enabled,
+	}
+	if cfg.Gateway.Tracing.Enabled() {
+		attrs = append(attrs, "tracing", cfg.Gateway.Tracing.Endpoint, "service_name", cfg.Gateway.Tracing.ServiceName)
+	}
+	if cfg.Gateway.Audit.Enabled() {
+		attrs = append(attrs, "audit", cfg.Gateway.Audit.File)
+	}
+	slog.Info("Starting mcpgate", attrs...)
+
+	for _, srv := range cfg.Servers {
+		serverAttrs := []interface{}{logging.Server(srv.Name),
+			"transport", srv.Transport, "enabled", srv.Enabled, "timeout", srv.Timeout}
+		if srv.LogLevel != "" {
+			serverAttrs = append(serverAttrs, "log_level", srv.LogLevel)
+		}
+		slog.Info("Configured server", serverAttrs...)
+	}
+}
@@ -1,21 +1,28 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
+	"time"
 
 	"github.com/j4ng5y/mcpgate/inject"
+	"github.com/j4ng5y/mcpgate/logging"
 	"github.com/spf13/cobra"
 )
 
 var (
 	injectURL      string
+	injectAPIKey   string
 	injectName     string
 	injectAgents   string
 	injectMode     string
 	injectConfig   string
 	doEject        bool
+	injectValidate bool
+	injectCopy     bool
+	injectProfile  string
 )
 
 // injectCmd represents the inject command
@@ -41,11 +48,15 @@ Supported agents:
 
 func init() {
 	injectCmd.Flags().StringVar(&injectMode, "mode", "stdio", "Connection mode: stdio (subprocess) or http (HTTP server)")
-	injectCmd.Flags().StringVar(&injectURL, "url", "", "URL to the mcpgate server (HTTP mode only)")
-	injectCmd.Flags().StringVar(&injectName, "name", "mcpgate", "Name for the mcpgate server entry")
+	injectCmd.Flags().StringVar(&injectURL, "url", "", "URL of a gateway started with mcpgate server --http, e.g. http://localhost:8080/mcp (HTTP mode only)")
+	injectCmd.Flags().StringVar(&injectAPIKey, "api-key", "", "API key the agents present to a gateway with [auth] keys (HTTP mode only)")
+	injectCmd.Flags().StringVar(&injectName, "name", "mcpgate", "Name for the mcpgate server entry; may use {profile}, {hostname} and {user}")
+	injectCmd.Flags().StringVar(&injectProfile, "profile", "", "Value of {profile} in --name (defaults to the --config file name)")
 	injectCmd.Flags().StringVar(&injectAgents, "agents", "all", "Comma-separated list of agents to inject into (all, claude, cursor, zed, codex-cli, gemini-cli, opencode, windsurf, kiro)")
 	injectCmd.Flags().StringVar(&injectConfig, "config", "", "Path to mcpgate config file (stdio mode only)")
 	injectCmd.Flags().BoolVar(&doEject, "eject", false, "Remove mcpgate from agent configs instead of injecting")
+	injectCmd.Flags().BoolVar(&injectValidate, "validate", false, "Launch the injected command once and check it answers initialize (stdio mode only)")
+	injectCmd.Flags().BoolVar(&injectCopy, "copy-config", false, "Copy --config to a stable per-agent location and reference the copy (stdio mode only)")
 }
 
 func runInject(cmd *cobra.Command, args []string) {
@@ -55,6 +66,14 @@ func runInject(cmd *cobra.Command, args []string) {
 		return
 	}
 
+	// Expand the name template once so inject and eject address the same entry
+	name, err := inject.ExpandName(injectName, inject.DefaultNameVars(injectProfile, injectConfig))
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	injectName = name
+
 	// Validate mode-specific parameters
 	if injectMode == "stdio" {
 		// For stdio mode, find mcpgate binary
@@ -64,12 +83,29 @@ func runInject(cmd *cobra.Command, args []string) {
 			return
 		}
 
-		// Build args for mcpgate subprocess
-		var args []string
-		if injectConfig != "" {
-			args = []string{"server", "-c", injectConfig}
-		} else {
-			args = []string{"server"}
+		// Agents launch the command from their own working directory, possibly
+		// months from now, so only absolute paths to existing files are written
+		command, err := inject.ResolveCommand(exe)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		if inject.IsTemporaryPath(command) && !doEject {
+			fmt.Printf("WARNING: %s is in a temporary directory (e.g. built by 'go run'); agents will fail to start it once it is removed. Install mcpgate and inject again.\n\n", command)
+		}
+
+		configPath := ""
+		if !doEject {
+			if injectConfig != "" {
+				configPath, err = inject.ResolveConfigPath(injectConfig)
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+					return
+				}
+			} else if injectCopy {
+				fmt.Println("Error: --copy-config requires --config")
+				return
+			}
 		}
 
 		// Create manager and register agents
@@ -86,7 +122,7 @@ func runInject(cmd *cobra.Command, args []string) {
 		if doEject {
 			handleEject(manager)
 		} else {
-			handleInjectStdio(manager, exe, args)
+			handleInjectStdio(manager, command, configPath)
 		}
 	} else {
 		// HTTP mode
@@ -114,8 +150,22 @@ func runInject(cmd *cobra.Command, args []string) {
 	}
 }
 
+// stdioEntry is an agent injected in stdio mode and the arguments written for it
+type stdioEntry struct {
+	agent inject.Agent
+	args  []string
+}
+
+// stdioArgs builds the arguments for the mcpgate subprocess
+func stdioArgs(configPath string) []string {
+	if configPath == "" {
+		return []string{"server"}
+	}
+	return []string{"server", "-c", configPath}
+}
+
 // handleInjectStdio injects mcpgate (stdio mode) into agent configs
-func handleInjectStdio(manager *inject.Manager, command string, args []string) {
+func handleInjectStdio(manager *inject.Manager, command string, configPath string) {
 	installed := manager.ListInstalledAgents()
 
 	if len(installed) == 0 {
@@ -153,33 +203,85 @@ func handleInjectStdio(manager *inject.Manager, command string, args []string) {
 		return
 	}
 
+	copyDir := ""
+	if injectCopy {
+		dir, err := inject.StableConfigDir()
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		copyDir = dir
+	}
+
 	fmt.Printf("Injecting mcpgate (stdio mode) into %d agent(s)...\n", len(agentsToInject))
-	fmt.Printf("Command: %s %v\n\n", command, args)
+	fmt.Printf("Command: %s %v\n\n", command, stdioArgs(configPath))
 
 	options := map[string]interface{}{}
 
+	var injected []stdioEntry
 	for _, agent := range agentsToInject {
 		fmt.Printf("  Injecting into %s... ", agent.Name())
 
+		agentConfig := configPath
+		if copyDir != "" {
+			copied, err := inject.CopyConfig(configPath, copyDir, agent.Name(), injectName)
+			if err != nil {
+				fmt.Printf("FAILED (%v)\n", err)
+				slog.Error("Failed to copy config", "agent", agent.Name(), logging.Err(err))
+				continue
+			}
+			agentConfig = copied
+		}
+		args := stdioArgs(agentConfig)
+
 		if err := agent.CreateBackup(); err != nil {
 			fmt.Printf("FAILED (backup error: %v)\n", err)
-			log.Printf("Failed to backup %s: %v", agent.Name(), err)
+			slog.Error("Failed to backup agent config", "agent", agent.Name(), logging.Err(err))
 			continue
 		}
 
 		if err := agent.InjectStdio(command, args, injectName, options); err != nil {
 			fmt.Printf("FAILED (%v)\n", err)
-			log.Printf("Failed to inject into %s: %v", agent.Name(), err)
+			slog.Error("Failed to inject", "agent", agent.Name(), logging.Err(err))
 			if restoreErr := agent.RestoreBackup(); restoreErr != nil {
 				fmt.Printf("    WARNING: Failed to restore backup: %v\n", restoreErr)
 			}
 			continue
 		}
 
-		fmt.Println("OK")
+		if copyDir != "" {
+			fmt.Printf("OK (config: %s)\n", agentConfig)
+		} else {
+			fmt.Println("OK")
+		}
+		injected = append(injected, stdioEntry{agent: agent, args: args})
 	}
 
 	fmt.Printf("\nSuccessfully injected mcpgate (Name: %s)\n", injectName)
+
+	if injectValidate && len(injected) > 0 {
+		validateInjected(injected, command)
+	}
+}
+
+// validateInjected launches the injected command for each agent and reports whether it starts
+func validateInjected(entries []stdioEntry, command string) {
+	fmt.Printf("\nValidating injected command for %d agent(s)...\n", len(entries))
+
+	failed := 0
+	for _, entry := range entries {
+		result := inject.ValidateAgents(context.Background(), []inject.Agent{entry.agent}, command, entry.args)[0]
+		if result.OK() {
+			fmt.Printf("  %s... OK (%s)\n", result.Agent, result.Duration.Round(time.Millisecond))
+			continue
+		}
+		failed++
+		fmt.Printf("  %s... FAILED (%v)\n", result.Agent, result.Err)
+	}
+
+	if failed > 0 {
+		fmt.Printf("\nWARNING: %d agent(s) will not be able to start mcpgate; check the binary path and --config\n", failed)
+	}
 }
 
 // handleInjectHTTP injects mcpgate (HTTP mode) into agent configs
@@ -225,19 +327,22 @@ func handleInjectHTTP(manager *inject.Manager) {
 	fmt.Printf("URL: %s\n\n", injectURL)
 
 	options := map[string]interface{}{}
+	if injectAPIKey != "" {
+		options = inject.APIKeyOptions(injectAPIKey)
+	}
 
 	for _, agent := range agentsToInject {
 		fmt.Printf("  Injecting into %s... ", agent.Name())
 
 		if err := agent.CreateBackup(); err != nil {
 			fmt.Printf("FAILED (backup error: %v)\n", err)
-			log.Printf("Failed to backup %s: %v", agent.Name(), err)
+			slog.Error("Failed to backup agent config", "agent", agent.Name(), logging.Err(err))
 			continue
 		}
 
 		if err := agent.InjectHTTP(injectURL, injectName, options); err != nil {
 			fmt.Printf("FAILED (%v)\n", err)
-			log.Printf("Failed to inject into %s: %v", agent.Name(), err)
+			slog.Error("Failed to inject", "agent", agent.Name(), logging.Err(err))
 			if restoreErr := agent.RestoreBackup(); restoreErr != nil {
 				fmt.Printf("    WARNING: Failed to restore backup: %v\n", restoreErr)
 			}
@@ -267,7 +372,7 @@ func handleEject(manager *inject.Manager) {
 
 		if err := agent.Eject(injectName); err != nil {
 			fmt.Printf("FAILED (%v)\n", err)
-			log.Printf("Failed to eject from %s: %v", agent.Name(), err)
+			slog.Error("Failed to eject", "agent", agent.Name(), logging.Err(err))
 			continue
 		}
 
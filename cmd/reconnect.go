@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// reconnectCmd reconnects an upstream server of a running gateway
+var reconnectCmd = &cobra.Command{
+	Use:   "reconnect NAME",
+	Short: "Reconnect an upstream server of a running gateway",
+	Long: `Disconnect and reconnect an upstream server of a running mcpgate instance,
+e.g. one that stopped answering, without restarting the gateway.
+
+The gateway must have the control endpoint enabled ([gateway.control] in the
+config file).`,
+	Args: cobra.ExactArgs(1),
+	RunE: runReconnect,
+}
+
+func init() {
+	reconnectCmd.Flags().StringVarP(&configPath, "config", "c", "config.toml", "Path to configuration file")
+}
+
+func runReconnect(cmd *cobra.Command, args []string) error {
+	client, err := newControlClient()
+	if err != nil {
+		return err
+	}
+
+	// Connecting retries with backoff, so allow more than a listing does
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var result struct {
+		Name  string `json:"name"`
+		State string `json:"state"`
+	}
+	params := map[string]string{"name": args[0]}
+	if err := callControl(ctx, client, "gateway/reconnect_server", params, &result); err != nil {
+		return err
+	}
+
+	fmt.Printf("Reconnected %s (%s)\n", result.Name, result.State)
+	return nil
+}
@@ -31,4 +31,8 @@ func init() {
 	// Add subcommands
 	rootCmd.AddCommand(serverCmd)
 	rootCmd.AddCommand(injectCmd)
+	rootCmd.AddCommand(serversCmd)
+	rootCmd.AddCommand(reconnectCmd)
+	rootCmd.AddCommand(statsCmd)
+	rootCmd.AddCommand(serviceCmd)
 }
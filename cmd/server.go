@@ -3,20 +3,36 @@ package cmd
 import (
 	"bufio"
 	"context"
+	"crypto/tls"
 	"encoding/json"
-	"log"
+	"errors"
+	"io"
+	"log/slog"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
+	"time"
 
+	"github.com/j4ng5y/mcpgate/audit"
 	"github.com/j4ng5y/mcpgate/config"
+	"github.com/j4ng5y/mcpgate/control"
+	"github.com/j4ng5y/mcpgate/dashboard"
+	"github.com/j4ng5y/mcpgate/listener"
+	"github.com/j4ng5y/mcpgate/logging"
 	"github.com/j4ng5y/mcpgate/mcp"
+	"github.com/j4ng5y/mcpgate/serve"
 	"github.com/j4ng5y/mcpgate/server"
+	"github.com/j4ng5y/mcpgate/tracing"
 	"github.com/spf13/cobra"
 )
 
 var (
-	configPath string
+	configPath    string
+	httpAddresses []string
+	sseAddresses  []string
+	wsAddresses   []string
+	alsoStdio     bool
 )
 
 // serverCmd represents the server command
@@ -26,76 +42,536 @@ var serverCmd = &cobra.Command{
 	Long: `Start mcpgate as a Model Context Protocol server.
 
 The server reads JSON-RPC 2.0 requests from stdin and writes responses to stdout.
-It routes requests to configured upstream MCP servers.`,
+It routes requests to configured upstream MCP servers.
+
+With --http it serves MCP over Streamable HTTP on the given address instead,
+at the /mcp endpoint, so agents can connect to the gateway over the network.
+With --sse it serves the older HTTP+SSE transport at /sse, for clients that
+only support that, and with --websocket it accepts WebSocket connections at
+/ws. These may be combined, and --stdio serves stdio alongside them, so an
+agent that spawns the gateway and agents connecting over the network share
+the same upstream servers. Each flag may be repeated to listen on several
+addresses; [gateway.http], [gateway.sse] and [gateway.websocket] in the
+config file set their addresses and address family, or enable them without
+the flag.`,
 	Run: runServer,
 }
 
 func init() {
 	serverCmd.Flags().StringVarP(&configPath, "config", "c", "config.toml", "Path to configuration file")
+	serverCmd.Flags().StringArrayVar(&httpAddresses, "http", nil, "Serve Streamable HTTP on this address (e.g. 127.0.0.1:8080, unix:///path/to.sock or systemd: for socket activation) instead of stdio; repeat for more addresses")
+	serverCmd.Flags().StringArrayVar(&sseAddresses, "sse", nil, "Serve HTTP+SSE on this address instead of stdio, for clients without Streamable HTTP support; repeat for more addresses")
+	serverCmd.Flags().StringArrayVar(&wsAddresses, "websocket", nil, "Accept WebSocket connections on this address instead of stdio; repeat for more addresses")
+	serverCmd.Flags().BoolVar(&alsoStdio, "stdio", false, "Serve stdio as well as --http, --sse or --websocket; the gateway exits when stdin closes")
 }
 
 func runServer(cmd *cobra.Command, args []string) {
+	// Only JSON-RPC frames may reach stdout; everything else goes to stderr
+	stdout := claimStdout()
+
 	// Load configuration
 	cfg, err := config.LoadConfig(configPath)
 	if err != nil {
-		log.Fatalf("Failed to load configuration: %v", err)
+		fatal("Failed to load configuration", logging.Err(err))
+	}
+	var logOutput io.Writer = os.Stderr
+	if cfg.Gateway.LogFile != "" {
+		logFile, err := logging.OpenFile(cfg.Gateway.LogFile, logRotation(cfg.Gateway.LogRotation))
+		if err != nil {
+			fatal("Failed to open log file", logging.Err(err))
+		}
+		defer func() {
+			_ = logFile.Close()
+		}()
+		logOutput = logFile
+		if cfg.Gateway.LogStderr {
+			logOutput = io.MultiWriter(logFile, os.Stderr)
+		}
+	}
+	logLevels, err := logging.NewLevels(cfg.Gateway.LogLevel, serverLogLevels(cfg.Servers))
+	if err != nil {
+		fatal("Failed to set up logging", logging.Err(err))
+	}
+	logger, err := logging.New(logOutput, cfg.Gateway.LogFormat, logLevels)
+	if err != nil {
+		fatal("Failed to set up logging", logging.Err(err))
+	}
+	slog.SetDefault(logger)
+
+	// stdio is served unless only network listeners were asked for
+	var listeners []string
+	for _, mode := range networkModes(cfg) {
+		for _, address := range mode.listen.Addresses {
+			listeners = append(listeners, mode.flag+"="+address)
+		}
+	}
+	serveStdin := len(listeners) == 0 || alsoStdio
+	if serveStdin {
+		listeners = append([]string{"stdio"}, listeners...)
+	}
+	if cfg.Gateway.Control.Enabled {
+		for _, address := range cfg.Gateway.Control.ListenAddresses() {
+			listeners = append(listeners, "control="+address)
+		}
+	}
+	if cfg.Gateway.Dashboard.Enabled {
+		listeners = append(listeners, "dashboard="+cfg.Gateway.Dashboard.Address)
+	}
+	logStartupBanner(cfg, configPath, listeners)
+
+	// Export a span per routed request to an OpenTelemetry collector
+	var spanExporter *tracing.Exporter
+	if cfg.Gateway.Tracing.Enabled() {
+		spanExporter = startTracing(cfg.Gateway.Tracing)
 	}
 
 	// Initialize server manager
 	mgr := server.NewManager(cfg)
 	if err := mgr.Start(); err != nil {
-		log.Fatalf("Failed to start server manager: %v", err)
+		mgr.Stop()
+		fatal("Failed to start server manager", logging.Err(err))
 	}
 
 	// Create MCP router
 	router := mcp.NewRouter(mgr)
+	if cfg.Gateway.ManagementTools {
+		router.EnableManagementTools()
+	}
+	if cfg.Gateway.AllowRuntimeChanges {
+		router.EnableRuntimeChanges()
+	}
+	if cfg.Gateway.Audit.Enabled() {
+		auditFile, err := logging.OpenFile(cfg.Gateway.Audit.File, logRotation(cfg.Gateway.Audit.Rotation))
+		if err != nil {
+			mgr.Stop()
+			fatal("Failed to open audit log", logging.Err(err))
+		}
+		defer func() {
+			_ = auditFile.Close()
+		}()
+		router.SetAuditLog(audit.New(auditFile, cfg.Gateway.Audit.Redact))
+	}
+
+	// Start the optional control endpoint for tooling
+	var controlServer *control.Server
+	if cfg.Gateway.Control.Enabled {
+		controlServer = control.NewServer(cfg.Gateway.Control, router)
+		if err := controlServer.Start(); err != nil {
+			slog.Error("Failed to start control endpoint", logging.Err(err))
+			controlServer = nil
+		}
+	}
+
+	// Start the optional web dashboard
+	var dashboardServer *dashboard.Server
+	if cfg.Gateway.Dashboard.Enabled {
+		dashboardServer = dashboard.NewServer(cfg.Gateway.Dashboard, router)
+		if err := dashboardServer.Start(); err != nil {
+			slog.Error("Failed to start dashboard", logging.Err(err))
+			dashboardServer = nil
+		}
+	}
+
+	// Serve downstream clients over the network, instead of or as well as stdio
+	netServers, err := startNetworkServers(cfg, router)
+	if err != nil {
+		mgr.Stop()
+		fatal("Failed to start server", logging.Err(err))
+	}
 
-	// Create context for graceful shutdown
+	// Requests and background work run on ctx, which is cancelled once the
+	// shutdown stops waiting for them
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// Handle signals
-	sigChan := make(chan os.Signal, 1)
+	// Reload [[server]] entries on SIGHUP, or when the file changes if watched
+	reloadChan := make(chan struct{}, 1)
+	requestReload := func() {
+		select {
+		case reloadChan <- struct{}{}:
+		default:
+		}
+	}
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+	go func() {
+		for range hupChan {
+			slog.Info("Received SIGHUP, reloading configuration")
+			requestReload()
+		}
+	}()
+	if cfg.Gateway.WatchConfig {
+		go config.Watch(ctx, configPath, config.DefaultWatchInterval, func() {
+			slog.Info("Configuration file changed, reloading")
+			requestReload()
+		})
+	}
+	go func() {
+		for {
+			select {
+			case <-reloadChan:
+				reloadConfig(mgr, logLevels)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// The first SIGINT or SIGTERM starts a graceful shutdown; a second one
+	// exits at once
+	stopping, stop := context.WithCancel(context.Background())
+	defer stop()
+	sigChan := make(chan os.Signal, 2)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 	go func() {
 		sig := <-sigChan
-		log.Printf("Received signal: %v", sig)
-		mgr.Stop()
-		cancel()
-		os.Exit(0)
+		slog.Info("Received signal, shutting down", "signal", sig.String())
+		stop()
+		sig = <-sigChan
+		slog.Warn("Received signal again, exiting immediately", "signal", sig.String())
+		os.Exit(1)
 	}()
 
-	// Start stdio server
-	reader := bufio.NewReader(os.Stdin)
-	encoder := json.NewEncoder(os.Stdout)
+	// Requests are handled concurrently so a slow or large response never
+	// holds up the ones behind it
+	var inflight sync.WaitGroup
+	if serveStdin {
+		serveStdio(ctx, stopping, stdout, router, requestLimits(cfg.Gateway.Limits), &inflight)
+	} else {
+		<-stopping.Done()
+	}
+
+	// The in-flight requests, listeners, shutdown hooks and servers share one
+	// deadline
+	stopCtx, stopCancel := context.WithTimeout(context.Background(), server.DefaultShutdownTimeout)
+	defer stopCancel()
+	for _, netServer := range netServers {
+		// Stopping drains the requests the server is still routing
+		if err := netServer.Stop(stopCtx); err != nil {
+			slog.Warn("Error stopping server", logging.Err(err))
+		}
+	}
+	if !waitInflight(stopCtx, &inflight) {
+		slog.Warn("Shutdown deadline passed with requests in flight, cancelling them")
+	}
+	cancel()
+	if controlServer != nil {
+		if err := controlServer.Stop(stopCtx); err != nil {
+			slog.Warn("Error stopping control endpoint", logging.Err(err))
+		}
+	}
+	if dashboardServer != nil {
+		if err := dashboardServer.Stop(stopCtx); err != nil {
+			slog.Warn("Error stopping dashboard", logging.Err(err))
+		}
+	}
+	if err := mgr.Shutdown(stopCtx); err != nil {
+		slog.Warn("Error during shutdown", logging.Err(err))
+	}
+	if spanExporter != nil {
+		if err := spanExporter.Shutdown(stopCtx); err != nil {
+			slog.Warn("Error exporting remaining spans", logging.Err(err))
+		}
+	}
+	slog.Info("Shutdown complete")
+}
+
+// serveStdio routes the requests read from stdin, writing their responses
+// to stdout, until stdin closes or stopping is done. Requests over limits are
+// answered with an error. The requests still in flight are left in inflight.
+func serveStdio(ctx, stopping context.Context, stdout io.Writer, router *mcp.Router, limits mcp.Limits, inflight *sync.WaitGroup) {
+	encoder := newSyncEncoder(stdout)
+
+	// Push list_changed notifications to the client as upstreams come and
+	// go, and updates to the resources it subscribed to
+	router.AddNotifier(func(n *mcp.Notification) {
+		if !router.Receives(ctx, n) {
+			return
+		}
+		if err := encoder.Encode(n); err != nil {
+			slog.Warn("Error encoding notification", logging.Err(err))
+		}
+	})
+
+	// Lines are read in the background so a shutdown need not wait for the
+	// next one
+	lines := make(chan []byte)
+	go func() {
+		defer close(lines)
+		reader := bufio.NewReader(os.Stdin)
+		for {
+			line, err := limits.ReadLine(reader)
+			if errors.Is(err, mcp.ErrRequestTooLarge) {
+				slog.Warn("Discarding request over the size limit", "limit", limits.MaxRequestSize)
+				if err := encoder.Encode(limits.TooLarge()); err != nil {
+					slog.Warn("Error encoding error response", logging.Err(err))
+				}
+				continue
+			}
+			if errors.Is(err, io.EOF) {
+				slog.Info("Client closed stdin")
+				return
+			}
+			if err != nil {
+				slog.Error("Error reading input", logging.Err(err))
+				return
+			}
+			select {
+			case lines <- line:
+			case <-stopping.Done():
+				return
+			}
+		}
+	}()
 
 	for {
-		line, err := reader.ReadString('\n')
-		if err != nil {
-			log.Printf("Error reading input: %v", err)
-			break
-		}
-
-		var request mcp.Request
-		if err := json.Unmarshal([]byte(line), &request); err != nil {
-			// Send error response
-			errResp := mcp.Response{
-				JSONRPC: "2.0",
-				Error: &mcp.JSONRPCError{
-					Code:    -32700,
-					Message: "Parse error",
-				},
+		var line []byte
+		var ok bool
+		select {
+		case line, ok = <-lines:
+			if !ok {
+				return
 			}
+		case <-stopping.Done():
+			return
+		}
+
+		request, errResp := limits.ParseRequest(line)
+		if errResp != nil {
 			if err := encoder.Encode(errResp); err != nil {
-				log.Printf("Error encoding error response: %v", err)
+				slog.Warn("Error encoding error response", logging.Err(err))
 			}
 			continue
 		}
 
-		// Route request
-		response := router.Route(ctx, &request)
-		if err := encoder.Encode(response); err != nil {
-			log.Printf("Error encoding response: %v", err)
+		inflight.Add(1)
+		go func() {
+			defer inflight.Done()
+			ctx, release := mcp.StreamResults(ctx)
+			defer release()
+			response := router.Route(ctx, request)
+			if response == nil {
+				// Notifications are not answered
+				return
+			}
+			if err := encoder.WriteResponse(response); err != nil {
+				slog.Warn("Error encoding response", logging.Err(err))
+			}
+		}()
+	}
+}
+
+// requestLimits returns the limits [gateway.limits] sets on requests from
+// downstream clients, using the defaults for those left unset
+func requestLimits(cfg config.LimitsConfig) mcp.Limits {
+	limits := mcp.DefaultLimits()
+	if cfg.MaxRequestSize != 0 {
+		limits.MaxRequestSize = cfg.MaxRequestSize
+	}
+	if cfg.MaxParamsDepth != 0 {
+		limits.MaxParamsDepth = cfg.MaxParamsDepth
+	}
+	return limits
+}
+
+// waitInflight waits for the in-flight requests to finish, reporting false
+// when ctx is done first
+func waitInflight(ctx context.Context, inflight *sync.WaitGroup) bool {
+	done := make(chan struct{})
+	go func() {
+		inflight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// networkServer is a server mode serving downstream clients over the network
+type networkServer interface {
+	SetTLSConfig(tlsConfig *tls.Config)
+	SetAPIKeys(keys []string)
+	SetClients(clients []config.ClientConfig)
+	SetOAuth(validator *serve.OAuthValidator)
+	SetLimits(limits mcp.Limits)
+	SetAllowedOrigins(origins []string)
+	Start() error
+	Stop(ctx context.Context) error
+	Addrs() []string
+}
+
+// networkMode is a network server mode of mcpgate server and where it listens
+type networkMode struct {
+	flag   string
+	listen config.ListenConfig
+}
+
+// networkModes returns the server modes selected by --http, --sse and
+// --websocket, listening on the addresses given with the flag, and those
+// enabled in the config file, listening on its addresses
+func networkModes(cfg *config.Config) []networkMode {
+	var modes []networkMode
+	for _, mode := range []struct {
+		flag      string
+		addresses []string
+		listen    config.ListenConfig
+	}{
+		{"http", httpAddresses, cfg.Gateway.HTTP},
+		{"sse", sseAddresses, cfg.Gateway.SSE},
+		{"websocket", wsAddresses, cfg.Gateway.WebSocket},
+	} {
+		if len(mode.addresses) > 0 {
+			mode.listen.Addresses = mode.addresses
+		} else if !mode.listen.Enabled {
+			continue
 		}
+		modes = append(modes, networkMode{flag: mode.flag, listen: mode.listen})
 	}
+	return modes
+}
+
+// startNetworkServers starts the server modes selected by --http, --sse and
+// --websocket or the config file, over TLS when [gateway.tls] has a
+// certificate and requiring the API keys or OAuth access tokens of [auth],
+// holding clients to their policies. It returns none when serving stdio only.
+func startNetworkServers(cfg *config.Config, router *mcp.Router) ([]networkServer, error) {
+	type mode struct {
+		name string
+		srv  networkServer
+	}
+	var modes []mode
+	for _, m := range networkModes(cfg) {
+		switch m.flag {
+		case "http":
+			httpServer := serve.NewHTTPServer(m.listen.Addresses, m.listen.Family, router)
+			httpServer.SetSessionIdleTimeout(time.Duration(cfg.Gateway.SessionIdleTimeout) * time.Second)
+			modes = append(modes, mode{"HTTP", httpServer})
+		case "sse":
+			modes = append(modes, mode{"SSE", serve.NewSSEServer(m.listen.Addresses, m.listen.Family, router)})
+		case "websocket":
+			modes = append(modes, mode{"WebSocket", serve.NewWebSocketServer(m.listen.Addresses, m.listen.Family, router)})
+		}
+	}
+	if len(modes) == 0 {
+		return nil, nil
+	}
+
+	tlsConfig, err := serve.LoadTLSConfig(cfg.Gateway.TLS)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := cfg.Auth.Keys()
+	if err != nil {
+		return nil, err
+	}
+	var validator *serve.OAuthValidator
+	if cfg.Auth.OAuth.Enabled() {
+		validator = serve.NewOAuthValidator(cfg.Auth.OAuth)
+	}
+	// API keys, access tokens and client certificates authenticate; TLS
+	// alone merely encrypts
+	authenticated := len(keys) > 0 || len(cfg.Auth.Clients) > 0 || cfg.Auth.OAuth.Enabled() || cfg.Gateway.TLS.ClientCA != ""
+
+	started := make([]networkServer, 0, len(modes))
+	for _, m := range modes {
+		m.srv.SetTLSConfig(tlsConfig)
+		m.srv.SetAPIKeys(keys)
+		m.srv.SetClients(cfg.Auth.Clients)
+		m.srv.SetLimits(requestLimits(cfg.Gateway.Limits))
+		m.srv.SetAllowedOrigins(cfg.Gateway.CORS.AllowedOrigins)
+		if validator != nil {
+			m.srv.SetOAuth(validator)
+		}
+		if err := m.srv.Start(); err != nil {
+			for _, srv := range started {
+				_ = srv.Stop(context.Background())
+			}
+			return nil, err
+		}
+		started = append(started, m.srv)
+
+		// The bound addresses are checked, as sockets passed in by systemd
+		// are only known once opened
+		listener.WarnIfExposed(m.name, m.srv.Addrs(), authenticated)
+	}
+	return started, nil
+}
+
+// reloadConfig applies the config file's current [[server]] entries, and
+// their log levels, to mgr. An invalid file is logged and ignored so the
+// running servers keep going.
+func reloadConfig(mgr *server.Manager, logLevels *logging.Levels) {
+	cfg, err := config.LoadConfig(configPath)
+	if err != nil {
+		slog.Error("Not reloading configuration", logging.Err(err))
+		return
+	}
+	if err := logLevels.SetServers(serverLogLevels(cfg.Servers)); err != nil {
+		slog.Error("Error reloading log levels", logging.Err(err))
+	}
+	if err := mgr.Reload(cfg); err != nil {
+		slog.Error("Error reloading configuration", logging.Err(err))
+	}
+}
+
+// serverLogLevels returns the log_level of each server that sets its own
+func serverLogLevels(servers []config.ServerConfig) map[string]string {
+	levels := make(map[string]string)
+	for _, srv := range servers {
+		if srv.LogLevel != "" {
+			levels[srv.Name] = srv.LogLevel
+		}
+	}
+	return levels
+}
+
+// logRotation returns the rotation a [gateway.log_rotation] or
+// [gateway.audit.rotation] table sets, using the defaults for those left unset
+func logRotation(cfg config.LogRotationConfig) logging.Rotation {
+	rotation := logging.DefaultRotation()
+	if cfg.MaxSize != 0 {
+		rotation.MaxSize = int64(cfg.MaxSize) << 20
+	}
+	if cfg.MaxAge != 0 {
+		rotation.MaxAge = time.Duration(cfg.MaxAge) * time.Hour
+	}
+	if cfg.MaxBackups != 0 {
+		rotation.MaxBackups = cfg.MaxBackups
+	}
+	return rotation
+}
+
+// syncEncoder serializes writes so responses and notifications never interleave
+type syncEncoder struct {
+	mutex   sync.Mutex
+	writer  io.Writer
+	encoder *json.Encoder
+}
+
+// newSyncEncoder creates an encoder safe for concurrent use
+func newSyncEncoder(w io.Writer) *syncEncoder {
+	return &syncEncoder{writer: w, encoder: json.NewEncoder(w)}
+}
+
+// WriteResponse writes a response, streaming large results in chunks
+func (e *syncEncoder) WriteResponse(resp *mcp.Response) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return mcp.WriteResponse(e.writer, resp)
+}
+
+// Encode writes v as a single JSON line
+func (e *syncEncoder) Encode(v interface{}) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.encoder.Encode(v)
+}
+
+// fatal logs msg as an error and exits
+func fatal(msg string, args ...interface{}) {
+	slog.Error(msg, args...)
+	os.Exit(1)
 }
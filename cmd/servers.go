@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/j4ng5y/mcpgate/config"
+	"github.com/j4ng5y/mcpgate/control"
+	"github.com/spf13/cobra"
+)
+
+// serversCmd lists upstream servers of a running gateway
+var serversCmd = &cobra.Command{
+	Use:   "servers",
+	Short: "List upstream servers of a running gateway",
+	Long: `List the upstream servers of a running mcpgate instance.
+
+The gateway must have the control endpoint enabled ([gateway.control] in the
+config file). Quarantined servers are listed separately.`,
+	RunE: runServers,
+}
+
+// serversTag limits the listing to servers carrying a tag
+var serversTag string
+
+func init() {
+	serversCmd.Flags().StringVarP(&configPath, "config", "c", "config.toml", "Path to configuration file")
+	serversCmd.Flags().StringVarP(&serversTag, "tag", "t", "", "Only list servers with this tag")
+}
+
+// serverEntry is a server as reported by gateway/list_servers
+type serverEntry struct {
+	Name                string    `json:"name"`
+	Transport           string    `json:"transport"`
+	State               string    `json:"state"`
+	Health              string    `json:"health"`
+	Capabilities        []string  `json:"capabilities"`
+	Quarantined         bool      `json:"quarantined"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	RetryAt             time.Time `json:"retry_at"`
+	UptimeSeconds       int64     `json:"uptime_seconds"`
+	TotalRestarts       int       `json:"total_restarts"`
+}
+
+func runServers(cmd *cobra.Command, args []string) error {
+	client, err := newControlClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var params interface{}
+	if serversTag != "" {
+		params = map[string]string{"tag": serversTag}
+	}
+
+	var servers []serverEntry
+	if err := callControl(ctx, client, "gateway/list_servers", params, &servers); err != nil {
+		return err
+	}
+
+	var active, quarantined []serverEntry
+	for _, srv := range servers {
+		if srv.Quarantined {
+			quarantined = append(quarantined, srv)
+		} else {
+			active = append(active, srv)
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "NAME\tTRANSPORT\tSTATE\tHEALTH\tUPTIME\tRESTARTS\tCAPABILITIES")
+	for _, srv := range active {
+		uptime := time.Duration(srv.UptimeSeconds) * time.Second
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%s\n", srv.Name, srv.Transport, srv.State, srv.Health, uptime, srv.TotalRestarts, strings.Join(srv.Capabilities, ","))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if len(quarantined) > 0 {
+		fmt.Println("\nQuarantined:")
+		w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "NAME\tTRANSPORT\tFAILURES\tNEXT RETRY")
+		for _, srv := range quarantined {
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", srv.Name, srv.Transport, srv.ConsecutiveFailures, srv.RetryAt.Local().Format(time.Kitchen))
+		}
+		return w.Flush()
+	}
+
+	return nil
+}
+
+// newControlClient loads the config and connects to the gateway's control endpoint
+func newControlClient() (*control.Client, error) {
+	cfg, err := config.LoadConfig(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+	return control.NewClient(cfg.Gateway.Control)
+}
+
+// callControl invokes a gateway method and decodes its result into out
+func callControl(ctx context.Context, client *control.Client, method string, params interface{}, out interface{}) error {
+	resp, err := client.Call(ctx, method, params)
+	if err != nil {
+		return err
+	}
+	if resp.Error != nil {
+		return fmt.Errorf("%s failed: %s", method, resp.Error.Message)
+	}
+
+	data, err := json.Marshal(resp.Result)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/j4ng5y/mcpgate/inject"
+	"github.com/j4ng5y/mcpgate/listener"
+	"github.com/j4ng5y/mcpgate/service"
+	"github.com/spf13/cobra"
+)
+
+var (
+	serviceName    string
+	serviceSystem  bool
+	serviceConfig  string
+	serviceAddress string
+)
+
+// serviceCmd manages mcpgate as a background service
+var serviceCmd = &cobra.Command{
+	Use:   "service",
+	Short: "Run mcpgate in HTTP mode as a background service",
+	Long: `Install, uninstall, start or stop mcpgate as a background service serving
+Streamable HTTP, so one gateway can be shared by every agent on the machine.
+
+On Linux the service is a systemd unit, on macOS a launchd job. It is
+installed for the current user unless --system is given, which usually
+requires root. Point agents at it with
+mcpgate inject --mode http --url http://<address>/mcp.`,
+}
+
+var serviceInstallCmd = &cobra.Command{
+	Use:   "install",
+	Short: "Install the service, then enable and start it",
+	Args:  cobra.NoArgs,
+	RunE:  runServiceInstall,
+}
+
+var serviceUninstallCmd = &cobra.Command{
+	Use:   "uninstall",
+	Short: "Stop the service and remove it",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return controlService("Uninstalled", service.Manager.Uninstall)
+	},
+}
+
+var serviceStartCmd = &cobra.Command{
+	Use:   "start",
+	Short: "Start the installed service",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return controlService("Started", service.Manager.Start)
+	},
+}
+
+var serviceStopCmd = &cobra.Command{
+	Use:   "stop",
+	Short: "Stop the running service",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return controlService("Stopped", service.Manager.Stop)
+	},
+}
+
+func init() {
+	serviceCmd.PersistentFlags().StringVar(&serviceName, "name", service.DefaultName, "Service name, to install several gateways side by side")
+	serviceCmd.PersistentFlags().BoolVar(&serviceSystem, "system", false, "Manage a system-wide service instead of one for the current user")
+	serviceInstallCmd.Flags().StringVarP(&serviceConfig, "config", "c", "config.toml", "Path to configuration file")
+	serviceInstallCmd.Flags().StringVar(&serviceAddress, "http", service.DefaultAddress, "Address the service serves Streamable HTTP on")
+
+	serviceCmd.AddCommand(serviceInstallCmd)
+	serviceCmd.AddCommand(serviceUninstallCmd)
+	serviceCmd.AddCommand(serviceStartCmd)
+	serviceCmd.AddCommand(serviceStopCmd)
+}
+
+func runServiceInstall(cmd *cobra.Command, args []string) error {
+	// The service manager starts the gateway from its own working directory,
+	// so only absolute paths to existing files are written
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find mcpgate binary: %w", err)
+	}
+	executable, err := inject.ResolveCommand(exe)
+	if err != nil {
+		return err
+	}
+	if inject.IsTemporaryPath(executable) {
+		fmt.Printf("WARNING: %s is in a temporary directory (e.g. built by 'go run'); the service will fail to start once it is removed. Install mcpgate and install the service again.\n\n", executable)
+	}
+	config, err := inject.ResolveConfigPath(serviceConfig)
+	if err != nil {
+		return err
+	}
+
+	mgr, err := service.New(service.Spec{
+		Name:       serviceName,
+		System:     serviceSystem,
+		Executable: executable,
+		ConfigPath: config,
+		Address:    serviceAddress,
+	})
+	if err != nil {
+		return err
+	}
+	if err := mgr.Install(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Installed %s %s (%s)\n", mgr.Kind(), serviceName, mgr.Path())
+	if !strings.HasPrefix(serviceAddress, listener.UnixPrefix) {
+		host := serviceAddress
+		if strings.HasPrefix(host, ":") {
+			host = "localhost" + host
+		}
+		fmt.Printf("Point agents at it with: mcpgate inject --mode http --url http://%s/mcp\n", host)
+	}
+	return nil
+}
+
+// controlService applies action to the installed service
+func controlService(done string, action func(service.Manager) error) error {
+	mgr, err := service.New(service.Spec{Name: serviceName, System: serviceSystem})
+	if err != nil {
+		return err
+	}
+	if err := action(mgr); err != nil {
+		return err
+	}
+
+	fmt.Printf("%s %s %s\n", done, mgr.Kind(), serviceName)
+	return nil
+}
@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// statsCmd shows request and connection pool statistics of a running gateway
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Show request and connection pool statistics of a running gateway",
+	Long: `Show the request counts and latencies of each upstream server of a running
+mcpgate instance, and the connections in the pool of each server with a
+pool_size.
+
+The gateway must have the control endpoint enabled ([gateway.control] in the
+config file).`,
+	RunE: runStats,
+}
+
+func init() {
+	statsCmd.Flags().StringVarP(&configPath, "config", "c", "config.toml", "Path to configuration file")
+}
+
+// statsResult is the part of gateway/stats the command shows
+type statsResult struct {
+	Queued   map[string]int `json:"queued"`
+	Requests map[string]struct {
+		Count     int64   `json:"count"`
+		Errors    int64   `json:"errors"`
+		ErrorRate float64 `json:"error_rate"`
+		LatencyMS struct {
+			P50 float64 `json:"p50"`
+			P99 float64 `json:"p99"`
+		} `json:"latency_ms"`
+	} `json:"requests"`
+	Pools map[string]struct {
+		Size        int    `json:"size"`
+		Open        int    `json:"open"`
+		InUse       int    `json:"in_use"`
+		Waits       int64  `json:"waits"`
+		WaitTime    string `json:"wait_time"`
+		Evictions   int64  `json:"evictions"`
+		CircuitOpen bool   `json:"circuit_open"`
+		Connections []struct {
+			Connected   bool    `json:"connected"`
+			InUse       bool    `json:"in_use"`
+			HealthScore float64 `json:"health_score"`
+			Requests    int     `json:"requests"`
+			Age         string  `json:"age"`
+		} `json:"connections"`
+	} `json:"pools"`
+}
+
+func runStats(cmd *cobra.Command, args []string) error {
+	client, err := newControlClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var stats statsResult
+	if err := callControl(ctx, client, "gateway/stats", nil, &stats); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(stats.Requests))
+	for name := range stats.Requests {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "NAME\tREQUESTS\tERRORS\tP50\tP99\tQUEUED\tPOOL")
+	for _, name := range names {
+		requests := stats.Requests[name]
+		queued := "-"
+		if n, ok := stats.Queued[name]; ok {
+			queued = fmt.Sprint(n)
+		}
+		pool := "-"
+		if p, ok := stats.Pools[name]; ok {
+			pool = fmt.Sprintf("%d/%d in use", p.InUse, p.Size)
+			if p.CircuitOpen {
+				pool += ", cooling down"
+			}
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%d\t%d (%.1f%%)\t%.1fms\t%.1fms\t%s\t%s\n", name, requests.Count, requests.Errors,
+			requests.ErrorRate*100, requests.LatencyMS.P50, requests.LatencyMS.P99, queued, pool)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if len(stats.Pools) == 0 {
+		return nil
+	}
+
+	fmt.Println("\nPools:")
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "NAME\tCONNECTION\tSTATE\tHEALTH\tREQUESTS\tAGE")
+	for _, name := range names {
+		p, ok := stats.Pools[name]
+		if !ok {
+			continue
+		}
+		for i, conn := range p.Connections {
+			state := "idle"
+			switch {
+			case !conn.Connected:
+				state = "disconnected"
+			case conn.InUse:
+				state = "in use"
+			}
+			_, _ = fmt.Fprintf(w, "%s\t%d\t%s\t%.2f\t%d\t%s\n", name, i+1, state, conn.HealthScore, conn.Requests, conn.Age)
+		}
+		if p.Waits > 0 || p.Evictions > 0 {
+			_, _ = fmt.Fprintf(w, "%s\t\twaited %d times for %s, %d evicted\t\t\t\n", name, p.Waits, p.WaitTime, p.Evictions)
+		}
+	}
+	return w.Flush()
+}
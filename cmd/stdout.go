@@ -0,0 +1,25 @@
+package cmd
+
+import (
+	"log"
+	"log/slog"
+	"os"
+
+	"github.com/j4ng5y/mcpgate/logging"
+)
+
+// claimStdout reserves stdout for JSON-RPC frames in server mode. It returns
+// the original stdout for the protocol encoder and points os.Stdout, the
+// standard logger and, where the platform allows, file descriptor 1 at
+// stderr, so a stray print, a logger misconfigured to write to stdout or a
+// child process inheriting it cannot corrupt the protocol stream.
+func claimStdout() *os.File {
+	protocol, err := dupStdout()
+	if err != nil {
+		slog.Warn("Stray output may reach the protocol stream", logging.Err(err))
+		protocol = os.Stdout
+	}
+	os.Stdout = os.Stderr
+	log.SetOutput(os.Stderr)
+	return protocol
+}
@@ -0,0 +1,10 @@
+//go:build unix && !linux && !solaris
+
+package cmd
+
+import "syscall"
+
+// redirectFD makes to refer to the same file as from
+func redirectFD(from, to int) error {
+	return syscall.Dup2(from, to)
+}
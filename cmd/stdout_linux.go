@@ -0,0 +1,9 @@
+package cmd
+
+import "syscall"
+
+// redirectFD makes to refer to the same file as from. Not every Linux
+// architecture has dup2, but all of them have dup3.
+func redirectFD(from, to int) error {
+	return syscall.Dup3(from, to, 0)
+}
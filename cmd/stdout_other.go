@@ -0,0 +1,11 @@
+//go:build !unix || solaris
+
+package cmd
+
+import "os"
+
+// dupStdout leaves descriptor-level redirection to platforms with dup2; the
+// os.Stdout and logger redirection in claimStdout still applies
+func dupStdout() (*os.File, error) {
+	return os.Stdout, nil
+}
@@ -0,0 +1,26 @@
+//go:build unix && !solaris
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// dupStdout duplicates stdout for the protocol stream and then replaces
+// descriptor 1 with stderr
+func dupStdout() (*os.File, error) {
+	stdout := int(os.Stdout.Fd())
+	fd, err := syscall.Dup(stdout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to duplicate stdout: %w", err)
+	}
+	syscall.CloseOnExec(fd)
+
+	if err := redirectFD(int(os.Stderr.Fd()), stdout); err != nil {
+		_ = syscall.Close(fd)
+		return nil, fmt.Errorf("failed to redirect stdout to stderr: %w", err)
+	}
+	return os.NewFile(uintptr(fd), "/dev/stdout"), nil
+}
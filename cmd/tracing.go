@@ -0,0 +1,23 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/j4ng5y/mcpgate/config"
+	"github.com/j4ng5y/mcpgate/tracing"
+)
+
+// startTracing installs a tracer exporting request spans to the configured
+// collector, returning the exporter to flush at shutdown
+func startTracing(cfg config.TracingConfig) *tracing.Exporter {
+	headers := make(map[string]string, len(cfg.Headers))
+	for key, value := range cfg.Headers {
+		headers[key] = os.ExpandEnv(value)
+	}
+	exporter := tracing.NewExporter(cfg.Endpoint, headers, map[string]string{
+		"service.name":    cfg.ServiceName,
+		"service.version": Version,
+	})
+	tracing.SetTracer(tracing.NewTracer(exporter))
+	return exporter
+}
@@ -2,21 +2,371 @@ package config
 
 import (
 	"fmt"
+	"net/url"
 	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/BurntSushi/toml"
+	"github.com/j4ng5y/mcpgate/listener"
+	"github.com/j4ng5y/mcpgate/logging"
 )
 
 // Config represents the gateway configuration
 type Config struct {
-	Gateway GatewayConfig `toml:"gateway"`
+	Gateway GatewayConfig  `toml:"gateway"`
+	Auth    AuthConfig     `toml:"auth"`
 	Servers []ServerConfig `toml:"server"`
+
+	// File the configuration was loaded from, if any
+	Path string `toml:"-"`
 }
 
 // GatewayConfig represents gateway-level configuration
 type GatewayConfig struct {
-	LogLevel string `toml:"log_level"`
-	LogFile  string `toml:"log_file"`
+	LogLevel    string            `toml:"log_level"`  // debug, info (default), warn or error
+	LogFormat   string            `toml:"log_format"` // text (default) or json
+	LogFile     string            `toml:"log_file"`   // Write logs here instead of stderr
+	LogStderr   bool              `toml:"log_stderr"` // Also write logs to stderr when log_file is set
+	LogRotation LogRotationConfig `toml:"log_rotation"`
+	Control     ControlConfig     `toml:"control"`
+	HTTP        ListenConfig      `toml:"http"`      // mcpgate server --http
+	SSE         ListenConfig      `toml:"sse"`       // mcpgate server --sse
+	WebSocket   ListenConfig      `toml:"websocket"` // mcpgate server --websocket
+	Dashboard   DashboardConfig   `toml:"dashboard"`
+	TLS         TLSConfig         `toml:"tls"`  // For the network server modes
+	CORS        CORSConfig        `toml:"cors"` // For the network server modes
+	Quarantine  QuarantineConfig  `toml:"quarantine"`
+	HealthCheck HealthCheckConfig `toml:"health_check"`
+	Retry       RetryConfig       `toml:"retry"`  // Defaults for servers without their own
+	Limits      LimitsConfig      `toml:"limits"` // For requests from downstream clients
+	Tracing     TracingConfig     `toml:"tracing"`
+	Audit       AuditConfig       `toml:"audit"`
+
+	// Expose gateway management operations as mcpgate_* tools
+	ManagementTools bool `toml:"management_tools"`
+
+	// Accept gateway/add_server and gateway/remove_server. Over the network
+	// server modes they also require an authenticated client.
+	AllowRuntimeChanges bool `toml:"allow_runtime_changes"`
+
+	// Reload [[server]] entries when the config file changes on disk
+	WatchConfig bool `toml:"watch_config"`
+
+	// Seconds an --http session may go unused, with no event stream open,
+	// before it ends; -1 keeps sessions until clients delete them
+	SessionIdleTimeout int `toml:"session_idle_timeout"`
+}
+
+// QuarantineConfig controls when repeatedly failing servers are taken out of rotation
+type QuarantineConfig struct {
+	FailureBudget int `toml:"failure_budget"` // Consecutive failures before quarantine; -1 disables
+	RetryInterval int `toml:"retry_interval"` // Seconds between retries while quarantined
+}
+
+// HealthCheckConfig controls the periodic pings that track upstream health
+type HealthCheckConfig struct {
+	Interval           int `toml:"interval"`            // Seconds between pings; -1 disables
+	Timeout            int `toml:"timeout"`             // Seconds to wait for each ping
+	UnhealthyThreshold int `toml:"unhealthy_threshold"` // Missed pings in a row before a server is unhealthy
+}
+
+// RetryConfig controls how connecting to a server is retried, with jittered
+// exponential backoff between attempts
+type RetryConfig struct {
+	MaxRetries int `toml:"max_retries"` // Retries after the first attempt; -1 disables
+	Backoff    int `toml:"backoff"`     // Seconds before the first retry, doubling after each
+	BackoffMax int `toml:"backoff_max"` // Longest wait between retries in seconds
+}
+
+// CORSConfig lists the browser origins allowed to use the network server
+// modes. Requests with an Origin header not listed are refused, so a web page
+// cannot reach a gateway on localhost through DNS rebinding.
+type CORSConfig struct {
+	AllowedOrigins []string `toml:"allowed_origins"` // scheme://host[:port], or "*" for any
+}
+
+// validate checks every origin is "*" or a bare scheme://host[:port]
+func (c CORSConfig) validate() error {
+	for _, origin := range c.AllowedOrigins {
+		if origin == "*" {
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || u.Scheme == "" || u.Host == "" || (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" || u.User != nil {
+			return fmt.Errorf("invalid cors origin %q (must be scheme://host[:port] or \"*\")", origin)
+		}
+	}
+	return nil
+}
+
+// LimitsConfig bounds the requests the gateway accepts from downstream
+// clients on every listener. Zero keeps the default; -1 disables a limit.
+type LimitsConfig struct {
+	MaxRequestSize int `toml:"max_request_size"` // Bytes in a single message (default 4 MiB)
+	MaxParamsDepth int `toml:"max_params_depth"` // Nesting of objects and arrays in params (default 64)
+}
+
+// LogRotationConfig controls when log_file is rotated and how many rotated
+// files are kept. Zero keeps the default; -1 disables a limit.
+type LogRotationConfig struct {
+	MaxSize    int `toml:"max_size"`    // MiB written before rotating (default 100)
+	MaxAge     int `toml:"max_age"`     // Hours written to before rotating (default 168)
+	MaxBackups int `toml:"max_backups"` // Rotated files kept; older ones are removed (default 5)
+}
+
+// validate checks no limit is below -1; name prefixes the errors
+func (c LogRotationConfig) validate(name string) error {
+	if c.MaxSize < -1 {
+		return fmt.Errorf("invalid %s max_size %d (must be positive, or -1 for no limit)", name, c.MaxSize)
+	} else if c.MaxAge < -1 {
+		return fmt.Errorf("invalid %s max_age %d (must be positive, or -1 for no limit)", name, c.MaxAge)
+	} else if c.MaxBackups < -1 {
+		return fmt.Errorf("invalid %s max_backups %d (must be positive, or -1 to keep all)", name, c.MaxBackups)
+	}
+	return nil
+}
+
+// AuditConfig writes one JSON line for every tools/call to file: when, which
+// client and session, the server and tool, the arguments with secrets
+// redacted, the outcome and how long it took
+type AuditConfig struct {
+	File     string            `toml:"file"`     // JSONL file; unset disables the audit log
+	Redact   []string          `toml:"redact"`   // Argument names redacted besides the built-in ones, e.g. "ssn"
+	Rotation LogRotationConfig `toml:"rotation"` // Same defaults as log_rotation
+}
+
+// Enabled reports whether tool calls are audited
+func (c AuditConfig) Enabled() bool {
+	return c.File != ""
+}
+
+// validate checks the rotation limits and redacted names
+func (c AuditConfig) validate() error {
+	for _, name := range c.Redact {
+		if strings.TrimSpace(name) == "" {
+			return fmt.Errorf("invalid audit redact entry %q (must not be empty)", name)
+		}
+	}
+	return c.Rotation.validate("audit rotation")
+}
+
+// DefaultTracingServiceName is the service.name spans are exported under
+const DefaultTracingServiceName = "mcpgate"
+
+// TracingConfig exports a span for every routed request, with a child span
+// for each upstream call, to an OpenTelemetry collector over OTLP/HTTP
+type TracingConfig struct {
+	Endpoint    string            `toml:"endpoint"`     // Collector URL, e.g. http://localhost:4318; unset disables tracing
+	ServiceName string            `toml:"service_name"` // Default "mcpgate"
+	Headers     map[string]string `toml:"headers"`      // Sent with every export; ${VAR} references are expanded
+}
+
+// Enabled reports whether spans are exported
+func (c TracingConfig) Enabled() bool {
+	return c.Endpoint != ""
+}
+
+// validate checks the endpoint is an http or https URL
+func (c TracingConfig) validate() error {
+	if !c.Enabled() {
+		return nil
+	}
+	u, err := url.Parse(c.Endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid tracing endpoint %q (must be an http or https URL)", c.Endpoint)
+	}
+	return nil
+}
+
+// TLSConfig configures TLS on the network server modes (--http, --sse and
+// --websocket). With a client CA, clients must present a certificate it signed.
+type TLSConfig struct {
+	CertFile string `toml:"cert_file"` // PEM certificate chain
+	KeyFile  string `toml:"key_file"`  // PEM private key
+	ClientCA string `toml:"client_ca"` // PEM CA bundle client certificates must chain to
+}
+
+// Enabled reports whether a certificate is configured
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != ""
+}
+
+// AuthConfig lists the credentials clients of the network server modes must
+// present: an API key, as a bearer token or in the X-API-Key header, or an
+// OAuth access token. Clients may be held to policies limiting the servers
+// and tools they use.
+type AuthConfig struct {
+	APIKeys  []string       `toml:"api_keys"`  // ${VAR} references are expanded from the environment
+	KeysFile string         `toml:"keys_file"` // One key per line; blank lines and # comments are skipped
+	OAuth    OAuthConfig    `toml:"oauth"`
+	Clients  []ClientConfig `toml:"clients"`
+}
+
+// ClientConfig names a client and limits what it may use through the
+// gateway. A client is identified by one of its API keys, or by the sub or
+// client_id claim of its OAuth access token; keys and tokens that identify
+// no client may use everything.
+type ClientConfig struct {
+	Name     string   `toml:"name"`
+	APIKeys  []string `toml:"api_keys"` // ${VAR} references are expanded from the environment
+	Subjects []string `toml:"subjects"` // OAuth sub or client_id claims
+	Servers  []string `toml:"servers"`  // Servers or replica groups it may use; all when empty
+	Tools    []string `toml:"tools"`    // Tools it may list and call, with * wildcards; all when empty
+	Admin    bool     `toml:"admin"`    // May add and remove servers at runtime
+}
+
+// Keys returns the client's API keys with ${VAR} references expanded
+func (c *ClientConfig) Keys() []string {
+	var keys []string
+	for _, key := range c.APIKeys {
+		if key = os.ExpandEnv(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// AllowsServer reports whether the client may use the named server or
+// replica group
+func (c *ClientConfig) AllowsServer(name string) bool {
+	return len(c.Servers) == 0 || slices.Contains(c.Servers, name)
+}
+
+// AllowsTool reports whether the client may list and call the named tool
+func (c *ClientConfig) AllowsTool(name string) bool {
+	if len(c.Tools) == 0 {
+		return true
+	}
+	for _, pattern := range c.Tools {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// validateClients checks that every client has a unique name, a way to be
+// identified and valid tool patterns
+func (c AuthConfig) validateClients() error {
+	seen := make(map[string]bool, len(c.Clients))
+	for i, client := range c.Clients {
+		if client.Name == "" {
+			return fmt.Errorf("auth client %d missing required field: name", i)
+		}
+		if seen[client.Name] {
+			return fmt.Errorf("duplicate auth client %q", client.Name)
+		}
+		seen[client.Name] = true
+
+		if len(client.Keys()) == 0 && len(client.Subjects) == 0 {
+			return fmt.Errorf("auth client %q has no api_keys or subjects", client.Name)
+		}
+		for _, pattern := range client.Tools {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("auth client %q: invalid tool pattern %q", client.Name, pattern)
+			}
+		}
+	}
+	return nil
+}
+
+// OAuthConfig makes the gateway an OAuth protected resource, per the MCP
+// authorization spec: clients present access tokens the issuer signed for
+// the gateway's resource URL
+type OAuthConfig struct {
+	Issuer   string   `toml:"issuer"`   // Authorization server tokens come from
+	Resource string   `toml:"resource"` // The gateway's public URL, e.g. https://mcp.example.com/mcp; tokens must name it as audience
+	JWKSURL  string   `toml:"jwks_url"` // Signing keys; discovered from the issuer's metadata when empty
+	Scopes   []string `toml:"scopes"`   // Scopes every token must carry
+}
+
+// Enabled reports whether an issuer is configured
+func (c OAuthConfig) Enabled() bool {
+	return c.Issuer != ""
+}
+
+// validate checks that the issuer and resource are both absolute URLs
+func (c OAuthConfig) validate() error {
+	if c.Issuer == "" && c.Resource == "" && c.JWKSURL == "" && len(c.Scopes) == 0 {
+		return nil
+	}
+	for _, field := range []struct{ name, value string }{{"issuer", c.Issuer}, {"resource", c.Resource}} {
+		if u, err := url.Parse(field.value); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("auth.oauth %s must be an absolute URL, got %q", field.name, field.value)
+		}
+	}
+	return nil
+}
+
+// Keys returns every configured API key, reading keys_file if set
+func (c AuthConfig) Keys() ([]string, error) {
+	var keys []string
+	for _, key := range c.APIKeys {
+		if key = os.ExpandEnv(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+
+	if c.KeysFile != "" {
+		data, err := os.ReadFile(c.KeysFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read keys_file: %w", err)
+		}
+		for line := range strings.Lines(string(data)) {
+			if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+				keys = append(keys, line)
+			}
+		}
+	}
+
+	if len(keys) == 0 && (len(c.APIKeys) > 0 || c.KeysFile != "") {
+		return nil, fmt.Errorf("[auth] has no API keys")
+	}
+	return keys, nil
+}
+
+// ControlConfig configures the optional local control endpoint used by tooling
+type ControlConfig struct {
+	Enabled    bool     `toml:"enabled"`
+	Address    string   `toml:"address"`     // unix:///path/to.sock or 127.0.0.1:port
+	Addresses  []string `toml:"addresses"`   // Additional addresses, e.g. "[::1]:7070"
+	Family     string   `toml:"family"`      // dual (default), ipv4 or ipv6
+	RuntimeDir string   `toml:"runtime_dir"` // Where the socket and auth token live
+}
+
+// ListenAddresses returns the primary address followed by any additional ones
+func (c ControlConfig) ListenAddresses() []string {
+	return append([]string{c.Address}, c.Addresses...)
+}
+
+// ListenConfig configures a network server mode of mcpgate server. Addresses
+// given on the command line replace those configured here.
+type ListenConfig struct {
+	Enabled   bool     `toml:"enabled"`   // Serve this mode without its command-line flag
+	Addresses []string `toml:"addresses"` // e.g. ["127.0.0.1:8080", "[::1]:8080"]
+	Family    string   `toml:"family"`    // dual (default), ipv4 or ipv6
+}
+
+// Default addresses of the network server modes, on loopback so nothing is
+// exposed to other machines unless configured
+const (
+	DefaultHTTPAddress      = "127.0.0.1:8080"
+	DefaultSSEAddress       = "127.0.0.1:8081"
+	DefaultWebSocketAddress = "127.0.0.1:8082"
+)
+
+// DefaultDashboardAddress is where the dashboard listens unless configured
+const DefaultDashboardAddress = "127.0.0.1:7071"
+
+// DashboardConfig configures the optional web dashboard showing server
+// health, the tool catalog and recent requests
+type DashboardConfig struct {
+	Enabled bool   `toml:"enabled"`
+	Address string `toml:"address"` // host:port, 127.0.0.1:7071 by default
 }
 
 // ServerConfig represents a single upstream MCP server configuration
@@ -31,6 +381,214 @@ type ServerConfig struct {
 	SocketPath string                 `toml:"socket_path"`
 	Timeout    int                    `toml:"timeout"`
 	Metadata   map[string]interface{} `toml:"metadata"`
+
+	// Labels for selecting servers by tag, e.g. ["github", "prod"]
+	Tags []string `toml:"tags"`
+
+	// Level the server's records are logged at instead of the gateway's
+	// log_level, e.g. "debug" to troubleshoot one upstream
+	LogLevel string `toml:"log_level"`
+
+	// Weekly windows in local time during which the server is connected and
+	// routable, e.g. "09:00-18:00 Mon-Fri"; empty means always
+	Schedule string `toml:"schedule"`
+
+	// Seconds without requests after which the server is disconnected until
+	// the next request; 0 keeps it connected
+	IdleTimeout int `toml:"idle_timeout"`
+
+	// Requests sent to the server at once (0 is unlimited); further requests wait
+	// in a queue of queue_depth for up to queue_timeout seconds
+	MaxConcurrent int `toml:"max_concurrent"`
+	QueueDepth    int `toml:"queue_depth"`
+	QueueTimeout  int `toml:"queue_timeout"`
+
+	// Extra connections, or subprocesses, opened on demand so requests to the
+	// server run in parallel; 0 sends every request over one connection
+	PoolSize int `toml:"pool_size"`
+
+	// Pooled connections opened when the gateway starts, so the first
+	// requests do not wait for them to connect; at most pool_size
+	PoolWarmUp int `toml:"pool_warm_up"`
+
+	// Seconds a request waits for a pooled connection to be returned while
+	// all are busy, before sharing the server's own; 0 does not wait
+	PoolWait int `toml:"pool_wait"`
+
+	// Which idle pooled connection is closed to make room for a new one when
+	// none is healthy enough to use (lru, least_healthy or oldest; default lru)
+	PoolEviction string `toml:"pool_eviction"`
+
+	// Seconds a pooled connection lives before it is closed, once idle, and
+	// replaced; 0 keeps it as long as it is used
+	MaxConnLifetime int `toml:"max_conn_lifetime"`
+
+	// Seconds the pool stops using its connections once all are unhealthy,
+	// sending requests over the server's own connection instead (default 30)
+	PoolCoolDown int `toml:"pool_cool_down"`
+
+	// Preference among servers that can handle the same request; the highest
+	// available one is used
+	Priority int `toml:"priority"`
+
+	// Identical instances to run, registered as <name>-1 to <name>-N, and the
+	// logical server an instance belongs to; tools/call is balanced across a group
+	Replicas int    `toml:"replicas"`
+	Group    string `toml:"group"`
+
+	// Servers, or replica groups, that must be connected before this one is
+	// started; it is restarted after they are
+	DependsOn []string `toml:"depends_on"`
+
+	// Whether the gateway refuses to start when the server cannot be connected
+	Required bool `toml:"required"`
+
+	// Spare connections kept connected and initialized, one of which takes
+	// over at once when the server's connection is lost
+	Standby int `toml:"standby"`
+
+	// Recent stderr lines kept for gateway/server_status (stdio)
+	StderrLines int `toml:"stderr_lines"`
+
+	// Seconds a stdio server gets to exit after stdin is closed and SIGTERM
+	// is sent, before it is killed; -1 kills immediately
+	ShutdownGrace int `toml:"shutdown_grace"`
+
+	// Responses buffered by the unix and websocket transports, and what to do
+	// when the buffer is full: block (default), drop-oldest or error
+	ResponseBuffer int    `toml:"response_buffer"`
+	OverflowPolicy string `toml:"overflow_policy"`
+
+	// Seconds the unix transport keeps retrying until socket_path accepts connections
+	WaitForSocket int `toml:"wait_for_socket"`
+
+	// Stdio message framing: newline (default) or content-length
+	Framing string `toml:"framing"`
+
+	// Whether stdio subprocesses inherit the gateway's whole environment, and
+	// the extra variables they keep when they do not (a trailing * matches a prefix)
+	InheritEnv   *bool    `toml:"inherit_env"`
+	EnvAllowlist []string `toml:"env_allowlist"`
+
+	// Working directory, and on Unix the user, group and octal umask, for stdio subprocesses
+	Cwd   string `toml:"cwd"`
+	UID   *int   `toml:"uid"`
+	GID   *int   `toml:"gid"`
+	Umask string `toml:"umask"`
+
+	// Container image, extra `docker run` flags and CLI (docker or podman) for the docker transport
+	Image         string   `toml:"image"`
+	DockerArgs    []string `toml:"docker_args"`
+	DockerCommand string   `toml:"docker_command"`
+
+	// Extra headers and bearer token for http, streamable-http and websocket
+	Headers   map[string]string `toml:"headers"`
+	AuthToken string            `toml:"auth_token"`
+
+	// Reconnect automatically when the transport drops; retries of -1 are unlimited
+	AutoReconnect       bool `toml:"auto_reconnect"`
+	ReconnectMaxRetries int  `toml:"reconnect_max_retries"`
+
+	// Connect on the first request routed to the server instead of at startup
+	Lazy bool `toml:"lazy"`
+
+	// Connection retries at startup and on reconnect; unset keys use [gateway.retry]
+	Retry RetryConfig `toml:"retry"`
+
+	// Restart policy for upstreams that crash or drop (always, on-failure or
+	// never) and the restarts allowed in a row; max_restarts of -1 is unlimited
+	Restart     string `toml:"restart"`
+	MaxRestarts int    `toml:"max_restarts"`
+
+	// Static hostname to address overrides and a custom DNS server for remote transports
+	Hosts     map[string]string `toml:"hosts"`
+	DNSServer string            `toml:"dns_server"`
+
+	// Sec-WebSocket-Protocol values offered in the WebSocket handshake
+	Subprotocols []string `toml:"subprotocols"`
+
+	// WebSocket keepalive in seconds; -1 disables
+	PingInterval int `toml:"ping_interval"`
+	ReadTimeout  int `toml:"read_timeout"`
+
+	// Retries of 429 and 503 responses for http and streamable-http (-1
+	// disables), and the longest Retry-After in seconds worth waiting for
+	MaxRetries    int `toml:"max_retries"`
+	MaxRetryDelay int `toml:"max_retry_delay"`
+
+	// Proxy for http, streamable-http and websocket; defaults to HTTP_PROXY/HTTPS_PROXY/NO_PROXY
+	ProxyURL string `toml:"proxy_url"`
+
+	// OAuth2 client-credentials for http and streamable-http upstreams
+	OAuth2 *OAuth2Config `toml:"oauth2"`
+
+	// Remote host for the ssh transport, which runs command there
+	SSH *SSHConfig `toml:"ssh"`
+
+	// HTTP request that health checks an http upstream instead of an MCP ping
+	HealthProbe *HealthProbeConfig `toml:"health_probe"`
+
+	// Static capabilities for upstreams whose initialize result is incomplete
+	Capabilities     []string     `toml:"capabilities"`
+	CapabilitiesMode string       `toml:"capabilities_mode"` // fallback (default) or override
+	Tools            []StaticTool `toml:"tools"`
+}
+
+// OAuth2Config configures the client-credentials grant used to obtain access tokens
+type OAuth2Config struct {
+	TokenURL     string   `toml:"token_url"`
+	ClientID     string   `toml:"client_id"`
+	ClientSecret string   `toml:"client_secret"` // ${VAR} references are expanded
+	Scopes       []string `toml:"scopes"`
+	Audience     string   `toml:"audience"`
+}
+
+// HealthProbeConfig is the request sent to an http upstream to check its health
+type HealthProbeConfig struct {
+	Path           string `toml:"path"`            // Appended to url; default /health
+	Method         string `toml:"method"`          // Default GET
+	ExpectedStatus int    `toml:"expected_status"` // Default any 2xx
+	Interval       int    `toml:"interval"`        // Seconds between probes; default the gateway health check interval
+}
+
+// SSHConfig configures the host and authentication for the ssh transport.
+// Settings from ~/.ssh/config still apply to anything left unset.
+type SSHConfig struct {
+	Host           string   `toml:"host"`
+	Port           int      `toml:"port"`
+	User           string   `toml:"user"`
+	IdentityFile   string   `toml:"identity_file"`
+	Agent          string   `toml:"agent"` // Agent socket path, or "none"; default SSH_AUTH_SOCK
+	KnownHostsFile string   `toml:"known_hosts_file"`
+	Options        []string `toml:"options"` // Extra -o options, e.g. "ProxyJump=bastion"
+	Client         string   `toml:"client"`  // ssh binary; default "ssh"
+}
+
+// Capability modes for statically declared capabilities
+const (
+	CapabilitiesFallback = "fallback"
+	CapabilitiesOverride = "override"
+)
+
+// Restart policies for upstream servers
+const (
+	RestartAlways    = "always"
+	RestartOnFailure = "on-failure"
+	RestartNever     = "never"
+)
+
+// Eviction policies for pooled connections
+const (
+	PoolEvictLRU          = "lru"
+	PoolEvictLeastHealthy = "least_healthy"
+	PoolEvictOldest       = "oldest"
+)
+
+// StaticTool is a tool declared in config for servers that cannot list their own
+type StaticTool struct {
+	Name        string                 `toml:"name" json:"name"`
+	Description string                 `toml:"description" json:"description,omitempty"`
+	InputSchema map[string]interface{} `toml:"input_schema" json:"inputSchema"`
 }
 
 // LoadConfig loads the configuration from a TOML file
@@ -49,19 +607,321 @@ func LoadConfig(path string) (*Config, error) {
 	if cfg.Gateway.LogLevel == "" {
 		cfg.Gateway.LogLevel = "info"
 	}
+	if cfg.Gateway.Quarantine.FailureBudget == 0 {
+		cfg.Gateway.Quarantine.FailureBudget = 5
+	}
+	if cfg.Gateway.Quarantine.RetryInterval == 0 {
+		cfg.Gateway.Quarantine.RetryInterval = 300
+	}
+	if cfg.Gateway.HealthCheck.Interval == 0 {
+		cfg.Gateway.HealthCheck.Interval = 30
+	}
+	if cfg.Gateway.HealthCheck.Timeout == 0 {
+		cfg.Gateway.HealthCheck.Timeout = 5
+	}
+	if cfg.Gateway.HealthCheck.UnhealthyThreshold == 0 {
+		cfg.Gateway.HealthCheck.UnhealthyThreshold = 3
+	}
+	if cfg.Gateway.Retry.MaxRetries == 0 {
+		cfg.Gateway.Retry.MaxRetries = 2
+	}
+	if cfg.Gateway.Retry.Backoff == 0 {
+		cfg.Gateway.Retry.Backoff = 1
+	}
+	if cfg.Gateway.Retry.BackoffMax == 0 {
+		cfg.Gateway.Retry.BackoffMax = 30
+	}
+	if cfg.Gateway.Control.RuntimeDir == "" {
+		cfg.Gateway.Control.RuntimeDir = DefaultRuntimeDir()
+	}
+	if cfg.Gateway.Control.Address == "" {
+		cfg.Gateway.Control.Address = "unix://" + filepath.Join(cfg.Gateway.Control.RuntimeDir, "control.sock")
+	}
+
+	if cfg.Gateway.Dashboard.Address == "" {
+		cfg.Gateway.Dashboard.Address = DefaultDashboardAddress
+	}
+	if len(cfg.Gateway.HTTP.Addresses) == 0 {
+		cfg.Gateway.HTTP.Addresses = []string{DefaultHTTPAddress}
+	}
+	if len(cfg.Gateway.SSE.Addresses) == 0 {
+		cfg.Gateway.SSE.Addresses = []string{DefaultSSEAddress}
+	}
+	if len(cfg.Gateway.WebSocket.Addresses) == 0 {
+		cfg.Gateway.WebSocket.Addresses = []string{DefaultWebSocketAddress}
+	}
+	if cfg.Gateway.SessionIdleTimeout == 0 {
+		cfg.Gateway.SessionIdleTimeout = 1800
+	}
+
+	if _, err := logging.ParseLevel(cfg.Gateway.LogLevel); err != nil {
+		return nil, fmt.Errorf("invalid log_level %q (must be debug, info, warn or error)", cfg.Gateway.LogLevel)
+	}
+	if cfg.Gateway.LogFormat == "" {
+		cfg.Gateway.LogFormat = logging.FormatText
+	}
+	if !logging.ValidFormat(cfg.Gateway.LogFormat) {
+		return nil, fmt.Errorf("invalid log_format %q (must be %q or %q)", cfg.Gateway.LogFormat, logging.FormatText, logging.FormatJSON)
+	}
+
+	if err := cfg.Gateway.LogRotation.validate("log_rotation"); err != nil {
+		return nil, err
+	}
+
+	families := []struct {
+		name   string
+		family string
+	}{
+		{"control", cfg.Gateway.Control.Family},
+		{"http", cfg.Gateway.HTTP.Family},
+		{"sse", cfg.Gateway.SSE.Family},
+		{"websocket", cfg.Gateway.WebSocket.Family},
+	}
+	for _, f := range families {
+		if !listener.ValidFamily(f.family) {
+			return nil, fmt.Errorf("invalid %s family %q (must be %q, %q or %q)",
+				f.name, f.family, listener.FamilyDual, listener.FamilyIPv4, listener.FamilyIPv6)
+		}
+	}
+
+	if err := cfg.Gateway.CORS.validate(); err != nil {
+		return nil, err
+	}
+
+	if cfg.Gateway.Tracing.ServiceName == "" {
+		cfg.Gateway.Tracing.ServiceName = DefaultTracingServiceName
+	}
+	if err := cfg.Gateway.Tracing.validate(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Gateway.Audit.validate(); err != nil {
+		return nil, err
+	}
+
+	if limits := cfg.Gateway.Limits; limits.MaxRequestSize < -1 {
+		return nil, fmt.Errorf("invalid max_request_size %d (must be positive, or -1 for no limit)", limits.MaxRequestSize)
+	} else if limits.MaxParamsDepth < -1 {
+		return nil, fmt.Errorf("invalid max_params_depth %d (must be positive, or -1 for no limit)", limits.MaxParamsDepth)
+	}
+
+	if cfg.Gateway.SessionIdleTimeout < -1 {
+		return nil, fmt.Errorf("invalid session_idle_timeout %d (must be positive, or -1 to keep sessions)", cfg.Gateway.SessionIdleTimeout)
+	}
+
+	if tls := cfg.Gateway.TLS; (tls.CertFile == "") != (tls.KeyFile == "") {
+		return nil, fmt.Errorf("tls cert_file and key_file must be set together")
+	} else if tls.ClientCA != "" && !tls.Enabled() {
+		return nil, fmt.Errorf("tls client_ca requires cert_file and key_file")
+	}
+
+	if _, err := cfg.Auth.Keys(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Auth.OAuth.validate(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Auth.validateClients(); err != nil {
+		return nil, err
+	}
 
 	// Validate servers
 	for i, srv := range cfg.Servers {
 		if srv.Name == "" {
 			return nil, fmt.Errorf("server %d missing required field: name", i)
 		}
-		if srv.Transport == "" {
-			cfg.Servers[i].Transport = "stdio"
-		}
-		if srv.Timeout == 0 {
-			cfg.Servers[i].Timeout = 30
+		if err := cfg.Servers[i].Normalize(); err != nil {
+			return nil, fmt.Errorf("server %s: %w", srv.Name, err)
 		}
 	}
 
+	cfg.Servers = ExpandReplicas(cfg.Servers)
+	if _, err := OrderByDependencies(cfg.Servers); err != nil {
+		return nil, err
+	}
+	cfg.Path = path
 	return &cfg, nil
 }
+
+// Normalize validates the server config and fills in its defaults
+func (srv *ServerConfig) Normalize() error {
+	if srv.Name == "" {
+		return fmt.Errorf("missing required field: name")
+	}
+	if srv.Transport == "" {
+		srv.Transport = "stdio"
+	}
+	if srv.Timeout == 0 {
+		srv.Timeout = 30
+	}
+	if err := normalizeStaticCapabilities(srv); err != nil {
+		return err
+	}
+	if srv.OAuth2 != nil && (srv.OAuth2.TokenURL == "" || srv.OAuth2.ClientID == "") {
+		return fmt.Errorf("oauth2 requires token_url and client_id")
+	}
+	if srv.SSH != nil && srv.SSH.Host == "" {
+		return fmt.Errorf("ssh requires host")
+	}
+	if srv.HealthProbe != nil {
+		if srv.Transport != "http" {
+			return fmt.Errorf("health_probe requires the http transport")
+		}
+		if srv.HealthProbe.Path == "" {
+			srv.HealthProbe.Path = "/health"
+		}
+		if srv.HealthProbe.Method == "" {
+			srv.HealthProbe.Method = "GET"
+		}
+		srv.HealthProbe.Method = strings.ToUpper(srv.HealthProbe.Method)
+		if status := srv.HealthProbe.ExpectedStatus; status != 0 && (status < 100 || status > 599) {
+			return fmt.Errorf("invalid health_probe expected_status %d", status)
+		}
+		if srv.HealthProbe.Interval < 0 {
+			return fmt.Errorf("health_probe interval must not be negative")
+		}
+	}
+	if _, err := logging.ParseLevel(srv.LogLevel); err != nil {
+		return fmt.Errorf("invalid log_level %q (must be debug, info, warn or error)", srv.LogLevel)
+	}
+	if srv.Schedule != "" {
+		if _, err := ParseSchedule(srv.Schedule); err != nil {
+			return err
+		}
+	}
+	if srv.IdleTimeout < 0 {
+		return fmt.Errorf("idle_timeout must not be negative")
+	}
+	if srv.MaxConcurrent < 0 || srv.QueueTimeout < 0 {
+		return fmt.Errorf("max_concurrent and queue_timeout must not be negative")
+	}
+	if srv.PoolSize < 0 {
+		return fmt.Errorf("pool_size must not be negative")
+	}
+	if srv.PoolWarmUp < 0 || srv.PoolWarmUp > srv.PoolSize {
+		return fmt.Errorf("pool_warm_up must be between 0 and pool_size")
+	}
+	if srv.PoolWait < 0 || srv.MaxConnLifetime < 0 || srv.PoolCoolDown < 0 {
+		return fmt.Errorf("pool_wait, max_conn_lifetime and pool_cool_down must not be negative")
+	}
+	switch srv.PoolEviction {
+	case "", PoolEvictLRU, PoolEvictLeastHealthy, PoolEvictOldest:
+	default:
+		return fmt.Errorf("invalid pool_eviction %q (must be %q, %q or %q)",
+			srv.PoolEviction, PoolEvictLRU, PoolEvictLeastHealthy, PoolEvictOldest)
+	}
+	if srv.Replicas < 0 {
+		return fmt.Errorf("replicas must not be negative")
+	}
+	if srv.Required && srv.Lazy {
+		return fmt.Errorf("a required server cannot be lazy")
+	}
+	if srv.Standby < 0 {
+		return fmt.Errorf("standby must not be negative")
+	}
+	switch srv.Restart {
+	case "", RestartAlways, RestartOnFailure, RestartNever:
+	default:
+		return fmt.Errorf("invalid restart policy %q (must be %q, %q or %q)",
+			srv.Restart, RestartAlways, RestartOnFailure, RestartNever)
+	}
+	return nil
+}
+
+// InstanceIDEnv is the environment variable holding a replica's index, from 1
+const InstanceIDEnv = "INSTANCE_ID"
+
+// ExpandReplicas replaces each server with more than one replica by that many
+// instances named <name>-1 to <name>-N, grouped under the server's group or,
+// without one, its name. Every instance of a server with replicas set gets
+// its index in INSTANCE_ID, also substituted for ${INSTANCE_ID} in its args,
+// docker_args, env, cwd and socket_path.
+func ExpandReplicas(servers []ServerConfig) []ServerConfig {
+	expanded := make([]ServerConfig, 0, len(servers))
+	for _, srv := range servers {
+		switch {
+		case srv.Replicas < 1:
+			expanded = append(expanded, srv)
+			continue
+		case srv.Replicas == 1:
+			expanded = append(expanded, instance(srv, 1))
+			continue
+		}
+		if srv.Group == "" {
+			srv.Group = srv.Name
+		}
+		for i := 1; i <= srv.Replicas; i++ {
+			replica := instance(srv, i)
+			replica.Name = fmt.Sprintf("%s-%d", srv.Name, i)
+			expanded = append(expanded, replica)
+		}
+	}
+	return expanded
+}
+
+// instance returns the config of a server's replica with index id, with its
+// own copies of the lists and maps that mention the index
+func instance(srv ServerConfig, id int) ServerConfig {
+	index := strconv.Itoa(id)
+	substitute := strings.NewReplacer("${"+InstanceIDEnv+"}", index).Replace
+
+	substituteAll := func(values []string) []string {
+		if values == nil {
+			return nil
+		}
+		result := make([]string, len(values))
+		for i, value := range values {
+			result[i] = substitute(value)
+		}
+		return result
+	}
+
+	srv.Args = substituteAll(srv.Args)
+	srv.DockerArgs = substituteAll(srv.DockerArgs)
+	srv.Cwd = substitute(srv.Cwd)
+	srv.SocketPath = substitute(srv.SocketPath)
+
+	env := make(map[string]string, len(srv.Env)+1)
+	for key, value := range srv.Env {
+		env[key] = substitute(value)
+	}
+	env[InstanceIDEnv] = index
+	srv.Env = env
+	return srv
+}
+
+// normalizeStaticCapabilities validates static capability settings and fills defaults
+func normalizeStaticCapabilities(srv *ServerConfig) error {
+	switch srv.CapabilitiesMode {
+	case "":
+		srv.CapabilitiesMode = CapabilitiesFallback
+	case CapabilitiesFallback, CapabilitiesOverride:
+	default:
+		return fmt.Errorf("invalid capabilities_mode %q (must be %q or %q)", srv.CapabilitiesMode, CapabilitiesFallback, CapabilitiesOverride)
+	}
+
+	for i, tool := range srv.Tools {
+		if tool.Name == "" {
+			return fmt.Errorf("static tool %d missing required field: name", i)
+		}
+		if tool.InputSchema == nil {
+			srv.Tools[i].InputSchema = map[string]interface{}{"type": "object"}
+		}
+	}
+
+	// Declaring tools implies the tools capability
+	if len(srv.Tools) > 0 && !slices.Contains(srv.Capabilities, "tools") {
+		srv.Capabilities = append(srv.Capabilities, "tools")
+	}
+
+	return nil
+}
+
+// DefaultRuntimeDir returns the per-user directory for runtime files such as
+// sockets and tokens, preferring $XDG_RUNTIME_DIR when set
+func DefaultRuntimeDir() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "mcpgate")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("mcpgate-%d", os.Getuid()))
+}
@@ -1,9 +1,16 @@
 package config
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestLoadConfig_ValidConfig(t *testing.T) {
@@ -111,6 +118,10 @@ enabled = true
 		t.Errorf("Expected default log_level 'info', got '%s'", cfg.Gateway.LogLevel)
 	}
 
+	if retry := cfg.Gateway.Retry; retry.MaxRetries != 2 || retry.Backoff != 1 || retry.BackoffMax != 30 {
+		t.Errorf("Expected default retry 2/1/30, got %+v", retry)
+	}
+
 	server := cfg.Servers[0]
 	if server.Transport != "stdio" {
 		t.Errorf("Expected default transport 'stdio', got '%s'", server.Transport)
@@ -331,3 +342,930 @@ func createTempConfig(content string) (string, error) {
 
 	return f.Name(), nil
 }
+
+func TestLoadConfig_ControlDefaults(t *testing.T) {
+	configContent := `
+[gateway.control]
+enabled = true
+runtime_dir = "/tmp/mcpgate-test-runtime"
+`
+
+	tmpFile, err := createTempConfig(configContent)
+	if err != nil {
+		t.Fatalf("Failed to create temp config: %v", err)
+	}
+	defer func() {
+		_ = os.Remove(tmpFile)
+	}()
+
+	cfg, err := LoadConfig(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	if !cfg.Gateway.Control.Enabled {
+		t.Error("Expected control endpoint to be enabled")
+	}
+
+	expected := "unix://" + filepath.Join("/tmp/mcpgate-test-runtime", "control.sock")
+	if cfg.Gateway.Control.Address != expected {
+		t.Errorf("Expected default address %s, got %s", expected, cfg.Gateway.Control.Address)
+	}
+}
+
+func TestLoadConfig_TLS(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{"cert and key", "[gateway.tls]\ncert_file = \"gateway.pem\"\nkey_file = \"gateway.key\"\n", false},
+		{"mutual TLS", "[gateway.tls]\ncert_file = \"gateway.pem\"\nkey_file = \"gateway.key\"\nclient_ca = \"clients.pem\"\n", false},
+		{"cert without key", "[gateway.tls]\ncert_file = \"gateway.pem\"\n", true},
+		{"client CA without cert", "[gateway.tls]\nclient_ca = \"clients.pem\"\n", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpFile, err := createTempConfig(tt.content)
+			if err != nil {
+				t.Fatalf("Failed to create temp config: %v", err)
+			}
+			defer func() {
+				_ = os.Remove(tmpFile)
+			}()
+
+			cfg, err := LoadConfig(tmpFile)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("Expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to load config: %v", err)
+			}
+			if !cfg.Gateway.TLS.Enabled() {
+				t.Error("Expected TLS to be enabled")
+			}
+		})
+	}
+}
+
+func TestLoadConfig_CORS(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{"origins", "[gateway.cors]\nallowed_origins = [\"https://app.example.com\", \"http://localhost:6274\"]\n", false},
+		{"any", "[gateway.cors]\nallowed_origins = [\"*\"]\n", false},
+		{"no scheme", "[gateway.cors]\nallowed_origins = [\"app.example.com\"]\n", true},
+		{"path", "[gateway.cors]\nallowed_origins = [\"https://app.example.com/mcp\"]\n", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpFile, err := createTempConfig(tt.content)
+			if err != nil {
+				t.Fatalf("Failed to create temp config: %v", err)
+			}
+			defer func() {
+				_ = os.Remove(tmpFile)
+			}()
+
+			_, err = LoadConfig(tmpFile)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_Logging(t *testing.T) {
+	tests := []struct {
+		name       string
+		content    string
+		wantLevel  string
+		wantFormat string
+		wantErr    bool
+	}{
+		{"unset", "", "info", "text", false},
+		{"json", "[gateway]\nlog_level = \"warn\"\nlog_format = \"json\"\n", "warn", "json", false},
+		{"invalid level", "[gateway]\nlog_level = \"verbose\"\n", "", "", true},
+		{"invalid format", "[gateway]\nlog_format = \"xml\"\n", "", "", true},
+		{"rotation", "[gateway]\nlog_file = \"/var/log/mcpgate.log\"\n[gateway.log_rotation]\nmax_size = 10\nmax_age = -1\n", "info", "text", false},
+		{"invalid rotation", "[gateway.log_rotation]\nmax_backups = -3\n", "", "", true},
+		{"server level", "[[server]]\nname = \"files\"\ncommand = \"cat\"\nlog_level = \"debug\"\n", "info", "text", false},
+		{"invalid server level", "[[server]]\nname = \"files\"\ncommand = \"cat\"\nlog_level = \"verbose\"\n", "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpFile, err := createTempConfig(tt.content)
+			if err != nil {
+				t.Fatalf("Failed to create temp config: %v", err)
+			}
+			defer func() {
+				_ = os.Remove(tmpFile)
+			}()
+
+			cfg, err := LoadConfig(tmpFile)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && (cfg.Gateway.LogLevel != tt.wantLevel || cfg.Gateway.LogFormat != tt.wantFormat) {
+				t.Errorf("Expected %s/%s, got %s/%s", tt.wantLevel, tt.wantFormat, cfg.Gateway.LogLevel, cfg.Gateway.LogFormat)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_Tracing(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    TracingConfig
+		wantErr bool
+	}{
+		{"unset", "", TracingConfig{ServiceName: DefaultTracingServiceName}, false},
+		{"set", "[gateway.tracing]\nendpoint = \"http://localhost:4318\"\nservice_name = \"gateway-a\"\n", TracingConfig{Endpoint: "http://localhost:4318", ServiceName: "gateway-a"}, false},
+		{"no scheme", "[gateway.tracing]\nendpoint = \"localhost:4318\"\n", TracingConfig{}, true},
+		{"grpc", "[gateway.tracing]\nendpoint = \"grpc://localhost:4317\"\n", TracingConfig{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpFile, err := createTempConfig(tt.content)
+			if err != nil {
+				t.Fatalf("Failed to create temp config: %v", err)
+			}
+			defer func() {
+				_ = os.Remove(tmpFile)
+			}()
+
+			cfg, err := LoadConfig(tmpFile)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && (cfg.Gateway.Tracing.Endpoint != tt.want.Endpoint || cfg.Gateway.Tracing.ServiceName != tt.want.ServiceName) {
+				t.Errorf("Expected %+v, got %+v", tt.want, cfg.Gateway.Tracing)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_Audit(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		enabled bool
+		redact  []string
+		wantErr bool
+	}{
+		{"unset", "", false, nil, false},
+		{"set", "[gateway.audit]\nfile = \"/var/log/mcpgate/audit.jsonl\"\nredact = [\"ssn\"]\n[gateway.audit.rotation]\nmax_backups = -1\n", true, []string{"ssn"}, false},
+		{"empty redact", "[gateway.audit]\nfile = \"audit.jsonl\"\nredact = [\" \"]\n", false, nil, true},
+		{"invalid rotation", "[gateway.audit.rotation]\nmax_age = -2\n", false, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpFile, err := createTempConfig(tt.content)
+			if err != nil {
+				t.Fatalf("Failed to create temp config: %v", err)
+			}
+			defer func() {
+				_ = os.Remove(tmpFile)
+			}()
+
+			cfg, err := LoadConfig(tmpFile)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if cfg.Gateway.Audit.Enabled() != tt.enabled || !slices.Equal(cfg.Gateway.Audit.Redact, tt.redact) {
+				t.Errorf("Expected enabled %v with redact %v, got %+v", tt.enabled, tt.redact, cfg.Gateway.Audit)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_Limits(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    LimitsConfig
+		wantErr bool
+	}{
+		{"unset", "", LimitsConfig{}, false},
+		{"set", "[gateway.limits]\nmax_request_size = 1048576\nmax_params_depth = 16\n", LimitsConfig{MaxRequestSize: 1048576, MaxParamsDepth: 16}, false},
+		{"disabled", "[gateway.limits]\nmax_request_size = -1\nmax_params_depth = -1\n", LimitsConfig{MaxRequestSize: -1, MaxParamsDepth: -1}, false},
+		{"negative size", "[gateway.limits]\nmax_request_size = -5\n", LimitsConfig{}, true},
+		{"negative depth", "[gateway.limits]\nmax_params_depth = -2\n", LimitsConfig{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpFile, err := createTempConfig(tt.content)
+			if err != nil {
+				t.Fatalf("Failed to create temp config: %v", err)
+			}
+			defer func() {
+				_ = os.Remove(tmpFile)
+			}()
+
+			cfg, err := LoadConfig(tmpFile)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("Expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to load config: %v", err)
+			}
+			if cfg.Gateway.Limits != tt.want {
+				t.Errorf("Expected limits %+v, got %+v", tt.want, cfg.Gateway.Limits)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_SessionIdleTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    int
+		wantErr bool
+	}{
+		{"unset", "", 1800, false},
+		{"set", "[gateway]\nsession_idle_timeout = 60\n", 60, false},
+		{"disabled", "[gateway]\nsession_idle_timeout = -1\n", -1, false},
+		{"negative", "[gateway]\nsession_idle_timeout = -5\n", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpFile, err := createTempConfig(tt.content)
+			if err != nil {
+				t.Fatalf("Failed to create temp config: %v", err)
+			}
+			defer func() {
+				_ = os.Remove(tmpFile)
+			}()
+
+			cfg, err := LoadConfig(tmpFile)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("Expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to load config: %v", err)
+			}
+			if cfg.Gateway.SessionIdleTimeout != tt.want {
+				t.Errorf("Expected session_idle_timeout %d, got %d", tt.want, cfg.Gateway.SessionIdleTimeout)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_ListenModes(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    ListenConfig
+		wantErr bool
+	}{
+		{"unset", "", ListenConfig{Addresses: []string{DefaultHTTPAddress}}, false},
+		{
+			"set",
+			"[gateway.http]\nenabled = true\naddresses = [\"127.0.0.1:9000\", \"[::1]:9000\"]\nfamily = \"ipv6\"\n",
+			ListenConfig{Enabled: true, Addresses: []string{"127.0.0.1:9000", "[::1]:9000"}, Family: "ipv6"},
+			false,
+		},
+		{"invalid family", "[gateway.http]\nfamily = \"ipx\"\n", ListenConfig{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpFile, err := createTempConfig(tt.content)
+			if err != nil {
+				t.Fatalf("Failed to create temp config: %v", err)
+			}
+			defer func() {
+				_ = os.Remove(tmpFile)
+			}()
+
+			cfg, err := LoadConfig(tmpFile)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("Expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to load config: %v", err)
+			}
+			got := cfg.Gateway.HTTP
+			if got.Enabled != tt.want.Enabled || !slices.Equal(got.Addresses, tt.want.Addresses) || got.Family != tt.want.Family {
+				t.Errorf("Expected [gateway.http] %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_OAuth(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{"issuer and resource", "[auth.oauth]\nissuer = \"https://auth.example.com\"\nresource = \"https://mcp.example.com/mcp\"\nscopes = [\"mcp\"]\n", false},
+		{"missing resource", "[auth.oauth]\nissuer = \"https://auth.example.com\"\n", true},
+		{"relative issuer", "[auth.oauth]\nissuer = \"auth.example.com\"\nresource = \"https://mcp.example.com/mcp\"\n", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpFile, err := createTempConfig(tt.content)
+			if err != nil {
+				t.Fatalf("Failed to create temp config: %v", err)
+			}
+			defer func() {
+				_ = os.Remove(tmpFile)
+			}()
+
+			cfg, err := LoadConfig(tmpFile)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("Expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to load config: %v", err)
+			}
+			if !cfg.Auth.OAuth.Enabled() {
+				t.Error("Expected OAuth to be enabled")
+			}
+		})
+	}
+}
+
+func TestLoadConfig_AuthClients(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{"key and subject", "[[auth.clients]]\nname = \"ci\"\napi_keys = [\"ci-key\"]\nsubjects = [\"ci-bot\"]\nservers = [\"github\"]\ntools = [\"create_*\"]\n", false},
+		{"missing name", "[[auth.clients]]\napi_keys = [\"ci-key\"]\n", true},
+		{"duplicate name", "[[auth.clients]]\nname = \"ci\"\napi_keys = [\"a\"]\n[[auth.clients]]\nname = \"ci\"\napi_keys = [\"b\"]\n", true},
+		{"no credentials", "[[auth.clients]]\nname = \"ci\"\napi_keys = [\"${MCPGATE_TEST_UNSET}\"]\n", true},
+		{"bad tool pattern", "[[auth.clients]]\nname = \"ci\"\napi_keys = [\"ci-key\"]\ntools = [\"[\"]\n", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpFile, err := createTempConfig(tt.content)
+			if err != nil {
+				t.Fatalf("Failed to create temp config: %v", err)
+			}
+			defer func() {
+				_ = os.Remove(tmpFile)
+			}()
+
+			_, err = LoadConfig(tmpFile)
+			if tt.wantErr && err == nil {
+				t.Error("Expected error")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Failed to load config: %v", err)
+			}
+		})
+	}
+}
+
+func TestClientConfig_Allows(t *testing.T) {
+	client := &ClientConfig{Name: "ci", Servers: []string{"github"}, Tools: []string{"create_*", "list_issues"}}
+
+	if !client.AllowsServer("github") || client.AllowsServer("filesystem") {
+		t.Error("Expected only github allowed")
+	}
+	for tool, want := range map[string]bool{"create_issue": true, "list_issues": true, "delete_repo": false} {
+		if got := client.AllowsTool(tool); got != want {
+			t.Errorf("AllowsTool(%q) = %v, want %v", tool, got, want)
+		}
+	}
+
+	unrestricted := &ClientConfig{Name: "admin"}
+	if !unrestricted.AllowsServer("filesystem") || !unrestricted.AllowsTool("delete_repo") {
+		t.Error("Expected a client without limits to use everything")
+	}
+}
+
+func TestAuthConfig_Keys(t *testing.T) {
+	t.Setenv("MCPGATE_TEST_KEY", "from-env")
+	keysFile := filepath.Join(t.TempDir(), "keys")
+	if err := os.WriteFile(keysFile, []byte("# agents\nfrom-file\n\n  padded  \n"), 0o600); err != nil {
+		t.Fatalf("Failed to write keys file: %v", err)
+	}
+
+	auth := AuthConfig{APIKeys: []string{"static", "${MCPGATE_TEST_KEY}"}, KeysFile: keysFile}
+	keys, err := auth.Keys()
+	if err != nil {
+		t.Fatalf("Keys failed: %v", err)
+	}
+	if !slices.Equal(keys, []string{"static", "from-env", "from-file", "padded"}) {
+		t.Errorf("Unexpected keys: %v", keys)
+	}
+
+	if keys, err := (AuthConfig{}).Keys(); err != nil || len(keys) != 0 {
+		t.Errorf("Expected no keys without [auth], got %v, %v", keys, err)
+	}
+	if _, err := (AuthConfig{APIKeys: []string{"${MCPGATE_TEST_UNSET}"}}).Keys(); err == nil {
+		t.Error("Expected error when every key is empty")
+	}
+	if _, err := (AuthConfig{KeysFile: filepath.Join(t.TempDir(), "missing")}).Keys(); err == nil {
+		t.Error("Expected error for a missing keys_file")
+	}
+}
+
+func TestLoadConfig_StaticCapabilities(t *testing.T) {
+	configContent := `
+[[server]]
+name = "legacy"
+command = "legacy-server"
+capabilities = ["resources"]
+capabilities_mode = "override"
+
+[[server.tools]]
+name = "search"
+description = "Search documents"
+`
+
+	tmpFile, err := createTempConfig(configContent)
+	if err != nil {
+		t.Fatalf("Failed to create temp config: %v", err)
+	}
+	defer func() {
+		_ = os.Remove(tmpFile)
+	}()
+
+	cfg, err := LoadConfig(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	server := cfg.Servers[0]
+	if server.CapabilitiesMode != CapabilitiesOverride {
+		t.Errorf("Expected capabilities_mode override, got %s", server.CapabilitiesMode)
+	}
+
+	if len(server.Capabilities) != 2 || server.Capabilities[1] != "tools" {
+		t.Errorf("Expected tools capability to be implied, got %v", server.Capabilities)
+	}
+
+	if len(server.Tools) != 1 || server.Tools[0].Name != "search" {
+		t.Fatalf("Expected static tool 'search', got %v", server.Tools)
+	}
+
+	if server.Tools[0].InputSchema["type"] != "object" {
+		t.Errorf("Expected default input schema, got %v", server.Tools[0].InputSchema)
+	}
+}
+
+func TestLoadConfig_InvalidCapabilitiesMode(t *testing.T) {
+	configContent := `
+[[server]]
+name = "legacy"
+command = "legacy-server"
+capabilities_mode = "sometimes"
+`
+
+	tmpFile, err := createTempConfig(configContent)
+	if err != nil {
+		t.Fatalf("Failed to create temp config: %v", err)
+	}
+	defer func() {
+		_ = os.Remove(tmpFile)
+	}()
+
+	if _, err := LoadConfig(tmpFile); err == nil {
+		t.Fatal("Expected error for invalid capabilities_mode")
+	}
+}
+
+func TestLoadConfig_InvalidRestartPolicy(t *testing.T) {
+	configContent := `
+[[server]]
+name = "crashy"
+command = "crashy-server"
+restart = "sometimes"
+`
+
+	tmpFile, err := createTempConfig(configContent)
+	if err != nil {
+		t.Fatalf("Failed to create temp config: %v", err)
+	}
+	defer func() {
+		_ = os.Remove(tmpFile)
+	}()
+
+	if _, err := LoadConfig(tmpFile); err == nil || !strings.Contains(err.Error(), "restart") {
+		t.Fatalf("Expected error for invalid restart policy, got %v", err)
+	}
+}
+
+func TestLoadConfig_SSH(t *testing.T) {
+	configContent := `
+[[server]]
+name = "remote"
+transport = "ssh"
+command = "mcp-server"
+
+[server.ssh]
+host = "build.example.com"
+port = 2222
+identity_file = "~/.ssh/id_ed25519"
+options = ["ProxyJump=bastion"]
+
+[[server]]
+name = "hostless"
+transport = "ssh"
+command = "mcp-server"
+
+[server.ssh]
+user = "deploy"
+`
+
+	tmpFile, err := createTempConfig(configContent)
+	if err != nil {
+		t.Fatalf("Failed to create temp config: %v", err)
+	}
+	defer func() {
+		_ = os.Remove(tmpFile)
+	}()
+
+	if _, err := LoadConfig(tmpFile); err == nil || !strings.Contains(err.Error(), "hostless") {
+		t.Fatalf("Expected error for ssh without host, got %v", err)
+	}
+
+	valid := strings.SplitN(configContent, "[[server]]\nname = \"hostless\"", 2)[0]
+	if err := os.WriteFile(tmpFile, []byte(valid), 0600); err != nil {
+		t.Fatalf("Failed to rewrite config: %v", err)
+	}
+
+	cfg, err := LoadConfig(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	ssh := cfg.Servers[0].SSH
+	if ssh == nil || ssh.Host != "build.example.com" || ssh.Port != 2222 || len(ssh.Options) != 1 {
+		t.Errorf("Unexpected ssh config %+v", ssh)
+	}
+}
+
+func TestLoadConfig_Replicas(t *testing.T) {
+	configContent := `
+[[server]]
+name = "python"
+command = "python-server"
+args = ["--port", "900${INSTANCE_ID}"]
+replicas = 3
+
+[server.env]
+WORKER = "worker-${INSTANCE_ID}"
+
+[[server]]
+name = "remote-a"
+transport = "http"
+url = "http://a.example.com/mcp"
+group = "remote"
+
+[[server]]
+name = "single"
+command = "cat"
+replicas = 1
+`
+
+	tmpFile, err := createTempConfig(configContent)
+	if err != nil {
+		t.Fatalf("Failed to create temp config: %v", err)
+	}
+	defer func() {
+		_ = os.Remove(tmpFile)
+	}()
+
+	cfg, err := LoadConfig(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	expected := []struct{ name, group string }{
+		{"python-1", "python"},
+		{"python-2", "python"},
+		{"python-3", "python"},
+		{"remote-a", "remote"},
+		{"single", ""},
+	}
+	if len(cfg.Servers) != len(expected) {
+		t.Fatalf("Expected %d servers, got %d", len(expected), len(cfg.Servers))
+	}
+	for i, want := range expected {
+		if got := cfg.Servers[i]; got.Name != want.name || got.Group != want.group {
+			t.Errorf("Server %d: expected %s in group %q, got %s in group %q", i, want.name, want.group, got.Name, got.Group)
+		}
+	}
+
+	for i, srv := range cfg.Servers[:3] {
+		id := strconv.Itoa(i + 1)
+		if srv.Env[InstanceIDEnv] != id || srv.Env["WORKER"] != "worker-"+id || srv.Args[1] != "900"+id {
+			t.Errorf("Expected %s to be instance %s, got env %v and args %v", srv.Name, id, srv.Env, srv.Args)
+		}
+	}
+	if single := cfg.Servers[4]; single.Env[InstanceIDEnv] != "1" {
+		t.Errorf("Expected a single replica to be instance 1, got env %v", single.Env)
+	}
+	if remote := cfg.Servers[3]; remote.Env != nil {
+		t.Errorf("Expected a server without replicas to keep its env, got %v", remote.Env)
+	}
+
+	srv := ServerConfig{Name: "bad", Command: "cat", Replicas: -1}
+	if err := srv.Normalize(); err == nil {
+		t.Error("Expected error for negative replicas")
+	}
+}
+
+func TestOrderByDependencies(t *testing.T) {
+	servers := []ServerConfig{
+		{Name: "query", DependsOn: []string{"db", "cache"}},
+		{Name: "cache-1", Group: "cache"},
+		{Name: "db", DependsOn: []string{"cache"}},
+		{Name: "cache-2", Group: "cache"},
+		{Name: "standalone"},
+	}
+
+	ordered, err := OrderByDependencies(servers)
+	if err != nil {
+		t.Fatalf("Failed to order servers: %v", err)
+	}
+	var names []string
+	for _, srv := range ordered {
+		names = append(names, srv.Name)
+	}
+	expected := []string{"cache-1", "cache-2", "db", "query", "standalone"}
+	if !slices.Equal(names, expected) {
+		t.Errorf("Expected order %v, got %v", expected, names)
+	}
+
+	if _, err := OrderByDependencies([]ServerConfig{{Name: "query", DependsOn: []string{"db"}}}); err == nil {
+		t.Error("Expected error for an unknown dependency")
+	}
+
+	cycle := []ServerConfig{
+		{Name: "a", DependsOn: []string{"b"}},
+		{Name: "b", DependsOn: []string{"c"}},
+		{Name: "c", DependsOn: []string{"a"}},
+	}
+	if _, err := OrderByDependencies(cycle); err == nil || !strings.Contains(err.Error(), "a -> b -> c -> a") {
+		t.Errorf("Expected error naming the cycle, got %v", err)
+	}
+}
+
+func TestServerConfig_RequiredNotLazy(t *testing.T) {
+	srv := ServerConfig{Name: "critical", Command: "cat", Required: true, Lazy: true}
+	if err := srv.Normalize(); err == nil {
+		t.Error("Expected error for a required lazy server")
+	}
+}
+
+func TestServerConfig_Pool(t *testing.T) {
+	srv := ServerConfig{Name: "python", Command: "cat", PoolSize: 2, PoolWarmUp: 2}
+	if err := srv.Normalize(); err != nil {
+		t.Fatalf("Expected warm-up within pool_size to be valid: %v", err)
+	}
+
+	srv.PoolWarmUp = 3
+	if err := srv.Normalize(); err == nil {
+		t.Error("Expected error for pool_warm_up over pool_size")
+	}
+
+	srv.PoolWarmUp = 0
+	srv.PoolEviction = "random"
+	if err := srv.Normalize(); err == nil {
+		t.Error("Expected error for an unknown pool_eviction")
+	}
+
+	srv.PoolEviction = ""
+	srv.PoolCoolDown = -1
+	if err := srv.Normalize(); err == nil {
+		t.Error("Expected error for a negative pool_cool_down")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte("[gateway]\n"), 0o600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changed := make(chan struct{}, 1)
+	go Watch(ctx, path, 10*time.Millisecond, func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	})
+
+	// Nothing changed yet
+	select {
+	case <-changed:
+		t.Fatal("Expected no change before the file is written")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := os.WriteFile(path, []byte("[gateway]\nlog_level = \"debug\"\n"), 0o600); err != nil {
+		t.Fatalf("Failed to rewrite config: %v", err)
+	}
+
+	select {
+	case <-changed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected a change after the file was rewritten")
+	}
+}
+
+func TestParseServer(t *testing.T) {
+	srv, entry, err := ParseServer([]byte(`{
+		"name": "fs",
+		"command": "npx",
+		"args": ["-y", "server-filesystem"],
+		"env": {"DEBUG": "1"},
+		"timeout": 10,
+		"tools": [{"name": "read_file"}]
+	}`))
+	if err != nil {
+		t.Fatalf("ParseServer failed: %v", err)
+	}
+
+	if srv.Name != "fs" || srv.Transport != "stdio" || !srv.Enabled || srv.Timeout != 10 {
+		t.Errorf("Unexpected server config: %+v", srv)
+	}
+	if len(srv.Args) != 2 || srv.Env["DEBUG"] != "1" || len(srv.Tools) != 1 {
+		t.Errorf("Expected args, env and tools to be decoded, got %+v", srv)
+	}
+
+	// The entry round-trips through the config file
+	path, err := createTempConfig("[gateway]\nlog_level = \"info\"")
+	if err != nil {
+		t.Fatalf("Failed to create temp config: %v", err)
+	}
+	defer func() {
+		_ = os.Remove(path)
+	}()
+
+	if err := AppendServer(path, entry); err != nil {
+		t.Fatalf("AppendServer failed: %v", err)
+	}
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("Failed to load appended config: %v", err)
+	}
+	if len(cfg.Servers) != 1 || cfg.Servers[0].Name != "fs" || cfg.Servers[0].Timeout != 10 || !cfg.Servers[0].Enabled {
+		t.Errorf("Expected the appended server in the config, got %+v", cfg.Servers)
+	}
+}
+
+func TestParseServer_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"not an object":  `["fs"]`,
+		"missing name":   `{"command": "npx"}`,
+		"unknown field":  `{"name": "fs", "comand": "npx"}`,
+		"wrong type":     `{"name": "fs", "timeout": "10"}`,
+		"invalid policy": `{"name": "fs", "restart": "sometimes"}`,
+	}
+	for name, data := range tests {
+		if _, _, err := ParseServer([]byte(data)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestRemoveServer(t *testing.T) {
+	content := `[gateway]
+log_level = "info"
+
+# Filesystem access
+[[server]]
+name = "files"
+command = "npx"
+
+[server.env]
+ROOT = "/tmp"
+
+# Web search
+[[server]]
+name = "search"
+command = "search-mcp"
+`
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	if err := RemoveServer(path, "files"); err != nil {
+		t.Fatalf("RemoveServer failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read config: %v", err)
+	}
+	expected := `[gateway]
+log_level = "info"
+
+# Web search
+[[server]]
+name = "search"
+command = "search-mcp"
+`
+	if string(data) != expected {
+		t.Errorf("Unexpected config after removal:\n%s", data)
+	}
+
+	if err := RemoveServer(path, "files"); err == nil {
+		t.Error("Expected removing a missing server to fail")
+	}
+}
+
+func TestParseSchedule(t *testing.T) {
+	// 2026-10-12 is a Monday
+	at := func(day int, clock string) time.Time {
+		parsed, err := time.ParseInLocation("2006-01-02 15:04", fmt.Sprintf("2026-10-%02d %s", day, clock), time.Local)
+		if err != nil {
+			t.Fatalf("Invalid test time: %v", err)
+		}
+		return parsed
+	}
+
+	tests := []struct {
+		spec   string
+		time   time.Time
+		active bool
+	}{
+		{"09:00-18:00 Mon-Fri", at(12, "09:00"), true},
+		{"09:00-18:00 Mon-Fri", at(12, "17:59"), true},
+		{"09:00-18:00 Mon-Fri", at(12, "18:00"), false},
+		{"09:00-18:00 Mon-Fri", at(12, "08:59"), false},
+		{"09:00-18:00 Mon-Fri", at(17, "12:00"), false},
+		{"09:00-18:00", at(18, "12:00"), true},
+		{"08:00-12:00 Mon,Wed-Fri; 10:00-14:00 Sat", at(13, "09:00"), false},
+		{"08:00-12:00 Mon,Wed-Fri; 10:00-14:00 Sat", at(14, "09:00"), true},
+		{"08:00-12:00 Mon,Wed-Fri; 10:00-14:00 Sat", at(17, "13:00"), true},
+		{"22:00-06:00 Fri", at(16, "23:00"), true},
+		{"22:00-06:00 Fri", at(17, "05:00"), true},
+		{"22:00-06:00 Fri", at(17, "23:00"), false},
+		{"22:00-06:00 Fri", at(16, "05:00"), false},
+		{"00:00-24:00 Sat-Sun", at(18, "23:59"), true},
+		{"00:00-24:00 Fri-Mon", at(14, "12:00"), false},
+		{"00:00-24:00 Fri-Mon", at(12, "12:00"), true},
+	}
+
+	for _, tt := range tests {
+		schedule, err := ParseSchedule(tt.spec)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", tt.spec, err)
+		}
+		if got := schedule.Active(tt.time); got != tt.active {
+			t.Errorf("%q at %s: expected active %v, got %v", tt.spec, tt.time.Format("Mon 15:04"), tt.active, got)
+		}
+	}
+}
+
+func TestParseSchedule_Invalid(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"9-17",
+		"09:00-18:00 Mon-Fri extra",
+		"09:00-09:00",
+		"25:00-26:00",
+		"09:60-10:00",
+		"9:00-18:00",
+		"09:00-18:00 Monday",
+		"09:00-18:00 Mon-Funday",
+		"09:00-18:00;",
+	} {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Errorf("Expected %q to be rejected", spec)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// OrderByDependencies returns the servers ordered so that each comes after
+// everything in its depends_on, keeping config order otherwise. A dependency
+// names a server or a replica group; an unknown name or servers depending on
+// each other are errors.
+func OrderByDependencies(servers []ServerConfig) ([]ServerConfig, error) {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	state := make([]int, len(servers))
+	ordered := make([]ServerConfig, 0, len(servers))
+	var path []string
+
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch state[i] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("servers depend on each other: %s -> %s", strings.Join(path, " -> "), servers[i].Name)
+		}
+
+		state[i] = visiting
+		path = append(path, servers[i].Name)
+		for _, dependency := range servers[i].DependsOn {
+			targets := dependencyTargets(servers, dependency)
+			if len(targets) == 0 {
+				return fmt.Errorf("server %s depends on unknown server %q", servers[i].Name, dependency)
+			}
+			for _, target := range targets {
+				if err := visit(target); err != nil {
+					return err
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[i] = visited
+
+		ordered = append(ordered, servers[i])
+		return nil
+	}
+
+	for i := range servers {
+		if err := visit(i); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
+
+// dependencyTargets returns the indexes of the servers a dependency names:
+// the server of that name, or otherwise every server in that group
+func dependencyTargets(servers []ServerConfig, dependency string) []int {
+	for i, srv := range servers {
+		if srv.Name == dependency {
+			return []int{i}
+		}
+	}
+
+	var targets []int
+	for i, srv := range servers {
+		if srv.Group == dependency {
+			targets = append(targets, i)
+		}
+	}
+	return targets
+}
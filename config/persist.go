@@ -0,0 +1,244 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// ParseServer decodes a server entry given as a JSON object with the same
+// keys as a [[server]] table in config.toml, validates it and fills in its
+// defaults. An entry that leaves out enabled is enabled. The entry is also
+// returned as a TOML [[server]] table, ready for AppendServer.
+func ParseServer(data []byte) (ServerConfig, []byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var fields map[string]interface{}
+	if err := decoder.Decode(&fields); err != nil {
+		return ServerConfig{}, nil, fmt.Errorf("invalid server entry: %w", err)
+	}
+	if fields == nil {
+		return ServerConfig{}, nil, fmt.Errorf("invalid server entry: expected an object")
+	}
+	if _, ok := fields["enabled"]; !ok {
+		fields["enabled"] = true
+	}
+
+	var entry bytes.Buffer
+	table := map[string]interface{}{
+		"server": []map[string]interface{}{tomlValue(fields).(map[string]interface{})},
+	}
+	if err := toml.NewEncoder(&entry).Encode(table); err != nil {
+		return ServerConfig{}, nil, fmt.Errorf("invalid server entry: %w", err)
+	}
+
+	var cfg Config
+	meta, err := toml.Decode(entry.String(), &cfg)
+	if err != nil {
+		return ServerConfig{}, nil, fmt.Errorf("invalid server entry: %w", err)
+	}
+	if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+		keys := make([]string, len(undecoded))
+		for i, key := range undecoded {
+			keys[i] = strings.TrimPrefix(key.String(), "server.")
+		}
+		return ServerConfig{}, nil, fmt.Errorf("invalid server entry: unknown fields %s", strings.Join(keys, ", "))
+	}
+
+	srv := cfg.Servers[0]
+	if err := srv.Normalize(); err != nil {
+		return ServerConfig{}, nil, err
+	}
+	return srv, entry.Bytes(), nil
+}
+
+// tomlValue converts a decoded JSON value to one the TOML encoder writes with
+// the type the config expects, e.g. integers rather than floats
+func tomlValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = tomlValue(item)
+		}
+		return v
+	case []interface{}:
+		// Arrays of objects, such as static tools, become arrays of tables
+		tables := make([]map[string]interface{}, 0, len(v))
+		for i, item := range v {
+			v[i] = tomlValue(item)
+			if table, ok := v[i].(map[string]interface{}); ok {
+				tables = append(tables, table)
+			}
+		}
+		if len(v) > 0 && len(tables) == len(v) {
+			return tables
+		}
+		return v
+	default:
+		return value
+	}
+}
+
+// AppendServer appends a [[server]] table produced by ParseServer to the
+// config file at path, leaving the rest of the file, comments included, as is
+func AppendServer(path string, entry []byte) error {
+	existing, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open config file: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if len(existing) > 0 {
+		if !bytes.HasSuffix(existing, []byte("\n")) {
+			buf.WriteByte('\n')
+		}
+		buf.WriteByte('\n')
+	}
+	buf.Write(entry)
+
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	return nil
+}
+
+// RemoveServer deletes the [[server]] table named name from the config file
+// at path, together with the comment lines directly above it. The rest of the
+// file is left as is.
+func RemoveServer(path, name string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	lines := strings.SplitAfter(string(data), "\n")
+	start, end := -1, -1
+	for _, block := range serverBlocks(lines) {
+		var table struct {
+			Servers []struct {
+				Name string `toml:"name"`
+			} `toml:"server"`
+		}
+		if _, err := toml.Decode(strings.Join(lines[block[0]:block[1]], ""), &table); err != nil {
+			continue
+		}
+		if len(table.Servers) == 1 && table.Servers[0].Name == name {
+			start, end = block[0], block[1]
+			break
+		}
+	}
+	if start < 0 {
+		return fmt.Errorf("server %s not found in config file", name)
+	}
+
+	// Take the comments describing the server and the blank lines after it
+	for start > 0 && strings.HasPrefix(strings.TrimSpace(lines[start-1]), "#") {
+		start--
+	}
+	for end < len(lines) && strings.TrimSpace(lines[end]) == "" {
+		end++
+	}
+	updated := strings.Join(lines[:start], "") + strings.Join(lines[end:], "")
+
+	// Refuse to write a file that no longer parses the same way
+	var before, after Config
+	if _, err := toml.Decode(string(data), &before); err != nil {
+		return fmt.Errorf("failed to parse config file: %w", err)
+	}
+	if _, err := toml.Decode(updated, &after); err != nil || len(after.Servers) != len(before.Servers)-1 {
+		return fmt.Errorf("server %s could not be removed from config file", name)
+	}
+
+	return writeFileAtomic(path, []byte(updated))
+}
+
+// serverBlocks returns the [start, end) line ranges of the [[server]] tables
+// in lines, sub-tables such as [server.env] included. Each range ends after
+// the table's last key, so comments leading into the next table are excluded.
+func serverBlocks(lines []string) [][2]int {
+	var blocks [][2]int
+	start, last := -1, -1
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "" || strings.HasPrefix(trimmed, "#"):
+			continue
+		case isTableHeader(trimmed, "[[server]]"):
+			if start >= 0 {
+				blocks = append(blocks, [2]int{start, last + 1})
+			}
+			start = i
+		case strings.HasPrefix(trimmed, "[") && !strings.HasPrefix(trimmed, "[server.") && !strings.HasPrefix(trimmed, "[[server."):
+			if start >= 0 {
+				blocks = append(blocks, [2]int{start, last + 1})
+			}
+			start = -1
+		}
+		last = i
+	}
+	if start >= 0 {
+		blocks = append(blocks, [2]int{start, last + 1})
+	}
+	return blocks
+}
+
+// isTableHeader reports whether line is header, ignoring a trailing comment
+func isTableHeader(line, header string) bool {
+	if !strings.HasPrefix(line, header) {
+		return false
+	}
+	rest := strings.TrimSpace(strings.TrimPrefix(line, header))
+	return rest == "" || strings.HasPrefix(rest, "#")
+}
+
+// writeFileAtomic replaces the file at path with data, keeping its permissions
+func writeFileAtomic(path string, data []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to stat config file: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	return nil
+}
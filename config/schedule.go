@@ -0,0 +1,139 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Schedule is a set of weekly time windows, in local time, during which a
+// server is available
+type Schedule struct {
+	windows []scheduleWindow
+}
+
+// scheduleWindow is a daily time range on a set of weekdays. A range that
+// ends before it starts runs past midnight into the next day.
+type scheduleWindow struct {
+	start, end time.Duration // Since midnight
+	days       [7]bool       // Indexed by time.Weekday
+}
+
+// scheduleDays maps day abbreviations to weekdays
+var scheduleDays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// ParseSchedule parses windows such as "09:00-18:00 Mon-Fri". Several windows
+// are separated by semicolons, days are listed with commas and ranges, e.g.
+// "08:00-12:00 Mon,Wed-Fri; 10:00-14:00 Sat", and a window without days
+// applies every day.
+func ParseSchedule(spec string) (*Schedule, error) {
+	var schedule Schedule
+	for _, part := range strings.Split(spec, ";") {
+		fields := strings.Fields(part)
+		if len(fields) == 0 || len(fields) > 2 {
+			return nil, fmt.Errorf("invalid schedule window %q: expected HH:MM-HH:MM and optional days", strings.TrimSpace(part))
+		}
+
+		window, err := parseWindowTimes(fields[0])
+		if err != nil {
+			return nil, err
+		}
+		if len(fields) == 1 {
+			window.days = [7]bool{true, true, true, true, true, true, true}
+		} else if window.days, err = parseWindowDays(fields[1]); err != nil {
+			return nil, err
+		}
+		schedule.windows = append(schedule.windows, window)
+	}
+	return &schedule, nil
+}
+
+// parseWindowTimes parses the HH:MM-HH:MM range of a window
+func parseWindowTimes(spec string) (scheduleWindow, error) {
+	from, to, ok := strings.Cut(spec, "-")
+	if !ok {
+		return scheduleWindow{}, fmt.Errorf("invalid schedule times %q: expected HH:MM-HH:MM", spec)
+	}
+	start, err := parseClock(from)
+	if err != nil {
+		return scheduleWindow{}, err
+	}
+	end, err := parseClock(to)
+	if err != nil {
+		return scheduleWindow{}, err
+	}
+	if start == end {
+		return scheduleWindow{}, fmt.Errorf("invalid schedule times %q: window is empty", spec)
+	}
+	return scheduleWindow{start: start, end: end}, nil
+}
+
+// parseClock parses HH:MM into the time since midnight; 24:00 is midnight at
+// the end of the day
+func parseClock(spec string) (time.Duration, error) {
+	var hours, minutes int
+	if n, err := fmt.Sscanf(spec, "%d:%d", &hours, &minutes); err != nil || n != 2 || len(spec) != 5 ||
+		hours < 0 || minutes < 0 || minutes > 59 || hours > 24 || (hours == 24 && minutes != 0) {
+		return 0, fmt.Errorf("invalid schedule time %q: expected HH:MM", spec)
+	}
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute, nil
+}
+
+// parseWindowDays parses a comma separated list of days and day ranges
+func parseWindowDays(spec string) ([7]bool, error) {
+	var days [7]bool
+	for _, item := range strings.Split(spec, ",") {
+		from, to, isRange := strings.Cut(item, "-")
+		first, ok := scheduleDays[strings.ToLower(from)]
+		if !ok {
+			return days, fmt.Errorf("invalid schedule day %q", from)
+		}
+		last := first
+		if isRange {
+			if last, ok = scheduleDays[strings.ToLower(to)]; !ok {
+				return days, fmt.Errorf("invalid schedule day %q", to)
+			}
+		}
+		// Ranges may wrap around the week, e.g. Fri-Mon
+		for day := first; ; day = (day + 1) % 7 {
+			days[day] = true
+			if day == last {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+// Active reports whether t falls within one of the schedule's windows
+func (s *Schedule) Active(t time.Time) bool {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	sinceMidnight := t.Sub(midnight)
+	today := t.Weekday()
+	yesterday := (today + 6) % 7
+
+	for _, window := range s.windows {
+		if window.start < window.end {
+			if window.days[today] && sinceMidnight >= window.start && sinceMidnight < window.end {
+				return true
+			}
+			continue
+		}
+		// Overnight: the part after midnight belongs to the previous day's window
+		if window.days[today] && sinceMidnight >= window.start {
+			return true
+		}
+		if window.days[yesterday] && sinceMidnight < window.end {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,42 @@
+package config
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// DefaultWatchInterval is how often Watch checks the config file for changes
+const DefaultWatchInterval = 2 * time.Second
+
+// Watch polls the file at path every interval and calls onChange whenever its
+// modification time or size changes, until ctx is done. Polling keeps the
+// gateway free of platform-specific file notification APIs, and survives
+// editors that replace the file instead of writing it in place.
+func Watch(ctx context.Context, path string, interval time.Duration, onChange func()) {
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+
+	last, _ := os.Stat(path)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			// The file may be mid-replacement; check again next tick
+			continue
+		}
+		if last == nil || !info.ModTime().Equal(last.ModTime()) || info.Size() != last.Size() {
+			last = info
+			onChange()
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package control
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/j4ng5y/mcpgate/config"
+	"github.com/j4ng5y/mcpgate/mcp"
+)
+
+// Client calls gateway methods on a running gateway's control endpoint
+type Client struct {
+	httpClient *http.Client
+	baseURL    string
+	token      string
+}
+
+// NewClient creates a client for the control endpoint described by cfg,
+// reading the auth token from the runtime directory
+func NewClient(cfg config.ControlConfig) (*Client, error) {
+	data, err := os.ReadFile(filepath.Join(cfg.RuntimeDir, TokenFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read control token (is the gateway running with [gateway.control] enabled?): %w", err)
+	}
+
+	client := &Client{
+		token:      strings.TrimSpace(string(data)),
+		httpClient: &http.Client{},
+		baseURL:    "http://" + cfg.Address,
+	}
+
+	if path, ok := strings.CutPrefix(cfg.Address, "unix://"); ok {
+		client.baseURL = "http://control"
+		client.httpClient.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", path)
+			},
+		}
+	}
+
+	return client, nil
+}
+
+// Call invokes a gateway method and returns its JSON-RPC response
+func (c *Client) Call(ctx context.Context, method string, params interface{}) (*mcp.Response, error) {
+	request := mcp.Request{
+		JSONRPC: "2.0",
+		ID:      1,
+		Method:  method,
+	}
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal params: %w", err)
+		}
+		request.Params = data
+	}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/rpc", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.token)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("control request failed: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("control error %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+
+	var response mcp.Response
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return &response, nil
+}
@@ -0,0 +1,21 @@
+//go:build !unix
+
+package control
+
+import (
+	"fmt"
+	"os"
+)
+
+// checkRuntimeDir refuses a runtime directory that is a symlink. Ownership
+// and permissions are left to the platform's ACLs.
+func checkRuntimeDir(dir string) error {
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return fmt.Errorf("failed to inspect runtime directory: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("runtime directory %s is not a directory", dir)
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+//go:build unix
+
+package control
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// checkRuntimeDir refuses a runtime directory that is a symlink, belongs to
+// another user or is open to other users, as whoever controls it can read or
+// replace the control token
+func checkRuntimeDir(dir string) error {
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return fmt.Errorf("failed to inspect runtime directory: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("runtime directory %s is not a directory", dir)
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok && int(stat.Uid) != os.Getuid() {
+		return fmt.Errorf("runtime directory %s is owned by uid %d, not %d", dir, stat.Uid, os.Getuid())
+	}
+	if perm := info.Mode().Perm(); perm&0077 != 0 {
+		return fmt.Errorf("runtime directory %s has mode %04o (must not be accessible to other users)", dir, perm)
+	}
+	return nil
+}
@@ -0,0 +1,269 @@
+package control
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/j4ng5y/mcpgate/config"
+	"github.com/j4ng5y/mcpgate/listener"
+	"github.com/j4ng5y/mcpgate/logging"
+	"github.com/j4ng5y/mcpgate/mcp"
+)
+
+// TokenFile is the name of the auth token file inside the runtime directory
+const TokenFile = "control.token"
+
+// controlMethods are the gateway methods exposed over the control endpoint:
+// the read-only ones, plus reconnecting a wedged server
+var controlMethods = map[string]bool{
+	"gateway/list_servers":     true,
+	"gateway/get_server":       true,
+	"gateway/server_status":    true,
+	"gateway/capabilities":     true,
+	"gateway/stats":            true,
+	"gateway/reconnect_server": true,
+}
+
+// Server exposes gateway introspection methods on a local socket, separate
+// from the agent's protocol stream
+type Server struct {
+	config     config.ControlConfig
+	router     *mcp.Router
+	token      string
+	tokenPath  string
+	listeners  []net.Listener
+	httpServer *http.Server
+}
+
+// NewServer creates a new control server
+func NewServer(cfg config.ControlConfig, router *mcp.Router) *Server {
+	return &Server{
+		config: cfg,
+		router: router,
+	}
+}
+
+// Start generates an auth token, writes it to the runtime directory and starts listening
+func (s *Server) Start() error {
+	if err := os.MkdirAll(s.config.RuntimeDir, 0700); err != nil {
+		return fmt.Errorf("failed to create runtime directory: %w", err)
+	}
+	if err := checkRuntimeDir(s.config.RuntimeDir); err != nil {
+		return err
+	}
+
+	token, err := generateToken()
+	if err != nil {
+		return fmt.Errorf("failed to generate control token: %w", err)
+	}
+
+	s.token = token
+	s.tokenPath = filepath.Join(s.config.RuntimeDir, TokenFile)
+	if err := writeToken(s.tokenPath, token); err != nil {
+		return fmt.Errorf("failed to write control token: %w", err)
+	}
+
+	listeners, err := listen(s.config.ListenAddresses(), s.config.Family)
+	if err != nil {
+		return err
+	}
+	s.listeners = listeners
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rpc", s.handleRPC)
+
+	s.httpServer = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	for _, l := range listeners {
+		go func(l net.Listener) {
+			if err := s.httpServer.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				slog.Error("Control server error", logging.Err(err))
+			}
+		}(l)
+		slog.Info("Control endpoint listening", "address", listener.Addr(l))
+	}
+
+	return nil
+}
+
+// Stop shuts down the control server and removes the token file
+func (s *Server) Stop(ctx context.Context) error {
+	if s.httpServer == nil {
+		return nil
+	}
+
+	err := s.httpServer.Shutdown(ctx)
+
+	if removeErr := os.Remove(s.tokenPath); removeErr != nil && !os.IsNotExist(removeErr) {
+		slog.Warn("Error removing control token", logging.Err(removeErr))
+	}
+	for _, address := range s.config.ListenAddresses() {
+		if path, ok := strings.CutPrefix(address, listener.UnixPrefix); ok {
+			if removeErr := os.Remove(path); removeErr != nil && !os.IsNotExist(removeErr) {
+				slog.Warn("Error removing control socket", logging.Err(removeErr))
+			}
+		}
+	}
+
+	return err
+}
+
+// Addr returns the primary address the control server is listening on
+func (s *Server) Addr() string {
+	if len(s.listeners) == 0 {
+		return s.config.Address
+	}
+	return listener.Addr(s.listeners[0])
+}
+
+// Addrs returns every address the control server is listening on
+func (s *Server) Addrs() []string {
+	addrs := make([]string, 0, len(s.listeners))
+	for _, l := range s.listeners {
+		addrs = append(addrs, listener.Addr(l))
+	}
+	return addrs
+}
+
+// Token returns the bearer token clients must present
+func (s *Server) Token() string {
+	return s.token
+}
+
+// handleRPC serves a single JSON-RPC request over HTTP POST
+func (s *Server) handleRPC(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !s.authorized(req) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var request mcp.Request
+	body := http.MaxBytesReader(w, req.Body, mcp.DefaultMaxRequestSize)
+	if err := json.NewDecoder(body).Decode(&request); err != nil {
+		writeResponse(w, &mcp.Response{
+			JSONRPC: "2.0",
+			Error: &mcp.JSONRPCError{
+				Code:    mcp.ParseError,
+				Message: "Parse error",
+			},
+		})
+		return
+	}
+
+	if !controlMethods[request.Method] {
+		writeResponse(w, &mcp.Response{
+			JSONRPC: "2.0",
+			ID:      request.ID,
+			Error: &mcp.JSONRPCError{
+				Code:    mcp.MethodNotFound,
+				Message: "Method not available on control endpoint: " + request.Method,
+			},
+		})
+		return
+	}
+
+	resp := s.router.Route(req.Context(), &request)
+	if resp == nil {
+		// Notifications are not answered
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	writeResponse(w, resp)
+}
+
+// authorized checks the bearer token on a control request
+func (s *Server) authorized(req *http.Request) bool {
+	token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1
+}
+
+// writeResponse encodes a JSON-RPC response
+func writeResponse(w http.ResponseWriter, resp *mcp.Response) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		slog.Warn("Error encoding control response", logging.Err(err))
+	}
+}
+
+// listen opens the control listeners, refusing anything but unix sockets and loopback addresses
+func listen(addresses []string, family string) ([]net.Listener, error) {
+	for _, address := range addresses {
+		if _, _, err := net.SplitHostPort(address); err != nil && !strings.HasPrefix(address, listener.UnixPrefix) {
+			return nil, fmt.Errorf("invalid control address %q: %w", address, err)
+		}
+		if !listener.IsLocal(address) {
+			return nil, fmt.Errorf("control address %q must be a loopback address", address)
+		}
+	}
+
+	listeners, err := listener.Open(addresses, family)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open control endpoint: %w", err)
+	}
+
+	for _, address := range addresses {
+		if path, ok := strings.CutPrefix(address, listener.UnixPrefix); ok {
+			if err := os.Chmod(path, 0600); err != nil {
+				for _, l := range listeners {
+					_ = l.Close()
+				}
+				return nil, fmt.Errorf("failed to restrict control socket permissions: %w", err)
+			}
+		}
+	}
+
+	return listeners, nil
+}
+
+// writeToken writes the token to a new file only the current user can read,
+// created exclusively so an existing file or symlink is never written
+// through, and renames it into place
+func writeToken(path, token string) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(token + "\n")
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+	}
+	return err
+}
+
+// generateToken returns a random hex-encoded token
+func generateToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
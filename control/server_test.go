@@ -0,0 +1,298 @@
+package control
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/j4ng5y/mcpgate/config"
+	"github.com/j4ng5y/mcpgate/mcp"
+	"github.com/j4ng5y/mcpgate/server"
+)
+
+func newTestServer(t *testing.T, address string) *Server {
+	t.Helper()
+
+	manager := server.NewManager(&config.Config{})
+	if err := manager.Start(); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+
+	srv := NewServer(config.ControlConfig{
+		Enabled:    true,
+		Address:    address,
+		RuntimeDir: filepath.Join(t.TempDir(), "mcpgate"),
+	}, mcp.NewRouter(manager))
+
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Failed to start control server: %v", err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = srv.Stop(ctx)
+	})
+
+	return srv
+}
+
+func call(t *testing.T, srv *Server, token string, method string) (*http.Response, *mcp.Response) {
+	t.Helper()
+
+	body, _ := json.Marshal(mcp.Request{JSONRPC: "2.0", ID: 1, Method: method})
+	req, err := http.NewRequest(http.MethodPost, "http://"+srv.Addr()+"/rpc", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return resp, nil
+	}
+
+	var rpcResp mcp.Response
+	if err := json.NewDecoder(resp.Body).Decode(&rpcResp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	return resp, &rpcResp
+}
+
+func TestServer_TokenWrittenToRuntimeDir(t *testing.T) {
+	srv := newTestServer(t, "127.0.0.1:0")
+
+	data, err := os.ReadFile(filepath.Join(srv.config.RuntimeDir, TokenFile))
+	if err != nil {
+		t.Fatalf("Failed to read token file: %v", err)
+	}
+
+	if strings.TrimSpace(string(data)) != srv.Token() {
+		t.Error("Token file does not match server token")
+	}
+
+	info, err := os.Stat(filepath.Join(srv.config.RuntimeDir, TokenFile))
+	if err != nil {
+		t.Fatalf("Failed to stat token file: %v", err)
+	}
+	if info.Mode().Perm()&0077 != 0 && os.PathSeparator == '/' {
+		t.Errorf("Token file should not be accessible by others, got %v", info.Mode().Perm())
+	}
+}
+
+func TestServer_RefusesUnsafeRuntimeDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires Unix permissions")
+	}
+
+	open := t.TempDir()
+	if err := os.Chmod(open, 0755); err != nil {
+		t.Fatalf("Failed to chmod: %v", err)
+	}
+	private := filepath.Join(t.TempDir(), "private")
+	if err := os.Mkdir(private, 0700); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	link := filepath.Join(t.TempDir(), "link")
+	if err := os.Symlink(private, link); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	manager := server.NewManager(&config.Config{})
+	if err := manager.Start(); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+	for name, dir := range map[string]string{"open to others": open, "symlink": link} {
+		srv := NewServer(config.ControlConfig{
+			Enabled:    true,
+			Address:    "127.0.0.1:0",
+			RuntimeDir: dir,
+		}, mcp.NewRouter(manager))
+		if err := srv.Start(); err == nil {
+			_ = srv.Stop(context.Background())
+			t.Errorf("Expected a runtime directory %s to be refused", name)
+		}
+		if _, err := os.Stat(filepath.Join(dir, TokenFile)); err == nil {
+			t.Errorf("Expected no token written to a runtime directory %s", name)
+		}
+	}
+}
+
+func TestServer_TokenReplacesExistingFile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires symlinks")
+	}
+
+	dir := t.TempDir()
+	target := filepath.Join(t.TempDir(), "target")
+	if err := os.WriteFile(target, []byte("untouched"), 0644); err != nil {
+		t.Fatalf("Failed to write target: %v", err)
+	}
+	if err := os.Symlink(target, filepath.Join(dir, TokenFile)); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	if err := writeToken(filepath.Join(dir, TokenFile), "secret"); err != nil {
+		t.Fatalf("writeToken failed: %v", err)
+	}
+	if data, _ := os.ReadFile(target); string(data) != "untouched" {
+		t.Errorf("Expected the symlink target left alone, got %q", data)
+	}
+	info, err := os.Lstat(filepath.Join(dir, TokenFile))
+	if err != nil || !info.Mode().IsRegular() || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected a regular 0600 token file, got %v (%v)", info, err)
+	}
+}
+
+func TestServer_RequiresToken(t *testing.T) {
+	srv := newTestServer(t, "127.0.0.1:0")
+
+	resp, _ := call(t, srv, "", "gateway/list_servers")
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without token, got %d", resp.StatusCode)
+	}
+
+	resp, _ = call(t, srv, "wrong", "gateway/list_servers")
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected 401 with wrong token, got %d", resp.StatusCode)
+	}
+}
+
+func TestServer_ReadOnlyMethods(t *testing.T) {
+	srv := newTestServer(t, "127.0.0.1:0")
+
+	_, rpcResp := call(t, srv, srv.Token(), "gateway/list_servers")
+	if rpcResp == nil || rpcResp.Error != nil {
+		t.Fatalf("Expected gateway/list_servers to succeed, got %+v", rpcResp)
+	}
+
+	// Reconnecting is allowed, so an unknown server is the router's error
+	_, rpcResp = call(t, srv, srv.Token(), "gateway/reconnect_server")
+	if rpcResp == nil || rpcResp.Error == nil || rpcResp.Error.Code == mcp.MethodNotFound {
+		t.Errorf("Expected gateway/reconnect_server to reach the router, got %+v", rpcResp)
+	}
+
+	_, rpcResp = call(t, srv, srv.Token(), "tools/call")
+	if rpcResp == nil || rpcResp.Error == nil {
+		t.Fatal("Expected tools/call to be rejected")
+	}
+	if rpcResp.Error.Code != mcp.MethodNotFound {
+		t.Errorf("Expected error code %d, got %d", mcp.MethodNotFound, rpcResp.Error.Code)
+	}
+}
+
+func TestServer_UnixSocket(t *testing.T) {
+	dir, err := os.MkdirTemp("", "ctl")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	socketPath := filepath.Join(dir, "c.sock")
+	srv := newTestServer(t, "unix://"+socketPath)
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", socketPath)
+			},
+		},
+	}
+
+	body, _ := json.Marshal(mcp.Request{JSONRPC: "2.0", ID: 1, Method: "gateway/capabilities"})
+	req, _ := http.NewRequest(http.MethodPost, "http://control/rpc", bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+srv.Token())
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Request over unix socket failed: %v", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected 200, got %d", resp.StatusCode)
+	}
+}
+
+func TestListen_RejectsNonLoopback(t *testing.T) {
+	if _, err := listen([]string{"127.0.0.1:0", "0.0.0.0:0"}, ""); err == nil {
+		t.Fatal("Expected error for non-loopback address")
+	}
+}
+
+func TestClient_Call(t *testing.T) {
+	srv := newTestServer(t, "127.0.0.1:0")
+
+	client, err := NewClient(config.ControlConfig{
+		Address:    srv.Addr(),
+		RuntimeDir: srv.config.RuntimeDir,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	resp, err := client.Call(context.Background(), "gateway/list_servers", nil)
+	if err != nil {
+		t.Fatalf("Call failed: %v", err)
+	}
+	if resp.Error != nil {
+		t.Fatalf("Unexpected error: %v", resp.Error.Message)
+	}
+}
+
+func TestClient_MissingToken(t *testing.T) {
+	_, err := NewClient(config.ControlConfig{
+		Address:    "127.0.0.1:1",
+		RuntimeDir: t.TempDir(),
+	})
+	if err == nil {
+		t.Fatal("Expected error when token file is missing")
+	}
+}
+
+func TestServer_MultipleAddresses(t *testing.T) {
+	manager := server.NewManager(&config.Config{})
+	srv := NewServer(config.ControlConfig{
+		Enabled:    true,
+		Address:    "127.0.0.1:0",
+		Addresses:  []string{"unix://" + filepath.Join(t.TempDir(), "control.sock")},
+		RuntimeDir: filepath.Join(t.TempDir(), "mcpgate"),
+	}, mcp.NewRouter(manager))
+
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Failed to start control server: %v", err)
+	}
+	defer func() {
+		_ = srv.Stop(context.Background())
+	}()
+
+	addrs := srv.Addrs()
+	if len(addrs) != 2 || addrs[0] != srv.Addr() {
+		t.Fatalf("Expected two listen addresses with the primary first, got %v", addrs)
+	}
+
+	resp, body := call(t, srv, srv.Token(), "gateway/list_servers")
+	if resp.StatusCode != http.StatusOK || body.Error != nil {
+		t.Errorf("Expected call on primary address to succeed, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,180 @@
+// Package dashboard serves a small web UI showing the gateway's servers,
+// tool catalog and recent requests
+package dashboard
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/j4ng5y/mcpgate/config"
+	"github.com/j4ng5y/mcpgate/listener"
+	"github.com/j4ng5y/mcpgate/logging"
+	"github.com/j4ng5y/mcpgate/mcp"
+)
+
+// OverviewPath serves everything the dashboard shows as JSON; the page
+// polls it
+const OverviewPath = "/api/overview"
+
+//go:embed index.html
+var indexHTML []byte
+
+// Server serves the dashboard page and the overview it renders
+type Server struct {
+	config     config.DashboardConfig
+	router     *mcp.Router
+	listener   net.Listener
+	httpServer *http.Server
+}
+
+// overview is the state of the gateway the dashboard renders
+type overview struct {
+	Servers  interface{}         `json:"servers"` // Result of gateway/list_servers
+	Stats    interface{}         `json:"stats"`   // Result of gateway/stats
+	Tools    []mcp.CatalogTool   `json:"tools"`
+	Requests []mcp.RequestRecord `json:"requests"`
+}
+
+// NewServer creates a dashboard server for router
+func NewServer(cfg config.DashboardConfig, router *mcp.Router) *Server {
+	return &Server{
+		config: cfg,
+		router: router,
+	}
+}
+
+// Start opens the listener and starts serving. The dashboard has no
+// authentication, so an address reachable from other machines logs a warning.
+func (s *Server) Start() error {
+	if _, _, err := net.SplitHostPort(s.config.Address); err != nil {
+		return fmt.Errorf("invalid dashboard address %q: %w", s.config.Address, err)
+	}
+	listeners, err := listener.Open([]string{s.config.Address}, "")
+	if err != nil {
+		return fmt.Errorf("failed to open dashboard listener: %w", err)
+	}
+	s.listener = listeners[0]
+	listener.WarnIfExposed("dashboard", []string{s.config.Address}, false)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.handleIndex)
+	mux.HandleFunc(OverviewPath, s.handleOverview)
+
+	s.httpServer = &http.Server{
+		Handler:           s.checkHost(mux),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		if err := s.httpServer.Serve(s.listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Dashboard server error", logging.Err(err))
+		}
+	}()
+	slog.Info("Dashboard listening", "url", "http://"+s.listener.Addr().String()+"/")
+
+	return nil
+}
+
+// Stop shuts down the dashboard server
+func (s *Server) Stop(ctx context.Context) error {
+	if s.httpServer == nil {
+		return nil
+	}
+	return s.httpServer.Shutdown(ctx)
+}
+
+// Addr returns the address the dashboard is listening on
+func (s *Server) Addr() string {
+	if s.listener == nil {
+		return s.config.Address
+	}
+	return s.listener.Addr().String()
+}
+
+// checkHost refuses requests naming the dashboard by a host it does not
+// answer to. The dashboard has no authentication, so a page whose own name
+// was rebound to the dashboard's address must not be able to read it.
+func (s *Server) checkHost(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !s.allowsHost(req.Host) {
+			http.Error(w, "forbidden host", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// allowsHost reports whether host, from a request's Host header, names the
+// dashboard by an IP address, localhost or the host it was configured with.
+// DNS rebinding needs a name of the attacker's, so none of these can be one.
+func (s *Server) allowsHost(host string) bool {
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		host = name
+	}
+	host = strings.TrimSuffix(strings.Trim(host, "[]"), ".")
+	if host == "" {
+		return false
+	}
+	if net.ParseIP(host) != nil || strings.EqualFold(host, "localhost") {
+		return true
+	}
+	configured, _, _ := net.SplitHostPort(s.config.Address)
+	return strings.EqualFold(host, configured)
+}
+
+// handleIndex serves the dashboard page
+func (s *Server) handleIndex(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != "/" {
+		http.NotFound(w, req)
+		return
+	}
+	if req.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "default-src 'self'; script-src 'unsafe-inline'; style-src 'unsafe-inline'")
+	if _, err := w.Write(indexHTML); err != nil {
+		slog.Warn("Error writing dashboard page", logging.Err(err))
+	}
+}
+
+// handleOverview serves the servers, stats, tool catalog and recent requests
+func (s *Server) handleOverview(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	result := overview{
+		Servers:  s.route(req.Context(), "gateway/list_servers"),
+		Stats:    s.route(req.Context(), "gateway/stats"),
+		Tools:    s.router.ToolCatalog(),
+		Requests: s.router.RecentRequests(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		slog.Warn("Error encoding dashboard overview", logging.Err(err))
+	}
+}
+
+// route calls a gateway method and returns its result, or nil on error
+func (s *Server) route(ctx context.Context, method string) interface{} {
+	resp := s.router.Route(ctx, &mcp.Request{JSONRPC: "2.0", ID: "dashboard", Method: method})
+	if resp == nil || resp.Error != nil {
+		return nil
+	}
+	return resp.Result
+}
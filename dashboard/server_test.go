@@ -0,0 +1,126 @@
+package dashboard
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/j4ng5y/mcpgate/config"
+	"github.com/j4ng5y/mcpgate/internal/mcptest"
+	"github.com/j4ng5y/mcpgate/mcp"
+	"github.com/j4ng5y/mcpgate/server"
+)
+
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+
+	manager := server.NewManager(&config.Config{
+		Servers: []config.ServerConfig{{
+			Name:             "search",
+			Transport:        "stdio",
+			Enabled:          true,
+			Command:          mcptest.EchoCommand,
+			Args:             mcptest.EchoArgs(),
+			Lazy:             true,
+			Capabilities:     []string{"tools"},
+			CapabilitiesMode: config.CapabilitiesOverride,
+			Tools:            []config.StaticTool{{Name: "web_search"}},
+		}},
+	})
+	if err := manager.Start(); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+	t.Cleanup(manager.Stop)
+
+	srv := NewServer(config.DashboardConfig{Enabled: true, Address: "127.0.0.1:0"}, mcp.NewRouter(manager))
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Failed to start dashboard: %v", err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = srv.Stop(ctx)
+	})
+
+	return srv
+}
+
+func TestServer_Index(t *testing.T) {
+	srv := newTestServer(t)
+
+	resp, err := http.Get("http://" + srv.Addr() + "/")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") || !strings.Contains(string(body), "api/overview") {
+		t.Errorf("Expected the dashboard page, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	resp, err = http.Get("http://" + srv.Addr() + "/missing")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown path, got %d", resp.StatusCode)
+	}
+}
+
+func TestServer_RefusesOtherHosts(t *testing.T) {
+	srv := newTestServer(t)
+
+	for host, want := range map[string]int{
+		srv.Addr():                   http.StatusOK,
+		"localhost:7071":             http.StatusOK,
+		"[::1]:7071":                 http.StatusOK,
+		"attacker.example:7071":      http.StatusForbidden,
+		"attacker.example.localhost": http.StatusForbidden,
+	} {
+		req, _ := http.NewRequest(http.MethodGet, "http://"+srv.Addr()+OverviewPath, nil)
+		req.Host = host
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET failed: %v", err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("Expected %d for host %s, got %d", want, host, resp.StatusCode)
+		}
+	}
+}
+
+func TestServer_Overview(t *testing.T) {
+	srv := newTestServer(t)
+
+	resp, err := http.Get("http://" + srv.Addr() + OverviewPath)
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	var result struct {
+		Servers []map[string]interface{} `json:"servers"`
+		Stats   map[string]interface{}   `json:"stats"`
+		Tools   []mcp.CatalogTool        `json:"tools"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("Failed to decode overview: %v", err)
+	}
+	if len(result.Servers) != 1 || result.Servers[0]["name"] != "search" {
+		t.Errorf("Expected the search server, got %v", result.Servers)
+	}
+	if result.Stats["servers"] != float64(1) {
+		t.Errorf("Expected stats for one server, got %v", result.Stats)
+	}
+	if len(result.Tools) != 1 || result.Tools[0].Name != "web_search" {
+		t.Errorf("Expected the web_search tool, got %+v", result.Tools)
+	}
+}
@@ -249,8 +249,11 @@ func (c *CodexCLI) InjectHTTP(serverURL string, serverName string, options map[s
 		"url": serverURL,
 	}
 
-	// Add any additional options
+	// Add any additional options; Codex reads headers from http_headers
 	for key, value := range options {
+		if key == OptionHeaders {
+			key = "http_headers"
+		}
 		serverConfig[key] = value
 	}
 
@@ -1,10 +1,14 @@
 package inject
 
 import (
+	"context"
 	"errors"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestManager_RegisterAgent(t *testing.T) {
@@ -486,6 +490,37 @@ func TestCodexCLI_InjectHTTP_MemoryConfig(t *testing.T) {
 	}
 }
 
+func TestInjectHTTP_APIKey(t *testing.T) {
+	tmpDir := t.TempDir()
+	cursor := NewCursor()
+	cursor.configPath = filepath.Join(tmpDir, "cursor_config.json")
+	codexcli := NewCodexCLI()
+	codexcli.configPath = filepath.Join(tmpDir, "codex_config.toml")
+
+	for _, agent := range []Agent{cursor, codexcli} {
+		if err := agent.InjectHTTP("http://localhost:8080/mcp", "mcpgate", APIKeyOptions("secret")); err != nil {
+			t.Fatalf("Failed to inject into %s: %v", agent.Name(), err)
+		}
+	}
+
+	data, err := os.ReadFile(cursor.configPath)
+	if err != nil {
+		t.Fatalf("Failed to read Cursor config: %v", err)
+	}
+	if !strings.Contains(string(data), `"headers"`) || !strings.Contains(string(data), "Bearer secret") {
+		t.Errorf("Expected the key in Cursor's headers, got %s", data)
+	}
+
+	// Codex names the same setting http_headers
+	data, err = os.ReadFile(codexcli.configPath)
+	if err != nil {
+		t.Fatalf("Failed to read Codex config: %v", err)
+	}
+	if !strings.Contains(string(data), "http_headers") || !strings.Contains(string(data), "Bearer secret") {
+		t.Errorf("Expected the key in Codex's http_headers, got %s", data)
+	}
+}
+
 func TestCodexCLI_InjectStdio_MemoryConfig(t *testing.T) {
 	tmpDir := t.TempDir()
 	configPath := filepath.Join(tmpDir, "codex_config.toml")
@@ -536,3 +571,213 @@ func TestManager_EjectAll_NoAgents(t *testing.T) {
 		t.Fatalf("Expected no error, got %v", err)
 	}
 }
+
+func TestValidateStdio_Success(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+
+	script := `read line; echo '{"jsonrpc":"2.0","id":1,"result":{"capabilities":{}}}'`
+	if err := ValidateStdio(context.Background(), "sh", []string{"-c", script}); err != nil {
+		t.Fatalf("Expected validation to succeed, got %v", err)
+	}
+}
+
+func TestValidateStdio_ReturnsWhileServerKeepsWriting(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	script := `read line; echo '{"jsonrpc":"2.0","id":1,"result":{"capabilities":{}}}'; while :; do echo '{"jsonrpc":"2.0","method":"notifications/message"}'; done`
+	start := time.Now()
+	if err := ValidateStdio(ctx, "sh", []string{"-c", script}); err != nil {
+		t.Fatalf("Expected validation to succeed, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("Expected validation to return promptly, took %v", elapsed)
+	}
+}
+
+func TestValidateStdio_MissingBinary(t *testing.T) {
+	err := ValidateStdio(context.Background(), "/nonexistent/mcpgate", []string{"server"})
+	if err == nil {
+		t.Fatal("Expected error for missing binary")
+	}
+
+	if !errors.Is(err, ErrValidationFailed) {
+		t.Errorf("Expected ErrValidationFailed, got %v", err)
+	}
+}
+
+func TestValidateStdio_ErrorResponse(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+
+	script := `read line; echo '{"jsonrpc":"2.0","id":1,"error":{"code":-32603,"message":"boom"}}'`
+	err := ValidateStdio(context.Background(), "sh", []string{"-c", script})
+	if err == nil {
+		t.Fatal("Expected error for initialize error response")
+	}
+}
+
+func TestValidateAgents(t *testing.T) {
+	agents := []Agent{NewClaude(), NewCursor()}
+
+	results := ValidateAgents(context.Background(), agents, "/nonexistent/mcpgate", nil)
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 results, got %d", len(results))
+	}
+
+	for i, result := range results {
+		if result.Agent != agents[i].Name() {
+			t.Errorf("Expected agent %s, got %s", agents[i].Name(), result.Agent)
+		}
+		if result.OK() {
+			t.Errorf("Expected validation failure for %s", result.Agent)
+		}
+	}
+}
+
+func TestResolveConfigPath_Relative(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "mcpgate.toml"), []byte("[gateway]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(dir)
+
+	path, err := ResolveConfigPath("mcpgate.toml")
+	if err != nil {
+		t.Fatalf("ResolveConfigPath failed: %v", err)
+	}
+	if !filepath.IsAbs(path) {
+		t.Errorf("Expected absolute path, got %s", path)
+	}
+	if filepath.Base(path) != "mcpgate.toml" {
+		t.Errorf("Expected path to mcpgate.toml, got %s", path)
+	}
+}
+
+func TestResolveConfigPath_Invalid(t *testing.T) {
+	dir := t.TempDir()
+
+	if _, err := ResolveConfigPath(filepath.Join(dir, "missing.toml")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected not-exist error for missing file, got %v", err)
+	}
+	if _, err := ResolveConfigPath(dir); err == nil {
+		t.Error("Expected error for directory")
+	}
+}
+
+func TestResolveCommand(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path, err := ResolveCommand(exe)
+	if err != nil {
+		t.Fatalf("ResolveCommand failed: %v", err)
+	}
+	if !filepath.IsAbs(path) {
+		t.Errorf("Expected absolute path, got %s", path)
+	}
+}
+
+func TestIsTemporaryPath(t *testing.T) {
+	if !IsTemporaryPath(filepath.Join(os.TempDir(), "go-build123", "exe", "mcpgate")) {
+		t.Error("Expected path under temp dir to be temporary")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip("no home directory")
+	}
+	if IsTemporaryPath(filepath.Join(home, "go", "bin", "mcpgate")) {
+		t.Error("Expected path under home to not be temporary")
+	}
+}
+
+func TestCopyConfig(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "mcpgate.toml")
+	content := []byte("[gateway]\nlog_level = \"debug\"\n")
+	if err := os.WriteFile(src, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	dest, err := CopyConfig(src, dir, "Claude Desktop", "mcpgate")
+	if err != nil {
+		t.Fatalf("CopyConfig failed: %v", err)
+	}
+
+	want := filepath.Join(dir, "claude-desktop", "mcpgate.toml")
+	if dest != want {
+		t.Errorf("Expected copy at %s, got %s", want, dest)
+	}
+
+	data, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatalf("Failed to read copy: %v", err)
+	}
+	if string(data) != string(content) {
+		t.Errorf("Copy content mismatch: %q", data)
+	}
+
+	// The original can go away without breaking the copy
+	if err := os.Remove(src); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(dest); err != nil {
+		t.Errorf("Expected copy to survive removal of the original: %v", err)
+	}
+}
+
+func TestExpandName(t *testing.T) {
+	vars := NameVars{Profile: "work", Hostname: "laptop", User: "DOMAIN user"}
+
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{"mcpgate", "mcpgate"},
+		{"mcpgate-{profile}", "mcpgate-work"},
+		{"mcpgate-{hostname}-{profile}", "mcpgate-laptop-work"},
+		{"{user}", "DOMAIN-user"},
+	}
+
+	for _, tt := range tests {
+		got, err := ExpandName(tt.template, vars)
+		if err != nil {
+			t.Errorf("ExpandName(%q) failed: %v", tt.template, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ExpandName(%q) = %q, want %q", tt.template, got, tt.want)
+		}
+	}
+}
+
+func TestExpandName_Errors(t *testing.T) {
+	vars := NameVars{Profile: "work"}
+
+	for _, template := range []string{"mcpgate-{unknown}", "mcpgate-{hostname}", ""} {
+		if _, err := ExpandName(template, vars); err == nil {
+			t.Errorf("Expected error for template %q", template)
+		}
+	}
+}
+
+func TestDefaultNameVars_Profile(t *testing.T) {
+	if got := DefaultNameVars("", "").Profile; got != DefaultProfile {
+		t.Errorf("Expected default profile %q, got %q", DefaultProfile, got)
+	}
+	if got := DefaultNameVars("", filepath.Join("configs", "work.toml")).Profile; got != "work" {
+		t.Errorf("Expected profile from config file name, got %q", got)
+	}
+	if got := DefaultNameVars("staging", "work.toml").Profile; got != "staging" {
+		t.Errorf("Expected explicit profile to win, got %q", got)
+	}
+}
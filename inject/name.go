@@ -0,0 +1,92 @@
+package inject
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// DefaultProfile is the profile name used when none is given and no config file is set
+const DefaultProfile = "default"
+
+// NameVars are the values substituted into a server name template
+type NameVars struct {
+	Profile  string // {profile}
+	Hostname string // {hostname}
+	User     string // {user}
+}
+
+// placeholderPattern matches {name} placeholders in a name template
+var placeholderPattern = regexp.MustCompile(`\{[^{}]*\}`)
+
+// unsafeNameChars matches characters that are not allowed in substituted values
+var unsafeNameChars = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// DefaultNameVars fills NameVars for this machine. An empty profile falls back
+// to the config file's base name, or DefaultProfile without one.
+func DefaultNameVars(profile, configPath string) NameVars {
+	if profile == "" && configPath != "" {
+		profile = strings.TrimSuffix(filepath.Base(configPath), filepath.Ext(configPath))
+	}
+	if profile == "" {
+		profile = DefaultProfile
+	}
+
+	vars := NameVars{Profile: profile}
+
+	if hostname, err := os.Hostname(); err == nil {
+		// Only the first label, so "laptop.local" becomes "laptop"
+		vars.Hostname, _, _ = strings.Cut(hostname, ".")
+	}
+
+	if current, err := user.Current(); err == nil {
+		// Strip the domain from Windows DOMAIN\user names
+		name := current.Username
+		if idx := strings.LastIndex(name, `\`); idx >= 0 {
+			name = name[idx+1:]
+		}
+		vars.User = name
+	}
+
+	return vars
+}
+
+// ExpandName substitutes {profile}, {hostname} and {user} in a server name
+// template such as "mcpgate-{profile}". Substituted values are reduced to
+// letters, digits, '-' and '_' so they are valid in every agent's config.
+// Inject and eject expand the same template, so the entry written by one is
+// the entry removed by the other.
+func ExpandName(template string, vars NameVars) (string, error) {
+	values := map[string]string{
+		"{profile}":  vars.Profile,
+		"{hostname}": vars.Hostname,
+		"{user}":     vars.User,
+	}
+
+	var expandErr error
+	name := placeholderPattern.ReplaceAllStringFunc(template, func(placeholder string) string {
+		value, ok := values[placeholder]
+		if !ok {
+			if expandErr == nil {
+				expandErr = fmt.Errorf("unknown placeholder %s in server name %q (supported: {profile}, {hostname}, {user})", placeholder, template)
+			}
+			return placeholder
+		}
+		if value == "" && expandErr == nil {
+			expandErr = fmt.Errorf("placeholder %s in server name %q has no value on this machine", placeholder, template)
+		}
+		return strings.Trim(unsafeNameChars.ReplaceAllString(value, "-"), "-")
+	})
+	if expandErr != nil {
+		return "", expandErr
+	}
+
+	if strings.TrimSpace(name) == "" {
+		return "", fmt.Errorf("server name %q expands to an empty name", template)
+	}
+
+	return name, nil
+}
@@ -0,0 +1,120 @@
+package inject
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ResolveCommand turns the binary path written into agent configs into an
+// absolute path and verifies it is an existing file. Agents start the command
+// from their own working directory, so relative paths would not resolve.
+func ResolveCommand(command string) (string, error) {
+	path, err := resolveFile(command)
+	if err != nil {
+		return "", fmt.Errorf("mcpgate binary: %w", err)
+	}
+	return path, nil
+}
+
+// ResolveConfigPath turns a --config path into an absolute path and verifies
+// it is an existing file
+func ResolveConfigPath(configPath string) (string, error) {
+	path, err := resolveFile(configPath)
+	if err != nil {
+		return "", fmt.Errorf("config file: %w", err)
+	}
+	return path, nil
+}
+
+// resolveFile expands ~ and environment variables, makes path absolute and
+// checks it names a regular file
+func resolveFile(path string) (string, error) {
+	expanded, err := ExpandPath(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to expand %s: %w", path, err)
+	}
+
+	abs, err := filepath.Abs(expanded)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w", path, err)
+	}
+
+	info, err := os.Stat(abs)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", abs, err)
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("%s is a directory", abs)
+	}
+
+	return abs, nil
+}
+
+// IsTemporaryPath reports whether path lives in the system temp directory,
+// as binaries built by "go run" do. Such paths disappear and break agents later.
+func IsTemporaryPath(path string) bool {
+	for _, dir := range tempDirs() {
+		if rel, err := filepath.Rel(dir, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// tempDirs returns the temp directory as configured and with symlinks
+// resolved, since on macOS /var is a link to /private/var
+func tempDirs() []string {
+	dir := filepath.Clean(os.TempDir())
+	dirs := []string{dir}
+	if resolved, err := filepath.EvalSymlinks(dir); err == nil && resolved != dir {
+		dirs = append(dirs, resolved)
+	}
+	return dirs
+}
+
+// StableConfigDir returns the directory holding per-agent config copies
+func StableConfigDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find user config directory: %w", err)
+	}
+	return filepath.Join(dir, "mcpgate", "agents"), nil
+}
+
+// AgentSlug converts an agent name such as "Claude Desktop" to a directory name
+func AgentSlug(agentName string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(agentName)), " ", "-")
+}
+
+// CopyConfig copies the config at src into dir/<agent>/<serverName>.toml and
+// returns the copy's path. The copy is written with owner-only permissions
+// since configs may contain credentials.
+func CopyConfig(src, dir, agentName, serverName string) (string, error) {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return "", fmt.Errorf("failed to read config: %w", err)
+	}
+
+	dest := filepath.Join(dir, AgentSlug(agentName), serverName+".toml")
+	if dest == src {
+		return dest, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0700); err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", filepath.Dir(dest), err)
+	}
+
+	// Write then rename so a running agent never sees a partial config
+	tmp := dest + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return "", fmt.Errorf("failed to write config copy: %w", err)
+	}
+	if err := os.Rename(tmp, dest); err != nil {
+		_ = os.Remove(tmp)
+		return "", fmt.Errorf("failed to write config copy: %w", err)
+	}
+
+	return dest, nil
+}
@@ -23,6 +23,18 @@ const (
 	TransportHTTP  Transport = "http"
 )
 
+// OptionHeaders is the InjectHTTP option holding the HTTP headers the agent
+// sends with every request to mcpgate
+const OptionHeaders = "headers"
+
+// APIKeyOptions returns the InjectHTTP options that make an agent present
+// apiKey to a gateway requiring API keys
+func APIKeyOptions(apiKey string) map[string]interface{} {
+	return map[string]interface{}{
+		OptionHeaders: map[string]interface{}{"Authorization": "Bearer " + apiKey},
+	}
+}
+
 // ServerConfig contains configuration for injecting mcpgate into an agent
 type ServerConfig struct {
 	Transport    Transport              // stdio or http
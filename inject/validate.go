@@ -0,0 +1,161 @@
+package inject
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"time"
+)
+
+// ErrValidationFailed is returned when an injected command fails its launch check
+var ErrValidationFailed = errors.New("launch validation failed")
+
+// DefaultValidationTimeout bounds how long a launch validation may take
+const DefaultValidationTimeout = 10 * time.Second
+
+// ValidationResult describes the outcome of validating an injected stdio entry
+type ValidationResult struct {
+	Agent    string        // Agent the entry was injected into
+	Err      error         // nil when the command started and answered initialize
+	Duration time.Duration // How long the check took
+}
+
+// OK reports whether validation succeeded
+func (r ValidationResult) OK() bool {
+	return r.Err == nil
+}
+
+// ValidateStdio spawns command with args exactly as an agent would, sends an
+// initialize request and waits for a successful response. The process is
+// killed once the check completes.
+func ValidateStdio(ctx context.Context, command string, args []string) error {
+	// Cancelled on return, so the reader below never outlives the check
+	var cancel context.CancelFunc
+	if _, ok := ctx.Deadline(); ok {
+		ctx, cancel = context.WithCancel(ctx)
+	} else {
+		ctx, cancel = context.WithTimeout(ctx, DefaultValidationTimeout)
+	}
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, command, args...)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("%w: failed to create stdin pipe: %v", ErrValidationFailed, err)
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("%w: failed to create stdout pipe: %v", ErrValidationFailed, err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("%w: failed to start %s: %v", ErrValidationFailed, command, err)
+	}
+
+	lines := make(chan []byte)
+	readErr := make(chan error, 1)
+	readDone := make(chan struct{})
+	go func() {
+		defer close(readDone)
+		reader := bufio.NewReader(stdout)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if err != nil {
+				readErr <- err
+				return
+			}
+			select {
+			case lines <- line:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// Wait must not close stdout while the reader still uses it, so the
+	// reader is stopped and drained first
+	defer func() {
+		cancel()
+		_ = stdin.Close()
+		_ = cmd.Process.Kill()
+		_ = stdout.Close()
+		<-readDone
+		_ = cmd.Wait()
+	}()
+
+	req := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  "initialize",
+		"params": map[string]interface{}{
+			"protocolVersion": "2024-11-05",
+			"capabilities":    map[string]interface{}{},
+			"clientInfo": map[string]interface{}{
+				"name":    "mcpgate-inject",
+				"version": "1.0.0",
+			},
+		},
+	}
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("%w: failed to marshal request: %v", ErrValidationFailed, err)
+	}
+
+	if _, err := stdin.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("%w: failed to write initialize request: %v", ErrValidationFailed, err)
+	}
+
+	for {
+		select {
+		case line := <-lines:
+			var resp struct {
+				ID     interface{}     `json:"id"`
+				Result json.RawMessage `json:"result"`
+				Error  *struct {
+					Code    int    `json:"code"`
+					Message string `json:"message"`
+				} `json:"error"`
+			}
+			if err := json.Unmarshal(line, &resp); err != nil {
+				// Ignore non-JSON output such as banners
+				continue
+			}
+			if id, ok := resp.ID.(float64); !ok || id != 1 {
+				// Notification or unrelated message
+				continue
+			}
+			if resp.Error != nil {
+				return fmt.Errorf("%w: initialize returned error %d: %s", ErrValidationFailed, resp.Error.Code, resp.Error.Message)
+			}
+			if len(resp.Result) == 0 {
+				return fmt.Errorf("%w: initialize response has no result", ErrValidationFailed)
+			}
+			return nil
+		case err := <-readErr:
+			return fmt.Errorf("%w: process exited before responding: %v", ErrValidationFailed, err)
+		case <-ctx.Done():
+			return fmt.Errorf("%w: timed out waiting for initialize response", ErrValidationFailed)
+		}
+	}
+}
+
+// ValidateAgents runs ValidateStdio once for each agent, reporting results in order
+func ValidateAgents(ctx context.Context, agents []Agent, command string, args []string) []ValidationResult {
+	results := make([]ValidationResult, 0, len(agents))
+	for _, agent := range agents {
+		start := time.Now()
+		err := ValidateStdio(ctx, command, args)
+		results = append(results, ValidationResult{
+			Agent:    agent.Name(),
+			Err:      err,
+			Duration: time.Since(start),
+		})
+	}
+	return results
+}
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/j4ng5y/mcpgate/config"
+	"github.com/j4ng5y/mcpgate/internal/mcptest"
 	"github.com/j4ng5y/mcpgate/mcp"
 	"github.com/j4ng5y/mcpgate/server"
 )
@@ -25,7 +26,8 @@ func TestIntegration_FullWorkflow(t *testing.T) {
 				Name:      "echo-server",
 				Transport: "stdio",
 				Enabled:   true,
-				Command:   "cat",
+				Command:   mcptest.EchoCommand,
+				Args:      mcptest.EchoArgs(),
 				Timeout:   10,
 			},
 		},
@@ -72,21 +74,24 @@ func TestIntegration_MultipleServers(t *testing.T) {
 				Name:      "server1",
 				Transport: "stdio",
 				Enabled:   true,
-				Command:   "cat",
+				Command:   mcptest.EchoCommand,
+				Args:      mcptest.EchoArgs(),
 				Timeout:   5,
 			},
 			{
 				Name:      "server2",
 				Transport: "stdio",
 				Enabled:   true,
-				Command:   "cat",
+				Command:   mcptest.EchoCommand,
+				Args:      mcptest.EchoArgs(),
 				Timeout:   5,
 			},
 			{
 				Name:      "server3",
 				Transport: "stdio",
 				Enabled:   false, // Disabled
-				Command:   "cat",
+				Command:   mcptest.EchoCommand,
+				Args:      mcptest.EchoArgs(),
 			},
 		},
 	}
@@ -169,13 +174,15 @@ func TestIntegration_RouterWithMultipleServers(t *testing.T) {
 				Name:      "tools-server",
 				Transport: "stdio",
 				Enabled:   true,
-				Command:   "cat",
+				Command:   mcptest.EchoCommand,
+				Args:      mcptest.EchoArgs(),
 			},
 			{
 				Name:      "resources-server",
 				Transport: "stdio",
 				Enabled:   true,
-				Command:   "cat",
+				Command:   mcptest.EchoCommand,
+				Args:      mcptest.EchoArgs(),
 			},
 		},
 	}
@@ -229,7 +236,8 @@ func TestIntegration_RegistryOperations(t *testing.T) {
 				Name:      "server1",
 				Transport: "stdio",
 				Enabled:   true,
-				Command:   "cat",
+				Command:   mcptest.EchoCommand,
+				Args:      mcptest.EchoArgs(),
 			},
 		},
 	}
@@ -338,7 +346,8 @@ func TestIntegration_ConcurrentRequests(t *testing.T) {
 				Name:      "server1",
 				Transport: "stdio",
 				Enabled:   true,
-				Command:   "cat",
+				Command:   mcptest.EchoCommand,
+				Args:      mcptest.EchoArgs(),
 			},
 		},
 	}
@@ -0,0 +1,33 @@
+// Package mcptest provides stdio upstreams for tests that need replies without
+// a real MCP server.
+package mcptest
+
+// EchoCommand runs an upstream that answers each request with a null result,
+// keeping its id and params, and echoes notifications back unchanged. Start it
+// with EchoArgs.
+const EchoCommand = "sh"
+
+// EchoScript is the shell program behind EchoCommand, for tests that run it
+// through their own wrapper. It drops each request's method and prepends a
+// null result, so the line reads as the response to its own id, and sticks
+// to shell builtins as tools like awk may hold input back until the pipe
+// closes.
+const EchoScript = `while IFS= read -r line; do
+	case $line in
+	*'"id":'*'"method":"'* | *'"method":"'*'"id":'*)
+		rest=${line#*'"method":"'}
+		method='"method":"'${rest%%'"'*}'"'
+		case $line in
+		*"$method,"*) line=${line%%"$method,"*}${line#*"$method,"} ;;
+		*) line=${line%%",$method"*}${line#*",$method"} ;;
+		esac
+		line='{"result":null,'${line#'{'}
+		;;
+	esac
+	printf '%s\n' "$line"
+done`
+
+// EchoArgs returns the arguments for EchoCommand
+func EchoArgs() []string {
+	return []string{"-c", EchoScript}
+}
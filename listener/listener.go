@@ -0,0 +1,145 @@
+// Package listener opens the network listeners the gateway serves on
+package listener
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+)
+
+// Address families controlling dual-stack behavior of wildcard and IPv6 binds
+const (
+	FamilyDual = "dual" // IPv6 sockets also accept IPv4 connections (default)
+	FamilyIPv4 = "ipv4" // Only bind IPv4
+	FamilyIPv6 = "ipv6" // IPv6 sockets accept IPv6 connections only
+)
+
+// UnixPrefix marks an address as a unix socket path
+const UnixPrefix = "unix://"
+
+// ValidFamily reports whether family is a known address family; empty means dual
+func ValidFamily(family string) bool {
+	switch family {
+	case "", FamilyDual, FamilyIPv4, FamilyIPv6:
+		return true
+	}
+	return false
+}
+
+// Open binds every address in order. Addresses are host:port, [ipv6]:port,
+// unix:///path or systemd:[name], which may yield several listeners. If any
+// bind fails the listeners opened so far are closed.
+func Open(addresses []string, family string) ([]net.Listener, error) {
+	if !ValidFamily(family) {
+		return nil, fmt.Errorf("invalid address family %q (must be %q, %q or %q)", family, FamilyDual, FamilyIPv4, FamilyIPv6)
+	}
+
+	listeners := make([]net.Listener, 0, len(addresses))
+	for _, address := range addresses {
+		var opened []net.Listener
+		var err error
+		if IsSystemd(address) {
+			opened, err = openActivated(address)
+		} else {
+			var l net.Listener
+			l, err = open(address, family)
+			opened = []net.Listener{l}
+		}
+		if err != nil {
+			for _, l := range listeners {
+				_ = l.Close()
+			}
+			return nil, err
+		}
+		listeners = append(listeners, opened...)
+	}
+
+	return listeners, nil
+}
+
+// open binds a single address
+func open(address, family string) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(address, UnixPrefix); ok {
+		// Remove a stale socket left behind by a previous run
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to remove stale socket %s: %w", path, err)
+		}
+		l, err := net.Listen("unix", path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to listen on %s: %w", address, err)
+		}
+		return l, nil
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid listen address %q: %w", address, err)
+	}
+
+	network := "tcp"
+	switch family {
+	case FamilyIPv4:
+		network = "tcp4"
+	case FamilyIPv6:
+		network = "tcp6"
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		if ip.To4() != nil && family == FamilyIPv6 {
+			return nil, fmt.Errorf("cannot bind IPv4 address %q with family %q", address, family)
+		}
+		if ip.To4() == nil && family == FamilyIPv4 {
+			return nil, fmt.Errorf("cannot bind IPv6 address %q with family %q", address, family)
+		}
+	}
+
+	l, err := net.Listen(network, address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", address, err)
+	}
+	return l, nil
+}
+
+// IsLocal reports whether an address is only reachable from this machine:
+// a unix socket, localhost or a loopback IP. Wildcard binds are not local.
+func IsLocal(address string) bool {
+	if strings.HasPrefix(address, UnixPrefix) {
+		return true
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// WarnIfExposed logs a warning for every address reachable from other
+// machines when the listener does not require authentication
+func WarnIfExposed(name string, addresses []string, authEnabled bool) []string {
+	if authEnabled {
+		return nil
+	}
+
+	var exposed []string
+	for _, address := range addresses {
+		if !IsLocal(address) {
+			exposed = append(exposed, address)
+			slog.Warn("Listener is reachable from other machines and has no authentication enabled", "listener", name, "address", address)
+		}
+	}
+	return exposed
+}
+
+// Addr formats a listener's address the way it is written in config
+func Addr(l net.Listener) string {
+	if l.Addr().Network() == "unix" {
+		return UnixPrefix + l.Addr().String()
+	}
+	return l.Addr().String()
+}
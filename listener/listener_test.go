@@ -0,0 +1,170 @@
+package listener
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func ipv6Available() bool {
+	l, err := net.Listen("tcp6", "[::1]:0")
+	if err != nil {
+		return false
+	}
+	_ = l.Close()
+	return true
+}
+
+func TestOpen_MultipleAddresses(t *testing.T) {
+	addresses := []string{"127.0.0.1:0", "unix://" + filepath.Join(t.TempDir(), "gateway.sock")}
+	if ipv6Available() {
+		addresses = append(addresses, "[::1]:0")
+	}
+
+	listeners, err := Open(addresses, "")
+	if err != nil {
+		t.Fatalf("Failed to open listeners: %v", err)
+	}
+	defer func() {
+		for _, l := range listeners {
+			_ = l.Close()
+		}
+	}()
+
+	if len(listeners) != len(addresses) {
+		t.Fatalf("Expected %d listeners, got %d", len(addresses), len(listeners))
+	}
+	if Addr(listeners[1]) != addresses[1] {
+		t.Errorf("Expected unix address %s, got %s", addresses[1], Addr(listeners[1]))
+	}
+}
+
+func TestOpen_ClosesOnFailure(t *testing.T) {
+	first, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer func() { _ = first.Close() }()
+
+	// The second address is already in use, so the first bind must be released
+	if _, err := Open([]string{"127.0.0.1:0", first.Addr().String()}, ""); err == nil {
+		t.Fatal("Expected error for address in use")
+	}
+}
+
+func TestOpen_FamilyMismatch(t *testing.T) {
+	if _, err := Open([]string{"127.0.0.1:0"}, FamilyIPv6); err == nil {
+		t.Error("Expected error binding IPv4 address with ipv6 family")
+	}
+	if _, err := Open([]string{"[::1]:0"}, FamilyIPv4); err == nil {
+		t.Error("Expected error binding IPv6 address with ipv4 family")
+	}
+	if _, err := Open([]string{"127.0.0.1:0"}, "ipx"); err == nil {
+		t.Error("Expected error for unknown family")
+	}
+}
+
+func TestIsLocal(t *testing.T) {
+	tests := map[string]bool{
+		"127.0.0.1:8080":       true,
+		"[::1]:8080":           true,
+		"localhost:8080":       true,
+		"unix:///tmp/mcp.sock": true,
+		"0.0.0.0:8080":         false,
+		"[::]:8080":            false,
+		":8080":                false,
+		"192.168.1.10:8080":    false,
+	}
+
+	for address, want := range tests {
+		if got := IsLocal(address); got != want {
+			t.Errorf("IsLocal(%q) = %v, want %v", address, got, want)
+		}
+	}
+}
+
+func TestWarnIfExposed(t *testing.T) {
+	addresses := []string{"127.0.0.1:8080", "0.0.0.0:8080"}
+
+	if exposed := WarnIfExposed("http", addresses, true); len(exposed) != 0 {
+		t.Errorf("Expected no warnings with auth enabled, got %v", exposed)
+	}
+	if exposed := WarnIfExposed("http", addresses, false); len(exposed) != 1 || exposed[0] != "0.0.0.0:8080" {
+		t.Errorf("Expected wildcard address to be reported, got %v", exposed)
+	}
+}
+
+func TestActivate(t *testing.T) {
+	pid := strconv.Itoa(os.Getpid())
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    []string
+		wantErr bool
+	}{
+		{"not activated", map[string]string{}, nil, false},
+		{"another process", map[string]string{"LISTEN_PID": "1", "LISTEN_FDS": "1"}, nil, false},
+		{"no pid", map[string]string{"LISTEN_FDS": "1"}, nil, false},
+		{"named", map[string]string{"LISTEN_PID": pid, "LISTEN_FDS": "2", "LISTEN_FDNAMES": "http:control"}, []string{"http", "control"}, false},
+		{"unnamed", map[string]string{"LISTEN_PID": pid, "LISTEN_FDS": "1"}, []string{"unknown"}, false},
+		{"invalid count", map[string]string{"LISTEN_PID": pid, "LISTEN_FDS": "two"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fds []int
+			sockets, err := activate(func(key string) string { return tt.env[key] }, func(fd int, name string) (net.Listener, error) {
+				fds = append(fds, fd)
+				return net.Listen("tcp", "127.0.0.1:0")
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if len(sockets) != len(tt.want) {
+				t.Fatalf("Expected %d sockets, got %d", len(tt.want), len(sockets))
+			}
+			for i, socket := range sockets {
+				_ = socket.listener.Close()
+				if socket.name != tt.want[i] || fds[i] != listenFDsStart+i {
+					t.Errorf("Expected socket %s on descriptor %d, got %s on %d", tt.want[i], listenFDsStart+i, socket.name, fds[i])
+				}
+			}
+		})
+	}
+}
+
+func TestOpen_Systemd(t *testing.T) {
+	env := map[string]string{"LISTEN_PID": strconv.Itoa(os.Getpid()), "LISTEN_FDS": "3", "LISTEN_FDNAMES": "http:http:control"}
+	sockets, err := activate(func(key string) string { return env[key] }, func(fd int, name string) (net.Listener, error) {
+		return net.Listen("tcp", "127.0.0.1:0")
+	})
+	if err != nil {
+		t.Fatalf("Failed to activate: %v", err)
+	}
+	// Stand in for the sockets systemd would pass this process
+	activationOnce.Do(func() {})
+	activated = append([]activatedSocket(nil), sockets...)
+	t.Cleanup(func() {
+		for _, socket := range sockets {
+			_ = socket.listener.Close()
+		}
+		activated = nil
+	})
+
+	listeners, err := Open([]string{"systemd:http"}, "")
+	if err != nil || len(listeners) != 2 {
+		t.Fatalf("Expected both http sockets, got %d: %v", len(listeners), err)
+	}
+	if _, err := Open([]string{"systemd:http"}, ""); err == nil {
+		t.Error("Expected error once the http sockets are taken")
+	}
+	listeners, err = Open([]string{"systemd:"}, "")
+	if err != nil || len(listeners) != 1 || listeners[0] != sockets[2].listener {
+		t.Fatalf("Expected the remaining control socket, got %v: %v", listeners, err)
+	}
+	if _, err := Open([]string{"systemd:"}, ""); err == nil {
+		t.Error("Expected error once every socket is taken")
+	}
+}
@@ -0,0 +1,120 @@
+package listener
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// SystemdPrefix marks an address as sockets passed in by systemd socket
+// activation. "systemd:" takes every passed socket not yet taken,
+// "systemd:name" the ones whose FileDescriptorName is name.
+const SystemdPrefix = "systemd:"
+
+// listenFDsStart is the first descriptor systemd passes sockets on
+const listenFDsStart = 3
+
+// activatedSocket is a listener passed in by systemd
+type activatedSocket struct {
+	name     string
+	listener net.Listener
+}
+
+var (
+	activationOnce sync.Once
+	activationErr  error
+	activationMu   sync.Mutex
+	activated      []activatedSocket // Sockets not yet taken by Open
+)
+
+// IsSystemd reports whether address names sockets passed in by systemd
+func IsSystemd(address string) bool {
+	return strings.HasPrefix(address, SystemdPrefix)
+}
+
+// openActivated takes the sockets passed in by systemd that address names
+func openActivated(address string) ([]net.Listener, error) {
+	activationOnce.Do(func() {
+		activated, activationErr = activate(os.Getenv, fileListener)
+		// Like sd_listen_fds, keep the sockets from child processes
+		for _, key := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"} {
+			_ = os.Unsetenv(key)
+		}
+	})
+	if activationErr != nil {
+		return nil, activationErr
+	}
+
+	name := strings.TrimPrefix(address, SystemdPrefix)
+	activationMu.Lock()
+	defer activationMu.Unlock()
+
+	var taken []net.Listener
+	remaining := activated[:0]
+	for _, socket := range activated {
+		if name == "" || socket.name == name {
+			taken = append(taken, socket.listener)
+		} else {
+			remaining = append(remaining, socket)
+		}
+	}
+	activated = remaining
+
+	if len(taken) == 0 {
+		if name == "" {
+			return nil, fmt.Errorf("no sockets passed by systemd for %s", address)
+		}
+		return nil, fmt.Errorf("no socket named %q passed by systemd for %s", name, address)
+	}
+	return taken, nil
+}
+
+// activate reads the sockets systemd passed in from the LISTEN_PID,
+// LISTEN_FDS and LISTEN_FDNAMES variables. Sockets meant for another
+// process, such as the parent that exec'd this one, are ignored.
+func activate(getenv func(string) string, listen func(fd int, name string) (net.Listener, error)) ([]activatedSocket, error) {
+	fds := getenv("LISTEN_FDS")
+	if fds == "" {
+		return nil, nil
+	}
+	if pid := getenv("LISTEN_PID"); pid != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+	count, err := strconv.Atoi(fds)
+	if err != nil || count < 0 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS %q", fds)
+	}
+
+	var names []string
+	if fdNames := getenv("LISTEN_FDNAMES"); fdNames != "" {
+		names = strings.Split(fdNames, ":")
+	}
+
+	sockets := make([]activatedSocket, 0, count)
+	for i := 0; i < count; i++ {
+		name := "unknown"
+		if i < len(names) {
+			name = names[i]
+		}
+		l, err := listen(listenFDsStart+i, name)
+		if err != nil {
+			for _, socket := range sockets {
+				_ = socket.listener.Close()
+			}
+			return nil, fmt.Errorf("failed to use socket %d (%s) passed by systemd: %w", listenFDsStart+i, name, err)
+		}
+		sockets = append(sockets, activatedSocket{name: name, listener: l})
+	}
+	return sockets, nil
+}
+
+// fileListener wraps a listening socket descriptor. The listener holds its
+// own close-on-exec copy, so the inherited descriptor is closed.
+func fileListener(fd int, name string) (net.Listener, error) {
+	file := os.NewFile(uintptr(fd), name)
+	defer func() { _ = file.Close() }()
+	return net.FileListener(file)
+}
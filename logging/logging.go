@@ -0,0 +1,258 @@
+// Package logging builds the gateway's structured logger. Records are
+// tagged with the server, request id and method carried by the context they
+// are logged with.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// Keys of the attributes records are tagged with
+const (
+	KeyServer    = "server"
+	KeyRequestID = "request_id"
+	KeyMethod    = "method"
+	KeyError     = "error"
+)
+
+// Output formats
+const (
+	FormatText = "text" // key=value pairs, the default
+	FormatJSON = "json" // One JSON object per line
+)
+
+// ParseLevel returns the level named by debug, info, warn or error
+func ParseLevel(level string) (slog.Level, error) {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q", level)
+}
+
+// ValidFormat reports whether format is a known output format; empty means
+// the default
+func ValidFormat(format string) bool {
+	return format == "" || format == FormatText || format == FormatJSON
+}
+
+// Levels holds the level records are logged at, and the levels of servers
+// logged at their own. It may be changed while the logger is in use.
+type Levels struct {
+	mutex   sync.RWMutex
+	gateway slog.Level
+	servers map[string]slog.Level
+}
+
+// NewLevels returns the gateway's level and the overrides servers maps
+// server names to; a server without one is logged at the gateway's level
+func NewLevels(gateway string, servers map[string]string) (*Levels, error) {
+	level, err := ParseLevel(gateway)
+	if err != nil {
+		return nil, err
+	}
+	levels := &Levels{gateway: level}
+	if err := levels.SetServers(servers); err != nil {
+		return nil, err
+	}
+	return levels, nil
+}
+
+// SetServers replaces the servers' overrides, keeping the current ones when
+// any level is unknown
+func (l *Levels) SetServers(servers map[string]string) error {
+	parsed := make(map[string]slog.Level, len(servers))
+	for name, level := range servers {
+		if level == "" {
+			continue
+		}
+		serverLevel, err := ParseLevel(level)
+		if err != nil {
+			return fmt.Errorf("server %s: %w", name, err)
+		}
+		parsed[name] = serverLevel
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.servers = parsed
+	return nil
+}
+
+// Server returns the level records about server are logged at
+func (l *Levels) Server(server string) slog.Level {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	if level, ok := l.servers[server]; ok && server != "" {
+		return level
+	}
+	return l.gateway
+}
+
+// Level returns the lowest level any record may be logged at, so Levels can
+// be the slog.Leveler of a handler it filters for
+func (l *Levels) Level() slog.Level {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	lowest := l.gateway
+	for _, level := range l.servers {
+		lowest = min(lowest, level)
+	}
+	return lowest
+}
+
+// New creates a logger writing records to w in format, at the levels chosen
+// for the gateway and for the server each record is tagged with
+func New(w io.Writer, format string, levels *Levels) (*slog.Logger, error) {
+	if !ValidFormat(format) {
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+
+	options := &slog.HandlerOptions{Level: levels}
+	var handler slog.Handler = slog.NewTextHandler(w, options)
+	if format == FormatJSON {
+		handler = slog.NewJSONHandler(w, options)
+	}
+	return slog.New(newLevelHandler(NewHandler(handler), levels)), nil
+}
+
+// Server returns the attribute naming the upstream server a record is about
+func Server(name string) slog.Attr {
+	return slog.String(KeyServer, name)
+}
+
+// Err returns the attribute recording err
+func Err(err error) slog.Attr {
+	return slog.Any(KeyError, err)
+}
+
+// attrsKey is the context key for the attributes records are tagged with
+type attrsKey struct{}
+
+// With returns a context whose records are tagged with attrs as well as
+// those ctx already carries
+func With(ctx context.Context, attrs ...slog.Attr) context.Context {
+	existing, _ := ctx.Value(attrsKey{}).([]slog.Attr)
+	combined := make([]slog.Attr, 0, len(existing)+len(attrs))
+	combined = append(combined, existing...)
+	combined = append(combined, attrs...)
+	return context.WithValue(ctx, attrsKey{}, combined)
+}
+
+// contextHandler adds the attributes carried by a record's context
+type contextHandler struct {
+	slog.Handler
+}
+
+// NewHandler wraps handler so records logged with a context are tagged with
+// the attributes With stored in it
+func NewHandler(handler slog.Handler) slog.Handler {
+	return contextHandler{handler}
+}
+
+// Handle adds the context's attributes to the record
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if attrs, ok := ctx.Value(attrsKey{}).([]slog.Attr); ok {
+		record.AddAttrs(attrs...)
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+// WithAttrs keeps the context's attributes after the logger's own
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+// WithGroup keeps adding the context's attributes within the group
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// levelHandler drops the records below the level of the server they are
+// tagged with, or of the gateway when they are about no server
+type levelHandler struct {
+	slog.Handler
+	levels *Levels
+	server string // Tagged by the logger's own attributes
+}
+
+func newLevelHandler(handler slog.Handler, levels *Levels) slog.Handler {
+	return levelHandler{Handler: handler, levels: levels}
+}
+
+// Enabled reports whether a record at level may be logged. Until its
+// attributes are known a record about no known server is let through at the
+// lowest level, for Handle to decide.
+func (h levelHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	if server := h.contextServer(ctx); server != "" {
+		return level >= h.levels.Server(server)
+	}
+	return level >= h.levels.Level()
+}
+
+// Handle logs the record if it is at or above its server's level
+func (h levelHandler) Handle(ctx context.Context, record slog.Record) error {
+	server := h.contextServer(ctx)
+	record.Attrs(func(attr slog.Attr) bool {
+		if name, ok := serverName(attr); ok {
+			server = name
+		}
+		return true
+	})
+	if record.Level < h.levels.Server(server) {
+		return nil
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+// WithAttrs remembers the server the logger is tagged with
+func (h levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	server := h.server
+	for _, attr := range attrs {
+		if name, ok := serverName(attr); ok {
+			server = name
+		}
+	}
+	return levelHandler{Handler: h.Handler.WithAttrs(attrs), levels: h.levels, server: server}
+}
+
+// WithGroup keeps filtering the records logged within the group
+func (h levelHandler) WithGroup(name string) slog.Handler {
+	return levelHandler{Handler: h.Handler.WithGroup(name), levels: h.levels, server: h.server}
+}
+
+// contextServer returns the server the logger or, failing that, ctx is
+// tagged with
+func (h levelHandler) contextServer(ctx context.Context) string {
+	if h.server != "" {
+		return h.server
+	}
+	server := ""
+	if attrs, ok := ctx.Value(attrsKey{}).([]slog.Attr); ok {
+		for _, attr := range attrs {
+			if name, ok := serverName(attr); ok {
+				server = name
+			}
+		}
+	}
+	return server
+}
+
+// serverName returns the server attr names, if it is the server attribute
+func serverName(attr slog.Attr) (string, bool) {
+	if attr.Key != KeyServer || attr.Value.Kind() != slog.KindString {
+		return "", false
+	}
+	return attr.Value.String(), true
+}
@@ -0,0 +1,126 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// newLogger creates a logger at level with the servers' overrides
+func newLogger(t *testing.T, w *bytes.Buffer, level, format string, servers map[string]string) *slog.Logger {
+	t.Helper()
+	levels, err := NewLevels(level, servers)
+	if err != nil {
+		t.Fatalf("NewLevels failed: %v", err)
+	}
+	logger, err := New(w, format, levels)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	return logger
+}
+
+func TestNew_JSON(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newLogger(t, &buf, "info", FormatJSON, nil)
+
+	ctx := With(context.Background(), slog.String(KeyMethod, "tools/call"), slog.Any(KeyRequestID, 7))
+	ctx = With(ctx, Server("weather"))
+	logger.DebugContext(ctx, "Routing request")
+	logger.With("listener", "HTTP").WarnContext(ctx, "Upstream failed", Err(errors.New("boom")))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("Expected only the warning to be logged at info, got %q", buf.String())
+	}
+	var record map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatalf("Expected a JSON record, got %q: %v", lines[0], err)
+	}
+	want := map[string]interface{}{
+		"level":      "WARN",
+		"msg":        "Upstream failed",
+		"listener":   "HTTP",
+		"error":      "boom",
+		KeyServer:    "weather",
+		KeyMethod:    "tools/call",
+		KeyRequestID: float64(7),
+	}
+	for key, value := range want {
+		if record[key] != value {
+			t.Errorf("Expected %s=%v, got %v", key, value, record[key])
+		}
+	}
+}
+
+func TestNew_Text(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newLogger(t, &buf, "debug", "", nil)
+
+	logger.Debug("Connected to server", Server("files"))
+	if got := buf.String(); !strings.Contains(got, "level=DEBUG") || !strings.Contains(got, "server=files") {
+		t.Errorf("Expected a text record at debug, got %q", got)
+	}
+}
+
+func TestNew_Invalid(t *testing.T) {
+	if _, err := NewLevels("verbose", nil); err == nil {
+		t.Error("Expected an unknown level to be refused")
+	}
+	if _, err := NewLevels("info", map[string]string{"files": "loud"}); err == nil {
+		t.Error("Expected an unknown server level to be refused")
+	}
+	levels, _ := NewLevels("info", nil)
+	if _, err := New(&bytes.Buffer{}, "xml", levels); err == nil {
+		t.Error("Expected an unknown format to be refused")
+	}
+}
+
+func TestNew_ServerLevels(t *testing.T) {
+	var buf bytes.Buffer
+	levels, err := NewLevels("warn", map[string]string{"noisy": "debug", "quiet": "error"})
+	if err != nil {
+		t.Fatalf("NewLevels failed: %v", err)
+	}
+	logger, err := New(&buf, FormatText, levels)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	logger.Debug("gateway debug")
+	logger.Warn("gateway warn")
+	logger.Debug("noisy debug", Server("noisy"))
+	logger.With(KeyServer, "noisy").Debug("noisy logger debug")
+	logger.DebugContext(With(context.Background(), Server("noisy")), "noisy context debug")
+	logger.Info("other info", Server("other"))
+	logger.Warn("quiet warn", Server("quiet"))
+	logger.With(KeyServer, "quiet").Error("quiet error")
+
+	got := buf.String()
+	for _, msg := range []string{"gateway warn", "noisy debug", "noisy logger debug", "noisy context debug", "quiet error"} {
+		if !strings.Contains(got, msg) {
+			t.Errorf("Expected %q to be logged, got %q", msg, got)
+		}
+	}
+	for _, msg := range []string{"gateway debug", "other info", "quiet warn"} {
+		if strings.Contains(got, msg) {
+			t.Errorf("Expected %q to be dropped, got %q", msg, got)
+		}
+	}
+
+	buf.Reset()
+	if err := levels.SetServers(map[string]string{"noisy": "verbose"}); err == nil {
+		t.Error("Expected an unknown server level to be refused")
+	}
+	if err := levels.SetServers(nil); err != nil {
+		t.Fatalf("SetServers failed: %v", err)
+	}
+	logger.Debug("noisy debug", Server("noisy"))
+	if buf.Len() != 0 {
+		t.Errorf("Expected the override to be removed, got %q", buf.String())
+	}
+}
@@ -0,0 +1,175 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults for rotating the log file
+const (
+	DefaultMaxSize    = 100 << 20          // Bytes written before the file is rotated
+	DefaultMaxAge     = 7 * 24 * time.Hour // Time a file is written to before it is rotated
+	DefaultMaxBackups = 5                  // Rotated files kept
+)
+
+// backupTimeFormat names rotated files so they sort oldest first
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// Rotation controls when a log file is rotated and how many rotated files
+// are kept. Zero or a negative value means no limit.
+type Rotation struct {
+	MaxSize    int64
+	MaxAge     time.Duration
+	MaxBackups int
+}
+
+// DefaultRotation returns the rotation used when none is configured
+func DefaultRotation() Rotation {
+	return Rotation{MaxSize: DefaultMaxSize, MaxAge: DefaultMaxAge, MaxBackups: DefaultMaxBackups}
+}
+
+// File is a log file rotated once it grows past MaxSize or has been written
+// to for longer than MaxAge. The rotated file is renamed with the time of
+// rotation appended, e.g. mcpgate.log.2024-05-01T12-00-00.000, and the
+// oldest are removed beyond MaxBackups.
+type File struct {
+	path     string
+	rotation Rotation
+	now      func() time.Time
+
+	mutex  sync.Mutex
+	file   *os.File
+	size   int64
+	opened time.Time
+}
+
+// OpenFile opens the log file at path for appending, creating it and its
+// directory if needed
+func OpenFile(path string, rotation Rotation) (*File, error) {
+	f := &File{path: path, rotation: rotation, now: time.Now}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+	if err := f.openLocked(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Write appends p to the file, rotating it first when it is due. A record is
+// never split across files.
+func (f *File) Write(p []byte) (int, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	if f.dueLocked(len(p)) {
+		// A file that cannot be rotated keeps being written to
+		if err := f.rotateLocked(); err != nil && f.file == nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Close closes the file; later writes fail
+func (f *File) Close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// dueLocked reports whether the file must be rotated before writing n more
+// bytes. An empty file is never rotated.
+func (f *File) dueLocked(n int) bool {
+	if f.size == 0 {
+		return false
+	}
+	if f.rotation.MaxSize > 0 && f.size+int64(n) > f.rotation.MaxSize {
+		return true
+	}
+	return f.rotation.MaxAge > 0 && f.now().Sub(f.opened) >= f.rotation.MaxAge
+}
+
+// openLocked opens the file for appending. The age of a file written to
+// before is counted from when it was opened.
+func (f *File) openLocked() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	f.file = file
+	f.size = info.Size()
+	f.opened = f.now()
+	return nil
+}
+
+// rotateLocked renames the current file aside, opens a new one and removes
+// the oldest rotated files beyond MaxBackups
+func (f *File) rotateLocked() error {
+	if err := f.file.Close(); err != nil {
+		return fmt.Errorf("failed to close log file: %w", err)
+	}
+	f.file = nil
+
+	backup := f.path + "." + f.now().Format(backupTimeFormat)
+	if err := os.Rename(f.path, backup); err != nil {
+		if openErr := f.openLocked(); openErr != nil {
+			return openErr
+		}
+		return fmt.Errorf("failed to rotate log file: %w", err)
+	}
+	if err := f.openLocked(); err != nil {
+		return err
+	}
+	f.pruneLocked()
+	return nil
+}
+
+// pruneLocked removes the oldest rotated files beyond MaxBackups
+func (f *File) pruneLocked() {
+	if f.rotation.MaxBackups <= 0 {
+		return
+	}
+	dir, base := filepath.Split(f.path)
+	entries, err := os.ReadDir(filepath.Clean(dir))
+	if err != nil {
+		return
+	}
+	var rotated []string
+	for _, entry := range entries {
+		stamp, ok := strings.CutPrefix(entry.Name(), base+".")
+		if !ok {
+			continue
+		}
+		if _, err := time.Parse(backupTimeFormat, stamp); err == nil {
+			rotated = append(rotated, entry.Name())
+		}
+	}
+	sort.Strings(rotated)
+	for len(rotated) > f.rotation.MaxBackups {
+		_ = os.Remove(filepath.Join(dir, rotated[0]))
+		rotated = rotated[1:]
+	}
+}
@@ -0,0 +1,94 @@
+package logging
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// backups returns the rotated files next to path, oldest first
+func backups(t *testing.T, path string) []string {
+	t.Helper()
+	matches, err := filepath.Glob(path + ".*")
+	if err != nil {
+		t.Fatalf("Glob failed: %v", err)
+	}
+	return matches
+}
+
+func TestFile_RotatesBySize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "mcpgate.log")
+	file, err := OpenFile(path, Rotation{MaxSize: 10, MaxBackups: 2})
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	clock := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	file.now = func() time.Time {
+		clock = clock.Add(time.Second)
+		return clock
+	}
+
+	// A record larger than the limit still goes into one file
+	for _, record := range []string{"first\n", "second\n", "third\n", "a longer fourth\n", "fifth\n"} {
+		if _, err := file.Write([]byte(record)); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+
+	rotated := backups(t, path)
+	if len(rotated) != 2 {
+		t.Fatalf("Expected the 2 newest rotated files to be kept, got %v", rotated)
+	}
+	if data, _ := os.ReadFile(rotated[1]); string(data) != "a longer fourth\n" {
+		t.Errorf("Expected the newest rotated file to hold the fourth record, got %q", data)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "fifth\n" {
+		t.Errorf("Expected the current file to hold the last record, got %q", data)
+	}
+}
+
+func TestFile_RotatesByAge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mcpgate.log")
+	if err := os.WriteFile(path, []byte("from a previous run\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write log file: %v", err)
+	}
+
+	file, err := OpenFile(path, Rotation{MaxAge: time.Hour})
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	start := time.Now()
+	now := start
+	file.now = func() time.Time { return now }
+	file.opened = start
+
+	if _, err := file.Write([]byte("appended\n")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	now = start.Add(time.Hour)
+	if _, err := file.Write([]byte("after an hour\n")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	rotated := backups(t, path)
+	if len(rotated) != 1 {
+		t.Fatalf("Expected one rotated file, got %v", rotated)
+	}
+	if data, _ := os.ReadFile(rotated[0]); string(data) != "from a previous run\nappended\n" {
+		t.Errorf("Expected the rotated file to hold the earlier records, got %q", data)
+	}
+	if !strings.HasSuffix(rotated[0], now.Format(backupTimeFormat)) {
+		t.Errorf("Expected the rotated file to be named after the rotation time, got %s", rotated[0])
+	}
+	if data, _ := os.ReadFile(path); string(data) != "after an hour\n" {
+		t.Errorf("Expected the current file to hold the new record, got %q", data)
+	}
+}
@@ -0,0 +1,113 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/j4ng5y/mcpgate/audit"
+	"github.com/j4ng5y/mcpgate/logging"
+	"github.com/j4ng5y/mcpgate/transport"
+)
+
+// WithSession returns a context whose requests are recorded as part of the
+// session id. Server modes use it for their per-client sessions. The session
+// travels with the requests sent upstream, so cancellations stay within it.
+func WithSession(ctx context.Context, id string) context.Context {
+	return transport.WithSession(ctx, id)
+}
+
+// SessionFromContext returns the session stored in ctx, or ""
+func SessionFromContext(ctx context.Context) string {
+	return transport.SessionFromContext(ctx)
+}
+
+// SetAuditLog records every tools/call, including each call of
+// gateway/call_batch, to log. Calls refused by a client's policy are
+// recorded too.
+func (r *Router) SetAuditLog(log *audit.Log) {
+	r.audit = log
+}
+
+// auditKey is the context key for the tool call being audited
+type auditKey struct{}
+
+// auditedCall collects what is only known once a tool call is forwarded
+type auditedCall struct {
+	server string
+}
+
+// beginAudit starts auditing a tool call whose request carries params. The
+// returned function writes its record once the call is answered.
+func (r *Router) beginAudit(ctx context.Context, requestID interface{}, params json.RawMessage) (context.Context, func(*Response)) {
+	if r.audit == nil {
+		return ctx, func(*Response) {}
+	}
+	call := &auditedCall{}
+	ctx = context.WithValue(ctx, auditKey{}, call)
+	start := time.Now()
+	return ctx, func(resp *Response) {
+		r.writeAudit(ctx, requestID, params, call.server, time.Since(start), resp)
+	}
+}
+
+// auditForwarded notes the server a tool call being audited was sent to
+func auditForwarded(ctx context.Context, serverName string) {
+	if call, ok := ctx.Value(auditKey{}).(*auditedCall); ok {
+		call.server = serverName
+	}
+}
+
+// writeAudit writes the record of a tool call answered with resp
+func (r *Router) writeAudit(ctx context.Context, requestID interface{}, params json.RawMessage, serverName string, duration time.Duration, resp *Response) {
+	var call struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	}
+	_ = json.Unmarshal(params, &call)
+
+	record := audit.Record{
+		Time:       time.Now().UTC(),
+		Session:    SessionFromContext(ctx),
+		RequestID:  requestID,
+		Server:     serverName,
+		Tool:       call.Name,
+		Arguments:  call.Arguments,
+		Status:     audit.StatusOK,
+		DurationMS: float64(duration.Microseconds()) / 1000,
+	}
+	if client := ClientFromContext(ctx); client != nil {
+		record.Client = client.Name
+	}
+	switch {
+	case resp == nil:
+		record.Status = audit.StatusError
+	case resp.Error != nil:
+		record.Status = audit.StatusError
+		record.ErrorCode = resp.Error.Code
+		record.Error = resp.Error.Message
+	case isToolError(resp.Result):
+		record.Status = audit.StatusToolError
+	}
+
+	if err := r.audit.Write(record); err != nil {
+		slog.ErrorContext(ctx, "Failed to audit tool call", logging.Err(err))
+	}
+}
+
+// isToolError reports whether a tools/call result has isError set
+func isToolError(result interface{}) bool {
+	if fields, ok := result.(map[string]interface{}); ok {
+		isError, _ := fields["isError"].(bool)
+		return isError
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return false
+	}
+	var fields struct {
+		IsError bool `json:"isError"`
+	}
+	return json.Unmarshal(data, &fields) == nil && fields.IsError
+}
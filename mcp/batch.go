@@ -0,0 +1,147 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+)
+
+// DefaultBatchConcurrency caps how many calls of a batch run at once
+const DefaultBatchConcurrency = 8
+
+// MaxBatchSize is the largest number of calls accepted in one batch
+const MaxBatchSize = 100
+
+// BatchCall is a single tool invocation within gateway/call_batch
+type BatchCall struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+	Server    string          `json:"server,omitempty"` // Optional pin, like _meta.server
+}
+
+// BatchParams are the parameters of gateway/call_batch
+type BatchParams struct {
+	Calls          []BatchCall `json:"calls"`
+	MaxConcurrency int         `json:"max_concurrency,omitempty"`
+}
+
+// BatchResult is the outcome of one call, in the same position as its request
+type BatchResult struct {
+	Name   string        `json:"name"`
+	Result interface{}   `json:"result,omitempty"`
+	Error  *JSONRPCError `json:"error,omitempty"`
+}
+
+// handleCallBatch runs a list of tool calls concurrently across their upstreams
+// and returns per-call results in request order
+func (r *Router) handleCallBatch(ctx context.Context, req *Request) *Response {
+	var params BatchParams
+	if err := json.Unmarshal(req.Params, &params); err != nil || len(params.Calls) == 0 {
+		return &Response{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error: &JSONRPCError{
+				Code:    InvalidParams,
+				Message: "Invalid parameters: calls is required",
+			},
+		}
+	}
+	if len(params.Calls) > MaxBatchSize {
+		return &Response{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error: &JSONRPCError{
+				Code:    InvalidParams,
+				Message: "Invalid parameters: too many calls in batch",
+			},
+		}
+	}
+
+	concurrency := params.MaxConcurrency
+	if concurrency <= 0 || concurrency > DefaultBatchConcurrency {
+		concurrency = DefaultBatchConcurrency
+	}
+
+	results := make([]BatchResult, len(params.Calls))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	for i, call := range params.Calls {
+		wg.Add(1)
+		go func(i int, call BatchCall) {
+			defer wg.Done()
+
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				results[i] = BatchResult{
+					Name:  call.Name,
+					Error: &JSONRPCError{Code: InternalError, Message: ctx.Err().Error()},
+				}
+				return
+			}
+
+			results[i] = r.runBatchCall(ctx, req, i, call)
+		}(i, call)
+	}
+	wg.Wait()
+
+	return &Response{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Result: map[string]interface{}{
+			"results": results,
+		},
+	}
+}
+
+// runBatchCall routes a single batch entry as a tools/call request, traced
+// and cancelled with the batch like a request of its own
+func (r *Router) runBatchCall(ctx context.Context, batch *Request, index int, call BatchCall) BatchResult {
+	if call.Name == "" {
+		return BatchResult{
+			Error: &JSONRPCError{Code: InvalidParams, Message: "Invalid parameters: name is required"},
+		}
+	}
+
+	callParams := map[string]interface{}{"name": call.Name}
+	if len(call.Arguments) > 0 {
+		callParams["arguments"] = call.Arguments
+	}
+	if call.Server != "" {
+		callParams["_meta"] = map[string]interface{}{"server": call.Server}
+	}
+	data, err := json.Marshal(callParams)
+	if err != nil {
+		return BatchResult{
+			Name:  call.Name,
+			Error: &JSONRPCError{Code: InvalidParams, Message: err.Error()},
+		}
+	}
+
+	callReq := &Request{
+		JSONRPC: batch.JSONRPC,
+		ID:      index + 1,
+		Method:  MethodToolsCall,
+		Params:  data,
+	}
+	ctx, finish := r.beginRoute(ctx, callReq)
+
+	// Each call is audited on its own, under the batch's request id
+	ctx, audited := r.beginAudit(ctx, batch.ID, data)
+	var resp *Response
+	if permitsTool(ctx, call.Name) {
+		resp = r.routeToServer(ctx, callReq)
+	} else {
+		resp = forbidden(ctx, batch, "call tool "+call.Name)
+	}
+	audited(resp)
+	finish(resp)
+
+	return BatchResult{
+		Name:   call.Name,
+		Result: resp.Result,
+		Error:  resp.Error,
+	}
+}
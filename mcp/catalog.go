@@ -0,0 +1,44 @@
+package mcp
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// CatalogTool is a tool of the merged catalog, with the server offering it
+type CatalogTool struct {
+	Server      string `json:"server"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// ToolCatalog returns the tools each server is known to offer, from its
+// cached tools/list or else its static tool list, sorted by server and name.
+// Servers whose tools have not been listed yet contribute none.
+func (r *Router) ToolCatalog() []CatalogTool {
+	var catalog []CatalogTool
+	for _, srv := range r.manager.ListServers() {
+		items, cached := srv.CachedList(MethodToolsList)
+		if !cached || srv.OverridesDiscovery() {
+			for _, tool := range srv.StaticTools() {
+				catalog = append(catalog, CatalogTool{Server: srv.Name, Name: tool.Name, Description: tool.Description})
+			}
+			continue
+		}
+		for _, item := range items {
+			var tool CatalogTool
+			if json.Unmarshal(item, &tool) == nil && tool.Name != "" {
+				tool.Server = srv.Name
+				catalog = append(catalog, tool)
+			}
+		}
+	}
+
+	sort.Slice(catalog, func(i, j int) bool {
+		if catalog[i].Server != catalog[j].Server {
+			return catalog[i].Server < catalog[j].Server
+		}
+		return catalog[i].Name < catalog[j].Name
+	})
+	return catalog
+}
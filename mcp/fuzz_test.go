@@ -0,0 +1,176 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand"
+	"reflect"
+	"testing"
+	"testing/quick"
+
+	"github.com/j4ng5y/mcpgate/config"
+	"github.com/j4ng5y/mcpgate/internal/mcptest"
+	"github.com/j4ng5y/mcpgate/server"
+)
+
+// routedMethods covers gateway, capability-routed and unknown methods
+var routedMethods = []string{
+	"gateway/list_servers",
+	"gateway/get_server",
+	"gateway/server_status",
+	"gateway/capabilities",
+	"gateway/call_batch",
+	MethodToolsList,
+	MethodToolsCall,
+	MethodResourcesRead,
+	MethodResourcesSubscribe,
+	MethodPromptsGet,
+	"ping",
+	"no/such/method",
+}
+
+// checkResponseInvariants asserts the properties every routed response must
+// hold: JSON-RPC 2.0, the caller's id and at most one of result and error with
+// a valid code
+func checkResponseInvariants(t *testing.T, req *Request, resp *Response) {
+	t.Helper()
+
+	if resp == nil {
+		t.Fatalf("nil response for %s", req.Method)
+	}
+	if resp.JSONRPC != "2.0" {
+		t.Errorf("%s: expected jsonrpc 2.0, got %q", req.Method, resp.JSONRPC)
+	}
+	if !sameID(req.ID, resp.ID) {
+		t.Errorf("%s: expected id %#v, got %#v", req.Method, req.ID, resp.ID)
+	}
+	if resp.Error != nil {
+		if resp.Result != nil {
+			t.Errorf("%s: response has both result and error", req.Method)
+		}
+		if !validErrorCode(resp.Error.Code) {
+			t.Errorf("%s: invalid error code %d", req.Method, resp.Error.Code)
+		}
+	}
+}
+
+// sameID compares ids the way a client would after decoding the response
+func sameID(want, got interface{}) bool {
+	wantJSON, err1 := json.Marshal(want)
+	gotJSON, err2 := json.Marshal(got)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	var a, b interface{}
+	_ = json.Unmarshal(wantJSON, &a)
+	_ = json.Unmarshal(gotJSON, &b)
+	return reflect.DeepEqual(a, b)
+}
+
+// validErrorCode reports whether code is a standard JSON-RPC code or in the
+// implementation-defined server error range
+func validErrorCode(code int) bool {
+	switch code {
+	case ParseError, InvalidRequest, MethodNotFound, InvalidParams, InternalError:
+		return true
+	}
+	return code >= ServerErrorStart && code <= ServerErrorEnd
+}
+
+func FuzzParseRequest(f *testing.F) {
+	f.Add([]byte(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`))
+	f.Add([]byte(`{"jsonrpc":"2.0","id":"abc","method":"tools/call","params":{"name":"x","arguments":{}}}`))
+	f.Add([]byte(`{"jsonrpc":"2.0","method":"notifications/initialized"}`))
+	f.Add([]byte(`{"jsonrpc":"2.0","id":null,"method":""}`))
+	f.Add([]byte(`[1,2,3]`))
+	f.Add([]byte(`{`))
+	f.Add([]byte(``))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		req, errResp := ParseRequest(data)
+		if (req == nil) == (errResp == nil) {
+			t.Fatalf("expected exactly one of request and error response, got %v and %v", req, errResp)
+		}
+
+		if errResp != nil {
+			if errResp.Error == nil || errResp.Error.Code != ParseError {
+				t.Fatalf("expected parse error, got %+v", errResp)
+			}
+			return
+		}
+
+		// A parsed request survives re-encoding unchanged
+		encoded, err := json.Marshal(req)
+		if err != nil {
+			t.Fatalf("failed to re-encode %+v: %v", req, err)
+		}
+		again, errResp := ParseRequest(encoded)
+		if errResp != nil {
+			t.Fatalf("re-encoded request %s does not parse", encoded)
+		}
+		if again.Method != req.Method || again.JSONRPC != req.JSONRPC || !sameID(req.ID, again.ID) {
+			t.Fatalf("round trip changed request: %+v -> %+v", req, again)
+		}
+	})
+}
+
+func FuzzRoute(f *testing.F) {
+	manager := server.NewManager(&config.Config{})
+	if err := manager.Start(); err != nil {
+		f.Fatalf("Failed to start manager: %v", err)
+	}
+	f.Cleanup(manager.Stop)
+	router := NewRouter(manager)
+
+	for i, method := range routedMethods {
+		f.Add(method, int64(i), []byte(`{}`))
+	}
+	f.Add("gateway/call_batch", int64(1), []byte(`{"calls":[{"name":"a"}]}`))
+	f.Add("gateway/get_server", int64(2), []byte(`{"name":1}`))
+	f.Add(MethodToolsCall, int64(3), []byte(`{"_meta":{"server":"missing"}}`))
+	f.Add(MethodResourcesSubscribe, int64(4), []byte(`{"uri":"missing://x"}`))
+
+	f.Fuzz(func(t *testing.T, method string, id int64, params []byte) {
+		req := &Request{JSONRPC: "2.0", ID: float64(id), Method: method}
+		if json.Valid(params) {
+			req.Params = params
+		}
+
+		checkResponseInvariants(t, req, router.Route(context.Background(), req))
+	})
+}
+
+func TestRouter_ResponseInvariantsProperty(t *testing.T) {
+	manager := server.NewManager(&config.Config{
+		Servers: []config.ServerConfig{
+			{Name: "echo", Transport: "stdio", Enabled: true, Command: mcptest.EchoCommand, Args: mcptest.EchoArgs()},
+		},
+	})
+	if err := manager.Start(); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+	defer manager.Stop()
+	router := NewRouter(manager)
+
+	property := func(methodIndex uint8, numericID int32, stringID string, useString bool) bool {
+		var id interface{} = float64(numericID)
+		if useString {
+			id = stringID
+		}
+		req := &Request{
+			JSONRPC: "2.0",
+			ID:      id,
+			Method:  routedMethods[int(methodIndex)%len(routedMethods)],
+			Params:  json.RawMessage(`{"name":"echo"}`),
+		}
+
+		resp := router.Route(context.Background(), req)
+		checkResponseInvariants(t, req, resp)
+		return !t.Failed()
+	}
+
+	config := &quick.Config{MaxCount: 200, Rand: rand.New(rand.NewSource(1))}
+	if err := quick.Check(property, config); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,212 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/j4ng5y/mcpgate/logging"
+	"github.com/j4ng5y/mcpgate/server"
+)
+
+// inflightTracker remembers the client requests being routed, so a
+// cancellation can reach the upstream handling the request and stop the
+// gateway waiting for its response. Sessions reuse the same ids, so requests
+// are told apart by session as well.
+type inflightTracker struct {
+	mutex sync.Mutex
+	byID  map[inflightID]*inflightRequest
+}
+
+// inflightID identifies a client request among those of every session
+type inflightID struct {
+	session string
+	key     string
+}
+
+// inflightRequest is a client request the gateway is still routing
+type inflightRequest struct {
+	mutex   sync.Mutex
+	key     string
+	cancel  context.CancelFunc
+	servers []*server.ManagedServer
+	calls   []*inflightRequest // Requests made on its behalf, such as the calls of a batch
+}
+
+// inflightKey is the context key carrying the request being routed
+type inflightKey struct{}
+
+// begin records a client request and returns the context to route it with,
+// along with the function that forgets it once routed. A request begun while
+// routing another, such as a call of a batch, is recorded as a call of that
+// request instead, so it is cancelled along with it.
+func (t *inflightTracker) begin(ctx context.Context, id interface{}) (context.Context, func()) {
+	key := requestKey(id)
+	if key == "" {
+		return ctx, func() {}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	entry := &inflightRequest{key: key, cancel: cancel}
+
+	if parent, ok := ctx.Value(inflightKey{}).(*inflightRequest); ok {
+		parent.addCall(entry)
+		return context.WithValue(ctx, inflightKey{}, entry), func() {
+			cancel()
+			parent.removeCall(entry)
+		}
+	}
+
+	inflight := inflightID{session: SessionFromContext(ctx), key: key}
+	t.mutex.Lock()
+	if t.byID == nil {
+		t.byID = make(map[inflightID]*inflightRequest)
+	}
+	t.byID[inflight] = entry
+	t.mutex.Unlock()
+
+	return context.WithValue(ctx, inflightKey{}, entry), func() {
+		cancel()
+		t.mutex.Lock()
+		defer t.mutex.Unlock()
+		// A later request may have reused the id
+		if t.byID[inflight] == entry {
+			delete(t.byID, inflight)
+		}
+	}
+}
+
+// lookup returns the request of session being routed with the given id, if any
+func (t *inflightTracker) lookup(session string, id interface{}) *inflightRequest {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.byID[inflightID{session: session, key: requestKey(id)}]
+}
+
+// recordUpstream notes that req, carrying the id it was begun with, was sent
+// to srv
+func recordUpstream(ctx context.Context, req *Request, srv *server.ManagedServer) {
+	entry, ok := ctx.Value(inflightKey{}).(*inflightRequest)
+	if !ok || requestKey(req.ID) != entry.key {
+		return
+	}
+
+	entry.mutex.Lock()
+	defer entry.mutex.Unlock()
+	entry.servers = append(entry.servers, srv)
+}
+
+// upstreams returns the servers the request was forwarded to
+func (e *inflightRequest) upstreams() []*server.ManagedServer {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return append([]*server.ManagedServer(nil), e.servers...)
+}
+
+// addCall records a request made on this one's behalf
+func (e *inflightRequest) addCall(call *inflightRequest) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.calls = append(e.calls, call)
+}
+
+// removeCall forgets a call once it is routed
+func (e *inflightRequest) removeCall(call *inflightRequest) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.calls = slices.DeleteFunc(e.calls, func(c *inflightRequest) bool { return c == call })
+}
+
+// cancelUpstreams forwards a client's cancellation to the servers handling
+// the request, and to those handling its calls under the ids they were sent
+// with
+func (e *inflightRequest) cancelUpstreams(ctx context.Context, req *Request) {
+	notification := upstreamMessage(req)
+	for _, srv := range e.upstreams() {
+		if err := srv.SendNotification(ctx, notification); err != nil {
+			slog.WarnContext(ctx, "Failed to forward notification", logging.Server(srv.Name), logging.Err(err))
+		}
+	}
+
+	e.mutex.Lock()
+	calls := append([]*inflightRequest(nil), e.calls...)
+	e.mutex.Unlock()
+	for _, call := range calls {
+		call.cancelUpstreams(ctx, cancellationOf(req, call.key))
+	}
+}
+
+// cancellationOf returns a copy of a cancellation naming another request,
+// given by its key
+func cancellationOf(req *Request, key string) *Request {
+	var params map[string]json.RawMessage
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		params = make(map[string]json.RawMessage)
+	}
+	params["requestId"] = json.RawMessage(key)
+	data, _ := json.Marshal(params)
+
+	cancellation := *req
+	cancellation.Params = data
+	return &cancellation
+}
+
+// requestKey encodes a JSON-RPC id as a comparable string
+func requestKey(id interface{}) string {
+	if id == nil {
+		return ""
+	}
+	data, err := json.Marshal(id)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// isNotification reports whether req is a client notification. Other
+// methods sent without an id are still answered, as they always have been.
+func isNotification(req *Request) bool {
+	return req.ID == nil && (strings.HasPrefix(req.Method, "notifications/") || req.Method == MethodInitialized)
+}
+
+// routeNotification forwards a client notification upstream. A cancellation
+// goes to the servers handling the cancelled request, which the gateway then
+// stops waiting for; the client's initialized notification goes nowhere, as
+// every upstream is sent its own when it connects; anything else goes to
+// every active server the client may use.
+func (r *Router) routeNotification(ctx context.Context, req *Request) {
+	if req.Method == MethodInitializedNotify || req.Method == MethodInitialized {
+		return
+	}
+
+	notification := upstreamMessage(req)
+
+	if req.Method != MethodCancelled {
+		for _, srv := range permittedServers(ctx, r.manager.ListActiveServers()) {
+			if err := srv.SendNotification(ctx, notification); err != nil {
+				slog.WarnContext(ctx, "Failed to forward notification", logging.Server(srv.Name), logging.Err(err))
+			}
+		}
+		return
+	}
+
+	var params struct {
+		RequestID interface{} `json:"requestId"`
+	}
+	if err := json.Unmarshal(req.Params, &params); err != nil || params.RequestID == nil {
+		slog.WarnContext(ctx, "Ignoring cancellation without a requestId")
+		return
+	}
+
+	entry := r.inflight.lookup(SessionFromContext(ctx), params.RequestID)
+	if entry == nil {
+		// The request already completed; the response may be on its way
+		return
+	}
+
+	entry.cancelUpstreams(ctx, req)
+	entry.cancel()
+}
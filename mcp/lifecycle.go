@@ -0,0 +1,297 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/j4ng5y/mcpgate/config"
+	"github.com/j4ng5y/mcpgate/server"
+)
+
+// Bounds on connecting a server added at runtime, and on waiting for the
+// requests in flight on a server being removed
+const (
+	serverConnectTimeout = 30 * time.Second
+	serverDrainTimeout   = 30 * time.Second
+)
+
+// EnableRuntimeChanges accepts gateway/add_server and gateway/remove_server,
+// which start and stop upstream processes on the gateway's host
+func (r *Router) EnableRuntimeChanges() {
+	r.runtimeChanges = true
+}
+
+// refuseRuntimeChange refuses adding or removing a server unless runtime
+// changes are enabled and, for a request from a network server mode, it was
+// made by an authenticated client; checkPolicy requires that client to be an
+// admin
+func (r *Router) refuseRuntimeChange(ctx context.Context, req *Request) *Response {
+	message := ""
+	switch {
+	case !r.runtimeChanges:
+		message = "Adding and removing servers is disabled (see gateway.allow_runtime_changes)"
+	case fromNetwork(ctx) && ClientFromContext(ctx) == nil:
+		message = "Adding and removing servers over the network requires an authenticated admin client"
+	default:
+		return nil
+	}
+	return &Response{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Error: &JSONRPCError{
+			Code:    Forbidden,
+			Message: message,
+		},
+	}
+}
+
+// handleAddServer registers and connects a new upstream server at runtime.
+// The server entry uses the same keys as a [[server]] table in config.toml;
+// with persist set it is also appended to the config file.
+func (r *Router) handleAddServer(ctx context.Context, req *Request) *Response {
+	if errResp := r.refuseRuntimeChange(ctx, req); errResp != nil {
+		return errResp
+	}
+
+	var params struct {
+		Server  json.RawMessage `json:"server"`
+		Persist bool            `json:"persist"`
+	}
+
+	if req.Params != nil {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return &Response{
+				JSONRPC: "2.0",
+				ID:      req.ID,
+				Error: &JSONRPCError{
+					Code:    InvalidParams,
+					Message: "Invalid parameters",
+				},
+			}
+		}
+	}
+
+	serverCfg, entry, err := config.ParseServer(params.Server)
+	if err != nil {
+		return &Response{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error: &JSONRPCError{
+				Code:    InvalidParams,
+				Message: err.Error(),
+			},
+		}
+	}
+
+	instances := config.ExpandReplicas([]config.ServerConfig{serverCfg})
+	for _, instance := range instances {
+		if _, err := r.manager.GetServer(instance.Name); err == nil {
+			return &Response{
+				JSONRPC: "2.0",
+				ID:      req.ID,
+				Error: &JSONRPCError{
+					Code:    -32000,
+					Message: "Server " + instance.Name + " already exists",
+				},
+			}
+		}
+	}
+
+	connectCtx, cancel := context.WithTimeout(ctx, serverConnectTimeout)
+	defer cancel()
+
+	added := make([]map[string]interface{}, 0, len(instances))
+	for _, instance := range instances {
+		srv, connectErr := r.manager.AddServer(connectCtx, instance)
+		if srv == nil {
+			return &Response{
+				JSONRPC: "2.0",
+				ID:      req.ID,
+				Error: &JSONRPCError{
+					Code:    -32000,
+					Message: connectErr.Error(),
+				},
+			}
+		}
+		status := map[string]interface{}{
+			"name":      srv.Name,
+			"state":     srv.State(),
+			"connected": srv.IsConnected(),
+		}
+		if connectErr != nil {
+			status["error"] = connectErr.Error()
+		}
+		added = append(added, status)
+	}
+
+	if params.Persist {
+		message := "gateway has no config file"
+		if path := r.manager.ConfigPath(); path != "" {
+			err = config.AppendServer(path, entry)
+			if err == nil {
+				message = ""
+			} else {
+				message = err.Error()
+			}
+		}
+		if message != "" {
+			return &Response{
+				JSONRPC: "2.0",
+				ID:      req.ID,
+				Error: &JSONRPCError{
+					Code:    -32000,
+					Message: "Server added but not persisted: " + message,
+				},
+			}
+		}
+	}
+
+	// A replicated server reports each replica under its own name
+	result := added[0]
+	if len(added) > 1 {
+		result = map[string]interface{}{
+			"name":     serverCfg.Name,
+			"replicas": added,
+		}
+	}
+	result["persisted"] = params.Persist
+
+	return &Response{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Result:  result,
+	}
+}
+
+// handleRemoveServer drains, disconnects and unregisters an upstream server at
+// runtime; with persist set it is also deleted from the config file
+func (r *Router) handleRemoveServer(ctx context.Context, req *Request) *Response {
+	if errResp := r.refuseRuntimeChange(ctx, req); errResp != nil {
+		return errResp
+	}
+
+	var params struct {
+		Name    string `json:"name"`
+		Persist bool   `json:"persist"`
+	}
+
+	if req.Params != nil {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return &Response{
+				JSONRPC: "2.0",
+				ID:      req.ID,
+				Error: &JSONRPCError{
+					Code:    InvalidParams,
+					Message: "Invalid parameters",
+				},
+			}
+		}
+	}
+
+	drainCtx, cancel := context.WithTimeout(ctx, serverDrainTimeout)
+	defer cancel()
+
+	if err := r.manager.RemoveServer(drainCtx, params.Name); err != nil {
+		return &Response{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error: &JSONRPCError{
+				Code:    -32000,
+				Message: "Server not found",
+			},
+		}
+	}
+
+	if params.Persist {
+		message := "gateway has no config file"
+		if path := r.manager.ConfigPath(); path != "" {
+			if err := config.RemoveServer(path, params.Name); err == nil {
+				message = ""
+			} else {
+				message = err.Error()
+			}
+		}
+		if message != "" {
+			return &Response{
+				JSONRPC: "2.0",
+				ID:      req.ID,
+				Error: &JSONRPCError{
+					Code:    -32000,
+					Message: "Server removed but not persisted: " + message,
+				},
+			}
+		}
+	}
+
+	return &Response{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Result: map[string]interface{}{
+			"name":      params.Name,
+			"removed":   true,
+			"persisted": params.Persist,
+		},
+	}
+}
+
+// handleReconnectServer disconnects and reconnects an upstream server, e.g.
+// one that stopped answering without dropping its connection
+func (r *Router) handleReconnectServer(ctx context.Context, req *Request) *Response {
+	var params struct {
+		Name string `json:"name"`
+	}
+
+	if req.Params != nil {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return &Response{
+				JSONRPC: "2.0",
+				ID:      req.ID,
+				Error: &JSONRPCError{
+					Code:    InvalidParams,
+					Message: "Invalid parameters",
+				},
+			}
+		}
+	}
+
+	if err := r.manager.ReconnectServer(params.Name); err != nil {
+		message := "Reconnect failed: " + err.Error()
+		var managerErr *server.ManagerError
+		if errors.As(err, &managerErr) {
+			message = "Server not found"
+		}
+		return &Response{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error: &JSONRPCError{
+				Code:    -32000,
+				Message: message,
+			},
+		}
+	}
+
+	srv, err := r.manager.GetServer(params.Name)
+	if err != nil {
+		// Removed while reconnecting
+		return &Response{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error: &JSONRPCError{
+				Code:    -32000,
+				Message: "Server not found",
+			},
+		}
+	}
+
+	return &Response{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Result: map[string]interface{}{
+			"name":      srv.Name,
+			"connected": srv.IsConnected(),
+			"state":     srv.State(),
+		},
+	}
+}
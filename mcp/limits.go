@@ -0,0 +1,145 @@
+package mcp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Default limits on the requests accepted from downstream clients
+const (
+	DefaultMaxRequestSize = 4 << 20 // Bytes in a single JSON-RPC message
+	DefaultMaxParamsDepth = 64      // Nesting of objects and arrays in params
+)
+
+// ErrRequestTooLarge is returned when a message exceeds MaxRequestSize. The
+// rest of the message has been discarded, so the next one can be read.
+var ErrRequestTooLarge = errors.New("request too large")
+
+// Limits bounds the requests accepted from downstream clients. Zero or a
+// negative value means no limit.
+type Limits struct {
+	MaxRequestSize int
+	MaxParamsDepth int
+}
+
+// DefaultLimits returns the limits used when none are configured
+func DefaultLimits() Limits {
+	return Limits{MaxRequestSize: DefaultMaxRequestSize, MaxParamsDepth: DefaultMaxParamsDepth}
+}
+
+// ParseRequest decodes a single JSON-RPC request, refusing one that exceeds
+// the limits. On failure it returns the error response to send back instead.
+func (l Limits) ParseRequest(data []byte) (*Request, *Response) {
+	if l.MaxRequestSize > 0 && len(data) > l.MaxRequestSize {
+		return nil, l.TooLarge()
+	}
+
+	req, errResp := ParseRequest(data)
+	if errResp != nil {
+		return nil, errResp
+	}
+
+	if l.MaxParamsDepth > 0 && jsonDepth(req.Params) > l.MaxParamsDepth {
+		return nil, &Response{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error: &JSONRPCError{
+				Code:    InvalidRequest,
+				Message: fmt.Sprintf("Params are nested deeper than the limit of %d", l.MaxParamsDepth),
+			},
+		}
+	}
+	return req, nil
+}
+
+// TooLarge returns the error response for a message over MaxRequestSize. Its
+// id is unknown, as the message is never parsed.
+func (l Limits) TooLarge() *Response {
+	return &Response{
+		JSONRPC: "2.0",
+		Error: &JSONRPCError{
+			Code:    InvalidRequest,
+			Message: fmt.Sprintf("Request exceeds the limit of %d bytes", l.MaxRequestSize),
+		},
+	}
+}
+
+// ReadLine reads one newline-delimited message without buffering more than
+// MaxRequestSize bytes of it. A longer line is discarded up to its newline
+// and ErrRequestTooLarge returned.
+func (l Limits) ReadLine(r *bufio.Reader) ([]byte, error) {
+	var line []byte
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if l.MaxRequestSize <= 0 || len(line)+len(chunk) <= l.MaxRequestSize+1 {
+			line = append(line, chunk...)
+		} else {
+			// Keep reading to the end of the line so the next one starts clean
+			line = nil
+			for errors.Is(err, bufio.ErrBufferFull) {
+				_, err = r.ReadSlice('\n')
+			}
+			if err != nil {
+				return nil, err
+			}
+			return nil, ErrRequestTooLarge
+		}
+
+		if !errors.Is(err, bufio.ErrBufferFull) {
+			return line, err
+		}
+	}
+}
+
+// ReadMessage reads a whole message from r, such as a WebSocket frame,
+// without buffering more than MaxRequestSize bytes of it. A longer message
+// is drained and ErrRequestTooLarge returned.
+func (l Limits) ReadMessage(r io.Reader) ([]byte, error) {
+	if l.MaxRequestSize <= 0 {
+		return io.ReadAll(r)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r, int64(l.MaxRequestSize)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > l.MaxRequestSize {
+		if _, err := io.Copy(io.Discard, r); err != nil {
+			return nil, err
+		}
+		return nil, ErrRequestTooLarge
+	}
+	return data, nil
+}
+
+// jsonDepth returns how deeply objects and arrays nest in a JSON value,
+// scanning it without decoding
+func jsonDepth(data []byte) int {
+	depth, deepest := 0, 0
+	inString, escaped := false, false
+	for _, c := range data {
+		switch {
+		case escaped:
+			escaped = false
+		case inString:
+			switch c {
+			case '\\':
+				escaped = true
+			case '"':
+				inString = false
+			}
+		case c == '"':
+			inString = true
+		case c == '{' || c == '[':
+			depth++
+			if depth > deepest {
+				deepest = depth
+			}
+		case c == '}' || c == ']':
+			depth--
+		}
+	}
+	return deepest
+}
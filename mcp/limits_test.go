@@ -0,0 +1,68 @@
+package mcp
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestLimits_ParseRequest(t *testing.T) {
+	limits := Limits{MaxRequestSize: 100, MaxParamsDepth: 3}
+
+	if _, errResp := limits.ParseRequest([]byte(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"a":[{"b":"[[[[{{{"}]}}`)); errResp != nil {
+		t.Errorf("Expected params 3 deep to be accepted, got %v", errResp.Error.Message)
+	}
+
+	_, errResp := limits.ParseRequest([]byte(`{"jsonrpc":"2.0","id":7,"method":"tools/call","params":{"a":[{"b":[]}]}}`))
+	if errResp == nil || errResp.Error.Code != InvalidRequest || errResp.ID != float64(7) {
+		t.Errorf("Expected params 4 deep to be refused with the request's id, got %+v", errResp)
+	}
+
+	_, errResp = limits.ParseRequest([]byte(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"text":"` + strings.Repeat("x", 100) + `"}}`))
+	if errResp == nil || errResp.Error.Code != InvalidRequest {
+		t.Errorf("Expected an oversized request to be refused, got %+v", errResp)
+	}
+
+	// No limits
+	deep := `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":` + strings.Repeat("[", 200) + strings.Repeat("]", 200) + `}`
+	if _, errResp := (Limits{}).ParseRequest([]byte(deep)); errResp != nil {
+		t.Errorf("Expected no limits to accept anything, got %v", errResp.Error.Message)
+	}
+}
+
+func TestLimits_ReadLine(t *testing.T) {
+	limits := Limits{MaxRequestSize: 10}
+	// The oversized line spans several buffer fills
+	input := "short\n" + strings.Repeat("x", 100) + "\nnext\nlast"
+	reader := bufio.NewReaderSize(strings.NewReader(input), 16)
+
+	expect := func(want string, wantErr error) {
+		t.Helper()
+		line, err := limits.ReadLine(reader)
+		if string(line) != want || !errors.Is(err, wantErr) {
+			t.Errorf("Expected %q (%v), got %q (%v)", want, wantErr, line, err)
+		}
+	}
+	expect("short\n", nil)
+	expect("", ErrRequestTooLarge)
+	expect("next\n", nil)
+	expect("last", io.EOF)
+}
+
+func TestLimits_ReadMessage(t *testing.T) {
+	limits := Limits{MaxRequestSize: 10}
+
+	reader := strings.NewReader(strings.Repeat("x", 100))
+	if _, err := limits.ReadMessage(reader); !errors.Is(err, ErrRequestTooLarge) {
+		t.Errorf("Expected ErrRequestTooLarge, got %v", err)
+	}
+	if reader.Len() != 0 {
+		t.Errorf("Expected the oversized message to be drained, %d bytes left", reader.Len())
+	}
+
+	if data, err := limits.ReadMessage(strings.NewReader("0123456789")); err != nil || string(data) != "0123456789" {
+		t.Errorf("Expected a message at the limit to be read, got %q (%v)", data, err)
+	}
+}
@@ -0,0 +1,209 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/j4ng5y/mcpgate/server"
+)
+
+// ManagementToolPrefix prefixes the names of the gateway's own management tools
+const ManagementToolPrefix = "mcpgate_"
+
+// managementTool describes a gateway management tool in the tools catalog
+type managementTool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	InputSchema map[string]interface{} `json:"inputSchema"`
+}
+
+// serverNameSchema is the input schema of tools that act on a single server
+var serverNameSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"name": map[string]interface{}{
+			"type":        "string",
+			"description": "Name of the upstream server",
+		},
+	},
+	"required": []string{"name"},
+}
+
+// managementTools are the gateway operations exposed as MCP tools
+var managementTools = []managementTool{
+	{
+		Name:        ManagementToolPrefix + "list_servers",
+		Description: "List the upstream MCP servers behind the gateway and their state",
+		InputSchema: map[string]interface{}{"type": "object"},
+	},
+	{
+		Name:        ManagementToolPrefix + "stats",
+		Description: "Summarize how many upstream servers are connected, quarantined or disabled",
+		InputSchema: map[string]interface{}{"type": "object"},
+	},
+	{
+		Name:        ManagementToolPrefix + "reconnect_server",
+		Description: "Disconnect and reconnect an upstream server",
+		InputSchema: serverNameSchema,
+	},
+	{
+		Name:        ManagementToolPrefix + "enable_server",
+		Description: "Reconnect a disabled upstream server and route requests to it again",
+		InputSchema: serverNameSchema,
+	},
+	{
+		Name:        ManagementToolPrefix + "disable_server",
+		Description: "Disconnect an upstream server and stop routing requests to it",
+		InputSchema: serverNameSchema,
+	},
+}
+
+// EnableManagementTools adds the gateway management tools to the tools catalog
+func (r *Router) EnableManagementTools() {
+	r.managementEnabled = true
+}
+
+// withManagementTools appends the management tools to a tools/list response.
+// The tools are listed even when no upstream can answer tools/list.
+func (r *Router) withManagementTools(req *Request, resp *Response) *Response {
+	result := make(map[string]interface{})
+	if resp.Error == nil && resp.Result != nil {
+		data, err := json.Marshal(resp.Result)
+		if err != nil || json.Unmarshal(data, &result) != nil {
+			return resp
+		}
+	}
+
+	tools, _ := result["tools"].([]interface{})
+	for _, tool := range managementTools {
+		tools = append(tools, tool)
+	}
+	result["tools"] = tools
+
+	return &Response{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Result:  result,
+	}
+}
+
+// handleManagementToolCall runs a management tool. It reports false when the
+// call names some other tool and should be routed upstream.
+func (r *Router) handleManagementToolCall(ctx context.Context, req *Request) (*Response, bool) {
+	var params struct {
+		Name      string `json:"name"`
+		Arguments struct {
+			Name string `json:"name"`
+		} `json:"arguments"`
+	}
+	if err := json.Unmarshal(req.Params, &params); err != nil || !strings.HasPrefix(params.Name, ManagementToolPrefix) {
+		return nil, false
+	}
+
+	var result interface{}
+	var err error
+
+	switch strings.TrimPrefix(params.Name, ManagementToolPrefix) {
+	case "list_servers":
+		result = r.handleListServers(ctx, req).Result
+	case "stats":
+		result = r.serverStats(ctx)
+	case "reconnect_server":
+		err = r.manager.ReconnectServer(params.Arguments.Name)
+		result = "reconnected " + params.Arguments.Name
+	case "enable_server":
+		err = r.manager.EnableServer(params.Arguments.Name)
+		result = "enabled " + params.Arguments.Name
+	case "disable_server":
+		err = r.manager.DisableServer(params.Arguments.Name)
+		result = "disabled " + params.Arguments.Name
+	default:
+		return nil, false
+	}
+
+	if err != nil {
+		return toolResult(req, err.Error(), true), true
+	}
+	if text, ok := result.(string); ok {
+		return toolResult(req, text, false), true
+	}
+
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return toolResult(req, err.Error(), true), true
+	}
+	return toolResult(req, string(data), false), true
+}
+
+// handleStats returns the gateway's server statistics
+func (r *Router) handleStats(ctx context.Context, req *Request) *Response {
+	return &Response{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Result:  r.serverStats(ctx),
+	}
+}
+
+// serverStats counts upstream servers by state and reports the request queue
+// length of each server with a concurrency limit, the connection pool of each
+// server with one and the request metrics of every server the request's
+// client may use
+func (r *Router) serverStats(ctx context.Context) map[string]interface{} {
+	states := make(map[string]int)
+	queued := make(map[string]int)
+	pools := make(map[string]interface{})
+	requests := make(map[string]interface{})
+	servers := permittedServers(ctx, r.manager.ListServers())
+	for _, srv := range servers {
+		states[srv.State()]++
+		if srv.Config.MaxConcurrent > 0 {
+			queued[srv.Name] = srv.QueueLength()
+		}
+		if pool := srv.PoolStats(); pool != nil {
+			pools[srv.Name] = pool
+		}
+		requests[srv.Name] = requestMetricsResult(srv.RequestMetrics())
+	}
+
+	return map[string]interface{}{
+		"servers":  len(servers),
+		"states":   states,
+		"queued":   queued,
+		"pools":    pools,
+		"requests": requests,
+	}
+}
+
+// requestMetricsResult describes a server's request counts and latency
+// percentiles for gateway/stats and gateway/server_status
+func requestMetricsResult(metrics server.RequestMetrics) map[string]interface{} {
+	milliseconds := func(d time.Duration) float64 {
+		return float64(d.Microseconds()) / 1000
+	}
+	return map[string]interface{}{
+		"count":      metrics.Requests,
+		"errors":     metrics.Errors,
+		"error_rate": metrics.ErrorRate,
+		"latency_ms": map[string]float64{
+			"p50": milliseconds(metrics.P50),
+			"p90": milliseconds(metrics.P90),
+			"p99": milliseconds(metrics.P99),
+		},
+	}
+}
+
+// toolResult wraps text in a tools/call result
+func toolResult(req *Request, text string, isError bool) *Response {
+	return &Response{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Result: map[string]interface{}{
+			"content": []map[string]interface{}{
+				{"type": "text", "text": text},
+			},
+			"isError": isError,
+		},
+	}
+}
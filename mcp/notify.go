@@ -0,0 +1,185 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/j4ng5y/mcpgate/server"
+)
+
+// NotifyFunc delivers a server-initiated notification to the downstream client
+type NotifyFunc func(notification *Notification)
+
+// listChangedMethods maps each aggregated capability to its list_changed notification
+var listChangedMethods = map[string]string{
+	"tools":     MethodToolsUpdated,
+	"resources": MethodResourcesUpdated,
+	"prompts":   MethodPromptsUpdated,
+}
+
+// catalogListMethods maps each aggregated capability to the list method
+// whose items make up its catalog
+var catalogListMethods = map[string]string{
+	"tools":     MethodToolsList,
+	"resources": MethodResourcesList,
+	"prompts":   MethodPromptsList,
+}
+
+// catalogTracker remembers the last advertised catalog so only real changes are announced
+type catalogTracker struct {
+	mutex             sync.Mutex
+	notifiers         []NotifyFunc
+	clientInitialized bool
+	snapshot          map[string]map[string]string
+}
+
+// SetNotifier sets the function used to push notifications to the client,
+// replacing any added before
+func (r *Router) SetNotifier(fn NotifyFunc) {
+	r.catalog.mutex.Lock()
+	defer r.catalog.mutex.Unlock()
+	r.catalog.notifiers = []NotifyFunc{fn}
+}
+
+// AddNotifier adds a function notifications are pushed to, for gateways
+// serving clients on several listeners at once
+func (r *Router) AddNotifier(fn NotifyFunc) {
+	r.catalog.mutex.Lock()
+	defer r.catalog.mutex.Unlock()
+	r.catalog.notifiers = append(r.catalog.notifiers, fn)
+}
+
+// Receives reports whether the client session of ctx is sent a
+// notification. Resource updates go only to the session that subscribed, and
+// notifications about upstream servers only to clients that may use one of
+// them; notifiers call it for each of their sessions.
+func (r *Router) Receives(ctx context.Context, n *Notification) bool {
+	if n.addressed && n.session != SessionFromContext(ctx) {
+		return false
+	}
+	if len(n.servers) == 0 {
+		return true
+	}
+	for _, name := range n.servers {
+		if r.permitsServerName(ctx, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// sendNotification pushes a notification to every notifier
+func (r *Router) sendNotification(n *Notification) {
+	r.catalog.mutex.Lock()
+	notifiers := r.catalog.notifiers
+	r.catalog.mutex.Unlock()
+
+	for _, notify := range notifiers {
+		notify(n)
+	}
+}
+
+// markClientInitialized records that the client has started a session and can receive notifications
+func (r *Router) markClientInitialized() {
+	r.catalog.mutex.Lock()
+	defer r.catalog.mutex.Unlock()
+	r.catalog.clientInitialized = true
+}
+
+// SyncCapabilities compares the aggregated catalog against the last one advertised
+// and emits list_changed notifications for each capability whose contents changed
+func (r *Router) SyncCapabilities() {
+	current := r.catalogFingerprint()
+
+	r.catalog.mutex.Lock()
+	previous := r.catalog.snapshot
+	r.catalog.snapshot = current
+	ready := r.catalog.clientInitialized && len(r.catalog.notifiers) > 0
+	r.catalog.mutex.Unlock()
+
+	if !ready || previous == nil {
+		return
+	}
+
+	for _, capability := range []string{"tools", "resources", "prompts"} {
+		changed := changedServers(previous[capability], current[capability])
+		if len(changed) == 0 {
+			continue
+		}
+		slog.Info("Aggregated catalog changed, notifying client", "capability", capability, "servers", strings.Join(changed, ","))
+		r.sendNotification(&Notification{
+			JSONRPC: "2.0",
+			Method:  listChangedMethods[capability],
+			servers: changed,
+		})
+	}
+}
+
+// catalogFingerprint summarizes, for each capability, what every connected
+// server contributes to it
+func (r *Router) catalogFingerprint() map[string]map[string]string {
+	fingerprint := make(map[string]map[string]string, len(listChangedMethods))
+	for capability := range listChangedMethods {
+		fingerprint[capability] = make(map[string]string)
+	}
+	for _, srv := range r.manager.ListServers() {
+		if !srv.IsConnected() || srv.IsQuarantined() {
+			continue
+		}
+		for capability := range listChangedMethods {
+			if srv.HasCapability(capability) {
+				fingerprint[capability][srv.Name] = catalogContribution(srv, capability)
+			}
+		}
+	}
+	return fingerprint
+}
+
+// catalogContribution summarizes the items a server contributes to a
+// capability's catalog: the names of its cached items, or of its static tools
+// where those are advertised instead, sorted. A server whose list is not
+// cached contributes nothing yet.
+func catalogContribution(srv *server.ManagedServer, capability string) string {
+	items, cached := srv.CachedList(catalogListMethods[capability])
+
+	var names []string
+	if capability == "tools" && (!cached || srv.OverridesDiscovery()) {
+		for _, tool := range srv.StaticTools() {
+			names = append(names, tool.Name)
+		}
+	} else {
+		for _, item := range items {
+			var entry struct {
+				Name string `json:"name"`
+				URI  string `json:"uri"`
+			}
+			if json.Unmarshal(item, &entry) == nil {
+				names = append(names, entry.URI+" "+entry.Name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return strings.Join(names, "\n")
+}
+
+// changedServers returns the servers whose contribution to a capability
+// differs between two fingerprints, sorted
+func changedServers(previous, current map[string]string) []string {
+	var changed []string
+	for name, contribution := range current {
+		if before, ok := previous[name]; !ok || before != contribution {
+			changed = append(changed, name)
+		}
+	}
+	for name := range previous {
+		if _, ok := current[name]; !ok {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
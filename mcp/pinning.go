@@ -0,0 +1,196 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+
+	"github.com/j4ng5y/mcpgate/server"
+)
+
+// ServerHintHeader pins a request to one upstream when the gateway is served over HTTP
+const ServerHintHeader = "Mcp-Gateway-Server"
+
+// serverHintKey is the context key for a routing hint supplied outside the request body
+type serverHintKey struct{}
+
+// WithServerHint returns a context that pins requests routed with it to serverName.
+// Server modes use it to pass on the value of ServerHintHeader.
+func WithServerHint(ctx context.Context, serverName string) context.Context {
+	if serverName == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, serverHintKey{}, serverName)
+}
+
+// serverHint returns the routing hint stored in ctx, if any
+func serverHint(ctx context.Context) string {
+	name, _ := ctx.Value(serverHintKey{}).(string)
+	return name
+}
+
+// routingParams are the gateway routing hints that may appear in request params
+type routingParams struct {
+	Meta struct {
+		Server string `json:"server"`
+		Tag    string `json:"tag"`
+	} `json:"_meta"`
+	Server string `json:"_server"` // Deprecated: use _meta.server
+}
+
+// pinnedServerName returns the server a request is pinned to: _meta.server,
+// then the legacy _server param, then a hint carried on the context
+func pinnedServerName(ctx context.Context, req *Request) string {
+	if len(req.Params) > 0 {
+		var params routingParams
+		if err := json.Unmarshal(req.Params, &params); err == nil {
+			if params.Meta.Server != "" {
+				return params.Meta.Server
+			}
+			if params.Server != "" {
+				return params.Server
+			}
+		}
+	}
+	return serverHint(ctx)
+}
+
+// routingTag returns the tag in a request's _meta.tag, if any
+func routingTag(req *Request) string {
+	if len(req.Params) == 0 {
+		return ""
+	}
+	var params routingParams
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return ""
+	}
+	return params.Meta.Tag
+}
+
+// taggedServer picks a routable server carrying the request's _meta.tag that
+// can handle its method. It returns nil and no error when the request carries
+// no tag, and an error response when no such server is available.
+func (r *Router) taggedServer(ctx context.Context, req *Request) (*server.ManagedServer, *Response) {
+	tag := routingTag(req)
+	if tag == "" {
+		return nil, nil
+	}
+
+	capability := r.extractCapability(req.Method)
+	for _, srv := range permittedServers(ctx, r.manager.ListServersByTag(tag)) {
+		if mayHandle(srv, capability) {
+			return srv, nil
+		}
+	}
+
+	message := "No server available with tag " + tag
+	if capability != "" {
+		message += " that supports " + capability
+	}
+	return nil, &Response{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Error: &JSONRPCError{
+			Code:    InvalidParams,
+			Message: message,
+		},
+	}
+}
+
+// pinnedServer resolves the server a request is pinned to, which may be named
+// directly or by its replica group. It returns nil and no error when the
+// request carries no hint, and an error response when the pinned server does
+// not exist, is not the client's to use or lacks the capability the method
+// requires.
+func (r *Router) pinnedServer(ctx context.Context, req *Request) (*server.ManagedServer, *Response) {
+	name := pinnedServerName(ctx, req)
+	if name == "" {
+		return nil, nil
+	}
+
+	srv, err := r.manager.GetServer(name)
+	if err != nil {
+		// A replica group name pins the request to one of its replicas
+		if replicas := r.manager.ListServersByGroup(name); len(replicas) > 0 {
+			srv, err = replicas[0], nil
+		}
+	}
+	if err != nil {
+		return nil, &Response{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error: &JSONRPCError{
+				Code:    InvalidParams,
+				Message: "Pinned server not found: " + name,
+			},
+		}
+	}
+
+	if !permitsServer(ctx, srv) {
+		return nil, forbidden(ctx, req, "use server "+name)
+	}
+
+	capability := r.extractCapability(req.Method)
+	if !mayHandle(srv, capability) {
+		return nil, &Response{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error: &JSONRPCError{
+				Code:    MethodNotFound,
+				Message: "Pinned server " + name + " does not support " + capability,
+			},
+		}
+	}
+
+	return srv, nil
+}
+
+// mayHandle reports whether srv can handle a request needing capability.
+// Servers that have not reported capabilities are trusted to handle it.
+func mayHandle(srv *server.ManagedServer, capability string) bool {
+	if capability == "" {
+		return true
+	}
+	capabilities := srv.Capabilities()
+	return len(capabilities) == 0 || slices.Contains(capabilities, capability)
+}
+
+// stripRoutingHints returns a copy of req without the gateway's routing hints,
+// so upstream servers never see _meta.server, _meta.tag or _server
+func stripRoutingHints(req *Request) *Request {
+	if len(req.Params) == 0 {
+		return req
+	}
+
+	var params map[string]interface{}
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return req
+	}
+
+	_, hasLegacy := params["_server"]
+	meta, _ := params["_meta"].(map[string]interface{})
+	_, hasServer := meta["server"]
+	_, hasTag := meta["tag"]
+	hasMeta := hasServer || hasTag
+	if !hasLegacy && !hasMeta {
+		return req
+	}
+
+	delete(params, "_server")
+	if hasMeta {
+		delete(meta, "server")
+		delete(meta, "tag")
+		if len(meta) == 0 {
+			delete(params, "_meta")
+		}
+	}
+
+	data, err := json.Marshal(params)
+	if err != nil {
+		return req
+	}
+
+	stripped := *req
+	stripped.Params = data
+	return &stripped
+}
@@ -0,0 +1,190 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/j4ng5y/mcpgate/config"
+	"github.com/j4ng5y/mcpgate/server"
+)
+
+// clientKey is the context key for the client a request authenticated as
+type clientKey struct{}
+
+// WithClient returns a context whose requests are held to client's policy.
+// Server modes use it for the client a request authenticated as; requests
+// without one may use every server and tool.
+func WithClient(ctx context.Context, client *config.ClientConfig) context.Context {
+	if client == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, clientKey{}, client)
+}
+
+// networkKey is the context key marking requests from a network server mode
+type networkKey struct{}
+
+// WithNetwork returns a context marking its requests as received by a
+// network server mode rather than over stdio
+func WithNetwork(ctx context.Context) context.Context {
+	return context.WithValue(ctx, networkKey{}, true)
+}
+
+// fromNetwork reports whether ctx carries a request from a network server mode
+func fromNetwork(ctx context.Context) bool {
+	network, _ := ctx.Value(networkKey{}).(bool)
+	return network
+}
+
+// ClientFromContext returns the client stored in ctx, or nil
+func ClientFromContext(ctx context.Context) *config.ClientConfig {
+	client, _ := ctx.Value(clientKey{}).(*config.ClientConfig)
+	return client
+}
+
+// permitsServer reports whether the request's client may use srv, named
+// directly or by its replica group
+func permitsServer(ctx context.Context, srv *server.ManagedServer) bool {
+	client := ClientFromContext(ctx)
+	if client == nil {
+		return true
+	}
+	return client.AllowsServer(srv.Name) || (srv.Config.Group != "" && client.AllowsServer(srv.Config.Group))
+}
+
+// permitsServerName is permitsServer for a server looked up by name
+func (r *Router) permitsServerName(ctx context.Context, name string) bool {
+	client := ClientFromContext(ctx)
+	if client == nil {
+		return true
+	}
+	if srv, err := r.manager.GetServer(name); err == nil {
+		return permitsServer(ctx, srv)
+	}
+	return client.AllowsServer(name)
+}
+
+// permitsTool reports whether the request's client may list and call a tool
+func permitsTool(ctx context.Context, name string) bool {
+	client := ClientFromContext(ctx)
+	return client == nil || client.AllowsTool(name)
+}
+
+// permittedServers filters servers down to those the request's client may use
+func permittedServers(ctx context.Context, servers []*server.ManagedServer) []*server.ManagedServer {
+	if ClientFromContext(ctx) == nil {
+		return servers
+	}
+	permitted := make([]*server.ManagedServer, 0, len(servers))
+	for _, srv := range servers {
+		if permitsServer(ctx, srv) {
+			permitted = append(permitted, srv)
+		}
+	}
+	return permitted
+}
+
+// forbidden refuses a request the client's policy does not permit
+func forbidden(ctx context.Context, req *Request, message string) *Response {
+	return &Response{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Error: &JSONRPCError{
+			Code:    Forbidden,
+			Message: "Client " + ClientFromContext(ctx).Name + " may not " + message,
+		},
+	}
+}
+
+// checkPolicy refuses gateway methods and tool calls the request's client
+// may not use. Requests routed upstream are confined to the client's servers
+// as they are routed.
+func (r *Router) checkPolicy(ctx context.Context, req *Request) *Response {
+	client := ClientFromContext(ctx)
+	if client == nil {
+		return nil
+	}
+
+	var params struct {
+		Name      string `json:"name"`
+		Arguments struct {
+			Name string `json:"name"`
+		} `json:"arguments"`
+	}
+	if len(req.Params) > 0 {
+		// Malformed params are left for the method to refuse
+		_ = json.Unmarshal(req.Params, &params)
+	}
+
+	switch req.Method {
+	case "gateway/add_server", "gateway/remove_server":
+		// Adding a server runs a command on the gateway's host, so only
+		// clients explicitly made admins may
+		if !client.Admin {
+			return forbidden(ctx, req, "add or remove servers")
+		}
+	case "gateway/reconnect_server":
+		// Every client shares the upstream, so only admins may bounce it
+		if !client.Admin {
+			return forbidden(ctx, req, "reconnect servers")
+		}
+	case "gateway/get_server", "gateway/server_status", "gateway/capabilities":
+		if params.Name != "" && !r.permitsServerName(ctx, params.Name) {
+			return forbidden(ctx, req, "use server "+params.Name)
+		}
+	case MethodToolsCall:
+		if !permitsTool(ctx, params.Name) {
+			return forbidden(ctx, req, "call tool "+params.Name)
+		}
+		if !r.managementEnabled || !strings.HasPrefix(params.Name, ManagementToolPrefix) {
+			break
+		}
+		if sharedServerTools[strings.TrimPrefix(params.Name, ManagementToolPrefix)] && !client.Admin {
+			return forbidden(ctx, req, "reconnect, enable or disable servers")
+		}
+		if params.Arguments.Name != "" && !r.permitsServerName(ctx, params.Arguments.Name) {
+			return forbidden(ctx, req, "use server "+params.Arguments.Name)
+		}
+	}
+	return nil
+}
+
+// sharedServerTools are the management tools acting on an upstream every
+// client shares, which only admins may call
+var sharedServerTools = map[string]bool{
+	"reconnect_server": true,
+	"enable_server":    true,
+	"disable_server":   true,
+}
+
+// permittedTools removes the tools the request's client may not use from a
+// tools/list response
+func permittedTools(ctx context.Context, resp *Response) *Response {
+	client := ClientFromContext(ctx)
+	if client == nil || len(client.Tools) == 0 || resp.Error != nil || resp.Result == nil {
+		return resp
+	}
+
+	result := make(map[string]interface{})
+	data, err := json.Marshal(resp.Result)
+	if err != nil || json.Unmarshal(data, &result) != nil {
+		return resp
+	}
+
+	tools, _ := result["tools"].([]interface{})
+	permitted := make([]interface{}, 0, len(tools))
+	for _, tool := range tools {
+		entry, _ := tool.(map[string]interface{})
+		if name, _ := entry["name"].(string); permitsTool(ctx, name) {
+			permitted = append(permitted, tool)
+		}
+	}
+	result["tools"] = permitted
+
+	return &Response{
+		JSONRPC: resp.JSONRPC,
+		ID:      resp.ID,
+		Result:  result,
+	}
+}
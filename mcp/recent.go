@@ -0,0 +1,81 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// recentRequestLimit is how many forwarded requests the router remembers
+const recentRequestLimit = 100
+
+// RequestRecord describes a request the gateway forwarded upstream
+type RequestRecord struct {
+	Time      time.Time `json:"time"`
+	Method    string    `json:"method"`
+	Tool      string    `json:"tool,omitempty"` // For tools/call
+	Server    string    `json:"server"`
+	Client    string    `json:"client,omitempty"` // Configured client it came from
+	LatencyMS float64   `json:"latency_ms"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// recentRequests is a ring buffer of the last forwarded requests
+type recentRequests struct {
+	mutex   sync.Mutex
+	records []RequestRecord
+	next    int // Where the next record goes once the buffer is full
+}
+
+// add remembers a record, replacing the oldest once the buffer is full
+func (t *recentRequests) add(record RequestRecord) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if len(t.records) < recentRequestLimit {
+		t.records = append(t.records, record)
+		return
+	}
+	t.records[t.next] = record
+	t.next = (t.next + 1) % recentRequestLimit
+}
+
+// RecentRequests returns the last requests forwarded upstream, newest first
+func (r *Router) RecentRequests() []RequestRecord {
+	r.recent.mutex.Lock()
+	defer r.recent.mutex.Unlock()
+
+	records := make([]RequestRecord, 0, len(r.recent.records))
+	for i := range r.recent.records {
+		// Walk back from the newest record
+		index := (r.recent.next - 1 - i + 2*len(r.recent.records)) % len(r.recent.records)
+		records = append(records, r.recent.records[index])
+	}
+	return records
+}
+
+// recordRequest remembers a request forwarded to serverName and its outcome
+func (r *Router) recordRequest(ctx context.Context, req *Request, serverName string, latency time.Duration, resp *Response) {
+	record := RequestRecord{
+		Time:      time.Now(),
+		Method:    req.Method,
+		Server:    serverName,
+		LatencyMS: float64(latency.Microseconds()) / 1000,
+	}
+	if req.Method == MethodToolsCall {
+		var params struct {
+			Name string `json:"name"`
+		}
+		if json.Unmarshal(req.Params, &params) == nil {
+			record.Tool = params.Name
+		}
+	}
+	if client := ClientFromContext(ctx); client != nil {
+		record.Client = client.Name
+	}
+	if resp != nil && resp.Error != nil {
+		record.Error = resp.Error.Message
+	}
+	r.recent.add(record)
+}
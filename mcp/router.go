@@ -3,30 +3,69 @@ package mcp
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"log/slog"
 	"strings"
+	"time"
 
+	"github.com/j4ng5y/mcpgate/audit"
+	"github.com/j4ng5y/mcpgate/logging"
 	"github.com/j4ng5y/mcpgate/server"
 )
 
 // Router handles request routing to appropriate upstream servers
 type Router struct {
-	manager *server.Manager
+	manager       *server.Manager
+	catalog       catalogTracker
+	subscriptions subscriptionTracker
+	inflight      inflightTracker
+	recent        recentRequests
+	audit         *audit.Log
+
+	managementEnabled bool
+	runtimeChanges    bool
 }
 
 // NewRouter creates a new request router
 func NewRouter(mgr *server.Manager) *Router {
-	return &Router{
+	r := &Router{
 		manager: mgr,
 	}
+	r.catalog.snapshot = r.catalogFingerprint()
+	r.subscriptions.byClient = make(map[subscriptionKey]subscription)
+	mgr.OnChange(r.SyncCapabilities)
+	mgr.OnNotification(r.handleUpstreamNotification)
+	return r
 }
 
-// Route handles a JSON-RPC request and returns a response
-func (r *Router) Route(ctx context.Context, req *Request) *Response {
+// Route handles a JSON-RPC request and returns a response. Client
+// notifications are forwarded upstream and get no response, so Route
+// returns nil for them.
+func (r *Router) Route(ctx context.Context, req *Request) (resp *Response) {
+	ctx = logging.With(ctx, slog.String(logging.KeyMethod, req.Method))
+	if isNotification(req) {
+		r.routeNotification(ctx, req)
+		return nil
+	}
+	ctx = logging.With(ctx, slog.Any(logging.KeyRequestID, req.ID))
+
+	ctx, finish := r.beginRoute(ctx, req)
+	defer func() {
+		finish(resp)
+	}()
+
+	if req.Method == MethodToolsCall {
+		var audited func(*Response)
+		ctx, audited = r.beginAudit(ctx, req.ID, req.Params)
+		defer func() {
+			audited(resp)
+		}()
+	}
+
 	// Validate request
 	if req.JSONRPC != "2.0" {
 		return &Response{
 			JSONRPC: "2.0",
+			ID:      req.ID,
 			Error: &JSONRPCError{
 				Code:    InvalidRequest,
 				Message: "Invalid JSON-RPC version",
@@ -34,6 +73,10 @@ func (r *Router) Route(ctx context.Context, req *Request) *Response {
 		}
 	}
 
+	if errResp := r.checkPolicy(ctx, req); errResp != nil {
+		return errResp
+	}
+
 	// Handle gateway-level methods
 	switch req.Method {
 	case "gateway/list_servers":
@@ -44,25 +87,115 @@ func (r *Router) Route(ctx context.Context, req *Request) *Response {
 		return r.handleServerStatus(ctx, req)
 	case "gateway/capabilities":
 		return r.handleCapabilities(ctx, req)
+	case "gateway/stats":
+		return r.handleStats(ctx, req)
+	case "gateway/call_batch":
+		return r.handleCallBatch(ctx, req)
+	case "gateway/add_server":
+		return r.handleAddServer(ctx, req)
+	case "gateway/remove_server":
+		return r.handleRemoveServer(ctx, req)
+	case "gateway/reconnect_server":
+		return r.handleReconnectServer(ctx, req)
+	case MethodResourcesSubscribe:
+		return r.handleResourcesSubscribe(ctx, req)
+	case MethodResourcesUnsubscribe:
+		return r.handleResourcesUnsubscribe(ctx, req)
+	case MethodInitialize:
+		r.markClientInitialized()
+	case MethodToolsList:
+		if r.managementEnabled && pinnedServerName(ctx, req) == "" && routingTag(req) == "" {
+			return permittedTools(ctx, r.withManagementTools(req, r.routeToServer(ctx, req)))
+		}
+		return permittedTools(ctx, r.routeToServer(ctx, req))
+	case MethodToolsCall:
+		if r.managementEnabled {
+			if resp, ok := r.handleManagementToolCall(ctx, req); ok {
+				return resp
+			}
+		}
 	}
 
 	// Route to upstream server based on method or explicit server specification
 	return r.routeToServer(ctx, req)
 }
 
-// handleListServers returns a list of all registered servers
+// beginRoute starts the span of a request being routed and records it in
+// flight, so a cancellation reaches it and the upstreams handling it. The
+// returned function ends both once the request is answered.
+func (r *Router) beginRoute(ctx context.Context, req *Request) (context.Context, func(*Response)) {
+	ctx, span := startRouteSpan(ctx, req)
+	ctx, done := r.inflight.begin(ctx, req.ID)
+	return ctx, func(resp *Response) {
+		done()
+		endRouteSpan(span, resp)
+	}
+}
+
+// handleListServers returns a list of all registered servers, or of those
+// carrying the tag given in params
 func (r *Router) handleListServers(ctx context.Context, req *Request) *Response {
-	servers := r.manager.ListServers()
+	var params struct {
+		Tag string `json:"tag"`
+	}
+
+	if req.Params != nil {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return &Response{
+				JSONRPC: "2.0",
+				ID:      req.ID,
+				Error: &JSONRPCError{
+					Code:    InvalidParams,
+					Message: "Invalid parameters",
+				},
+			}
+		}
+	}
+
+	servers := permittedServers(ctx, r.manager.ListServers())
 	result := make([]map[string]interface{}, 0, len(servers))
 
 	for _, srv := range servers {
-		result = append(result, map[string]interface{}{
-			"name":         srv.Name,
-			"connected":    srv.IsConnected(),
-			"initialized":  srv.IsInitialized(),
-			"transport":    srv.Config.Transport,
-			"capabilities": srv.Capabilities,
-		})
+		if params.Tag != "" && !srv.HasTag(params.Tag) {
+			continue
+		}
+		history := srv.History()
+		entry := map[string]interface{}{
+			"name":                 srv.Name,
+			"connected":            srv.IsConnected(),
+			"initialized":          srv.IsInitialized(),
+			"transport":            srv.Config.Transport,
+			"capabilities":         srv.Capabilities(),
+			"state":                srv.State(),
+			"quarantined":          srv.IsQuarantined(),
+			"consecutive_failures": srv.ConsecutiveFailures(),
+			"disabled":             srv.IsDisabled(),
+			"health":               srv.Health().Status,
+			"tags":                 srv.Config.Tags,
+			"priority":             srv.Config.Priority,
+			"uptime_seconds":       int64(srv.Uptime().Seconds()),
+			"total_restarts":       history.TotalRestarts,
+		}
+		if !history.LastSuccessAt.IsZero() {
+			entry["last_success"] = history.LastSuccessAt
+		}
+		if srv.Config.Schedule != "" {
+			entry["schedule"] = srv.Config.Schedule
+		}
+		if srv.Config.MaxConcurrent > 0 {
+			entry["queued"] = srv.QueueLength()
+		}
+		if srv.Config.Standby > 0 {
+			entry["standby"] = srv.StandbyReady()
+		}
+		if srv.Config.Group != "" {
+			entry["group"] = srv.Config.Group
+			entry["in_flight"] = srv.InFlight()
+		}
+		if srv.IsQuarantined() {
+			entry["retry_at"] = srv.QuarantineRetryAt()
+		}
+		result = append(result, entry)
 	}
 
 	return &Response{
@@ -111,8 +244,9 @@ func (r *Router) handleGetServer(ctx context.Context, req *Request) *Response {
 			"connected":    srv.IsConnected(),
 			"initialized":  srv.IsInitialized(),
 			"transport":    srv.Config.Transport,
-			"capabilities": srv.Capabilities,
+			"capabilities": srv.Capabilities(),
 			"metadata":     srv.Metadata,
+			"server_info":  srv.ServerInfo(),
 		},
 	}
 }
@@ -148,17 +282,87 @@ func (r *Router) handleServerStatus(ctx context.Context, req *Request) *Response
 		}
 	}
 
+	result := map[string]interface{}{
+		"connected":   srv.IsConnected(),
+		"initialized": srv.IsInitialized(),
+		"last_used":   srv.GetLastUsed(),
+		"stderr":      srv.StderrTail(),
+		"health":      healthResult(srv.Health()),
+		"restarts":    srv.Restarts(),
+	}
+	for key, value := range historyResult(srv.History()) {
+		result[key] = value
+	}
+	result["requests"] = requestMetricsResult(srv.RequestMetrics())
+	if metrics, ok := srv.TransportMetrics(); ok {
+		result["metrics"] = map[string]interface{}{
+			"bytes_sent":      metrics.BytesSent,
+			"bytes_received":  metrics.BytesReceived,
+			"requests":        metrics.Requests,
+			"errors":          metrics.Errors,
+			"dropped":         metrics.Dropped,
+			"last_latency_ms": float64(metrics.LastLatency.Microseconds()) / 1000,
+		}
+	}
+
 	return &Response{
 		JSONRPC: "2.0",
 		ID:      req.ID,
-		Result: map[string]interface{}{
-			"connected":   srv.IsConnected(),
-			"initialized": srv.IsInitialized(),
-			"last_used":   srv.GetLastUsed(),
-		},
+		Result:  result,
 	}
 }
 
+// historyResult describes a server's last error and connection activity for
+// gateway/server_status
+func historyResult(history server.ConnectionHistory) map[string]interface{} {
+	events := make([]map[string]interface{}, 0, len(history.Events))
+	for _, event := range history.Events {
+		entry := map[string]interface{}{
+			"time":  event.Time,
+			"event": event.Event,
+		}
+		if event.Error != "" {
+			entry["error"] = event.Error
+		}
+		events = append(events, entry)
+	}
+
+	result := map[string]interface{}{
+		"total_restarts": history.TotalRestarts,
+		"history":        events,
+	}
+	if history.LastError != "" {
+		result["last_error"] = history.LastError
+		result["last_error_at"] = history.LastErrorAt
+	}
+	if !history.ConnectedAt.IsZero() {
+		result["connected_at"] = history.ConnectedAt
+	}
+	if !history.DisconnectedAt.IsZero() {
+		result["disconnected_at"] = history.DisconnectedAt
+	}
+	if !history.LastSuccessAt.IsZero() {
+		result["last_success"] = history.LastSuccessAt
+	}
+	return result
+}
+
+// healthResult describes a server's health for gateway/server_status
+func healthResult(health server.HealthStatus) map[string]interface{} {
+	result := map[string]interface{}{
+		"status":               health.Status,
+		"consecutive_failures": health.ConsecutiveFailures,
+	}
+	if !health.LastCheck.IsZero() {
+		result["last_check"] = health.LastCheck
+		result["last_latency_ms"] = float64(health.LastLatency.Microseconds()) / 1000
+	}
+	if health.LastError != "" {
+		result["error"] = health.LastError
+	}
+	return result
+}
+
 // handleCapabilities returns capabilities of a server or all servers
 func (r *Router) handleCapabilities(ctx context.Context, req *Request) *Response {
 	var params struct {
@@ -196,15 +400,15 @@ func (r *Router) handleCapabilities(ctx context.Context, req *Request) *Response
 			ID:      req.ID,
 			Result: map[string]interface{}{
 				"name":         srv.Name,
-				"capabilities": srv.Capabilities,
+				"capabilities": srv.Capabilities(),
 			},
 		}
 	}
 
 	// Return capabilities from all servers
 	result := make(map[string][]string)
-	for _, srv := range r.manager.ListServers() {
-		result[srv.Name] = srv.Capabilities
+	for _, srv := range permittedServers(ctx, r.manager.ListServers()) {
+		result[srv.Name] = srv.Capabilities()
 	}
 
 	return &Response{
@@ -216,13 +420,28 @@ func (r *Router) handleCapabilities(ctx context.Context, req *Request) *Response
 
 // routeToServer routes a request to the appropriate upstream server
 func (r *Router) routeToServer(ctx context.Context, req *Request) *Response {
-	// Try to determine target server
-	// First check for explicit server specification in params
-	targetServer := r.findTargetServer(ctx, req)
+	// A pinned server takes precedence over capability routing
+	targetServer, errResp := r.pinnedServer(ctx, req)
+	if errResp != nil {
+		return errResp
+	}
+	// Tool calls pinned to a single replica stay on it; others are balanced
+	balance := targetServer == nil || targetServer.Name != pinnedServerName(ctx, req)
+	if targetServer == nil {
+		targetServer, errResp = r.taggedServer(ctx, req)
+		if errResp != nil {
+			return errResp
+		}
+	}
+	req = stripRoutingHints(req)
+
+	if targetServer == nil {
+		targetServer = r.findTargetServer(ctx, req)
+	}
 	if targetServer == nil {
 		// If no target, try routing based on method
 		// For now, try all servers with the capability
-		servers := r.manager.ListServers()
+		servers := permittedServers(ctx, r.manager.ListActiveServers())
 		if len(servers) == 0 {
 			return &Response{
 				JSONRPC: "2.0",
@@ -236,26 +455,92 @@ func (r *Router) routeToServer(ctx context.Context, req *Request) *Response {
 		// Use first available server
 		targetServer = servers[0]
 	}
+	if req.Method == MethodToolsCall && balance {
+		// A client allowed only some replicas of a group stays on them
+		if replica := r.manager.PickReplica(targetServer); permitsServer(ctx, replica) {
+			targetServer = replica
+		}
+	}
 
-	// Send request to target server
-	log.Printf("Routing request %v to server %s", req.ID, targetServer.Name)
+	if req.Method == MethodToolsList && len(targetServer.StaticTools()) > 0 {
+		return r.staticToolsList(ctx, targetServer, req)
+	}
+	if resp := cachedListResponse(targetServer, req); resp != nil {
+		return resp
+	}
 
-	// Convert request to map for sending
-	reqMap := map[string]interface{}{
-		"jsonrpc": req.JSONRPC,
-		"method":  req.Method,
+	return r.forward(ctx, targetServer, req)
+}
+
+// cachedListFields maps the list methods answered from a server's catalog
+// cache to the result field holding their items
+var cachedListFields = map[string]string{
+	MethodToolsList:     "tools",
+	MethodResourcesList: "resources",
+	MethodPromptsList:   "prompts",
+}
+
+// cachedListResponse answers a list request from the server's catalog cache,
+// or returns nil when the list is not cached or a later page is requested
+func cachedListResponse(targetServer *server.ManagedServer, req *Request) *Response {
+	field, ok := cachedListFields[req.Method]
+	if !ok {
+		return nil
 	}
-	if req.ID != nil {
-		reqMap["id"] = req.ID
+
+	var params struct {
+		Cursor string `json:"cursor"`
 	}
 	if len(req.Params) > 0 {
-		var params interface{}
-		if err := json.Unmarshal(req.Params, &params); err == nil {
-			reqMap["params"] = params
+		if err := json.Unmarshal(req.Params, &params); err != nil || params.Cursor != "" {
+			return nil
+		}
+	}
+
+	items, ok := targetServer.CachedList(req.Method)
+	if !ok {
+		return nil
+	}
+	return &Response{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Result: map[string]interface{}{
+			field: items,
+		},
+	}
+}
+
+// staticToolsList answers tools/list from config, either in place of the
+// upstream (override) or when the upstream cannot list its tools (fallback)
+func (r *Router) staticToolsList(ctx context.Context, targetServer *server.ManagedServer, req *Request) *Response {
+	if !targetServer.OverridesDiscovery() {
+		resp := r.forward(ctx, targetServer, req)
+		if resp.Error == nil && resp.Result != nil {
+			return resp
 		}
+		slog.InfoContext(ctx, "Using static tool list", logging.Server(targetServer.Name))
 	}
 
-	respData, err := targetServer.SendRequest(ctx, reqMap)
+	return &Response{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Result: map[string]interface{}{
+			"tools": targetServer.StaticTools(),
+		},
+	}
+}
+
+// forward sends a request to a specific upstream server and parses its response
+func (r *Router) forward(ctx context.Context, targetServer *server.ManagedServer, req *Request) (resp *Response) {
+	// Send request to target server
+	slog.DebugContext(ctx, "Routing request", logging.Server(targetServer.Name))
+	defer func(start time.Time) {
+		r.recordRequest(ctx, req, targetServer.Name, time.Since(start), resp)
+	}(time.Now())
+
+	recordUpstream(ctx, req, targetServer)
+	auditForwarded(ctx, targetServer.Name)
+	respData, err := targetServer.SendRequest(ctx, upstreamMessage(req))
 	if err != nil {
 		return &Response{
 			JSONRPC: "2.0",
@@ -267,6 +552,10 @@ func (r *Router) routeToServer(ctx context.Context, req *Request) *Response {
 		}
 	}
 
+	if passthroughMethods[req.Method] {
+		return streamedResponse(ctx, passthroughResponse(req, respData))
+	}
+
 	// Parse the response
 	var response Response
 	if err := json.Unmarshal(respData, &response); err != nil {
@@ -280,29 +569,68 @@ func (r *Router) routeToServer(ctx context.Context, req *Request) *Response {
 		}
 	}
 
+	// The gateway owns the id: errors generated by the managed server carry
+	// none, and the downstream client must always get its own id back
+	response.JSONRPC = "2.0"
+	response.ID = req.ID
+
 	return &response
 }
 
-// findTargetServer determines which server should handle the request
-func (r *Router) findTargetServer(ctx context.Context, req *Request) *server.ManagedServer {
-	// Check for explicit server in params
-	if req.Params != nil {
-		var params map[string]interface{}
+// upstreamMessage converts a request or notification to the message sent upstream
+func upstreamMessage(req *Request) map[string]interface{} {
+	msg := map[string]interface{}{
+		"jsonrpc": req.JSONRPC,
+		"method":  req.Method,
+	}
+	if req.ID != nil {
+		msg["id"] = req.ID
+	}
+	if len(req.Params) > 0 {
+		var params interface{}
 		if err := json.Unmarshal(req.Params, &params); err == nil {
-			if serverName, ok := params["_server"].(string); ok {
-				srv, err := r.manager.GetServer(serverName)
-				if err == nil {
-					return srv
-				}
-			}
+			msg["params"] = params
 		}
 	}
+	return msg
+}
 
+// passthroughResponse builds a response whose result is the upstream's raw
+// bytes, for results the gateway only relays
+func passthroughResponse(req *Request, respData json.RawMessage) *Response {
+	var raw rawResponse
+	if err := json.Unmarshal(respData, &raw); err != nil {
+		return &Response{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error: &JSONRPCError{
+				Code:    ParseError,
+				Message: "Failed to parse upstream response",
+			},
+		}
+	}
+
+	response := &Response{JSONRPC: "2.0", ID: req.ID, Error: raw.Error}
+	if len(raw.Result) > 0 && string(raw.Result) != "null" {
+		response.Result = raw.Result
+	}
+	return response
+}
+
+// findTargetServer determines which server should handle the request
+func (r *Router) findTargetServer(ctx context.Context, req *Request) *server.ManagedServer {
 	// Try to route based on method name
 	// e.g., "tools/list" -> find server with tools capability
 	capability := r.extractCapability(req.Method)
 	if capability != "" {
-		servers := r.manager.ListServersByCapability(capability)
+		// Servers come best first, so a tool call goes to the most preferred
+		// server known to offer the tool
+		servers := permittedServers(ctx, r.manager.ListServersByCapability(capability))
+		if req.Method == MethodToolsCall {
+			if srv := serverWithTool(servers, req); srv != nil {
+				return srv
+			}
+		}
 		if len(servers) > 0 {
 			return servers[0]
 		}
@@ -311,6 +639,23 @@ func (r *Router) findTargetServer(ctx context.Context, req *Request) *server.Man
 	return nil
 }
 
+// serverWithTool returns the first server known to offer the tool a
+// tools/call request names, or nil when none is
+func serverWithTool(servers []*server.ManagedServer, req *Request) *server.ManagedServer {
+	var params struct {
+		Name string `json:"name"`
+	}
+	if len(req.Params) == 0 || json.Unmarshal(req.Params, &params) != nil || params.Name == "" {
+		return nil
+	}
+	for _, srv := range servers {
+		if srv.HasTool(params.Name) {
+			return srv
+		}
+	}
+	return nil
+}
+
 // extractCapability extracts capability from method name
 func (r *Router) extractCapability(method string) string {
 	// Map methods to capabilities
@@ -1,11 +1,21 @@
 package mcp
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/j4ng5y/mcpgate/audit"
 	"github.com/j4ng5y/mcpgate/config"
+	"github.com/j4ng5y/mcpgate/internal/mcptest"
 	"github.com/j4ng5y/mcpgate/server"
 )
 
@@ -58,7 +68,8 @@ func TestRouter_Route_ListServers(t *testing.T) {
 				Name:      "server1",
 				Transport: "stdio",
 				Enabled:   true,
-				Command:   "cat",
+				Command:   mcptest.EchoCommand,
+				Args:      mcptest.EchoArgs(),
 			},
 		},
 	}
@@ -104,7 +115,8 @@ func TestRouter_Route_GetServer(t *testing.T) {
 				Name:      "test-server",
 				Transport: "stdio",
 				Enabled:   true,
-				Command:   "cat",
+				Command:   mcptest.EchoCommand,
+				Args:      mcptest.EchoArgs(),
 			},
 		},
 	}
@@ -136,6 +148,14 @@ func TestRouter_Route_GetServer(t *testing.T) {
 		t.Fatal("Expected result in response")
 	}
 
+	result, ok := resp.Result.(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected result map, got %T", resp.Result)
+	}
+	if _, ok := result["server_info"].(server.ServerInfo); !ok {
+		t.Errorf("Expected server_info in result, got %v", result["server_info"])
+	}
+
 	manager.Stop()
 }
 
@@ -207,7 +227,8 @@ func TestRouter_Route_ServerStatus(t *testing.T) {
 				Name:      "test-server",
 				Transport: "stdio",
 				Enabled:   true,
-				Command:   "cat",
+				Command:   mcptest.EchoCommand,
+				Args:      mcptest.EchoArgs(),
 			},
 		},
 	}
@@ -235,6 +256,33 @@ func TestRouter_Route_ServerStatus(t *testing.T) {
 		t.Fatalf("Unexpected error: %v", resp.Error)
 	}
 
+	// The initialize handshake is counted
+	result, _ := resp.Result.(map[string]interface{})
+	metrics, ok := result["metrics"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected metrics in server status, got %v", result)
+	}
+	if metrics["requests"].(int64) < 1 || metrics["bytes_sent"].(int64) == 0 || metrics["bytes_received"].(int64) == 0 {
+		t.Errorf("Expected traffic from initialize, got %v", metrics)
+	}
+
+	srv, _ := manager.GetServer("test-server")
+	srv.CheckHealth(ctx)
+	resp = router.Route(ctx, req)
+	result, _ = resp.Result.(map[string]interface{})
+	health, _ := result["health"].(map[string]interface{})
+	if health["status"] != server.HealthHealthy || health["last_check"] == nil {
+		t.Errorf("Expected a healthy check in server status, got %v", health)
+	}
+
+	history, _ := result["history"].([]map[string]interface{})
+	if result["connected_at"] == nil || len(history) != 1 || history[0]["event"] != server.EventConnected {
+		t.Errorf("Expected the connection in server status, got %v", result)
+	}
+	if _, ok := result["last_error"]; ok {
+		t.Errorf("Expected no last error, got %v", result["last_error"])
+	}
+
 	manager.Stop()
 }
 
@@ -245,7 +293,8 @@ func TestRouter_Route_Capabilities_All(t *testing.T) {
 				Name:      "server1",
 				Transport: "stdio",
 				Enabled:   true,
-				Command:   "cat",
+				Command:   mcptest.EchoCommand,
+				Args:      mcptest.EchoArgs(),
 			},
 		},
 	}
@@ -281,7 +330,8 @@ func TestRouter_Route_Capabilities_Specific(t *testing.T) {
 				Name:      "test-server",
 				Transport: "stdio",
 				Enabled:   true,
-				Command:   "cat",
+				Command:   mcptest.EchoCommand,
+				Args:      mcptest.EchoArgs(),
 			},
 		},
 	}
@@ -316,8 +366,8 @@ func TestRouter_ExtractCapability(t *testing.T) {
 	router := &Router{}
 
 	tests := []struct {
-		method       string
-		expectedCap  string
+		method      string
+		expectedCap string
 	}{
 		{"tools/list", "tools"},
 		{"tools/call", "tools"},
@@ -393,3 +443,1551 @@ func TestRouter_RequestID(t *testing.T) {
 
 	manager.Stop()
 }
+
+func TestRouter_SyncCapabilities_NotifiesChanges(t *testing.T) {
+	cfg := &config.Config{
+		Servers: []config.ServerConfig{
+			{
+				Name:      "test-server",
+				Transport: "stdio",
+				Enabled:   true,
+				Command:   mcptest.EchoCommand,
+				Args:      mcptest.EchoArgs(),
+			},
+		},
+	}
+	manager := server.NewManager(cfg)
+	if err := manager.Start(); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+	defer manager.Stop()
+
+	router := NewRouter(manager)
+
+	var notifications []*Notification
+	router.SetNotifier(func(n *Notification) {
+		notifications = append(notifications, n)
+	})
+
+	srv, err := manager.GetServer("test-server")
+	if err != nil {
+		t.Fatalf("Failed to get server: %v", err)
+	}
+
+	// No notifications before the client has initialized
+	srv.SetCapabilities([]string{"tools"})
+	router.SyncCapabilities()
+	if len(notifications) != 0 {
+		t.Fatalf("Expected no notifications before initialize, got %d", len(notifications))
+	}
+
+	router.markClientInitialized()
+
+	srv.SetCapabilities([]string{"tools", "prompts"})
+	router.SyncCapabilities()
+	if len(notifications) != 1 {
+		t.Fatalf("Expected 1 notification, got %d", len(notifications))
+	}
+	if notifications[0].Method != MethodPromptsUpdated {
+		t.Errorf("Expected %s, got %s", MethodPromptsUpdated, notifications[0].Method)
+	}
+
+	// Unchanged catalog produces no further notifications
+	router.SyncCapabilities()
+	if len(notifications) != 1 {
+		t.Errorf("Expected no new notifications, got %d total", len(notifications))
+	}
+}
+
+func TestRouter_AddNotifier_FansOut(t *testing.T) {
+	router := NewRouter(server.NewManager(&config.Config{}))
+
+	var stdio, network, replaced int
+	router.SetNotifier(func(n *Notification) { stdio++ })
+	router.AddNotifier(func(n *Notification) { network++ })
+	router.sendNotification(&Notification{JSONRPC: "2.0", Method: MethodToolsUpdated})
+	if stdio != 1 || network != 1 {
+		t.Errorf("Expected every notifier to be called once, got %d and %d", stdio, network)
+	}
+
+	// SetNotifier replaces the notifiers added before
+	router.SetNotifier(func(n *Notification) { replaced++ })
+	router.sendNotification(&Notification{JSONRPC: "2.0", Method: MethodToolsUpdated})
+	if stdio != 1 || network != 1 || replaced != 1 {
+		t.Errorf("Expected only the new notifier to be called, got %d, %d and %d", stdio, network, replaced)
+	}
+}
+
+func TestRouter_ResourcesSubscribe_PerSession(t *testing.T) {
+	manager := server.NewManager(&config.Config{
+		Servers: []config.ServerConfig{
+			{Name: "files", Transport: "stdio", Enabled: true, Command: mcptest.EchoCommand, Args: mcptest.EchoArgs()},
+		},
+	})
+	if err := manager.Start(); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+	defer manager.Stop()
+	router := NewRouter(manager)
+
+	params, _ := json.Marshal(map[string]interface{}{"uri": QualifyURI("files", "file:///tmp/a.txt")})
+	route := func(session, method string) {
+		t.Helper()
+		ctx := WithSession(context.Background(), session)
+		if resp := router.Route(ctx, &Request{JSONRPC: "2.0", ID: 1, Method: method, Params: params}); resp.Error != nil {
+			t.Fatalf("%s for session %s failed: %v", method, session, resp.Error.Message)
+		}
+	}
+	unsubscribesSent := func() int {
+		n := 0
+		for _, record := range router.RecentRequests() {
+			if record.Method == MethodResourcesUnsubscribe {
+				n++
+			}
+		}
+		return n
+	}
+	update := json.RawMessage(`{"jsonrpc":"2.0","method":"notifications/resources/updated","params":{"uri":"file:///tmp/a.txt"}}`)
+
+	route("a", MethodResourcesSubscribe)
+	route("b", MethodResourcesSubscribe)
+
+	var sessions []string
+	router.SetNotifier(func(n *Notification) {
+		sessions = append(sessions, n.session)
+	})
+	router.handleUpstreamNotification("files", update)
+	slices.Sort(sessions)
+	if !slices.Equal(sessions, []string{"a", "b"}) {
+		t.Fatalf("Expected an update for each subscribed session, got %v", sessions)
+	}
+
+	// b is still subscribed, so a's unsubscribe is not sent upstream, nor
+	// that of c, which never subscribed
+	route("a", MethodResourcesUnsubscribe)
+	route("c", MethodResourcesUnsubscribe)
+	if n := unsubscribesSent(); n != 0 {
+		t.Errorf("Expected the upstream subscription kept for b, got %d unsubscribes sent", n)
+	}
+	sessions = nil
+	router.handleUpstreamNotification("files", update)
+	if !slices.Equal(sessions, []string{"b"}) {
+		t.Errorf("Expected the update for b alone, got %v", sessions)
+	}
+
+	// The last subscriber going away unsubscribes upstream
+	router.EndSession("b")
+	deadline := time.Now().Add(2 * time.Second)
+	for unsubscribesSent() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := unsubscribesSent(); n != 1 {
+		t.Errorf("Expected ending b to unsubscribe upstream once, got %d", n)
+	}
+	sessions = nil
+	router.handleUpstreamNotification("files", update)
+	if len(sessions) != 0 {
+		t.Errorf("Expected no updates once every session left, got %v", sessions)
+	}
+}
+
+func TestRouter_SyncCapabilities_NotifiesItemChanges(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+
+	// Lists tool a, and tool b too once a tools/call has added it, announcing
+	// the change with list_changed
+	script := `added=
+while IFS= read -r line; do
+  id=${line#*'"id":'}; id=${id%%[,\}]*}
+  case $line in
+    *'"method":"initialize"'*) echo '{"jsonrpc":"2.0","id":'$id',"result":{"capabilities":{"tools":{}}}}' ;;
+    *'"method":"tools/list"'*)
+      tools='{"name":"a"}'; [ -n "$added" ] && tools='{"name":"a"},{"name":"b"}'
+      echo '{"jsonrpc":"2.0","id":'$id',"result":{"tools":['$tools']}}' ;;
+    *'"method":"tools/call"'*)
+      added=1
+      echo '{"jsonrpc":"2.0","id":'$id',"result":{}}'
+      echo '{"jsonrpc":"2.0","method":"notifications/tools/list_changed"}' ;;
+  esac
+done`
+	manager := server.NewManager(&config.Config{
+		Servers: []config.ServerConfig{
+			{Name: "tools", Transport: "stdio", Enabled: true, Command: "sh", Args: []string{"-c", script}},
+		},
+	})
+	if err := manager.Start(); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+	defer manager.Stop()
+	router := NewRouter(manager)
+	router.markClientInitialized()
+
+	notifications := make(chan *Notification, 10)
+	router.SetNotifier(func(n *Notification) {
+		notifications <- n
+	})
+
+	// The same tools again announce nothing
+	router.SyncCapabilities()
+	select {
+	case n := <-notifications:
+		t.Fatalf("Expected no notification for an unchanged catalog, got %s", n.Method)
+	default:
+	}
+
+	resp := router.Route(context.Background(), &Request{JSONRPC: "2.0", ID: 1, Method: MethodToolsCall, Params: json.RawMessage(`{"name":"a"}`)})
+	if resp.Error != nil {
+		t.Fatalf("Unexpected error: %v", resp.Error.Message)
+	}
+
+	select {
+	case n := <-notifications:
+		if n.Method != MethodToolsUpdated || !slices.Equal(n.servers, []string{"tools"}) {
+			t.Errorf("Expected %s for tools, got %s for %v", MethodToolsUpdated, n.Method, n.servers)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected a list_changed notification once the server's tools changed")
+	}
+}
+
+func TestRouter_Receives(t *testing.T) {
+	router := NewRouter(server.NewManager(&config.Config{
+		Servers: []config.ServerConfig{
+			{Name: "github", Transport: "stdio", Enabled: true, Command: mcptest.EchoCommand, Args: mcptest.EchoArgs(), Lazy: true},
+			{Name: "files", Transport: "stdio", Enabled: true, Command: mcptest.EchoCommand, Args: mcptest.EchoArgs(), Lazy: true},
+		},
+	}))
+	reviewer := WithClient(context.Background(), &config.ClientConfig{Name: "reviewer", Servers: []string{"github"}})
+	stdio := context.Background()
+
+	listChanged := &Notification{JSONRPC: "2.0", Method: MethodToolsUpdated, servers: []string{"files"}}
+	if router.Receives(reviewer, listChanged) {
+		t.Error("Expected a client to miss list_changed for a server it may not use")
+	}
+	if !router.Receives(stdio, listChanged) {
+		t.Error("Expected a session without a policy to receive every list_changed")
+	}
+	listChanged.servers = []string{"files", "github"}
+	if !router.Receives(reviewer, listChanged) {
+		t.Error("Expected a client to receive list_changed concerning a server it may use")
+	}
+
+	updated := &Notification{JSONRPC: "2.0", Method: MethodResourceUpdated, session: "a", addressed: true}
+	if !router.Receives(WithSession(reviewer, "a"), updated) {
+		t.Error("Expected the subscribed session to receive the update")
+	}
+	if router.Receives(WithSession(reviewer, "b"), updated) || router.Receives(stdio, updated) {
+		t.Error("Expected other sessions to miss the update")
+	}
+	updated.session = ""
+	if !router.Receives(stdio, updated) || router.Receives(WithSession(stdio, "a"), updated) {
+		t.Error("Expected an update subscribed to over stdio to reach stdio alone")
+	}
+}
+
+func TestSplitQualifiedURI(t *testing.T) {
+	tests := []struct {
+		uri      string
+		server   string
+		upstream string
+		ok       bool
+	}{
+		{"mcpgate://files/file:///tmp/a.txt", "files", "file:///tmp/a.txt", true},
+		{QualifyURI("github", "repo://owner/name"), "github", "repo://owner/name", true},
+		{"file:///tmp/a.txt", "", "", false},
+		{"mcpgate://files", "", "", false},
+		{"mcpgate:///file:///tmp", "", "", false},
+	}
+
+	for _, test := range tests {
+		srv, upstream, ok := SplitQualifiedURI(test.uri)
+		if ok != test.ok || srv != test.server || upstream != test.upstream {
+			t.Errorf("SplitQualifiedURI(%q) = (%q, %q, %v), want (%q, %q, %v)",
+				test.uri, srv, upstream, ok, test.server, test.upstream, test.ok)
+		}
+	}
+}
+
+func TestRouter_ResourcesSubscribe_ForwardsUpdates(t *testing.T) {
+	cfg := &config.Config{
+		Servers: []config.ServerConfig{
+			{
+				Name:      "files",
+				Transport: "stdio",
+				Enabled:   true,
+				Command:   mcptest.EchoCommand,
+				Args:      mcptest.EchoArgs(),
+			},
+		},
+	}
+	manager := server.NewManager(cfg)
+	if err := manager.Start(); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+	defer manager.Stop()
+
+	router := NewRouter(manager)
+
+	var notifications []*Notification
+	router.SetNotifier(func(n *Notification) {
+		notifications = append(notifications, n)
+	})
+
+	clientURI := QualifyURI("files", "file:///tmp/a.txt")
+	params, _ := json.Marshal(map[string]interface{}{"uri": clientURI})
+	resp := router.Route(context.Background(), &Request{
+		JSONRPC: "2.0",
+		ID:      1,
+		Method:  MethodResourcesSubscribe,
+		Params:  params,
+	})
+	if resp.Error != nil {
+		t.Fatalf("Unexpected error: %v", resp.Error.Message)
+	}
+
+	// Updates for unrelated resources are dropped
+	router.handleUpstreamNotification("files", json.RawMessage(`{"jsonrpc":"2.0","method":"notifications/resources/updated","params":{"uri":"file:///tmp/b.txt"}}`))
+	if len(notifications) != 0 {
+		t.Fatalf("Expected no notifications, got %d", len(notifications))
+	}
+
+	router.handleUpstreamNotification("files", json.RawMessage(`{"jsonrpc":"2.0","method":"notifications/resources/updated","params":{"uri":"file:///tmp/a.txt"}}`))
+	if len(notifications) != 1 {
+		t.Fatalf("Expected 1 notification, got %d", len(notifications))
+	}
+
+	var got struct {
+		URI string `json:"uri"`
+	}
+	if err := json.Unmarshal(notifications[0].Params, &got); err != nil {
+		t.Fatalf("Failed to parse notification params: %v", err)
+	}
+	if got.URI != clientURI {
+		t.Errorf("Expected rewritten URI %s, got %s", clientURI, got.URI)
+	}
+
+	resp = router.Route(context.Background(), &Request{
+		JSONRPC: "2.0",
+		ID:      2,
+		Method:  MethodResourcesUnsubscribe,
+		Params:  params,
+	})
+	if resp.Error != nil {
+		t.Fatalf("Unexpected error: %v", resp.Error.Message)
+	}
+
+	router.handleUpstreamNotification("files", json.RawMessage(`{"jsonrpc":"2.0","method":"notifications/resources/updated","params":{"uri":"file:///tmp/a.txt"}}`))
+	if len(notifications) != 1 {
+		t.Errorf("Expected no notifications after unsubscribe, got %d", len(notifications))
+	}
+}
+
+func TestRouter_StaticToolsList(t *testing.T) {
+	for _, mode := range []string{config.CapabilitiesOverride, config.CapabilitiesFallback} {
+		t.Run(mode, func(t *testing.T) {
+			cfg := &config.Config{
+				Servers: []config.ServerConfig{
+					{
+						Name:             "legacy",
+						Transport:        "stdio",
+						Enabled:          true,
+						Command:          mcptest.EchoCommand,
+						Args:             mcptest.EchoArgs(),
+						Capabilities:     []string{"tools"},
+						CapabilitiesMode: mode,
+						Tools: []config.StaticTool{
+							{Name: "search", InputSchema: map[string]interface{}{"type": "object"}},
+						},
+					},
+				},
+			}
+			manager := server.NewManager(cfg)
+			if err := manager.Start(); err != nil {
+				t.Fatalf("Failed to start manager: %v", err)
+			}
+			defer manager.Stop()
+
+			router := NewRouter(manager)
+			resp := router.Route(context.Background(), &Request{
+				JSONRPC: "2.0",
+				ID:      1,
+				Method:  MethodToolsList,
+			})
+			if resp.Error != nil {
+				t.Fatalf("Unexpected error: %v", resp.Error.Message)
+			}
+
+			result, ok := resp.Result.(map[string]interface{})
+			if !ok {
+				t.Fatalf("Expected static result map, got %T", resp.Result)
+			}
+			tools, ok := result["tools"].([]config.StaticTool)
+			if !ok || len(tools) != 1 || tools[0].Name != "search" {
+				t.Errorf("Expected static tool list, got %v", result["tools"])
+			}
+		})
+	}
+}
+
+func TestRouter_PinnedServerDuringReconnect(t *testing.T) {
+	manager := server.NewManager(&config.Config{
+		Servers: []config.ServerConfig{
+			{Name: "docs", Transport: "stdio", Enabled: true, Command: mcptest.EchoCommand, Args: mcptest.EchoArgs(), Capabilities: []string{"resources"}},
+		},
+	})
+	if err := manager.Start(); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+	defer manager.Stop()
+	router := NewRouter(manager)
+
+	// Reconnecting rewrites the server's capabilities while pinned requests
+	// check them; run with -race
+	reconnected := make(chan struct{})
+	go func() {
+		defer close(reconnected)
+		for i := 0; i < 5; i++ {
+			_ = manager.ReconnectServer("docs")
+		}
+	}()
+
+	for {
+		select {
+		case <-reconnected:
+			return
+		default:
+		}
+		router.Route(context.Background(), &Request{
+			JSONRPC: "2.0",
+			ID:      1,
+			Method:  "gateway/capabilities",
+			Params:  json.RawMessage(`{}`),
+		})
+		if _, errResp := router.pinnedServer(context.Background(), &Request{
+			JSONRPC: "2.0",
+			ID:      2,
+			Method:  MethodPromptsList,
+			Params:  json.RawMessage(`{"_meta":{"server":"docs"}}`),
+		}); errResp == nil {
+			t.Fatal("Expected a server without prompts to refuse a pinned prompts/list")
+		}
+	}
+}
+
+func TestStripRoutingHints(t *testing.T) {
+	req := &Request{
+		JSONRPC: "2.0",
+		ID:      1,
+		Method:  MethodToolsCall,
+		Params:  json.RawMessage(`{"name":"search","_server":"a","_meta":{"server":"a","tag":"prod","progressToken":7}}`),
+	}
+
+	stripped := stripRoutingHints(req)
+
+	var params map[string]interface{}
+	if err := json.Unmarshal(stripped.Params, &params); err != nil {
+		t.Fatalf("Failed to parse stripped params: %v", err)
+	}
+	if _, ok := params["_server"]; ok {
+		t.Error("Expected _server to be stripped")
+	}
+	meta, ok := params["_meta"].(map[string]interface{})
+	if !ok {
+		t.Fatal("Expected remaining _meta fields to be preserved")
+	}
+	if _, ok := meta["server"]; ok {
+		t.Error("Expected _meta.server to be stripped")
+	}
+	if _, ok := meta["tag"]; ok {
+		t.Error("Expected _meta.tag to be stripped")
+	}
+	if meta["progressToken"] != float64(7) || params["name"] != "search" {
+		t.Errorf("Unexpected stripped params: %v", params)
+	}
+	if string(req.Params) == string(stripped.Params) {
+		t.Error("Expected original request to be left untouched")
+	}
+}
+
+func TestRouter_PinnedServer(t *testing.T) {
+	cfg := &config.Config{
+		Servers: []config.ServerConfig{
+			{
+				Name:         "docs",
+				Transport:    "stdio",
+				Enabled:      true,
+				Command:      mcptest.EchoCommand,
+				Args:         mcptest.EchoArgs(),
+				Capabilities: []string{"resources"},
+			},
+		},
+	}
+	manager := server.NewManager(cfg)
+	if err := manager.Start(); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+	defer manager.Stop()
+
+	router := NewRouter(manager)
+
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		method string
+		params string
+		code   int
+	}{
+		{"unknown server in _meta", context.Background(), MethodToolsList, `{"_meta":{"server":"missing"}}`, InvalidParams},
+		{"unknown server in header", WithServerHint(context.Background(), "missing"), MethodToolsList, `{}`, InvalidParams},
+		{"missing capability", context.Background(), MethodToolsList, `{"_meta":{"server":"docs"}}`, MethodNotFound},
+		{"legacy _server", context.Background(), MethodPromptsList, `{"_server":"docs"}`, MethodNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := router.Route(tt.ctx, &Request{
+				JSONRPC: "2.0",
+				ID:      1,
+				Method:  tt.method,
+				Params:  json.RawMessage(tt.params),
+			})
+			if resp.Error == nil {
+				t.Fatal("Expected error response")
+			}
+			if resp.Error.Code != tt.code {
+				t.Errorf("Expected code %d, got %d (%s)", tt.code, resp.Error.Code, resp.Error.Message)
+			}
+		})
+	}
+
+	srv, errResp := router.pinnedServer(context.Background(), &Request{
+		JSONRPC: "2.0",
+		ID:      1,
+		Method:  MethodResourcesList,
+		Params:  json.RawMessage(`{"_meta":{"server":"docs"}}`),
+	})
+	if errResp != nil || srv == nil || srv.Name != "docs" {
+		t.Errorf("Expected request pinned to docs, got %v %v", srv, errResp)
+	}
+}
+
+func TestRouter_CallBatch(t *testing.T) {
+	cfg := &config.Config{
+		Servers: []config.ServerConfig{
+			{
+				Name:         "tools",
+				Transport:    "stdio",
+				Enabled:      true,
+				Command:      mcptest.EchoCommand,
+				Args:         mcptest.EchoArgs(),
+				Capabilities: []string{"tools"},
+			},
+		},
+	}
+	manager := server.NewManager(cfg)
+	if err := manager.Start(); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+	defer manager.Stop()
+
+	router := NewRouter(manager)
+	resp := router.Route(context.Background(), &Request{
+		JSONRPC: "2.0",
+		ID:      1,
+		Method:  "gateway/call_batch",
+		Params: json.RawMessage(`{"calls":[
+			{"name":"first","arguments":{"q":1}},
+			{"name":"second","server":"missing"},
+			{"name":"third","server":"tools"}
+		]}`),
+	})
+	if resp.Error != nil {
+		t.Fatalf("Unexpected error: %v", resp.Error.Message)
+	}
+
+	result, ok := resp.Result.(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected result map, got %T", resp.Result)
+	}
+	results, ok := result["results"].([]BatchResult)
+	if !ok || len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %v", result["results"])
+	}
+
+	for i, name := range []string{"first", "second", "third"} {
+		if results[i].Name != name {
+			t.Errorf("Expected result %d for %s, got %s", i, name, results[i].Name)
+		}
+	}
+	if results[0].Error != nil || results[2].Error != nil {
+		t.Errorf("Expected calls to routable servers to succeed, got %v and %v", results[0].Error, results[2].Error)
+	}
+	if results[1].Error == nil || results[1].Error.Code != InvalidParams {
+		t.Errorf("Expected pinned call to unknown server to fail, got %v", results[1].Error)
+	}
+}
+
+func TestRouter_CallBatch_InvalidParams(t *testing.T) {
+	router := NewRouter(server.NewManager(&config.Config{}))
+
+	for _, params := range []string{`{}`, `{"calls":[]}`, `not json`} {
+		resp := router.Route(context.Background(), &Request{
+			JSONRPC: "2.0",
+			ID:      1,
+			Method:  "gateway/call_batch",
+			Params:  json.RawMessage(params),
+		})
+		if resp.Error == nil || resp.Error.Code != InvalidParams {
+			t.Errorf("Expected invalid params error for %s, got %v", params, resp.Error)
+		}
+	}
+}
+
+func TestRouter_ManagementTools(t *testing.T) {
+	cfg := &config.Config{
+		Servers: []config.ServerConfig{
+			{
+				Name:      "upstream",
+				Transport: "stdio",
+				Enabled:   true,
+				Command:   mcptest.EchoCommand,
+				Args:      mcptest.EchoArgs(),
+			},
+		},
+	}
+	manager := server.NewManager(cfg)
+	if err := manager.Start(); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+	defer manager.Stop()
+
+	router := NewRouter(manager)
+	ctx := context.Background()
+
+	// Management tools are hidden unless enabled
+	resp := router.Route(ctx, &Request{
+		JSONRPC: "2.0",
+		ID:      1,
+		Method:  MethodToolsCall,
+		Params:  json.RawMessage(`{"name":"mcpgate_stats"}`),
+	})
+	if result, ok := resp.Result.(map[string]interface{}); ok && result["isError"] != nil {
+		t.Fatal("Expected management tool to be routed upstream when disabled")
+	}
+
+	router.EnableManagementTools()
+
+	resp = router.Route(ctx, &Request{JSONRPC: "2.0", ID: 2, Method: MethodToolsList})
+	result, ok := resp.Result.(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected result map, got %T", resp.Result)
+	}
+	tools, _ := result["tools"].([]interface{})
+	if len(tools) != len(managementTools) {
+		t.Errorf("Expected %d management tools, got %d", len(managementTools), len(tools))
+	}
+
+	// Disabling a server every client shares takes an admin
+	disable := &Request{
+		JSONRPC: "2.0",
+		ID:      3,
+		Method:  MethodToolsCall,
+		Params:  json.RawMessage(`{"name":"mcpgate_disable_server","arguments":{"name":"upstream"}}`),
+	}
+	agent := WithClient(ctx, &config.ClientConfig{Name: "agent", Servers: []string{"upstream"}})
+	if resp := router.Route(agent, disable); resp.Error == nil || resp.Error.Code != Forbidden {
+		t.Fatalf("Expected a client that is not an admin to be refused, got %+v", resp)
+	}
+	if srv, _ := manager.GetServer("upstream"); srv.IsDisabled() {
+		t.Fatal("Expected the server to stay enabled")
+	}
+
+	resp = router.Route(WithClient(ctx, &config.ClientConfig{Name: "ops", Admin: true}), disable)
+	if result, ok := resp.Result.(map[string]interface{}); !ok || result["isError"] != false {
+		t.Fatalf("Expected disable to succeed, got %v", resp.Result)
+	}
+
+	srv, _ := manager.GetServer("upstream")
+	if !srv.IsDisabled() || srv.State() != "disabled" {
+		t.Errorf("Expected server to be disabled, got state %s", srv.State())
+	}
+	if len(manager.ListActiveServers()) != 0 {
+		t.Error("Expected disabled server to be excluded from routing")
+	}
+
+	resp = router.Route(ctx, &Request{
+		JSONRPC: "2.0",
+		ID:      4,
+		Method:  MethodToolsCall,
+		Params:  json.RawMessage(`{"name":"mcpgate_reconnect_server","arguments":{"name":"missing"}}`),
+	})
+	if result, ok := resp.Result.(map[string]interface{}); !ok || result["isError"] != true {
+		t.Errorf("Expected reconnect of unknown server to report a tool error, got %v", resp.Result)
+	}
+}
+
+func TestRouter_ForwardsClientNotifications(t *testing.T) {
+	manager := server.NewManager(&config.Config{
+		Servers: []config.ServerConfig{
+			{Name: "echo", Transport: "stdio", Enabled: true, Command: mcptest.EchoCommand, Args: mcptest.EchoArgs()},
+		},
+	})
+	if err := manager.Start(); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+	defer manager.Stop()
+	router := NewRouter(manager)
+
+	srv, _ := manager.GetServer("echo")
+	before, _ := srv.TransportMetrics()
+
+	resp := router.Route(context.Background(), &Request{JSONRPC: "2.0", Method: "notifications/roots/list_changed"})
+	if resp != nil {
+		t.Fatalf("Expected no response to a notification, got %+v", resp)
+	}
+
+	after, _ := srv.TransportMetrics()
+	if after.BytesSent <= before.BytesSent || after.Requests != before.Requests {
+		t.Errorf("Expected the notification to be sent upstream, got %+v then %+v", before, after)
+	}
+
+	// Upstreams were sent their own initialized notification when they connected
+	resp = router.Route(context.Background(), &Request{JSONRPC: "2.0", Method: MethodInitializedNotify})
+	if resp != nil {
+		t.Fatalf("Expected no response to a notification, got %+v", resp)
+	}
+	if final, _ := srv.TransportMetrics(); final.BytesSent != after.BytesSent {
+		t.Errorf("Expected the client's initialized notification not to be forwarded, got %+v then %+v", after, final)
+	}
+
+	// A client held to other servers reaches none of its own upstreams
+	restricted := WithClient(context.Background(), &config.ClientConfig{Name: "reviewer", Servers: []string{"github"}})
+	router.Route(restricted, &Request{JSONRPC: "2.0", Method: "notifications/roots/list_changed"})
+	if final, _ := srv.TransportMetrics(); final.BytesSent != after.BytesSent {
+		t.Errorf("Expected the notification not to reach a server the client may not use, got %+v then %+v", after, final)
+	}
+}
+
+func TestRouter_CancelledRequest(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+
+	// Answers initialize, never answers anything else and records cancellations
+	cancelled := filepath.Join(t.TempDir(), "cancelled")
+	script := `while read -r line; do
+  case "$line" in
+    *'"method":"initialize"'*) echo '{"jsonrpc":"2.0","id":1,"result":{}}' ;;
+    *notifications/cancelled*) echo "$line" >> "$0" ;;
+  esac
+done`
+	manager := server.NewManager(&config.Config{
+		Servers: []config.ServerConfig{
+			{Name: "slow", Transport: "stdio", Enabled: true, Command: "sh", Args: []string{"-c", script, cancelled}},
+		},
+	})
+	if err := manager.Start(); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+	defer manager.Stop()
+	router := NewRouter(manager)
+
+	done := make(chan *Response, 1)
+	go func() {
+		done <- router.Route(context.Background(), &Request{JSONRPC: "2.0", ID: "call-1", Method: MethodToolsCall, Params: json.RawMessage(`{"name":"slow"}`)})
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if entry := router.inflight.lookup("", "call-1"); entry != nil && len(entry.upstreams()) > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Request was never forwarded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	router.Route(context.Background(), &Request{
+		JSONRPC: "2.0",
+		Method:  MethodCancelled,
+		Params:  json.RawMessage(`{"requestId":"call-1","reason":"user"}`),
+	})
+
+	select {
+	case resp := <-done:
+		if resp.Error == nil {
+			t.Errorf("Expected the cancelled request to fail, got %+v", resp)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the gateway to stop waiting for a cancelled request")
+	}
+
+	// The upstream sees the id the request was sent with, not the client's
+	for time.Now().Before(deadline) {
+		if data, _ := os.ReadFile(cancelled); len(data) > 0 {
+			if !strings.Contains(string(data), `"requestId":2`) {
+				t.Errorf("Expected the upstream id in the cancellation, got %s", data)
+			}
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("Expected the cancellation to reach the upstream")
+}
+
+func TestRouter_CancelledRequest_PerSession(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+
+	// Answers initialize and never answers anything else
+	script := `while read -r line; do
+  case "$line" in
+    *'"method":"initialize"'*) echo '{"jsonrpc":"2.0","id":1,"result":{}}' ;;
+  esac
+done`
+	manager := server.NewManager(&config.Config{
+		Servers: []config.ServerConfig{
+			{Name: "slow", Transport: "stdio", Enabled: true, Command: "sh", Args: []string{"-c", script}},
+		},
+	})
+	if err := manager.Start(); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+	defer manager.Stop()
+	router := NewRouter(manager)
+
+	// Both sessions use the same request id
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	first := make(chan *Response, 1)
+	second := make(chan *Response, 1)
+	for session, done := range map[string]chan *Response{"first": first, "second": second} {
+		go func() {
+			done <- router.Route(WithSession(ctx, session), &Request{JSONRPC: "2.0", ID: 1, Method: MethodToolsCall, Params: json.RawMessage(`{"name":"slow"}`)})
+		}()
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for _, session := range []string{"first", "second"} {
+		for {
+			if entry := router.inflight.lookup(session, 1); entry != nil && len(entry.upstreams()) > 0 {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Request of session %s was never forwarded", session)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	router.Route(WithSession(context.Background(), "second"), &Request{
+		JSONRPC: "2.0",
+		Method:  MethodCancelled,
+		Params:  json.RawMessage(`{"requestId":1}`),
+	})
+
+	select {
+	case <-second:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the gateway to stop waiting for the cancelled request")
+	}
+	select {
+	case resp := <-first:
+		t.Fatalf("Expected the other session's request to keep running, got %+v", resp)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestRouter_CancelledBatch(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+
+	// Answers initialize, never answers anything else and records cancellations
+	cancelled := filepath.Join(t.TempDir(), "cancelled")
+	script := `while read -r line; do
+  case "$line" in
+    *'"method":"initialize"'*) echo '{"jsonrpc":"2.0","id":1,"result":{}}' ;;
+    *notifications/cancelled*) echo "$line" >> "$0" ;;
+  esac
+done`
+	manager := server.NewManager(&config.Config{
+		Servers: []config.ServerConfig{
+			{Name: "slow", Transport: "stdio", Enabled: true, Command: "sh", Args: []string{"-c", script, cancelled}},
+		},
+	})
+	if err := manager.Start(); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+	defer manager.Stop()
+	router := NewRouter(manager)
+
+	done := make(chan *Response, 1)
+	go func() {
+		done <- router.Route(context.Background(), &Request{
+			JSONRPC: "2.0",
+			ID:      "batch-1",
+			Method:  "gateway/call_batch",
+			Params:  json.RawMessage(`{"calls":[{"name":"first"},{"name":"second"}]}`),
+		})
+	}()
+
+	// Both calls are in flight under the batch once forwarded
+	forwarded := func() int {
+		entry := router.inflight.lookup("", "batch-1")
+		if entry == nil {
+			return 0
+		}
+		entry.mutex.Lock()
+		defer entry.mutex.Unlock()
+		n := 0
+		for _, call := range entry.calls {
+			n += len(call.upstreams())
+		}
+		return n
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for forwarded() < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("Calls were never forwarded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	router.Route(context.Background(), &Request{
+		JSONRPC: "2.0",
+		Method:  MethodCancelled,
+		Params:  json.RawMessage(`{"requestId":"batch-1","reason":"user"}`),
+	})
+
+	select {
+	case resp := <-done:
+		results, _ := resp.Result.(map[string]interface{})["results"].([]BatchResult)
+		if len(results) != 2 || results[0].Error == nil || results[1].Error == nil {
+			t.Errorf("Expected both cancelled calls to fail, got %+v", resp.Result)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the gateway to stop waiting for a cancelled batch")
+	}
+
+	// Each call's cancellation reaches the upstream under the id it was sent with
+	for time.Now().Before(deadline) {
+		data, _ := os.ReadFile(cancelled)
+		if strings.Count(string(data), "\n") == 2 {
+			if !strings.Contains(string(data), `"requestId":2`) || !strings.Contains(string(data), `"requestId":3`) {
+				t.Errorf("Expected cancellations for both calls, got %s", data)
+			}
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("Expected a cancellation for each call to reach the upstream")
+}
+
+func TestRouter_AddServer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte("[gateway]\nlog_level = \"info\"\n"), 0o600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	cfg, err := config.LoadConfig(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	manager := server.NewManager(cfg)
+	if err := manager.Start(); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+	defer manager.Stop()
+
+	args, _ := json.Marshal(mcptest.EchoArgs())
+	router := NewRouter(manager)
+	router.EnableRuntimeChanges()
+	resp := router.Route(context.Background(), &Request{
+		JSONRPC: "2.0",
+		ID:      1,
+		Method:  "gateway/add_server",
+		Params:  json.RawMessage(`{"server":{"name":"echo","command":"` + mcptest.EchoCommand + `","args":` + string(args) + `},"persist":true}`),
+	})
+	if resp.Error != nil {
+		t.Fatalf("Unexpected error: %v", resp.Error.Message)
+	}
+
+	srv, err := manager.GetServer("echo")
+	if err != nil || !srv.IsConnected() {
+		t.Fatal("Expected the added server to be registered and connected")
+	}
+
+	saved, err := config.LoadConfig(path)
+	if err != nil {
+		t.Fatalf("Failed to reload config: %v", err)
+	}
+	if len(saved.Servers) != 1 || saved.Servers[0].Name != "echo" || saved.Servers[0].Command != mcptest.EchoCommand {
+		t.Errorf("Expected the server to be persisted, got %+v", saved.Servers)
+	}
+
+	// Names must stay unique
+	resp = router.Route(context.Background(), &Request{
+		JSONRPC: "2.0",
+		ID:      2,
+		Method:  "gateway/add_server",
+		Params:  json.RawMessage(`{"server":{"name":"echo","command":"cat"}}`),
+	})
+	if resp.Error == nil {
+		t.Error("Expected adding a duplicate server to fail")
+	}
+
+	resp = router.Route(context.Background(), &Request{
+		JSONRPC: "2.0",
+		ID:      3,
+		Method:  "gateway/add_server",
+		Params:  json.RawMessage(`{"server":{"command":"cat"}}`),
+	})
+	if resp.Error == nil || resp.Error.Code != InvalidParams {
+		t.Errorf("Expected invalid params for a server without a name, got %v", resp.Error)
+	}
+}
+
+func TestRouter_RemoveServer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	args, _ := json.Marshal(mcptest.EchoArgs())
+	content := "[[server]]\nname = \"echo\"\nenabled = true\ncommand = \"" + mcptest.EchoCommand + "\"\nargs = " + string(args) + "\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	cfg, err := config.LoadConfig(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	manager := server.NewManager(cfg)
+	if err := manager.Start(); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+	defer manager.Stop()
+
+	srv, err := manager.GetServer("echo")
+	if err != nil {
+		t.Fatalf("Failed to get server: %v", err)
+	}
+
+	router := NewRouter(manager)
+	router.EnableRuntimeChanges()
+	resp := router.Route(context.Background(), &Request{
+		JSONRPC: "2.0",
+		ID:      1,
+		Method:  "gateway/remove_server",
+		Params:  json.RawMessage(`{"name":"echo","persist":true}`),
+	})
+	if resp.Error != nil {
+		t.Fatalf("Unexpected error: %v", resp.Error.Message)
+	}
+
+	if _, err := manager.GetServer("echo"); err == nil {
+		t.Error("Expected the server to be unregistered")
+	}
+	if srv.IsConnected() {
+		t.Error("Expected the server to be disconnected")
+	}
+
+	saved, err := config.LoadConfig(path)
+	if err != nil {
+		t.Fatalf("Failed to reload config: %v", err)
+	}
+	if len(saved.Servers) != 0 {
+		t.Errorf("Expected the server to be deleted from the config, got %+v", saved.Servers)
+	}
+
+	resp = router.Route(context.Background(), &Request{
+		JSONRPC: "2.0",
+		ID:      2,
+		Method:  "gateway/remove_server",
+		Params:  json.RawMessage(`{"name":"echo"}`),
+	})
+	if resp.Error == nil {
+		t.Error("Expected removing an unknown server to fail")
+	}
+}
+
+func TestRouter_RuntimeChangesRefused(t *testing.T) {
+	manager := server.NewManager(&config.Config{})
+	if err := manager.Start(); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+	defer manager.Stop()
+	router := NewRouter(manager)
+	remove := func(ctx context.Context) *Response {
+		return router.Route(ctx, &Request{JSONRPC: "2.0", ID: 1, Method: "gateway/remove_server", Params: json.RawMessage(`{"name":"missing"}`)})
+	}
+
+	if resp := remove(context.Background()); resp.Error == nil || resp.Error.Code != Forbidden {
+		t.Errorf("Expected runtime changes refused unless enabled, got %+v", resp.Error)
+	}
+
+	router.EnableRuntimeChanges()
+	network := WithNetwork(context.Background())
+	if resp := remove(network); resp.Error == nil || resp.Error.Code != Forbidden {
+		t.Errorf("Expected runtime changes over the network refused without a client, got %+v", resp.Error)
+	}
+	if resp := remove(WithClient(network, &config.ClientConfig{Name: "reader", Tools: []string{"get_*"}})); resp.Error == nil || resp.Error.Code != Forbidden {
+		t.Errorf("Expected a client that is not an admin refused, got %+v", resp.Error)
+	}
+	if resp := remove(WithClient(network, &config.ClientConfig{Name: "ops", Admin: true})); resp.Error == nil || resp.Error.Code == Forbidden {
+		t.Errorf("Expected an admin client to get past the check, got %+v", resp.Error)
+	}
+	if resp := remove(context.Background()); resp.Error == nil || resp.Error.Code == Forbidden {
+		t.Errorf("Expected stdio to get past the check, got %+v", resp.Error)
+	}
+}
+
+func TestRouter_ReconnectServer(t *testing.T) {
+	cfg := &config.Config{
+		Servers: []config.ServerConfig{
+			{Name: "echo", Transport: "stdio", Enabled: true, Command: mcptest.EchoCommand, Args: mcptest.EchoArgs()},
+		},
+	}
+	manager := server.NewManager(cfg)
+	if err := manager.Start(); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+	defer manager.Stop()
+
+	router := NewRouter(manager)
+	resp := router.Route(context.Background(), &Request{
+		JSONRPC: "2.0",
+		ID:      1,
+		Method:  "gateway/reconnect_server",
+		Params:  json.RawMessage(`{"name":"echo"}`),
+	})
+	if resp.Error != nil {
+		t.Fatalf("Unexpected error: %v", resp.Error.Message)
+	}
+	result, ok := resp.Result.(map[string]interface{})
+	if !ok || result["connected"] != true {
+		t.Errorf("Expected the server to be reconnected, got %v", resp.Result)
+	}
+
+	resp = router.Route(context.Background(), &Request{
+		JSONRPC: "2.0",
+		ID:      2,
+		Method:  "gateway/reconnect_server",
+		Params:  json.RawMessage(`{"name":"missing"}`),
+	})
+	if resp.Error == nil || resp.Error.Message != "Server not found" {
+		t.Errorf("Expected server not found, got %v", resp.Error)
+	}
+
+	// Every client shares the upstream, so bouncing it takes an admin
+	resp = router.Route(WithClient(context.Background(), &config.ClientConfig{Name: "agent", Servers: []string{"echo"}}), &Request{
+		JSONRPC: "2.0",
+		ID:      3,
+		Method:  "gateway/reconnect_server",
+		Params:  json.RawMessage(`{"name":"echo"}`),
+	})
+	if resp.Error == nil || resp.Error.Code != Forbidden {
+		t.Errorf("Expected a client that is not an admin to be refused, got %+v", resp)
+	}
+}
+
+func TestRouter_CachedToolsList(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+
+	// Answers initialize and the catalog's tools/list, then never again
+	script := `read -r line; echo '{"jsonrpc":"2.0","id":1,"result":{"capabilities":{"tools":{}}}}'
+read -r line
+read -r line; echo '{"jsonrpc":"2.0","id":2,"result":{"tools":[{"name":"search"}]}}'; cat >/dev/null`
+	cfg := &config.Config{
+		Servers: []config.ServerConfig{
+			{Name: "tools", Transport: "stdio", Enabled: true, Command: "sh", Args: []string{"-c", script}, Timeout: 1},
+		},
+	}
+	manager := server.NewManager(cfg)
+	if err := manager.Start(); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+	defer manager.Stop()
+
+	router := NewRouter(manager)
+	resp := router.Route(context.Background(), &Request{
+		JSONRPC: "2.0",
+		ID:      1,
+		Method:  MethodToolsList,
+	})
+	if resp.Error != nil {
+		t.Fatalf("Expected tools/list to be answered from the cache, got %v", resp.Error.Message)
+	}
+
+	data, _ := json.Marshal(resp.Result)
+	if !strings.Contains(string(data), `"name":"search"`) {
+		t.Errorf("Expected the cached tool, got %s", data)
+	}
+
+	// Later pages are always forwarded; this upstream never answers them
+	resp = router.Route(context.Background(), &Request{
+		JSONRPC: "2.0",
+		ID:      2,
+		Method:  MethodToolsList,
+		Params:  json.RawMessage(`{"cursor":"next"}`),
+	})
+	if resp.Error == nil {
+		t.Errorf("Expected a cursor request to be forwarded upstream, got %v", resp.Result)
+	}
+}
+
+func TestRouter_TaggedServer(t *testing.T) {
+	cfg := &config.Config{
+		Servers: []config.ServerConfig{
+			{Name: "prod", Transport: "stdio", Enabled: true, Command: mcptest.EchoCommand, Args: mcptest.EchoArgs(), Capabilities: []string{"tools"}, Tags: []string{"github", "prod"}},
+			{Name: "docs", Transport: "stdio", Enabled: true, Command: mcptest.EchoCommand, Args: mcptest.EchoArgs(), Capabilities: []string{"resources"}, Tags: []string{"prod"}},
+		},
+	}
+	manager := server.NewManager(cfg)
+	if err := manager.Start(); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+	defer manager.Stop()
+
+	router := NewRouter(manager)
+
+	srv, errResp := router.taggedServer(context.Background(), &Request{
+		JSONRPC: "2.0",
+		ID:      1,
+		Method:  MethodToolsList,
+		Params:  json.RawMessage(`{"_meta":{"tag":"prod"}}`),
+	})
+	if errResp != nil || srv == nil || srv.Name != "prod" {
+		t.Errorf("Expected the prod server with tools, got %v %v", srv, errResp)
+	}
+
+	resp := router.Route(context.Background(), &Request{
+		JSONRPC: "2.0",
+		ID:      2,
+		Method:  MethodPromptsList,
+		Params:  json.RawMessage(`{"_meta":{"tag":"prod"}}`),
+	})
+	if resp.Error == nil || resp.Error.Code != InvalidParams {
+		t.Errorf("Expected no tagged server with prompts, got %v", resp.Error)
+	}
+
+	resp = router.Route(context.Background(), &Request{
+		JSONRPC: "2.0",
+		ID:      3,
+		Method:  "gateway/list_servers",
+		Params:  json.RawMessage(`{"tag":"github"}`),
+	})
+	servers, ok := resp.Result.([]map[string]interface{})
+	if !ok || len(servers) != 1 || servers[0]["name"] != "prod" {
+		t.Errorf("Expected only the server tagged github, got %v", resp.Result)
+	}
+}
+
+func TestRouter_PinnedReplicaGroup(t *testing.T) {
+	cfg := &config.Config{
+		Servers: config.ExpandReplicas([]config.ServerConfig{
+			{Name: "python", Transport: "stdio", Enabled: true, Command: mcptest.EchoCommand, Args: mcptest.EchoArgs(), Capabilities: []string{"tools"}, Replicas: 2},
+		}),
+	}
+	manager := server.NewManager(cfg)
+	if err := manager.Start(); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+	defer manager.Stop()
+
+	router := NewRouter(manager)
+
+	srv, errResp := router.pinnedServer(context.Background(), &Request{
+		JSONRPC: "2.0",
+		ID:      1,
+		Method:  MethodToolsCall,
+		Params:  json.RawMessage(`{"_meta":{"server":"python"}}`),
+	})
+	if errResp != nil || srv == nil || srv.Config.Group != "python" {
+		t.Errorf("Expected a replica of python, got %v %v", srv, errResp)
+	}
+
+	resp := router.Route(context.Background(), &Request{
+		JSONRPC: "2.0",
+		ID:      2,
+		Method:  "gateway/list_servers",
+	})
+	servers, ok := resp.Result.([]map[string]interface{})
+	if !ok || len(servers) != 2 {
+		t.Fatalf("Expected both replicas to be listed, got %v", resp.Result)
+	}
+	for _, entry := range servers {
+		if entry["group"] != "python" {
+			t.Errorf("Expected replica %v to report its group", entry["name"])
+		}
+	}
+}
+
+func TestRouter_ToolCallPrefersServerWithTool(t *testing.T) {
+	cfg := &config.Config{
+		Servers: []config.ServerConfig{
+			{Name: "general", Transport: "stdio", Enabled: true, Command: mcptest.EchoCommand, Args: mcptest.EchoArgs(), Lazy: true, Capabilities: []string{"tools"}, Priority: 10},
+			{
+				Name:         "deployer",
+				Transport:    "stdio",
+				Enabled:      true,
+				Command:      mcptest.EchoCommand,
+				Args:         mcptest.EchoArgs(),
+				Lazy:         true,
+				Capabilities: []string{"tools"},
+				Tools: []config.StaticTool{
+					{Name: "deploy", InputSchema: map[string]interface{}{"type": "object"}},
+				},
+			},
+		},
+	}
+	manager := server.NewManager(cfg)
+	if err := manager.Start(); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+	defer manager.Stop()
+
+	router := NewRouter(manager)
+
+	tests := []struct {
+		params string
+		want   string
+	}{
+		{`{"name":"deploy"}`, "deployer"},
+		{`{"name":"search"}`, "general"},
+	}
+	for _, tt := range tests {
+		srv := router.findTargetServer(context.Background(), &Request{
+			JSONRPC: "2.0",
+			ID:      1,
+			Method:  MethodToolsCall,
+			Params:  json.RawMessage(tt.params),
+		})
+		if srv == nil || srv.Name != tt.want {
+			t.Errorf("%s: expected server %s, got %v", tt.params, tt.want, srv)
+		}
+	}
+}
+
+func TestRouter_Stats(t *testing.T) {
+	cfg := &config.Config{
+		Servers: []config.ServerConfig{
+			{Name: "limited", Transport: "stdio", Enabled: true, Command: mcptest.EchoCommand, Args: mcptest.EchoArgs(), Lazy: true, MaxConcurrent: 2, PoolSize: 2},
+			{Name: "unlimited", Transport: "stdio", Enabled: true, Command: mcptest.EchoCommand, Args: mcptest.EchoArgs(), Lazy: true},
+		},
+	}
+	manager := server.NewManager(cfg)
+	if err := manager.Start(); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+	defer manager.Stop()
+
+	router := NewRouter(manager)
+	resp := router.Route(context.Background(), &Request{
+		JSONRPC: "2.0",
+		ID:      1,
+		Method:  "gateway/stats",
+	})
+	if resp.Error != nil {
+		t.Fatalf("Expected stats, got %v", resp.Error)
+	}
+
+	stats, ok := resp.Result.(map[string]interface{})
+	if !ok || stats["servers"] != 2 {
+		t.Fatalf("Expected stats for 2 servers, got %v", resp.Result)
+	}
+	queued, ok := stats["queued"].(map[string]int)
+	if !ok || len(queued) != 1 || queued["limited"] != 0 {
+		t.Errorf("Expected a queue length only for the limited server, got %v", stats["queued"])
+	}
+	pools, ok := stats["pools"].(map[string]interface{})
+	if !ok || len(pools) != 1 {
+		t.Fatalf("Expected a pool only for the limited server, got %v", stats["pools"])
+	}
+	if pool, _ := pools["limited"].(map[string]interface{}); pool["size"] != 2 || pool["open"] != 0 {
+		t.Errorf("Expected an empty pool of 2, got %v", pool)
+	}
+	requests, ok := stats["requests"].(map[string]interface{})
+	if !ok || len(requests) != 2 {
+		t.Fatalf("Expected request metrics for every server, got %v", stats["requests"])
+	}
+	if metrics, _ := requests["unlimited"].(map[string]interface{}); metrics["count"] != int64(0) || metrics["latency_ms"] == nil {
+		t.Errorf("Expected no requests yet, got %v", metrics)
+	}
+}
+
+func TestRouter_ClientPolicy(t *testing.T) {
+	cfg := &config.Config{
+		Servers: []config.ServerConfig{
+			{Name: "general", Transport: "stdio", Enabled: true, Command: mcptest.EchoCommand, Args: mcptest.EchoArgs(), Lazy: true, Capabilities: []string{"tools"}, Priority: 10},
+			{
+				Name:             "deployer",
+				Transport:        "stdio",
+				Enabled:          true,
+				Command:          mcptest.EchoCommand,
+				Args:             mcptest.EchoArgs(),
+				Lazy:             true,
+				Capabilities:     []string{"tools"},
+				CapabilitiesMode: config.CapabilitiesOverride,
+				Tools: []config.StaticTool{
+					{Name: "deploy_staging", InputSchema: map[string]interface{}{"type": "object"}},
+					{Name: "rollback", InputSchema: map[string]interface{}{"type": "object"}},
+				},
+			},
+		},
+	}
+	manager := server.NewManager(cfg)
+	if err := manager.Start(); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+	defer manager.Stop()
+
+	router := NewRouter(manager)
+	ctx := WithClient(context.Background(), &config.ClientConfig{Name: "ci", Servers: []string{"deployer"}, Tools: []string{"deploy_*"}})
+	route := func(method, params string) *Response {
+		return router.Route(ctx, &Request{JSONRPC: "2.0", ID: 1, Method: method, Params: json.RawMessage(params)})
+	}
+
+	// Capability routing skips servers outside the policy
+	if srv := router.findTargetServer(ctx, &Request{JSONRPC: "2.0", ID: 1, Method: MethodToolsCall, Params: json.RawMessage(`{"name":"search"}`)}); srv == nil || srv.Name != "deployer" {
+		t.Errorf("Expected tool calls routed to deployer, got %v", srv)
+	}
+
+	resp := route(MethodToolsList, `{}`)
+	data, _ := json.Marshal(resp.Result)
+	if resp.Error != nil || !strings.Contains(string(data), "deploy_staging") || strings.Contains(string(data), "rollback") {
+		t.Errorf("Expected only deploy_staging listed, got %s %+v", data, resp.Error)
+	}
+
+	resp = route("gateway/list_servers", `{}`)
+	if servers, ok := resp.Result.([]map[string]interface{}); !ok || len(servers) != 1 || servers[0]["name"] != "deployer" {
+		t.Errorf("Expected only deployer listed, got %v", resp.Result)
+	}
+
+	forbiddenTests := []struct {
+		name   string
+		method string
+		params string
+	}{
+		{"tool outside policy", MethodToolsCall, `{"name":"rollback"}`},
+		{"pinned server outside policy", MethodToolsCall, `{"name":"deploy_staging","_meta":{"server":"general"}}`},
+		{"status of server outside policy", "gateway/server_status", `{"name":"general"}`},
+		{"add server", "gateway/add_server", `{"name":"extra","command":"cat"}`},
+	}
+	for _, tt := range forbiddenTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if resp := route(tt.method, tt.params); resp.Error == nil || resp.Error.Code != Forbidden {
+				t.Errorf("Expected the request forbidden, got %+v", resp)
+			}
+		})
+	}
+
+	resp = route("gateway/call_batch", `{"calls":[{"name":"rollback"}]}`)
+	result, _ := resp.Result.(map[string]interface{})
+	results, _ := result["results"].([]BatchResult)
+	if len(results) != 1 || results[0].Error == nil || results[0].Error.Code != Forbidden {
+		t.Errorf("Expected the batched call forbidden, got %+v", resp.Result)
+	}
+}
+
+func TestRouter_RecentRequests(t *testing.T) {
+	router := &Router{}
+	for i := 0; i < recentRequestLimit+5; i++ {
+		router.recent.add(RequestRecord{Method: MethodToolsCall, Tool: strconv.Itoa(i)})
+	}
+
+	records := router.RecentRequests()
+	if len(records) != recentRequestLimit {
+		t.Fatalf("Expected %d records, got %d", recentRequestLimit, len(records))
+	}
+	if records[0].Tool != strconv.Itoa(recentRequestLimit+4) || records[len(records)-1].Tool != "5" {
+		t.Errorf("Expected the newest first and the oldest dropped, got %s ... %s", records[0].Tool, records[len(records)-1].Tool)
+	}
+}
+
+func TestRouter_AuditLog(t *testing.T) {
+	manager := server.NewManager(&config.Config{
+		Servers: []config.ServerConfig{
+			{Name: "tools", Transport: "stdio", Enabled: true, Command: mcptest.EchoCommand, Args: mcptest.EchoArgs(), Capabilities: []string{"tools"}},
+		},
+	})
+	if err := manager.Start(); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+	defer manager.Stop()
+
+	var buf bytes.Buffer
+	router := NewRouter(manager)
+	router.SetAuditLog(audit.New(&buf, nil))
+	ctx := WithSession(WithClient(context.Background(), &config.ClientConfig{Name: "ci", Tools: []string{"search"}}), "s1")
+	route := func(id interface{}, method, params string) {
+		router.Route(ctx, &Request{JSONRPC: "2.0", ID: id, Method: method, Params: json.RawMessage(params)})
+	}
+
+	route(1, MethodToolsCall, `{"name":"search","arguments":{"query":"x","api_key":"k"}}`)
+	route(2, MethodToolsCall, `{"name":"delete"}`)
+	route(3, MethodToolsList, `{}`)
+	route(4, "gateway/call_batch", `{"calls":[{"name":"search"}]}`)
+
+	var records []audit.Record
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record audit.Record
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Expected a JSON record, got %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	if len(records) != 3 {
+		t.Fatalf("Expected the three tool calls audited, got %d: %s", len(records), buf.String())
+	}
+
+	call := records[0]
+	if call.Client != "ci" || call.Session != "s1" || call.Server != "tools" || call.Tool != "search" || call.Status != audit.StatusOK {
+		t.Errorf("Expected an audited call to search on tools, got %+v", call)
+	}
+	if string(call.Arguments) != `{"api_key":"[REDACTED]","query":"x"}` {
+		t.Errorf("Expected the api_key redacted, got %s", call.Arguments)
+	}
+	if denied := records[1]; denied.Tool != "delete" || denied.Server != "" || denied.Status != audit.StatusError || denied.ErrorCode != Forbidden {
+		t.Errorf("Expected the refused call audited, got %+v", denied)
+	}
+	if batched := records[2]; batched.Tool != "search" || batched.Server != "tools" || batched.RequestID != float64(4) {
+		t.Errorf("Expected the batched call audited under the batch's id, got %+v", batched)
+	}
+}
+
+func TestRouter_ToolCatalog(t *testing.T) {
+	cfg := &config.Config{
+		Servers: []config.ServerConfig{
+			{
+				Name:             "search",
+				Transport:        "stdio",
+				Enabled:          true,
+				Command:          mcptest.EchoCommand,
+				Args:             mcptest.EchoArgs(),
+				Lazy:             true,
+				Capabilities:     []string{"tools"},
+				CapabilitiesMode: config.CapabilitiesOverride,
+				Tools: []config.StaticTool{
+					{Name: "web_search", Description: "Search the web"},
+					{Name: "image_search"},
+				},
+			},
+			{Name: "plain", Transport: "stdio", Enabled: true, Command: mcptest.EchoCommand, Args: mcptest.EchoArgs(), Lazy: true},
+		},
+	}
+	manager := server.NewManager(cfg)
+	if err := manager.Start(); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+	defer manager.Stop()
+
+	catalog := NewRouter(manager).ToolCatalog()
+	if len(catalog) != 2 || catalog[0].Name != "image_search" || catalog[1].Name != "web_search" || catalog[1].Description != "Search the web" || catalog[1].Server != "search" {
+		t.Errorf("Expected the static tools sorted by name, got %+v", catalog)
+	}
+}
@@ -0,0 +1,161 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/j4ng5y/mcpgate/transport"
+)
+
+// StreamThreshold is the raw result size above which WriteResponse writes
+// the result in chunks instead of encoding the whole response at once, and
+// above which a resources/read result is streamed from the upstream
+const StreamThreshold = 1024 * 1024
+
+// streamChunkSize is the size of each chunk written while streaming
+const streamChunkSize = 64 * 1024
+
+// rawResponse decodes an upstream response while keeping the result as raw
+// bytes, so large results are never expanded into maps and strings
+type rawResponse struct {
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  *JSONRPCError   `json:"error,omitempty"`
+}
+
+// passthroughMethods are forwarded without decoding the result; their
+// results can be large and the gateway never inspects them
+var passthroughMethods = map[string]bool{
+	MethodResourcesRead: true,
+}
+
+// StreamResults returns a context under which a resources/read result larger
+// than StreamThreshold is relayed from the upstream as WriteResponse writes
+// it, instead of being read whole first, and the function to call once the
+// response is written or abandoned. Streaming applies to upstreams read as a
+// stream of messages, such as stdio; one context streams a single result.
+func StreamResults(ctx context.Context) (context.Context, func()) {
+	stream := transport.NewResultStream(MethodResourcesRead, StreamThreshold)
+	return transport.WithResultStream(ctx, stream), func() {
+		_ = stream.Close()
+	}
+}
+
+// streamedResult is a result being relayed from the upstream
+type streamedResult struct {
+	reader io.Reader
+}
+
+// MarshalJSON reads the whole result, for writers that cannot stream it
+func (s streamedResult) MarshalJSON() ([]byte, error) {
+	return io.ReadAll(s.reader)
+}
+
+// streamedResponse returns resp with the result relayed through the stream
+// of ctx, if the upstream streamed it
+func streamedResponse(ctx context.Context, resp *Response) *Response {
+	stream := transport.ResultStreamFromContext(ctx)
+	if stream == nil || resp.Error != nil {
+		return resp
+	}
+	if reader := stream.Reader(); reader != nil {
+		resp.Result = streamedResult{reader: reader}
+	}
+	return resp
+}
+
+// WriteResponse writes resp as a single line of JSON. A result streamed from
+// the upstream, or a raw result larger than StreamThreshold, is compacted and
+// written in chunks straight from the upstream bytes, avoiding the
+// re-encoded copies json.Encoder would make.
+func WriteResponse(w io.Writer, resp *Response) error {
+	var result io.Reader
+	switch r := resp.Result.(type) {
+	case streamedResult:
+		result = r.reader
+	case json.RawMessage:
+		if len(r) > StreamThreshold {
+			result = bytes.NewReader(r)
+		}
+	}
+	if result == nil || resp.Error != nil {
+		return json.NewEncoder(w).Encode(resp)
+	}
+
+	id, err := json.Marshal(resp.ID)
+	if err != nil {
+		return fmt.Errorf("failed to marshal response id: %w", err)
+	}
+
+	header := make([]byte, 0, 64)
+	header = append(header, `{"jsonrpc":"2.0"`...)
+	if resp.ID != nil {
+		header = append(header, `,"id":`...)
+		header = append(header, id...)
+	}
+	header = append(header, `,"result":`...)
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+
+	if err := writeCompacted(w, result); err != nil {
+		return err
+	}
+
+	_, err = w.Write([]byte("}\n"))
+	return err
+}
+
+// writeCompacted writes the valid JSON read from r with insignificant
+// whitespace removed, in chunks of at most streamChunkSize. Newlines inside
+// strings are always escaped in valid JSON, so the output never contains a
+// raw newline.
+func writeCompacted(w io.Writer, r io.Reader) error {
+	chunk := make([]byte, 0, streamChunkSize)
+	buf := make([]byte, streamChunkSize)
+	inString := false
+	escaped := false
+
+	for {
+		n, readErr := r.Read(buf)
+		for _, c := range buf[:n] {
+			switch {
+			case inString:
+				if escaped {
+					escaped = false
+				} else if c == '\\' {
+					escaped = true
+				} else if c == '"' {
+					inString = false
+				}
+			case c == '"':
+				inString = true
+			case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+				continue
+			}
+
+			chunk = append(chunk, c)
+			if len(chunk) == streamChunkSize {
+				if _, err := w.Write(chunk); err != nil {
+					return err
+				}
+				chunk = chunk[:0]
+			}
+		}
+
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+
+	if len(chunk) > 0 {
+		_, err := w.Write(chunk)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/j4ng5y/mcpgate/config"
+	"github.com/j4ng5y/mcpgate/server"
+)
+
+// chunkRecorder records the size of every write
+type chunkRecorder struct {
+	bytes.Buffer
+	largest int
+}
+
+func (c *chunkRecorder) Write(p []byte) (int, error) {
+	if len(p) > c.largest {
+		c.largest = len(p)
+	}
+	return c.Buffer.Write(p)
+}
+
+func TestWriteResponse_SmallResultUsesEncoder(t *testing.T) {
+	resp := &Response{JSONRPC: "2.0", ID: "a", Result: json.RawMessage(`{ "ok": true }`)}
+
+	var got, want bytes.Buffer
+	if err := WriteResponse(&got, resp); err != nil {
+		t.Fatalf("WriteResponse failed: %v", err)
+	}
+	_ = json.NewEncoder(&want).Encode(resp)
+	if got.String() != want.String() {
+		t.Errorf("Expected %q, got %q", want.String(), got.String())
+	}
+}
+
+func TestWriteResponse_StreamsLargeResult(t *testing.T) {
+	text := strings.Repeat("line \\\"quoted\\\"\\n  indented ", StreamThreshold/20)
+	result := json.RawMessage("{\n  \"contents\": [\n    {\"uri\": \"file:///big.txt\", \"text\": \"" + text + "\"}\n  ]\n}")
+
+	var out chunkRecorder
+	if err := WriteResponse(&out, &Response{JSONRPC: "2.0", ID: float64(7), Result: result}); err != nil {
+		t.Fatalf("WriteResponse failed: %v", err)
+	}
+
+	data := out.Bytes()
+	if bytes.IndexByte(data, '\n') != len(data)-1 {
+		t.Fatal("Expected exactly one trailing newline")
+	}
+	if out.largest > streamChunkSize {
+		t.Errorf("Expected writes of at most %d bytes, got %d", streamChunkSize, out.largest)
+	}
+
+	var decoded struct {
+		ID     float64 `json:"id"`
+		Result struct {
+			Contents []struct {
+				Text string `json:"text"`
+			} `json:"contents"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Streamed response is not valid JSON: %v", err)
+	}
+
+	var original struct {
+		Contents []struct {
+			Text string `json:"text"`
+		} `json:"contents"`
+	}
+	_ = json.Unmarshal(result, &original)
+	if decoded.ID != 7 || decoded.Result.Contents[0].Text != original.Contents[0].Text {
+		t.Error("Streamed response does not match the original result")
+	}
+}
+
+func TestPassthroughResponse(t *testing.T) {
+	req := &Request{JSONRPC: "2.0", ID: "client-1", Method: MethodResourcesRead}
+
+	resp := passthroughResponse(req, json.RawMessage(`{"jsonrpc":"2.0","id":99,"result":{"contents":[]}}`))
+	if resp.ID != "client-1" || resp.Error != nil {
+		t.Fatalf("Unexpected response %+v", resp)
+	}
+	if raw, ok := resp.Result.(json.RawMessage); !ok || string(raw) != `{"contents":[]}` {
+		t.Errorf("Expected raw result, got %T %v", resp.Result, resp.Result)
+	}
+
+	resp = passthroughResponse(req, json.RawMessage(`{"jsonrpc":"2.0","error":{"code":-32002,"message":"Resource not found"}}`))
+	if resp.Error == nil || resp.Error.Code != -32002 || resp.Result != nil {
+		t.Errorf("Expected upstream error to pass through, got %+v", resp)
+	}
+
+	resp = passthroughResponse(req, json.RawMessage(`not json`))
+	if resp.Error == nil || resp.Error.Code != ParseError {
+		t.Errorf("Expected parse error, got %+v", resp)
+	}
+}
+
+func TestRouter_StreamsLargeResourcesRead(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+
+	// Answers resources/read with a result of a few megabytes and anything
+	// else with an empty result
+	script := `while IFS= read -r line; do
+  case "$line" in
+    *'"id":'*) ;;
+    *) continue ;;
+  esac
+  id=${line#*'"id":'}
+  id=${id%%[,\}]*}
+  case "$line" in
+    *'"method":"resources/read"'*)
+      printf '{"jsonrpc":"2.0","id":%s,"result":{"contents":[{"uri":"file:///big","text":"' "$id"
+      head -c 3000000 /dev/zero | tr '\0' a
+      printf '"}]}}\n' ;;
+    *) printf '{"jsonrpc":"2.0","id":%s,"result":{}}\n' "$id" ;;
+  esac
+done`
+	manager := server.NewManager(&config.Config{
+		Servers: []config.ServerConfig{
+			{Name: "files", Transport: "stdio", Enabled: true, Command: "sh", Args: []string{"-c", script}},
+		},
+	})
+	if err := manager.Start(); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+	defer manager.Stop()
+	router := NewRouter(manager)
+
+	read := &Request{JSONRPC: "2.0", ID: "read-1", Method: MethodResourcesRead, Params: json.RawMessage(`{"uri":"file:///big"}`)}
+	for range 2 {
+		ctx, release := StreamResults(context.Background())
+		resp := router.Route(ctx, read)
+		if _, ok := resp.Result.(streamedResult); !ok {
+			release()
+			t.Fatalf("Expected the result to be streamed, got %T %+v", resp.Result, resp.Error)
+		}
+
+		var out bytes.Buffer
+		err := WriteResponse(&out, resp)
+		release()
+		if err != nil {
+			t.Fatalf("WriteResponse failed: %v", err)
+		}
+
+		var decoded struct {
+			ID     string `json:"id"`
+			Result struct {
+				Contents []struct {
+					Text string `json:"text"`
+				} `json:"contents"`
+			} `json:"result"`
+		}
+		if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+			t.Fatalf("Streamed response is not valid JSON: %v", err)
+		}
+		if decoded.ID != "read-1" || len(decoded.Result.Contents) != 1 || len(decoded.Result.Contents[0].Text) != 3000000 {
+			t.Fatalf("Unexpected streamed response of %d bytes", out.Len())
+		}
+	}
+
+	// Without a stream the result is read whole, after an abandoned stream
+	// left the connection in step
+	ctx, release := StreamResults(context.Background())
+	router.Route(ctx, read)
+	release()
+	resp := router.Route(context.Background(), read)
+	if raw, ok := resp.Result.(json.RawMessage); !ok || len(raw) < 3000000 {
+		t.Errorf("Expected the whole result, got %T %+v", resp.Result, resp.Error)
+	}
+}
@@ -0,0 +1,297 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/j4ng5y/mcpgate/logging"
+	"github.com/j4ng5y/mcpgate/server"
+)
+
+// GatewayURIScheme prefixes resource URIs that are qualified with their owning
+// server, e.g. mcpgate://github/repo://owner/name
+const GatewayURIScheme = "mcpgate://"
+
+// QualifyURI returns the gateway-qualified form of an upstream resource URI
+func QualifyURI(serverName, uri string) string {
+	return GatewayURIScheme + serverName + "/" + uri
+}
+
+// SplitQualifiedURI splits a gateway-qualified URI into server name and upstream URI
+func SplitQualifiedURI(uri string) (serverName string, upstreamURI string, ok bool) {
+	if !strings.HasPrefix(uri, GatewayURIScheme) {
+		return "", "", false
+	}
+
+	rest := strings.TrimPrefix(uri, GatewayURIScheme)
+	idx := strings.Index(rest, "/")
+	if idx <= 0 || idx == len(rest)-1 {
+		return "", "", false
+	}
+
+	return rest[:idx], rest[idx+1:], true
+}
+
+// subscription is a client's subscription to a resource on one upstream
+type subscription struct {
+	session     string // The subscribing session, "" over stdio
+	server      string
+	upstreamURI string
+	clientURI   string
+}
+
+// subscriptionKey identifies a subscription by the session that made it and
+// the URI it used, as sessions subscribe and unsubscribe independently
+type subscriptionKey struct {
+	session   string
+	clientURI string
+}
+
+// subscriptionTracker records the resources each client session has subscribed to
+type subscriptionTracker struct {
+	mutex    sync.RWMutex
+	byClient map[subscriptionKey]subscription
+}
+
+// add records a subscription keyed by its session and the URI the client used
+func (t *subscriptionTracker) add(sub subscription) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.byClient[subscriptionKey{sub.session, sub.clientURI}] = sub
+}
+
+// remove deletes a session's subscription for a client URI. It returns the
+// subscription and reports whether the upstream should stop sending its
+// updates: the session held it and no other session is still subscribed to
+// the same upstream resource.
+func (t *subscriptionTracker) remove(session, clientURI string) (subscription, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	key := subscriptionKey{session, clientURI}
+	sub, ok := t.byClient[key]
+	delete(t.byClient, key)
+	return sub, ok && !t.subscribedLocked(sub.server, sub.upstreamURI)
+}
+
+// removeSession deletes every subscription of a session, returning those no
+// other session shares an upstream resource with
+func (t *subscriptionTracker) removeSession(session string) []subscription {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	var removed []subscription
+	for key, sub := range t.byClient {
+		if key.session == session {
+			delete(t.byClient, key)
+			removed = append(removed, sub)
+		}
+	}
+	return slices.DeleteFunc(removed, func(sub subscription) bool {
+		return t.subscribedLocked(sub.server, sub.upstreamURI)
+	})
+}
+
+// subscribedLocked reports whether any session is subscribed to an upstream
+// resource. The caller holds the mutex.
+func (t *subscriptionTracker) subscribedLocked(serverName, upstreamURI string) bool {
+	for _, sub := range t.byClient {
+		if sub.server == serverName && sub.upstreamURI == upstreamURI {
+			return true
+		}
+	}
+	return false
+}
+
+// lookup finds the subscriptions matching an upstream server and URI
+func (t *subscriptionTracker) lookup(serverName, upstreamURI string) []subscription {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	var result []subscription
+	for _, sub := range t.byClient {
+		if sub.server == serverName && sub.upstreamURI == upstreamURI {
+			result = append(result, sub)
+		}
+	}
+	return result
+}
+
+// resourceParams are the parameters of resources/subscribe and resources/unsubscribe
+type resourceParams struct {
+	URI string `json:"uri"`
+}
+
+// handleResourcesSubscribe routes a subscription to the owning upstream and tracks it
+func (r *Router) handleResourcesSubscribe(ctx context.Context, req *Request) *Response {
+	var params resourceParams
+	if err := json.Unmarshal(req.Params, &params); err != nil || params.URI == "" {
+		return &Response{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error: &JSONRPCError{
+				Code:    InvalidParams,
+				Message: "Invalid parameters: uri is required",
+			},
+		}
+	}
+
+	srv, upstreamURI, errResp := r.resolveResourceOwner(ctx, req, params)
+	if errResp != nil {
+		return errResp
+	}
+	if srv == nil {
+		return &Response{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error: &JSONRPCError{
+				Code:    -32000,
+				Message: "No server owns resource " + params.URI,
+			},
+		}
+	}
+
+	resp := r.forward(ctx, srv, withResourceURI(req, upstreamURI))
+	if resp.Error == nil {
+		r.subscriptions.add(subscription{
+			session:     SessionFromContext(ctx),
+			server:      srv.Name,
+			upstreamURI: upstreamURI,
+			clientURI:   params.URI,
+		})
+	}
+	return resp
+}
+
+// handleResourcesUnsubscribe stops tracking a session's subscription and
+// routes the unsubscribe to the owning upstream. A session that held no such
+// subscription, or shares it with another session, is answered without
+// contacting the upstream, so the other sessions keep their updates.
+func (r *Router) handleResourcesUnsubscribe(ctx context.Context, req *Request) *Response {
+	var params resourceParams
+	if err := json.Unmarshal(req.Params, &params); err != nil || params.URI == "" {
+		return &Response{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error: &JSONRPCError{
+				Code:    InvalidParams,
+				Message: "Invalid parameters: uri is required",
+			},
+		}
+	}
+
+	if sub, orphaned := r.subscriptions.remove(SessionFromContext(ctx), params.URI); orphaned {
+		if srv, err := r.manager.GetServer(sub.server); err == nil {
+			return r.forward(ctx, srv, withResourceURI(req, sub.upstreamURI))
+		}
+	}
+	return &Response{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Result:  map[string]interface{}{},
+	}
+}
+
+// EndSession forgets the subscriptions of a session that ended and, in the
+// background, tells upstreams to stop sending the updates no other session
+// subscribed to. Server modes call it when a client's session ends; stdio,
+// without a session id, never does.
+func (r *Router) EndSession(id string) {
+	if id == "" {
+		return
+	}
+	orphaned := r.subscriptions.removeSession(id)
+	if len(orphaned) == 0 {
+		return
+	}
+
+	go func() {
+		for _, sub := range orphaned {
+			srv, err := r.manager.GetServer(sub.server)
+			if err != nil || !srv.IsConnected() {
+				continue
+			}
+			params, _ := json.Marshal(map[string]interface{}{"uri": sub.upstreamURI})
+			resp := r.forward(context.Background(), srv, &Request{JSONRPC: "2.0", ID: "unsubscribe-" + id, Method: MethodResourcesUnsubscribe, Params: params})
+			if resp.Error != nil {
+				slog.Warn("Error unsubscribing an ended session", logging.Server(sub.server), "uri", sub.upstreamURI, slog.String(logging.KeyError, resp.Error.Message))
+			}
+		}
+	}()
+}
+
+// resolveResourceOwner determines which upstream owns a resource URI
+func (r *Router) resolveResourceOwner(ctx context.Context, req *Request, params resourceParams) (*server.ManagedServer, string, *Response) {
+	if serverName, upstreamURI, ok := SplitQualifiedURI(params.URI); ok {
+		srv, err := r.manager.GetServer(serverName)
+		if err != nil {
+			return nil, "", nil
+		}
+		if !permitsServer(ctx, srv) {
+			return nil, "", forbidden(ctx, req, "use server "+serverName)
+		}
+		return srv, upstreamURI, nil
+	}
+
+	srv, errResp := r.pinnedServer(ctx, req)
+	if errResp != nil || srv != nil {
+		return srv, params.URI, errResp
+	}
+
+	return r.findTargetServer(ctx, req), params.URI, nil
+}
+
+// withResourceURI returns a copy of req whose params carry only the upstream URI
+func withResourceURI(req *Request, uri string) *Request {
+	params, _ := json.Marshal(map[string]interface{}{"uri": uri})
+	return &Request{
+		JSONRPC: req.JSONRPC,
+		ID:      req.ID,
+		Method:  req.Method,
+		Params:  params,
+	}
+}
+
+// handleUpstreamNotification translates notifications from upstream servers for the client
+func (r *Router) handleUpstreamNotification(serverName string, raw json.RawMessage) {
+	var notification Notification
+	if err := json.Unmarshal(raw, &notification); err != nil {
+		slog.Warn("Dropping malformed notification", logging.Server(serverName), logging.Err(err))
+		return
+	}
+
+	switch notification.Method {
+	case MethodResourceUpdated:
+		r.forwardResourceUpdated(serverName, &notification)
+	}
+}
+
+// forwardResourceUpdated sends resource updates to each session subscribed
+// to the resource, using the URI it subscribed with
+func (r *Router) forwardResourceUpdated(serverName string, notification *Notification) {
+	var params map[string]interface{}
+	if err := json.Unmarshal(notification.Params, &params); err != nil {
+		return
+	}
+
+	uri, _ := params["uri"].(string)
+	for _, sub := range r.subscriptions.lookup(serverName, uri) {
+		params["uri"] = sub.clientURI
+		data, err := json.Marshal(params)
+		if err != nil {
+			continue
+		}
+		r.sendNotification(&Notification{
+			JSONRPC:   "2.0",
+			Method:    MethodResourceUpdated,
+			Params:    data,
+			session:   sub.session,
+			addressed: true,
+			servers:   []string{serverName},
+		})
+	}
+}
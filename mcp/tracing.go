@@ -0,0 +1,33 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/j4ng5y/mcpgate/tracing"
+)
+
+// startRouteSpan begins the server span covering a client request, named
+// after its method. Upstream calls made while routing it become its children.
+func startRouteSpan(ctx context.Context, req *Request) (context.Context, *tracing.Span) {
+	ctx, span := tracing.Start(ctx, req.Method, tracing.KindServer)
+	if span == nil {
+		return ctx, nil
+	}
+	span.SetAttribute("rpc.system", "jsonrpc")
+	span.SetAttribute("rpc.method", req.Method)
+	span.SetAttribute("rpc.jsonrpc.request_id", fmt.Sprint(req.ID))
+	if client := ClientFromContext(ctx); client != nil {
+		span.SetAttribute("mcpgate.client", client.Name)
+	}
+	return ctx, span
+}
+
+// endRouteSpan records how a client request was answered and ends its span
+func endRouteSpan(span *tracing.Span, resp *Response) {
+	if resp != nil && resp.Error != nil {
+		span.SetAttribute("rpc.jsonrpc.error_code", resp.Error.Code)
+		span.SetError(resp.Error.Message)
+	}
+	span.End()
+}
@@ -14,9 +14,9 @@ type Request struct {
 
 // Response represents a JSON-RPC 2.0 response
 type Response struct {
-	JSONRPC string      `json:"jsonrpc"`
-	ID      interface{} `json:"id,omitempty"`
-	Result  interface{} `json:"result,omitempty"`
+	JSONRPC string        `json:"jsonrpc"`
+	ID      interface{}   `json:"id,omitempty"`
+	Result  interface{}   `json:"result,omitempty"`
 	Error   *JSONRPCError `json:"error,omitempty"`
 }
 
@@ -32,24 +32,35 @@ type Notification struct {
 	JSONRPC string          `json:"jsonrpc"`
 	Method  string          `json:"method"`
 	Params  json.RawMessage `json:"params,omitempty"`
+
+	// Who the notification is for, see Router.Receives
+	session   string   // The session it is addressed to, when addressed
+	addressed bool     // Set for notifications meant for one session
+	servers   []string // The upstream servers it concerns, if any
 }
 
 // Method types
 const (
 	// Core methods
-	MethodInitialize       = "initialize"
-	MethodInitialized      = "initialized"
-	MethodShutdown         = "shutdown"
-	MethodToolsList        = "tools/list"
-	MethodToolsCall        = "tools/call"
-	MethodResourcesList    = "resources/list"
-	MethodResourcesRead    = "resources/read"
-	MethodPromptsList      = "prompts/list"
-	MethodPromptsGet       = "prompts/get"
-	MethodLogsListChanged  = "logs/list_changed"
-	MethodProgressNotify   = "notifications/progress"
-	MethodResourcesUpdated = "notifications/resources/list_changed"
-	MethodToolsUpdated     = "notifications/tools/list_changed"
+	MethodInitialize           = "initialize"
+	MethodInitialized          = "initialized"
+	MethodShutdown             = "shutdown"
+	MethodToolsList            = "tools/list"
+	MethodToolsCall            = "tools/call"
+	MethodResourcesList        = "resources/list"
+	MethodResourcesRead        = "resources/read"
+	MethodResourcesSubscribe   = "resources/subscribe"
+	MethodResourcesUnsubscribe = "resources/unsubscribe"
+	MethodPromptsList          = "prompts/list"
+	MethodPromptsGet           = "prompts/get"
+	MethodLogsListChanged      = "logs/list_changed"
+	MethodProgressNotify       = "notifications/progress"
+	MethodResourcesUpdated     = "notifications/resources/list_changed"
+	MethodToolsUpdated         = "notifications/tools/list_changed"
+	MethodPromptsUpdated       = "notifications/prompts/list_changed"
+	MethodResourceUpdated      = "notifications/resources/updated"
+	MethodCancelled            = "notifications/cancelled"
+	MethodInitializedNotify    = "notifications/initialized"
 )
 
 // Error codes
@@ -61,4 +72,23 @@ const (
 	InternalError    = -32603
 	ServerErrorStart = -32099
 	ServerErrorEnd   = -32000
+
+	// Forbidden refuses requests a client's policy does not permit
+	Forbidden = -32003
 )
+
+// ParseRequest decodes a single JSON-RPC request. On failure it returns the
+// parse error response to send back instead.
+func ParseRequest(data []byte) (*Request, *Response) {
+	var req Request
+	if err := json.Unmarshal(data, &req); err != nil {
+		return nil, &Response{
+			JSONRPC: "2.0",
+			Error: &JSONRPCError{
+				Code:    ParseError,
+				Message: "Parse error",
+			},
+		}
+	}
+	return &req, nil
+}
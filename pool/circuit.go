@@ -0,0 +1,102 @@
+package pool
+
+import (
+	"errors"
+	"time"
+)
+
+// DefaultCoolDown is how long a server's pool refuses to hand out transports
+// once all of them are unhealthy, unless changed with SetCoolDown
+const DefaultCoolDown = 30 * time.Second
+
+// ErrCircuitOpen is returned by GetTransport while a server's pool is
+// cooling down after all of its transports turned unhealthy
+var ErrCircuitOpen = errors.New("connection pool circuit open")
+
+// CircuitHandler is told when a server's pool stops handing out transports
+// because all of them are unhealthy, and when one is healthy again
+type CircuitHandler func(server string, open bool)
+
+// circuit tracks whether a server's pool is short-circuiting acquisitions
+type circuit struct {
+	server    string
+	openUntil time.Time // End of the cool-down; acquisitions are tried again after it
+}
+
+// SetCoolDown sets how long a server's pool refuses to hand out transports
+// once all of them are unhealthy
+func (p *ConnectionPool) SetCoolDown(coolDown time.Duration) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.coolDown = coolDown
+}
+
+// SetCircuitHandler sets the handler told when a server's circuit opens or
+// closes
+func (p *ConnectionPool) SetCircuitHandler(handler CircuitHandler) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.onCircuit = handler
+}
+
+// coolingDownLocked reports whether the circuit of the server with the
+// given pool key is open and its cool-down has not ended. It must be called
+// with p.mutex held.
+func (p *ConnectionPool) coolingDownLocked(key string, now time.Time) bool {
+	c, ok := p.circuits[key]
+	return ok && now.Before(c.openUntil)
+}
+
+// updateCircuitLocked opens the circuit of a server whose transports all
+// have a health score at or below unhealthyScore, restarting the cool-down
+// if it was already open, and closes it once one of them is healthy. It
+// must be called with p.mutex held, and returns the report to send once the
+// lock is released, or nil when the circuit did not change.
+func (p *ConnectionPool) updateCircuitLocked(key string) func() {
+	transports := p.transports[key]
+	if len(transports) == 0 {
+		return nil
+	}
+
+	healthy := false
+	for _, pooled := range transports {
+		if pooled.healthScore > unhealthyScore {
+			healthy = true
+			break
+		}
+	}
+
+	c, open := p.circuits[key]
+	switch {
+	case !healthy:
+		p.circuits[key] = &circuit{server: transports[0].server, openUntil: time.Now().Add(p.coolDown)}
+		if open {
+			return nil
+		}
+		p.circuitTrips++
+		return p.circuitReport(transports[0].server, true)
+	case open:
+		delete(p.circuits, key)
+		return p.circuitReport(c.server, false)
+	default:
+		return nil
+	}
+}
+
+// circuitReport returns a call to the circuit handler, if there is one
+func (p *ConnectionPool) circuitReport(server string, open bool) func() {
+	handler := p.onCircuit
+	if handler == nil {
+		return nil
+	}
+	return func() { handler(server, open) }
+}
+
+// report runs circuit reports collected under the lock
+func report(reports ...func()) {
+	for _, r := range reports {
+		if r != nil {
+			r()
+		}
+	}
+}
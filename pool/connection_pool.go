@@ -2,7 +2,11 @@ package pool
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"slices"
 	"sync"
 	"time"
 
@@ -11,105 +15,269 @@ import (
 
 // PooledTransport wraps a transport with pool-specific metadata
 type PooledTransport struct {
-	transport    transport.Transport
+	transport     transport.Transport
+	transportType string
+	server        string
 	lastUsed     time.Time
 	createdAt    time.Time
 	lastError    error
 	healthScore  float64 // 0.0 to 1.0
 	requestCount int
+	lease        *Lease // Holder of the transport, nil while it is idle
 }
 
-// ConnectionPool manages a pool of transport connections
+// leased reports whether someone holds the transport
+func (pooled *PooledTransport) leased() bool {
+	return pooled.lease != nil
+}
+
+// ConnectionPool manages a pool of transport connections. Transports are
+// pooled per server, keyed by its name and a hash of its config, so a
+// transport is only ever handed out for the server it was created for.
 type ConnectionPool struct {
-	transports map[string][]*PooledTransport
+	transports map[string][]*PooledTransport // By poolKey
 	factory    *transport.Factory
 	mutex      sync.RWMutex
 
 	// Pool configuration
-	maxPerType      int
-	maxIdleTime     time.Duration
-	healthCheckFreq time.Duration
+	maxPerType         int
+	maxIdleTime        time.Duration
+	healthCheckFreq    time.Duration
+	healthCheckTimeout time.Duration
+	maxWait            time.Duration // How long GetTransport waits for a transport once the pool is exhausted
+	maxLifetime        time.Duration // How long a transport lives before it is closed once idle; zero is forever
+	evictionPolicy     EvictionPolicy
+	coolDown           time.Duration // How long an open circuit refuses acquisitions
+
+	circuits     map[string]*circuit // Open circuits by poolKey
+	onCircuit    CircuitHandler
+	circuitTrips int64 // Times a circuit opened
+
+	released chan struct{} // Closed, and replaced, whenever a transport is returned or dropped
+
+	// Waiting for a transport, as reported by Stats
+	waits        int64         // GetTransport calls that had to wait
+	waitTime     time.Duration // Total time spent waiting
+	waitTimeouts int64         // Waits that ended without a transport
+
+	evictions int64 // Transports closed to make room, or for outliving maxLifetime
+
+	stopHealthCheck chan struct{} // Closed by Close to stop the health check loop, nil while it is not running
 }
 
-// NewConnectionPool creates a new connection pool
+// DefaultMaxWait is how long GetTransport waits for a transport to be returned
+// when the pool is exhausted, unless changed with SetMaxWait
+const DefaultMaxWait = 5 * time.Second
+
+// unhealthyScore is the health score at or below which a transport is not
+// handed out
+const unhealthyScore = 0.5
+
+// evictHealthScore is the health score at or below which the health check
+// loop closes a transport
+const evictHealthScore = 0.25
+
+// NewConnectionPool creates a new connection pool holding up to maxPerType
+// transports for each server
 func NewConnectionPool(maxPerType int, maxIdleTime time.Duration) *ConnectionPool {
 	return &ConnectionPool{
 		transports:      make(map[string][]*PooledTransport),
 		factory:         transport.NewFactory(),
 		maxPerType:      maxPerType,
 		maxIdleTime:     maxIdleTime,
-		healthCheckFreq: 30 * time.Second,
+		healthCheckFreq:    30 * time.Second,
+		healthCheckTimeout: 5 * time.Second,
+		maxWait:            DefaultMaxWait,
+		evictionPolicy:     EvictLRU,
+		coolDown:           DefaultCoolDown,
+		circuits:           make(map[string]*circuit),
+		released:           make(chan struct{}),
 	}
 }
 
-// GetTransport returns an available transport from the pool or creates a new one
-func (p *ConnectionPool) GetTransport(ctx context.Context, transportType string, config map[string]interface{}) (transport.Transport, error) {
-	p.mutex.Lock()
-	defer p.mutex.Unlock()
+// GetTransport leases an available transport from the pool or creates a new
+// one. A transport is available while no one holds a lease on it; every lease
+// must be released once the transport is no longer used. A new transport is
+// not yet connected. When the server already has maxPerType transports in use,
+// GetTransport waits up to maxWait, or until ctx is done, for one to be
+// returned. While the server's circuit is open it fails at once with
+// ErrCircuitOpen.
+func (p *ConnectionPool) GetTransport(ctx context.Context, transportType string, config map[string]interface{}) (*Lease, error) {
+	key, err := poolKey(transportType, config)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	waited := false
+	for {
+		p.mutex.Lock()
+		lease, err := p.acquireLocked(key, transportType, config)
+		if lease != nil || err != nil {
+			if waited {
+				p.recordWaitLocked(start, true)
+			}
+			p.mutex.Unlock()
+			return lease, err
+		}
 
-	key := transportType
-	transports := p.transports[key]
-
-	// Try to find a healthy, available transport
-	for i, pooled := range transports {
-		if pooled.transport.IsConnected() && pooled.healthScore > 0.5 {
-			pooled.lastUsed = time.Now()
-			pooled.requestCount++
-			return pooled.transport, nil
-		} else if !pooled.transport.IsConnected() {
-			// Remove disconnected transport
-			p.transports[key] = append(transports[:i], transports[i+1:]...)
+		remaining := p.maxWait - time.Since(start)
+		if remaining <= 0 {
+			if waited {
+				p.recordWaitLocked(start, false)
+			}
+			p.mutex.Unlock()
+			return nil, fmt.Errorf("connection pool exhausted for server %s", serverName(transportType, config))
+		}
+		released := p.released
+		p.mutex.Unlock()
+
+		waited = true
+		timer := time.NewTimer(remaining)
+		select {
+		case <-released:
+			timer.Stop()
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			p.mutex.Lock()
+			p.recordWaitLocked(start, false)
+			p.mutex.Unlock()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// acquireLocked leases an idle, healthy transport of the server, or a new
+// one while it has fewer than maxPerType, and otherwise returns nil. It must
+// be called with p.mutex held.
+func (p *ConnectionPool) acquireLocked(key, transportType string, config map[string]interface{}) (*Lease, error) {
+	// Hand out nothing while the server's transports are all unhealthy
+	now := time.Now()
+	if p.coolingDownLocked(key, now) {
+		return nil, fmt.Errorf("%w for server %s", ErrCircuitOpen, serverName(transportType, config))
+	}
+
+	// Try to find a healthy, available transport, dropping those that lost
+	// their connection while nobody had them or outlived maxLifetime
+	var kept []*PooledTransport
+	var available *PooledTransport
+	for _, pooled := range p.transports[key] {
+		if !pooled.leased() && !pooled.transport.IsConnected() {
+			continue
+		}
+		if !pooled.leased() && p.expired(pooled, now) {
+			p.evictions++
+			disconnectLater(pooled.transport)
 			continue
 		}
+		if available == nil && !pooled.leased() && pooled.healthScore > unhealthyScore {
+			available = pooled
+		}
+		kept = append(kept, pooled)
+	}
+	p.transports[key] = kept
+
+	if available != nil {
+		available.lastUsed = time.Now()
+		available.requestCount++
+		return p.leaseLocked(key, available), nil
+	}
+
+	// Make room in a full pool whose idle transports are all too unhealthy
+	// to hand out
+	if len(kept) >= p.maxPerType {
+		if victim := p.victim(kept); victim != nil {
+			kept = slices.DeleteFunc(kept, func(pooled *PooledTransport) bool { return pooled == victim })
+			p.transports[key] = kept
+			p.evictions++
+			disconnectLater(victim.transport)
+		}
 	}
 
 	// Create new transport if pool is not full
-	if len(transports) < p.maxPerType {
+	if len(kept) < p.maxPerType {
 		t, err := p.factory.Create(transportType, config)
 		if err != nil {
 			return nil, err
 		}
 
 		pooled := &PooledTransport{
-			transport:   t,
-			createdAt:   time.Now(),
-			lastUsed:    time.Now(),
-			healthScore: 1.0,
+			transport:     t,
+			transportType: transportType,
+			server:        serverName(transportType, config),
+			createdAt:     time.Now(),
+			lastUsed:      time.Now(),
+			healthScore:   1.0,
+			requestCount:  1,
 		}
 
 		p.transports[key] = append(p.transports[key], pooled)
-		return t, nil
+		p.startHealthCheckLocked()
+		return p.leaseLocked(key, pooled), nil
 	}
 
-	return nil, fmt.Errorf("connection pool exhausted for transport type %s", transportType)
+	return nil, nil
+}
+
+// recordWaitLocked counts a wait for a transport that began at start and
+// whether it ended with one. It must be called with p.mutex held.
+func (p *ConnectionPool) recordWaitLocked(start time.Time, acquired bool) {
+	p.waits++
+	p.waitTime += time.Since(start)
+	if !acquired {
+		p.waitTimeouts++
+	}
 }
 
-// ReturnTransport marks a transport as available for reuse
-func (p *ConnectionPool) ReturnTransport(t transport.Transport, err error) {
+// SetMaxWait sets how long GetTransport waits for a transport to be returned
+// when the pool is exhausted; zero fails at once
+func (p *ConnectionPool) SetMaxWait(maxWait time.Duration) {
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
+	p.maxWait = maxWait
+}
 
-	// Update health score based on error
-	for _, transports := range p.transports {
-		for _, pooled := range transports {
-			if pooled.transport == t {
-				if err != nil {
-					pooled.healthScore *= 0.9 // Reduce health on error
-					pooled.lastError = err
-				} else {
-					pooled.healthScore = (pooled.healthScore + 1.0) / 2.0 // Improve health
-				}
-				return
-			}
-		}
+// releaseLocked wakes the callers of GetTransport waiting for a transport.
+// It must be called with p.mutex held whenever a transport is returned or
+// dropped.
+func (p *ConnectionPool) releaseLocked() {
+	close(p.released)
+	p.released = make(chan struct{})
+}
+
+// poolKey identifies the server a transport config is for: its name and a
+// hash of the whole config, so two servers with the same name but different
+// settings, such as before and after a config reload, never share transports
+func poolKey(transportType string, config map[string]interface{}) (string, error) {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash transport config: %w", err)
+	}
+	sum := sha256.Sum256(append([]byte(transportType+"\x00"), data...))
+	return serverName(transportType, config) + "#" + hex.EncodeToString(sum[:8]), nil
+}
+
+// serverName returns the name in a transport config, or the transport type
+// for a config without one
+func serverName(transportType string, config map[string]interface{}) string {
+	if name, ok := config["name"].(string); ok && name != "" {
+		return name
 	}
+	return transportType
 }
 
-// Close closes all connections in the pool
+// Close closes all connections in the pool and closes their circuits, without
+// telling the circuit handler
 func (p *ConnectionPool) Close(ctx context.Context) error {
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
 
+	if p.stopHealthCheck != nil {
+		close(p.stopHealthCheck)
+		p.stopHealthCheck = nil
+	}
+
 	var lastErr error
 	for _, transports := range p.transports {
 		for _, pooled := range transports {
@@ -120,10 +288,13 @@ func (p *ConnectionPool) Close(ctx context.Context) error {
 	}
 
 	p.transports = make(map[string][]*PooledTransport)
+	clear(p.circuits)
+	p.releaseLocked()
 	return lastErr
 }
 
-// CleanIdleConnections removes idle connections from the pool
+// CleanIdleConnections removes connections idle for longer than maxIdleTime,
+// and idle ones that have outlived maxLifetime, from the pool
 func (p *ConnectionPool) CleanIdleConnections(ctx context.Context) error {
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
@@ -135,7 +306,11 @@ func (p *ConnectionPool) CleanIdleConnections(ctx context.Context) error {
 		var active []*PooledTransport
 
 		for _, pooled := range transports {
-			if now.Sub(pooled.lastUsed) > p.maxIdleTime {
+			expired := p.expired(pooled, now)
+			if !pooled.leased() && (now.Sub(pooled.lastUsed) > p.maxIdleTime || expired) {
+				if expired {
+					p.evictions++
+				}
 				if err := pooled.transport.Disconnect(ctx); err != nil {
 					lastErr = err
 				}
@@ -146,6 +321,7 @@ func (p *ConnectionPool) CleanIdleConnections(ctx context.Context) error {
 
 		p.transports[key] = active
 	}
+	p.releaseLocked()
 
 	return lastErr
 }
@@ -158,23 +334,37 @@ func (p *ConnectionPool) Stats() map[string]interface{} {
 	totalCount := 0
 	connectedCount := 0
 	typeStats := make(map[string]map[string]interface{})
+	serverStats := make(map[string]map[string]interface{})
 
-	for transportType, transports := range p.transports {
-		typeCount := len(transports)
-		typeConnected := 0
-
+	now := time.Now()
+	for _, transports := range p.transports {
 		for _, pooled := range transports {
+			connected := pooled.transport.IsConnected()
 			totalCount++
-			if pooled.transport.IsConnected() {
+			if connected {
 				connectedCount++
-				typeConnected++
 			}
-		}
+			countTransport(typeStats, pooled.transportType, pooled, connected)
+			entry := countTransport(serverStats, pooled.server, pooled, connected)
 
-		typeStats[transportType] = map[string]interface{}{
-			"total":      typeCount,
-			"connected":  typeConnected,
-			"available":  p.maxPerType - typeCount,
+			connections, _ := entry["connections"].([]map[string]interface{})
+			entry["connections"] = append(connections, map[string]interface{}{
+				"connected":    connected,
+				"in_use":       pooled.leased(),
+				"health_score": pooled.healthScore,
+				"requests":     pooled.requestCount,
+				"age":          now.Sub(pooled.createdAt).Round(time.Second).String(),
+				"idle":         now.Sub(pooled.lastUsed).Round(time.Second).String(),
+			})
+		}
+	}
+	for _, entry := range serverStats {
+		entry["available"] = max(p.maxPerType-entry["total"].(int), 0)
+	}
+	openCircuits := []string{}
+	for key, c := range p.circuits {
+		if p.coolingDownLocked(key, now) {
+			openCircuits = append(openCircuits, c.server)
 		}
 	}
 
@@ -183,7 +373,35 @@ func (p *ConnectionPool) Stats() map[string]interface{} {
 		"connected":          connectedCount,
 		"disconnected":       totalCount - connectedCount,
 		"by_type":            typeStats,
+		"by_server":          serverStats,
 		"max_per_type":       p.maxPerType,
 		"max_idle_duration":  p.maxIdleTime.String(),
+		"waits":              p.waits,
+		"wait_time":          p.waitTime.String(),
+		"wait_timeouts":      p.waitTimeouts,
+		"eviction_policy":    string(p.evictionPolicy),
+		"max_lifetime":       p.maxLifetime.String(),
+		"evictions":          p.evictions,
+		"circuit_trips":      p.circuitTrips,
+		"open_circuits":      openCircuits,
+	}
+}
+
+// countTransport adds a transport to the totals of name in stats and
+// returns its entry
+func countTransport(stats map[string]map[string]interface{}, name string, pooled *PooledTransport, connected bool) map[string]interface{} {
+	entry, ok := stats[name]
+	if !ok {
+		entry = map[string]interface{}{"total": 0, "connected": 0, "in_use": 0, "requests": 0}
+		stats[name] = entry
+	}
+	entry["total"] = entry["total"].(int) + 1
+	entry["requests"] = entry["requests"].(int) + pooled.requestCount
+	if connected {
+		entry["connected"] = entry["connected"].(int) + 1
+	}
+	if pooled.leased() {
+		entry["in_use"] = entry["in_use"].(int) + 1
 	}
+	return entry
 }
@@ -2,8 +2,15 @@ package pool
 
 import (
 	"context"
+	"errors"
+	"runtime"
+	"slices"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/j4ng5y/mcpgate/internal/mcptest"
+	"github.com/j4ng5y/mcpgate/transport"
 )
 
 func TestConnectionPool_NewConnectionPool(t *testing.T) {
@@ -112,6 +119,7 @@ func TestConnectionPool_Stats_Structure(t *testing.T) {
 		"connected",
 		"disconnected",
 		"by_type",
+		"by_server",
 		"max_per_type",
 		"max_idle_duration",
 	}
@@ -166,14 +174,16 @@ func TestConnectionPool_TransportMap_Empty(t *testing.T) {
 	}
 }
 
-func TestConnectionPool_ReturnTransport_NoOp(t *testing.T) {
+func TestConnectionPool_Release_NilLease(t *testing.T) {
 	pool := NewConnectionPool(5, 60*time.Second)
 	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
 	defer cancel()
 
-	// Try to return a transport that's not in the pool
-	// This should not panic or error
-	pool.ReturnTransport(nil, nil)
+	// Releasing a nil lease should not panic or error
+	var lease *Lease
+	if err := lease.Release(nil); err != nil {
+		t.Fatalf("Expected releasing a nil lease to do nothing, got %v", err)
+	}
 
 	err := pool.Close(ctx)
 	if err != nil {
@@ -225,3 +235,397 @@ func TestConnectionPool_DefaultHealthScore(t *testing.T) {
 		t.Error("Pool configuration incorrect")
 	}
 }
+
+func TestConnectionPool_CheckHealth(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh and sleep")
+	}
+
+	pool := NewConnectionPool(3, 60*time.Second)
+	pool.healthCheckTimeout = 100 * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	defer func() { _ = pool.Close(ctx) }()
+
+	// An echo answers pings, sleep never does and true exits straight away
+	commands := map[string][]string{
+		"echo":  append([]string{mcptest.EchoCommand}, mcptest.EchoArgs()...),
+		"sleep": {"sleep", "60"},
+		"true":  {"true"},
+	}
+	transports := make(map[string]transport.Transport)
+	var leases []*Lease
+	for name, command := range commands {
+		lease, err := pool.GetTransport(ctx, "stdio", map[string]interface{}{
+			"name":    name,
+			"command": command[0],
+			"args":    command[1:],
+		})
+		if err != nil {
+			t.Fatalf("GetTransport failed: %v", err)
+		}
+		tr := lease.Transport()
+		if err := tr.Connect(ctx); err != nil {
+			t.Fatalf("Connect %s failed: %v", name, err)
+		}
+		transports[name] = tr
+		leases = append(leases, lease)
+	}
+	for _, lease := range leases {
+		_ = lease.Release(nil)
+	}
+	if pool.stopHealthCheck == nil {
+		t.Fatal("Expected the health check loop to be running")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for transports["true"].IsConnected() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The first check halves sleep's score, the second evicts it
+	pool.CheckHealth(ctx)
+	pool.CheckHealth(ctx)
+
+	if stats := pool.Stats(); stats["total_transports"] != 1 {
+		t.Fatalf("Expected only the echo left, got %v", stats["total_transports"])
+	}
+	if !transports["echo"].IsConnected() {
+		t.Error("Expected the echo to stay connected")
+	}
+	if transports["sleep"].IsConnected() {
+		t.Error("Expected the unresponsive transport to be disconnected")
+	}
+
+	if err := pool.Close(ctx); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if pool.stopHealthCheck != nil {
+		t.Error("Expected Close to stop the health check loop")
+	}
+}
+
+func TestConnectionPool_KeyedByServer(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+
+	pool := NewConnectionPool(1, 60*time.Second)
+	pool.SetMaxWait(0)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	defer func() { _ = pool.Close(ctx) }()
+
+	get := func(config map[string]interface{}) *Lease {
+		t.Helper()
+		lease, err := pool.GetTransport(ctx, "stdio", config)
+		if err != nil {
+			t.Fatalf("GetTransport %v failed: %v", config, err)
+		}
+		if tr := lease.Transport(); !tr.IsConnected() {
+			if err := tr.Connect(ctx); err != nil {
+				t.Fatalf("Connect failed: %v", err)
+			}
+		}
+		return lease
+	}
+
+	a := get(map[string]interface{}{"name": "a", "command": mcptest.EchoCommand, "args": mcptest.EchoArgs()})
+	b := get(map[string]interface{}{"name": "b", "command": mcptest.EchoCommand, "args": mcptest.EchoArgs()})
+	if a.Transport() == b.Transport() {
+		t.Fatal("Expected servers a and b to get their own transports")
+	}
+	if _, err := pool.GetTransport(ctx, "stdio", map[string]interface{}{"name": "a", "command": mcptest.EchoCommand, "args": mcptest.EchoArgs()}); err == nil {
+		t.Error("Expected a's pool of one to be exhausted")
+	}
+
+	_ = a.Release(nil)
+	_ = b.Release(nil)
+	again := get(map[string]interface{}{"name": "a", "command": mcptest.EchoCommand, "args": mcptest.EchoArgs()})
+	if again.Transport() != a.Transport() {
+		t.Error("Expected a's transport to be reused for a")
+	}
+	_ = again.Release(nil)
+
+	// Same name, different config: a reloaded server must not reuse the old transport
+	changed := get(map[string]interface{}{"name": "a", "command": mcptest.EchoCommand, "args": append(mcptest.EchoArgs(), "-")})
+	if changed.Transport() == a.Transport() {
+		t.Error("Expected a changed config to get a new transport")
+	}
+	_ = changed.Release(nil)
+
+	byServer := pool.Stats()["by_server"].(map[string]map[string]interface{})
+	if total := byServer["a"]["total"]; total != 2 {
+		t.Errorf("Expected 2 transports for a, got %v", total)
+	}
+	if total := byServer["b"]["total"]; total != 1 {
+		t.Errorf("Expected 1 transport for b, got %v", total)
+	}
+}
+
+func TestConnectionPool_WaitsForReturn(t *testing.T) {
+	pool := NewConnectionPool(1, 60*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	defer func() { _ = pool.Close(ctx) }()
+	config := map[string]interface{}{"name": "a", "command": mcptest.EchoCommand, "args": mcptest.EchoArgs()}
+
+	held, err := pool.GetTransport(ctx, "stdio", config)
+	if err != nil {
+		t.Fatalf("GetTransport failed: %v", err)
+	}
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		_ = held.Release(nil)
+	}()
+
+	start := time.Now()
+	next, err := pool.GetTransport(ctx, "stdio", config)
+	if err != nil {
+		t.Fatalf("Expected to get the returned transport, got %v", err)
+	}
+	if waited := time.Since(start); waited < 100*time.Millisecond {
+		t.Errorf("Expected to wait for the transport to be returned, waited %s", waited)
+	}
+
+	// Nothing is returned this time, so the wait runs out
+	pool.SetMaxWait(50 * time.Millisecond)
+	if _, err := pool.GetTransport(ctx, "stdio", config); err == nil {
+		t.Error("Expected the pool to be exhausted after waiting")
+	}
+
+	// A done context ends the wait early
+	pool.SetMaxWait(time.Minute)
+	canceled, cancelWait := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancelWait()
+	if _, err := pool.GetTransport(canceled, "stdio", config); err != context.DeadlineExceeded {
+		t.Errorf("Expected the context's error, got %v", err)
+	}
+	_ = next.Release(nil)
+
+	stats := pool.Stats()
+	if stats["waits"] != int64(3) || stats["wait_timeouts"] != int64(2) {
+		t.Errorf("Expected 3 waits, 2 without a transport, got %v and %v", stats["waits"], stats["wait_timeouts"])
+	}
+}
+
+func TestConnectionPool_EvictionPolicy(t *testing.T) {
+	now := time.Now()
+	old := &PooledTransport{createdAt: now.Add(-time.Hour), lastUsed: now, healthScore: 0.4}
+	stale := &PooledTransport{createdAt: now, lastUsed: now.Add(-time.Hour), healthScore: 0.5}
+	sick := &PooledTransport{createdAt: now, lastUsed: now, healthScore: 0.1}
+	busy := &PooledTransport{createdAt: now.Add(-2 * time.Hour), lastUsed: now.Add(-2 * time.Hour), healthScore: 0, lease: &Lease{}}
+	transports := []*PooledTransport{busy, old, stale, sick}
+
+	tests := []struct {
+		policy   string
+		expected *PooledTransport
+	}{
+		{"", stale},
+		{"lru", stale},
+		{"least_healthy", sick},
+		{"oldest", old},
+	}
+	for _, tt := range tests {
+		policy, err := ParseEvictionPolicy(tt.policy)
+		if err != nil {
+			t.Fatalf("ParseEvictionPolicy(%q) failed: %v", tt.policy, err)
+		}
+		pool := NewConnectionPool(4, time.Minute)
+		pool.SetEvictionPolicy(policy)
+		if victim := pool.victim(transports); victim != tt.expected {
+			t.Errorf("Policy %q evicted the wrong transport: %+v", tt.policy, victim)
+		}
+	}
+
+	if _, err := ParseEvictionPolicy("random"); err == nil {
+		t.Error("Expected error for an unknown policy")
+	}
+}
+
+func TestConnectionPool_EvictsToMakeRoom(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+
+	pool := NewConnectionPool(1, 60*time.Second)
+	pool.SetMaxWait(0)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	defer func() { _ = pool.Close(ctx) }()
+	config := map[string]interface{}{"name": "a", "command": mcptest.EchoCommand, "args": mcptest.EchoArgs()}
+
+	first, err := pool.GetTransport(ctx, "stdio", config)
+	if err != nil {
+		t.Fatalf("GetTransport failed: %v", err)
+	}
+	if err := first.Transport().Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	_ = first.Release(errors.New("failed"))
+	// Too unhealthy to hand out
+	pool.transports[mustPoolKey(t, config)][0].healthScore = 0.3
+
+	second, err := pool.GetTransport(ctx, "stdio", config)
+	if err != nil {
+		t.Fatalf("Expected the unhealthy transport to make room, got %v", err)
+	}
+	if second.Transport() == first.Transport() {
+		t.Error("Expected a new transport in place of the unhealthy one")
+	}
+	if evictions := pool.Stats()["evictions"]; evictions != int64(1) {
+		t.Errorf("Expected 1 eviction, got %v", evictions)
+	}
+	_ = second.Release(nil)
+}
+
+func TestConnectionPool_MaxLifetime(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+
+	pool := NewConnectionPool(2, 60*time.Second)
+	pool.SetMaxLifetime(50 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	defer func() { _ = pool.Close(ctx) }()
+
+	lease, err := pool.GetTransport(ctx, "stdio", map[string]interface{}{"name": "a", "command": mcptest.EchoCommand, "args": mcptest.EchoArgs()})
+	if err != nil {
+		t.Fatalf("GetTransport failed: %v", err)
+	}
+	tr := lease.Transport()
+	if err := tr.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+
+	// Busy past its lifetime, it is only closed once returned
+	time.Sleep(100 * time.Millisecond)
+	if !tr.IsConnected() {
+		t.Fatal("Expected a transport in use to stay connected")
+	}
+	_ = lease.Release(nil)
+
+	stats := pool.Stats()
+	if stats["total_transports"] != 0 || stats["evictions"] != int64(1) {
+		t.Errorf("Expected the expired transport evicted, got %v left and %v evictions", stats["total_transports"], stats["evictions"])
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for tr.IsConnected() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if tr.IsConnected() {
+		t.Error("Expected the expired transport to be disconnected")
+	}
+}
+
+// mustPoolKey returns the pool key of a stdio config
+func mustPoolKey(t *testing.T, config map[string]interface{}) string {
+	t.Helper()
+	key, err := poolKey("stdio", config)
+	if err != nil {
+		t.Fatalf("poolKey failed: %v", err)
+	}
+	return key
+}
+
+func TestConnectionPool_LeaseIsExclusive(t *testing.T) {
+	pool := NewConnectionPool(2, 60*time.Second)
+	pool.SetMaxWait(0)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	defer func() { _ = pool.Close(ctx) }()
+	config := map[string]interface{}{"name": "a", "command": mcptest.EchoCommand, "args": mcptest.EchoArgs()}
+
+	first, err := pool.GetTransport(ctx, "stdio", config)
+	if err != nil {
+		t.Fatalf("GetTransport failed: %v", err)
+	}
+	second, err := pool.GetTransport(ctx, "stdio", config)
+	if err != nil {
+		t.Fatalf("GetTransport failed: %v", err)
+	}
+	if first.Transport() == second.Transport() {
+		t.Fatal("Expected two leases to hold different transports")
+	}
+
+	if err := first.Release(nil); err != nil {
+		t.Fatalf("Release failed: %v", err)
+	}
+	if err := first.Release(nil); err != ErrLeaseReleased {
+		t.Errorf("Expected releasing twice to fail with ErrLeaseReleased, got %v", err)
+	}
+	if err := second.Release(nil); err != nil {
+		t.Fatalf("Release failed: %v", err)
+	}
+}
+
+func TestConnectionPool_CircuitBreaking(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+
+	pool := NewConnectionPool(1, 60*time.Second)
+	pool.SetMaxWait(0)
+	pool.SetCoolDown(50 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	defer func() { _ = pool.Close(ctx) }()
+	config := map[string]interface{}{"name": "a", "command": mcptest.EchoCommand, "args": mcptest.EchoArgs()}
+
+	var mu sync.Mutex
+	var reports []bool
+	pool.SetCircuitHandler(func(server string, open bool) {
+		if server != "a" {
+			t.Errorf("Expected reports for server a, got %q", server)
+		}
+		mu.Lock()
+		reports = append(reports, open)
+		mu.Unlock()
+	})
+
+	// Fail requests until the only transport is too unhealthy to hand out
+	for i := 0; ; i++ {
+		lease, err := pool.GetTransport(ctx, "stdio", config)
+		if errors.Is(err, ErrCircuitOpen) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("GetTransport failed: %v", err)
+		}
+		if i == 0 {
+			if err := lease.Transport().Connect(ctx); err != nil {
+				t.Fatalf("Connect failed: %v", err)
+			}
+		}
+		if i > 10 {
+			t.Fatal("Expected the circuit to open")
+		}
+		_ = lease.Release(errors.New("request failed"))
+	}
+
+	stats := pool.Stats()
+	if stats["circuit_trips"] != int64(1) {
+		t.Errorf("Expected one circuit trip, got %v", stats["circuit_trips"])
+	}
+	if open, _ := stats["open_circuits"].([]string); !slices.Equal(open, []string{"a"}) {
+		t.Errorf("Expected server a's circuit to be open, got %v", stats["open_circuits"])
+	}
+
+	// After the cool-down the unhealthy transport makes room for a new one
+	time.Sleep(100 * time.Millisecond)
+	lease, err := pool.GetTransport(ctx, "stdio", config)
+	if err != nil {
+		t.Fatalf("Expected a transport after the cool-down, got %v", err)
+	}
+	_ = lease.Release(nil)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !slices.Equal(reports, []bool{true, false}) {
+		t.Errorf("Expected the circuit to open and close, got %v", reports)
+	}
+	if open, _ := pool.Stats()["open_circuits"].([]string); len(open) != 0 {
+		t.Errorf("Expected no open circuits, got %v", open)
+	}
+}
@@ -0,0 +1,91 @@
+package pool
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/j4ng5y/mcpgate/transport"
+)
+
+// EvictionPolicy chooses which idle transport is closed to make room for a
+// new one when a server's pool is full
+type EvictionPolicy string
+
+// Eviction policies
+const (
+	EvictLRU          EvictionPolicy = "lru"           // Least recently used first
+	EvictLeastHealthy EvictionPolicy = "least_healthy" // Lowest health score first
+	EvictOldest       EvictionPolicy = "oldest"        // Longest connected first
+)
+
+// ParseEvictionPolicy returns the policy of the given name; an empty name is EvictLRU
+func ParseEvictionPolicy(name string) (EvictionPolicy, error) {
+	switch policy := EvictionPolicy(name); policy {
+	case "":
+		return EvictLRU, nil
+	case EvictLRU, EvictLeastHealthy, EvictOldest:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown eviction policy %q", name)
+	}
+}
+
+// SetEvictionPolicy sets which idle transport is evicted when a server's
+// pool is full and none of its idle transports is healthy enough to hand out
+func (p *ConnectionPool) SetEvictionPolicy(policy EvictionPolicy) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.evictionPolicy = policy
+}
+
+// SetMaxLifetime sets how long a transport may live before it is closed
+// once idle, however healthy and busy it is; zero keeps transports for as
+// long as they are used
+func (p *ConnectionPool) SetMaxLifetime(maxLifetime time.Duration) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.maxLifetime = maxLifetime
+}
+
+// expired reports whether a transport has outlived maxLifetime
+func (p *ConnectionPool) expired(pooled *PooledTransport, now time.Time) bool {
+	return p.maxLifetime > 0 && now.Sub(pooled.createdAt) > p.maxLifetime
+}
+
+// victim returns the idle transport the eviction policy closes first, or
+// nil if all of them are in use
+func (p *ConnectionPool) victim(transports []*PooledTransport) *PooledTransport {
+	var victim *PooledTransport
+	for _, pooled := range transports {
+		if pooled.leased() {
+			continue
+		}
+		if victim == nil || p.evictsBefore(pooled, victim) {
+			victim = pooled
+		}
+	}
+	return victim
+}
+
+// evictsBefore reports whether the eviction policy closes a before b
+func (p *ConnectionPool) evictsBefore(a, b *PooledTransport) bool {
+	switch p.evictionPolicy {
+	case EvictLeastHealthy:
+		return a.healthScore < b.healthScore
+	case EvictOldest:
+		return a.createdAt.Before(b.createdAt)
+	default:
+		return a.lastUsed.Before(b.lastUsed)
+	}
+}
+
+// disconnectLater disconnects a transport dropped from the pool in the
+// background, so the pool's lock is not held while it shuts down
+func disconnectLater(t transport.Transport) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = t.Disconnect(ctx)
+	}()
+}
@@ -0,0 +1,117 @@
+package pool
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/j4ng5y/mcpgate/logging"
+)
+
+// startHealthCheckLocked starts the health check loop unless it is already
+// running. It must be called with p.mutex held.
+func (p *ConnectionPool) startHealthCheckLocked() {
+	if p.stopHealthCheck != nil || p.healthCheckFreq <= 0 {
+		return
+	}
+	p.stopHealthCheck = make(chan struct{})
+	go p.healthCheckLoop(p.stopHealthCheck)
+}
+
+// healthCheckLoop checks the pooled transports every healthCheckFreq until
+// stop is closed
+func (p *ConnectionPool) healthCheckLoop(stop <-chan struct{}) {
+	ticker := time.NewTicker(p.healthCheckFreq)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.CheckHealth(context.Background())
+		case <-stop:
+			return
+		}
+	}
+}
+
+// CheckHealth pings every idle transport and adjusts its health score: an
+// answer, even an error from a server that does not implement ping, raises
+// it and a missing answer halves it, which may open or close the server's
+// circuit. Transports that lost their connection
+// or whose score fell to evictHealthScore are disconnected and dropped.
+// Transports that are in use are left alone, as their requests already
+// update their score.
+func (p *ConnectionPool) CheckHealth(ctx context.Context) {
+	p.mutex.Lock()
+	var idle []*Lease
+	for key, transports := range p.transports {
+		for _, pooled := range transports {
+			if !pooled.leased() {
+				// Hold the transport so it is not handed out mid-ping
+				idle = append(idle, p.leaseLocked(key, pooled))
+			}
+		}
+	}
+	p.mutex.Unlock()
+
+	for _, lease := range idle {
+		pooled := lease.pooled
+		err := p.ping(ctx, pooled)
+
+		p.mutex.Lock()
+		pooled.lease = nil
+		if err != nil {
+			pooled.healthScore /= 2
+			pooled.lastError = err
+		} else {
+			pooled.healthScore = (pooled.healthScore + 1.0) / 2.0
+		}
+		circuitChanged := p.updateCircuitLocked(lease.key)
+		p.releaseLocked()
+		p.mutex.Unlock()
+		report(circuitChanged)
+	}
+
+	p.evictDead(ctx)
+}
+
+// ping sends a ping over a connected transport
+func (p *ConnectionPool) ping(ctx context.Context, pooled *PooledTransport) error {
+	if !pooled.transport.IsConnected() {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.healthCheckTimeout)
+	defer cancel()
+	_, err := pooled.transport.SendRequest(ctx, map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      "mcpgate-pool-health",
+		"method":  "ping",
+	})
+	return err
+}
+
+// evictDead disconnects and drops the idle transports that lost their
+// connection or whose health score fell to evictHealthScore
+func (p *ConnectionPool) evictDead(ctx context.Context) {
+	p.mutex.Lock()
+	var dead []*PooledTransport
+	for key, transports := range p.transports {
+		p.transports[key] = slices.DeleteFunc(transports, func(pooled *PooledTransport) bool {
+			if pooled.leased() || (pooled.transport.IsConnected() && pooled.healthScore > evictHealthScore) {
+				return false
+			}
+			dead = append(dead, pooled)
+			return true
+		})
+	}
+	p.releaseLocked()
+	p.mutex.Unlock()
+
+	for _, pooled := range dead {
+		if err := pooled.transport.Disconnect(ctx); err != nil {
+			slog.Warn("Error closing unhealthy pooled transport", logging.Err(err))
+		}
+	}
+}
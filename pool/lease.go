@@ -0,0 +1,82 @@
+package pool
+
+import (
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/j4ng5y/mcpgate/transport"
+)
+
+// ErrLeaseReleased is returned when a lease is released more than once
+var ErrLeaseReleased = errors.New("lease already released")
+
+// Lease grants its holder exclusive use of a pooled transport until it is
+// released. The pool hands the transport to no one else meanwhile, and only
+// the current lease can give it back.
+type Lease struct {
+	pool   *ConnectionPool
+	key    string
+	pooled *PooledTransport
+}
+
+// leaseLocked leases a transport of the server with the given pool key. It
+// must be called with p.mutex held, on a transport nobody holds.
+func (p *ConnectionPool) leaseLocked(key string, pooled *PooledTransport) *Lease {
+	lease := &Lease{pool: p, key: key, pooled: pooled}
+	pooled.lease = lease
+	return lease
+}
+
+// Transport returns the leased transport. It must not be used once the
+// lease is released.
+func (l *Lease) Transport() transport.Transport {
+	return l.pooled.transport
+}
+
+// Release gives the transport back to the pool for reuse, err being the
+// outcome of using it, which adjusts its health score and may open or close
+// the server's circuit. A transport that outlived the pool's max lifetime,
+// or that the pool dropped meanwhile, is disconnected instead. Releasing a nil lease does nothing; releasing one
+// twice fails with ErrLeaseReleased.
+func (l *Lease) Release(err error) error {
+	if l == nil {
+		return nil
+	}
+
+	p := l.pool
+	p.mutex.Lock()
+
+	pooled := l.pooled
+	if pooled.lease != l {
+		p.mutex.Unlock()
+		return ErrLeaseReleased
+	}
+	pooled.lease = nil
+
+	if err != nil {
+		pooled.healthScore *= 0.9 // Reduce health on error
+		pooled.lastError = err
+	} else {
+		pooled.healthScore = (pooled.healthScore + 1.0) / 2.0 // Improve health
+	}
+
+	var circuitChanged func()
+	transports := p.transports[l.key]
+	i := slices.Index(transports, pooled)
+	switch {
+	case i < 0:
+		disconnectLater(pooled.transport)
+	case p.expired(pooled, time.Now()):
+		p.transports[l.key] = slices.Delete(transports, i, i+1)
+		p.evictions++
+		disconnectLater(pooled.transport)
+	default:
+		circuitChanged = p.updateCircuitLocked(l.key)
+	}
+	p.releaseLocked()
+	p.mutex.Unlock()
+
+	report(circuitChanged)
+	return nil
+}
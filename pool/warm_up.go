@@ -0,0 +1,72 @@
+package pool
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/j4ng5y/mcpgate/transport"
+)
+
+// WarmUp opens transports for a server until the pool holds n of them, or
+// as many as maxPerType allows, and leaves them idle for GetTransport to
+// hand out. connect connects and initializes each new transport; one that
+// fails is dropped and its error returned.
+func (p *ConnectionPool) WarmUp(ctx context.Context, transportType string, config map[string]interface{}, n int, connect func(context.Context, transport.Transport) error) error {
+	key, err := poolKey(transportType, config)
+	if err != nil {
+		return err
+	}
+
+	for {
+		p.mutex.Lock()
+		if len(p.transports[key]) >= min(n, p.maxPerType) {
+			p.mutex.Unlock()
+			return nil
+		}
+		t, err := p.factory.Create(transportType, config)
+		if err != nil {
+			p.mutex.Unlock()
+			return err
+		}
+		// Held while it connects, so it is not handed out half ready
+		pooled := &PooledTransport{
+			transport:     t,
+			transportType: transportType,
+			server:        serverName(transportType, config),
+			createdAt:     time.Now(),
+			lastUsed:      time.Now(),
+			healthScore:   1.0,
+		}
+		p.transports[key] = append(p.transports[key], pooled)
+		p.leaseLocked(key, pooled)
+		p.startHealthCheckLocked()
+		p.mutex.Unlock()
+
+		if err := connect(ctx, t); err != nil {
+			_ = t.Disconnect(ctx)
+			p.remove(key, pooled)
+			return fmt.Errorf("failed to warm up a pooled connection: %w", err)
+		}
+
+		p.mutex.Lock()
+		pooled.lease = nil
+		p.releaseLocked()
+		p.mutex.Unlock()
+	}
+}
+
+// remove drops a transport from the pool without disconnecting it
+func (p *ConnectionPool) remove(key string, pooled *PooledTransport) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	transports := p.transports[key]
+	for i, candidate := range transports {
+		if candidate == pooled {
+			p.transports[key] = append(transports[:i:i], transports[i+1:]...)
+			p.releaseLocked()
+			return
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package serve
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/j4ng5y/mcpgate/config"
+	"github.com/j4ng5y/mcpgate/mcp"
+)
+
+// APIKeyHeader carries an API key for clients that cannot send it as a
+// bearer token
+const APIKeyHeader = "X-API-Key"
+
+// SetAPIKeys requires every request to present one of keys, from the next
+// Start on. Without keys, requests are not authenticated.
+func (e *endpoint) SetAPIKeys(keys []string) {
+	e.apiKeys = make([][]byte, len(keys))
+	for i, key := range keys {
+		e.apiKeys[i] = []byte(key)
+	}
+}
+
+// authClient is a configured client with its API keys
+type authClient struct {
+	config *config.ClientConfig
+	keys   [][]byte
+}
+
+// SetClients holds the requests of each client to its policy, from the next
+// Start on. A client's API keys are accepted alongside the endpoint's own.
+func (e *endpoint) SetClients(clients []config.ClientConfig) {
+	e.clients = make([]authClient, len(clients))
+	for i := range clients {
+		client := authClient{config: &clients[i]}
+		for _, key := range clients[i].Keys() {
+			client.keys = append(client.keys, []byte(key))
+		}
+		e.clients[i] = client
+	}
+}
+
+// SetOAuth requires every request to present an access token that validator
+// accepts, or one of the API keys, from the next Start on
+func (e *endpoint) SetOAuth(validator *OAuthValidator) {
+	e.oauth = validator
+}
+
+// authenticate rejects requests that present neither a valid API key nor a
+// valid access token with 401, or 403 when the token lacks a required scope.
+// Requests from a configured client carry it on their context for the
+// router to hold them to its policy.
+func (e *endpoint) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		key := requestKey(req)
+		if e.validKey(key) {
+			next.ServeHTTP(w, req)
+			return
+		}
+		if client := e.keyClient(key); client != nil {
+			next.ServeHTTP(w, req.WithContext(mcp.WithClient(req.Context(), client)))
+			return
+		}
+
+		if e.oauth == nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="mcpgate"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		token, hasToken := bearerToken(req)
+		var err error
+		if hasToken {
+			var claims *tokenClaims
+			if claims, err = e.oauth.Validate(req.Context(), token); err == nil {
+				ctx := mcp.WithClient(req.Context(), e.subjectClient(claims))
+				next.ServeHTTP(w, req.WithContext(ctx))
+				return
+			}
+		}
+		w.Header().Set("WWW-Authenticate", e.oauth.challenge(err))
+		if errors.Is(err, errInsufficientScope) {
+			http.Error(w, "insufficient scope", http.StatusForbidden)
+			return
+		}
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	})
+}
+
+// validKey reports whether key is one of the API keys. Every key is
+// compared in constant time so the timing reveals nothing about them.
+func (e *endpoint) validKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	valid := 0
+	for _, apiKey := range e.apiKeys {
+		valid |= subtle.ConstantTimeCompare([]byte(key), apiKey)
+	}
+	return valid == 1
+}
+
+// keyClient returns the client key belongs to, or nil. Like validKey, it
+// compares every key in constant time.
+func (e *endpoint) keyClient(key string) *config.ClientConfig {
+	if key == "" {
+		return nil
+	}
+	var found *config.ClientConfig
+	for _, client := range e.clients {
+		for _, clientKey := range client.keys {
+			if subtle.ConstantTimeCompare([]byte(key), clientKey) == 1 && found == nil {
+				found = client.config
+			}
+		}
+	}
+	return found
+}
+
+// subjectClient returns the client whose subjects name the token's sub or
+// client_id claim, or nil
+func (e *endpoint) subjectClient(claims *tokenClaims) *config.ClientConfig {
+	for _, client := range e.clients {
+		for _, subject := range client.config.Subjects {
+			if subject != "" && (subject == claims.Subject || subject == claims.ClientID) {
+				return client.config
+			}
+		}
+	}
+	return nil
+}
+
+// requestKey returns the API key a request presents as a bearer token or in
+// the X-API-Key header
+func requestKey(req *http.Request) string {
+	if token, ok := bearerToken(req); ok {
+		return token
+	}
+	return req.Header.Get(APIKeyHeader)
+}
+
+// bearerToken returns the bearer token in a request's Authorization header
+func bearerToken(req *http.Request) (string, bool) {
+	token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	return token, ok && token != ""
+}
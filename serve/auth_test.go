@@ -0,0 +1,189 @@
+package serve
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/j4ng5y/mcpgate/config"
+	"github.com/j4ng5y/mcpgate/internal/mcptest"
+	"github.com/j4ng5y/mcpgate/mcp"
+	"github.com/j4ng5y/mcpgate/server"
+	"github.com/j4ng5y/mcpgate/transport"
+)
+
+func TestHTTPServer_APIKeys(t *testing.T) {
+	manager := server.NewManager(&config.Config{})
+	if err := manager.Start(); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+	t.Cleanup(manager.Stop)
+
+	srv := NewHTTPServer([]string{"127.0.0.1:0"}, "", mcp.NewRouter(manager))
+	srv.SetAPIKeys([]string{"first-key", "second-key"})
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Failed to start HTTP server: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = srv.Stop(t.Context())
+	})
+
+	initialize := `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`
+	tests := []struct {
+		name   string
+		header http.Header
+		want   int
+	}{
+		{"no key", nil, http.StatusUnauthorized},
+		{"wrong key", http.Header{"Authorization": {"Bearer wrong-key"}}, http.StatusUnauthorized},
+		{"bearer token", http.Header{"Authorization": {"Bearer second-key"}}, http.StatusOK},
+		{"api key header", http.Header{APIKeyHeader: {"first-key"}}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, _ := post(t, srv, "", tt.header, initialize)
+			if resp.StatusCode != tt.want {
+				t.Errorf("Expected %d, got %d", tt.want, resp.StatusCode)
+			}
+			if tt.want == http.StatusUnauthorized && resp.Header.Get("WWW-Authenticate") == "" {
+				t.Error("Expected a WWW-Authenticate challenge")
+			}
+		})
+	}
+}
+
+// newPolicyRouter returns a router for the github and filesystem servers
+// and a function announcing that one of them changed its tools
+func newPolicyRouter(t *testing.T) (*mcp.Router, func(name string)) {
+	t.Helper()
+
+	manager := server.NewManager(&config.Config{
+		Servers: []config.ServerConfig{
+			{Name: "github", Transport: "stdio", Command: mcptest.EchoCommand, Args: mcptest.EchoArgs(), Enabled: true},
+			{Name: "filesystem", Transport: "stdio", Command: mcptest.EchoCommand, Args: mcptest.EchoArgs(), Enabled: true},
+		},
+	})
+	if err := manager.Start(); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+	t.Cleanup(manager.Stop)
+	router := mcp.NewRouter(manager)
+
+	changeTools := func(name string) {
+		srv, err := manager.GetServer(name)
+		if err != nil {
+			t.Fatalf("Failed to get server: %v", err)
+		}
+		srv.SetCapabilities([]string{"tools"})
+		router.SyncCapabilities()
+	}
+	return router, changeTools
+}
+
+func TestHTTPServer_NotificationsFollowClientPolicy(t *testing.T) {
+	router, changeTools := newPolicyRouter(t)
+
+	srv := NewHTTPServer([]string{"127.0.0.1:0"}, "", router)
+	srv.SetAPIKeys([]string{"admin-key"})
+	srv.SetClients([]config.ClientConfig{{Name: "reviewer", APIKeys: []string{"reviewer-key"}, Servers: []string{"github"}}})
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Failed to start HTTP server: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = srv.Stop(t.Context())
+	})
+
+	initialize := `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`
+	admin := http.Header{"Authorization": {"Bearer admin-key"}}
+	reviewer := http.Header{"Authorization": {"Bearer reviewer-key"}}
+	resp, _ := post(t, srv, "", admin, initialize)
+	adminSession := resp.Header.Get(transport.SessionHeader)
+	resp, _ = post(t, srv, "", reviewer, initialize)
+	reviewerSession := resp.Header.Get(transport.SessionHeader)
+
+	if resp, _ := post(t, srv, adminSession, reviewer, `{"jsonrpc":"2.0","id":2,"method":"gateway/list_servers"}`); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected 403 for another client's session, got %d", resp.StatusCode)
+	}
+
+	adminStream, _ := srv.openStream(adminSession)
+	reviewerStream, _ := srv.openStream(reviewerSession)
+
+	changeTools("filesystem")
+	if len(adminStream) != 1 || len(reviewerStream) != 0 {
+		t.Errorf("Expected list_changed for filesystem to reach the admin alone, got %d and %d", len(adminStream), len(reviewerStream))
+	}
+
+	changeTools("github")
+	if len(adminStream) != 2 || len(reviewerStream) != 1 {
+		t.Errorf("Expected list_changed for github to reach both clients, got %d and %d", len(adminStream), len(reviewerStream))
+	}
+}
+
+func TestHTTPServer_ClientPolicies(t *testing.T) {
+	manager := server.NewManager(&config.Config{
+		Servers: []config.ServerConfig{
+			{Name: "github", Transport: "stdio", Command: mcptest.EchoCommand, Args: mcptest.EchoArgs(), Enabled: true, Lazy: true},
+			{Name: "filesystem", Transport: "stdio", Command: mcptest.EchoCommand, Args: mcptest.EchoArgs(), Enabled: true, Lazy: true},
+		},
+	})
+	if err := manager.Start(); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+	t.Cleanup(manager.Stop)
+
+	srv := NewHTTPServer([]string{"127.0.0.1:0"}, "", mcp.NewRouter(manager))
+	srv.SetAPIKeys([]string{"admin-key"})
+	srv.SetClients([]config.ClientConfig{{Name: "reviewer", APIKeys: []string{"reviewer-key"}, Servers: []string{"github"}}})
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Failed to start HTTP server: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = srv.Stop(t.Context())
+	})
+
+	tests := []struct {
+		key  string
+		want int
+	}{
+		{"admin-key", 2},
+		{"reviewer-key", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			header := http.Header{APIKeyHeader: {tt.key}}
+			resp, _ := post(t, srv, "", header, `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`)
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("Expected the key accepted, got %d", resp.StatusCode)
+			}
+			_, rpcResp := post(t, srv, resp.Header.Get(transport.SessionHeader), header, `{"jsonrpc":"2.0","id":2,"method":"gateway/list_servers"}`)
+			if servers, ok := rpcResp.Result.([]interface{}); !ok || len(servers) != tt.want {
+				t.Errorf("Expected %d servers listed, got %v", tt.want, rpcResp.Result)
+			}
+		})
+	}
+}
+
+func TestEndpoint_SubjectClient(t *testing.T) {
+	e := newEndpoint("HTTP", nil, "")
+	e.SetClients([]config.ClientConfig{
+		{Name: "ci", Subjects: []string{"ci-bot"}},
+		{Name: "ide", Subjects: []string{"ide-app"}},
+	})
+
+	tests := []struct {
+		claims tokenClaims
+		want   string
+	}{
+		{tokenClaims{Subject: "ci-bot"}, "ci"},
+		{tokenClaims{Subject: "alice", ClientID: "ide-app"}, "ide"},
+		{tokenClaims{Subject: "alice"}, ""},
+	}
+	for _, tt := range tests {
+		got := ""
+		if client := e.subjectClient(&tt.claims); client != nil {
+			got = client.Name
+		}
+		if got != tt.want {
+			t.Errorf("Expected %+v to be client %q, got %q", tt.claims, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package serve
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/j4ng5y/mcpgate/mcp"
+	"github.com/j4ng5y/mcpgate/tracing"
+	"github.com/j4ng5y/mcpgate/transport"
+)
+
+// corsAllowedHeaders are the request headers browser clients may send
+var corsAllowedHeaders = strings.Join([]string{
+	"Authorization",
+	"Content-Type",
+	"Last-Event-ID",
+	"Mcp-Protocol-Version",
+	APIKeyHeader,
+	mcp.ServerHintHeader,
+	tracing.TraceparentHeader,
+	transport.SessionHeader,
+}, ", ")
+
+// corsExposedHeaders are the response headers browser clients may read
+var corsExposedHeaders = strings.Join([]string{
+	"WWW-Authenticate",
+	transport.SessionHeader,
+}, ", ")
+
+// SetAllowedOrigins lists the browser origins, as scheme://host[:port] or
+// "*" for any, that may use the server, from the next Start on. Requests
+// with any other Origin header are refused; those without one, from
+// clients that are not browsers, are unaffected.
+func (e *endpoint) SetAllowedOrigins(origins []string) {
+	e.origins = make(map[string]bool, len(origins))
+	for _, origin := range origins {
+		e.origins[normalizeOrigin(origin)] = true
+	}
+}
+
+// allowsOrigin reports whether a request may be served given its Origin
+func (e *endpoint) allowsOrigin(req *http.Request) bool {
+	origin := req.Header.Get("Origin")
+	return origin == "" || e.origins["*"] || e.origins[normalizeOrigin(origin)]
+}
+
+// cors refuses requests from browser origins that are not allowed, answers
+// CORS preflights and adds the CORS headers allowed origins need
+func (e *endpoint) cors(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		origin := req.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, req)
+			return
+		}
+		if !e.allowsOrigin(req) {
+			http.Error(w, "origin not allowed", http.StatusForbidden)
+			return
+		}
+
+		header := w.Header()
+		header.Add("Vary", "Origin")
+		header.Set("Access-Control-Allow-Origin", origin)
+		header.Set("Access-Control-Expose-Headers", corsExposedHeaders)
+
+		if req.Method == http.MethodOptions && req.Header.Get("Access-Control-Request-Method") != "" {
+			// Preflights carry no credentials, so they are answered before
+			// authentication
+			header.Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
+			header.Set("Access-Control-Allow-Headers", corsAllowedHeaders)
+			header.Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// normalizeOrigin lowercases an origin and drops a trailing slash, as
+// browsers send origins without one
+func normalizeOrigin(origin string) string {
+	return strings.TrimSuffix(strings.ToLower(origin), "/")
+}
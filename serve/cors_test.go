@@ -0,0 +1,82 @@
+package serve
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/j4ng5y/mcpgate/config"
+	"github.com/j4ng5y/mcpgate/mcp"
+	"github.com/j4ng5y/mcpgate/server"
+	"github.com/j4ng5y/mcpgate/transport"
+)
+
+func TestHTTPServer_CORS(t *testing.T) {
+	manager := server.NewManager(&config.Config{})
+	if err := manager.Start(); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+	t.Cleanup(manager.Stop)
+
+	srv := NewHTTPServer([]string{"127.0.0.1:0"}, "", mcp.NewRouter(manager))
+	srv.SetAPIKeys([]string{"api-key"})
+	srv.SetAllowedOrigins([]string{"https://app.example.com/"})
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Failed to start HTTP server: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = srv.Stop(t.Context())
+	})
+
+	initialize := `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`
+	withKey := func(origin string) http.Header {
+		header := http.Header{APIKeyHeader: {"api-key"}}
+		if origin != "" {
+			header.Set("Origin", origin)
+		}
+		return header
+	}
+
+	if resp, _ := post(t, srv, "", withKey(""), initialize); resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected a request without Origin to be served, got %d", resp.StatusCode)
+	}
+
+	// A page on another origin, possibly resolving to this host through DNS
+	// rebinding, is refused
+	if resp, _ := post(t, srv, "", withKey("http://rebound.example.com:8080"), initialize); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected 403 for an origin not allowed, got %d", resp.StatusCode)
+	}
+
+	resp, _ := post(t, srv, "", withKey("https://app.example.com"), initialize)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected an allowed origin to be served, got %d", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+		t.Errorf("Expected the origin to be allowed, got %q", got)
+	}
+	if got := resp.Header.Get("Access-Control-Expose-Headers"); !strings.Contains(got, transport.SessionHeader) {
+		t.Errorf("Expected the session header to be exposed, got %q", got)
+	}
+
+	// Preflights carry no API key
+	preflight := func(origin string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodOptions, "http://"+srv.Addrs()[0]+HTTPPath, nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		req.Header.Set("Access-Control-Request-Headers", "authorization, content-type")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Preflight failed: %v", err)
+		}
+		_ = resp.Body.Close()
+		return resp
+	}
+	resp = preflight("https://app.example.com")
+	if resp.StatusCode != http.StatusNoContent || !strings.Contains(resp.Header.Get("Access-Control-Allow-Headers"), "Authorization") {
+		t.Errorf("Expected the preflight to be answered, got %d %v", resp.StatusCode, resp.Header)
+	}
+	if resp := preflight("https://evil.example.com"); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected 403 for a preflight from an origin not allowed, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,251 @@
+package serve
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/j4ng5y/mcpgate/listener"
+	"github.com/j4ng5y/mcpgate/logging"
+	"github.com/j4ng5y/mcpgate/mcp"
+)
+
+// streamBuffer is the number of messages an event stream holds for a client
+// that has not caught up; a full stream misses notifications
+const streamBuffer = 64
+
+// endpoint serves a server mode's handler on its listen addresses
+type endpoint struct {
+	name       string // Server mode, for logs
+	scheme     string // URL scheme clients connect with, without TLS
+	addresses  []string
+	family     string
+	tlsConfig  *tls.Config
+	apiKeys    [][]byte        // Keys clients may present, if any
+	clients    []authClient    // Clients held to policies, by key or token subject
+	oauth      *OAuthValidator // Validates access tokens, if configured
+	limits     mcp.Limits      // Bounds the requests clients send
+	origins    map[string]bool // Browser origins allowed, if any
+	listeners  []net.Listener
+	httpServer *http.Server
+
+	routes   sync.WaitGroup // Requests routed outside their HTTP handler
+	mutex    sync.Mutex
+	draining bool // Set by Stop; no more requests are routed
+
+	stopOnce sync.Once
+	done     chan struct{} // Closed by Stop to end open streams
+}
+
+// newEndpoint creates an endpoint listening on addresses once started
+func newEndpoint(name string, addresses []string, family string) endpoint {
+	return endpoint{
+		name:      name,
+		scheme:    "http",
+		addresses: addresses,
+		family:    family,
+		limits:    mcp.DefaultLimits(),
+		done:      make(chan struct{}),
+	}
+}
+
+// SetLimits bounds the size and nesting of the requests clients send
+func (e *endpoint) SetLimits(limits mcp.Limits) {
+	e.limits = limits
+}
+
+// SetTLSConfig serves the endpoint over TLS, from the next Start on
+func (e *endpoint) SetTLSConfig(tlsConfig *tls.Config) {
+	e.tlsConfig = tlsConfig
+}
+
+// start opens the listeners and serves handler on them, logging the URL
+// clients connect to at path
+func (e *endpoint) start(handler http.Handler, path string) error {
+	listeners, err := listener.Open(e.addresses, e.family)
+	if err != nil {
+		return fmt.Errorf("failed to open %s listener: %w", e.name, err)
+	}
+	scheme := e.scheme
+	if e.tlsConfig != nil {
+		for i, l := range listeners {
+			listeners[i] = tls.NewListener(l, e.tlsConfig)
+		}
+		scheme += "s"
+	}
+	e.listeners = listeners
+
+	if len(e.apiKeys) > 0 || len(e.clients) > 0 || e.oauth != nil {
+		handler = e.authenticate(handler)
+	}
+	if e.oauth != nil {
+		// The metadata tells clients how to authenticate, so it is public
+		mux := http.NewServeMux()
+		mux.Handle("/", handler)
+		mux.HandleFunc(ProtectedResourcePath, e.oauth.serveMetadata)
+		if metadataPath := e.oauth.metadataPath(); metadataPath != ProtectedResourcePath {
+			mux.HandleFunc(metadataPath, e.oauth.serveMetadata)
+		}
+		handler = mux
+	}
+	handler = markNetwork(e.cors(handler))
+	e.httpServer = &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	for _, l := range listeners {
+		go func(l net.Listener) {
+			if err := e.httpServer.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				slog.Error("Server error", "listener", e.name, logging.Err(err))
+			}
+		}(l)
+		slog.Info("Endpoint listening", "listener", e.name, "url", endpointURL(l, scheme, path))
+	}
+
+	return nil
+}
+
+// Stop stops accepting connections and requests, waits for the in-flight
+// requests to be answered, then ends the open streams and shuts down the
+// server. It gives up waiting once ctx is done.
+func (e *endpoint) Stop(ctx context.Context) error {
+	if e.httpServer == nil {
+		return nil
+	}
+
+	e.mutex.Lock()
+	e.draining = true
+	e.mutex.Unlock()
+
+	// Shutdown closes the listeners at once, but only returns once the open
+	// streams have ended
+	shutdown := make(chan error, 1)
+	go func() {
+		shutdown <- e.httpServer.Shutdown(ctx)
+	}()
+	drained := make(chan struct{})
+	go func() {
+		e.routes.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-ctx.Done():
+	}
+
+	e.stopOnce.Do(func() { close(e.done) })
+	err := <-shutdown
+	for _, address := range e.addresses {
+		if path, ok := strings.CutPrefix(address, listener.UnixPrefix); ok {
+			if removeErr := os.Remove(path); removeErr != nil && !os.IsNotExist(removeErr) {
+				slog.Warn("Error removing socket", "listener", e.name, logging.Err(removeErr))
+			}
+		}
+	}
+	return err
+}
+
+// beginRoute registers a request routed outside its HTTP handler, which Stop
+// waits for. It reports false once the server is stopping; the request must
+// not be routed then. Otherwise the caller must call e.routes.Done when the
+// request has been answered.
+func (e *endpoint) beginRoute() bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.draining {
+		return false
+	}
+	e.routes.Add(1)
+	return true
+}
+
+// Addrs returns every address the server is listening on
+func (e *endpoint) Addrs() []string {
+	addrs := make([]string, 0, len(e.listeners))
+	for _, l := range e.listeners {
+		addrs = append(addrs, listener.Addr(l))
+	}
+	return addrs
+}
+
+// newSessionID returns a random session id
+func newSessionID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// writeEvent writes v as a server-sent event
+func writeEvent(w io.Writer, event string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+	return err
+}
+
+// readRequest reads and parses the JSON-RPC request in a POST body. When it
+// fails, the response has been written.
+func (e *endpoint) readRequest(w http.ResponseWriter, req *http.Request) (*mcp.Request, bool) {
+	body := req.Body
+	if e.limits.MaxRequestSize > 0 {
+		body = http.MaxBytesReader(w, body, int64(e.limits.MaxRequestSize))
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeJSON(w, http.StatusRequestEntityTooLarge, e.limits.TooLarge())
+			return nil, false
+		}
+		http.Error(w, "failed to read request", http.StatusBadRequest)
+		return nil, false
+	}
+
+	request, errResp := e.limits.ParseRequest(data)
+	if errResp != nil {
+		writeJSON(w, http.StatusBadRequest, errResp)
+		return nil, false
+	}
+	return request, true
+}
+
+// writeJSON writes v as a JSON body with the given status
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Warn("Error encoding HTTP response", logging.Err(err))
+	}
+}
+
+// endpointURL returns the URL clients use to reach path on l
+func endpointURL(l net.Listener, scheme, path string) string {
+	if l.Addr().Network() == "unix" {
+		return listener.Addr(l) + " (" + path + ")"
+	}
+	return scheme + "://" + l.Addr().String() + path
+}
+
+// markNetwork marks the requests handler routes as received over the network
+func markNetwork(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		handler.ServeHTTP(w, req.WithContext(mcp.WithNetwork(req.Context())))
+	})
+}
@@ -0,0 +1,325 @@
+// Package serve exposes the gateway to downstream MCP clients over the network
+package serve
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/j4ng5y/mcpgate/config"
+	"github.com/j4ng5y/mcpgate/logging"
+	"github.com/j4ng5y/mcpgate/mcp"
+	"github.com/j4ng5y/mcpgate/tracing"
+	"github.com/j4ng5y/mcpgate/transport"
+)
+
+// HTTPPath is the Streamable HTTP endpoint clients connect to
+const HTTPPath = "/mcp"
+
+// DefaultSessionIdleTimeout is how long an HTTP session may go unused, with
+// no event stream open, before it ends
+const DefaultSessionIdleTimeout = 30 * time.Minute
+
+// HTTPServer serves the gateway over MCP Streamable HTTP: clients POST each
+// message to a single endpoint and may GET an event stream of notifications
+type HTTPServer struct {
+	endpoint
+	router *mcp.Router
+
+	mutex       sync.Mutex
+	sessions    map[string]*httpSession
+	idleTimeout time.Duration // Zero keeps sessions until they are deleted
+}
+
+// httpSession is a client's Streamable HTTP session, started by initialize
+type httpSession struct {
+	id       string
+	ctx      context.Context // Carries the session and its client
+	streams  map[chan *mcp.Notification]struct{}
+	lastSeen time.Time // Of the last request, or the last stream to close
+}
+
+// NewHTTPServer creates a Streamable HTTP server for router, listening on
+// addresses once started
+func NewHTTPServer(addresses []string, family string, router *mcp.Router) *HTTPServer {
+	return &HTTPServer{
+		endpoint:    newEndpoint("HTTP", addresses, family),
+		router:      router,
+		sessions:    make(map[string]*httpSession),
+		idleTimeout: DefaultSessionIdleTimeout,
+	}
+}
+
+// SetSessionIdleTimeout sets how long a session may go unused, with no event
+// stream open, before it ends; zero or less keeps sessions until deleted
+func (s *HTTPServer) SetSessionIdleTimeout(timeout time.Duration) {
+	s.idleTimeout = max(timeout, 0)
+}
+
+// Start opens the listeners and starts serving. Notifications from the
+// router are sent to the event streams of the sessions they are for.
+func (s *HTTPServer) Start() error {
+	mux := http.NewServeMux()
+	mux.HandleFunc(HTTPPath, s.handleMCP)
+	if err := s.start(mux, HTTPPath); err != nil {
+		return err
+	}
+	s.router.AddNotifier(s.broadcast)
+	if s.idleTimeout > 0 {
+		go s.expireSessions(s.idleTimeout)
+	}
+	return nil
+}
+
+// handleMCP serves the Streamable HTTP endpoint
+func (s *HTTPServer) handleMCP(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodPost:
+		s.handlePost(w, req)
+	case http.MethodGet:
+		s.handleStream(w, req)
+	case http.MethodDelete:
+		s.handleDelete(w, req)
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handlePost routes one JSON-RPC message. initialize starts a new session
+// whose id is returned in the Mcp-Session-Id header; every later message
+// must carry it. Notifications and responses are acknowledged with 202.
+func (s *HTTPServer) handlePost(w http.ResponseWriter, req *http.Request) {
+	request, ok := s.readRequest(w, req)
+	if !ok {
+		return
+	}
+
+	sessionID := req.Header.Get(transport.SessionHeader)
+	if request.Method == mcp.MethodInitialize {
+		id, err := s.newSession(mcp.ClientFromContext(req.Context()))
+		if err != nil {
+			slog.Error("Failed to start HTTP session", logging.Err(err))
+			http.Error(w, "failed to start session", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set(transport.SessionHeader, id)
+		sessionID = id
+	} else if status, msg := s.checkSession(req); status != http.StatusOK {
+		http.Error(w, msg, status)
+		return
+	}
+
+	ctx := mcp.WithServerHint(req.Context(), req.Header.Get(mcp.ServerHintHeader))
+	ctx = mcp.WithSession(ctx, sessionID)
+	ctx = tracing.Extract(ctx, req.Header)
+	ctx, release := mcp.StreamResults(ctx)
+	defer release()
+	resp := s.router.Route(ctx, request)
+	if resp == nil {
+		// Notifications, and responses to the gateway, are not answered
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := mcp.WriteResponse(w, resp); err != nil {
+		slog.WarnContext(ctx, "Error encoding HTTP response", logging.Err(err))
+	}
+}
+
+// handleStream opens an event stream carrying the notifications of the
+// session, such as list_changed, until the client goes away
+func (s *HTTPServer) handleStream(w http.ResponseWriter, req *http.Request) {
+	if !strings.Contains(req.Header.Get("Accept"), "text/event-stream") {
+		http.Error(w, "GET requires Accept: text/event-stream", http.StatusMethodNotAllowed)
+		return
+	}
+	if status, msg := s.checkSession(req); status != http.StatusOK {
+		http.Error(w, msg, status)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	stream, ok := s.openStream(req.Header.Get(transport.SessionHeader))
+	if !ok {
+		http.Error(w, "unknown session", http.StatusNotFound)
+		return
+	}
+	defer s.closeStream(req.Header.Get(transport.SessionHeader), stream)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case notification, ok := <-stream:
+			if !ok {
+				return
+			}
+			if err := writeEvent(w, "message", notification); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-req.Context().Done():
+			return
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// handleDelete ends a session at the client's request
+func (s *HTTPServer) handleDelete(w http.ResponseWriter, req *http.Request) {
+	if status, msg := s.checkSession(req); status != http.StatusOK {
+		http.Error(w, msg, status)
+		return
+	}
+	s.endSession(req.Header.Get(transport.SessionHeader))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// newSession starts a session with a random id for client, which may be nil
+func (s *HTTPServer) newSession(client *config.ClientConfig) (string, error) {
+	id, err := newSessionID()
+	if err != nil {
+		return "", err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.sessions[id] = &httpSession{
+		id:       id,
+		ctx:      mcp.WithSession(mcp.WithClient(context.Background(), client), id),
+		streams:  make(map[chan *mcp.Notification]struct{}),
+		lastSeen: time.Now(),
+	}
+	return id, nil
+}
+
+// checkSession returns the HTTP status for a request's session: 400 without
+// the Mcp-Session-Id header, 404 for a session that ended or never existed
+// and 403 for another client's session. It marks the session as used.
+func (s *HTTPServer) checkSession(req *http.Request) (int, string) {
+	id := req.Header.Get(transport.SessionHeader)
+	if id == "" {
+		return http.StatusBadRequest, "missing " + transport.SessionHeader + " header"
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	sess, ok := s.sessions[id]
+	if !ok {
+		return http.StatusNotFound, "unknown session"
+	}
+	if mcp.ClientFromContext(req.Context()) != mcp.ClientFromContext(sess.ctx) {
+		// Requests are routed as the client that started the session
+		return http.StatusForbidden, "session belongs to another client"
+	}
+	sess.lastSeen = time.Now()
+	return http.StatusOK, ""
+}
+
+// endSession forgets a session, closes its event streams and drops its
+// subscriptions
+func (s *HTTPServer) endSession(id string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	sess, ok := s.sessions[id]
+	if !ok {
+		return
+	}
+	delete(s.sessions, id)
+	for stream := range sess.streams {
+		close(stream)
+	}
+	s.router.EndSession(id)
+}
+
+// openStream registers a new event stream for a session
+func (s *HTTPServer) openStream(id string) (chan *mcp.Notification, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	sess, ok := s.sessions[id]
+	if !ok {
+		return nil, false
+	}
+	stream := make(chan *mcp.Notification, streamBuffer)
+	sess.streams[stream] = struct{}{}
+	return stream, true
+}
+
+// closeStream unregisters an event stream the client went away from
+func (s *HTTPServer) closeStream(id string, stream chan *mcp.Notification) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if sess, ok := s.sessions[id]; ok {
+		if _, open := sess.streams[stream]; open {
+			delete(sess.streams, stream)
+			close(stream)
+		}
+		sess.lastSeen = time.Now()
+	}
+}
+
+// expireSessions ends idle sessions, checking at least once per timeout,
+// until the server stops
+func (s *HTTPServer) expireSessions(timeout time.Duration) {
+	ticker := time.NewTicker(min(timeout, time.Minute))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.endIdleSessions(time.Now().Add(-timeout))
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// endIdleSessions ends the sessions without an open event stream that were
+// last used before cutoff
+func (s *HTTPServer) endIdleSessions(cutoff time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for id, sess := range s.sessions {
+		if len(sess.streams) == 0 && sess.lastSeen.Before(cutoff) {
+			delete(s.sessions, id)
+			s.router.EndSession(id)
+			slog.Debug("Ended idle HTTP session", "session", id)
+		}
+	}
+}
+
+// broadcast sends a notification to the event streams of every session the
+// router says receives it. A stream that has not caught up misses it.
+func (s *HTTPServer) broadcast(notification *mcp.Notification) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, sess := range s.sessions {
+		if !s.router.Receives(sess.ctx, notification) {
+			continue
+		}
+		for stream := range sess.streams {
+			select {
+			case stream <- notification:
+			default:
+				slog.Warn("Dropping notification: event stream is full", logging.KeyMethod, notification.Method, "session", sess.id)
+			}
+		}
+	}
+}
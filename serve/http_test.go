@@ -0,0 +1,287 @@
+package serve
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/j4ng5y/mcpgate/config"
+	"github.com/j4ng5y/mcpgate/internal/mcptest"
+	"github.com/j4ng5y/mcpgate/mcp"
+	"github.com/j4ng5y/mcpgate/server"
+	"github.com/j4ng5y/mcpgate/transport"
+)
+
+func newTestHTTPServer(t *testing.T, cfg *config.Config) *HTTPServer {
+	t.Helper()
+
+	manager := server.NewManager(cfg)
+	if err := manager.Start(); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+	t.Cleanup(manager.Stop)
+
+	srv := NewHTTPServer([]string{"127.0.0.1:0"}, "", mcp.NewRouter(manager))
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Failed to start HTTP server: %v", err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = srv.Stop(ctx)
+	})
+
+	return srv
+}
+
+func post(t *testing.T, srv *HTTPServer, sessionID string, header http.Header, body string) (*http.Response, *mcp.Response) {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodPost, "http://"+srv.Addrs()[0]+HTTPPath, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if sessionID != "" {
+		req.Header.Set(transport.SessionHeader, sessionID)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return resp, nil
+	}
+
+	var rpcResp mcp.Response
+	if err := json.NewDecoder(resp.Body).Decode(&rpcResp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	return resp, &rpcResp
+}
+
+func TestHTTPServer_Sessions(t *testing.T) {
+	srv := newTestHTTPServer(t, &config.Config{})
+
+	if resp, _ := post(t, srv, "", nil, `{"jsonrpc":"2.0","id":1,"method":"gateway/list_servers"}`); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 without a session, got %d", resp.StatusCode)
+	}
+
+	resp, _ := post(t, srv, "", nil, `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`)
+	sessionID := resp.Header.Get(transport.SessionHeader)
+	if resp.StatusCode != http.StatusOK || sessionID == "" {
+		t.Fatalf("Expected initialize to start a session, got %d with id %q", resp.StatusCode, sessionID)
+	}
+
+	resp, rpcResp := post(t, srv, sessionID, nil, `{"jsonrpc":"2.0","id":2,"method":"gateway/list_servers"}`)
+	if resp.StatusCode != http.StatusOK || rpcResp.Error != nil {
+		t.Fatalf("Expected gateway/list_servers to succeed, got %d %+v", resp.StatusCode, rpcResp)
+	}
+
+	if resp, _ := post(t, srv, sessionID, nil, `{"jsonrpc":"2.0","method":"notifications/initialized"}`); resp.StatusCode != http.StatusAccepted {
+		t.Errorf("Expected 202 for a notification, got %d", resp.StatusCode)
+	}
+	if resp, _ := post(t, srv, "unknown", nil, `{"jsonrpc":"2.0","id":3,"method":"gateway/list_servers"}`); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown session, got %d", resp.StatusCode)
+	}
+	if resp, _ := post(t, srv, sessionID, nil, `{not json`); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for malformed JSON, got %d", resp.StatusCode)
+	}
+
+	// The routing header pins requests like _meta.server
+	header := http.Header{mcp.ServerHintHeader: {"missing"}}
+	if _, rpcResp := post(t, srv, sessionID, header, `{"jsonrpc":"2.0","id":4,"method":"tools/list"}`); rpcResp == nil || rpcResp.Error == nil || rpcResp.Error.Code != mcp.InvalidParams {
+		t.Errorf("Expected the header to pin the request to an unknown server, got %+v", rpcResp)
+	}
+
+	req, _ := http.NewRequest(http.MethodDelete, "http://"+srv.Addrs()[0]+HTTPPath, nil)
+	req.Header.Set(transport.SessionHeader, sessionID)
+	deleted, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("DELETE failed: %v", err)
+	}
+	_ = deleted.Body.Close()
+	if deleted.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected 204 ending the session, got %d", deleted.StatusCode)
+	}
+	if resp, _ := post(t, srv, sessionID, nil, `{"jsonrpc":"2.0","id":5,"method":"gateway/list_servers"}`); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 once the session ended, got %d", resp.StatusCode)
+	}
+}
+
+func TestHTTPServer_RuntimeChangesNeedClient(t *testing.T) {
+	manager := server.NewManager(&config.Config{})
+	if err := manager.Start(); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+	t.Cleanup(manager.Stop)
+	router := mcp.NewRouter(manager)
+	router.EnableRuntimeChanges()
+
+	srv := NewHTTPServer([]string{"127.0.0.1:0"}, "", router)
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Failed to start HTTP server: %v", err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = srv.Stop(ctx)
+	})
+
+	body := `{"jsonrpc":"2.0","id":1,"method":"gateway/add_server","params":{"server":{"name":"shell","command":"sh"}}}`
+	resp, _ := post(t, srv, "", nil, `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`)
+	sessionID := resp.Header.Get(transport.SessionHeader)
+	if _, rpcResp := post(t, srv, sessionID, nil, body); rpcResp == nil || rpcResp.Error == nil || rpcResp.Error.Code != mcp.Forbidden {
+		t.Errorf("Expected gateway/add_server refused without authentication, got %+v", rpcResp)
+	}
+	if _, err := manager.GetServer("shell"); err == nil {
+		t.Error("Expected no server added")
+	}
+}
+
+func TestHTTPServer_RequestLimits(t *testing.T) {
+	manager := server.NewManager(&config.Config{})
+	if err := manager.Start(); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+	t.Cleanup(manager.Stop)
+
+	srv := NewHTTPServer([]string{"127.0.0.1:0"}, "", mcp.NewRouter(manager))
+	srv.SetLimits(mcp.Limits{MaxRequestSize: 256, MaxParamsDepth: 4})
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Failed to start HTTP server: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = srv.Stop(t.Context())
+	})
+
+	large := `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"pad":"` + strings.Repeat("x", 256) + `"}}`
+	resp, err := http.Post("http://"+srv.Addrs()[0]+HTTPPath, "application/json", strings.NewReader(large))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	var rpcResp mcp.Response
+	err = json.NewDecoder(resp.Body).Decode(&rpcResp)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestEntityTooLarge || err != nil || rpcResp.Error == nil || rpcResp.Error.Code != mcp.InvalidRequest {
+		t.Errorf("Expected 413 with a JSON-RPC error, got %d %+v (%v)", resp.StatusCode, rpcResp.Error, err)
+	}
+
+	deep := `{"jsonrpc":"2.0","id":2,"method":"initialize","params":{"a":[[[[]]]]}}`
+	if resp, _ := post(t, srv, "", nil, deep); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for params nested too deeply, got %d", resp.StatusCode)
+	}
+	if resp, _ := post(t, srv, "", nil, `{"jsonrpc":"2.0","id":3,"method":"initialize","params":{"a":[[]]}}`); resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected a request within the limits to succeed, got %d", resp.StatusCode)
+	}
+}
+
+func TestHTTPServer_EventStream(t *testing.T) {
+	srv := newTestHTTPServer(t, &config.Config{})
+
+	resp, _ := post(t, srv, "", nil, `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`)
+	sessionID := resp.Header.Get(transport.SessionHeader)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+srv.Addrs()[0]+HTTPPath, nil)
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set(transport.SessionHeader, sessionID)
+	stream, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer func() {
+		_ = stream.Body.Close()
+	}()
+	if stream.StatusCode != http.StatusOK {
+		t.Fatalf("Expected the event stream to open, got %d", stream.StatusCode)
+	}
+
+	srv.broadcast(&mcp.Notification{JSONRPC: "2.0", Method: mcp.MethodToolsUpdated})
+
+	scanner := bufio.NewScanner(stream.Body)
+	for scanner.Scan() {
+		if data, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+			var notification mcp.Notification
+			if err := json.Unmarshal([]byte(data), &notification); err != nil {
+				t.Fatalf("Failed to decode event: %v", err)
+			}
+			if notification.Method != mcp.MethodToolsUpdated {
+				t.Errorf("Expected %s, got %s", mcp.MethodToolsUpdated, notification.Method)
+			}
+			return
+		}
+	}
+	t.Fatalf("Event stream ended without a notification: %v", scanner.Err())
+}
+
+func TestHTTPServer_IdleSessionsExpire(t *testing.T) {
+	srv := newTestHTTPServer(t, &config.Config{})
+
+	initialize := `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`
+	resp, _ := post(t, srv, "", nil, initialize)
+	idle := resp.Header.Get(transport.SessionHeader)
+	resp, _ = post(t, srv, "", nil, initialize)
+	streaming := resp.Header.Get(transport.SessionHeader)
+	if _, ok := srv.openStream(streaming); !ok {
+		t.Fatal("Failed to open an event stream")
+	}
+
+	// A session with an open event stream is in use however long ago its
+	// last request was
+	srv.endIdleSessions(time.Now().Add(time.Minute))
+
+	listServers := `{"jsonrpc":"2.0","id":2,"method":"gateway/list_servers"}`
+	if resp, _ := post(t, srv, idle, nil, listServers); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for an expired session, got %d", resp.StatusCode)
+	}
+	if resp, _ := post(t, srv, streaming, nil, listServers); resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected the streaming session kept, got %d", resp.StatusCode)
+	}
+}
+
+func TestHTTPServer_StreamableHTTPClient(t *testing.T) {
+	srv := newTestHTTPServer(t, &config.Config{
+		Servers: []config.ServerConfig{{Name: "echo", Transport: "stdio", Command: mcptest.EchoCommand, Args: mcptest.EchoArgs(), Enabled: true}},
+	})
+
+	client, err := transport.NewStreamableHTTPTransport(map[string]interface{}{
+		"url": "http://" + srv.Addrs()[0] + HTTPPath,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer func() {
+		_ = client.Disconnect(ctx)
+	}()
+
+	if _, err := client.SendRequest(ctx, map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": "initialize", "params": map[string]interface{}{}}); err != nil {
+		t.Fatalf("initialize failed: %v", err)
+	}
+	raw, err := client.SendRequest(ctx, map[string]interface{}{"jsonrpc": "2.0", "id": 2, "method": "gateway/list_servers"})
+	if err != nil {
+		t.Fatalf("gateway/list_servers failed: %v", err)
+	}
+	if !bytes.Contains(raw, []byte(`"echo"`)) {
+		t.Errorf("Expected the echo server listed, got %s", raw)
+	}
+}
@@ -0,0 +1,456 @@
+package serve
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/j4ng5y/mcpgate/config"
+	"github.com/j4ng5y/mcpgate/logging"
+)
+
+// ProtectedResourcePath is where the gateway publishes its OAuth protected
+// resource metadata (RFC 9728), telling clients which authorization server
+// issues tokens for it
+const ProtectedResourcePath = "/.well-known/oauth-protected-resource"
+
+// Token validation errors. A token without a required scope is refused with
+// 403 rather than 401, so clients know to ask for more scopes.
+var (
+	errInvalidToken      = errors.New("invalid access token")
+	errInsufficientScope = errors.New("insufficient scope")
+)
+
+// Bounds on validating tokens: clock skew tolerated on exp and nbf, how often
+// an unknown key id may trigger fetching the signing keys again, and how long
+// fetching metadata or keys may take
+const (
+	tokenLeeway      = 30 * time.Second
+	jwksRefreshLimit = time.Minute
+	fetchTimeout     = 10 * time.Second
+)
+
+// OAuthValidator checks the access tokens clients present against the
+// configured issuer: JWTs signed with one of its keys, naming the gateway's
+// resource URL as audience, unexpired, and carrying the required scopes
+type OAuthValidator struct {
+	config config.OAuthConfig
+	client *http.Client
+
+	mutex   sync.Mutex
+	jwksURL string
+	keys    map[string]crypto.PublicKey
+	fetched time.Time // When the keys were last fetched
+}
+
+// tokenClaims are the JWT claims the gateway checks
+type tokenClaims struct {
+	Issuer    string   `json:"iss"`
+	Subject   string   `json:"sub"`
+	Audience  audience `json:"aud"`
+	ExpiresAt int64    `json:"exp"`
+	NotBefore int64    `json:"nbf"`
+	Scope     string   `json:"scope"`
+	ClientID  string   `json:"client_id"`
+}
+
+// audience is the aud claim, either one string or a list of them
+type audience []string
+
+// UnmarshalJSON accepts a single audience or a list
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+// NewOAuthValidator creates a validator for cfg. The issuer's signing keys
+// are fetched when the first token arrives.
+func NewOAuthValidator(cfg config.OAuthConfig) *OAuthValidator {
+	return &OAuthValidator{
+		config:  cfg,
+		client:  &http.Client{Timeout: fetchTimeout},
+		jwksURL: cfg.JWKSURL,
+	}
+}
+
+// MetadataURL returns the URL of the protected resource metadata, which is
+// inserted between the host and path of the resource URL
+func (v *OAuthValidator) MetadataURL() string {
+	u, err := url.Parse(v.config.Resource)
+	if err != nil {
+		return ProtectedResourcePath
+	}
+	return u.Scheme + "://" + u.Host + v.metadataPath()
+}
+
+// metadataPath returns the path the metadata is served at for the resource
+func (v *OAuthValidator) metadataPath() string {
+	u, err := url.Parse(v.config.Resource)
+	if err != nil {
+		return ProtectedResourcePath
+	}
+	return ProtectedResourcePath + strings.TrimSuffix(u.Path, "/")
+}
+
+// serveMetadata answers with the protected resource metadata
+func (v *OAuthValidator) serveMetadata(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	metadata := map[string]interface{}{
+		"resource":                 v.config.Resource,
+		"authorization_servers":    []string{v.config.Issuer},
+		"bearer_methods_supported": []string{"header"},
+		"resource_name":            "mcpgate",
+	}
+	if len(v.config.Scopes) > 0 {
+		metadata["scopes_supported"] = v.config.Scopes
+	}
+	writeJSON(w, http.StatusOK, metadata)
+}
+
+// challenge returns the WWW-Authenticate header for a refused request,
+// pointing clients at the metadata. err is the reason a presented token was
+// refused, or nil when there was none.
+func (v *OAuthValidator) challenge(err error) string {
+	params := []string{fmt.Sprintf("resource_metadata=%q", v.MetadataURL())}
+	switch {
+	case errors.Is(err, errInsufficientScope):
+		params = append(params, `error="insufficient_scope"`)
+	case err != nil:
+		params = append(params, `error="invalid_token"`)
+	}
+	if len(v.config.Scopes) > 0 {
+		params = append(params, fmt.Sprintf("scope=%q", strings.Join(v.config.Scopes, " ")))
+	}
+	return "Bearer " + strings.Join(params, ", ")
+}
+
+// Validate checks an access token and returns its claims
+func (v *OAuthValidator) Validate(ctx context.Context, token string) (*tokenClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: not a JWT", errInvalidToken)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: bad header: %v", errInvalidToken, err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: bad signature encoding", errInvalidToken)
+	}
+
+	key, err := v.key(ctx, header.Kid)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidToken, err)
+	}
+	if err := verifySignature(header.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidToken, err)
+	}
+
+	var claims tokenClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: bad claims: %v", errInvalidToken, err)
+	}
+	if err := v.checkClaims(&claims, time.Now()); err != nil {
+		return nil, err
+	}
+	return &claims, nil
+}
+
+// checkClaims checks the issuer, audience, lifetime and scopes of a token
+func (v *OAuthValidator) checkClaims(claims *tokenClaims, now time.Time) error {
+	if claims.Issuer != v.config.Issuer {
+		return fmt.Errorf("%w: issued by %q", errInvalidToken, claims.Issuer)
+	}
+	if !slices.Contains(claims.Audience, v.config.Resource) {
+		return fmt.Errorf("%w: not issued for %s", errInvalidToken, v.config.Resource)
+	}
+	if claims.ExpiresAt == 0 || now.After(time.Unix(claims.ExpiresAt, 0).Add(tokenLeeway)) {
+		return fmt.Errorf("%w: expired", errInvalidToken)
+	}
+	if claims.NotBefore != 0 && now.Add(tokenLeeway).Before(time.Unix(claims.NotBefore, 0)) {
+		return fmt.Errorf("%w: not valid yet", errInvalidToken)
+	}
+
+	granted := strings.Fields(claims.Scope)
+	for _, scope := range v.config.Scopes {
+		if !slices.Contains(granted, scope) {
+			return fmt.Errorf("%w: missing %s", errInsufficientScope, scope)
+		}
+	}
+	return nil
+}
+
+// key returns the issuer's signing key with the given id, fetching the keys
+// again when it is unknown, at most once a minute. A token without a key id
+// may use the only key there is.
+func (v *OAuthValidator) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	if key, ok := v.lookupLocked(kid); ok {
+		return key, nil
+	}
+	if !v.fetched.IsZero() && time.Since(v.fetched) < jwksRefreshLimit {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	if err := v.fetchKeysLocked(ctx); err != nil {
+		slog.Warn("Failed to fetch signing keys", "issuer", v.config.Issuer, logging.Err(err))
+		return nil, fmt.Errorf("signing keys unavailable")
+	}
+	if key, ok := v.lookupLocked(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// lookupLocked finds a cached key. It must be called with v.mutex held.
+func (v *OAuthValidator) lookupLocked(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(v.keys) == 1 {
+		for _, key := range v.keys {
+			return key, true
+		}
+	}
+	key, ok := v.keys[kid]
+	return key, ok && kid != ""
+}
+
+// fetchKeysLocked fetches the issuer's JSON Web Key Set, discovering its URL
+// from the issuer's metadata unless configured. It must be called with
+// v.mutex held.
+func (v *OAuthValidator) fetchKeysLocked(ctx context.Context) error {
+	v.fetched = time.Now()
+
+	if v.jwksURL == "" {
+		jwksURL, err := v.discoverJWKS(ctx)
+		if err != nil {
+			return err
+		}
+		v.jwksURL = jwksURL
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := v.getJSON(ctx, v.jwksURL, &set); err != nil {
+		return err
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			slog.Warn("Skipping signing key", "kid", jwk.Kid, "issuer", v.config.Issuer, logging.Err(err))
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	v.keys = keys
+	return nil
+}
+
+// discoverJWKS reads jwks_uri from the issuer's authorization server
+// metadata (RFC 8414), or its OpenID configuration
+func (v *OAuthValidator) discoverJWKS(ctx context.Context) (string, error) {
+	issuer, err := url.Parse(v.config.Issuer)
+	if err != nil {
+		return "", err
+	}
+	origin := issuer.Scheme + "://" + issuer.Host
+	path := strings.TrimSuffix(issuer.Path, "/")
+	candidates := []string{
+		origin + "/.well-known/oauth-authorization-server" + path,
+		origin + "/.well-known/openid-configuration" + path,
+		origin + path + "/.well-known/openid-configuration",
+	}
+
+	var lastErr error
+	for _, candidate := range candidates {
+		var metadata struct {
+			Issuer  string `json:"issuer"`
+			JWKSURI string `json:"jwks_uri"`
+		}
+		if err := v.getJSON(ctx, candidate, &metadata); err != nil {
+			lastErr = err
+			continue
+		}
+		if metadata.Issuer != v.config.Issuer {
+			return "", fmt.Errorf("metadata at %s is for issuer %q", candidate, metadata.Issuer)
+		}
+		if metadata.JWKSURI == "" {
+			return "", fmt.Errorf("metadata at %s has no jwks_uri", candidate)
+		}
+		return metadata.JWKSURI, nil
+	}
+	return "", fmt.Errorf("no authorization server metadata found: %w", lastErr)
+}
+
+// getJSON fetches and decodes a JSON document
+func (v *OAuthValidator) getJSON(ctx context.Context, target string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", target, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// jsonWebKey is a public key of a JSON Web Key Set (RFC 7517)
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// publicKey decodes an RSA or EC key
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("bad modulus: %w", err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("bad exponent: %w", err)
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("exponent too large")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("bad x coordinate: %w", err)
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("bad y coordinate: %w", err)
+		}
+		size := (curve.Params().BitSize + 7) / 8
+		if len(x) > size || len(y) > size {
+			return nil, fmt.Errorf("coordinates too long for %s", k.Crv)
+		}
+		point := make([]byte, 1+2*size)
+		point[0] = 4 // Uncompressed
+		copy(point[1+size-len(x):1+size], x)
+		copy(point[1+2*size-len(y):], y)
+		return ecdsa.ParseUncompressedPublicKey(curve, point)
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+// verifySignature checks a JWS signature over signed with key, for the RSA
+// and ECDSA algorithms authorization servers use
+func verifySignature(alg string, key crypto.PublicKey, signed string, signature []byte) error {
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "PS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "PS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512", "PS512", "ES512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	h := hash.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		switch alg[:2] {
+		case "RS":
+			return rsa.VerifyPKCS1v15(pub, hash, digest, signature)
+		case "PS":
+			return rsa.VerifyPSS(pub, hash, digest, signature, nil)
+		}
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if alg[:2] != "ES" || len(signature) != 2*size {
+			break
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return fmt.Errorf("signature mismatch")
+		}
+		return nil
+	}
+	return fmt.Errorf("algorithm %q does not match the signing key", alg)
+}
+
+// decodeSegment decodes a base64url JSON segment of a JWT
+func decodeSegment(segment string, out interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
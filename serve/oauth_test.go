@@ -0,0 +1,180 @@
+package serve
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/j4ng5y/mcpgate/config"
+	"github.com/j4ng5y/mcpgate/mcp"
+	"github.com/j4ng5y/mcpgate/server"
+)
+
+// testIssuer is an authorization server publishing its metadata and the
+// key it signs tokens with
+type testIssuer struct {
+	url string
+	key *rsa.PrivateKey
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	issuer := &testIssuer{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/oauth-authorization-server", func(w http.ResponseWriter, req *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"issuer": issuer.url, "jwks_uri": issuer.url + "/jwks"})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, req *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	issuer.url = srv.URL
+
+	return issuer
+}
+
+// token returns an RS256 JWT with claims, signed by the issuer
+func (i *testIssuer) token(t *testing.T, claims map[string]interface{}) string {
+	t.Helper()
+
+	encode := func(v interface{}) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatalf("Failed to encode token: %v", err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	signed := encode(map[string]string{"alg": "RS256", "kid": "test", "typ": "JWT"}) + "." + encode(claims)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, i.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestHTTPServer_OAuth(t *testing.T) {
+	issuer := newTestIssuer(t)
+	resource := "https://mcp.example.com/mcp"
+
+	manager := server.NewManager(&config.Config{})
+	if err := manager.Start(); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+	t.Cleanup(manager.Stop)
+
+	srv := NewHTTPServer([]string{"127.0.0.1:0"}, "", mcp.NewRouter(manager))
+	srv.SetAPIKeys([]string{"api-key"})
+	srv.SetOAuth(NewOAuthValidator(config.OAuthConfig{Issuer: issuer.url, Resource: resource, Scopes: []string{"mcp"}}))
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Failed to start HTTP server: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = srv.Stop(t.Context())
+	})
+
+	now := time.Now().Unix()
+	claims := func(overrides map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{"iss": issuer.url, "aud": resource, "sub": "alice", "exp": now + 60, "scope": "openid mcp"}
+		for k, v := range overrides {
+			c[k] = v
+		}
+		return c
+	}
+	bearer := func(token string) http.Header {
+		return http.Header{"Authorization": {"Bearer " + token}}
+	}
+
+	initialize := `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`
+	tests := []struct {
+		name      string
+		header    http.Header
+		want      int
+		challenge string
+	}{
+		{"no token", nil, http.StatusUnauthorized, "resource_metadata="},
+		{"valid token", bearer(issuer.token(t, claims(nil))), http.StatusOK, ""},
+		{"audience list", bearer(issuer.token(t, claims(map[string]interface{}{"aud": []string{"other", resource}}))), http.StatusOK, ""},
+		{"api key", http.Header{APIKeyHeader: {"api-key"}}, http.StatusOK, ""},
+		{"wrong audience", bearer(issuer.token(t, claims(map[string]interface{}{"aud": "https://other.example.com"}))), http.StatusUnauthorized, `error="invalid_token"`},
+		{"wrong issuer", bearer(issuer.token(t, claims(map[string]interface{}{"iss": "https://evil.example.com"}))), http.StatusUnauthorized, `error="invalid_token"`},
+		{"expired", bearer(issuer.token(t, claims(map[string]interface{}{"exp": now - 120}))), http.StatusUnauthorized, `error="invalid_token"`},
+		{"tampered", bearer(issuer.token(t, claims(nil)) + "x"), http.StatusUnauthorized, `error="invalid_token"`},
+		{"missing scope", bearer(issuer.token(t, claims(map[string]interface{}{"scope": "openid"}))), http.StatusForbidden, `error="insufficient_scope"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, _ := post(t, srv, "", tt.header, initialize)
+			if resp.StatusCode != tt.want {
+				t.Errorf("Expected %d, got %d", tt.want, resp.StatusCode)
+			}
+			if challenge := resp.Header.Get("WWW-Authenticate"); !strings.Contains(challenge, tt.challenge) {
+				t.Errorf("Expected a challenge with %s, got %q", tt.challenge, challenge)
+			}
+		})
+	}
+}
+
+func TestHTTPServer_ProtectedResourceMetadata(t *testing.T) {
+	manager := server.NewManager(&config.Config{})
+	if err := manager.Start(); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+	t.Cleanup(manager.Stop)
+
+	validator := NewOAuthValidator(config.OAuthConfig{Issuer: "https://auth.example.com", Resource: "https://mcp.example.com/mcp", Scopes: []string{"mcp"}})
+	if got := validator.MetadataURL(); got != "https://mcp.example.com/.well-known/oauth-protected-resource/mcp" {
+		t.Errorf("Unexpected metadata URL %s", got)
+	}
+
+	srv := NewHTTPServer([]string{"127.0.0.1:0"}, "", mcp.NewRouter(manager))
+	srv.SetOAuth(validator)
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Failed to start HTTP server: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = srv.Stop(t.Context())
+	})
+
+	for _, path := range []string{ProtectedResourcePath, ProtectedResourcePath + "/mcp"} {
+		resp, err := http.Get("http://" + srv.Addrs()[0] + path)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", path, err)
+		}
+		var metadata struct {
+			Resource             string   `json:"resource"`
+			AuthorizationServers []string `json:"authorization_servers"`
+			ScopesSupported      []string `json:"scopes_supported"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&metadata)
+		_ = resp.Body.Close()
+		if err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected metadata at %s without a token, got %d: %v", path, resp.StatusCode, err)
+		}
+		if metadata.Resource != "https://mcp.example.com/mcp" || len(metadata.AuthorizationServers) != 1 || metadata.AuthorizationServers[0] != "https://auth.example.com" || len(metadata.ScopesSupported) != 1 {
+			t.Errorf("Unexpected metadata at %s: %+v", path, metadata)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package serve
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+
+	"github.com/j4ng5y/mcpgate/logging"
+	"github.com/j4ng5y/mcpgate/mcp"
+	"github.com/j4ng5y/mcpgate/tracing"
+)
+
+// Paths of the HTTP+SSE transport: clients GET the event stream at SSEPath,
+// which tells them where to POST their messages
+const (
+	SSEPath     = "/sse"
+	MessagePath = "/message"
+)
+
+// SSEServer serves the gateway over the HTTP+SSE transport of earlier MCP
+// revisions, for clients that do not speak Streamable HTTP yet. Each client
+// holds an event stream open; it POSTs messages to the endpoint announced on
+// the stream and receives the responses, and notifications, over the stream.
+type SSEServer struct {
+	endpoint
+	router *mcp.Router
+
+	mutex    sync.Mutex
+	sessions map[string]*sseSession
+}
+
+// sseSession is a client's open event stream
+type sseSession struct {
+	id       string
+	messages chan interface{}   // Responses and notifications to send
+	ctx      context.Context    // Done once the stream closes
+	cancel   context.CancelFunc // Cancels the session's in-flight requests
+}
+
+// NewSSEServer creates an HTTP+SSE server for router, listening on
+// addresses once started
+func NewSSEServer(addresses []string, family string, router *mcp.Router) *SSEServer {
+	return &SSEServer{
+		endpoint: newEndpoint("SSE", addresses, family),
+		router:   router,
+		sessions: make(map[string]*sseSession),
+	}
+}
+
+// Start opens the listeners and starts serving. Notifications from the
+// router are sent to the event streams of the sessions they are for.
+func (s *SSEServer) Start() error {
+	mux := http.NewServeMux()
+	mux.HandleFunc(SSEPath, s.handleStream)
+	mux.HandleFunc(MessagePath, s.handleMessage)
+	if err := s.start(mux, SSEPath); err != nil {
+		return err
+	}
+	s.router.AddNotifier(s.broadcast)
+	return nil
+}
+
+// handleStream opens a session's event stream. Its first event, endpoint,
+// holds the URL to POST messages to; every later one is a message.
+func (s *SSEServer) handleStream(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	sess, err := s.newSession(req.Context())
+	if err != nil {
+		slog.Error("Failed to start SSE session", logging.Err(err))
+		http.Error(w, "failed to start session", http.StatusInternalServerError)
+		return
+	}
+	defer s.endSession(sess)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.WriteString(w, "event: endpoint\ndata: "+MessagePath+"?sessionId="+sess.id+"\n\n"); err != nil {
+		return
+	}
+	flusher.Flush()
+
+	for {
+		select {
+		case message := <-sess.messages:
+			if err := writeEvent(w, "message", message); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-req.Context().Done():
+			return
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// handleMessage accepts a message for a session with 202 and routes it in
+// the background; its response is sent over the session's event stream
+func (s *SSEServer) handleMessage(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.mutex.Lock()
+	sess, ok := s.sessions[req.URL.Query().Get("sessionId")]
+	s.mutex.Unlock()
+	if !ok {
+		http.Error(w, "unknown session", http.StatusNotFound)
+		return
+	}
+	if mcp.ClientFromContext(req.Context()) != mcp.ClientFromContext(sess.ctx) {
+		// Messages are routed as the client that opened the stream
+		http.Error(w, "session belongs to another client", http.StatusForbidden)
+		return
+	}
+
+	request, ok := s.readRequest(w, req)
+	if !ok {
+		return
+	}
+
+	if !s.beginRoute() {
+		http.Error(w, "server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	ctx := mcp.WithServerHint(sess.ctx, req.Header.Get(mcp.ServerHintHeader))
+	ctx = tracing.Extract(ctx, req.Header)
+	w.WriteHeader(http.StatusAccepted)
+
+	go func() {
+		defer s.routes.Done()
+		resp := s.router.Route(ctx, request)
+		if resp == nil {
+			// Notifications are not answered
+			return
+		}
+		select {
+		case sess.messages <- resp:
+		case <-sess.ctx.Done():
+		}
+	}()
+}
+
+// newSession registers a session for a new event stream, ending with ctx
+func (s *SSEServer) newSession(ctx context.Context) (*sseSession, error) {
+	id, err := newSessionID()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(mcp.WithSession(ctx, id))
+	sess := &sseSession{
+		id:       id,
+		messages: make(chan interface{}, streamBuffer),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.sessions[id] = sess
+	return sess, nil
+}
+
+// endSession forgets a session whose stream closed, cancels its in-flight
+// requests and drops its subscriptions
+func (s *SSEServer) endSession(sess *sseSession) {
+	s.mutex.Lock()
+	delete(s.sessions, sess.id)
+	s.mutex.Unlock()
+	sess.cancel()
+	s.router.EndSession(sess.id)
+}
+
+// broadcast sends a notification to the event stream of every session the
+// router says receives it. A stream that has not caught up misses it.
+func (s *SSEServer) broadcast(notification *mcp.Notification) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, sess := range s.sessions {
+		if !s.router.Receives(sess.ctx, notification) {
+			continue
+		}
+		select {
+		case sess.messages <- notification:
+		default:
+			slog.Warn("Dropping notification: event stream is full", logging.KeyMethod, notification.Method, "session", sess.id)
+		}
+	}
+}
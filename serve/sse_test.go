@@ -0,0 +1,196 @@
+package serve
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/j4ng5y/mcpgate/config"
+	"github.com/j4ng5y/mcpgate/internal/mcptest"
+	"github.com/j4ng5y/mcpgate/mcp"
+	"github.com/j4ng5y/mcpgate/server"
+)
+
+func newTestSSEServer(t *testing.T) *SSEServer {
+	t.Helper()
+
+	manager := server.NewManager(&config.Config{})
+	if err := manager.Start(); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+	t.Cleanup(manager.Stop)
+
+	srv := NewSSEServer([]string{"127.0.0.1:0"}, "", mcp.NewRouter(manager))
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Failed to start SSE server: %v", err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = srv.Stop(ctx)
+	})
+
+	return srv
+}
+
+// readEvent returns the name and data of the next event on an SSE stream
+func readEvent(t *testing.T, scanner *bufio.Scanner) (string, string) {
+	t.Helper()
+
+	var event, data string
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "" && data != "":
+			return event, data
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+	t.Fatalf("Event stream ended: %v", scanner.Err())
+	return "", ""
+}
+
+func TestSSEServer_RoundTrip(t *testing.T) {
+	srv := newTestSSEServer(t)
+	base := "http://" + srv.Addrs()[0]
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, base+SSEPath, nil)
+	stream, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer func() {
+		_ = stream.Body.Close()
+	}()
+	scanner := bufio.NewScanner(stream.Body)
+
+	event, endpoint := readEvent(t, scanner)
+	if event != "endpoint" || !strings.HasPrefix(endpoint, MessagePath+"?sessionId=") {
+		t.Fatalf("Expected the message endpoint first, got %s %q", event, endpoint)
+	}
+
+	resp, err := http.Post(base+endpoint, "application/json", strings.NewReader(`{"jsonrpc":"2.0","id":7,"method":"gateway/list_servers"}`))
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("Expected 202, got %d", resp.StatusCode)
+	}
+
+	event, data := readEvent(t, scanner)
+	var rpcResp mcp.Response
+	if err := json.Unmarshal([]byte(data), &rpcResp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if event != "message" || rpcResp.Error != nil || rpcResp.ID != float64(7) {
+		t.Errorf("Expected the response to request 7, got %s %s", event, data)
+	}
+
+	srv.broadcast(&mcp.Notification{JSONRPC: "2.0", Method: mcp.MethodToolsUpdated})
+	if _, data := readEvent(t, scanner); !strings.Contains(data, mcp.MethodToolsUpdated) {
+		t.Errorf("Expected %s on the stream, got %s", mcp.MethodToolsUpdated, data)
+	}
+}
+
+func TestSSEServer_NotificationsFollowClientPolicy(t *testing.T) {
+	router, changeTools := newPolicyRouter(t)
+	srv := NewSSEServer([]string{"127.0.0.1:0"}, "", router)
+
+	reviewer := &config.ClientConfig{Name: "reviewer", Servers: []string{"github"}}
+	adminSession, _ := srv.newSession(context.Background())
+	reviewerSession, _ := srv.newSession(mcp.WithClient(context.Background(), reviewer))
+	router.AddNotifier(srv.broadcast)
+	router.Route(reviewerSession.ctx, &mcp.Request{JSONRPC: "2.0", ID: 1, Method: mcp.MethodInitialize, Params: json.RawMessage(`{}`)})
+
+	changeTools("filesystem")
+	if len(adminSession.messages) != 1 || len(reviewerSession.messages) != 0 {
+		t.Errorf("Expected list_changed for filesystem to reach the admin alone, got %d and %d", len(adminSession.messages), len(reviewerSession.messages))
+	}
+
+	changeTools("github")
+	if len(adminSession.messages) != 2 || len(reviewerSession.messages) != 1 {
+		t.Errorf("Expected list_changed for github to reach both clients, got %d and %d", len(adminSession.messages), len(reviewerSession.messages))
+	}
+}
+
+func TestSSEServer_UnknownSession(t *testing.T) {
+	srv := newTestSSEServer(t)
+
+	resp, err := http.Post("http://"+srv.Addrs()[0]+MessagePath+"?sessionId=missing", "application/json", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown session, got %d", resp.StatusCode)
+	}
+}
+
+func TestSSEServer_DrainsOnStop(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+
+	// An echo server that takes a while to answer
+	manager := server.NewManager(&config.Config{
+		Servers: []config.ServerConfig{{
+			Name:      "slow",
+			Transport: "stdio",
+			Command:   "sh",
+			Args:      []string{"-c", `while IFS= read -r line; do sleep 0.3; printf '%s\n' "$line"; done | sh -c "$0"`, mcptest.EchoScript},
+			Enabled:   true,
+		}},
+	})
+	if err := manager.Start(); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+	t.Cleanup(manager.Stop)
+
+	srv := NewSSEServer([]string{"127.0.0.1:0"}, "", mcp.NewRouter(manager))
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Failed to start SSE server: %v", err)
+	}
+	base := "http://" + srv.Addrs()[0]
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, base+SSEPath, nil)
+	stream, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer func() {
+		_ = stream.Body.Close()
+	}()
+	scanner := bufio.NewScanner(stream.Body)
+	_, endpoint := readEvent(t, scanner)
+
+	resp, err := http.Post(base+endpoint, "application/json", strings.NewReader(`{"jsonrpc":"2.0","id":9,"method":"tools/call","params":{"name":"echo"}}`))
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	_ = resp.Body.Close()
+
+	// Stopping waits for the accepted request to be answered on the stream
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- srv.Stop(ctx)
+	}()
+	if _, data := readEvent(t, scanner); !strings.Contains(data, `"id":9`) {
+		t.Errorf("Expected the response to request 9 before the stream ended, got %s", data)
+	}
+	if err := <-stopped; err != nil {
+		t.Errorf("Stop failed: %v", err)
+	}
+}
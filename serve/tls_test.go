@@ -0,0 +1,143 @@
+package serve
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/j4ng5y/mcpgate/config"
+	"github.com/j4ng5y/mcpgate/mcp"
+	"github.com/j4ng5y/mcpgate/server"
+)
+
+// testCert is a certificate with its key, signed by a test CA
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// issueCert creates a certificate for 127.0.0.1 signed by parent, or
+// self-signed CA when parent is nil
+func issueCert(t *testing.T, name string, parent *testCert) *testCert {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %v", err)
+	}
+	return &testCert{cert: cert, key: key}
+}
+
+// writePEM writes the certificate and key to dir, returning their paths
+func (c *testCert) writePEM(t *testing.T, dir, name string) (string, string) {
+	t.Helper()
+
+	certPath := filepath.Join(dir, name+".pem")
+	keyPath := filepath.Join(dir, name+".key")
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw}), 0o600); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+	return certPath, keyPath
+}
+
+func TestLoadTLSConfig_Disabled(t *testing.T) {
+	tlsConfig, err := LoadTLSConfig(config.TLSConfig{})
+	if err != nil || tlsConfig != nil {
+		t.Errorf("Expected no TLS without a certificate, got %v, %v", tlsConfig, err)
+	}
+}
+
+func TestHTTPServer_MutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := issueCert(t, "test CA", nil)
+	caPath, _ := ca.writePEM(t, dir, "ca")
+	certPath, keyPath := issueCert(t, "gateway", ca).writePEM(t, dir, "gateway")
+
+	tlsConfig, err := LoadTLSConfig(config.TLSConfig{CertFile: certPath, KeyFile: keyPath, ClientCA: caPath})
+	if err != nil {
+		t.Fatalf("LoadTLSConfig failed: %v", err)
+	}
+
+	manager := server.NewManager(&config.Config{})
+	if err := manager.Start(); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+	t.Cleanup(manager.Stop)
+	srv := NewHTTPServer([]string{"127.0.0.1:0"}, "", mcp.NewRouter(manager))
+	srv.SetTLSConfig(tlsConfig)
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Failed to start HTTP server: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = srv.Stop(t.Context())
+	})
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	clientCert := issueCert(t, "agent", ca)
+	post := func(certs []tls.Certificate) (*http.Response, error) {
+		client := &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs},
+		}}
+		return client.Post("https://"+srv.Addrs()[0]+HTTPPath, "application/json",
+			strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`))
+	}
+
+	if resp, err := post(nil); err == nil {
+		_ = resp.Body.Close()
+		t.Error("Expected a client without a certificate to be refused")
+	}
+
+	resp, err := post([]tls.Certificate{{Certificate: [][]byte{clientCert.cert.Raw}, PrivateKey: clientCert.key}})
+	if err != nil {
+		t.Fatalf("Request with a client certificate failed: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected 200, got %d", resp.StatusCode)
+	}
+}
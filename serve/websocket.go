@@ -0,0 +1,247 @@
+//go:build !nowebsocket && !minimal
+
+package serve
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/j4ng5y/mcpgate/logging"
+	"github.com/j4ng5y/mcpgate/mcp"
+)
+
+// WebSocketPath is the endpoint WebSocket clients connect to
+const WebSocketPath = "/ws"
+
+// wsPingInterval is how often idle connections are pinged so proxies in
+// between keep them open
+const wsPingInterval = 30 * time.Second
+
+// WebSocketServer serves the gateway to clients that connect over
+// WebSocket. Each text message carries one JSON-RPC message, like a line on
+// stdio; requests are routed concurrently and each connection is sent the
+// notifications meant for it.
+type WebSocketServer struct {
+	endpoint
+	router   *mcp.Router
+	upgrader websocket.Upgrader
+
+	mutex sync.Mutex
+	conns map[*wsConn]struct{}
+}
+
+// wsConn is a client connection. Writes are serialized so responses and
+// notifications never interleave.
+type wsConn struct {
+	conn          *websocket.Conn
+	ctx           context.Context // Carries the connection's session and client
+	writeMutex    sync.Mutex
+	notifications chan *mcp.Notification
+}
+
+// NewWebSocketServer creates a WebSocket server for router, listening on
+// addresses once started
+func NewWebSocketServer(addresses []string, family string, router *mcp.Router) *WebSocketServer {
+	s := &WebSocketServer{
+		endpoint: newEndpoint("WebSocket", addresses, family),
+		router:   router,
+		upgrader: websocket.Upgrader{Subprotocols: []string{"mcp"}},
+		conns:    make(map[*wsConn]struct{}),
+	}
+	s.scheme = "ws"
+	return s
+}
+
+// Start opens the listeners and starts serving. Notifications from the
+// router are sent to the connections they are for.
+func (s *WebSocketServer) Start() error {
+	// Origins are checked against the allowed list, by the same rule as the
+	// other server modes, rather than required to match the host
+	s.upgrader.CheckOrigin = s.allowsOrigin
+	mux := http.NewServeMux()
+	mux.HandleFunc(WebSocketPath, s.handleConn)
+	if err := s.start(mux, WebSocketPath); err != nil {
+		return err
+	}
+	s.router.AddNotifier(s.broadcast)
+	return nil
+}
+
+// handleConn upgrades a request and serves the connection until the client
+// closes it or the server stops, then waits for its in-flight requests
+func (s *WebSocketServer) handleConn(w http.ResponseWriter, req *http.Request) {
+	conn, err := s.upgrader.Upgrade(w, req, nil)
+	if err != nil {
+		// The upgrader has already answered with an error
+		return
+	}
+	ctx := mcp.WithNetwork(mcp.WithClient(context.Background(), mcp.ClientFromContext(req.Context())))
+	// Each connection is a session of its own
+	if id, err := newSessionID(); err == nil {
+		ctx = mcp.WithSession(ctx, id)
+	}
+	ctx, cancel := context.WithCancel(mcp.WithServerHint(ctx, req.Header.Get(mcp.ServerHintHeader)))
+	c := &wsConn{conn: conn, ctx: ctx, notifications: make(chan *mcp.Notification, streamBuffer)}
+
+	s.mutex.Lock()
+	s.conns[c] = struct{}{}
+	s.mutex.Unlock()
+
+	var inflight sync.WaitGroup
+	defer func() {
+		cancel()
+		inflight.Wait()
+		s.mutex.Lock()
+		delete(s.conns, c)
+		s.mutex.Unlock()
+		s.router.EndSession(mcp.SessionFromContext(ctx))
+		_ = conn.Close()
+	}()
+
+	// Send notifications and keepalive pings until the connection ends. A
+	// stopping server closes the connection, which ends the read loop below.
+	go func() {
+		ticker := time.NewTicker(wsPingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case notification := <-c.notifications:
+				if err := c.write(notification); err != nil {
+					return
+				}
+			case <-ticker.C:
+				c.writeMutex.Lock()
+				err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second))
+				c.writeMutex.Unlock()
+				if err != nil {
+					return
+				}
+			case <-s.done:
+				_ = conn.Close()
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for {
+		_, reader, err := conn.NextReader()
+		if err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				slog.Info("WebSocket client disconnected", "client", req.RemoteAddr, logging.Err(err))
+			}
+			return
+		}
+		data, err := s.limits.ReadMessage(reader)
+		if errors.Is(err, mcp.ErrRequestTooLarge) {
+			// The message was discarded, so the connection carries on
+			if err := c.write(s.limits.TooLarge()); err != nil {
+				return
+			}
+			continue
+		}
+		if err != nil {
+			slog.Info("WebSocket client disconnected", "client", req.RemoteAddr, logging.Err(err))
+			return
+		}
+
+		request, errResp := s.limits.ParseRequest(data)
+		if errResp != nil {
+			if err := c.write(errResp); err != nil {
+				return
+			}
+			continue
+		}
+
+		if !s.beginRoute() {
+			// Requests are refused while stopping; notifications are dropped
+			if request.ID != nil {
+				if err := c.write(shuttingDown(request)); err != nil {
+					return
+				}
+			}
+			continue
+		}
+		inflight.Add(1)
+		go func() {
+			defer inflight.Done()
+			defer s.routes.Done()
+			ctx, release := mcp.StreamResults(ctx)
+			defer release()
+			resp := s.router.Route(ctx, request)
+			if resp == nil {
+				// Notifications are not answered
+				return
+			}
+			if err := c.writeResponse(resp); err != nil {
+				slog.WarnContext(ctx, "Error writing WebSocket response", logging.Err(err))
+			}
+		}()
+	}
+}
+
+// shuttingDown answers a request that arrived while the server is stopping
+func shuttingDown(request *mcp.Request) *mcp.Response {
+	return &mcp.Response{
+		JSONRPC: "2.0",
+		ID:      request.ID,
+		Error: &mcp.JSONRPCError{
+			Code:    mcp.InternalError,
+			Message: "Gateway is shutting down",
+		},
+	}
+}
+
+// broadcast queues a notification for every connection the router says
+// receives it. A connection that has not caught up misses it.
+func (s *WebSocketServer) broadcast(notification *mcp.Notification) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for c := range s.conns {
+		if !s.router.Receives(c.ctx, notification) {
+			continue
+		}
+		select {
+		case c.notifications <- notification:
+		default:
+			slog.Warn("Dropping notification: too many queued", logging.KeyMethod, notification.Method, "client", c.conn.RemoteAddr().String())
+		}
+	}
+}
+
+// write sends v as a single text message
+func (c *wsConn) write(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	return c.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+// writeResponse sends a response as a single text message, streaming large
+// results in chunks
+func (c *wsConn) writeResponse(resp *mcp.Response) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	w, err := c.conn.NextWriter(websocket.TextMessage)
+	if err != nil {
+		return err
+	}
+	if err := mcp.WriteResponse(w, resp); err != nil {
+		_ = w.Close()
+		return err
+	}
+	return w.Close()
+}
@@ -0,0 +1,26 @@
+//go:build nowebsocket || minimal
+
+package serve
+
+import (
+	"fmt"
+
+	"github.com/j4ng5y/mcpgate/mcp"
+)
+
+// WebSocketServer stands in for the WebSocket server mode, which this build
+// leaves out
+type WebSocketServer struct {
+	endpoint
+}
+
+// NewWebSocketServer returns a server whose Start fails, as WebSocket
+// support is compiled out
+func NewWebSocketServer(addresses []string, family string, _ *mcp.Router) *WebSocketServer {
+	return &WebSocketServer{endpoint: newEndpoint("WebSocket", addresses, family)}
+}
+
+// Start fails: the WebSocket server mode is not included in this build
+func (s *WebSocketServer) Start() error {
+	return fmt.Errorf("WebSocket server mode is not included in this build (built with -tags nowebsocket or minimal)")
+}
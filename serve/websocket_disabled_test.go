@@ -0,0 +1,15 @@
+//go:build nowebsocket || minimal
+
+package serve
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWebSocketServer_CompiledOut(t *testing.T) {
+	err := NewWebSocketServer([]string{"127.0.0.1:0"}, "", nil).Start()
+	if err == nil || !strings.Contains(err.Error(), "not included in this build") {
+		t.Errorf("Expected error when websocket is compiled out, got %v", err)
+	}
+}
@@ -0,0 +1,205 @@
+//go:build !nowebsocket && !minimal
+
+package serve
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/j4ng5y/mcpgate/config"
+	"github.com/j4ng5y/mcpgate/mcp"
+	"github.com/j4ng5y/mcpgate/server"
+)
+
+func TestWebSocketServer_RoundTrip(t *testing.T) {
+	manager := server.NewManager(&config.Config{})
+	if err := manager.Start(); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+	t.Cleanup(manager.Stop)
+
+	srv := NewWebSocketServer([]string{"127.0.0.1:0"}, "", mcp.NewRouter(manager))
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Failed to start WebSocket server: %v", err)
+	}
+	stopped := false
+	t.Cleanup(func() {
+		if !stopped {
+			_ = srv.Stop(context.Background())
+		}
+	})
+
+	header := http.Header{mcp.ServerHintHeader: {"missing"}}
+	conn, _, err := websocket.DefaultDialer.Dial("ws://"+srv.Addrs()[0]+WebSocketPath, header)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	read := func() map[string]interface{} {
+		t.Helper()
+		var message map[string]interface{}
+		if err := conn.ReadJSON(&message); err != nil {
+			t.Fatalf("Read failed: %v", err)
+		}
+		return message
+	}
+
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"jsonrpc":"2.0","id":1,"method":"gateway/list_servers"}`)); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if message := read(); message["id"] != float64(1) || message["error"] != nil {
+		t.Errorf("Expected the response to request 1, got %v", message)
+	}
+
+	// The routing header of the handshake pins every request on the connection
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`)); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	message := read()
+	if rpcErr, _ := message["error"].(map[string]interface{}); rpcErr == nil || rpcErr["code"] != float64(mcp.InvalidParams) {
+		t.Errorf("Expected the request pinned to an unknown server, got %v", message)
+	}
+
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(`{not json`)); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if rpcErr, _ := read()["error"].(map[string]interface{}); rpcErr == nil || rpcErr["code"] != float64(mcp.ParseError) {
+		t.Errorf("Expected a parse error, got %v", rpcErr)
+	}
+
+	// An oversized message is refused without closing the connection
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"jsonrpc":"2.0","id":3,"method":"ping","params":{"pad":"`+strings.Repeat("x", mcp.DefaultMaxRequestSize)+`"}}`)); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if rpcErr, _ := read()["error"].(map[string]interface{}); rpcErr == nil || rpcErr["code"] != float64(mcp.InvalidRequest) {
+		t.Errorf("Expected an oversized request to be refused, got %v", rpcErr)
+	}
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"jsonrpc":"2.0","id":4,"method":"gateway/list_servers"}`)); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if message := read(); message["id"] != float64(4) {
+		t.Errorf("Expected the connection to carry on after an oversized request, got %v", message)
+	}
+
+	srv.broadcast(&mcp.Notification{JSONRPC: "2.0", Method: mcp.MethodToolsUpdated})
+	if message := read(); message["method"] != mcp.MethodToolsUpdated {
+		t.Errorf("Expected %s, got %v", mcp.MethodToolsUpdated, message)
+	}
+
+	// Stopping the server closes the connection
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := srv.Stop(ctx); err != nil {
+		t.Fatalf("Stop failed: %v", err)
+	}
+	stopped = true
+	var ignored json.RawMessage
+	if err := conn.ReadJSON(&ignored); err == nil {
+		t.Error("Expected the connection closed once the server stopped")
+	}
+}
+
+func TestWebSocketServer_NotificationsFollowClientPolicy(t *testing.T) {
+	router, changeTools := newPolicyRouter(t)
+	srv := NewWebSocketServer([]string{"127.0.0.1:0"}, "", router)
+	srv.SetAPIKeys([]string{"admin-key"})
+	srv.SetClients([]config.ClientConfig{{Name: "reviewer", APIKeys: []string{"reviewer-key"}, Servers: []string{"github"}}})
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Failed to start WebSocket server: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = srv.Stop(context.Background())
+	})
+
+	// Each connection is served once it has answered a request
+	dial := func(key string) *websocket.Conn {
+		t.Helper()
+		conn, _, err := websocket.DefaultDialer.Dial("ws://"+srv.Addrs()[0]+WebSocketPath, http.Header{"Authorization": {"Bearer " + key}})
+		if err != nil {
+			t.Fatalf("Dial failed: %v", err)
+		}
+		t.Cleanup(func() {
+			_ = conn.Close()
+		})
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`)); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+		var ignored json.RawMessage
+		if err := conn.ReadJSON(&ignored); err != nil {
+			t.Fatalf("Read failed: %v", err)
+		}
+		return conn
+	}
+	admin := dial("admin-key")
+	reviewer := dial("reviewer-key")
+
+	changeTools("filesystem")
+	changeTools("github")
+
+	count := func(conn *websocket.Conn) int {
+		n := 0
+		for {
+			var message map[string]interface{}
+			_ = conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+			if err := conn.ReadJSON(&message); err != nil {
+				return n
+			}
+			if message["method"] == mcp.MethodToolsUpdated {
+				n++
+			}
+		}
+	}
+	if got := count(admin); got != 2 {
+		t.Errorf("Expected the admin told about both servers, got %d notifications", got)
+	}
+	if got := count(reviewer); got != 1 {
+		t.Errorf("Expected the reviewer told about github alone, got %d notifications", got)
+	}
+}
+
+func TestWebSocketServer_Origin(t *testing.T) {
+	manager := server.NewManager(&config.Config{})
+	if err := manager.Start(); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+	t.Cleanup(manager.Stop)
+
+	srv := NewWebSocketServer([]string{"127.0.0.1:0"}, "", mcp.NewRouter(manager))
+	srv.SetAllowedOrigins([]string{"https://app.example.com"})
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Failed to start WebSocket server: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = srv.Stop(context.Background())
+	})
+
+	dial := func(origin string) (int, error) {
+		conn, resp, err := websocket.DefaultDialer.Dial("ws://"+srv.Addrs()[0]+WebSocketPath, http.Header{"Origin": {origin}})
+		if conn != nil {
+			_ = conn.Close()
+		}
+		if resp == nil {
+			return 0, err
+		}
+		return resp.StatusCode, err
+	}
+
+	if status, err := dial("https://app.example.com"); err != nil {
+		t.Errorf("Expected an allowed origin to connect, got %d: %v", status, err)
+	}
+	// Even an origin naming the gateway's own host is refused unless listed,
+	// as DNS rebinding makes it meaningless
+	if status, _ := dial("http://" + srv.Addrs()[0]); status != http.StatusForbidden {
+		t.Errorf("Expected 403 for an origin not allowed, got %d", status)
+	}
+}
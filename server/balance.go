@@ -0,0 +1,32 @@
+package server
+
+// PickReplica returns the available replica of server's group with the fewest
+// requests in flight, taking turns between replicas that are equally loaded.
+// A server outside a group, or whose group has no routable replica, is
+// returned as is.
+func (m *Manager) PickReplica(server *ManagedServer) *ManagedServer {
+	if server.Config.Group == "" {
+		return server
+	}
+	replicas := m.ListServersByGroup(server.Config.Group)
+	// Replicas come available first; balance across those while there are any
+	for i, replica := range replicas {
+		if !replica.IsAvailable() && i > 0 {
+			replicas = replicas[:i]
+			break
+		}
+	}
+	if len(replicas) == 0 {
+		return server
+	}
+
+	offset := int(m.replicaTurn.Add(1) % uint64(len(replicas)))
+	best, bestLoad := server, -1
+	for i := range replicas {
+		replica := replicas[(offset+i)%len(replicas)]
+		if load := replica.InFlight(); bestLoad < 0 || load < bestLoad {
+			best, bestLoad = replica, load
+		}
+	}
+	return best
+}
@@ -0,0 +1,214 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/j4ng5y/mcpgate/logging"
+)
+
+// Catalog fetching limits
+const (
+	// catalogRefreshTimeout bounds refetching a list after list_changed
+	catalogRefreshTimeout = 30 * time.Second
+	// maxCatalogPages stops following nextCursor from a misbehaving upstream
+	maxCatalogPages = 100
+)
+
+// catalogList is a list method whose items are cached
+type catalogList struct {
+	method     string // e.g. tools/list
+	capability string // capability the server needs to answer it
+	field      string // result field holding the items
+}
+
+// catalogLists are the lists cached for each server after it connects
+var catalogLists = []catalogList{
+	{method: "tools/list", capability: "tools", field: "tools"},
+	{method: "resources/list", capability: "resources", field: "resources"},
+	{method: "prompts/list", capability: "prompts", field: "prompts"},
+}
+
+// catalogState caches the items of a server's list methods. Each method's
+// generation changes when its cache is invalidated, so a fetch that started
+// before the invalidation never stores what it got.
+type catalogState struct {
+	lists       map[string][]json.RawMessage
+	generations map[string]int
+}
+
+// CachedList returns the cached items of a list method such as tools/list,
+// and false when the list is not cached
+func (s *ManagedServer) CachedList(method string) ([]json.RawMessage, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	items, ok := s.catalog.lists[method]
+	if !ok {
+		return nil, false
+	}
+	return append([]json.RawMessage{}, items...), true
+}
+
+// HasTool reports whether the server is known to offer a tool, either from
+// its static tool list or from its cached tools/list
+func (s *ManagedServer) HasTool(name string) bool {
+	for _, tool := range s.StaticTools() {
+		if tool.Name == name {
+			return true
+		}
+	}
+
+	tools, _ := s.CachedList("tools/list")
+	for _, item := range tools {
+		var tool struct {
+			Name string `json:"name"`
+		}
+		if json.Unmarshal(item, &tool) == nil && tool.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// invalidateCatalogLocked drops the cached items of method and returns the
+// generation a new fetch must store under. It must be called with s.mutex held.
+func (s *ManagedServer) invalidateCatalogLocked(method string) int {
+	if s.catalog.generations == nil {
+		s.catalog.generations = make(map[string]int)
+	}
+	delete(s.catalog.lists, method)
+	s.catalog.generations[method]++
+	return s.catalog.generations[method]
+}
+
+// resetCatalogLocked drops every cached list and returns the generations new
+// fetches must store under. It must be called with s.mutex held.
+func (s *ManagedServer) resetCatalogLocked() map[string]int {
+	generations := make(map[string]int, len(catalogLists))
+	for _, list := range catalogLists {
+		generations[list.method] = s.invalidateCatalogLocked(list.method)
+	}
+	return generations
+}
+
+// refreshCatalog fetches every list the server has the capability for
+func (s *ManagedServer) refreshCatalog(ctx context.Context, generations map[string]int) {
+	for _, list := range catalogLists {
+		if s.HasCapability(list.capability) {
+			s.refreshCatalogList(ctx, list, generations[list.method])
+		}
+	}
+}
+
+// refreshCatalogList fetches every page of a list and caches the items,
+// unless the cache was invalidated again in the meantime. Upstreams that
+// cannot answer are left uncached, so their lists are forwarded as before.
+func (s *ManagedServer) refreshCatalogList(ctx context.Context, list catalogList, generation int) {
+	items, err := s.fetchCatalogList(ctx, list)
+	if err != nil {
+		s.logger().Warn("Not caching catalog", "list", list.method, logging.Err(err))
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.catalog.generations[list.method] != generation {
+		return
+	}
+	if s.catalog.lists == nil {
+		s.catalog.lists = make(map[string][]json.RawMessage)
+	}
+	s.catalog.lists[list.method] = items
+}
+
+// fetchCatalogList requests every page of a list from the upstream. It uses
+// the transport directly so catalog fetches never count towards quarantine.
+func (s *ManagedServer) fetchCatalogList(ctx context.Context, list catalogList) ([]json.RawMessage, error) {
+	var items []json.RawMessage
+	cursor := ""
+	for page := 0; page < maxCatalogPages; page++ {
+		req := map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      "mcpgate-catalog",
+			"method":  list.method,
+		}
+		if cursor != "" {
+			req["params"] = map[string]interface{}{"cursor": cursor}
+		}
+
+		resp, err := s.sendWithTimeout(ctx, s.activeTransport(), req)
+		if err != nil {
+			return nil, err
+		}
+
+		var response struct {
+			Result map[string]json.RawMessage `json:"result"`
+			Error  *JSONRPCError              `json:"error"`
+		}
+		if err := json.Unmarshal(resp, &response); err != nil {
+			return nil, err
+		}
+		if response.Error != nil {
+			return nil, response.Error
+		}
+		if response.Result == nil {
+			return nil, fmt.Errorf("response has no result")
+		}
+
+		var pageItems []json.RawMessage
+		if err := json.Unmarshal(response.Result[list.field], &pageItems); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", list.field, err)
+		}
+		items = append(items, pageItems...)
+
+		cursor = ""
+		_ = json.Unmarshal(response.Result["nextCursor"], &cursor)
+		if cursor == "" {
+			return items, nil
+		}
+	}
+	return nil, fmt.Errorf("more than %d pages", maxCatalogPages)
+}
+
+// handleListChanged refetches the list a list_changed notification refers to
+func (s *ManagedServer) handleListChanged(notification json.RawMessage) {
+	var msg struct {
+		Method string `json:"method"`
+	}
+	if json.Unmarshal(notification, &msg) != nil {
+		return
+	}
+	kind, ok := strings.CutPrefix(msg.Method, "notifications/")
+	if !ok {
+		return
+	}
+	kind, ok = strings.CutSuffix(kind, "/list_changed")
+	if !ok {
+		return
+	}
+
+	for _, list := range catalogLists {
+		if list.field != kind {
+			continue
+		}
+
+		s.mutex.Lock()
+		generation := s.invalidateCatalogLocked(list.method)
+		s.mutex.Unlock()
+
+		// The transport's reader delivers the response, so never wait for it
+		// here. Once refetched, the router compares the items and tells
+		// clients if the aggregated catalog changed.
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), catalogRefreshTimeout)
+			defer cancel()
+			s.refreshCatalogList(ctx, list, generation)
+			s.stateChanged()
+		}()
+	}
+}
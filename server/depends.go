@@ -0,0 +1,120 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/j4ng5y/mcpgate/config"
+	"github.com/j4ng5y/mcpgate/logging"
+)
+
+// dependenciesConnected returns an error naming the first dependency of cfg
+// with nothing connected. A dependency on a replica group is met by any
+// connected replica.
+func (m *Manager) dependenciesConnected(cfg config.ServerConfig) error {
+	for _, dependency := range cfg.DependsOn {
+		if !slices.ContainsFunc(m.dependencyServers(dependency), (*ManagedServer).IsConnected) {
+			return fmt.Errorf("dependency %s is not connected", dependency)
+		}
+	}
+	return nil
+}
+
+// dependencyServers returns the servers a dependency names: the server of
+// that name, or otherwise the replicas of that group
+func (m *Manager) dependencyServers(dependency string) []*ManagedServer {
+	if server, err := m.registry.Get(dependency); err == nil {
+		return []*ManagedServer{server}
+	}
+	return m.registry.ListByGroup(dependency)
+}
+
+// dependents returns the servers that directly depend on the named server,
+// either by name or through its replica group
+func (m *Manager) dependents(name string) []*ManagedServer {
+	var result []*ManagedServer
+	for _, server := range m.registry.List() {
+		for _, dependency := range server.Config.DependsOn {
+			if slices.ContainsFunc(m.dependencyServers(dependency), func(s *ManagedServer) bool { return s.Name == name }) {
+				result = append(result, server)
+				break
+			}
+		}
+	}
+	return result
+}
+
+// handleEvent publishes a server's lifecycle event to subscribers, then
+// starts the servers waiting for it to connect, or restarts the servers that
+// depend on it after it was restarted
+func (m *Manager) handleEvent(event Event) {
+	m.events.publish(event)
+
+	if !m.started.Load() {
+		return
+	}
+	switch event.Type {
+	case EventConnected:
+		go m.startDependents(event.Server)
+	case EventRestarted:
+		go m.restartDependents(event.Server)
+	}
+}
+
+// startDependents connects the dependents of a server that were left
+// disconnected until their dependencies were up
+func (m *Manager) startDependents(name string) {
+	for _, server := range m.dependents(name) {
+		if m.stopping() || server.Config.Lazy || server.State() != "disconnected" {
+			continue
+		}
+		if err := m.dependenciesConnected(server.Config); err != nil {
+			continue
+		}
+
+		server.logger().Info("Starting server now that its dependency is connected", "dependency", name)
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		if err := m.connectWithRetry(ctx, server); err != nil {
+			server.logger().Error("Failed to connect server after retries", logging.Err(err))
+		}
+		cancel()
+		m.notifyChange()
+	}
+}
+
+// restartDependents restarts the connected dependents of a server that was
+// restarted, so they reconnect to it; their own dependents follow in turn
+func (m *Manager) restartDependents(name string) {
+	for _, server := range m.dependents(name) {
+		if m.stopping() || server.State() != "connected" {
+			continue
+		}
+
+		server.logger().Info("Restarting server after its dependency restarted", "dependency", name)
+		if err := m.ReconnectServer(server.Name); err != nil {
+			server.logger().Error("Failed to restart server", logging.Err(err))
+			continue
+		}
+		server.publish(Event{Type: EventRestarted})
+	}
+}
+
+// stopping reports whether the manager is shutting down
+func (m *Manager) stopping() bool {
+	select {
+	case <-m.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// checkDependencies refuses to connect the server while a dependency is down
+func (s *ManagedServer) checkDependencies() error {
+	if s.dependencies == nil || len(s.Config.DependsOn) == 0 || s.IsConnected() {
+		return nil
+	}
+	return s.dependencies()
+}
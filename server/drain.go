@@ -0,0 +1,61 @@
+package server
+
+import (
+	"context"
+	"sync"
+)
+
+// drainState tracks the requests in flight on a server, so it can be drained
+// before it is removed and replicas can be balanced by load
+type drainState struct {
+	draining bool
+	inflight sync.WaitGroup
+	count    int
+}
+
+// beginRequestLocked counts a request in flight and reports false once the
+// server is draining. It must be called with s.mutex held.
+func (s *ManagedServer) beginRequestLocked() bool {
+	if s.drain.draining {
+		return false
+	}
+	s.drain.inflight.Add(1)
+	s.drain.count++
+	return true
+}
+
+// finishRequest counts a request started with beginRequestLocked as done
+func (s *ManagedServer) finishRequest() {
+	s.mutex.Lock()
+	s.drain.count--
+	s.mutex.Unlock()
+	s.drain.inflight.Done()
+}
+
+// InFlight returns the number of requests the server is handling
+func (s *ManagedServer) InFlight() int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.drain.count
+}
+
+// Drain stops the server from accepting requests and waits until the ones in
+// flight have finished or ctx is done
+func (s *ManagedServer) Drain(ctx context.Context) error {
+	s.mutex.Lock()
+	s.drain.draining = true
+	s.mutex.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		s.drain.inflight.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
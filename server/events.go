@@ -0,0 +1,130 @@
+package server
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/j4ng5y/mcpgate/logging"
+)
+
+// DefaultEventBuffer is the number of events a subscription holds for a
+// subscriber that has not caught up
+const DefaultEventBuffer = 64
+
+// Lifecycle events published in addition to EventConnected and EventDisconnected
+const (
+	EventRestarted   = "restarted"   // Reconnected by the restart policy, or a standby took over, after dropping
+	EventDegraded    = "degraded"    // Health checks report it degraded or unhealthy
+	EventRecovered   = "recovered"   // Health checks report it healthy again
+	EventQuarantined = "quarantined" // Taken out of routing after repeated failures
+
+	EventPoolCircuitOpen   = "pool_circuit_open"   // Every pooled connection is unhealthy; the pool is cooling down
+	EventPoolCircuitClosed = "pool_circuit_closed" // A pooled connection is healthy again
+)
+
+// Event is a change in a server's lifecycle
+type Event struct {
+	Type   string
+	Server string
+	Time   time.Time
+	Health string // Health status, for EventDegraded
+	Err    error  // Cause of a disconnect or quarantine
+}
+
+// EventHandler receives a server's lifecycle events
+type EventHandler func(event Event)
+
+// SetEventHandler sets the handler for lifecycle events from this server
+func (s *ManagedServer) SetEventHandler(handler EventHandler) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.onEvent = handler
+}
+
+// publish delivers a lifecycle event to the event handler, if any. It must
+// not be called with s.mutex held.
+func (s *ManagedServer) publish(event Event) {
+	s.mutex.RLock()
+	handler := s.onEvent
+	s.mutex.RUnlock()
+
+	event.Server = s.Name
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	if handler != nil {
+		handler(event)
+	}
+}
+
+// eventBus fans lifecycle events out to subscribers. Publishing never blocks:
+// a subscriber whose buffer is full misses the event.
+type eventBus struct {
+	mutex       sync.Mutex
+	subscribers map[chan Event]struct{}
+	closed      bool
+}
+
+// Subscribe returns a channel receiving the lifecycle events of every server,
+// holding up to buffer events (DefaultEventBuffer if not positive), and a
+// function that ends the subscription. The channel is closed when the
+// subscription ends or the manager stops.
+func (m *Manager) Subscribe(buffer int) (<-chan Event, func()) {
+	return m.events.subscribe(buffer)
+}
+
+// subscribe adds a subscriber
+func (b *eventBus) subscribe(buffer int) (<-chan Event, func()) {
+	if buffer <= 0 {
+		buffer = DefaultEventBuffer
+	}
+	ch := make(chan Event, buffer)
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	if b.subscribers == nil {
+		b.subscribers = make(map[chan Event]struct{})
+	}
+	b.subscribers[ch] = struct{}{}
+
+	return ch, func() {
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+		if _, ok := b.subscribers[ch]; ok {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// publish delivers an event to every subscriber with room for it
+func (b *eventBus) publish(event Event) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			slog.Warn("Dropping event for a slow subscriber", "event", event.Type, logging.Server(event.Server))
+		}
+	}
+}
+
+// close ends every subscription; later subscriptions end straight away
+func (b *eventBus) close() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for ch := range b.subscribers {
+		close(ch)
+	}
+	b.subscribers = nil
+	b.closed = true
+}
@@ -0,0 +1,216 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/j4ng5y/mcpgate/transport"
+)
+
+// Health check defaults used when the gateway config leaves them unset
+const (
+	DefaultHealthInterval     = 30 * time.Second
+	DefaultHealthTimeout      = 5 * time.Second
+	DefaultUnhealthyThreshold = 3
+)
+
+// Health states reported for upstream servers
+const (
+	HealthUnknown   = "unknown"   // Not connected, or not checked yet
+	HealthHealthy   = "healthy"   // Answered the last ping
+	HealthDegraded  = "degraded"  // Missed pings, fewer than the unhealthy threshold
+	HealthUnhealthy = "unhealthy" // Missed at least the unhealthy threshold of pings in a row
+)
+
+// HealthStatus is the outcome of a server's recent health checks
+type HealthStatus struct {
+	Status              string
+	LastCheck           time.Time
+	LastLatency         time.Duration
+	ConsecutiveFailures int
+	LastError           string
+}
+
+// healthState tracks the health checks of a server
+type healthState struct {
+	HealthStatus
+	unhealthyThreshold int
+}
+
+// Health returns the server's current health
+func (s *ManagedServer) Health() HealthStatus {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	health := s.health.HealthStatus
+	if health.Status == "" {
+		health.Status = HealthUnknown
+	}
+	return health
+}
+
+// SetUnhealthyThreshold sets how many consecutive missed pings mark the
+// server unhealthy; zero uses DefaultUnhealthyThreshold
+func (s *ManagedServer) SetUnhealthyThreshold(threshold int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.health.unhealthyThreshold = threshold
+}
+
+// CheckHealth pings the server and records the outcome. Any answer, even an
+// error from a server that does not implement ping, counts as healthy; only
+// a missing answer is a failure. A server with a health_probe is sent that
+// instead, and any answer but the expected one is a failure. Health checks
+// never count towards quarantine.
+func (s *ManagedServer) CheckHealth(ctx context.Context) HealthStatus {
+	s.mutex.RLock()
+	ready := s.connected && s.initialized
+	s.mutex.RUnlock()
+
+	if !ready {
+		s.mutex.Lock()
+		s.health.HealthStatus = HealthStatus{Status: HealthUnknown}
+		s.mutex.Unlock()
+		return s.Health()
+	}
+
+	start := time.Now()
+	var err error
+	if prober, ok := s.healthProber(); ok {
+		err = prober.Probe(ctx)
+	} else {
+		_, err = s.activeTransport().SendRequest(ctx, map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      "mcpgate-health",
+			"method":  "ping",
+		})
+	}
+	latency := time.Since(start)
+
+	s.mutex.Lock()
+	previous := s.health.Status
+	s.health.LastCheck = start
+	s.health.LastLatency = latency
+	if err == nil {
+		s.health.Status = HealthHealthy
+		s.health.ConsecutiveFailures = 0
+		s.health.LastError = ""
+	} else {
+		threshold := s.health.unhealthyThreshold
+		if threshold <= 0 {
+			threshold = DefaultUnhealthyThreshold
+		}
+		s.health.ConsecutiveFailures++
+		s.health.LastError = err.Error()
+		s.health.Status = HealthDegraded
+		if s.health.ConsecutiveFailures >= threshold {
+			s.health.Status = HealthUnhealthy
+		}
+	}
+	current := s.health.Status
+	s.mutex.Unlock()
+
+	if current != previous && (previous != "" || current != HealthHealthy) {
+		s.logger().Info("Server health changed", "health", current)
+	}
+	switch {
+	case current == previous:
+	case current == HealthHealthy && (previous == HealthDegraded || previous == HealthUnhealthy):
+		s.publish(Event{Type: EventRecovered, Health: current})
+	case current == HealthDegraded || current == HealthUnhealthy:
+		s.publish(Event{Type: EventDegraded, Health: current})
+	}
+	return s.Health()
+}
+
+// healthInterval returns the configured health check interval; a negative
+// interval disables health checks
+func (m *Manager) healthInterval() time.Duration {
+	interval := m.config.Gateway.HealthCheck.Interval
+	if interval == 0 {
+		return DefaultHealthInterval
+	}
+	return time.Duration(interval) * time.Second
+}
+
+// healthTimeout returns how long a ping may take before it counts as missed
+func (m *Manager) healthTimeout() time.Duration {
+	if m.config.Gateway.HealthCheck.Timeout > 0 {
+		return time.Duration(m.config.Gateway.HealthCheck.Timeout) * time.Second
+	}
+	return DefaultHealthTimeout
+}
+
+// healthTick returns how often the health loop runs: the shortest of the
+// gateway's interval and any health probe's, or zero when nothing is checked
+func (m *Manager) healthTick() time.Duration {
+	tick := m.healthInterval()
+	for _, cfg := range m.config.Servers {
+		if cfg.HealthProbe == nil || cfg.HealthProbe.Interval <= 0 {
+			continue
+		}
+		if interval := time.Duration(cfg.HealthProbe.Interval) * time.Second; tick <= 0 || interval < tick {
+			tick = interval
+		}
+	}
+	return max(tick, 0)
+}
+
+// healthInterval returns how often the server is checked: its health probe's
+// interval if set, and otherwise the gateway's
+func (s *ManagedServer) healthInterval(gateway time.Duration) time.Duration {
+	if s.Config.HealthProbe != nil && s.Config.HealthProbe.Interval > 0 {
+		return time.Duration(s.Config.HealthProbe.Interval) * time.Second
+	}
+	return gateway
+}
+
+// healthProber returns the transport's health probe, if the server has one
+func (s *ManagedServer) healthProber() (transport.HealthProber, bool) {
+	if s.Config.HealthProbe == nil {
+		return nil, false
+	}
+	prober, ok := s.activeTransport().(transport.HealthProber)
+	return prober, ok
+}
+
+// healthLoop periodically checks every server due a check until the manager stops
+func (m *Manager) healthLoop(tick time.Duration) {
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			m.checkHealth(now, tick)
+		case <-m.done:
+			return
+		}
+	}
+}
+
+// checkHealth concurrently checks every enabled, unquarantined server whose
+// interval has passed since its last check. A check is due up to half a tick
+// early, so one that ran a little late is not put off a whole tick.
+func (m *Manager) checkHealth(now time.Time, tick time.Duration) {
+	timeout := m.healthTimeout()
+	gateway := m.healthInterval()
+	for _, server := range m.ListServers() {
+		if server.IsDisabled() || server.IsQuarantined() || server.OffSchedule() {
+			continue
+		}
+		interval := server.healthInterval(gateway)
+		if interval <= 0 {
+			continue
+		}
+		if last := server.Health().LastCheck; !last.IsZero() && now.Sub(last) < interval-tick/2 {
+			continue
+		}
+
+		go func(server *ManagedServer) {
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			server.CheckHealth(ctx)
+		}(server)
+	}
+}
@@ -0,0 +1,103 @@
+package server
+
+import "time"
+
+// maxConnectionEvents is how many connection events a server remembers
+const maxConnectionEvents = 20
+
+// Connection events recorded in a server's history
+const (
+	EventConnected    = "connected"
+	EventDisconnected = "disconnected"
+)
+
+// ConnectionEvent is a server connecting or disconnecting
+type ConnectionEvent struct {
+	Time  time.Time
+	Event string
+	Error string
+}
+
+// ConnectionHistory is a server's recent connection activity
+type ConnectionHistory struct {
+	LastError      string
+	LastErrorAt    time.Time
+	ConnectedAt    time.Time
+	DisconnectedAt time.Time
+	LastSuccessAt  time.Time
+	TotalRestarts  int
+	Events         []ConnectionEvent // Oldest first
+}
+
+// historyState records a server's connection activity
+type historyState struct {
+	lastErrorAt    time.Time
+	disconnectedAt time.Time
+	lastSuccessAt  time.Time
+	totalRestarts  int
+	events         []ConnectionEvent
+}
+
+// History returns the server's last error and recent connection activity
+func (s *ManagedServer) History() ConnectionHistory {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	history := ConnectionHistory{
+		LastErrorAt:    s.history.lastErrorAt,
+		ConnectedAt:    s.reconnect.upSince,
+		DisconnectedAt: s.history.disconnectedAt,
+		LastSuccessAt:  s.history.lastSuccessAt,
+		TotalRestarts:  s.history.totalRestarts,
+		Events:         append([]ConnectionEvent{}, s.history.events...),
+	}
+	if s.lastError != nil {
+		history.LastError = s.lastError.Error()
+	}
+	return history
+}
+
+// Uptime returns how long the server has been connected, or zero when it is not
+func (s *ManagedServer) Uptime() time.Duration {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if !s.connected || s.reconnect.upSince.IsZero() {
+		return 0
+	}
+	return time.Since(s.reconnect.upSince)
+}
+
+// recordErrorLocked stores err as the server's last error. It must be called
+// with s.mutex held.
+func (s *ManagedServer) recordErrorLocked(err error) {
+	s.lastError = err
+	s.history.lastErrorAt = time.Now()
+}
+
+// recordConnectedLocked notes that the server connected. It must be called
+// with s.mutex held.
+func (s *ManagedServer) recordConnectedLocked() {
+	s.reconnect.upSince = time.Now()
+	s.addEventLocked(ConnectionEvent{Time: s.reconnect.upSince, Event: EventConnected})
+}
+
+// recordDisconnectedLocked notes that the server disconnected, because of err
+// if it is not nil. It must be called with s.mutex held.
+func (s *ManagedServer) recordDisconnectedLocked(err error) {
+	s.history.disconnectedAt = time.Now()
+	event := ConnectionEvent{Time: s.history.disconnectedAt, Event: EventDisconnected}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	s.addEventLocked(event)
+}
+
+// addEventLocked appends to the connection history, dropping the oldest
+// event once it is full. It must be called with s.mutex held.
+func (s *ManagedServer) addEventLocked(event ConnectionEvent) {
+	if len(s.history.events) >= maxConnectionEvents {
+		s.history.events = append(s.history.events[:0], s.history.events[1:]...)
+	}
+	s.history.events = append(s.history.events, event)
+}
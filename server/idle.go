@@ -0,0 +1,76 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/j4ng5y/mcpgate/logging"
+)
+
+// idleCheckInterval is how often the manager looks for idle servers
+const idleCheckInterval = 5 * time.Second
+
+// idleTimeout returns how long the server may go unused before it is
+// disconnected, or zero when it stays connected
+func (s *ManagedServer) idleTimeout() time.Duration {
+	return time.Duration(s.Config.IdleTimeout) * time.Second
+}
+
+// disconnectIfIdle disconnects the server when it has been connected and
+// unused for its idle timeout as of now, and reports whether it did. The next
+// request connects it again.
+func (s *ManagedServer) disconnectIfIdle(ctx context.Context, now time.Time) bool {
+	timeout := s.idleTimeout()
+	if timeout <= 0 {
+		return false
+	}
+
+	// Checked and disconnected under one lock, so no request starts in between
+	s.mutex.Lock()
+	idle := s.connected && !s.disabled && !s.drain.draining && s.drain.count == 0 && now.Sub(s.lastUsed) >= timeout
+	var err error
+	if idle {
+		s.idleDisconnected = true
+		_, err = s.disconnectLocked(ctx)
+	}
+	s.mutex.Unlock()
+
+	if !idle {
+		return false
+	}
+
+	s.logger().Info("Disconnected idle server", "idle", timeout)
+	if err != nil {
+		s.logger().Warn("Error disconnecting idle server", logging.Err(err))
+	}
+	s.publish(Event{Type: EventDisconnected})
+	return true
+}
+
+// idleLoop periodically disconnects idle servers until the manager stops
+func (m *Manager) idleLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			m.disconnectIdle(now)
+		case <-m.done:
+			return
+		}
+	}
+}
+
+// disconnectIdle disconnects every server idle beyond its idle_timeout. They
+// stay in the catalog, so clients never notice. Pooled connections unused for
+// DefaultPoolIdleTime or past max_conn_lifetime are closed too, and replaced
+// up to pool_warm_up.
+func (m *Manager) disconnectIdle(now time.Time) {
+	for _, server := range m.ListServers() {
+		ctx, cancel := context.WithTimeout(context.Background(), DefaultShutdownTimeout)
+		server.disconnectIfIdle(ctx, now)
+		server.cleanPool(ctx)
+		cancel()
+	}
+}
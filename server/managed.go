@@ -3,59 +3,231 @@ package server
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
 	"sync"
 	"time"
 
 	"github.com/j4ng5y/mcpgate/config"
+	"github.com/j4ng5y/mcpgate/logging"
+	"github.com/j4ng5y/mcpgate/pool"
 	"github.com/j4ng5y/mcpgate/transport"
 )
 
 // ManagedServer wraps an upstream MCP server with connection management
 type ManagedServer struct {
-	Name        string
-	Config      config.ServerConfig
-	Transport   transport.Transport
-	Capabilities []string
-	Metadata    map[string]interface{}
+	Name      string
+	Config    config.ServerConfig
+	Transport transport.Transport
+	Metadata  map[string]interface{}
+
+	// Guarded by mutex and read through Capabilities, as reconnecting rewrites them
+	capabilities []string
 
 	mutex       sync.RWMutex
 	initialized bool
 	connected   bool
 	lastError   error
 	lastUsed    time.Time
+	disabled    bool
+	serverInfo  ServerInfo
+
+	// idleDisconnected is set while the server is disconnected for being
+	// idle, so the next request connects it again
+	idleDisconnected bool
+
+	notifyHandler  NotificationHandler
+	quarantine     quarantineState
+	reconnect      reconnectState
+	health         healthState
+	drain          drainState
+	catalog        catalogState
+	retry          retryPolicy
+	queue          queueState
+	history        historyState
+	schedule       scheduleState
+	standby        standbyState
+	dependencies   func() error // Reports a dependency that is not connected
+	metrics        requestMetrics
+	pool           *pool.ConnectionPool // Extra connections for requests in parallel, with pool_size
+	pooledRequests pooledRequests
+	onEvent        EventHandler
 }
 
+// ProtocolVersion is the MCP protocol version the gateway speaks to upstreams
+const ProtocolVersion = "2024-11-05"
+
+// NotificationHandler receives notifications sent by an upstream server
+type NotificationHandler func(serverName string, notification json.RawMessage)
+
 // NewManagedServer creates a new managed server
 func NewManagedServer(cfg config.ServerConfig) (*ManagedServer, error) {
-	factory := transport.NewFactory()
-
-	// Convert config to map for transport
-	configMap := map[string]interface{}{
-		"command":     cfg.Command,
-		"args":        cfg.Args,
-		"env":         cfg.Env,
-		"url":         cfg.URL,
-		"socket_path": cfg.SocketPath,
-		"timeout":     cfg.Timeout,
+	t, err := newTransport(cfg)
+	if err != nil {
+		return nil, err
 	}
 
-	t, err := factory.Create(cfg.Transport, configMap)
+	schedule, err := newScheduleState(cfg, time.Now())
 	if err != nil {
 		return nil, err
 	}
 
-	return &ManagedServer{
-		Name:        cfg.Name,
-		Config:      cfg,
-		Transport:   t,
-		Capabilities: []string{},
-		Metadata:    cfg.Metadata,
-	}, nil
+	s := &ManagedServer{
+		Name:         cfg.Name,
+		Config:       cfg,
+		Transport:    t,
+		capabilities: append([]string{}, cfg.Capabilities...),
+		Metadata:     cfg.Metadata,
+		queue:        newQueueState(cfg),
+		schedule:     schedule,
+		pool:         newServerPool(cfg),
+	}
+
+	if s.pool != nil {
+		s.pool.SetCircuitHandler(s.poolCircuitChanged)
+	}
+
+	if source, ok := t.(transport.NotificationSource); ok {
+		source.SetNotificationHandler(s.handleNotification)
+	}
+	if source, ok := t.(transport.DisconnectSource); ok {
+		source.SetDisconnectHandler(s.handleConnectionLost)
+	}
+
+	return s, nil
+}
+
+// newTransport creates the transport a server's config describes
+func newTransport(cfg config.ServerConfig) (transport.Transport, error) {
+	return transport.NewFactory().Create(cfg.Transport, transportConfig(cfg))
+}
+
+// transportConfig converts a server's config to the map transports are created from
+func transportConfig(cfg config.ServerConfig) map[string]interface{} {
+	configMap := map[string]interface{}{
+		"name":            cfg.Name,
+		"command":         cfg.Command,
+		"args":            cfg.Args,
+		"env":             cfg.Env,
+		"url":             cfg.URL,
+		"socket_path":     cfg.SocketPath,
+		"wait_for_socket": cfg.WaitForSocket,
+		"response_buffer": cfg.ResponseBuffer,
+		"overflow_policy": cfg.OverflowPolicy,
+		"timeout":         cfg.Timeout,
+		"headers":         cfg.Headers,
+		"auth_token":      cfg.AuthToken,
+		"proxy_url":       cfg.ProxyURL,
+		"max_retries":     cfg.MaxRetries,
+		"max_retry_delay": cfg.MaxRetryDelay,
+		"hosts":           cfg.Hosts,
+		"dns_server":      cfg.DNSServer,
+		"stderr_lines":    cfg.StderrLines,
+		"shutdown_grace":  cfg.ShutdownGrace,
+		"framing":         cfg.Framing,
+		"cwd":             cfg.Cwd,
+		"umask":           cfg.Umask,
+		"image":           cfg.Image,
+		"docker_args":     cfg.DockerArgs,
+		"docker_command":  cfg.DockerCommand,
+		"subprotocols":    cfg.Subprotocols,
+		"ping_interval":   cfg.PingInterval,
+		"read_timeout":    cfg.ReadTimeout,
+	}
+	if cfg.OAuth2 != nil {
+		configMap["oauth2"] = map[string]interface{}{
+			"token_url":     cfg.OAuth2.TokenURL,
+			"client_id":     cfg.OAuth2.ClientID,
+			"client_secret": cfg.OAuth2.ClientSecret,
+			"scopes":        cfg.OAuth2.Scopes,
+			"audience":      cfg.OAuth2.Audience,
+		}
+	}
+
+	if cfg.InheritEnv != nil {
+		configMap["inherit_env"] = *cfg.InheritEnv
+	}
+	if len(cfg.EnvAllowlist) > 0 {
+		configMap["env_allowlist"] = cfg.EnvAllowlist
+	}
+	if cfg.UID != nil {
+		configMap["uid"] = *cfg.UID
+	}
+	if cfg.GID != nil {
+		configMap["gid"] = *cfg.GID
+	}
+	if cfg.HealthProbe != nil {
+		configMap["health_probe"] = map[string]interface{}{
+			"path":            cfg.HealthProbe.Path,
+			"method":          cfg.HealthProbe.Method,
+			"expected_status": cfg.HealthProbe.ExpectedStatus,
+		}
+	}
+	if cfg.SSH != nil {
+		configMap["ssh"] = map[string]interface{}{
+			"host":             cfg.SSH.Host,
+			"port":             cfg.SSH.Port,
+			"user":             cfg.SSH.User,
+			"identity_file":    cfg.SSH.IdentityFile,
+			"agent":            cfg.SSH.Agent,
+			"known_hosts_file": cfg.SSH.KnownHostsFile,
+			"options":          cfg.SSH.Options,
+			"client":           cfg.SSH.Client,
+		}
+	}
+
+	return configMap
+}
+
+// SetNotificationHandler sets the handler for notifications from this server
+func (s *ManagedServer) SetNotificationHandler(handler NotificationHandler) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.notifyHandler = handler
+}
+
+// handleNotification forwards a transport notification to the registered handler
+func (s *ManagedServer) handleNotification(notification json.RawMessage) {
+	s.handleListChanged(notification)
+
+	s.mutex.RLock()
+	handler := s.notifyHandler
+	s.mutex.RUnlock()
+
+	if handler != nil {
+		handler(s.Name, notification)
+	}
 }
 
 // Connect establishes a connection to the upstream server
 func (s *ManagedServer) Connect(ctx context.Context) error {
+	if err := s.checkDependencies(); err != nil {
+		return err
+	}
+	ctx = logging.With(ctx, logging.Server(s.Name))
+
+	// Deferred first so these run after the lock is released
+	quarantined, connected := false, false
+	var connectErr error
+	var catalogGenerations map[string]int
+	defer func() {
+		if connected {
+			s.publish(Event{Type: EventConnected})
+			if s.Config.Standby > 0 {
+				go s.fillStandby()
+			}
+		}
+		if quarantined {
+			s.publish(Event{Type: EventQuarantined, Err: connectErr})
+			s.stateChanged()
+		}
+		if catalogGenerations != nil {
+			s.refreshCatalog(ctx, catalogGenerations)
+		}
+	}()
+
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
@@ -64,8 +236,10 @@ func (s *ManagedServer) Connect(ctx context.Context) error {
 	}
 
 	if err := s.Transport.Connect(ctx); err != nil {
-		s.lastError = err
-		log.Printf("Failed to connect to server %s: %v", s.Name, err)
+		connectErr = err
+		s.recordErrorLocked(err)
+		quarantined = s.recordFailureLocked()
+		s.logger().Warn("Failed to connect to server", logging.Err(err))
 		return err
 	}
 
@@ -75,31 +249,49 @@ func (s *ManagedServer) Connect(ctx context.Context) error {
 	// Initialize the server
 	if err := s.initialize(ctx); err != nil {
 		s.connected = false
-		s.lastError = err
-		log.Printf("Failed to initialize server %s: %v", s.Name, err)
+		connectErr = err
+		s.recordErrorLocked(err)
+		quarantined = s.recordFailureLocked()
+		s.logger().Warn("Failed to initialize server", logging.Err(err))
 		return err
 	}
 
+	s.recordSuccessLocked()
+	s.recordConnectedLocked()
+	s.idleDisconnected = false
+	catalogGenerations = s.resetCatalogLocked()
+	connected = true
 	return nil
 }
 
 // initialize sends the initialize request to the server
 func (s *ManagedServer) initialize(ctx context.Context) error {
+	result, err := s.handshake(ctx, s.Transport, s.initializeParams())
+	if err != nil {
+		return err
+	}
+	s.applyInitializeLocked(result)
+	return nil
+}
+
+// handshake initializes the upstream at the other end of t and returns its
+// initialize result
+func (s *ManagedServer) handshake(ctx context.Context, t transport.Transport, params map[string]interface{}) (map[string]interface{}, error) {
 	req := map[string]interface{}{
 		"jsonrpc": "2.0",
 		"id":      1,
 		"method":  "initialize",
-		"params":  map[string]interface{}{},
+		"params":  params,
 	}
 
-	resp, err := s.Transport.SendRequest(ctx, req)
+	resp, err := s.sendWithTimeout(ctx, t, req)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	var response map[string]interface{}
 	if err := json.Unmarshal(resp, &response); err != nil {
-		return err
+		return nil, err
 	}
 
 	// Check for error in response
@@ -108,39 +300,226 @@ func (s *ManagedServer) initialize(ctx context.Context) error {
 		if ok {
 			code, _ := errMap["code"].(float64)
 			message, _ := errMap["message"].(string)
-			return &JSONRPCError{
+			return nil, &JSONRPCError{
 				Code:    int(code),
 				Message: message,
 			}
 		}
 	}
 
+	// Completes the handshake, whenever the server connects; a server that
+	// went away is noticed by its transport
+	if err := t.SendNotification(ctx, map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "notifications/initialized",
+	}); err != nil {
+		s.logger().Warn("Failed to send notifications/initialized", logging.Err(err))
+	}
+
+	result, _ := response["result"].(map[string]interface{})
+	return result, nil
+}
+
+// applyInitializeLocked takes the capabilities and server info from an
+// initialize result. It must be called with s.mutex held.
+func (s *ManagedServer) applyInitializeLocked(result map[string]interface{}) {
+	s.capabilities = s.resolveCapabilities(discoveredCapabilities(result))
+	s.serverInfo = serverInfoFrom(result)
 	s.initialized = true
-	return nil
+}
+
+// ServerInfo identifies the upstream implementation, as reported in its
+// initialize result
+type ServerInfo struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// serverInfoFrom reads the serverInfo of an initialize result
+func serverInfoFrom(result map[string]interface{}) ServerInfo {
+	info, _ := result["serverInfo"].(map[string]interface{})
+	name, _ := info["name"].(string)
+	version, _ := info["version"].(string)
+	return ServerInfo{Name: name, Version: version}
+}
+
+// ServerInfo returns the name and version the upstream reported when it was
+// last initialized; both are empty if it has not been or did not say
+func (s *ManagedServer) ServerInfo() ServerInfo {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.serverInfo
+}
+
+// discoverableCapabilities are the server capabilities read from an
+// initialize result, in the order they are reported
+var discoverableCapabilities = []string{"tools", "resources", "prompts", "logging"}
+
+// discoveredCapabilities returns the capabilities an upstream declared in its
+// initialize result
+func discoveredCapabilities(result map[string]interface{}) []string {
+	declared, _ := result["capabilities"].(map[string]interface{})
+
+	var capabilities []string
+	for _, capability := range discoverableCapabilities {
+		if _, ok := declared[capability]; ok {
+			capabilities = append(capabilities, capability)
+		}
+	}
+	return capabilities
+}
+
+// resolveCapabilities combines discovered capabilities with the static ones
+// from config: static capabilities win in override mode, and otherwise only
+// stand in when the upstream declared none
+func (s *ManagedServer) resolveCapabilities(discovered []string) []string {
+	static := append([]string{}, s.Config.Capabilities...)
+	if len(discovered) == 0 || (s.OverridesDiscovery() && len(static) > 0) {
+		return static
+	}
+	return discovered
+}
+
+// initializeParams builds the params the gateway sends when initializing upstream.
+// No client capabilities are advertised: the gateway does not relay requests
+// from upstreams to the client, such as sampling/createMessage or roots/list,
+// so upstreams must not send them.
+func (s *ManagedServer) initializeParams() map[string]interface{} {
+	return map[string]interface{}{
+		"protocolVersion": ProtocolVersion,
+		"capabilities":    map[string]interface{}{},
+		"clientInfo": map[string]interface{}{
+			"name":    "mcpgate",
+			"version": "1.0.0",
+		},
+	}
 }
 
 // Disconnect closes the connection to the upstream server
 func (s *ManagedServer) Disconnect(ctx context.Context) error {
 	s.mutex.Lock()
-	defer s.mutex.Unlock()
+	disconnected, err := s.disconnectLocked(ctx)
+	s.mutex.Unlock()
+
+	if disconnected {
+		s.publish(Event{Type: EventDisconnected})
+	}
+	return err
+}
+
+// disconnectLocked closes the connection and reports whether there was one.
+// It must be called with s.mutex held.
+func (s *ManagedServer) disconnectLocked(ctx context.Context) (bool, error) {
+	s.stopReconnectLocked()
+	s.discardStandbyLocked(ctx)
+	if s.pool != nil {
+		if err := s.pool.Close(ctx); err != nil {
+			s.logger().Warn("Error closing pooled connections", logging.Err(err))
+		}
+	}
 
 	if !s.connected {
-		return nil
+		return false, nil
 	}
 
 	s.connected = false
-	return s.Transport.Disconnect(ctx)
+	s.recordDisconnectedLocked(nil)
+	return true, s.Transport.Disconnect(ctx)
+}
+
+// connectOnFirstUse connects a lazy or idle server for the request about to be
+// sent and announces it, as its capabilities join the catalog
+func (s *ManagedServer) connectOnFirstUse(ctx context.Context) error {
+	s.logger().Info("Connecting to server on first use")
+	if err := s.Connect(ctx); err != nil {
+		return err
+	}
+	s.stateChanged()
+	return nil
+}
+
+// SendNotification forwards a notification to the upstream server. Nothing is
+// sent to a server that is quarantined or not yet initialized.
+func (s *ManagedServer) SendNotification(ctx context.Context, notification interface{}) error {
+	s.mutex.Lock()
+	s.lastUsed = time.Now()
+	ready := s.connected && s.initialized && !s.quarantine.quarantined
+	s.mutex.Unlock()
+
+	if !ready {
+		return fmt.Errorf("server %s is not ready for notifications", s.Name)
+	}
+	return s.notificationTransport(notification).SendNotification(ctx, notification)
 }
 
 // SendRequest forwards a request to the upstream server
 // Returns raw JSON response that can be parsed by the router
-func (s *ManagedServer) SendRequest(ctx context.Context, request interface{}) (json.RawMessage, error) {
+func (s *ManagedServer) SendRequest(ctx context.Context, request interface{}) (resp json.RawMessage, err error) {
+	ctx, span := s.startSpan(ctx, request)
+	ctx = logging.With(ctx, logging.Server(s.Name))
+	defer func(start time.Time) {
+		failed := isErrorResponse(resp, err)
+		elapsed := time.Since(start)
+		s.metrics.record(elapsed, failed)
+		endSpan(span, resp, err, failed)
+		if slog.Default().Enabled(ctx, slog.LevelDebug) {
+			slog.DebugContext(ctx, "Upstream request finished", "upstream_method", requestMethod(request),
+				"duration", elapsed, "failed", failed)
+		}
+	}(time.Now())
+
 	s.mutex.Lock()
+	if !s.beginRequestLocked() {
+		s.mutex.Unlock()
+		errResp := map[string]interface{}{
+			"jsonrpc": "2.0",
+			"error": map[string]interface{}{
+				"code":    -32603,
+				"message": "Server is being removed",
+			},
+		}
+		data, _ := json.Marshal(errResp)
+		return json.RawMessage(data), nil
+	}
+	defer s.finishRequest()
 	s.lastUsed = time.Now()
 	connected := s.connected
 	initialized := s.initialized
+	quarantined := s.quarantine.quarantined
+	offSchedule := s.schedule.off
+	lazy := (s.Config.Lazy || s.idleDisconnected) && !connected && !quarantined && !s.disabled && !s.reconnect.active && !offSchedule
 	s.mutex.Unlock()
 
+	if offSchedule {
+		errResp := map[string]interface{}{
+			"jsonrpc": "2.0",
+			"error": map[string]interface{}{
+				"code":    -32603,
+				"message": "Server is outside its schedule",
+			},
+		}
+		data, _ := json.Marshal(errResp)
+		return json.RawMessage(data), nil
+	}
+
+	if lazy {
+		if err := s.connectOnFirstUse(ctx); err == nil {
+			connected, initialized = true, true
+		}
+	}
+
+	if quarantined {
+		errResp := map[string]interface{}{
+			"jsonrpc": "2.0",
+			"error": map[string]interface{}{
+				"code":    -32603,
+				"message": "Server quarantined after repeated failures",
+			},
+		}
+		data, _ := json.Marshal(errResp)
+		return json.RawMessage(data), nil
+	}
+
 	if !connected || !initialized {
 		errResp := map[string]interface{}{
 			"jsonrpc": "2.0",
@@ -153,7 +532,44 @@ func (s *ManagedServer) SendRequest(ctx context.Context, request interface{}) (j
 		return json.RawMessage(data), nil
 	}
 
-	resp, err := s.Transport.SendRequest(ctx, request)
+	release, err := s.acquireSlot(ctx)
+	if err != nil {
+		errResp := map[string]interface{}{
+			"jsonrpc": "2.0",
+			"error": map[string]interface{}{
+				"code":    -32603,
+				"message": "Server busy: " + err.Error(),
+			},
+		}
+		data, _ := json.Marshal(errResp)
+		return json.RawMessage(data), nil
+	}
+
+	t, releaseTransport := s.acquireTransport(ctx, request)
+	resp, err = s.sendWithTimeout(ctx, t, request)
+	releaseTransport(err)
+	release()
+
+	s.mutex.Lock()
+	if err != nil {
+		s.recordErrorLocked(err)
+		quarantined = s.recordFailureLocked()
+	} else {
+		s.recordSuccessLocked()
+		s.history.lastSuccessAt = time.Now()
+	}
+	s.mutex.Unlock()
+
+	if quarantined {
+		s.publish(Event{Type: EventQuarantined, Err: err})
+		s.stateChanged()
+	}
+
+	var timeoutErr *RequestTimeoutError
+	if errors.As(err, &timeoutErr) {
+		return timeoutErrorResponse(timeoutErr), nil
+	}
+
 	if err != nil {
 		errResp := map[string]interface{}{
 			"jsonrpc": "2.0",
@@ -169,6 +585,14 @@ func (s *ManagedServer) SendRequest(ctx context.Context, request interface{}) (j
 	return resp, nil
 }
 
+// activeTransport returns the transport currently connecting the server,
+// which a standby takes the place of when it fails over
+func (s *ManagedServer) activeTransport() transport.Transport {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.Transport
+}
+
 // IsConnected returns connection status
 func (s *ManagedServer) IsConnected() bool {
 	s.mutex.RLock()
@@ -183,12 +607,42 @@ func (s *ManagedServer) IsInitialized() bool {
 	return s.initialized
 }
 
+// StderrTail returns the last lines the upstream process wrote to stderr, if captured
+func (s *ManagedServer) StderrTail() []string {
+	if source, ok := s.activeTransport().(transport.StderrSource); ok {
+		return source.StderrTail()
+	}
+	return nil
+}
+
+// TransportMetrics returns the transport's traffic counters, if it keeps them
+func (s *ManagedServer) TransportMetrics() (transport.Metrics, bool) {
+	if source, ok := s.activeTransport().(transport.MetricsSource); ok {
+		return source.Metrics(), true
+	}
+	return transport.Metrics{}, false
+}
+
+// IsDisabled returns whether the server was disabled at runtime
+func (s *ManagedServer) IsDisabled() bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.disabled
+}
+
+// setDisabled marks the server as disabled or enabled
+func (s *ManagedServer) setDisabled(disabled bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.disabled = disabled
+}
+
 // HasCapability checks if server has a specific capability
 func (s *ManagedServer) HasCapability(capability string) bool {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
 
-	for _, cap := range s.Capabilities {
+	for _, cap := range s.capabilities {
 		if cap == capability {
 			return true
 		}
@@ -196,6 +650,11 @@ func (s *ManagedServer) HasCapability(capability string) bool {
 	return false
 }
 
+// HasTag checks if the server is configured with a specific tag
+func (s *ManagedServer) HasTag(tag string) bool {
+	return slices.Contains(s.Config.Tags, tag)
+}
+
 // GetLastUsed returns the last time this server was used
 func (s *ManagedServer) GetLastUsed() time.Time {
 	s.mutex.RLock()
@@ -203,11 +662,30 @@ func (s *ManagedServer) GetLastUsed() time.Time {
 	return s.lastUsed
 }
 
+// StaticTools returns the tools declared for this server in config
+func (s *ManagedServer) StaticTools() []config.StaticTool {
+	return s.Config.Tools
+}
+
+// OverridesDiscovery reports whether static config replaces upstream discovery
+// rather than only being used when discovery fails
+func (s *ManagedServer) OverridesDiscovery() bool {
+	return s.Config.CapabilitiesMode == config.CapabilitiesOverride
+}
+
+// Capabilities returns a copy of the capabilities the server declared, or
+// those configured for it
+func (s *ManagedServer) Capabilities() []string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return append([]string{}, s.capabilities...)
+}
+
 // SetCapabilities updates the server's capabilities
 func (s *ManagedServer) SetCapabilities(caps []string) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
-	s.Capabilities = caps
+	s.capabilities = caps
 }
 
 // JSONRPCError represents a JSON-RPC error
@@ -220,3 +698,8 @@ type JSONRPCError struct {
 func (e *JSONRPCError) Error() string {
 	return e.Message
 }
+
+// logger returns the logger for records about this server
+func (s *ManagedServer) logger() *slog.Logger {
+	return slog.Default().With(logging.KeyServer, s.Name)
+}
@@ -2,10 +2,23 @@ package server
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/j4ng5y/mcpgate/config"
+	"github.com/j4ng5y/mcpgate/internal/mcptest"
+	"github.com/j4ng5y/mcpgate/transport"
 )
 
 func TestManagedServer_NewManagedServer(t *testing.T) {
@@ -49,7 +62,7 @@ func TestManagedServer_InvalidTransport(t *testing.T) {
 func TestManagedServer_HasCapability(t *testing.T) {
 	server := &ManagedServer{
 		Name:         "test-server",
-		Capabilities: []string{"tools", "resources"},
+		capabilities: []string{"tools", "resources"},
 	}
 
 	if !server.HasCapability("tools") {
@@ -68,14 +81,14 @@ func TestManagedServer_HasCapability(t *testing.T) {
 func TestManagedServer_SetCapabilities(t *testing.T) {
 	server := &ManagedServer{
 		Name:         "test-server",
-		Capabilities: []string{},
+		capabilities: []string{},
 	}
 
 	caps := []string{"tools", "resources", "prompts"}
 	server.SetCapabilities(caps)
 
-	if len(server.Capabilities) != 3 {
-		t.Errorf("Expected 3 capabilities, got %d", len(server.Capabilities))
+	if len(server.Capabilities()) != 3 {
+		t.Errorf("Expected 3 capabilities, got %d", len(server.Capabilities()))
 	}
 
 	for _, cap := range caps {
@@ -159,7 +172,7 @@ func TestManagedServer_Connect_InvalidCommand(t *testing.T) {
 func TestManagedServer_Capabilities(t *testing.T) {
 	server := &ManagedServer{
 		Name:         "test-server",
-		Capabilities: []string{"tools", "resources"},
+		capabilities: []string{"tools", "resources"},
 	}
 
 	if !server.HasCapability("tools") {
@@ -212,7 +225,7 @@ func TestManagedServer_Config(t *testing.T) {
 func TestManagedServer_Concurrency(t *testing.T) {
 	server := &ManagedServer{
 		Name:         "test-server",
-		Capabilities: []string{"tools"},
+		capabilities: []string{"tools"},
 	}
 
 	// Test concurrent reads
@@ -233,3 +246,1116 @@ func TestManagedServer_Concurrency(t *testing.T) {
 		<-done
 	}
 }
+
+func TestManagedServer_InitializeParams_NoClientCapabilities(t *testing.T) {
+	server := &ManagedServer{
+		Name: "test-server",
+	}
+
+	params := server.initializeParams()
+	caps, ok := params["capabilities"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected capabilities map, got %T", params["capabilities"])
+	}
+	if len(caps) != 0 {
+		t.Errorf("Expected no client capabilities advertised upstream, got %v", caps)
+	}
+}
+
+func TestReconnectBackoff(t *testing.T) {
+	for attempt := 1; attempt <= 12; attempt++ {
+		backoff := reconnectBackoff(attempt)
+		ceiling := reconnectInitialBackoff << (attempt - 1)
+		if ceiling > reconnectMaxBackoff {
+			ceiling = reconnectMaxBackoff
+		}
+		if backoff < ceiling/2 || backoff > ceiling {
+			t.Errorf("reconnectBackoff(%d) = %v, want between %v and %v", attempt, backoff, ceiling/2, ceiling)
+		}
+	}
+}
+
+func TestManagedServer_AutoReconnect(t *testing.T) {
+	server, err := NewManagedServer(config.ServerConfig{
+		Name:          "flaky",
+		Transport:     "stdio",
+		Command:       mcptest.EchoCommand,
+		Args:          mcptest.EchoArgs(),
+		AutoReconnect: true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	events := make(chan StatusEvent, 10)
+	server.SetStatusHandler(func(event StatusEvent) {
+		events <- event
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := server.Connect(ctx); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer func() {
+		_ = server.Disconnect(ctx)
+	}()
+
+	server.handleConnectionLost(errors.New("connection reset"))
+
+	var statuses []string
+	for {
+		select {
+		case event := <-events:
+			statuses = append(statuses, event.Status)
+			if event.Status != StatusReconnected {
+				continue
+			}
+		case <-ctx.Done():
+			t.Fatalf("Expected server to reconnect, got events %v", statuses)
+		}
+		break
+	}
+
+	if statuses[0] != StatusDisconnected || statuses[1] != StatusReconnecting {
+		t.Errorf("Unexpected status sequence %v", statuses)
+	}
+	if !server.IsConnected() || server.IsReconnecting() {
+		t.Error("Expected server to be connected after reconnect")
+	}
+}
+
+func TestManagedServer_DisconnectStopsReconnect(t *testing.T) {
+	server, err := NewManagedServer(config.ServerConfig{
+		Name:          "flaky",
+		Transport:     "stdio",
+		Command:       mcptest.EchoCommand,
+		Args:          mcptest.EchoArgs(),
+		AutoReconnect: true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	server.handleConnectionLost(errors.New("connection reset"))
+	if !server.IsReconnecting() || server.State() != StatusReconnecting {
+		t.Fatalf("Expected reconnect to start, state %s", server.State())
+	}
+
+	if err := server.Disconnect(context.Background()); err != nil {
+		t.Fatalf("Failed to disconnect: %v", err)
+	}
+	time.Sleep(1200 * time.Millisecond)
+
+	if server.IsReconnecting() || server.IsConnected() {
+		t.Error("Expected Disconnect to cancel the reconnect loop")
+	}
+}
+
+// blockingTransport never answers, like a hung upstream
+type blockingTransport struct{}
+
+func (b *blockingTransport) Connect(ctx context.Context) error    { return nil }
+func (b *blockingTransport) Disconnect(ctx context.Context) error { return nil }
+func (b *blockingTransport) IsConnected() bool                    { return true }
+func (b *blockingTransport) Name() string                         { return "blocking" }
+func (b *blockingTransport) SendRequest(ctx context.Context, request interface{}) (json.RawMessage, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+func (b *blockingTransport) SendNotification(ctx context.Context, notification interface{}) error {
+	return nil
+}
+
+func TestManagedServer_SendRequestTimeout(t *testing.T) {
+	server := &ManagedServer{
+		Name:        "hung",
+		Config:      config.ServerConfig{Name: "hung", Timeout: 1},
+		Transport:   &blockingTransport{},
+		connected:   true,
+		initialized: true,
+	}
+
+	start := time.Now()
+	resp, err := server.SendRequest(context.Background(), map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  "tools/call",
+	})
+	if err != nil {
+		t.Fatalf("SendRequest returned error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("Expected request to time out after 1s, took %s", elapsed)
+	}
+
+	var body struct {
+		Error struct {
+			Code int `json:"code"`
+			Data struct {
+				Server  string  `json:"server"`
+				Method  string  `json:"method"`
+				Timeout float64 `json:"timeout"`
+			} `json:"data"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(resp, &body); err != nil {
+		t.Fatalf("Invalid response: %v", err)
+	}
+	if body.Error.Code != ErrCodeRequestTimeout {
+		t.Errorf("Expected code %d, got %d", ErrCodeRequestTimeout, body.Error.Code)
+	}
+	if body.Error.Data.Server != "hung" || body.Error.Data.Method != "tools/call" || body.Error.Data.Timeout != 1 {
+		t.Errorf("Unexpected timeout data %+v", body.Error.Data)
+	}
+}
+
+func TestManagedServer_SendRequestCallerCancel(t *testing.T) {
+	server := &ManagedServer{
+		Name:        "hung",
+		Config:      config.ServerConfig{Name: "hung", Timeout: 30},
+		Transport:   &blockingTransport{},
+		connected:   true,
+		initialized: true,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	resp, _ := server.SendRequest(ctx, map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": "ping"})
+
+	var body struct {
+		Error struct {
+			Code int `json:"code"`
+		} `json:"error"`
+	}
+	_ = json.Unmarshal(resp, &body)
+	if body.Error.Code == ErrCodeRequestTimeout {
+		t.Error("Expected caller cancellation not to be reported as an upstream timeout")
+	}
+}
+
+func TestManagedServer_CheckHealth(t *testing.T) {
+	server := &ManagedServer{
+		Name:        "hung",
+		Config:      config.ServerConfig{Name: "hung"},
+		Transport:   &blockingTransport{},
+		connected:   true,
+		initialized: true,
+	}
+	server.SetUnhealthyThreshold(2)
+
+	if got := server.Health().Status; got != HealthUnknown {
+		t.Errorf("Expected %s before any check, got %s", HealthUnknown, got)
+	}
+
+	check := func() HealthStatus {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		return server.CheckHealth(ctx)
+	}
+
+	if health := check(); health.Status != HealthDegraded || health.ConsecutiveFailures != 1 || health.LastError == "" {
+		t.Errorf("Expected degraded after one missed ping, got %+v", health)
+	}
+	if health := check(); health.Status != HealthUnhealthy {
+		t.Errorf("Expected unhealthy after two missed pings, got %+v", health)
+	}
+	if server.ConsecutiveFailures() != 0 {
+		t.Error("Expected health checks not to count towards quarantine")
+	}
+
+	server.connected = false
+	if health := check(); health.Status != HealthUnknown {
+		t.Errorf("Expected %s for a disconnected server, got %+v", HealthUnknown, health)
+	}
+}
+
+func TestManagedServer_CheckHealthAnswered(t *testing.T) {
+	server, err := NewManagedServer(config.ServerConfig{Name: "echo", Transport: "stdio", Command: mcptest.EchoCommand, Args: mcptest.EchoArgs()})
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := server.Connect(ctx); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer func() {
+		_ = server.Disconnect(ctx)
+	}()
+
+	// The echo answers the ping
+	if health := server.CheckHealth(ctx); health.Status != HealthHealthy || health.LastCheck.IsZero() {
+		t.Errorf("Expected healthy, got %+v", health)
+	}
+}
+
+func TestManagedServer_CheckHealthProbe(t *testing.T) {
+	var up atomic.Bool
+	up.Store(true)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/rpc":
+			_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":{}}`))
+		case r.URL.Path == "/healthz" && up.Load():
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer upstream.Close()
+
+	cfg := config.ServerConfig{
+		Name:        "remote",
+		Transport:   "http",
+		URL:         upstream.URL,
+		HealthProbe: &config.HealthProbeConfig{Path: "/healthz", Interval: 5},
+	}
+	if err := cfg.Normalize(); err != nil {
+		t.Fatalf("Invalid config: %v", err)
+	}
+	server, err := NewManagedServer(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	server.SetUnhealthyThreshold(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := server.Connect(ctx); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+
+	if health := server.CheckHealth(ctx); health.Status != HealthHealthy {
+		t.Errorf("Expected healthy while the probe passes, got %+v", health)
+	}
+	up.Store(false)
+	if health := server.CheckHealth(ctx); health.Status != HealthUnhealthy || !strings.Contains(health.LastError, "503") {
+		t.Errorf("Expected unhealthy once the probe fails, got %+v", health)
+	}
+
+	if interval := server.healthInterval(DefaultHealthInterval); interval != 5*time.Second {
+		t.Errorf("Expected the probe's interval, got %s", interval)
+	}
+	manager := NewManager(&config.Config{Servers: []config.ServerConfig{cfg}})
+	if tick := manager.healthTick(); tick != 5*time.Second {
+		t.Errorf("Expected the health loop to tick at the shortest interval, got %s", tick)
+	}
+}
+
+func TestManagedServer_RequestMetrics(t *testing.T) {
+	server, err := NewManagedServer(config.ServerConfig{Name: "echo", Transport: "stdio", Command: mcptest.EchoCommand, Args: mcptest.EchoArgs(), Timeout: 5})
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	ctx := context.Background()
+	if err := server.Connect(ctx); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := server.SendRequest(ctx, map[string]interface{}{"jsonrpc": "2.0", "id": i, "method": "ping"}); err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+	}
+	_ = server.Disconnect(ctx)
+	// Answered by the gateway with an error, as the server is gone
+	if _, err := server.SendRequest(ctx, map[string]interface{}{"jsonrpc": "2.0", "id": 3, "method": "ping"}); err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+
+	metrics := server.RequestMetrics()
+	if metrics.Requests != 4 || metrics.Errors != 1 || metrics.ErrorRate != 0.25 {
+		t.Errorf("Expected 4 requests with 1 error, got %+v", metrics)
+	}
+	if metrics.P50 <= 0 || metrics.P90 < metrics.P50 || metrics.P99 < metrics.P90 {
+		t.Errorf("Expected ordered latency percentiles, got %+v", metrics)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	var latencies []time.Duration
+	for i := 1; i <= 100; i++ {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+	for _, tt := range []struct {
+		p    int
+		want time.Duration
+	}{{50, 50 * time.Millisecond}, {90, 90 * time.Millisecond}, {99, 99 * time.Millisecond}} {
+		if got := percentile(latencies, tt.p); got != tt.want {
+			t.Errorf("percentile(%d) = %s, want %s", tt.p, got, tt.want)
+		}
+	}
+	if got := percentile([]time.Duration{time.Second}, 50); got != time.Second {
+		t.Errorf("Expected the only latency, got %s", got)
+	}
+}
+
+func TestManagedServer_Pool(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+
+	// Each process answers one request at a time, slowly, with its pid
+	script := `read -r line; echo '{"jsonrpc":"2.0","id":1,"result":{}}'
+while read -r line; do
+  case "$line" in *'"id"'*) ;; *) continue ;; esac
+  id=$(echo "$line" | sed 's/.*"id":\([0-9]*\).*/\1/')
+  sleep 0.3
+  echo "{\"jsonrpc\":\"2.0\",\"id\":$id,\"result\":{\"pid\":$$}}"
+done`
+	s, err := NewManagedServer(config.ServerConfig{
+		Name:      "slow",
+		Transport: "stdio",
+		Command:   "sh",
+		Args:      []string{"-c", script},
+		Timeout:   5,
+		PoolSize:  2,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	ctx := context.Background()
+	if err := s.Connect(ctx); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer func() {
+		_ = s.Disconnect(ctx)
+	}()
+
+	// Two pooled connections and the server's own serve three requests at once
+	var wg sync.WaitGroup
+	pids := make(chan string, 3)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			resp, err := s.SendRequest(ctx, map[string]interface{}{"jsonrpc": "2.0", "id": id, "method": "work"})
+			if err != nil {
+				t.Errorf("Request failed: %v", err)
+				return
+			}
+			var answer struct {
+				Result struct {
+					PID json.Number `json:"pid"`
+				} `json:"result"`
+			}
+			_ = json.Unmarshal(resp, &answer)
+			pids <- answer.Result.PID.String()
+		}(i)
+	}
+	wg.Wait()
+	close(pids)
+
+	if elapsed := time.Since(start); elapsed > 800*time.Millisecond {
+		t.Errorf("Expected the requests to run in parallel, took %s", elapsed)
+	}
+	seen := make(map[string]bool)
+	for pid := range pids {
+		seen[pid] = true
+	}
+	if len(seen) != 3 {
+		t.Errorf("Expected three processes to answer, got %v", seen)
+	}
+}
+
+func TestManagedServer_PoolMaxConnLifetime(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+
+	s, err := NewManagedServer(config.ServerConfig{
+		Name:            "echo",
+		Transport:       "stdio",
+		Command:         mcptest.EchoCommand,
+		Args:            mcptest.EchoArgs(),
+		PoolSize:        2,
+		PoolWarmUp:      1,
+		MaxConnLifetime: 60,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	ctx := context.Background()
+	if err := s.Connect(ctx); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer func() {
+		_ = s.Disconnect(ctx)
+	}()
+	if err := s.WarmUp(ctx, 1); err != nil {
+		t.Fatalf("WarmUp failed: %v", err)
+	}
+
+	// Still young, the connection is kept
+	s.cleanPool(ctx)
+	if evictions := s.PoolStats()["evictions"]; evictions != int64(0) {
+		t.Fatalf("Expected no evictions yet, got %v", evictions)
+	}
+
+	// Once it outlives its lifetime it is closed and replaced
+	s.pool.SetMaxLifetime(50 * time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	s.cleanPool(ctx)
+
+	stats := s.PoolStats()
+	if stats["evictions"] != int64(1) || stats["open"] != 1 {
+		t.Errorf("Expected the old connection replaced, got %v", stats)
+	}
+}
+
+func TestManagedServer_PoolCircuit(t *testing.T) {
+	s, err := NewManagedServer(config.ServerConfig{
+		Name:         "echo",
+		Transport:    "stdio",
+		Command:      mcptest.EchoCommand,
+		Args:         mcptest.EchoArgs(),
+		PoolSize:     1,
+		PoolCoolDown: 60,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	events := make(chan Event, 4)
+	s.SetEventHandler(func(event Event) { events <- event })
+	ctx := context.Background()
+	if err := s.Connect(ctx); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer func() {
+		_ = s.Disconnect(ctx)
+	}()
+	for len(events) > 0 {
+		<-events
+	}
+
+	// Fail requests over the pooled connection until the pool gives up on it
+	for i := 0; i < 10; i++ {
+		tr, release := s.acquireTransport(ctx, map[string]interface{}{"jsonrpc": "2.0", "id": i, "method": "work"})
+		if tr == s.activeTransport() {
+			break
+		}
+		release(errors.New("request failed"))
+	}
+
+	select {
+	case event := <-events:
+		if event.Type != EventPoolCircuitOpen || event.Server != "echo" {
+			t.Errorf("Expected a pool_circuit_open event for echo, got %+v", event)
+		}
+	default:
+		t.Fatal("Expected a pool_circuit_open event")
+	}
+	if stats := s.PoolStats(); stats["circuit_open"] != true || stats["circuit_trips"] != int64(1) {
+		t.Errorf("Expected the circuit reported open, got %v", stats)
+	}
+
+	// Requests still go through, over the server's own connection
+	if tr, _ := s.acquireTransport(ctx, map[string]interface{}{"jsonrpc": "2.0", "id": 11, "method": "work"}); tr != s.activeTransport() {
+		t.Error("Expected the server's own connection while the pool cools down")
+	}
+}
+
+func TestManagedServer_PoolKeepsSessionOnOwnConnection(t *testing.T) {
+	s, err := NewManagedServer(config.ServerConfig{
+		Name:      "echo",
+		Transport: "stdio",
+		Command:   mcptest.EchoCommand,
+		Args:      mcptest.EchoArgs(),
+		PoolSize:  1,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	ctx := context.Background()
+	if err := s.Connect(ctx); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer func() {
+		_ = s.Disconnect(ctx)
+	}()
+
+	subscribe := map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": "resources/subscribe"}
+	if tr, _ := s.acquireTransport(ctx, subscribe); tr != s.activeTransport() {
+		t.Error("Expected resources/subscribe over the server's own connection")
+	}
+
+	// A cancellation follows the request it names onto its pooled connection
+	pooled, release := s.acquireTransport(ctx, map[string]interface{}{"jsonrpc": "2.0", "id": "call-7", "method": "tools/call"})
+	if pooled == s.activeTransport() {
+		t.Fatal("Expected tools/call over a pooled connection")
+	}
+	cancel := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "notifications/cancelled",
+		"params":  map[string]interface{}{"requestId": "call-7"},
+	}
+	if tr := s.notificationTransport(cancel); tr != pooled {
+		t.Error("Expected the cancellation over the pooled connection carrying the request")
+	}
+	progress := map[string]interface{}{"jsonrpc": "2.0", "method": "notifications/progress"}
+	if tr := s.notificationTransport(progress); tr != s.activeTransport() {
+		t.Error("Expected other notifications over the server's own connection")
+	}
+
+	release(nil)
+	if tr := s.notificationTransport(cancel); tr != s.activeTransport() {
+		t.Error("Expected the request forgotten once it is done")
+	}
+}
+
+func TestShouldRestart(t *testing.T) {
+	crashed := &transport.ExitError{ExitCode: 1, Err: io.EOF}
+	exited := &transport.ExitError{ExitCode: 0, Err: io.EOF}
+	dropped := errors.New("connection reset")
+
+	tests := []struct {
+		policy string
+		err    error
+		want   bool
+	}{
+		{config.RestartAlways, exited, true},
+		{config.RestartOnFailure, crashed, true},
+		{config.RestartOnFailure, dropped, true},
+		{config.RestartOnFailure, exited, false},
+		{config.RestartNever, crashed, false},
+	}
+	for _, tt := range tests {
+		if got := shouldRestart(tt.policy, tt.err); got != tt.want {
+			t.Errorf("shouldRestart(%s, %v) = %v, want %v", tt.policy, tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestManagedServer_MaxRestarts(t *testing.T) {
+	server := &ManagedServer{
+		Name:   "crashy",
+		Config: config.ServerConfig{Name: "crashy", Restart: config.RestartOnFailure, MaxRestarts: 2},
+	}
+	crash := errors.New("crashed")
+
+	for i := 1; i <= 2; i++ {
+		if restart, _ := server.claimRestartLocked(crash); !restart {
+			t.Fatalf("Expected restart %d to be allowed", i)
+		}
+	}
+	if restart, exhausted := server.claimRestartLocked(crash); restart || !exhausted {
+		t.Errorf("Expected max_restarts to stop a third restart, got %v %v", restart, exhausted)
+	}
+
+	// Staying up long enough starts the count over
+	server.reconnect.upSince = time.Now().Add(-2 * restartResetAfter)
+	if restart, _ := server.claimRestartLocked(crash); !restart || server.Restarts() != 1 {
+		t.Errorf("Expected the restart count to reset, got %d", server.Restarts())
+	}
+
+	// Without a restart policy, auto_reconnect is unlimited
+	legacy := &ManagedServer{Config: config.ServerConfig{AutoReconnect: true}}
+	for i := 0; i < 20; i++ {
+		if restart, _ := legacy.claimRestartLocked(crash); !restart {
+			t.Fatalf("Expected auto_reconnect restart %d to be allowed", i+1)
+		}
+	}
+}
+
+func TestManagedServer_RestartsCrashedProcess(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+
+	// Answers initialize, then the first process exits with status 3 on the
+	// next message; the restarted one keeps running
+	script := `read -r line; echo '{"jsonrpc":"2.0","id":1,"result":{}}'
+if [ ! -e "$0" ]; then : > "$0"; read -r line; exit 3; fi
+while read -r line; do :; done`
+	server, err := NewManagedServer(config.ServerConfig{
+		Name:      "crashy",
+		Transport: "stdio",
+		Command:   "sh",
+		Args:      []string{"-c", script, filepath.Join(t.TempDir(), "crashed")},
+		Restart:   config.RestartOnFailure,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	events := make(chan StatusEvent, 10)
+	server.SetStatusHandler(func(event StatusEvent) {
+		events <- event
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Connect(ctx); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer func() {
+		_ = server.Disconnect(ctx)
+	}()
+
+	_ = server.SendNotification(ctx, map[string]interface{}{"jsonrpc": "2.0", "method": "notifications/initialized"})
+
+	for {
+		select {
+		case event := <-events:
+			if event.Status == StatusDisconnected {
+				var exitErr *transport.ExitError
+				if !errors.As(event.Err, &exitErr) || exitErr.ExitCode != 3 {
+					t.Errorf("Expected exit code 3, got %v", event.Err)
+				}
+			}
+			if event.Status != StatusReconnected {
+				continue
+			}
+		case <-ctx.Done():
+			t.Fatal("Expected the crashed server to be restarted")
+		}
+		break
+	}
+
+	if !server.IsConnected() || server.Restarts() != 1 {
+		t.Errorf("Expected one restart, got connected=%v restarts=%d", server.IsConnected(), server.Restarts())
+	}
+}
+
+func TestManagedServer_Drain(t *testing.T) {
+	server := &ManagedServer{
+		Name:        "hung",
+		Config:      config.ServerConfig{Name: "hung", Timeout: 30},
+		Transport:   &blockingTransport{},
+		connected:   true,
+		initialized: true,
+	}
+
+	reqCtx, cancelReq := context.WithCancel(context.Background())
+	finished := make(chan struct{})
+	go func() {
+		_, _ = server.SendRequest(reqCtx, map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": "ping"})
+		close(finished)
+	}()
+
+	// Let the request get in flight
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := server.Drain(ctx); err == nil {
+		t.Error("Expected Drain to time out while a request is in flight")
+	}
+
+	resp, _ := server.SendRequest(context.Background(), map[string]interface{}{"jsonrpc": "2.0", "id": 2, "method": "ping"})
+	if !strings.Contains(string(resp), "being removed") {
+		t.Errorf("Expected a draining server to refuse new requests, got %s", resp)
+	}
+
+	cancelReq()
+	<-finished
+	if err := server.Drain(context.Background()); err != nil {
+		t.Errorf("Expected Drain to finish once the request returned, got %v", err)
+	}
+}
+
+func TestResolveCapabilities(t *testing.T) {
+	result := map[string]interface{}{
+		"capabilities": map[string]interface{}{
+			"prompts":      map[string]interface{}{},
+			"tools":        map[string]interface{}{"listChanged": true},
+			"experimental": map[string]interface{}{},
+		},
+	}
+	discovered := discoveredCapabilities(result)
+	if strings.Join(discovered, ",") != "tools,prompts" {
+		t.Fatalf("Expected tools and prompts to be discovered, got %v", discovered)
+	}
+
+	tests := []struct {
+		name       string
+		config     config.ServerConfig
+		discovered []string
+		expected   string
+	}{
+		{"discovered", config.ServerConfig{Capabilities: []string{"resources"}}, discovered, "tools,prompts"},
+		{"fallback", config.ServerConfig{Capabilities: []string{"resources"}}, nil, "resources"},
+		{"override", config.ServerConfig{Capabilities: []string{"resources"}, CapabilitiesMode: config.CapabilitiesOverride}, discovered, "resources"},
+		{"override without static", config.ServerConfig{CapabilitiesMode: config.CapabilitiesOverride}, discovered, "tools,prompts"},
+	}
+	for _, tt := range tests {
+		server := &ManagedServer{Config: tt.config}
+		if got := strings.Join(server.resolveCapabilities(tt.discovered), ","); got != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestManagedServer_ConnectDiscoversCapabilities(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+
+	// Answers initialize, then the tools/list the catalog cache sends
+	script := `read -r line; echo '{"jsonrpc":"2.0","id":1,"result":{"capabilities":{"tools":{},"logging":{}},"serverInfo":{"name":"example","version":"1.2.3"}}}'
+read -r line
+read -r line; echo '{"jsonrpc":"2.0","id":2,"result":{"tools":[]}}'; cat >/dev/null`
+	server, err := NewManagedServer(config.ServerConfig{
+		Name:      "discovering",
+		Transport: "stdio",
+		Command:   "sh",
+		Args:      []string{"-c", script},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Connect(ctx); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer func() {
+		_ = server.Disconnect(ctx)
+	}()
+
+	if !server.HasCapability("tools") || !server.HasCapability("logging") || server.HasCapability("resources") {
+		t.Errorf("Expected the declared capabilities, got %v", server.Capabilities())
+	}
+	if info := server.ServerInfo(); info.Name != "example" || info.Version != "1.2.3" {
+		t.Errorf("Expected the upstream's serverInfo, got %+v", info)
+	}
+}
+
+func TestManagedServer_CatalogCache(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+
+	// Answers initialize and a two-page tools/list, then on the next message
+	// announces a changed tool list and answers the refetch
+	script := `read -r line; echo '{"jsonrpc":"2.0","id":1,"result":{"capabilities":{"tools":{}}}}'
+read -r line
+read -r line; echo '{"jsonrpc":"2.0","id":2,"result":{"tools":[{"name":"a"}],"nextCursor":"page2"}}'
+read -r line; echo '{"jsonrpc":"2.0","id":3,"result":{"tools":[{"name":"b"}]}}'
+read -r line; echo '{"jsonrpc":"2.0","method":"notifications/tools/list_changed"}'
+read -r line; echo '{"jsonrpc":"2.0","id":4,"result":{"tools":[{"name":"c"}]}}'
+cat >/dev/null`
+	server, err := NewManagedServer(config.ServerConfig{
+		Name:      "cataloged",
+		Transport: "stdio",
+		Command:   "sh",
+		Args:      []string{"-c", script},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Connect(ctx); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer func() {
+		_ = server.Disconnect(ctx)
+	}()
+
+	toolNames := func() string {
+		items, ok := server.CachedList("tools/list")
+		if !ok {
+			return "uncached"
+		}
+		var names []string
+		for _, item := range items {
+			var tool struct {
+				Name string `json:"name"`
+			}
+			_ = json.Unmarshal(item, &tool)
+			names = append(names, tool.Name)
+		}
+		return strings.Join(names, ",")
+	}
+
+	if got := toolNames(); got != "a,b" {
+		t.Fatalf("Expected both pages cached after connecting, got %s", got)
+	}
+	if _, ok := server.CachedList("prompts/list"); ok {
+		t.Error("Expected no prompts cached for a server without the capability")
+	}
+
+	_ = server.SendNotification(ctx, map[string]interface{}{"jsonrpc": "2.0", "method": "notifications/initialized"})
+
+	for toolNames() != "c" {
+		select {
+		case <-ctx.Done():
+			t.Fatalf("Expected the cache to be refreshed after list_changed, got %s", toolNames())
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestManagedServer_RequestQueue(t *testing.T) {
+	s, err := NewManagedServer(config.ServerConfig{
+		Name:          "busy",
+		Transport:     "stdio",
+		Command:       mcptest.EchoCommand,
+		Args:          mcptest.EchoArgs(),
+		MaxConcurrent: 1,
+		QueueDepth:    1,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	s.queue.timeout = 50 * time.Millisecond
+
+	release, err := s.acquireSlot(context.Background())
+	if err != nil {
+		t.Fatalf("Expected a free slot, got %v", err)
+	}
+
+	// The next request waits in the queue until the slot is released
+	queued := make(chan error, 1)
+	go func() {
+		next, err := s.acquireSlot(context.Background())
+		if err == nil {
+			next()
+		}
+		queued <- err
+	}()
+	deadline := time.Now().Add(time.Second)
+	for s.QueueLength() != 1 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if s.QueueLength() != 1 {
+		t.Fatalf("Expected one queued request, got %d", s.QueueLength())
+	}
+
+	if _, err := s.acquireSlot(context.Background()); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Expected ErrQueueFull with the queue at its depth, got %v", err)
+	}
+
+	release()
+	if err := <-queued; err != nil {
+		t.Errorf("Expected the queued request to get the slot, got %v", err)
+	}
+	if s.QueueLength() != 0 {
+		t.Errorf("Expected an empty queue, got %d", s.QueueLength())
+	}
+
+	release, err = s.acquireSlot(context.Background())
+	if err != nil {
+		t.Fatalf("Expected a free slot, got %v", err)
+	}
+	defer release()
+	if _, err := s.acquireSlot(context.Background()); !errors.Is(err, ErrQueueTimeout) {
+		t.Errorf("Expected ErrQueueTimeout, got %v", err)
+	}
+}
+
+func TestManagedServer_History(t *testing.T) {
+	s, err := NewManagedServer(config.ServerConfig{
+		Name:      "history",
+		Transport: "stdio",
+		Command:   mcptest.EchoCommand,
+		Args:      mcptest.EchoArgs(),
+		Timeout:   5,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	ctx := context.Background()
+	if err := s.Connect(ctx); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	if s.Uptime() <= 0 {
+		t.Errorf("Expected uptime while connected, got %v", s.Uptime())
+	}
+	if _, err := s.SendRequest(ctx, map[string]interface{}{"jsonrpc": "2.0", "id": 7, "method": "ping"}); err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	if err := s.Disconnect(ctx); err != nil {
+		t.Fatalf("Failed to disconnect: %v", err)
+	}
+	if s.Uptime() != 0 {
+		t.Errorf("Expected no uptime once disconnected, got %v", s.Uptime())
+	}
+
+	history := s.History()
+	if history.LastSuccessAt.IsZero() {
+		t.Error("Expected the time of the last successful request")
+	}
+	if history.ConnectedAt.IsZero() || history.DisconnectedAt.Before(history.ConnectedAt) {
+		t.Errorf("Expected connect and disconnect times, got %+v", history)
+	}
+	if len(history.Events) != 2 || history.Events[0].Event != EventConnected || history.Events[1].Event != EventDisconnected {
+		t.Errorf("Expected a connect then a disconnect, got %+v", history.Events)
+	}
+	if history.LastError != "" {
+		t.Errorf("Expected no last error, got %q", history.LastError)
+	}
+
+	s.mutex.Lock()
+	s.connected = true
+	s.mutex.Unlock()
+	s.handleConnectionLost(errors.New("process exited"))
+
+	history = s.History()
+	if history.LastError != "process exited" || history.LastErrorAt.IsZero() {
+		t.Errorf("Expected the lost connection as last error, got %q at %v", history.LastError, history.LastErrorAt)
+	}
+	if last := history.Events[len(history.Events)-1]; last.Event != EventDisconnected || last.Error != "process exited" {
+		t.Errorf("Expected a disconnect with its error, got %+v", last)
+	}
+
+	for i := 0; i < maxConnectionEvents; i++ {
+		s.mutex.Lock()
+		s.recordConnectedLocked()
+		s.mutex.Unlock()
+	}
+	if events := s.History().Events; len(events) != maxConnectionEvents {
+		t.Errorf("Expected the history capped at %d events, got %d", maxConnectionEvents, len(events))
+	}
+}
+
+func TestManagedServer_IdleDisconnect(t *testing.T) {
+	s, err := NewManagedServer(config.ServerConfig{
+		Name:        "idle",
+		Transport:   "stdio",
+		Command:     mcptest.EchoCommand,
+		Args:        mcptest.EchoArgs(),
+		Timeout:     5,
+		IdleTimeout: 60,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	ctx := context.Background()
+	if err := s.Connect(ctx); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer func() {
+		_ = s.Disconnect(ctx)
+	}()
+
+	if s.disconnectIfIdle(ctx, time.Now()) {
+		t.Fatal("Expected a server just used to stay connected")
+	}
+	if !s.disconnectIfIdle(ctx, time.Now().Add(61*time.Second)) {
+		t.Fatal("Expected the idle server to be disconnected")
+	}
+	if s.IsConnected() || s.State() != "idle" {
+		t.Errorf("Expected an idle, disconnected server, got connected=%v state=%s", s.IsConnected(), s.State())
+	}
+
+	// The next request connects it again
+	resp, err := s.SendRequest(ctx, map[string]interface{}{"jsonrpc": "2.0", "id": 7, "method": "ping"})
+	if err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	if strings.Contains(string(resp), "not connected") || !s.IsConnected() || s.State() != "connected" {
+		t.Errorf("Expected the request to reconnect the server, got %s in state %s", resp, s.State())
+	}
+}
+
+func TestManagedServer_ConnectSendsInitialized(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+
+	// Records every message after the initialize request
+	received := filepath.Join(t.TempDir(), "received")
+	script := `read -r line; echo '{"jsonrpc":"2.0","id":1,"result":{}}'; while read -r line; do echo "$line" >> "$0"; done`
+	s, err := NewManagedServer(config.ServerConfig{
+		Name:      "handshake",
+		Transport: "stdio",
+		Command:   "sh",
+		Args:      []string{"-c", script, received},
+		Timeout:   5,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	ctx := context.Background()
+	if err := s.Connect(ctx); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer func() {
+		_ = s.Disconnect(ctx)
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	var data []byte
+	for time.Now().Before(deadline) {
+		data, _ = os.ReadFile(received)
+		if len(data) > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !strings.Contains(string(data), `"method":"notifications/initialized"`) || strings.Contains(string(data), `"id"`) {
+		t.Errorf("Expected the initialized notification after initialize, got %q", data)
+	}
+}
+
+func TestManagedServer_StandbyTakesOver(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+
+	// Each process names itself by pid and exits on a crash notification
+	script := `read -r line; echo "{\"jsonrpc\":\"2.0\",\"id\":1,\"result\":{\"serverInfo\":{\"name\":\"pid-$$\"}}}"; while read -r line; do case "$line" in *crash*) exit 1;; esac; done`
+	s, err := NewManagedServer(config.ServerConfig{
+		Name:      "critical",
+		Transport: "stdio",
+		Command:   "sh",
+		Args:      []string{"-c", script},
+		Timeout:   5,
+		Standby:   1,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	ctx := context.Background()
+	if err := s.Connect(ctx); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer func() {
+		_ = s.Disconnect(ctx)
+	}()
+
+	waitFor := func(what string, cond func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("Timed out waiting for %s", what)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	waitFor("a standby", func() bool { return s.StandbyReady() == 1 })
+	primary := s.ServerInfo().Name
+
+	if err := s.SendNotification(ctx, map[string]interface{}{"jsonrpc": "2.0", "method": "crash"}); err != nil {
+		t.Fatalf("Failed to send notification: %v", err)
+	}
+
+	waitFor("the standby to take over", func() bool {
+		return s.IsConnected() && s.ServerInfo().Name != primary
+	})
+	if restarts := s.History().TotalRestarts; restarts != 1 {
+		t.Errorf("Expected the fail over to count as a restart, got %d", restarts)
+	}
+
+	waitFor("a replacement standby", func() bool { return s.StandbyReady() == 1 })
+	if err := s.Disconnect(ctx); err != nil {
+		t.Fatalf("Failed to disconnect: %v", err)
+	}
+	if ready := s.StandbyReady(); ready != 0 {
+		t.Errorf("Expected disconnecting to discard the standby, got %d", ready)
+	}
+}
@@ -2,11 +2,16 @@ package server
 
 import (
 	"context"
-	"log"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/j4ng5y/mcpgate/config"
+	"github.com/j4ng5y/mcpgate/logging"
 )
 
 // Manager manages the lifecycle of upstream MCP servers
@@ -16,6 +21,22 @@ type Manager struct {
 	servers  map[string]*ManagedServer
 	mutex    sync.RWMutex
 	done     chan struct{}
+	stopOnce sync.Once
+
+	listenerMutex        sync.RWMutex
+	listeners            []func()
+	notificationHandlers []NotificationHandler
+	statusHandlers       []StatusHandler
+	shutdownHooks        []shutdownHook
+
+	// replicaTurn rotates between equally loaded replicas
+	replicaTurn atomic.Uint64
+
+	// started is set once Start has connected the servers, after which
+	// dependents are started and restarted along with their dependencies
+	started atomic.Bool
+
+	events eventBus
 }
 
 // NewManager creates a new server manager
@@ -28,88 +49,222 @@ func NewManager(cfg *config.Config) *Manager {
 	}
 }
 
-// Start initializes and starts all configured servers
+// Start initializes and starts all configured servers. It fails, without
+// starting background work, when a required server cannot be registered or
+// connected; the caller should Stop the manager then.
 func (m *Manager) Start() error {
+	// Deferred first so listeners run after the lock is released
+	defer m.notifyChange()
+
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
-	for _, serverCfg := range m.config.Servers {
-		if !serverCfg.Enabled {
-			log.Printf("Skipping disabled server: %s", serverCfg.Name)
-			continue
-		}
+	// Dependencies come first, so each server connects after them
+	servers, err := config.OrderByDependencies(m.config.Servers)
+	if err != nil {
+		return err
+	}
 
-		managed, err := NewManagedServer(serverCfg)
-		if err != nil {
-			log.Printf("Failed to create managed server %s: %v", serverCfg.Name, err)
+	var requiredErrs []error
+	for _, serverCfg := range servers {
+		if !serverCfg.Enabled {
+			slog.Info("Skipping disabled server", logging.Server(serverCfg.Name))
 			continue
 		}
 
-		m.servers[serverCfg.Name] = managed
-
-		if err := m.registry.Register(managed); err != nil {
-			log.Printf("Failed to register server %s: %v", serverCfg.Name, err)
-			continue
+		if _, err := m.addServerLocked(serverCfg); err != nil {
+			slog.Error("Failed to add server", logging.Server(serverCfg.Name), logging.Err(err))
+			if serverCfg.Required {
+				requiredErrs = append(requiredErrs, fmt.Errorf("required server %s: %w", serverCfg.Name, err))
+			}
 		}
-
-		log.Printf("Registered server: %s", serverCfg.Name)
 	}
 
 	// Connect all servers with retries
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	for name, server := range m.servers {
-		if err := m.connectWithRetry(ctx, server, 3); err != nil {
-			log.Printf("Failed to connect server %s after retries: %v", name, err)
+	for _, serverCfg := range servers {
+		name := serverCfg.Name
+		server, ok := m.servers[name]
+		if !ok {
+			continue
+		}
+		if server.Config.Lazy {
+			server.logger().Info("Server will connect on first use")
+			continue
 		}
+		if server.OffSchedule() {
+			server.logger().Info("Server is outside its schedule; connecting once it starts")
+			continue
+		}
+		if err := m.dependenciesConnected(server.Config); err != nil {
+			server.logger().Info("Not connecting server until its dependencies are connected", "reason", err)
+			if server.Config.Required {
+				requiredErrs = append(requiredErrs, fmt.Errorf("required server %s: %w", name, err))
+			}
+			continue
+		}
+		if err := m.connectWithRetry(ctx, server); err != nil {
+			server.logger().Error("Failed to connect server after retries", logging.Err(err))
+			if server.Config.Required {
+				requiredErrs = append(requiredErrs, fmt.Errorf("required server %s failed to connect: %w", name, err))
+			}
+		}
+	}
+	if len(requiredErrs) > 0 {
+		return errors.Join(requiredErrs...)
 	}
 
+	// Open pooled connections now rather than on the first requests
+	m.warmUpPools(ctx)
+
+	m.started.Store(true)
+	go m.quarantineLoop(quarantineCheckInterval(m.quarantineRetryInterval()))
+	if tick := m.healthTick(); tick > 0 {
+		go m.healthLoop(tick)
+	}
+	go m.idleLoop(idleCheckInterval)
+	go m.scheduleLoop(scheduleCheckInterval)
+
 	return nil
 }
 
-// connectWithRetry attempts to connect with exponential backoff
-func (m *Manager) connectWithRetry(ctx context.Context, server *ManagedServer, maxRetries int) error {
-	var lastErr error
-	for attempt := 1; attempt <= maxRetries; attempt++ {
-		if err := server.Connect(ctx); err == nil {
-			log.Printf("Connected to server %s", server.Name)
+// addServerLocked creates a managed server from cfg, wires it to the manager
+// and registers it. It must be called with m.mutex held.
+func (m *Manager) addServerLocked(cfg config.ServerConfig) (*ManagedServer, error) {
+	managed, err := NewManagedServer(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	managed.SetNotificationHandler(m.dispatchNotification)
+	managed.SetStatusHandler(m.handleStatus)
+	managed.SetQuarantinePolicy(m.config.Gateway.Quarantine.FailureBudget, m.quarantineRetryInterval())
+	managed.SetUnhealthyThreshold(m.config.Gateway.HealthCheck.UnhealthyThreshold)
+	managed.SetStateChangeHandler(m.notifyChange)
+	managed.SetEventHandler(m.handleEvent)
+	managed.dependencies = func() error { return m.dependenciesConnected(cfg) }
+	managed.retry = m.connectRetryPolicy(cfg)
+
+	if err := m.registry.Register(managed); err != nil {
+		return nil, err
+	}
+	m.servers[cfg.Name] = managed
+
+	managed.logger().Info("Registered server")
+	return managed, nil
+}
+
+// quarantineRetryInterval returns the configured quarantine retry interval
+func (m *Manager) quarantineRetryInterval() time.Duration {
+	if m.config.Gateway.Quarantine.RetryInterval > 0 {
+		return time.Duration(m.config.Gateway.Quarantine.RetryInterval) * time.Second
+	}
+	return DefaultRetryInterval
+}
+
+// quarantineCheckInterval returns how often to look for quarantined servers due a retry
+func quarantineCheckInterval(retryInterval time.Duration) time.Duration {
+	if retryInterval < 30*time.Second {
+		return retryInterval
+	}
+	return 30 * time.Second
+}
+
+// OnChange registers a callback invoked whenever the set of servers or their
+// capabilities may have changed
+func (m *Manager) OnChange(fn func()) {
+	m.listenerMutex.Lock()
+	defer m.listenerMutex.Unlock()
+	m.listeners = append(m.listeners, fn)
+}
+
+// OnNotification registers a handler for notifications sent by any upstream server
+func (m *Manager) OnNotification(handler NotificationHandler) {
+	m.listenerMutex.Lock()
+	defer m.listenerMutex.Unlock()
+	m.notificationHandlers = append(m.notificationHandlers, handler)
+}
+
+// dispatchNotification fans an upstream notification out to all registered handlers
+func (m *Manager) dispatchNotification(serverName string, notification json.RawMessage) {
+	m.listenerMutex.RLock()
+	handlers := make([]NotificationHandler, len(m.notificationHandlers))
+	copy(handlers, m.notificationHandlers)
+	m.listenerMutex.RUnlock()
+
+	for _, handler := range handlers {
+		handler(serverName, notification)
+	}
+}
+
+// notifyChange invokes all registered change callbacks
+func (m *Manager) notifyChange() {
+	m.listenerMutex.RLock()
+	listeners := make([]func(), len(m.listeners))
+	copy(listeners, m.listeners)
+	m.listenerMutex.RUnlock()
+
+	for _, fn := range listeners {
+		fn()
+	}
+}
+
+// connectWithRetry attempts to connect, retrying with the server's retry policy
+func (m *Manager) connectWithRetry(ctx context.Context, server *ManagedServer) error {
+	policy := server.retry
+	var err error
+	for retry := 0; ; retry++ {
+		if err = server.Connect(ctx); err == nil {
+			server.logger().Info("Connected to server")
 			return nil
-		} else {
-			lastErr = err
-			if attempt < maxRetries {
-				backoff := time.Duration(attempt) * time.Second
-				log.Printf("Retrying connection to %s in %v (attempt %d/%d)", server.Name, backoff, attempt, maxRetries)
-				select {
-				case <-time.After(backoff):
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-			}
+		}
+		if retry >= policy.maxRetries {
+			return err
+		}
+
+		backoff := policy.delay(retry + 1)
+		server.logger().Info("Retrying connection", "backoff", backoff, "retry", retry+1, "max_retries", policy.maxRetries)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
 		}
 	}
-	return lastErr
 }
 
-// Stop disconnects all servers
+// Stop runs shutdown hooks and disconnects all servers within DefaultShutdownTimeout
 func (m *Manager) Stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultShutdownTimeout)
+	defer cancel()
+
+	if err := m.Shutdown(ctx); err != nil {
+		slog.Warn("Error during shutdown", logging.Err(err))
+	}
+}
+
+// stopServers disconnects and unregisters every server
+func (m *Manager) stopServers(ctx context.Context) {
+	m.stopOnce.Do(func() {
+		close(m.done)
+	})
+
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
 	for name, server := range m.servers {
 		if err := server.Disconnect(ctx); err != nil {
-			log.Printf("Error disconnecting server %s: %v", name, err)
+			server.logger().Warn("Error disconnecting server", logging.Err(err))
 		}
 		// Also unregister from registry
 		if err := m.registry.Unregister(name); err != nil {
-			log.Printf("Error unregistering server %s: %v", name, err)
+			slog.Warn("Error unregistering server", logging.Server(name), logging.Err(err))
 		}
 	}
 
 	m.servers = make(map[string]*ManagedServer)
+	m.events.close()
 }
 
 // GetServer retrieves a managed server by name
@@ -133,12 +288,47 @@ func (m *Manager) ListServers() []*ManagedServer {
 	return m.registry.List()
 }
 
-// ListServersByCapability returns servers with a specific capability
+// ListActiveServers returns all managed servers that are neither quarantined,
+// disabled nor outside their schedule
+func (m *Manager) ListActiveServers() []*ManagedServer {
+	return routable(m.ListServers())
+}
+
+// ListServersByCapability returns routable servers with a specific capability
 func (m *Manager) ListServersByCapability(capability string) []*ManagedServer {
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
 
-	return m.registry.ListByCapability(capability)
+	return routable(m.registry.ListByCapability(capability))
+}
+
+// ListServersByTag returns routable servers carrying a specific tag
+func (m *Manager) ListServersByTag(tag string) []*ManagedServer {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return routable(m.registry.ListByTag(tag))
+}
+
+// ListServersByGroup returns the routable servers in a replica group
+func (m *Manager) ListServersByGroup(group string) []*ManagedServer {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return routable(m.registry.ListByGroup(group))
+}
+
+// routable filters quarantined, disabled and off-schedule servers out of a
+// list and orders the rest by preference
+func routable(servers []*ManagedServer) []*ManagedServer {
+	result := make([]*ManagedServer, 0, len(servers))
+	for _, server := range servers {
+		if !server.IsQuarantined() && !server.IsDisabled() && !server.OffSchedule() {
+			result = append(result, server)
+		}
+	}
+	sortByPreference(result)
+	return result
 }
 
 // ReconnectServer reconnects a specific server
@@ -155,9 +345,123 @@ func (m *Manager) ReconnectServer(name string) error {
 	defer cancel()
 
 	if err := server.Disconnect(ctx); err != nil {
-		log.Printf("Error disconnecting server %s: %v", name, err)
+		server.logger().Warn("Error disconnecting server", logging.Err(err))
+	}
+	defer m.notifyChange()
+	return m.connectWithRetry(ctx, server)
+}
+
+// AddServer registers a new server at runtime and connects it unless it is
+// lazy. A server that fails to connect stays registered, as at startup.
+func (m *Manager) AddServer(ctx context.Context, cfg config.ServerConfig) (*ManagedServer, error) {
+	m.mutex.Lock()
+	if _, exists := m.servers[cfg.Name]; exists {
+		m.mutex.Unlock()
+		return nil, &ManagerError{Op: "AddServer", Name: cfg.Name, Err: "already exists"}
+	}
+	server, err := m.addServerLocked(cfg)
+	m.mutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	defer m.notifyChange()
+
+	if cfg.Lazy {
+		server.logger().Info("Server will connect on first use")
+		return server, nil
+	}
+	if server.OffSchedule() {
+		server.logger().Info("Server is outside its schedule; connecting once it starts")
+		return server, nil
+	}
+	if err := m.connectWithRetry(ctx, server); err != nil {
+		return server, fmt.Errorf("failed to connect server %s: %w", cfg.Name, err)
+	}
+	return server, nil
+}
+
+// RemoveServer takes a server out of routing, waits for its requests in
+// flight to finish (bounded by ctx), then disconnects it
+func (m *Manager) RemoveServer(ctx context.Context, name string) error {
+	m.mutex.Lock()
+	server, exists := m.servers[name]
+	if !exists {
+		m.mutex.Unlock()
+		return &ManagerError{Op: "RemoveServer", Name: name, Err: "not found"}
+	}
+	if err := m.registry.Unregister(name); err != nil {
+		slog.Warn("Error unregistering server", logging.Server(name), logging.Err(err))
+	}
+	delete(m.servers, name)
+	m.mutex.Unlock()
+
+	defer m.notifyChange()
+
+	if err := server.Drain(ctx); err != nil {
+		server.logger().Warn("Server still had requests in flight after draining", logging.Err(err))
+	}
+
+	// Requests cut off by a drain timeout fail, but the server is removed either way
+	disconnectCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Disconnect(disconnectCtx); err != nil {
+		server.logger().Warn("Error disconnecting server", logging.Err(err))
+	}
+	server.logger().Info("Removed server")
+	return nil
+}
+
+// ConfigPath returns the file the manager's configuration was loaded from
+func (m *Manager) ConfigPath() string {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.config.Path
+}
+
+// DisableServer disconnects a server and takes it out of routing until it is enabled again
+func (m *Manager) DisableServer(name string) error {
+	m.mutex.RLock()
+	server, exists := m.servers[name]
+	m.mutex.RUnlock()
+
+	if !exists {
+		return &ManagerError{Op: "DisableServer", Name: name, Err: "not found"}
+	}
+
+	defer m.notifyChange()
+
+	server.setDisabled(true)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := server.Disconnect(ctx); err != nil {
+		server.logger().Warn("Error disconnecting server", logging.Err(err))
+	}
+	server.logger().Info("Server disabled")
+	return nil
+}
+
+// EnableServer reconnects a disabled server and returns it to routing
+func (m *Manager) EnableServer(name string) error {
+	m.mutex.RLock()
+	server, exists := m.servers[name]
+	m.mutex.RUnlock()
+
+	if !exists {
+		return &ManagerError{Op: "EnableServer", Name: name, Err: "not found"}
 	}
-	return m.connectWithRetry(ctx, server, 3)
+
+	defer m.notifyChange()
+
+	server.setDisabled(false)
+	server.logger().Info("Server enabled")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return m.connectWithRetry(ctx, server)
 }
 
 // ManagerError represents a manager operation error
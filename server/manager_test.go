@@ -2,10 +2,14 @@ package server
 
 import (
 	"context"
+	"errors"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/j4ng5y/mcpgate/config"
+	"github.com/j4ng5y/mcpgate/internal/mcptest"
 )
 
 func TestManager_NewManager(t *testing.T) {
@@ -84,7 +88,8 @@ func TestManager_Start_EnabledServer(t *testing.T) {
 				Name:      "echo-server",
 				Transport: "stdio",
 				Enabled:   true,
-				Command:   "cat",
+				Command:   mcptest.EchoCommand,
+				Args:      mcptest.EchoArgs(),
 			},
 		},
 	}
@@ -106,6 +111,73 @@ func TestManager_Start_EnabledServer(t *testing.T) {
 	}
 }
 
+func TestManager_Start_RequiredServer(t *testing.T) {
+	broken := func(name string, required bool) config.ServerConfig {
+		return config.ServerConfig{
+			Name:      name,
+			Transport: "stdio",
+			Enabled:   true,
+			Command:   "/nonexistent/mcp-server",
+			Required:  required,
+			Retry:     config.RetryConfig{MaxRetries: -1},
+		}
+	}
+
+	// An optional server that fails leaves the gateway running degraded
+	manager := NewManager(&config.Config{Servers: []config.ServerConfig{broken("optional", false)}})
+	if err := manager.Start(); err != nil {
+		t.Errorf("Expected an optional server not to fail Start, got %v", err)
+	}
+	manager.Stop()
+
+	manager = NewManager(&config.Config{Servers: []config.ServerConfig{broken("optional", false), broken("critical", true)}})
+	err := manager.Start()
+	manager.Stop()
+	if err == nil {
+		t.Fatal("Expected Start to fail when a required server cannot connect")
+	}
+	if !strings.Contains(err.Error(), "required server critical") || strings.Contains(err.Error(), "optional") {
+		t.Errorf("Expected only the required server in the error, got %v", err)
+	}
+}
+
+func TestManager_Start_WarmsUpPools(t *testing.T) {
+	manager := NewManager(&config.Config{Servers: []config.ServerConfig{{
+		Name:       "echo",
+		Transport:  "stdio",
+		Enabled:    true,
+		Command:    mcptest.EchoCommand,
+		Args:       mcptest.EchoArgs(),
+		PoolSize:   3,
+		PoolWarmUp: 2,
+	}}})
+	if err := manager.Start(); err != nil {
+		t.Fatalf("Failed to start: %v", err)
+	}
+	defer manager.Stop()
+
+	server, err := manager.GetServer("echo")
+	if err != nil {
+		t.Fatalf("Failed to get server: %v", err)
+	}
+	stats := server.PoolStats()
+	connections, _ := stats["connections"].([]map[string]interface{})
+	if stats["open"] != 2 || stats["in_use"] != 0 || len(connections) != 2 {
+		t.Fatalf("Expected two idle warm pooled connections, got %v", stats)
+	}
+	if !connections[0]["connected"].(bool) || connections[0]["health_score"] != 1.0 {
+		t.Errorf("Expected a healthy connected pooled connection, got %v", connections[0])
+	}
+
+	// Warming up again only tops the pool up
+	if err := server.WarmUp(context.Background(), 5); err != nil {
+		t.Fatalf("WarmUp failed: %v", err)
+	}
+	if open := server.PoolStats()["open"]; open != 3 {
+		t.Errorf("Expected warm-up capped at pool_size 3, got %v", open)
+	}
+}
+
 func TestManager_GetServer(t *testing.T) {
 	cfg := &config.Config{
 		Gateway: config.GatewayConfig{
@@ -116,7 +188,8 @@ func TestManager_GetServer(t *testing.T) {
 				Name:      "test-server",
 				Transport: "stdio",
 				Enabled:   true,
-				Command:   "cat",
+				Command:   mcptest.EchoCommand,
+				Args:      mcptest.EchoArgs(),
 			},
 		},
 	}
@@ -165,13 +238,15 @@ func TestManager_ListServers(t *testing.T) {
 				Name:      "server1",
 				Transport: "stdio",
 				Enabled:   true,
-				Command:   "cat",
+				Command:   mcptest.EchoCommand,
+				Args:      mcptest.EchoArgs(),
 			},
 			{
 				Name:      "server2",
 				Transport: "stdio",
 				Enabled:   true,
-				Command:   "cat",
+				Command:   mcptest.EchoCommand,
+				Args:      mcptest.EchoArgs(),
 			},
 		},
 	}
@@ -197,7 +272,8 @@ func TestManager_ListServersByCapability(t *testing.T) {
 				Name:      "server1",
 				Transport: "stdio",
 				Enabled:   true,
-				Command:   "cat",
+				Command:   mcptest.EchoCommand,
+				Args:      mcptest.EchoArgs(),
 			},
 		},
 	}
@@ -234,7 +310,8 @@ func TestManager_Stop(t *testing.T) {
 				Name:      "test-server",
 				Transport: "stdio",
 				Enabled:   true,
-				Command:   "cat",
+				Command:   mcptest.EchoCommand,
+				Args:      mcptest.EchoArgs(),
 			},
 		},
 	}
@@ -267,7 +344,8 @@ func TestManager_ReconnectServer(t *testing.T) {
 				Name:      "test-server",
 				Transport: "stdio",
 				Enabled:   true,
-				Command:   "cat",
+				Command:   mcptest.EchoCommand,
+				Args:      mcptest.EchoArgs(),
 			},
 		},
 	}
@@ -313,19 +391,22 @@ func TestManager_MultipleServers(t *testing.T) {
 				Name:      "server1",
 				Transport: "stdio",
 				Enabled:   true,
-				Command:   "cat",
+				Command:   mcptest.EchoCommand,
+				Args:      mcptest.EchoArgs(),
 			},
 			{
 				Name:      "server2",
 				Transport: "stdio",
 				Enabled:   true,
-				Command:   "cat",
+				Command:   mcptest.EchoCommand,
+				Args:      mcptest.EchoArgs(),
 			},
 			{
 				Name:      "server3",
 				Transport: "stdio",
 				Enabled:   false, // This one is disabled
-				Command:   "cat",
+				Command:   mcptest.EchoCommand,
+				Args:      mcptest.EchoArgs(),
 			},
 		},
 	}
@@ -380,7 +461,8 @@ func TestManager_Concurrency(t *testing.T) {
 				Name:      "test-server",
 				Transport: "stdio",
 				Enabled:   true,
-				Command:   "cat",
+				Command:   mcptest.EchoCommand,
+				Args:      mcptest.EchoArgs(),
 			},
 		},
 	}
@@ -441,3 +523,566 @@ func TestManager_Timeout(t *testing.T) {
 
 	manager.Stop()
 }
+
+func TestManager_QuarantineAfterFailureBudget(t *testing.T) {
+	cfg := &config.Config{
+		Gateway: config.GatewayConfig{
+			Quarantine: config.QuarantineConfig{
+				FailureBudget: 2,
+				RetryInterval: 60,
+			},
+		},
+		Servers: []config.ServerConfig{
+			{
+				Name:         "broken",
+				Transport:    "stdio",
+				Enabled:      true,
+				Command:      "/nonexistent/mcp-server",
+				Capabilities: []string{"tools"},
+			},
+		},
+	}
+
+	manager := NewManager(cfg)
+	if err := manager.Start(); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+	defer manager.Stop()
+
+	server, err := manager.GetServer("broken")
+	if err != nil {
+		t.Fatalf("Failed to get server: %v", err)
+	}
+
+	if !server.IsQuarantined() {
+		t.Fatalf("Expected server to be quarantined after %d failures", server.ConsecutiveFailures())
+	}
+
+	if server.State() != "quarantined" {
+		t.Errorf("Expected state 'quarantined', got '%s'", server.State())
+	}
+
+	if len(manager.ListServersByCapability("tools")) != 0 {
+		t.Error("Quarantined server should be excluded from capability routing")
+	}
+
+	if len(manager.ListActiveServers()) != 0 {
+		t.Error("Quarantined server should be excluded from active servers")
+	}
+
+	if len(manager.ListServers()) != 1 {
+		t.Error("Quarantined server should still be listed")
+	}
+
+	// Not yet due for a retry
+	retryAt := server.QuarantineRetryAt()
+	manager.retryQuarantined(time.Now())
+	if !server.QuarantineRetryAt().Equal(retryAt) {
+		t.Error("Server should not be retried before its retry time")
+	}
+
+	// Due, but still failing: stays quarantined with a later retry time
+	manager.retryQuarantined(retryAt.Add(time.Second))
+	if !server.IsQuarantined() {
+		t.Error("Server should remain quarantined while still failing")
+	}
+	if !server.QuarantineRetryAt().After(retryAt) {
+		t.Error("Retry time should move forward after a failed retry")
+	}
+}
+
+func TestManagedServer_QuarantineRelease(t *testing.T) {
+	server, err := NewManagedServer(config.ServerConfig{
+		Name:      "flaky",
+		Transport: "stdio",
+		Command:   mcptest.EchoCommand,
+		Args:      mcptest.EchoArgs(),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create managed server: %v", err)
+	}
+
+	changes := 0
+	server.SetQuarantinePolicy(1, time.Minute)
+	server.SetStateChangeHandler(func() { changes++ })
+
+	server.mutex.Lock()
+	quarantined := server.recordFailureLocked()
+	server.mutex.Unlock()
+
+	if !quarantined || !server.IsQuarantined() {
+		t.Fatal("Expected server to be quarantined after exhausting budget of 1")
+	}
+
+	server.release()
+	if server.IsQuarantined() || server.ConsecutiveFailures() != 0 {
+		t.Error("Expected release to clear quarantine and failures")
+	}
+	if changes != 1 {
+		t.Errorf("Expected 1 state change callback, got %d", changes)
+	}
+}
+
+func TestManager_ShutdownHooksRunInReverseOrder(t *testing.T) {
+	manager := NewManager(&config.Config{})
+
+	var order []string
+	for _, name := range []string{"first", "second", "third"} {
+		manager.RegisterShutdownHook(name, func(ctx context.Context) error {
+			order = append(order, name)
+			return nil
+		})
+	}
+
+	if err := manager.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown returned error: %v", err)
+	}
+
+	want := []string{"third", "second", "first"}
+	if len(order) != len(want) {
+		t.Fatalf("Expected hooks %v, got %v", want, order)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("Expected hooks %v, got %v", want, order)
+		}
+	}
+
+	// Hooks run only once even if shutdown is repeated
+	manager.Stop()
+	if len(order) != len(want) {
+		t.Errorf("Expected hooks to run once, got %v", order)
+	}
+}
+
+func TestManager_ShutdownHooksShareDeadline(t *testing.T) {
+	manager := NewManager(&config.Config{})
+
+	var skippedRan bool
+	manager.RegisterShutdownHook("skipped", func(ctx context.Context) error {
+		skippedRan = true
+		return nil
+	})
+	manager.RegisterShutdownHook("slow", func(ctx context.Context) error {
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("Expected hook context to carry a deadline")
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err := manager.Shutdown(ctx)
+	if err == nil {
+		t.Fatal("Expected error from expired deadline")
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+	if skippedRan {
+		t.Error("Expected hook after the deadline to be skipped")
+	}
+}
+
+func TestManager_LazyServerConnectsOnFirstUse(t *testing.T) {
+	manager := NewManager(&config.Config{
+		Servers: []config.ServerConfig{
+			{Name: "lazy", Transport: "stdio", Enabled: true, Command: mcptest.EchoCommand, Args: mcptest.EchoArgs(), Lazy: true},
+		},
+	})
+	if err := manager.Start(); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+	defer manager.Stop()
+
+	changes := make(chan struct{}, 10)
+	manager.OnChange(func() {
+		changes <- struct{}{}
+	})
+
+	server, _ := manager.GetServer("lazy")
+	if server.IsConnected() || server.State() != "idle" {
+		t.Fatalf("Expected lazy server to stay idle at startup, got %s", server.State())
+	}
+
+	resp, err := server.SendRequest(context.Background(), map[string]interface{}{"jsonrpc": "2.0", "id": 7, "method": "ping"})
+	if err != nil {
+		t.Fatalf("SendRequest failed: %v", err)
+	}
+	if !server.IsConnected() || !strings.Contains(string(resp), `"id":7`) {
+		t.Errorf("Expected the request to connect the server and reach it, got %s", resp)
+	}
+
+	select {
+	case <-changes:
+	case <-time.After(time.Second):
+		t.Error("Expected a change notification once the lazy server connected")
+	}
+}
+
+func TestManager_Reload(t *testing.T) {
+	manager := NewManager(&config.Config{
+		Servers: []config.ServerConfig{
+			{Name: "kept", Transport: "stdio", Enabled: true, Command: mcptest.EchoCommand, Args: mcptest.EchoArgs()},
+			{Name: "changed", Transport: "stdio", Enabled: true, Command: mcptest.EchoCommand, Args: mcptest.EchoArgs()},
+			{Name: "removed", Transport: "stdio", Enabled: true, Command: mcptest.EchoCommand, Args: mcptest.EchoArgs()},
+		},
+	})
+	if err := manager.Start(); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+	defer manager.Stop()
+
+	kept, _ := manager.GetServer("kept")
+	changed, _ := manager.GetServer("changed")
+	removed, _ := manager.GetServer("removed")
+
+	err := manager.Reload(&config.Config{
+		Servers: []config.ServerConfig{
+			{Name: "kept", Transport: "stdio", Enabled: true, Command: mcptest.EchoCommand, Args: mcptest.EchoArgs()},
+			{Name: "changed", Transport: "stdio", Enabled: true, Command: mcptest.EchoCommand, Args: mcptest.EchoArgs(), Timeout: 10},
+			{Name: "added", Transport: "stdio", Enabled: true, Command: mcptest.EchoCommand, Args: mcptest.EchoArgs()},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+
+	if server, _ := manager.GetServer("kept"); server != kept || !kept.IsConnected() {
+		t.Error("Expected the unchanged server to keep its connection")
+	}
+
+	server, err := manager.GetServer("changed")
+	if err != nil || server == changed || server.Config.Timeout != 10 || !server.IsConnected() {
+		t.Error("Expected the changed server to be replaced and connected")
+	}
+	if changed.IsConnected() {
+		t.Error("Expected the old instance of the changed server to be disconnected")
+	}
+
+	if _, err := manager.GetServer("removed"); err == nil {
+		t.Error("Expected the removed server to be gone")
+	}
+	if removed.IsConnected() {
+		t.Error("Expected the removed server to be disconnected")
+	}
+
+	if server, err := manager.GetServer("added"); err != nil || !server.IsConnected() {
+		t.Error("Expected the added server to be connected")
+	}
+	if len(manager.ListServers()) != 3 {
+		t.Errorf("Expected 3 servers after reload, got %d", len(manager.ListServers()))
+	}
+}
+
+func TestManager_ConnectRetryPolicy(t *testing.T) {
+	manager := NewManager(&config.Config{
+		Gateway: config.GatewayConfig{
+			Retry: config.RetryConfig{MaxRetries: 5, Backoff: 2},
+		},
+	})
+
+	policy := manager.connectRetryPolicy(config.ServerConfig{
+		Retry: config.RetryConfig{Backoff: 3, BackoffMax: 10},
+	})
+	if policy.maxRetries != 5 || policy.backoff != 3*time.Second || policy.backoffMax != 10*time.Second {
+		t.Errorf("Expected server keys to override gateway defaults, got %+v", policy)
+	}
+
+	policy = manager.connectRetryPolicy(config.ServerConfig{})
+	if policy.maxRetries != 5 || policy.backoff != 2*time.Second || policy.backoffMax != DefaultConnectBackoffMax {
+		t.Errorf("Expected gateway and package defaults, got %+v", policy)
+	}
+
+	policy = manager.connectRetryPolicy(config.ServerConfig{Retry: config.RetryConfig{MaxRetries: -1}})
+	if policy.maxRetries != 0 {
+		t.Errorf("Expected max_retries = -1 to disable retries, got %d", policy.maxRetries)
+	}
+
+	for retry := 1; retry <= 10; retry++ {
+		delay := policy.delay(retry)
+		limit := policy.backoff << (retry - 1)
+		if limit > policy.backoffMax {
+			limit = policy.backoffMax
+		}
+		if delay < limit/2 || delay > limit {
+			t.Errorf("Retry %d: expected a delay between %v and %v, got %v", retry, limit/2, limit, delay)
+		}
+	}
+}
+
+func TestManager_ConnectWithoutRetries(t *testing.T) {
+	manager := NewManager(&config.Config{
+		Servers: []config.ServerConfig{
+			{
+				Name:      "missing",
+				Transport: "stdio",
+				Enabled:   true,
+				Command:   "mcpgate-test-no-such-command",
+				Retry:     config.RetryConfig{MaxRetries: -1},
+			},
+		},
+	})
+
+	start := time.Now()
+	if err := manager.Start(); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+	defer manager.Stop()
+
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected a single connection attempt, took %s", elapsed)
+	}
+}
+
+func TestManager_PickReplica(t *testing.T) {
+	manager := NewManager(&config.Config{
+		Servers: config.ExpandReplicas([]config.ServerConfig{
+			{Name: "python", Transport: "stdio", Enabled: true, Command: mcptest.EchoCommand, Args: mcptest.EchoArgs(), Lazy: true, Replicas: 3},
+			{Name: "single", Transport: "stdio", Enabled: true, Command: mcptest.EchoCommand, Args: mcptest.EchoArgs(), Lazy: true},
+		}),
+	})
+	if err := manager.Start(); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+	defer manager.Stop()
+
+	single, err := manager.GetServer("single")
+	if err != nil {
+		t.Fatalf("Failed to get server: %v", err)
+	}
+	if got := manager.PickReplica(single); got != single {
+		t.Errorf("Expected a server outside a group to be picked as is, got %s", got.Name)
+	}
+
+	replicas := manager.ListServersByGroup("python")
+	if len(replicas) != 3 {
+		t.Fatalf("Expected 3 replicas, got %d", len(replicas))
+	}
+
+	// Equally loaded replicas take turns
+	picked := make(map[string]bool)
+	for range replicas {
+		picked[manager.PickReplica(replicas[0]).Name] = true
+	}
+	if len(picked) != len(replicas) {
+		t.Errorf("Expected every idle replica to be picked once, got %v", picked)
+	}
+
+	// Busy replicas are passed over for the idle one
+	for _, replica := range replicas[:2] {
+		replica.mutex.Lock()
+		replica.beginRequestLocked()
+		replica.mutex.Unlock()
+		defer replica.finishRequest()
+	}
+	for range replicas {
+		if got := manager.PickReplica(replicas[0]); got != replicas[2] {
+			t.Errorf("Expected the idle replica %s, got %s with %d in flight", replicas[2].Name, got.Name, got.InFlight())
+		}
+	}
+}
+
+func TestManager_PreferenceOrder(t *testing.T) {
+	manager := NewManager(&config.Config{
+		Servers: []config.ServerConfig{
+			{Name: "backup", Transport: "stdio", Enabled: true, Command: mcptest.EchoCommand, Args: mcptest.EchoArgs(), Lazy: true, Capabilities: []string{"tools"}},
+			{Name: "primary", Transport: "stdio", Enabled: true, Command: mcptest.EchoCommand, Args: mcptest.EchoArgs(), Lazy: true, Capabilities: []string{"tools"}, Priority: 10},
+			{Name: "secondary", Transport: "stdio", Enabled: true, Command: mcptest.EchoCommand, Args: mcptest.EchoArgs(), Lazy: true, Capabilities: []string{"tools"}, Priority: 5},
+		},
+	})
+	if err := manager.Start(); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+	defer manager.Stop()
+
+	names := func() []string {
+		var names []string
+		for _, server := range manager.ListServersByCapability("tools") {
+			names = append(names, server.Name)
+		}
+		return names
+	}
+
+	if got := names(); !slices.Equal(got, []string{"primary", "secondary", "backup"}) {
+		t.Errorf("Expected servers by descending priority, got %v", got)
+	}
+
+	// An unhealthy server is failed over from until it recovers
+	primary, err := manager.GetServer("primary")
+	if err != nil {
+		t.Fatalf("Failed to get server: %v", err)
+	}
+	primary.mutex.Lock()
+	primary.health.Status = HealthUnhealthy
+	primary.mutex.Unlock()
+
+	if got := names(); !slices.Equal(got, []string{"secondary", "backup", "primary"}) {
+		t.Errorf("Expected the unhealthy server last, got %v", got)
+	}
+
+	primary.mutex.Lock()
+	primary.health.Status = HealthHealthy
+	primary.mutex.Unlock()
+
+	if got := names(); got[0] != "primary" {
+		t.Errorf("Expected the recovered server first, got %v", got)
+	}
+}
+
+func TestManager_Subscribe(t *testing.T) {
+	manager := NewManager(&config.Config{
+		Servers: []config.ServerConfig{
+			{Name: "events", Transport: "stdio", Enabled: true, Command: mcptest.EchoCommand, Args: mcptest.EchoArgs(), Lazy: true, Timeout: 5},
+		},
+	})
+	if err := manager.Start(); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+
+	events, unsubscribe := manager.Subscribe(0)
+	other, _ := manager.Subscribe(1)
+
+	server, err := manager.GetServer("events")
+	if err != nil {
+		t.Fatalf("Failed to get server: %v", err)
+	}
+	ctx := context.Background()
+	if err := server.Connect(ctx); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	if err := server.Disconnect(ctx); err != nil {
+		t.Fatalf("Failed to disconnect: %v", err)
+	}
+
+	for _, want := range []string{EventConnected, EventDisconnected} {
+		select {
+		case event := <-events:
+			if event.Type != want || event.Server != "events" || event.Time.IsZero() {
+				t.Errorf("Expected a %s event for server events, got %+v", want, event)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out waiting for the %s event", want)
+		}
+	}
+
+	unsubscribe()
+	if _, ok := <-events; ok {
+		t.Error("Expected the channel to be closed after unsubscribing")
+	}
+	unsubscribe()
+
+	// The second subscriber kept only what fit in its buffer
+	if event := <-other; event.Type != EventConnected {
+		t.Errorf("Expected the first event to be kept, got %+v", event)
+	}
+
+	manager.Stop()
+	if _, ok := <-other; ok {
+		t.Error("Expected the channel to be closed when the manager stops")
+	}
+	late, _ := manager.Subscribe(1)
+	if _, ok := <-late; ok {
+		t.Error("Expected subscriptions after stopping to end at once")
+	}
+}
+
+func TestManager_Schedule(t *testing.T) {
+	// A daily window starting two hours from now, so the server starts outside it
+	now := time.Now()
+	start, end := now.Add(2*time.Hour), now.Add(3*time.Hour)
+	manager := NewManager(&config.Config{
+		Servers: []config.ServerConfig{
+			{
+				Name:         "office",
+				Transport:    "stdio",
+				Enabled:      true,
+				Command:      mcptest.EchoCommand,
+				Args:         mcptest.EchoArgs(),
+				Timeout:      5,
+				Capabilities: []string{"tools"},
+				Schedule:     start.Format("15:04") + "-" + end.Format("15:04"),
+			},
+		},
+	})
+	if err := manager.Start(); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+	defer manager.Stop()
+
+	server, err := manager.GetServer("office")
+	if err != nil {
+		t.Fatalf("Failed to get server: %v", err)
+	}
+	if server.IsConnected() || server.State() != StateOffSchedule || len(manager.ListActiveServers()) != 0 {
+		t.Fatalf("Expected an unconnected, unroutable server, got state %s", server.State())
+	}
+	resp, err := server.SendRequest(context.Background(), map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": "ping"})
+	if err != nil || !strings.Contains(string(resp), "outside its schedule") {
+		t.Errorf("Expected requests to be refused, got %s %v", resp, err)
+	}
+
+	manager.applySchedules(start.Add(30 * time.Minute))
+	deadline := time.Now().Add(5 * time.Second)
+	for !server.IsConnected() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !server.IsConnected() || len(manager.ListActiveServers()) != 1 {
+		t.Fatalf("Expected the server to connect once its window started, got state %s", server.State())
+	}
+
+	manager.applySchedules(end.Add(30 * time.Minute))
+	if server.IsConnected() || server.State() != StateOffSchedule {
+		t.Errorf("Expected the server to disconnect once its window ended, got state %s", server.State())
+	}
+}
+
+func TestManager_DependsOn(t *testing.T) {
+	cfg := &config.Config{
+		Servers: []config.ServerConfig{
+			{Name: "query", Transport: "stdio", Enabled: true, Command: mcptest.EchoCommand, Args: mcptest.EchoArgs(), DependsOn: []string{"db"}},
+			{Name: "db", Transport: "stdio", Enabled: true, Command: mcptest.EchoCommand, Args: mcptest.EchoArgs(), Lazy: true},
+		},
+	}
+
+	manager := NewManager(cfg)
+	if err := manager.Start(); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+	defer manager.Stop()
+
+	query, _ := manager.GetServer("query")
+	db, _ := manager.GetServer("db")
+	if query.IsConnected() {
+		t.Fatal("Expected query not to connect before db")
+	}
+	if err := query.Connect(context.Background()); err == nil || !strings.Contains(err.Error(), "dependency db") {
+		t.Errorf("Expected connecting query to wait for db, got %v", err)
+	}
+
+	waitFor := func(what string, cond func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("Timed out waiting for %s", what)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// Connecting the dependency starts its dependent
+	if err := db.Connect(context.Background()); err != nil {
+		t.Fatalf("Failed to connect db: %v", err)
+	}
+	waitFor("query to start", query.IsConnected)
+
+	// Restarting the dependency restarts its dependent
+	connections := len(query.History().Events)
+	db.publish(Event{Type: EventRestarted})
+	waitFor("query to restart", func() bool {
+		return len(query.History().Events) >= connections+2 && query.IsConnected()
+	})
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"encoding/json"
+	"slices"
+	"sync"
+	"time"
+)
+
+// latencyWindow is how many recent requests latency percentiles cover
+const latencyWindow = 1024
+
+// RequestMetrics summarizes the requests sent to a server through SendRequest
+type RequestMetrics struct {
+	Requests  int64
+	Errors    int64   // Requests answered with an error, by the upstream or the gateway
+	ErrorRate float64 // Errors over Requests, or zero without requests
+	P50       time.Duration
+	P90       time.Duration
+	P99       time.Duration // Percentiles over the last latencyWindow requests
+}
+
+// requestMetrics counts a server's requests and keeps its recent latencies
+type requestMetrics struct {
+	mutex     sync.Mutex
+	requests  int64
+	errors    int64
+	latencies []time.Duration // Ring buffer of at most latencyWindow entries
+	next      int             // Where the next latency goes once the buffer is full
+}
+
+// record counts a request that took latency and whether it failed
+func (m *requestMetrics) record(latency time.Duration, failed bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.requests++
+	if failed {
+		m.errors++
+	}
+	if len(m.latencies) < latencyWindow {
+		m.latencies = append(m.latencies, latency)
+		return
+	}
+	m.latencies[m.next] = latency
+	m.next = (m.next + 1) % latencyWindow
+}
+
+// snapshot returns the counts and the latency percentiles
+func (m *requestMetrics) snapshot() RequestMetrics {
+	m.mutex.Lock()
+	metrics := RequestMetrics{Requests: m.requests, Errors: m.errors}
+	latencies := slices.Clone(m.latencies)
+	m.mutex.Unlock()
+
+	if metrics.Requests > 0 {
+		metrics.ErrorRate = float64(metrics.Errors) / float64(metrics.Requests)
+	}
+	if len(latencies) > 0 {
+		slices.Sort(latencies)
+		metrics.P50 = percentile(latencies, 50)
+		metrics.P90 = percentile(latencies, 90)
+		metrics.P99 = percentile(latencies, 99)
+	}
+	return metrics
+}
+
+// percentile returns the nearest-rank percentile p of sorted latencies
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	return sorted[max(rank, 1)-1]
+}
+
+// RequestMetrics returns the server's request counts and latency percentiles
+func (s *ManagedServer) RequestMetrics() RequestMetrics {
+	return s.metrics.snapshot()
+}
+
+// isErrorResponse reports whether a SendRequest result is a failure: an error,
+// or a JSON-RPC response carrying one
+func isErrorResponse(resp json.RawMessage, err error) bool {
+	if err != nil {
+		return true
+	}
+	var probe struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if json.Unmarshal(resp, &probe) != nil {
+		return false
+	}
+	return len(probe.Error) > 0 && string(probe.Error) != "null"
+}
@@ -0,0 +1,241 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/j4ng5y/mcpgate/config"
+	"github.com/j4ng5y/mcpgate/logging"
+	"github.com/j4ng5y/mcpgate/pool"
+	"github.com/j4ng5y/mcpgate/transport"
+)
+
+// DefaultPoolIdleTime is how long a pooled connection may go unused before
+// the idle loop closes it
+const DefaultPoolIdleTime = 5 * time.Minute
+
+// newServerPool returns the connection pool for a server with pool_size set, or nil
+func newServerPool(cfg config.ServerConfig) *pool.ConnectionPool {
+	if cfg.PoolSize <= 0 {
+		return nil
+	}
+	connPool := pool.NewConnectionPool(cfg.PoolSize, DefaultPoolIdleTime)
+	connPool.SetMaxWait(time.Duration(cfg.PoolWait) * time.Second)
+	connPool.SetMaxLifetime(time.Duration(cfg.MaxConnLifetime) * time.Second)
+	if policy, err := pool.ParseEvictionPolicy(cfg.PoolEviction); err == nil {
+		connPool.SetEvictionPolicy(policy)
+	}
+	if cfg.PoolCoolDown > 0 {
+		connPool.SetCoolDown(time.Duration(cfg.PoolCoolDown) * time.Second)
+	}
+	return connPool
+}
+
+// sessionMethods are the requests that change the state of the upstream
+// session rather than asking a question, so they always go over the server's
+// own connection, which outlives any pooled one
+var sessionMethods = map[string]bool{
+	"resources/subscribe":   true,
+	"resources/unsubscribe": true,
+	"logging/setLevel":      true,
+}
+
+// pooledRequests remembers the pooled connection carrying each request in
+// flight, keyed by its JSON-RPC id, so a cancellation is sent over the
+// connection that can match the id
+type pooledRequests struct {
+	mutex sync.Mutex
+	byID  map[string]transport.Transport
+}
+
+// track records that the request with the given id is carried by t and
+// returns the function that forgets it
+func (p *pooledRequests) track(id string, t transport.Transport) func() {
+	if id == "" {
+		return func() {}
+	}
+
+	p.mutex.Lock()
+	if p.byID == nil {
+		p.byID = make(map[string]transport.Transport)
+	}
+	p.byID[id] = t
+	p.mutex.Unlock()
+
+	return func() {
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+		// A later request may have reused the id
+		if p.byID[id] == t {
+			delete(p.byID, id)
+		}
+	}
+}
+
+// carrier returns the pooled connection carrying the request with the given id, if any
+func (p *pooledRequests) carrier(id string) (transport.Transport, bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	t, ok := p.byID[id]
+	return t, ok
+}
+
+// acquireTransport returns the transport to send a request over: an idle
+// pooled connection, a new one while the pool has room, one returned within
+// pool_wait, or otherwise the server's own connection. Session methods such
+// as resources/subscribe always use the server's own connection. release
+// must be called with the transport's error once the request is done.
+func (s *ManagedServer) acquireTransport(ctx context.Context, request interface{}) (transport.Transport, func(error)) {
+	primary := s.activeTransport()
+	if s.pool == nil || sessionMethods[requestMethod(request)] {
+		return primary, func(error) {}
+	}
+
+	lease, err := s.pool.GetTransport(ctx, s.Config.Transport, transportConfig(s.Config))
+	if err != nil {
+		return primary, func(error) {}
+	}
+	t := lease.Transport()
+	if !t.IsConnected() {
+		if err := s.connectPooled(ctx, t); err != nil {
+			s.logger().Warn("Failed to open a pooled connection", logging.Err(err))
+			_ = t.Disconnect(ctx)
+			_ = lease.Release(err)
+			return primary, func(error) {}
+		}
+	}
+
+	forget := s.pooledRequests.track(requestID(request), t)
+	return t, func(err error) {
+		forget()
+		_ = lease.Release(err)
+	}
+}
+
+// notificationTransport returns the transport to send a notification over: the
+// pooled connection carrying the request a cancellation names, or otherwise
+// the server's own connection
+func (s *ManagedServer) notificationTransport(notification interface{}) transport.Transport {
+	if s.pool != nil && requestMethod(notification) == "notifications/cancelled" {
+		if t, ok := s.pooledRequests.carrier(cancelledRequestID(notification)); ok {
+			return t
+		}
+	}
+	return s.activeTransport()
+}
+
+// connectPooled connects and initializes a new pooled connection. Its
+// notifications, such as progress for the requests sent over it, are
+// handled like those of the server's own connection.
+func (s *ManagedServer) connectPooled(ctx context.Context, t transport.Transport) error {
+	if source, ok := t.(transport.NotificationSource); ok {
+		source.SetNotificationHandler(s.handleNotification)
+	}
+
+	if err := t.Connect(ctx); err != nil {
+		return err
+	}
+
+	if _, err := s.handshake(ctx, t, s.initializeParams()); err != nil {
+		return fmt.Errorf("initialize failed: %w", err)
+	}
+	return nil
+}
+
+// WarmUp opens pooled connections until the server has n ready, or as many
+// as pool_size allows, so the first requests do not wait for them to connect.
+// It does nothing for a server without a pool.
+func (s *ManagedServer) WarmUp(ctx context.Context, n int) error {
+	if s.pool == nil || n <= 0 {
+		return nil
+	}
+	return s.pool.WarmUp(ctx, s.Config.Transport, transportConfig(s.Config), n, s.connectPooled)
+}
+
+// warmUpPools warms up the pools of the connected servers with pool_warm_up
+// set, all at once
+func (m *Manager) warmUpPools(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, server := range m.servers {
+		if server.Config.PoolWarmUp <= 0 || !server.IsConnected() {
+			continue
+		}
+		wg.Add(1)
+		go func(server *ManagedServer) {
+			defer wg.Done()
+			if err := server.WarmUp(ctx, server.Config.PoolWarmUp); err != nil {
+				server.logger().Warn("Failed to warm up the connection pool", logging.Err(err))
+			}
+		}(server)
+	}
+	wg.Wait()
+}
+
+// PoolStats returns the occupancy of the server's connection pool, the
+// health and request count of each pooled connection and the time requests
+// spent waiting for one, or nil for a server without a pool
+func (s *ManagedServer) PoolStats() map[string]interface{} {
+	if s.pool == nil {
+		return nil
+	}
+
+	stats := s.pool.Stats()
+	result := map[string]interface{}{
+		"size":          s.Config.PoolSize,
+		"open":          0,
+		"in_use":        0,
+		"requests":      0,
+		"connections":   []map[string]interface{}{},
+		"waits":         stats["waits"],
+		"wait_time":     stats["wait_time"],
+		"wait_timeouts": stats["wait_timeouts"],
+		"evictions":     stats["evictions"],
+		"circuit_open":  false,
+		"circuit_trips": stats["circuit_trips"],
+	}
+	if open, _ := stats["open_circuits"].([]string); slices.Contains(open, s.Name) {
+		result["circuit_open"] = true
+	}
+	byServer, _ := stats["by_server"].(map[string]map[string]interface{})
+	if entry, ok := byServer[s.Name]; ok {
+		result["open"] = entry["total"]
+		result["in_use"] = entry["in_use"]
+		result["requests"] = entry["requests"]
+		result["connections"] = entry["connections"]
+	}
+	return result
+}
+
+// poolCircuitChanged reports that the pool stopped using its connections
+// because all of them are unhealthy, or that one is healthy again. Requests
+// go over the server's own connection meanwhile.
+func (s *ManagedServer) poolCircuitChanged(_ string, open bool) {
+	if open {
+		s.logger().Warn("All pooled connections are unhealthy; using the server's own connection while the pool cools down")
+		s.publish(Event{Type: EventPoolCircuitOpen})
+		return
+	}
+	s.logger().Info("Pooled connections are healthy again")
+	s.publish(Event{Type: EventPoolCircuitClosed})
+}
+
+// cleanPool closes pooled connections that have been idle too long or
+// outlived max_conn_lifetime, then reopens connections up to pool_warm_up so
+// the pool stays warm
+func (s *ManagedServer) cleanPool(ctx context.Context) {
+	if s.pool == nil {
+		return
+	}
+	if err := s.pool.CleanIdleConnections(ctx); err != nil {
+		s.logger().Warn("Error closing idle pooled connections", logging.Err(err))
+	}
+	if !s.IsConnected() {
+		return
+	}
+	if err := s.WarmUp(ctx, s.Config.PoolWarmUp); err != nil {
+		s.logger().Warn("Failed to reopen pooled connections", logging.Err(err))
+	}
+}
@@ -0,0 +1,36 @@
+package server
+
+import "sort"
+
+// IsAvailable reports whether the server is expected to answer requests: it
+// is connected or waiting to connect on first use, and not failing health checks
+func (s *ManagedServer) IsAvailable() bool {
+	switch s.State() {
+	case "connected", "idle":
+		return s.Health().Status != HealthUnhealthy
+	default:
+		return false
+	}
+}
+
+// sortByPreference orders servers so that routing picks the first: available
+// servers before unavailable ones, then by descending priority, then by name.
+// Traffic fails over to the next server as soon as a preferred one becomes
+// unavailable, and returns once it recovers.
+func sortByPreference(servers []*ManagedServer) {
+	available := make(map[*ManagedServer]bool, len(servers))
+	for _, server := range servers {
+		available[server] = server.IsAvailable()
+	}
+
+	sort.SliceStable(servers, func(i, j int) bool {
+		a, b := servers[i], servers[j]
+		if available[a] != available[b] {
+			return available[a]
+		}
+		if a.Config.Priority != b.Config.Priority {
+			return a.Config.Priority > b.Config.Priority
+		}
+		return a.Name < b.Name
+	})
+}
@@ -0,0 +1,188 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/j4ng5y/mcpgate/logging"
+)
+
+// Quarantine defaults used when the gateway config leaves them unset
+const (
+	DefaultFailureBudget = 5
+	DefaultRetryInterval = 5 * time.Minute
+)
+
+// quarantineState tracks consecutive failures and whether a server has been
+// taken out of rotation
+type quarantineState struct {
+	failureBudget       int // consecutive failures allowed; negative disables quarantine
+	retryInterval       time.Duration
+	consecutiveFailures int
+	quarantined         bool
+	retryAt             time.Time
+	onStateChange       func()
+}
+
+// SetQuarantinePolicy configures the failure budget and slow retry interval
+func (s *ManagedServer) SetQuarantinePolicy(failureBudget int, retryInterval time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.quarantine.failureBudget = failureBudget
+	s.quarantine.retryInterval = retryInterval
+}
+
+// SetStateChangeHandler sets a callback invoked when the server enters or leaves quarantine
+func (s *ManagedServer) SetStateChangeHandler(fn func()) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.quarantine.onStateChange = fn
+}
+
+// IsQuarantined returns whether the server is currently quarantined
+func (s *ManagedServer) IsQuarantined() bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.quarantine.quarantined
+}
+
+// ConsecutiveFailures returns the number of failures since the last success
+func (s *ManagedServer) ConsecutiveFailures() int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.quarantine.consecutiveFailures
+}
+
+// QuarantineRetryAt returns when a quarantined server will next be retried
+func (s *ManagedServer) QuarantineRetryAt() time.Time {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.quarantine.retryAt
+}
+
+// State returns a short description of the server's state
+func (s *ManagedServer) State() string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	switch {
+	case s.disabled:
+		return "disabled"
+	case s.quarantine.quarantined:
+		return "quarantined"
+	case s.schedule.off:
+		return StateOffSchedule
+	case s.reconnect.active:
+		return StatusReconnecting
+	case s.connected && s.initialized:
+		return "connected"
+	case s.idleDisconnected:
+		return "idle"
+	case s.Config.Lazy && s.lastError == nil:
+		return "idle"
+	default:
+		return "disconnected"
+	}
+}
+
+// recordFailureLocked counts a failure and quarantines the server once the
+// budget is exhausted. It must be called with s.mutex held and reports
+// whether the server was newly quarantined.
+func (s *ManagedServer) recordFailureLocked() bool {
+	s.quarantine.consecutiveFailures++
+
+	if s.quarantine.quarantined {
+		s.quarantine.retryAt = time.Now().Add(s.retryIntervalLocked())
+		return false
+	}
+
+	budget := s.quarantine.failureBudget
+	if budget == 0 {
+		budget = DefaultFailureBudget
+	}
+	if budget < 0 || s.quarantine.consecutiveFailures < budget {
+		return false
+	}
+
+	s.quarantine.quarantined = true
+	s.quarantine.retryAt = time.Now().Add(s.retryIntervalLocked())
+	s.logger().Warn("Server quarantined after consecutive failures",
+		"failures", s.quarantine.consecutiveFailures, "retry_at", s.quarantine.retryAt.Format(time.RFC3339))
+	return true
+}
+
+// recordSuccessLocked resets the failure count. It must be called with s.mutex held.
+func (s *ManagedServer) recordSuccessLocked() {
+	s.quarantine.consecutiveFailures = 0
+}
+
+// retryIntervalLocked returns the configured retry interval or the default
+func (s *ManagedServer) retryIntervalLocked() time.Duration {
+	if s.quarantine.retryInterval > 0 {
+		return s.quarantine.retryInterval
+	}
+	return DefaultRetryInterval
+}
+
+// release takes the server out of quarantine
+func (s *ManagedServer) release() {
+	s.mutex.Lock()
+	s.quarantine.quarantined = false
+	s.quarantine.consecutiveFailures = 0
+	s.quarantine.retryAt = time.Time{}
+	s.mutex.Unlock()
+
+	s.logger().Info("Server released from quarantine")
+	s.stateChanged()
+}
+
+// stateChanged invokes the state change callback, if any
+func (s *ManagedServer) stateChanged() {
+	s.mutex.RLock()
+	fn := s.quarantine.onStateChange
+	s.mutex.RUnlock()
+
+	if fn != nil {
+		fn()
+	}
+}
+
+// quarantineLoop periodically retries quarantined servers until the manager stops
+func (m *Manager) quarantineLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.retryQuarantined(time.Now())
+		case <-m.done:
+			return
+		}
+	}
+}
+
+// retryQuarantined attempts to reconnect quarantined servers whose retry time has passed
+func (m *Manager) retryQuarantined(now time.Time) {
+	for _, server := range m.ListServers() {
+		if !server.IsQuarantined() || server.IsDisabled() || server.OffSchedule() || now.Before(server.QuarantineRetryAt()) {
+			continue
+		}
+
+		server.logger().Info("Retrying quarantined server")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		if err := server.Disconnect(ctx); err != nil {
+			server.logger().Warn("Error disconnecting server", logging.Err(err))
+		}
+		err := server.Connect(ctx)
+		cancel()
+
+		if err != nil {
+			server.logger().Warn("Quarantined server still failing", logging.Err(err))
+			continue
+		}
+
+		server.release()
+	}
+}
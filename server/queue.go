@@ -0,0 +1,108 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/j4ng5y/mcpgate/config"
+)
+
+// Request queue defaults used when a server with max_concurrent leaves them unset
+const (
+	DefaultQueueDepth   = 100
+	DefaultQueueTimeout = 30 * time.Second
+)
+
+// Errors returned when a request cannot be sent to a server at its concurrency limit
+var (
+	ErrQueueFull    = errors.New("request queue full")
+	ErrQueueTimeout = errors.New("timed out waiting in request queue")
+)
+
+// queueState limits how many requests are sent to a server at once. Requests
+// beyond the limit wait in a queue of bounded depth rather than piling up on
+// the upstream.
+type queueState struct {
+	slots   chan struct{} // Holds a token per request sent upstream; nil when unlimited
+	depth   int
+	timeout time.Duration
+	waiting int
+}
+
+// newQueueState sizes the request queue from a server's config
+func newQueueState(cfg config.ServerConfig) queueState {
+	if cfg.MaxConcurrent <= 0 {
+		return queueState{}
+	}
+
+	// A negative depth disables queueing, so requests at the limit fail at once
+	depth := cfg.QueueDepth
+	switch {
+	case depth == 0:
+		depth = DefaultQueueDepth
+	case depth < 0:
+		depth = 0
+	}
+	timeout := DefaultQueueTimeout
+	if cfg.QueueTimeout > 0 {
+		timeout = time.Duration(cfg.QueueTimeout) * time.Second
+	}
+
+	return queueState{
+		slots:   make(chan struct{}, cfg.MaxConcurrent),
+		depth:   depth,
+		timeout: timeout,
+	}
+}
+
+// QueueLength returns the number of requests waiting for the server to have
+// room under its concurrency limit
+func (s *ManagedServer) QueueLength() int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.queue.waiting
+}
+
+// acquireSlot waits for room under the server's concurrency limit and returns
+// a function that gives the room back. It fails with ErrQueueFull when the
+// queue is at its depth and with ErrQueueTimeout when no room frees up in time.
+func (s *ManagedServer) acquireSlot(ctx context.Context) (func(), error) {
+	slots := s.queue.slots
+	if slots == nil {
+		return func() {}, nil
+	}
+	release := func() { <-slots }
+
+	select {
+	case slots <- struct{}{}:
+		return release, nil
+	default:
+	}
+
+	s.mutex.Lock()
+	if s.queue.waiting >= s.queue.depth {
+		s.mutex.Unlock()
+		return nil, ErrQueueFull
+	}
+	s.queue.waiting++
+	s.mutex.Unlock()
+
+	defer func() {
+		s.mutex.Lock()
+		s.queue.waiting--
+		s.mutex.Unlock()
+	}()
+
+	timer := time.NewTimer(s.queue.timeout)
+	defer timer.Stop()
+
+	select {
+	case slots <- struct{}{}:
+		return release, nil
+	case <-timer.C:
+		return nil, ErrQueueTimeout
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,206 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/j4ng5y/mcpgate/logging"
+)
+
+// Reconnect defaults used when the server config leaves them unset
+const (
+	DefaultReconnectRetries = 10
+	reconnectInitialBackoff = time.Second
+	reconnectMaxBackoff     = time.Minute
+)
+
+// Connection status values reported through StatusEvent
+const (
+	StatusDisconnected    = "disconnected"
+	StatusReconnecting    = "reconnecting"
+	StatusReconnected     = "reconnected"
+	StatusReconnectFailed = "reconnect_failed"
+)
+
+// StatusEvent reports a change in a server's connection status
+type StatusEvent struct {
+	Server  string
+	Status  string
+	Attempt int   // Reconnect attempt, starting at 1
+	Err     error // Cause of a disconnect or failed reconnect
+}
+
+// StatusHandler receives connection status events
+type StatusHandler func(event StatusEvent)
+
+// reconnectState tracks an in-progress automatic reconnect
+type reconnectState struct {
+	active   bool
+	stop     chan struct{}
+	onStatus StatusHandler
+	restarts int       // Restarts in a row, reset once the server stays up
+	upSince  time.Time // When the server last connected
+}
+
+// SetStatusHandler sets the handler for connection status events from this server
+func (s *ManagedServer) SetStatusHandler(handler StatusHandler) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.reconnect.onStatus = handler
+}
+
+// IsReconnecting returns whether an automatic reconnect is in progress
+func (s *ManagedServer) IsReconnecting() bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.reconnect.active
+}
+
+// handleConnectionLost is called by the transport when the upstream goes away.
+// A standby takes over if there is one; otherwise, when the restart policy
+// allows it, a background reconnect loop restarts it.
+func (s *ManagedServer) handleConnectionLost(err error) {
+	s.mutex.Lock()
+	wasConnected := s.connected
+	if wasConnected {
+		s.recordDisconnectedLocked(err)
+	}
+	s.connected = false
+	s.initialized = false
+	s.recordErrorLocked(err)
+
+	if lost := s.Transport; wasConnected && s.failOverLocked() {
+		generations := s.resetCatalogLocked()
+		s.mutex.Unlock()
+		s.finishFailOver(lost, err, generations)
+		return
+	}
+
+	var stop chan struct{}
+	start, exhausted := false, false
+	if !s.reconnect.active {
+		start, exhausted = s.claimRestartLocked(err)
+	}
+	restarts := s.reconnect.restarts
+	if start {
+		stop = make(chan struct{})
+		s.reconnect.active = true
+		s.reconnect.stop = stop
+	}
+	s.mutex.Unlock()
+
+	s.logger().Warn("Lost connection to server", logging.Err(err))
+	if wasConnected {
+		s.publish(Event{Type: EventDisconnected, Err: err})
+	}
+	s.emitStatus(StatusEvent{Status: StatusDisconnected, Err: err})
+
+	if exhausted {
+		s.logger().Error("Server restarted too many times in a row; not restarting it again", "restarts", restarts)
+		s.emitStatus(StatusEvent{Status: StatusReconnectFailed, Attempt: restarts, Err: err})
+	}
+	if start {
+		go s.reconnectLoop(stop, restarts)
+	}
+}
+
+// reconnectLoop retries Connect with jittered exponential backoff until it
+// succeeds, the retry budget is spent, the server is quarantined or stop is
+// closed. The backoff keeps growing across restarts in a row, so a server
+// that crashes straight after starting is not restarted in a tight loop.
+func (s *ManagedServer) reconnectLoop(stop chan struct{}, restarts int) {
+	defer func() {
+		s.mutex.Lock()
+		if s.reconnect.stop == stop {
+			s.reconnect.active = false
+			s.reconnect.stop = nil
+		}
+		s.mutex.Unlock()
+	}()
+
+	maxRetries := s.Config.ReconnectMaxRetries
+	if maxRetries == 0 {
+		maxRetries = DefaultReconnectRetries
+	}
+
+	var lastErr error
+	for attempt := 1; maxRetries < 0 || attempt <= maxRetries; attempt++ {
+		s.emitStatus(StatusEvent{Status: StatusReconnecting, Attempt: attempt, Err: lastErr})
+
+		select {
+		case <-time.After(reconnectBackoff(restarts + attempt - 1)):
+		case <-stop:
+			return
+		}
+
+		if s.IsQuarantined() {
+			s.logger().Info("Server quarantined; leaving reconnects to the quarantine retry")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		lastErr = s.Connect(ctx)
+		cancel()
+
+		if lastErr == nil {
+			s.logger().Info("Reconnected to server", "attempts", attempt)
+			s.publish(Event{Type: EventRestarted})
+			s.emitStatus(StatusEvent{Status: StatusReconnected, Attempt: attempt})
+			return
+		}
+		s.logger().Warn("Reconnect attempt failed", "attempt", attempt, logging.Err(lastErr))
+	}
+
+	s.logger().Error("Giving up reconnecting to server", "attempts", maxRetries)
+	s.emitStatus(StatusEvent{Status: StatusReconnectFailed, Attempt: maxRetries, Err: lastErr})
+}
+
+// stopReconnectLocked cancels an in-progress reconnect loop. It must be called with s.mutex held.
+func (s *ManagedServer) stopReconnectLocked() {
+	if s.reconnect.stop != nil {
+		close(s.reconnect.stop)
+		s.reconnect.stop = nil
+		s.reconnect.active = false
+	}
+}
+
+// emitStatus delivers a status event to the status handler, if any
+func (s *ManagedServer) emitStatus(event StatusEvent) {
+	s.mutex.RLock()
+	handler := s.reconnect.onStatus
+	s.mutex.RUnlock()
+
+	event.Server = s.Name
+	if handler != nil {
+		handler(event)
+	}
+}
+
+// reconnectBackoff returns the jittered delay before a reconnect attempt
+func reconnectBackoff(attempt int) time.Duration {
+	return jitteredBackoff(reconnectInitialBackoff, reconnectMaxBackoff, attempt)
+}
+
+// OnStatus registers a handler for connection status events from any server
+func (m *Manager) OnStatus(handler StatusHandler) {
+	m.listenerMutex.Lock()
+	defer m.listenerMutex.Unlock()
+	m.statusHandlers = append(m.statusHandlers, handler)
+}
+
+// handleStatus fans a status event out to registered handlers and signals a
+// catalog change when a server drops out or comes back
+func (m *Manager) handleStatus(event StatusEvent) {
+	m.listenerMutex.RLock()
+	handlers := make([]StatusHandler, len(m.statusHandlers))
+	copy(handlers, m.statusHandlers)
+	m.listenerMutex.RUnlock()
+
+	for _, handler := range handlers {
+		handler(event)
+	}
+
+	if event.Status == StatusDisconnected || event.Status == StatusReconnected {
+		m.notifyChange()
+	}
+}
@@ -2,6 +2,7 @@ package server
 
 import (
 	"fmt"
+	"sort"
 	"sync"
 )
 
@@ -84,3 +85,36 @@ func (r *Registry) ListByCapability(capability string) []*ManagedServer {
 
 	return result
 }
+
+// ListByTag returns servers carrying a specific tag
+func (r *Registry) ListByTag(tag string) []*ManagedServer {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	var result []*ManagedServer
+	for _, server := range r.servers {
+		if server.HasTag(tag) {
+			result = append(result, server)
+		}
+	}
+
+	return result
+}
+
+// ListByGroup returns the servers in a replica group, ordered by name
+func (r *Registry) ListByGroup(group string) []*ManagedServer {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	var result []*ManagedServer
+	for _, server := range r.servers {
+		if server.Config.Group == group {
+			result = append(result, server)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	return result
+}
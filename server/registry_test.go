@@ -15,7 +15,7 @@ func TestRegistry_Register(t *testing.T) {
 			Name:      "test-server",
 			Transport: "stdio",
 		},
-		Capabilities: []string{"tools"},
+		capabilities: []string{"tools"},
 	}
 
 	err := registry.Register(server)
@@ -176,17 +176,17 @@ func TestRegistry_ListByCapability(t *testing.T) {
 
 	server1 := &ManagedServer{
 		Name:         "server1",
-		Capabilities: []string{"tools", "resources"},
+		capabilities: []string{"tools", "resources"},
 	}
 
 	server2 := &ManagedServer{
 		Name:         "server2",
-		Capabilities: []string{"tools"},
+		capabilities: []string{"tools"},
 	}
 
 	server3 := &ManagedServer{
 		Name:         "server3",
-		Capabilities: []string{"prompts"},
+		capabilities: []string{"prompts"},
 	}
 
 	if err := registry.Register(server1); err != nil {
@@ -266,3 +266,28 @@ func TestRegistry_Concurrency(t *testing.T) {
 		t.Errorf("Expected 10 servers after concurrent registration, got %d", len(list))
 	}
 }
+
+func TestRegistry_ListByTag(t *testing.T) {
+	registry := NewRegistry()
+
+	servers := []*ManagedServer{
+		{Name: "github", Config: config.ServerConfig{Name: "github", Tags: []string{"github", "prod"}}},
+		{Name: "staging", Config: config.ServerConfig{Name: "staging", Tags: []string{"github"}}},
+		{Name: "untagged", Config: config.ServerConfig{Name: "untagged"}},
+	}
+	for _, server := range servers {
+		if err := registry.Register(server); err != nil {
+			t.Fatalf("Failed to register server: %v", err)
+		}
+	}
+
+	if tagged := registry.ListByTag("github"); len(tagged) != 2 {
+		t.Errorf("Expected 2 servers tagged github, got %d", len(tagged))
+	}
+	if tagged := registry.ListByTag("prod"); len(tagged) != 1 || tagged[0].Name != "github" {
+		t.Errorf("Expected only github tagged prod, got %v", tagged)
+	}
+	if tagged := registry.ListByTag("missing"); len(tagged) != 0 {
+		t.Errorf("Expected no servers for an unknown tag, got %d", len(tagged))
+	}
+}
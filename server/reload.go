@@ -0,0 +1,85 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"time"
+
+	"github.com/j4ng5y/mcpgate/config"
+	"github.com/j4ng5y/mcpgate/logging"
+)
+
+// Reload applies a new configuration to a running manager. Servers no longer
+// enabled in cfg are disconnected and removed, new ones are added and
+// connected, and servers whose configuration changed are replaced by a fresh
+// connection. Unchanged servers keep their connection, so clients routed to
+// them notice nothing. Gateway-wide settings only apply to servers added
+// from now on.
+func (m *Manager) Reload(cfg *config.Config) error {
+	// Deferred first so listeners run after the lock is released
+	defer m.notifyChange()
+
+	wanted := make(map[string]config.ServerConfig, len(cfg.Servers))
+	for _, serverCfg := range cfg.Servers {
+		if serverCfg.Enabled {
+			wanted[serverCfg.Name] = serverCfg
+		}
+	}
+
+	m.mutex.Lock()
+	m.config = cfg
+
+	var removed []*ManagedServer
+	for name, server := range m.servers {
+		if serverCfg, ok := wanted[name]; ok && reflect.DeepEqual(serverCfg, server.Config) {
+			continue
+		}
+		if err := m.registry.Unregister(name); err != nil {
+			slog.Warn("Error unregistering server", logging.Server(name), logging.Err(err))
+		}
+		delete(m.servers, name)
+		removed = append(removed, server)
+	}
+
+	var added []*ManagedServer
+	var errs []error
+	for _, serverCfg := range cfg.Servers {
+		if _, exists := m.servers[serverCfg.Name]; exists || !serverCfg.Enabled {
+			continue
+		}
+		server, err := m.addServerLocked(serverCfg)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("server %s: %w", serverCfg.Name, err))
+			continue
+		}
+		added = append(added, server)
+	}
+	m.mutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	for _, server := range removed {
+		server.logger().Info("Removing server")
+		if err := server.Drain(ctx); err != nil {
+			server.logger().Warn("Server still had requests in flight after draining", logging.Err(err))
+		}
+		if err := server.Disconnect(ctx); err != nil {
+			server.logger().Warn("Error disconnecting server", logging.Err(err))
+		}
+	}
+	for _, server := range added {
+		if server.Config.Lazy || server.OffSchedule() {
+			continue
+		}
+		if err := m.connectWithRetry(ctx, server); err != nil {
+			server.logger().Error("Failed to connect server after retries", logging.Err(err))
+		}
+	}
+
+	slog.Info("Configuration reloaded", "removed", len(removed), "added", len(added))
+	return errors.Join(errs...)
+}
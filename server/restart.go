@@ -0,0 +1,84 @@
+package server
+
+import (
+	"errors"
+	"time"
+
+	"github.com/j4ng5y/mcpgate/config"
+	"github.com/j4ng5y/mcpgate/transport"
+)
+
+// Restart defaults used when the server config leaves them unset
+const (
+	DefaultMaxRestarts = 5
+	// restartResetAfter is how long a server must stay up before its
+	// restarts no longer count towards max_restarts
+	restartResetAfter = time.Minute
+)
+
+// restartPolicy returns the server's restart policy. Without one,
+// auto_reconnect keeps its original meaning of always reconnecting.
+func (s *ManagedServer) restartPolicy() string {
+	switch {
+	case s.Config.Restart != "":
+		return s.Config.Restart
+	case s.Config.AutoReconnect:
+		return config.RestartAlways
+	default:
+		return config.RestartNever
+	}
+}
+
+// maxRestarts returns the restarts allowed in a row; negative is unlimited
+func (s *ManagedServer) maxRestarts() int {
+	switch {
+	case s.Config.MaxRestarts != 0:
+		return s.Config.MaxRestarts
+	case s.Config.Restart == "":
+		// auto_reconnect on its own has never limited restarts
+		return -1
+	default:
+		return DefaultMaxRestarts
+	}
+}
+
+// shouldRestart reports whether policy restarts a server that dropped with
+// err. A subprocess exiting with code 0 is a clean exit, not a failure.
+func shouldRestart(policy string, err error) bool {
+	switch policy {
+	case config.RestartAlways:
+		return true
+	case config.RestartOnFailure:
+		var exitErr *transport.ExitError
+		return !errors.As(err, &exitErr) || exitErr.ExitCode != 0
+	default:
+		return false
+	}
+}
+
+// Restarts returns how many times the server has been restarted in a row
+func (s *ManagedServer) Restarts() int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.reconnect.restarts
+}
+
+// claimRestartLocked counts a restart of a server that dropped with err and
+// reports whether the policy allows it, and whether it was refused because
+// max_restarts was reached. It must be called with s.mutex held.
+func (s *ManagedServer) claimRestartLocked(err error) (restart, exhausted bool) {
+	if s.disabled || !shouldRestart(s.restartPolicy(), err) {
+		return false, false
+	}
+
+	if !s.reconnect.upSince.IsZero() && time.Since(s.reconnect.upSince) >= restartResetAfter {
+		s.reconnect.restarts = 0
+	}
+	if limit := s.maxRestarts(); limit >= 0 && s.reconnect.restarts >= limit {
+		return false, true
+	}
+
+	s.reconnect.restarts++
+	s.history.totalRestarts++
+	return true, false
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"math/rand/v2"
+	"time"
+
+	"github.com/j4ng5y/mcpgate/config"
+)
+
+// Connect retry defaults used when neither the server nor the gateway config
+// sets them
+const (
+	DefaultConnectRetries    = 2
+	DefaultConnectBackoff    = time.Second
+	DefaultConnectBackoffMax = 30 * time.Second
+)
+
+// retryPolicy is how connecting to a server is retried
+type retryPolicy struct {
+	maxRetries int // retries after the first attempt
+	backoff    time.Duration
+	backoffMax time.Duration
+}
+
+// connectRetryPolicy resolves the retry policy of a server from its own
+// [server.retry] keys, then [gateway.retry], then the package defaults
+func (m *Manager) connectRetryPolicy(cfg config.ServerConfig) retryPolicy {
+	gateway := m.config.Gateway.Retry
+	policy := retryPolicy{
+		maxRetries: firstNonZero(cfg.Retry.MaxRetries, gateway.MaxRetries, DefaultConnectRetries),
+		backoff:    firstNonZeroSeconds(cfg.Retry.Backoff, gateway.Backoff, DefaultConnectBackoff),
+		backoffMax: firstNonZeroSeconds(cfg.Retry.BackoffMax, gateway.BackoffMax, DefaultConnectBackoffMax),
+	}
+	if policy.maxRetries < 0 {
+		policy.maxRetries = 0
+	}
+	return policy
+}
+
+// delay returns the wait before the given retry, starting at 1
+func (p retryPolicy) delay(retry int) time.Duration {
+	return jitteredBackoff(p.backoff, p.backoffMax, retry)
+}
+
+// jitteredBackoff returns the delay before an attempt: exponential growth from
+// initial capped at max, with "equal jitter" so servers that failed together
+// do not retry in lockstep
+func jitteredBackoff(initial, max time.Duration, attempt int) time.Duration {
+	backoff := initial
+	for i := 1; i < attempt && backoff < max; i++ {
+		backoff *= 2
+	}
+	if backoff > max {
+		backoff = max
+	}
+
+	half := backoff / 2
+	return half + rand.N(half+1)
+}
+
+// firstNonZero returns the first of values that is not zero
+func firstNonZero(values ...int) int {
+	for _, value := range values {
+		if value != 0 {
+			return value
+		}
+	}
+	return 0
+}
+
+// firstNonZeroSeconds returns the first positive number of seconds, or fallback
+func firstNonZeroSeconds(server, gateway int, fallback time.Duration) time.Duration {
+	if seconds := firstNonZero(max(server, 0), max(gateway, 0)); seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return fallback
+}
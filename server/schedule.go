@@ -0,0 +1,109 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/j4ng5y/mcpgate/config"
+	"github.com/j4ng5y/mcpgate/logging"
+)
+
+// scheduleCheckInterval is how often the manager applies server schedules
+const scheduleCheckInterval = 30 * time.Second
+
+// StateOffSchedule is the state of a server outside its schedule
+const StateOffSchedule = "off_schedule"
+
+// scheduleState tracks whether a server with a schedule is inside it
+type scheduleState struct {
+	schedule *config.Schedule // nil for servers that are always available
+	off      bool
+}
+
+// newScheduleState parses a server's schedule and places it as of now
+func newScheduleState(cfg config.ServerConfig, now time.Time) (scheduleState, error) {
+	if cfg.Schedule == "" {
+		return scheduleState{}, nil
+	}
+	schedule, err := config.ParseSchedule(cfg.Schedule)
+	if err != nil {
+		return scheduleState{}, err
+	}
+	return scheduleState{schedule: schedule, off: !schedule.Active(now)}, nil
+}
+
+// OffSchedule returns whether the server is outside its schedule, and so
+// neither connected nor routable
+func (s *ManagedServer) OffSchedule() bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.schedule.off
+}
+
+// updateSchedule moves the server in or out of its schedule as of now and
+// reports whether its window started or ended
+func (s *ManagedServer) updateSchedule(now time.Time) (started, ended bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.schedule.schedule == nil {
+		return false, false
+	}
+	off := !s.schedule.schedule.Active(now)
+	if off == s.schedule.off {
+		return false, false
+	}
+	s.schedule.off = off
+	return !off, off
+}
+
+// scheduleLoop periodically applies server schedules until the manager stops
+func (m *Manager) scheduleLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			m.applySchedules(now)
+		case <-m.done:
+			return
+		}
+	}
+}
+
+// applySchedules disconnects servers whose window ended and connects those
+// whose window started, unless they connect on first use
+func (m *Manager) applySchedules(now time.Time) {
+	changed := false
+	for _, server := range m.ListServers() {
+		started, ended := server.updateSchedule(now)
+		switch {
+		case ended:
+			server.logger().Info("Server is outside its schedule; disconnecting")
+			ctx, cancel := context.WithTimeout(context.Background(), DefaultShutdownTimeout)
+			if err := server.Disconnect(ctx); err != nil {
+				server.logger().Warn("Error disconnecting server", logging.Err(err))
+			}
+			cancel()
+			changed = true
+		case started:
+			server.logger().Info("Server is within its schedule")
+			changed = true
+			if server.Config.Lazy {
+				continue
+			}
+			go func(server *ManagedServer) {
+				ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+				defer cancel()
+				if err := m.connectWithRetry(ctx, server); err != nil {
+					server.logger().Error("Failed to connect server after retries", logging.Err(err))
+				}
+				m.notifyChange()
+			}(server)
+		}
+	}
+	if changed {
+		m.notifyChange()
+	}
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DefaultShutdownTimeout bounds Stop, covering shutdown hooks and server disconnects
+const DefaultShutdownTimeout = 10 * time.Second
+
+// ShutdownHook lets an embedding application flush its own state (metrics,
+// sessions) during graceful shutdown. ctx carries the shutdown deadline.
+type ShutdownHook func(ctx context.Context) error
+
+// shutdownHook is a registered hook with the name used in logs and errors
+type shutdownHook struct {
+	name string
+	fn   ShutdownHook
+}
+
+// RegisterShutdownHook registers a hook run by Shutdown before upstream servers
+// are disconnected. Hooks run in reverse registration order.
+func (m *Manager) RegisterShutdownHook(name string, hook ShutdownHook) {
+	m.listenerMutex.Lock()
+	defer m.listenerMutex.Unlock()
+	m.shutdownHooks = append(m.shutdownHooks, shutdownHook{name: name, fn: hook})
+}
+
+// Shutdown runs the registered shutdown hooks in reverse registration order,
+// then disconnects all servers. Every hook shares ctx's deadline; once it has
+// passed the remaining hooks are skipped. Hooks run at most once.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	err := m.runShutdownHooks(ctx)
+	m.stopServers(ctx)
+	return err
+}
+
+// runShutdownHooks invokes each hook once, newest first, and joins their errors
+func (m *Manager) runShutdownHooks(ctx context.Context) error {
+	m.listenerMutex.Lock()
+	hooks := m.shutdownHooks
+	m.shutdownHooks = nil
+	m.listenerMutex.Unlock()
+
+	var errs []error
+	for i := len(hooks) - 1; i >= 0; i-- {
+		hook := hooks[i]
+		if ctx.Err() != nil {
+			errs = append(errs, fmt.Errorf("shutdown hook %s skipped: %w", hook.name, ctx.Err()))
+			continue
+		}
+		if err := hook.fn(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("shutdown hook %s: %w", hook.name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
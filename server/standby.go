@@ -0,0 +1,199 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"sync/atomic"
+	"time"
+
+	"github.com/j4ng5y/mcpgate/logging"
+	"github.com/j4ng5y/mcpgate/transport"
+)
+
+// standbyConnectTimeout bounds connecting and initializing a spare
+const standbyConnectTimeout = 30 * time.Second
+
+// standbyConn is a spare connection, initialized and waiting to take over
+type standbyConn struct {
+	transport transport.Transport
+	result    map[string]interface{} // Its initialize result
+	promoted  atomic.Bool            // Set once it is the server's connection
+}
+
+// standbyState tracks a server's spare connections
+type standbyState struct {
+	spares     []*standbyConn
+	filling    int // Spares being connected
+	generation int // Bumped when the spares are discarded
+	failures   int // Spares that failed to connect or were lost, in a row
+}
+
+// StandbyReady returns how many spares are connected and ready to take over
+func (s *ManagedServer) StandbyReady() int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return len(s.standby.spares)
+}
+
+// fillStandby connects spares until the server has as many as configured. A
+// spare that cannot connect is retried with backoff.
+func (s *ManagedServer) fillStandby() {
+	for {
+		s.mutex.Lock()
+		if !s.connected || s.disabled || len(s.standby.spares)+s.standby.filling >= s.Config.Standby {
+			s.mutex.Unlock()
+			return
+		}
+		s.standby.filling++
+		generation := s.standby.generation
+		params := s.initializeParams()
+		s.mutex.Unlock()
+
+		spare, err := s.connectStandby(params)
+
+		s.mutex.Lock()
+		s.standby.filling--
+		keep := err == nil && s.connected && generation == s.standby.generation
+		if keep {
+			s.standby.spares = append(s.standby.spares, spare)
+		}
+		s.mutex.Unlock()
+
+		if err != nil {
+			s.logger().Warn("Failed to connect a standby", logging.Err(err))
+			s.retryStandby()
+			return
+		}
+		if !keep {
+			ctx, cancel := context.WithTimeout(context.Background(), DefaultShutdownTimeout)
+			_ = spare.transport.Disconnect(ctx)
+			cancel()
+			return
+		}
+	}
+}
+
+// connectStandby starts a spare connection and initializes it. Until it is
+// promoted, its notifications are dropped and losing it only costs a spare.
+func (s *ManagedServer) connectStandby(params map[string]interface{}) (*standbyConn, error) {
+	t, err := newTransport(s.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	spare := &standbyConn{transport: t}
+	if source, ok := t.(transport.NotificationSource); ok {
+		source.SetNotificationHandler(func(notification json.RawMessage) {
+			if spare.promoted.Load() {
+				s.handleNotification(notification)
+			}
+		})
+	}
+	if source, ok := t.(transport.DisconnectSource); ok {
+		source.SetDisconnectHandler(func(err error) {
+			if spare.promoted.Load() {
+				s.handleConnectionLost(err)
+			} else {
+				s.standbyLost(spare, err)
+			}
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), standbyConnectTimeout)
+	defer cancel()
+
+	if err := t.Connect(ctx); err != nil {
+		return nil, err
+	}
+	result, err := s.handshake(ctx, t, params)
+	if err != nil {
+		_ = t.Disconnect(ctx)
+		return nil, err
+	}
+	spare.result = result
+	return spare, nil
+}
+
+// standbyLost drops a spare whose connection went away and replaces it
+func (s *ManagedServer) standbyLost(spare *standbyConn, err error) {
+	s.mutex.Lock()
+	for i, candidate := range s.standby.spares {
+		if candidate == spare {
+			s.standby.spares = append(s.standby.spares[:i], s.standby.spares[i+1:]...)
+			break
+		}
+	}
+	s.mutex.Unlock()
+
+	s.logger().Warn("Lost a standby", logging.Err(err))
+	s.retryStandby()
+}
+
+// retryStandby fills the spares again after a backoff that grows while they
+// keep failing
+func (s *ManagedServer) retryStandby() {
+	s.mutex.Lock()
+	s.standby.failures++
+	delay := reconnectBackoff(s.standby.failures - 1)
+	s.mutex.Unlock()
+
+	time.AfterFunc(delay, s.fillStandby)
+}
+
+// failOverLocked makes a spare the server's connection in place of the one
+// just lost, and reports whether there was one. It must be called with
+// s.mutex held.
+func (s *ManagedServer) failOverLocked() bool {
+	if s.disabled || len(s.standby.spares) == 0 {
+		return false
+	}
+
+	spare := s.standby.spares[0]
+	s.standby.spares = s.standby.spares[1:]
+	s.standby.failures = 0
+	spare.promoted.Store(true)
+
+	s.Transport = spare.transport
+	s.connected = true
+	s.lastUsed = time.Now()
+	s.applyInitializeLocked(spare.result)
+	s.recordConnectedLocked()
+	s.history.totalRestarts++
+	return true
+}
+
+// finishFailOver announces a fail over from the lost transport, then closes
+// it, refreshes the catalog and replaces the spare that took over
+func (s *ManagedServer) finishFailOver(lost transport.Transport, err error, generations map[string]int) {
+	s.logger().Warn("Lost connection to server; a standby took over", logging.Err(err))
+	s.publish(Event{Type: EventDisconnected, Err: err})
+	s.publish(Event{Type: EventConnected})
+	s.publish(Event{Type: EventRestarted})
+	s.emitStatus(StatusEvent{Status: StatusDisconnected, Err: err})
+	s.emitStatus(StatusEvent{Status: StatusReconnected, Attempt: 1})
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), DefaultShutdownTimeout)
+		_ = lost.Disconnect(ctx)
+		cancel()
+
+		ctx, cancel = context.WithTimeout(context.Background(), standbyConnectTimeout)
+		s.refreshCatalog(ctx, generations)
+		cancel()
+
+		s.fillStandby()
+	}()
+}
+
+// discardStandbyLocked disconnects every spare, including those still being
+// connected once they are. It must be called with s.mutex held.
+func (s *ManagedServer) discardStandbyLocked(ctx context.Context) {
+	spares := s.standby.spares
+	s.standby.spares = nil
+	s.standby.generation++
+	s.standby.failures = 0
+
+	for _, spare := range spares {
+		_ = spare.transport.Disconnect(ctx)
+	}
+}
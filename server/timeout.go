@@ -0,0 +1,136 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/j4ng5y/mcpgate/transport"
+)
+
+// ErrCodeRequestTimeout is the JSON-RPC error code returned when an upstream
+// server does not answer within its configured timeout
+const ErrCodeRequestTimeout = -32001
+
+// RequestTimeoutError reports a request that exceeded the server's timeout
+type RequestTimeoutError struct {
+	Server  string
+	Method  string
+	Timeout time.Duration
+}
+
+func (e *RequestTimeoutError) Error() string {
+	if e.Method == "" {
+		return fmt.Sprintf("server %s did not respond within %s", e.Server, e.Timeout)
+	}
+	return fmt.Sprintf("server %s did not respond to %s within %s", e.Server, e.Method, e.Timeout)
+}
+
+// Unwrap lets errors.Is match context.DeadlineExceeded
+func (e *RequestTimeoutError) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+// requestTimeout returns the per-request timeout from config; zero means none
+func (s *ManagedServer) requestTimeout() time.Duration {
+	if s.Config.Timeout <= 0 {
+		return 0
+	}
+	return time.Duration(s.Config.Timeout) * time.Second
+}
+
+// sendWithTimeout sends a request over t bounded by the server's timeout.
+// When that deadline, rather than ctx, ends the request the error is a
+// *RequestTimeoutError.
+func (s *ManagedServer) sendWithTimeout(ctx context.Context, t transport.Transport, request interface{}) (json.RawMessage, error) {
+	timeout := s.requestTimeout()
+	if timeout == 0 {
+		return t.SendRequest(ctx, request)
+	}
+
+	reqCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	resp, err := t.SendRequest(reqCtx, request)
+	if err != nil && ctx.Err() == nil && errors.Is(reqCtx.Err(), context.DeadlineExceeded) {
+		return nil, &RequestTimeoutError{
+			Server:  s.Name,
+			Method:  requestMethod(request),
+			Timeout: timeout,
+		}
+	}
+	return resp, err
+}
+
+// requestMethod extracts the JSON-RPC method of a request for error reporting
+// and tracing
+func requestMethod(request interface{}) string {
+	if msg, ok := request.(map[string]interface{}); ok {
+		method, _ := msg["method"].(string)
+		return method
+	}
+	data, err := json.Marshal(request)
+	if err != nil {
+		return ""
+	}
+	var probe struct {
+		Method string `json:"method"`
+	}
+	_ = json.Unmarshal(data, &probe)
+	return probe.Method
+}
+
+// requestID extracts the JSON-RPC id of a request, encoded as JSON, or "" for
+// a message without one
+func requestID(request interface{}) string {
+	var probe struct {
+		ID json.RawMessage `json:"id"`
+	}
+	if !decodeMessage(request, &probe) || string(probe.ID) == "null" {
+		return ""
+	}
+	return string(probe.ID)
+}
+
+// cancelledRequestID extracts the requestId of a notifications/cancelled
+// message, encoded as JSON like requestID
+func cancelledRequestID(notification interface{}) string {
+	var probe struct {
+		Params struct {
+			RequestID json.RawMessage `json:"requestId"`
+		} `json:"params"`
+	}
+	if !decodeMessage(notification, &probe) {
+		return ""
+	}
+	return string(probe.Params.RequestID)
+}
+
+// decodeMessage decodes a message of any type into probe by way of its JSON
+func decodeMessage(msg interface{}, probe interface{}) bool {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return false
+	}
+	return json.Unmarshal(data, probe) == nil
+}
+
+// timeoutErrorResponse builds the JSON-RPC error returned for a timed out request
+func timeoutErrorResponse(err *RequestTimeoutError) json.RawMessage {
+	errResp := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"error": map[string]interface{}{
+			"code":    ErrCodeRequestTimeout,
+			"message": err.Error(),
+			"data": map[string]interface{}{
+				"server":  err.Server,
+				"method":  err.Method,
+				"timeout": err.Timeout.Seconds(),
+			},
+		},
+	}
+	data, _ := json.Marshal(errResp)
+	return json.RawMessage(data)
+}
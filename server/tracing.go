@@ -0,0 +1,45 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/j4ng5y/mcpgate/tracing"
+)
+
+// startSpan begins the client span covering a request sent upstream. HTTP
+// transports pass its context on in the traceparent header.
+func (s *ManagedServer) startSpan(ctx context.Context, request interface{}) (context.Context, *tracing.Span) {
+	method := requestMethod(request)
+	ctx, span := tracing.Start(ctx, method, tracing.KindClient)
+	if span == nil {
+		return ctx, nil
+	}
+	span.SetAttribute("rpc.system", "jsonrpc")
+	span.SetAttribute("rpc.method", method)
+	span.SetAttribute("mcpgate.server", s.Name)
+	span.SetAttribute("mcpgate.transport", s.Config.Transport)
+	return ctx, span
+}
+
+// endSpan records whether the upstream failed the request and ends its span
+func endSpan(span *tracing.Span, resp json.RawMessage, err error, failed bool) {
+	if span == nil {
+		return
+	}
+	switch {
+	case err != nil:
+		span.SetError(err.Error())
+	case failed:
+		var probe struct {
+			Error struct {
+				Code    int    `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		_ = json.Unmarshal(resp, &probe)
+		span.SetAttribute("rpc.jsonrpc.error_code", probe.Error.Code)
+		span.SetError(probe.Error.Message)
+	}
+	span.End()
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// labelPrefix namespaces launchd labels
+const labelPrefix = "com.github.j4ng5y."
+
+// Launchd manages the service as a launchd job: a LaunchAgent for the
+// current user or a LaunchDaemon system-wide
+type Launchd struct {
+	spec    Spec
+	path    string
+	logPath string
+	domain  string // gui/<uid> or system
+	run     runner
+}
+
+// newLaunchd creates a launchd manager
+func newLaunchd(home string, spec Spec, run runner) *Launchd {
+	l := &Launchd{spec: spec, run: run}
+	if spec.System {
+		l.path = filepath.Join("/Library/LaunchDaemons", l.label()+".plist")
+		l.logPath = filepath.Join("/Library/Logs", spec.Name+".log")
+		l.domain = "system"
+	} else {
+		l.path = filepath.Join(home, "Library", "LaunchAgents", l.label()+".plist")
+		l.logPath = filepath.Join(home, "Library", "Logs", spec.Name+".log")
+		l.domain = "gui/" + strconv.Itoa(os.Getuid())
+	}
+	return l
+}
+
+// Kind returns the service manager
+func (l *Launchd) Kind() string {
+	if l.spec.System {
+		return "launchd daemon"
+	}
+	return "launchd agent"
+}
+
+// Path returns the job's property list
+func (l *Launchd) Path() string {
+	return l.path
+}
+
+// Render returns the job's property list. The job is restarted when it
+// fails, but not when it exits cleanly after launchctl stop.
+func (l *Launchd) Render() []byte {
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	b.WriteString(`<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">` + "\n")
+	b.WriteString(`<plist version="1.0">` + "\n<dict>\n")
+	plistString(&b, "Label", l.label())
+	b.WriteString("\t<key>ProgramArguments</key>\n\t<array>\n")
+	for _, arg := range l.spec.Args() {
+		fmt.Fprintf(&b, "\t\t<string>%s</string>\n", escapeXML(arg))
+	}
+	b.WriteString("\t</array>\n")
+	b.WriteString("\t<key>RunAtLoad</key>\n\t<true/>\n")
+	b.WriteString("\t<key>KeepAlive</key>\n\t<dict>\n\t\t<key>SuccessfulExit</key>\n\t\t<false/>\n\t</dict>\n")
+	plistString(&b, "StandardOutPath", l.logPath)
+	plistString(&b, "StandardErrorPath", l.logPath)
+	b.WriteString("</dict>\n</plist>\n")
+	return b.Bytes()
+}
+
+// Install writes the property list and loads the job, which starts it
+func (l *Launchd) Install() error {
+	// Reinstalling replaces a loaded job, which launchd would otherwise keep
+	if _, err := os.Stat(l.path); err == nil {
+		_ = l.run("launchctl", "bootout", l.target())
+	}
+	if err := writeDefinition(l.path, l.Render()); err != nil {
+		return err
+	}
+	return l.run("launchctl", "bootstrap", l.domain, l.path)
+}
+
+// Uninstall unloads the job, which stops it, and removes the property list
+func (l *Launchd) Uninstall() error {
+	if err := checkInstalled(l.path); err != nil {
+		return err
+	}
+	if err := l.run("launchctl", "bootout", l.target()); err != nil {
+		return err
+	}
+	if err := os.Remove(l.path); err != nil {
+		return fmt.Errorf("failed to remove %s: %w", l.path, err)
+	}
+	return nil
+}
+
+// Start starts the job, loading it first if it was unloaded
+func (l *Launchd) Start() error {
+	if err := checkInstalled(l.path); err != nil {
+		return err
+	}
+	if err := l.run("launchctl", "kickstart", l.target()); err != nil {
+		if bootErr := l.run("launchctl", "bootstrap", l.domain, l.path); bootErr != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stop asks the job to shut down gracefully. It exits cleanly, so KeepAlive
+// does not restart it.
+func (l *Launchd) Stop() error {
+	if err := checkInstalled(l.path); err != nil {
+		return err
+	}
+	return l.run("launchctl", "kill", "SIGTERM", l.target())
+}
+
+// label returns the job's label
+func (l *Launchd) label() string {
+	return labelPrefix + l.spec.Name
+}
+
+// target returns the job's service target for launchctl
+func (l *Launchd) target() string {
+	return l.domain + "/" + l.label()
+}
+
+// plistString writes a string entry of the property list's top-level dict
+func plistString(b *bytes.Buffer, key, value string) {
+	fmt.Fprintf(b, "\t<key>%s</key>\n\t<string>%s</string>\n", key, escapeXML(value))
+}
+
+// escapeXML escapes s for use as element text
+func escapeXML(s string) string {
+	var b bytes.Buffer
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,138 @@
+// Package service installs mcpgate as a background service serving HTTP,
+// as a systemd unit on Linux or a launchd job on macOS
+package service
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+var (
+	ErrNotInstalled = errors.New("service not installed")
+	ErrUnsupported  = errors.New("services are not supported on this platform")
+)
+
+// DefaultName is the service name used when none is given
+const DefaultName = "mcpgate"
+
+// DefaultAddress is the address the service serves HTTP on by default
+const DefaultAddress = "127.0.0.1:8080"
+
+// validName matches names usable as a systemd unit name and launchd label
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// Spec describes the gateway a service runs
+type Spec struct {
+	Name       string // Service name, so several gateways can be installed
+	System     bool   // Install system-wide instead of for the current user
+	Executable string // Absolute path to the mcpgate binary
+	ConfigPath string // Absolute path to the config file
+	Address    string // Address to serve Streamable HTTP on
+}
+
+// Args returns the command line the service runs the gateway with
+func (s Spec) Args() []string {
+	return []string{s.Executable, "server", "--config", s.ConfigPath, "--http", s.Address}
+}
+
+// Manager installs and controls the service on one service manager
+type Manager interface {
+	// Kind returns the service manager, e.g. "systemd user service"
+	Kind() string
+
+	// Path returns the unit or job file the service is defined in
+	Path() string
+
+	// Render returns the unit or job file for the spec
+	Render() []byte
+
+	// Install writes the service definition, then enables and starts it
+	Install() error
+
+	// Uninstall stops and disables the service and removes its definition
+	Uninstall() error
+
+	// Start starts the installed service
+	Start() error
+
+	// Stop stops the running service; it stays installed
+	Stop() error
+}
+
+// runner runs a service manager command
+type runner func(name string, args ...string) error
+
+// New returns the manager for the spec on this platform. Only Name and
+// System are needed to uninstall, start or stop a service.
+func New(spec Spec) (Manager, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find home directory: %w", err)
+	}
+	return newManager(runtime.GOOS, home, spec, run)
+}
+
+// newManager returns the manager for the spec on goos
+func newManager(goos, home string, spec Spec, run runner) (Manager, error) {
+	if spec.Name == "" {
+		spec.Name = DefaultName
+	}
+	if !validName.MatchString(spec.Name) {
+		return nil, fmt.Errorf("invalid service name %q (must be letters, digits, '.', '_' or '-')", spec.Name)
+	}
+
+	switch goos {
+	case "linux":
+		return newSystemd(home, spec, run), nil
+	case "darwin":
+		return newLaunchd(home, spec, run), nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnsupported, goos)
+}
+
+// run runs a command, including its output in the error when it fails
+func run(name string, args ...string) error {
+	output, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(output)); msg != "" {
+			return fmt.Errorf("%s %s: %w: %s", name, strings.Join(args, " "), err, msg)
+		}
+		return fmt.Errorf("%s %s: %w", name, strings.Join(args, " "), err)
+	}
+	return nil
+}
+
+// writeDefinition writes a unit or job file, replacing any earlier one
+func writeDefinition(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+
+	// Write then rename so the service manager never reads a partial file
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// checkInstalled returns ErrNotInstalled when path does not exist
+func checkInstalled(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%w: %s does not exist", ErrNotInstalled, path)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// recorder stands in for the service manager, recording its commands
+type recorder struct {
+	commands []string
+}
+
+func (r *recorder) run(name string, args ...string) error {
+	r.commands = append(r.commands, name+" "+strings.Join(args, " "))
+	return nil
+}
+
+func testSpec() Spec {
+	return Spec{
+		Executable: "/usr/local/bin/mcpgate",
+		ConfigPath: "/home/me/mcp gate/config.toml",
+		Address:    DefaultAddress,
+	}
+}
+
+func TestSystemd_Lifecycle(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", "")
+	rec := &recorder{}
+	mgr, err := newManager("linux", home, testSpec(), rec.run)
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+
+	want := filepath.Join(home, ".config", "systemd", "user", "mcpgate.service")
+	if mgr.Path() != want {
+		t.Errorf("Expected unit at %s, got %s", want, mgr.Path())
+	}
+	if err := mgr.Start(); !errors.Is(err, ErrNotInstalled) {
+		t.Errorf("Expected ErrNotInstalled before install, got %v", err)
+	}
+
+	if err := mgr.Install(); err != nil {
+		t.Fatalf("Failed to install: %v", err)
+	}
+	unit, err := os.ReadFile(want)
+	if err != nil {
+		t.Fatalf("Failed to read unit: %v", err)
+	}
+	for _, line := range []string{
+		`ExecStart=/usr/local/bin/mcpgate server --config "/home/me/mcp gate/config.toml" --http 127.0.0.1:8080`,
+		"ExecReload=/bin/kill -HUP $MAINPID",
+		"WantedBy=default.target",
+	} {
+		if !strings.Contains(string(unit), line+"\n") {
+			t.Errorf("Expected unit to contain %q:\n%s", line, unit)
+		}
+	}
+
+	if err := mgr.Stop(); err != nil {
+		t.Fatalf("Failed to stop: %v", err)
+	}
+	if err := mgr.Uninstall(); err != nil {
+		t.Fatalf("Failed to uninstall: %v", err)
+	}
+	if _, err := os.Stat(want); !os.IsNotExist(err) {
+		t.Errorf("Expected unit to be removed, got %v", err)
+	}
+
+	expected := []string{
+		"systemctl --user daemon-reload",
+		"systemctl --user enable --now mcpgate.service",
+		"systemctl --user stop mcpgate.service",
+		"systemctl --user disable --now mcpgate.service",
+		"systemctl --user daemon-reload",
+	}
+	if !reflect.DeepEqual(rec.commands, expected) {
+		t.Errorf("Expected commands %v, got %v", expected, rec.commands)
+	}
+}
+
+func TestSystemd_System(t *testing.T) {
+	spec := testSpec()
+	spec.Name = "shared"
+	spec.System = true
+	mgr, err := newManager("linux", t.TempDir(), spec, (&recorder{}).run)
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+
+	if mgr.Path() != "/etc/systemd/system/shared.service" {
+		t.Errorf("Unexpected unit path %s", mgr.Path())
+	}
+	if unit := string(mgr.Render()); !strings.Contains(unit, "WantedBy=multi-user.target\n") {
+		t.Errorf("Expected a system unit wanted by multi-user.target:\n%s", unit)
+	}
+}
+
+func TestLaunchd_Lifecycle(t *testing.T) {
+	home := t.TempDir()
+	rec := &recorder{}
+	mgr, err := newManager("darwin", home, testSpec(), rec.run)
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+
+	want := filepath.Join(home, "Library", "LaunchAgents", "com.github.j4ng5y.mcpgate.plist")
+	if mgr.Path() != want {
+		t.Errorf("Expected job at %s, got %s", want, mgr.Path())
+	}
+	if err := mgr.Install(); err != nil {
+		t.Fatalf("Failed to install: %v", err)
+	}
+	plist, err := os.ReadFile(want)
+	if err != nil {
+		t.Fatalf("Failed to read job: %v", err)
+	}
+	for _, line := range []string{
+		"<string>com.github.j4ng5y.mcpgate</string>",
+		"<string>/home/me/mcp gate/config.toml</string>",
+		"<key>SuccessfulExit</key>",
+		"<string>" + filepath.Join(home, "Library", "Logs", "mcpgate.log") + "</string>",
+	} {
+		if !strings.Contains(string(plist), line) {
+			t.Errorf("Expected job to contain %q:\n%s", line, plist)
+		}
+	}
+
+	if err := mgr.Uninstall(); err != nil {
+		t.Fatalf("Failed to uninstall: %v", err)
+	}
+
+	target := "gui/" + strconv.Itoa(os.Getuid())
+	expected := []string{
+		"launchctl bootstrap " + target + " " + want,
+		"launchctl bootout " + target + "/com.github.j4ng5y.mcpgate",
+	}
+	if !reflect.DeepEqual(rec.commands, expected) {
+		t.Errorf("Expected commands %v, got %v", expected, rec.commands)
+	}
+}
+
+func TestLaunchd_EscapesArguments(t *testing.T) {
+	spec := testSpec()
+	spec.ConfigPath = "/tmp/a&b<c>.toml"
+	mgr, err := newManager("darwin", t.TempDir(), spec, (&recorder{}).run)
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+
+	if plist := string(mgr.Render()); !strings.Contains(plist, "<string>/tmp/a&amp;b&lt;c&gt;.toml</string>") {
+		t.Errorf("Expected the config path to be escaped:\n%s", plist)
+	}
+}
+
+func TestNewManager_Invalid(t *testing.T) {
+	spec := testSpec()
+	if _, err := newManager("windows", t.TempDir(), spec, (&recorder{}).run); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Expected ErrUnsupported, got %v", err)
+	}
+
+	spec.Name = "../evil"
+	if _, err := newManager("linux", t.TempDir(), spec, (&recorder{}).run); err == nil {
+		t.Error("Expected error for a name with a path")
+	}
+}
+
+func TestSystemdQuote(t *testing.T) {
+	tests := map[string]string{
+		"/usr/bin/mcpgate":    "/usr/bin/mcpgate",
+		"/srv/my config.toml": `"/srv/my config.toml"`,
+		`/srv/"quoted"`:       `"/srv/\"quoted\""`,
+		"/srv/100%/$HOME":     "/srv/100%%/$$HOME",
+		"":                    `""`,
+	}
+
+	for arg, want := range tests {
+		if got := systemdQuote(arg); got != want {
+			t.Errorf("systemdQuote(%q) = %s, want %s", arg, got, want)
+		}
+	}
+}
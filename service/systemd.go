@@ -0,0 +1,140 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// systemdSystemDir holds the units of system-wide services
+const systemdSystemDir = "/etc/systemd/system"
+
+// Systemd manages the service as a systemd unit
+type Systemd struct {
+	spec Spec
+	path string
+	run  runner
+}
+
+// newSystemd creates a systemd manager; user units live in the user's
+// systemd config directory
+func newSystemd(home string, spec Spec, run runner) *Systemd {
+	dir := systemdSystemDir
+	if !spec.System {
+		configHome := os.Getenv("XDG_CONFIG_HOME")
+		if configHome == "" {
+			configHome = filepath.Join(home, ".config")
+		}
+		dir = filepath.Join(configHome, "systemd", "user")
+	}
+	return &Systemd{spec: spec, path: filepath.Join(dir, spec.Name+".service"), run: run}
+}
+
+// Kind returns the service manager
+func (s *Systemd) Kind() string {
+	if s.spec.System {
+		return "systemd system service"
+	}
+	return "systemd user service"
+}
+
+// Path returns the unit file
+func (s *Systemd) Path() string {
+	return s.path
+}
+
+// Render returns the unit file. SIGHUP reloads the gateway's servers, so it
+// doubles as systemctl reload.
+func (s *Systemd) Render() []byte {
+	wantedBy := "default.target"
+	if s.spec.System {
+		wantedBy = "multi-user.target"
+	}
+
+	args := make([]string, 0, len(s.spec.Args()))
+	for _, arg := range s.spec.Args() {
+		args = append(args, systemdQuote(arg))
+	}
+
+	var b bytes.Buffer
+	b.WriteString("[Unit]\n")
+	fmt.Fprintf(&b, "Description=mcpgate MCP gateway (%s)\n", s.spec.Name)
+	b.WriteString("Wants=network-online.target\n")
+	b.WriteString("After=network-online.target\n")
+	b.WriteString("\n[Service]\n")
+	fmt.Fprintf(&b, "ExecStart=%s\n", strings.Join(args, " "))
+	b.WriteString("ExecReload=/bin/kill -HUP $MAINPID\n")
+	b.WriteString("Restart=on-failure\n")
+	b.WriteString("\n[Install]\n")
+	fmt.Fprintf(&b, "WantedBy=%s\n", wantedBy)
+	return b.Bytes()
+}
+
+// Install writes the unit, then enables and starts it
+func (s *Systemd) Install() error {
+	if err := writeDefinition(s.path, s.Render()); err != nil {
+		return err
+	}
+	if err := s.systemctl("daemon-reload"); err != nil {
+		return err
+	}
+	return s.systemctl("enable", "--now", s.unit())
+}
+
+// Uninstall stops and disables the unit and removes it
+func (s *Systemd) Uninstall() error {
+	if err := checkInstalled(s.path); err != nil {
+		return err
+	}
+	if err := s.systemctl("disable", "--now", s.unit()); err != nil {
+		return err
+	}
+	if err := os.Remove(s.path); err != nil {
+		return fmt.Errorf("failed to remove %s: %w", s.path, err)
+	}
+	return s.systemctl("daemon-reload")
+}
+
+// Start starts the unit
+func (s *Systemd) Start() error {
+	if err := checkInstalled(s.path); err != nil {
+		return err
+	}
+	return s.systemctl("start", s.unit())
+}
+
+// Stop stops the unit
+func (s *Systemd) Stop() error {
+	if err := checkInstalled(s.path); err != nil {
+		return err
+	}
+	return s.systemctl("stop", s.unit())
+}
+
+// unit returns the unit name
+func (s *Systemd) unit() string {
+	return s.spec.Name + ".service"
+}
+
+// systemctl runs systemctl on the user or system manager
+func (s *Systemd) systemctl(args ...string) error {
+	if !s.spec.System {
+		args = append([]string{"--user"}, args...)
+	}
+	return s.run("systemctl", args...)
+}
+
+// systemdQuote quotes an ExecStart argument. % and $ are escaped so paths
+// are never taken for specifiers or variables.
+func systemdQuote(arg string) string {
+	arg = strings.ReplaceAll(arg, "%", "%%")
+	arg = strings.ReplaceAll(arg, "$", "$$")
+	if arg != "" && !strings.ContainsAny(arg, " \t\n\"'\\;") {
+		return arg
+	}
+	arg = strings.ReplaceAll(arg, `\`, `\\`)
+	arg = strings.ReplaceAll(arg, `"`, `\"`)
+	return `"` + arg + `"`
+}
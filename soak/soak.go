@@ -0,0 +1,336 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"runtime"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/j4ng5y/mcpgate/config"
+	"github.com/j4ng5y/mcpgate/mcp"
+	"github.com/j4ng5y/mcpgate/pool"
+	"github.com/j4ng5y/mcpgate/server"
+)
+
+// options configures a soak run
+type options struct {
+	Upstreams   int
+	Duration    time.Duration
+	Concurrency int
+	Interval    time.Duration
+	Rate        int
+	CrashAfter  time.Duration
+	PayloadSize int
+	PoolIdle    time.Duration
+
+	// Failure thresholds, compared against the first sample after warm-up
+	MaxGoroutineGrowth int
+	MaxHeapGrowth      float64
+	MaxLatencyDrift    float64
+}
+
+// sample is one reporting interval's measurements
+type sample struct {
+	Elapsed    time.Duration
+	Requests   int64
+	Errors     int64
+	Reconnects int64
+	P50        time.Duration
+	P95        time.Duration
+	P99        time.Duration
+	HeapAlloc  uint64
+	Goroutines int
+	PoolSize   int
+}
+
+// stats accumulates request outcomes between samples
+type stats struct {
+	requests   atomic.Int64
+	errors     atomic.Int64
+	reconnects atomic.Int64
+
+	mutex     sync.Mutex
+	latencies []time.Duration
+}
+
+// record adds one request's outcome
+func (s *stats) record(latency time.Duration, failed bool) {
+	s.requests.Add(1)
+	if failed {
+		s.errors.Add(1)
+	}
+	s.mutex.Lock()
+	s.latencies = append(s.latencies, latency)
+	s.mutex.Unlock()
+}
+
+// drainLatencies returns the latencies recorded since the last call, sorted
+func (s *stats) drainLatencies() []time.Duration {
+	s.mutex.Lock()
+	latencies := s.latencies
+	s.latencies = nil
+	s.mutex.Unlock()
+
+	slices.Sort(latencies)
+	return latencies
+}
+
+// percentile returns the p-th percentile of sorted latencies
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := int(float64(len(sorted)-1) * p)
+	return sorted[idx]
+}
+
+// run starts a gateway with mock upstreams, drives mixed traffic until the
+// duration elapses or ctx is cancelled, and returns the samples and any
+// threshold violations
+func run(ctx context.Context, opts options) ([]sample, []string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to find soak binary: %w", err)
+	}
+
+	// Upstreams inherit the gateway's environment
+	os.Setenv(envUpstream, "1")
+	os.Setenv(envCrashAfter, opts.CrashAfter.String())
+	os.Setenv(envPayload, strconv.Itoa(opts.PayloadSize))
+
+	// A crash fails every in-flight request, which must not be enough on its
+	// own to quarantine a server
+	cfg := &config.Config{
+		Gateway: config.GatewayConfig{
+			Quarantine: config.QuarantineConfig{FailureBudget: opts.Concurrency + 5, RetryInterval: 5},
+		},
+	}
+	names := make([]string, opts.Upstreams)
+	for i := range names {
+		names[i] = fmt.Sprintf("mock-%d", i)
+		cfg.Servers = append(cfg.Servers, config.ServerConfig{
+			Name:                names[i],
+			Transport:           "stdio",
+			Enabled:             true,
+			Command:             exe,
+			Timeout:             10,
+			AutoReconnect:       true,
+			ReconnectMaxRetries: -1,
+		})
+	}
+
+	manager := server.NewManager(cfg)
+	st := &stats{}
+	manager.OnStatus(func(event server.StatusEvent) {
+		if event.Status == server.StatusReconnected {
+			st.reconnects.Add(1)
+		}
+	})
+	if err := manager.Start(); err != nil {
+		manager.Stop()
+		return nil, nil, fmt.Errorf("failed to start gateway: %w", err)
+	}
+	defer manager.Stop()
+
+	router := mcp.NewRouter(manager)
+	connPool := pool.NewConnectionPool(opts.Upstreams, opts.PoolIdle)
+	defer func() {
+		closeCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = connPool.Close(closeCtx)
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, opts.Duration)
+	defer cancel()
+
+	// Workers share one ticker so the total request rate stays fixed
+	var pace <-chan time.Time
+	if opts.Rate > 0 {
+		ticker := time.NewTicker(time.Second / time.Duration(opts.Rate))
+		defer ticker.Stop()
+		pace = ticker.C
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < opts.Concurrency; i++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for id := 1; ctx.Err() == nil; id++ {
+				if pace != nil {
+					select {
+					case <-pace:
+					case <-ctx.Done():
+						return
+					}
+				}
+				req := trafficRequest(names, fmt.Sprintf("w%d-%d", worker, id))
+				start := time.Now()
+				resp := router.Route(ctx, req)
+				st.record(time.Since(start), resp.Error != nil)
+			}
+		}(i)
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		exercisePool(ctx, connPool, exe, st)
+	}()
+
+	var samples []sample
+	start := time.Now()
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+
+	// Sampling stops with the run so teardown never skews the last sample
+	for running := true; running; {
+		select {
+		case <-ctx.Done():
+			running = false
+			continue
+		case <-ticker.C:
+		}
+
+		s := takeSample(st, connPool, time.Since(start))
+		samples = append(samples, s)
+		reportf("t=%s requests=%d errors=%d reconnects=%d p50=%s p95=%s p99=%s heap=%dKiB goroutines=%d pool=%d",
+			s.Elapsed.Round(time.Second), s.Requests, s.Errors, s.Reconnects, s.P50, s.P95, s.P99,
+			s.HeapAlloc/1024, s.Goroutines, s.PoolSize)
+	}
+
+	wg.Wait()
+	return samples, checkThresholds(samples, opts), nil
+}
+
+// trafficRequest picks a request from the mixed workload
+func trafficRequest(names []string, id string) *mcp.Request {
+	target := names[rand.IntN(len(names))]
+	pinned := func(params map[string]interface{}) json.RawMessage {
+		params["_meta"] = map[string]interface{}{"server": target}
+		data, _ := json.Marshal(params)
+		return data
+	}
+
+	req := &mcp.Request{JSONRPC: "2.0", ID: id}
+	switch n := rand.IntN(100); {
+	case n < 30:
+		req.Method = mcp.MethodToolsList
+		req.Params = pinned(map[string]interface{}{})
+	case n < 70:
+		req.Method = mcp.MethodToolsCall
+		req.Params = pinned(map[string]interface{}{
+			"name":      "echo",
+			"arguments": map[string]interface{}{"request": id},
+		})
+	case n < 85:
+		req.Method = mcp.MethodResourcesRead
+		req.Params = pinned(map[string]interface{}{"uri": "soak://payload"})
+	case n < 95:
+		req.Method = "gateway/list_servers"
+	default:
+		calls := make([]map[string]interface{}, 0, len(names))
+		for _, name := range names {
+			calls = append(calls, map[string]interface{}{"name": "echo", "server": name})
+		}
+		req.Method = "gateway/call_batch"
+		req.Params, _ = json.Marshal(map[string]interface{}{"calls": calls})
+	}
+	return req
+}
+
+// exercisePool checks transports out of the connection pool, pings through
+// them and periodically evicts idle ones, as a pooled request path would
+func exercisePool(ctx context.Context, connPool *pool.ConnectionPool, exe string, st *stats) {
+	cfg := map[string]interface{}{"name": "pooled", "command": exe}
+	cleanup := time.NewTicker(time.Second)
+	defer cleanup.Stop()
+
+	for id := 1; ctx.Err() == nil; id++ {
+		select {
+		case <-cleanup.C:
+			_ = connPool.CleanIdleConnections(ctx)
+		default:
+		}
+
+		start := time.Now()
+		lease, err := connPool.GetTransport(ctx, "stdio", cfg)
+		if err == nil {
+			t := lease.Transport()
+			if !t.IsConnected() {
+				err = t.Connect(ctx)
+			}
+			if err == nil {
+				_, err = t.SendRequest(ctx, map[string]interface{}{"jsonrpc": "2.0", "id": id, "method": "ping"})
+			}
+			_ = lease.Release(err)
+		}
+		st.record(time.Since(start), err != nil)
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+// takeSample collects the interval's latencies and the process's resource usage
+func takeSample(st *stats, connPool *pool.ConnectionPool, elapsed time.Duration) sample {
+	latencies := st.drainLatencies()
+
+	// Collect first so HeapAlloc reflects live memory rather than garbage
+	runtime.GC()
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	poolSize, _ := connPool.Stats()["total_transports"].(int)
+
+	return sample{
+		Elapsed:    elapsed,
+		Requests:   st.requests.Load(),
+		Errors:     st.errors.Load(),
+		Reconnects: st.reconnects.Load(),
+		P50:        percentile(latencies, 0.50),
+		P95:        percentile(latencies, 0.95),
+		P99:        percentile(latencies, 0.99),
+		HeapAlloc:  mem.HeapAlloc,
+		Goroutines: runtime.NumGoroutine(),
+		PoolSize:   poolSize,
+	}
+}
+
+// checkThresholds compares the last sample with the first one after warm-up
+// and describes every leak or drift that exceeds its threshold
+func checkThresholds(samples []sample, opts options) []string {
+	// The first sample includes start-up; compare against the second when possible
+	if len(samples) < 2 {
+		return nil
+	}
+	baseline := samples[0]
+	if len(samples) > 2 {
+		baseline = samples[1]
+	}
+	last := samples[len(samples)-1]
+
+	var violations []string
+	if growth := last.Goroutines - baseline.Goroutines; opts.MaxGoroutineGrowth >= 0 && growth > opts.MaxGoroutineGrowth {
+		violations = append(violations, fmt.Sprintf("goroutines grew by %d (%d -> %d), limit %d",
+			growth, baseline.Goroutines, last.Goroutines, opts.MaxGoroutineGrowth))
+	}
+	if opts.MaxHeapGrowth > 0 && baseline.HeapAlloc > 0 && float64(last.HeapAlloc) > float64(baseline.HeapAlloc)*opts.MaxHeapGrowth {
+		violations = append(violations, fmt.Sprintf("heap grew %.1fx (%dKiB -> %dKiB), limit %.1fx",
+			float64(last.HeapAlloc)/float64(baseline.HeapAlloc), baseline.HeapAlloc/1024, last.HeapAlloc/1024, opts.MaxHeapGrowth))
+	}
+	if opts.MaxLatencyDrift > 0 && baseline.P95 > 0 && float64(last.P95) > float64(baseline.P95)*opts.MaxLatencyDrift {
+		violations = append(violations, fmt.Sprintf("p95 latency drifted %.1fx (%s -> %s), limit %.1fx",
+			float64(last.P95)/float64(baseline.P95), baseline.P95, last.P95, opts.MaxLatencyDrift))
+	}
+	return violations
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	// The test binary stands in for the soak binary as the mock upstream
+	if os.Getenv(envUpstream) != "" {
+		crashAfter, payloadSize := upstreamSettings()
+		runUpstream(os.Stdin, os.Stdout, crashAfter, payloadSize)
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func TestRun_Short(t *testing.T) {
+	if testing.Short() {
+		t.Skip("soak run skipped in short mode")
+	}
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	samples, violations, err := run(context.Background(), options{
+		Upstreams:          2,
+		Duration:           3500 * time.Millisecond,
+		Concurrency:        4,
+		Interval:           time.Second,
+		Rate:               200,
+		CrashAfter:         time.Second,
+		PayloadSize:        1024,
+		PoolIdle:           time.Second,
+		MaxGoroutineGrowth: 50,
+	})
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if len(samples) < 2 {
+		t.Fatalf("Expected a sample per interval, got %d", len(samples))
+	}
+	if len(violations) > 0 {
+		t.Errorf("Unexpected violations: %v", violations)
+	}
+
+	last := samples[len(samples)-1]
+	if last.Requests == 0 {
+		t.Error("Expected traffic to be sent")
+	}
+	if last.Errors == last.Requests {
+		t.Error("Expected some requests to succeed")
+	}
+}
+
+func TestCheckThresholds(t *testing.T) {
+	samples := []sample{
+		{Goroutines: 100, HeapAlloc: 1 << 20, P95: time.Millisecond},
+		{Goroutines: 20, HeapAlloc: 1 << 20, P95: time.Millisecond},
+		{Goroutines: 200, HeapAlloc: 4 << 20, P95: 10 * time.Millisecond},
+	}
+	opts := options{MaxGoroutineGrowth: 50, MaxHeapGrowth: 2, MaxLatencyDrift: 3}
+
+	if violations := checkThresholds(samples, opts); len(violations) != 3 {
+		t.Errorf("Expected goroutine, heap and latency violations, got %v", violations)
+	}
+
+	samples[2] = sample{Goroutines: 30, HeapAlloc: 1 << 20, P95: 2 * time.Millisecond}
+	if violations := checkThresholds(samples, opts); len(violations) != 0 {
+		t.Errorf("Expected no violations, got %v", violations)
+	}
+}
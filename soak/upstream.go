@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Environment variables that turn the soak binary into a mock upstream. The
+// gateway starts upstreams with its own environment, so the harness sets
+// these on itself before starting the gateway.
+const (
+	envUpstream   = "MCPGATE_SOAK_UPSTREAM"    // Set to run as a mock upstream
+	envCrashAfter = "MCPGATE_SOAK_CRASH_AFTER" // Mean lifetime before exiting, e.g. "5m"; empty never
+	envPayload    = "MCPGATE_SOAK_PAYLOAD"     // Bytes returned by resources/read
+)
+
+// upstreamMessage is a request or notification received from the gateway
+type upstreamMessage struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// runUpstream serves a minimal MCP server on in/out until in is closed. It
+// advertises tools and resources and echoes tool arguments. When crashAfter
+// is set it exits after a random, exponentially distributed lifetime with
+// that mean, so the gateway's reconnect path stays exercised.
+func runUpstream(in io.Reader, out io.Writer, crashAfter time.Duration, payloadSize int) {
+	if crashAfter > 0 {
+		lifetime := time.Duration(rand.ExpFloat64() * float64(crashAfter))
+		time.AfterFunc(lifetime, func() {
+			os.Exit(1)
+		})
+	}
+
+	payload := strings.Repeat("x", payloadSize)
+	reader := bufio.NewReaderSize(in, 64*1024)
+	encoder := json.NewEncoder(out)
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			return
+		}
+
+		var msg upstreamMessage
+		if err := json.Unmarshal(line, &msg); err != nil || len(msg.ID) == 0 {
+			// Notifications need no answer
+			continue
+		}
+
+		resp := map[string]interface{}{"jsonrpc": "2.0", "id": msg.ID}
+		switch msg.Method {
+		case "initialize":
+			resp["result"] = map[string]interface{}{
+				"protocolVersion": "2024-11-05",
+				"capabilities": map[string]interface{}{
+					"tools":     map[string]interface{}{},
+					"resources": map[string]interface{}{},
+				},
+				"serverInfo": map[string]interface{}{"name": "soak-upstream", "version": "1.0.0"},
+			}
+		case "ping":
+			resp["result"] = map[string]interface{}{}
+		case "tools/list":
+			resp["result"] = map[string]interface{}{
+				"tools": []map[string]interface{}{{
+					"name":        "echo",
+					"description": "Echo the arguments back",
+					"inputSchema": map[string]interface{}{"type": "object"},
+				}},
+			}
+		case "tools/call":
+			resp["result"] = map[string]interface{}{
+				"content": []map[string]interface{}{{"type": "text", "text": string(msg.Params)}},
+			}
+		case "resources/list":
+			resp["result"] = map[string]interface{}{
+				"resources": []map[string]interface{}{{"uri": "soak://payload", "name": "payload"}},
+			}
+		case "resources/read":
+			resp["result"] = map[string]interface{}{
+				"contents": []map[string]interface{}{{"uri": "soak://payload", "text": payload}},
+			}
+		default:
+			resp["error"] = map[string]interface{}{"code": -32601, "message": "Method not found"}
+		}
+
+		if err := encoder.Encode(resp); err != nil {
+			return
+		}
+	}
+}
+
+// upstreamSettings reads the mock upstream settings from the environment
+func upstreamSettings() (crashAfter time.Duration, payloadSize int) {
+	crashAfter, _ = time.ParseDuration(os.Getenv(envCrashAfter))
+	payloadSize, _ = strconv.Atoi(os.Getenv(envPayload))
+	return crashAfter, payloadSize
+}
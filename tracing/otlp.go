@@ -0,0 +1,317 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/j4ng5y/mcpgate/logging"
+)
+
+// Batching of finished spans before they are exported
+const (
+	maxQueueSize   = 2048            // Spans waiting for export; more are dropped
+	maxBatchSize   = 512             // Spans sent in one export request
+	exportInterval = 5 * time.Second // Longest a span waits for its batch
+	exportTimeout  = 10 * time.Second
+)
+
+// scopeName identifies the gateway as the instrumentation scope of its spans
+const scopeName = "github.com/j4ng5y/mcpgate"
+
+// Exporter sends finished spans in batches to an OpenTelemetry collector,
+// over OTLP/HTTP with JSON encoding
+type Exporter struct {
+	url      string
+	headers  map[string]string
+	resource []otlpAttribute
+	client   *http.Client
+
+	queue   chan *Span
+	flush   chan chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+
+	mutex   sync.Mutex
+	dropped int
+}
+
+// NewExporter starts an exporter posting to the collector at endpoint, e.g.
+// http://localhost:4318, whose /v1/traces path is added unless given. The
+// headers are sent with every request; the resource attributes, such as
+// service.name, describe the gateway.
+func NewExporter(endpoint string, headers, resource map[string]string) *Exporter {
+	url := strings.TrimSuffix(endpoint, "/")
+	if !strings.HasSuffix(url, "/v1/traces") {
+		url += "/v1/traces"
+	}
+
+	keys := make([]string, 0, len(resource))
+	for key := range resource {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	attributes := make([]otlpAttribute, 0, len(keys))
+	for _, key := range keys {
+		attributes = append(attributes, attribute(key, resource[key]))
+	}
+
+	e := &Exporter{
+		url:      url,
+		headers:  headers,
+		resource: attributes,
+		client:   &http.Client{Timeout: exportTimeout},
+		queue:    make(chan *Span, maxQueueSize),
+		flush:    make(chan chan struct{}),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+// export queues a finished span, dropping it when the queue is full so a
+// slow collector never holds up requests
+func (e *Exporter) export(span *Span) {
+	select {
+	case e.queue <- span:
+	default:
+		e.mutex.Lock()
+		e.dropped++
+		e.mutex.Unlock()
+	}
+}
+
+// Flush exports the spans queued so far
+func (e *Exporter) Flush(ctx context.Context) error {
+	flushed := make(chan struct{})
+	select {
+	case e.flush <- flushed:
+	case <-e.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Shutdown exports the spans still queued and stops the exporter. Spans
+// ending afterwards are dropped.
+func (e *Exporter) Shutdown(ctx context.Context) error {
+	e.once.Do(func() {
+		close(e.done)
+	})
+	select {
+	case <-e.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run batches queued spans until the exporter is shut down
+func (e *Exporter) run() {
+	defer close(e.stopped)
+	ticker := time.NewTicker(exportInterval)
+	defer ticker.Stop()
+
+	var batch []*Span
+	send := func() {
+		// Drain what is queued, in batches no larger than maxBatchSize
+		for {
+		drain:
+			for len(batch) < maxBatchSize {
+				select {
+				case span := <-e.queue:
+					batch = append(batch, span)
+				default:
+					break drain
+				}
+			}
+			if len(batch) == 0 {
+				return
+			}
+			if err := e.post(batch); err != nil {
+				slog.Warn("Failed to export spans", "spans", len(batch), logging.Err(err))
+			}
+			batch = batch[:0]
+		}
+	}
+
+	for {
+		select {
+		case span := <-e.queue:
+			batch = append(batch, span)
+			if len(batch) >= maxBatchSize {
+				send()
+			}
+		case <-ticker.C:
+			send()
+		case flushed := <-e.flush:
+			send()
+			close(flushed)
+		case <-e.done:
+			send()
+			return
+		}
+
+		e.mutex.Lock()
+		dropped := e.dropped
+		e.dropped = 0
+		e.mutex.Unlock()
+		if dropped > 0 {
+			slog.Warn("Dropped spans: export queue full", "spans", dropped)
+		}
+	}
+}
+
+// post sends one batch of spans to the collector
+func (e *Exporter) post(batch []*Span) error {
+	spans := make([]otlpSpan, 0, len(batch))
+	for _, span := range batch {
+		spans = append(spans, encodeSpan(span))
+	}
+	data, err := json.Marshal(otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: e.resource},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: scopeName}, Spans: spans}},
+	}}})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, e.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range e.headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("collector returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// The OTLP/HTTP JSON encoding of an export request. IDs are hex and
+// timestamps decimal strings, as the protocol's JSON mapping requires.
+type (
+	otlpRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+	otlpSpan struct {
+		TraceID           string          `json:"traceId"`
+		SpanID            string          `json:"spanId"`
+		ParentSpanID      string          `json:"parentSpanId,omitempty"`
+		Name              string          `json:"name"`
+		Kind              Kind            `json:"kind"`
+		StartTimeUnixNano string          `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+		Attributes        []otlpAttribute `json:"attributes,omitempty"`
+		Status            otlpStatus      `json:"status"`
+	}
+	otlpStatus struct {
+		Code    int    `json:"code,omitempty"` // 1 is ok, 2 error
+		Message string `json:"message,omitempty"`
+	}
+	otlpAttribute struct {
+		Key   string    `json:"key"`
+		Value otlpValue `json:"value"`
+	}
+	otlpValue struct {
+		StringValue *string  `json:"stringValue,omitempty"`
+		BoolValue   *bool    `json:"boolValue,omitempty"`
+		IntValue    *string  `json:"intValue,omitempty"`
+		DoubleValue *float64 `json:"doubleValue,omitempty"`
+	}
+)
+
+// encodeSpan converts a finished span to its OTLP form
+func encodeSpan(span *Span) otlpSpan {
+	encoded := otlpSpan{
+		TraceID:           span.context.TraceID.String(),
+		SpanID:            span.context.SpanID.String(),
+		Name:              span.name,
+		Kind:              span.kind,
+		StartTimeUnixNano: strconv.FormatInt(span.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(span.end.UnixNano(), 10),
+	}
+	if span.parent != (SpanID{}) {
+		encoded.ParentSpanID = span.parent.String()
+	}
+	if span.failed {
+		encoded.Status = otlpStatus{Code: 2, Message: span.message}
+	}
+
+	keys := make([]string, 0, len(span.attributes))
+	for key := range span.attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		encoded.Attributes = append(encoded.Attributes, attribute(key, span.attributes[key]))
+	}
+	return encoded
+}
+
+// attribute encodes a key and value, formatting types OTLP lacks as strings
+func attribute(key string, value interface{}) otlpAttribute {
+	var v otlpValue
+	switch value := value.(type) {
+	case string:
+		v.StringValue = &value
+	case bool:
+		v.BoolValue = &value
+	case int:
+		s := strconv.Itoa(value)
+		v.IntValue = &s
+	case int64:
+		s := strconv.FormatInt(value, 10)
+		v.IntValue = &s
+	case float64:
+		v.DoubleValue = &value
+	default:
+		s := fmt.Sprint(value)
+		v.StringValue = &s
+	}
+	return otlpAttribute{Key: key, Value: v}
+}
@@ -0,0 +1,71 @@
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"net/http"
+)
+
+// TraceparentHeader carries the W3C trace context of the caller's span
+const TraceparentHeader = "Traceparent"
+
+// ParseTraceparent decodes a W3C traceparent value, such as
+// "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+func ParseTraceparent(value string) (SpanContext, bool) {
+	// Later versions may append fields, so only version 00 must be exact
+	if len(value) < 55 || (value[:2] == "00" && len(value) != 55) || value[:2] == "ff" {
+		return SpanContext{}, false
+	}
+	if value[2] != '-' || value[35] != '-' || value[52] != '-' || (len(value) > 55 && value[55] != '-') {
+		return SpanContext{}, false
+	}
+
+	var sc SpanContext
+	var version, flags [1]byte
+	if !decodeHex(version[:], value[:2]) || !decodeHex(sc.TraceID[:], value[3:35]) || !decodeHex(sc.SpanID[:], value[36:52]) || !decodeHex(flags[:], value[53:55]) {
+		return SpanContext{}, false
+	}
+	if !sc.IsValid() {
+		return SpanContext{}, false
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, true
+}
+
+// decodeHex decodes lowercase hex into dst, which it must exactly fill
+func decodeHex(dst []byte, src string) bool {
+	for _, c := range src {
+		if c >= 'A' && c <= 'F' {
+			return false
+		}
+	}
+	n, err := hex.Decode(dst, []byte(src))
+	return err == nil && n == len(dst)
+}
+
+// Traceparent encodes the span context as a W3C traceparent value
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// Extract returns a context continuing the trace in the traceparent header
+// of an incoming request, if it has a valid one
+func Extract(ctx context.Context, header http.Header) context.Context {
+	sc, ok := ParseTraceparent(header.Get(TraceparentHeader))
+	if !ok {
+		return ctx
+	}
+	return WithRemote(ctx, sc)
+}
+
+// Inject sets the traceparent header of an outgoing request to the span in
+// ctx, so the upstream's spans join the trace
+func Inject(ctx context.Context, header http.Header) {
+	if sc := SpanFromContext(ctx).Context(); sc.IsValid() {
+		header.Set(TraceparentHeader, sc.Traceparent())
+	}
+}
@@ -0,0 +1,183 @@
+// Package tracing records spans for the requests the gateway routes and
+// exports them over OTLP, propagating W3C trace context so the gateway's
+// spans join the traces of its clients and upstreams
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// TraceID identifies a trace
+type TraceID [16]byte
+
+// SpanID identifies a span within a trace
+type SpanID [8]byte
+
+// String returns the trace ID in hex
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// String returns the span ID in hex
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// SpanContext is the part of a span propagated across process boundaries
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// IsValid reports whether both IDs are set, as the W3C spec requires
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != TraceID{} && sc.SpanID != SpanID{}
+}
+
+// Kind describes a span's role, with the values OTLP uses
+type Kind int
+
+const (
+	KindInternal Kind = 1
+	KindServer   Kind = 2 // Handling a request from a downstream client
+	KindClient   Kind = 3 // Sending a request to an upstream server
+)
+
+// Span is one timed operation in a trace. A nil span, returned while
+// tracing is off, ignores every call.
+type Span struct {
+	tracer     *Tracer
+	name       string
+	kind       Kind
+	context    SpanContext
+	parent     SpanID
+	start      time.Time
+	end        time.Time
+	attributes map[string]interface{}
+	failed     bool
+	message    string
+	once       sync.Once
+}
+
+// Context returns the span's context, to propagate to the next hop
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.context
+}
+
+// SetAttribute records a string, bool, integer or float attribute. It must
+// not be called after End.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.attributes[key] = value
+}
+
+// SetError marks the span as failed with message
+func (s *Span) SetError(message string) {
+	if s == nil {
+		return
+	}
+	s.failed = true
+	s.message = message
+}
+
+// End finishes the span and queues it for export. Later calls do nothing.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.once.Do(func() {
+		s.end = time.Now()
+		if s.context.Sampled {
+			s.tracer.exporter.export(s)
+		}
+	})
+}
+
+// Tracer creates spans and hands the finished ones to its exporter
+type Tracer struct {
+	exporter *Exporter
+}
+
+// NewTracer creates a tracer exporting finished spans through exporter
+func NewTracer(exporter *Exporter) *Tracer {
+	return &Tracer{exporter: exporter}
+}
+
+var (
+	tracerMutex sync.RWMutex
+	tracer      *Tracer
+)
+
+// SetTracer installs the tracer Start records spans with; nil turns tracing
+// off
+func SetTracer(t *Tracer) {
+	tracerMutex.Lock()
+	defer tracerMutex.Unlock()
+	tracer = t
+}
+
+// spanKey is the context key for the current span
+type spanKey struct{}
+
+// remoteKey is the context key for a span context received from a client
+type remoteKey struct{}
+
+// Start begins a span named name, as a child of the span in ctx or of the
+// remote span a client passed in. It returns a context carrying the new
+// span, and a nil span when tracing is off.
+func Start(ctx context.Context, name string, kind Kind) (context.Context, *Span) {
+	tracerMutex.RLock()
+	t := tracer
+	tracerMutex.RUnlock()
+	if t == nil {
+		return ctx, nil
+	}
+
+	span := &Span{
+		tracer:     t,
+		name:       name,
+		kind:       kind,
+		start:      time.Now(),
+		attributes: make(map[string]interface{}),
+	}
+	parent := SpanFromContext(ctx).Context()
+	if !parent.IsValid() {
+		parent, _ = ctx.Value(remoteKey{}).(SpanContext)
+	}
+	if parent.IsValid() {
+		// A client that chose not to sample the trace is respected
+		span.context = SpanContext{TraceID: parent.TraceID, Sampled: parent.Sampled}
+		span.parent = parent.SpanID
+	} else {
+		_, _ = rand.Read(span.context.TraceID[:])
+		span.context.Sampled = true
+	}
+	_, _ = rand.Read(span.context.SpanID[:])
+
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// SpanFromContext returns the span in ctx, or nil
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// WithRemote returns a context whose next span continues the trace of a
+// span in another process
+func WithRemote(ctx context.Context, sc SpanContext) context.Context {
+	if !sc.IsValid() {
+		return ctx
+	}
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
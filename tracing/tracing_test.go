@@ -0,0 +1,130 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		valid   bool
+		sampled bool
+	}{
+		{"sampled", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true, true},
+		{"not sampled", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", true, false},
+		{"later version", "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", true, true},
+		{"empty", "", false, false},
+		{"invalid version", "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false, false},
+		{"uppercase", "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", false, false},
+		{"zero trace id", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", false, false},
+		{"version 00 with extra", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc, ok := ParseTraceparent(tt.value)
+			if ok != tt.valid || sc.Sampled != tt.sampled {
+				t.Fatalf("Expected valid=%t sampled=%t, got %t %t", tt.valid, tt.sampled, ok, sc.Sampled)
+			}
+			if ok && tt.value[:2] == "00" && sc.Traceparent() != tt.value {
+				t.Errorf("Expected %q to round trip, got %q", tt.value, sc.Traceparent())
+			}
+		})
+	}
+}
+
+func TestStart_Disabled(t *testing.T) {
+	ctx, span := Start(context.Background(), "tools/call", KindServer)
+	if span != nil {
+		t.Fatalf("Expected no span while tracing is off")
+	}
+	// A nil span ignores every call
+	span.SetAttribute("key", "value")
+	span.SetError("failed")
+	span.End()
+
+	header := http.Header{}
+	Inject(ctx, header)
+	if header.Get(TraceparentHeader) != "" {
+		t.Errorf("Expected no traceparent while tracing is off, got %q", header.Get(TraceparentHeader))
+	}
+}
+
+func TestExporter_ExportsSpans(t *testing.T) {
+	var mutex sync.Mutex
+	var received []otlpSpan
+	var authorization string
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/v1/traces" || req.Header.Get("Content-Type") != "application/json" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		var body otlpRequest
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		authorization = req.Header.Get("Authorization")
+		for _, resourceSpans := range body.ResourceSpans {
+			for _, scopeSpans := range resourceSpans.ScopeSpans {
+				received = append(received, scopeSpans.Spans...)
+			}
+		}
+	}))
+	defer collector.Close()
+
+	exporter := NewExporter(collector.URL, map[string]string{"Authorization": "Bearer token"}, map[string]string{"service.name": "mcpgate"})
+	SetTracer(NewTracer(exporter))
+	t.Cleanup(func() {
+		SetTracer(nil)
+	})
+
+	// The client's span is the parent of the gateway's server span
+	incoming := http.Header{TraceparentHeader: {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}}
+	ctx, server := Start(Extract(context.Background(), incoming), "tools/call", KindServer)
+	_, client := Start(ctx, "tools/call", KindClient)
+	client.SetAttribute("mcpgate.server", "weather")
+	client.SetError("upstream failed")
+
+	outgoing := http.Header{}
+	Inject(ctx, outgoing)
+	if sc, ok := ParseTraceparent(outgoing.Get(TraceparentHeader)); !ok || sc != server.Context() {
+		t.Errorf("Expected the server span to be injected, got %q", outgoing.Get(TraceparentHeader))
+	}
+
+	client.End()
+	server.End()
+	if err := exporter.Shutdown(t.Context()); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if authorization != "Bearer token" {
+		t.Errorf("Expected the configured headers to be sent, got %q", authorization)
+	}
+	if len(received) != 2 {
+		t.Fatalf("Expected 2 spans, got %d", len(received))
+	}
+	clientSpan, serverSpan := received[0], received[1]
+	if serverSpan.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || serverSpan.ParentSpanID != "00f067aa0ba902b7" || serverSpan.Kind != KindServer {
+		t.Errorf("Expected the server span to continue the client's trace, got %+v", serverSpan)
+	}
+	if clientSpan.TraceID != serverSpan.TraceID || clientSpan.ParentSpanID != serverSpan.SpanID || clientSpan.Kind != KindClient {
+		t.Errorf("Expected the client span to be a child of the server span, got %+v", clientSpan)
+	}
+	if clientSpan.Status.Code != 2 || clientSpan.Status.Message != "upstream failed" {
+		t.Errorf("Expected the client span to have failed, got %+v", clientSpan.Status)
+	}
+	if len(clientSpan.Attributes) != 1 || *clientSpan.Attributes[0].Value.StringValue != "weather" {
+		t.Errorf("Expected the client span's attribute, got %+v", clientSpan.Attributes)
+	}
+}
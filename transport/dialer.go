@@ -0,0 +1,66 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+// dialFunc builds the dialer for remote transports from the "hosts" map
+// (static hostname to address overrides) and "dns_server" (a resolver used
+// instead of the system one). It returns nil when neither is configured so
+// callers keep their default dialer. TLS still verifies the original hostname.
+func dialFunc(config map[string]interface{}) (func(ctx context.Context, network, addr string) (net.Conn, error), error) {
+	hosts := make(map[string]string)
+	switch h := config["hosts"].(type) {
+	case map[string]string:
+		for name, addr := range h {
+			hosts[name] = addr
+		}
+	case map[string]interface{}:
+		for name, addr := range h {
+			if s, ok := addr.(string); ok {
+				hosts[name] = s
+			}
+		}
+	}
+
+	dnsServer, _ := config["dns_server"].(string)
+	if len(hosts) == 0 && dnsServer == "" {
+		return nil, nil
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+
+	if dnsServer != "" {
+		if _, _, err := net.SplitHostPort(dnsServer); err != nil {
+			dnsServer = net.JoinHostPort(dnsServer, "53")
+		}
+		host, _, err := net.SplitHostPort(dnsServer)
+		if err != nil || net.ParseIP(host) == nil {
+			return nil, fmt.Errorf("invalid dns_server %q: must be an IP address with optional port", dnsServer)
+		}
+
+		resolverDialer := &net.Dialer{Timeout: 5 * time.Second}
+		dialer.Resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return resolverDialer.DialContext(ctx, network, dnsServer)
+			},
+		}
+	}
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err == nil {
+			if override, ok := hosts[host]; ok {
+				addr = net.JoinHostPort(override, port)
+			}
+		}
+		return dialer.DialContext(ctx, network, addr)
+	}, nil
+}
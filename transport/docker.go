@@ -0,0 +1,175 @@
+//go:build !nodocker && !minimal
+
+package transport
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/j4ng5y/mcpgate/logging"
+)
+
+// DefaultDockerCommand is the container CLI used when docker_command is unset
+const DefaultDockerCommand = "docker"
+
+// containerNameChars matches characters Docker does not allow in container names
+var containerNameChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+func init() {
+	register("docker", NewDockerTransport)
+}
+
+// NewDockerTransport creates a new Docker transport
+func NewDockerTransport(config map[string]interface{}) (Transport, error) {
+	return &DockerTransport{
+		StdioTransport: &StdioTransport{config: map[string]interface{}{}},
+		config:         config,
+	}, nil
+}
+
+// DockerTransport runs an upstream server in a container with `docker run -i`
+// and talks to it over the CLI's stdio. The container is removed on
+// disconnect, including when the connection is lost unexpectedly.
+type DockerTransport struct {
+	*StdioTransport
+
+	config    map[string]interface{}
+	mutex     sync.Mutex
+	container string
+}
+
+// Connect starts the container and attaches to its stdio
+func (t *DockerTransport) Connect(ctx context.Context) error {
+	if t.StdioTransport.IsConnected() {
+		return nil
+	}
+
+	image, _ := t.config["image"].(string)
+	if image == "" {
+		return fmt.Errorf("docker transport requires 'image' configuration")
+	}
+
+	t.mutex.Lock()
+	t.container = containerName(t.config)
+	stdioConfig := dockerStdioConfig(t.config, t.container)
+	t.mutex.Unlock()
+
+	t.StdioTransport.mutex.Lock()
+	t.StdioTransport.config = stdioConfig
+	t.StdioTransport.mutex.Unlock()
+
+	return t.StdioTransport.Connect(ctx)
+}
+
+// Disconnect stops the container and removes it
+func (t *DockerTransport) Disconnect(ctx context.Context) error {
+	err := t.StdioTransport.Disconnect(ctx)
+	t.removeContainer()
+	return err
+}
+
+// SetDisconnectHandler sets the handler called when the connection is lost
+// unexpectedly; the container is removed before the handler runs
+func (t *DockerTransport) SetDisconnectHandler(handler DisconnectHandler) {
+	t.StdioTransport.SetDisconnectHandler(func(err error) {
+		t.removeContainer()
+		if handler != nil {
+			handler(err)
+		}
+	})
+}
+
+// removeContainer force-removes the current container, which is normally
+// already gone thanks to --rm unless the CLI was killed
+func (t *DockerTransport) removeContainer() {
+	t.mutex.Lock()
+	container := t.container
+	t.container = ""
+	t.mutex.Unlock()
+
+	if container == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, dockerCommand(t.config), "rm", "-f", container).CombinedOutput()
+	if err != nil && !strings.Contains(strings.ToLower(string(output)), "no such container") {
+		logger(t.config).Warn("Failed to remove container", "container", container, logging.Err(err), "output", strings.TrimSpace(string(output)))
+	}
+}
+
+// Name returns transport type name
+func (t *DockerTransport) Name() string {
+	return "docker"
+}
+
+// dockerCommand returns the container CLI, e.g. docker or podman
+func dockerCommand(config map[string]interface{}) string {
+	if command, ok := config["docker_command"].(string); ok && command != "" {
+		return command
+	}
+	return DefaultDockerCommand
+}
+
+// containerName builds a unique name so a container left behind by a crashed
+// gateway never blocks the next start
+func containerName(config map[string]interface{}) string {
+	name, _ := config["name"].(string)
+	name = strings.Trim(containerNameChars.ReplaceAllString(name, "-"), "-.")
+	if name == "" {
+		name = "server"
+	}
+
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+	return "mcpgate-" + name + "-" + hex.EncodeToString(suffix)
+}
+
+// dockerRunArgs builds the `docker run` arguments. Environment values are
+// passed by name only (-e KEY) and supplied through the CLI's own environment
+// so they never appear in the process list. A configured command follows the
+// image, replacing the image's default command, and args follow it.
+func dockerRunArgs(config map[string]interface{}, container string) []string {
+	image, _ := config["image"].(string)
+	server, _ := config["name"].(string)
+
+	args := []string{"run", "-i", "--rm", "--name", container, "--label", "mcpgate.server=" + server}
+
+	env := stringMap(config, "env")
+	keys := make([]string, 0, len(env))
+	for key := range env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		args = append(args, "-e", key)
+	}
+
+	args = append(args, stringList(config, "docker_args")...)
+	args = append(args, image)
+	if command, _ := config["command"].(string); command != "" {
+		args = append(args, command)
+	}
+	return append(args, stringList(config, "args")...)
+}
+
+// dockerStdioConfig derives the stdio configuration that runs the container
+func dockerStdioConfig(config map[string]interface{}, container string) map[string]interface{} {
+	stdioConfig := make(map[string]interface{}, len(config))
+	for key, value := range config {
+		stdioConfig[key] = value
+	}
+	stdioConfig["command"] = dockerCommand(config)
+	stdioConfig["args"] = dockerRunArgs(config, container)
+	return stdioConfig
+}
@@ -0,0 +1,18 @@
+//go:build nodocker || minimal
+
+package transport
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTransportFactory_DockerCompiledOut(t *testing.T) {
+	_, err := NewFactory().Create("docker", map[string]interface{}{"image": "example/mcp"})
+	if err == nil {
+		t.Fatal("Expected error when docker is compiled out")
+	}
+	if !strings.Contains(err.Error(), "not included in this build") {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,146 @@
+//go:build !nodocker && !minimal
+
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/j4ng5y/mcpgate/internal/mcptest"
+)
+
+func TestDockerTransport_MissingImage(t *testing.T) {
+	transport, err := NewFactory().Create("docker", map[string]interface{}{"name": "test"})
+	if err != nil {
+		t.Fatalf("Failed to create docker transport: %v", err)
+	}
+	if transport.Name() != "docker" {
+		t.Errorf("Expected transport name 'docker', got '%s'", transport.Name())
+	}
+
+	if err := transport.Connect(context.Background()); err == nil || !strings.Contains(err.Error(), "image") {
+		t.Fatalf("Expected missing image error, got %v", err)
+	}
+}
+
+func TestDockerRunArgs(t *testing.T) {
+	config := map[string]interface{}{
+		"name":        "github",
+		"image":       "ghcr.io/github/github-mcp-server",
+		"args":        []string{"stdio", "--read-only"},
+		"env":         map[string]string{"GITHUB_TOKEN": "secret", "A_FLAG": "1"},
+		"docker_args": []interface{}{"--network", "none"},
+	}
+
+	got := dockerRunArgs(config, "mcpgate-github-0001")
+	want := []string{
+		"run", "-i", "--rm", "--name", "mcpgate-github-0001", "--label", "mcpgate.server=github",
+		"-e", "A_FLAG", "-e", "GITHUB_TOKEN",
+		"--network", "none",
+		"ghcr.io/github/github-mcp-server",
+		"stdio", "--read-only",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("dockerRunArgs() =\n  %v\nwant\n  %v", got, want)
+	}
+
+	// A command replaces the image's default one, ahead of its args
+	config["command"] = "github-mcp-server"
+	if got := dockerRunArgs(config, "mcpgate-github-0001"); !slices.Equal(got[len(got)-4:], []string{"ghcr.io/github/github-mcp-server", "github-mcp-server", "stdio", "--read-only"}) {
+		t.Errorf("Expected the command between the image and args, got %v", got)
+	}
+
+	for _, arg := range got {
+		if strings.Contains(arg, "secret") {
+			t.Errorf("Environment value leaked into arguments: %v", got)
+		}
+	}
+}
+
+func TestContainerName(t *testing.T) {
+	first := containerName(map[string]interface{}{"name": "my server/1"})
+	second := containerName(map[string]interface{}{"name": "my server/1"})
+
+	if !strings.HasPrefix(first, "mcpgate-my-server-1-") {
+		t.Errorf("Unexpected container name %q", first)
+	}
+	if first == second {
+		t.Errorf("Expected unique container names, got %q twice", first)
+	}
+	if name := containerName(map[string]interface{}{}); !strings.HasPrefix(name, "mcpgate-server-") {
+		t.Errorf("Unexpected container name for unnamed server %q", name)
+	}
+}
+
+func TestDockerTransport_RunsAndRemovesContainer(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake docker CLI is a shell script")
+	}
+
+	// A fake CLI that records its invocations and answers like an upstream
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "docker.log")
+	echoPath := filepath.Join(dir, "echo.sh")
+	if err := os.WriteFile(echoPath, []byte(mcptest.EchoScript), 0644); err != nil {
+		t.Fatalf("Failed to write echo script: %v", err)
+	}
+	script := "#!/bin/sh\n" +
+		"if [ \"$1\" = rm ]; then echo \"rm $3\" >> " + logPath + "; exit 0; fi\n" +
+		"echo \"run $API_KEY\" >> " + logPath + "\n" +
+		"exec sh " + echoPath + "\n"
+	fakeDocker := filepath.Join(dir, "docker")
+	if err := os.WriteFile(fakeDocker, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write fake docker: %v", err)
+	}
+
+	transport, _ := NewDockerTransport(map[string]interface{}{
+		"name":           "test",
+		"image":          "example/mcp",
+		"env":            map[string]string{"API_KEY": "secret"},
+		"docker_command": fakeDocker,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := transport.Connect(ctx); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+
+	resp, err := transport.SendRequest(ctx, map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  "ping",
+	})
+	if err != nil {
+		t.Fatalf("SendRequest failed: %v", err)
+	}
+	var msg map[string]interface{}
+	if err := json.Unmarshal(resp, &msg); err != nil || msg["id"] != float64(1) {
+		t.Fatalf("Unexpected response %s: %v", resp, err)
+	}
+
+	container := transport.(*DockerTransport).container
+	if err := transport.Disconnect(ctx); err != nil {
+		t.Fatalf("Failed to disconnect: %v", err)
+	}
+	if transport.IsConnected() {
+		t.Error("Transport should be disconnected")
+	}
+
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("Failed to read log: %v", err)
+	}
+	want := "run secret\nrm " + container + "\n"
+	if string(data) != want {
+		t.Errorf("Expected invocations %q, got %q", want, data)
+	}
+}
@@ -0,0 +1,61 @@
+package transport
+
+import (
+	"os"
+	"runtime"
+	"strings"
+)
+
+// baseEnv are the variables a scrubbed subprocess still inherits: what most
+// programs need to run at all, and nothing that usually holds a secret
+var baseEnv = []string{
+	"PATH", "HOME", "USER", "LOGNAME", "SHELL", "LANG", "LC_*", "TZ", "TMPDIR",
+	// Windows
+	"SYSTEMROOT", "WINDIR", "COMSPEC", "PATHEXT", "TEMP", "TMP", "USERPROFILE", "APPDATA", "LOCALAPPDATA",
+}
+
+// subprocessEnv builds a subprocess environment. By default it inherits the
+// gateway's whole environment; with inherit_env = false or an env_allowlist
+// only baseEnv and the allowlisted names (a trailing * matches a prefix) are
+// inherited. The configured env is applied last.
+func subprocessEnv(config map[string]interface{}) []string {
+	allowlist := stringList(config, "env_allowlist")
+	inherit, ok := config["inherit_env"].(bool)
+	if !ok {
+		inherit = len(allowlist) == 0
+	}
+
+	var env []string
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		if inherit || envAllowed(name, baseEnv) || envAllowed(name, allowlist) {
+			env = append(env, kv)
+		}
+	}
+
+	for key, val := range stringMap(config, "env") {
+		env = append(env, key+"="+val)
+	}
+	return env
+}
+
+// envAllowed reports whether name matches one of patterns
+func envAllowed(name string, patterns []string) bool {
+	// Windows variable names are case-insensitive
+	if runtime.GOOS == "windows" {
+		name = strings.ToUpper(name)
+	}
+	for _, pattern := range patterns {
+		if runtime.GOOS == "windows" {
+			pattern = strings.ToUpper(pattern)
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == pattern {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,175 @@
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Message framings supported by the stdio transport
+const (
+	FramingNewline       = "newline"        // One JSON message per line (default)
+	FramingContentLength = "content-length" // LSP-style Content-Length headers
+)
+
+// maxFrameSize bounds a Content-Length body so a corrupt header cannot
+// trigger an arbitrarily large allocation
+const maxFrameSize = 64 * 1024 * 1024
+
+// framingFromConfig returns the configured framing, defaulting to newline
+func framingFromConfig(config map[string]interface{}) (string, error) {
+	framing, _ := config["framing"].(string)
+	switch framing {
+	case "":
+		return FramingNewline, nil
+	case FramingNewline, FramingContentLength:
+		return framing, nil
+	}
+	return "", fmt.Errorf("invalid framing %q (must be %q or %q)", framing, FramingNewline, FramingContentLength)
+}
+
+// writeFrame writes a single message using the given framing
+func writeFrame(w io.Writer, framing string, data []byte) error {
+	if framing == FramingContentLength {
+		frame := make([]byte, 0, len(data)+32)
+		frame = fmt.Appendf(frame, "Content-Length: %d\r\n\r\n", len(data))
+		_, err := w.Write(append(frame, data...))
+		return err
+	}
+
+	_, err := w.Write(append(data, '\n'))
+	return err
+}
+
+// readFrame reads the next message using the given framing
+func readFrame(r *bufio.Reader, framing string) ([]byte, error) {
+	if framing == FramingContentLength {
+		return readContentLengthFrame(r)
+	}
+	return r.ReadBytes('\n')
+}
+
+// readFramePrefix reads the next message using the given framing, or only
+// its first bytes when it is longer than the limit returned once the message
+// starts arriving. The rest of a message cut short is returned as a reader,
+// which must be read to the end before the next message. A limit of 0 reads
+// every message whole.
+func readFramePrefix(r *bufio.Reader, framing string, limit func() int) ([]byte, io.Reader, error) {
+	if framing == FramingContentLength {
+		length, err := readContentLength(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		size := length
+		if n := limit(); n > 0 && n < length {
+			size = n
+		}
+		body := make([]byte, size)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return nil, nil, err
+		}
+		if size < length {
+			return body, io.LimitReader(r, int64(length-size)), nil
+		}
+		return body, nil, nil
+	}
+
+	var msg []byte
+	for {
+		line, err := r.ReadSlice('\n')
+		msg = append(msg, line...)
+		if err == nil {
+			return msg, nil, nil
+		}
+		if err != bufio.ErrBufferFull {
+			return nil, nil, err
+		}
+		if n := limit(); n > 0 && len(msg) >= n {
+			return msg, &lineReader{r: r}, nil
+		}
+	}
+}
+
+// lineReader reads the rest of a line, up to and including its newline
+type lineReader struct {
+	r    *bufio.Reader
+	done bool
+}
+
+// Read reads from the line, returning io.EOF once its newline was read
+func (l *lineReader) Read(p []byte) (int, error) {
+	if l.done {
+		return 0, io.EOF
+	}
+	buffered, err := l.r.Peek(max(1, min(len(p), l.r.Buffered())))
+	if len(buffered) == 0 {
+		return 0, err
+	}
+	if i := bytes.IndexByte(buffered, '\n'); i >= 0 {
+		buffered = buffered[:i+1]
+		l.done = true
+	}
+	n := copy(p, buffered)
+	_, _ = l.r.Discard(n)
+	return n, nil
+}
+
+// readContentLengthFrame reads header lines up to the blank separator line and
+// then exactly Content-Length bytes of body. Other headers are ignored.
+func readContentLengthFrame(r *bufio.Reader) ([]byte, error) {
+	length, err := readContentLength(r)
+	if err != nil {
+		return nil, err
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// readContentLength reads header lines up to the blank separator line and
+// returns the length of the body that follows
+func readContentLength(r *bufio.Reader) (int, error) {
+	length := -1
+	sawHeader := false
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return 0, err
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			if length >= 0 {
+				break
+			}
+			if sawHeader {
+				return 0, fmt.Errorf("frame is missing Content-Length")
+			}
+			// Tolerate stray blank lines between messages
+			continue
+		}
+		sawHeader = true
+
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return 0, fmt.Errorf("malformed frame header %q", line)
+		}
+		if strings.EqualFold(strings.TrimSpace(name), "Content-Length") {
+			n, err := strconv.Atoi(strings.TrimSpace(value))
+			if err != nil || n < 0 {
+				return 0, fmt.Errorf("invalid Content-Length %q", value)
+			}
+			if n > maxFrameSize {
+				return 0, fmt.Errorf("frame of %d bytes exceeds limit of %d", n, maxFrameSize)
+			}
+			length = n
+		}
+	}
+	return length, nil
+}
@@ -0,0 +1,134 @@
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/rand"
+	"reflect"
+	"testing"
+	"testing/quick"
+)
+
+func FuzzReadContentLengthFrame(f *testing.F) {
+	f.Add([]byte("Content-Length: 2\r\n\r\n{}"))
+	f.Add([]byte("Content-Length: 2\r\nContent-Type: application/json\r\n\r\n{}Content-Length: 0\r\n\r\n"))
+	f.Add([]byte("\r\n\r\ncontent-length:3\n\n[1]"))
+	f.Add([]byte("Content-Length: 99999999999\r\n\r\n"))
+	f.Add([]byte("Content-Length: -1\r\n\r\n"))
+	f.Add([]byte("no colon\r\n\r\n"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		reader := bufio.NewReader(bytes.NewReader(data))
+		for i := 0; i <= len(data); i++ {
+			msg, err := readFrame(reader, FramingContentLength)
+			if err != nil {
+				return
+			}
+			if len(msg) > len(data) {
+				t.Fatalf("frame of %d bytes read from %d bytes of input", len(msg), len(data))
+			}
+		}
+		t.Fatal("reader did not make progress")
+	})
+}
+
+func FuzzFramingRoundTrip(f *testing.F) {
+	f.Add([]byte(`{"jsonrpc":"2.0","id":1,"result":{}}`))
+	f.Add([]byte(" \r\n"))
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, body []byte) {
+		for _, framing := range []string{FramingNewline, FramingContentLength} {
+			if framing == FramingNewline && bytes.IndexByte(body, '\n') >= 0 {
+				// Newline framing cannot carry raw newlines, and JSON never needs them
+				continue
+			}
+
+			var buf bytes.Buffer
+			if err := writeFrame(&buf, framing, append([]byte(nil), body...)); err != nil {
+				t.Fatalf("%s: writeFrame failed: %v", framing, err)
+			}
+
+			got, err := readFrame(bufio.NewReader(&buf), framing)
+			if err != nil {
+				t.Fatalf("%s: readFrame failed: %v", framing, err)
+			}
+			if framing == FramingNewline {
+				got = bytes.TrimSuffix(got, []byte("\n"))
+			}
+			if !bytes.Equal(got, body) {
+				t.Fatalf("%s: round trip changed %q to %q", framing, body, got)
+			}
+		}
+	})
+}
+
+func FuzzPendingDeliver(f *testing.F) {
+	f.Add([]byte(`{"jsonrpc":"2.0","id":1,"result":{}}`))
+	f.Add([]byte(`{"jsonrpc":"2.0","id":"1","error":{"code":-32603,"message":"x"}}`))
+	f.Add([]byte(`{"id":{"nested":true}}`))
+	f.Add([]byte(`not json`))
+
+	f.Fuzz(func(t *testing.T, msg []byte) {
+		pending := &pendingRequests{}
+		_, _, respChan, err := pending.register(context.Background(), []byte(`{"jsonrpc":"2.0","id":"caller","method":"ping"}`))
+		if err != nil {
+			t.Fatalf("register failed: %v", err)
+		}
+
+		if !pending.deliver(msg) {
+			return
+		}
+
+		// Whatever the upstream sent, the caller gets its own id back
+		var resp map[string]interface{}
+		if err := json.Unmarshal(<-respChan, &resp); err != nil {
+			t.Fatalf("delivered message is not JSON: %v", err)
+		}
+		if resp["id"] != "caller" {
+			t.Fatalf("expected caller id, got %#v", resp["id"])
+		}
+	})
+}
+
+func TestPendingRequests_PreservesIDProperty(t *testing.T) {
+	pending := &pendingRequests{}
+
+	property := func(numericID int64, stringID string, useString bool) bool {
+		var id interface{} = numericID
+		if useString {
+			id = stringID
+		}
+
+		request, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": id, "method": "ping"})
+		rewritten, _, respChan, err := pending.register(context.Background(), request)
+		if err != nil {
+			t.Logf("register failed: %v", err)
+			return false
+		}
+
+		// The upstream answers with the id it was sent
+		var sent struct {
+			ID json.RawMessage `json:"id"`
+		}
+		if err := json.Unmarshal(rewritten, &sent); err != nil {
+			return false
+		}
+		response := []byte(`{"jsonrpc":"2.0","id":` + string(sent.ID) + `,"result":{}}`)
+		if !pending.deliver(response) {
+			return false
+		}
+
+		var got, want map[string]interface{}
+		_ = json.Unmarshal(<-respChan, &got)
+		_ = json.Unmarshal(request, &want)
+		return reflect.DeepEqual(got["id"], want["id"])
+	}
+
+	config := &quick.Config{MaxCount: 500, Rand: rand.New(rand.NewSource(1))}
+	if err := quick.Check(property, config); err != nil {
+		t.Error(err)
+	}
+}
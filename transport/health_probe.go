@@ -0,0 +1,79 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/j4ng5y/mcpgate/logging"
+)
+
+// HealthProber is implemented by transports that can check their upstream
+// with a request of their own, outside the MCP session
+type HealthProber interface {
+	// Probe fails unless the upstream answers its health probe as expected
+	Probe(ctx context.Context) error
+}
+
+// healthProbe is a request whose answer tells whether an HTTP upstream is up
+type healthProbe struct {
+	path   string
+	method string
+	status int // Expected status; zero accepts any 2xx
+}
+
+// healthProbeFromConfig reads the "health_probe" map, returning nil when no
+// probe is configured
+func healthProbeFromConfig(config map[string]interface{}) *healthProbe {
+	probeConfig, ok := config["health_probe"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	probe := &healthProbe{path: "/health", method: http.MethodGet}
+	if path, ok := probeConfig["path"].(string); ok && path != "" {
+		probe.path = path
+	}
+	if method, ok := probeConfig["method"].(string); ok && method != "" {
+		probe.method = strings.ToUpper(method)
+	}
+	if status, ok := probeConfig["expected_status"].(int); ok {
+		probe.status = status
+	}
+	return probe
+}
+
+// check sends the probe to baseURL and reports an unexpected answer as an error
+func (p *healthProbe) check(ctx context.Context, client *http.Client, tokens *oauth2TokenSource, headers http.Header, baseURL string) error {
+	resp, err := doAuthorized(client, tokens, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, p.method, baseURL+p.path, nil)
+		if err != nil {
+			return nil, err
+		}
+		applyHeaders(req, headers)
+		return req, nil
+	})
+	if err != nil {
+		return fmt.Errorf("health probe failed: %w", err)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if err := resp.Body.Close(); err != nil {
+		slog.WarnContext(ctx, "Error closing response body", logging.Err(err))
+	}
+
+	if !p.accepts(resp.StatusCode) {
+		return fmt.Errorf("health probe %s %s answered with status %d", p.method, p.path, resp.StatusCode)
+	}
+	return nil
+}
+
+// accepts reports whether status is the answer the probe expects
+func (p *healthProbe) accepts(status int) bool {
+	if p.status != 0 {
+		return status == p.status
+	}
+	return status >= 200 && status < 300
+}
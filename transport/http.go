@@ -6,20 +6,30 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"sync"
 	"time"
+
+	"github.com/j4ng5y/mcpgate/logging"
+	"github.com/j4ng5y/mcpgate/tracing"
 )
 
 // HTTPTransport communicates with a remote MCP server via HTTP
 type HTTPTransport struct {
+	connMetrics
+
 	config    map[string]interface{}
 	client    *http.Client
 	baseURL   string
+	session   mcpSession
 	mutex     sync.RWMutex
 	connected bool
 	timeout   time.Duration
+	headers   http.Header
+	tokens    *oauth2TokenSource
+	retry     retryPolicy
+	probe     *healthProbe
 }
 
 // Connect establishes an HTTP connection (validates connectivity)
@@ -43,18 +53,26 @@ func (t *HTTPTransport) Connect(ctx context.Context) error {
 
 	t.baseURL = url
 	t.timeout = time.Duration(timeoutSec) * time.Second
-	t.client = &http.Client{
-		Timeout: t.timeout,
-	}
-
-	// Test connectivity
-	req, err := http.NewRequestWithContext(ctx, "GET", t.baseURL+"/health", nil)
-	if err == nil {
-		resp, err := t.client.Do(req)
-		if err == nil {
-			if err := resp.Body.Close(); err != nil {
-				log.Printf("Error closing response body: %v", err)
-			}
+	t.headers = requestHeaders(t.config)
+	client, err := newHTTPClient(t.config, t.timeout)
+	if err != nil {
+		return err
+	}
+	t.client = client
+
+	tokens, err := newOAuth2TokenSource(t.config, t.client)
+	if err != nil {
+		return err
+	}
+	t.tokens = tokens
+	t.retry = retryPolicyFromConfig(t.config)
+	t.session.reset()
+
+	// A configured health probe must pass before the upstream counts as reachable
+	t.probe = healthProbeFromConfig(t.config)
+	if t.probe != nil {
+		if err := t.probe.check(ctx, t.client, t.tokens, t.headers, t.baseURL); err != nil {
+			return err
 		}
 	}
 
@@ -62,6 +80,22 @@ func (t *HTTPTransport) Connect(ctx context.Context) error {
 	return nil
 }
 
+// Probe sends the configured health probe
+func (t *HTTPTransport) Probe(ctx context.Context) error {
+	t.mutex.RLock()
+	probe := t.probe
+	client := t.client
+	tokens := t.tokens
+	headers := t.headers
+	baseURL := t.baseURL
+	t.mutex.RUnlock()
+
+	if probe == nil || client == nil {
+		return fmt.Errorf("no health probe configured")
+	}
+	return probe.check(ctx, client, tokens, headers, baseURL)
+}
+
 // Disconnect closes the HTTP connection
 func (t *HTTPTransport) Disconnect(ctx context.Context) error {
 	t.mutex.Lock()
@@ -75,38 +109,86 @@ func (t *HTTPTransport) Disconnect(ctx context.Context) error {
 }
 
 // SendRequest sends a JSON-RPC request via HTTP POST
-func (t *HTTPTransport) SendRequest(ctx context.Context, request interface{}) (json.RawMessage, error) {
-	t.mutex.RLock()
-	if !t.connected {
-		t.mutex.RUnlock()
+func (t *HTTPTransport) SendRequest(ctx context.Context, request interface{}) (_ json.RawMessage, err error) {
+	defer t.finish(time.Now(), &err)
+
+	if !t.IsConnected() {
 		return nil, fmt.Errorf("not connected")
 	}
-	baseURL := t.baseURL
-	client := t.client
-	t.mutex.RUnlock()
 
 	data, err := json.Marshal(request)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", baseURL+"/rpc", bytes.NewReader(data))
+	return t.session.send(ctx, data, t.post)
+}
+
+// SendNotification POSTs a notification in the current session. Any body
+// the server answers with is discarded.
+func (t *HTTPTransport) SendNotification(ctx context.Context, notification interface{}) error {
+	if !t.IsConnected() {
+		return fmt.Errorf("not connected")
+	}
+
+	data, err := json.Marshal(notification)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return fmt.Errorf("failed to marshal notification: %w", err)
 	}
 
-	req.Header.Set("Content-Type", "application/json")
+	_, err = t.session.send(ctx, data, t.post)
+	return err
+}
 
-	resp, err := client.Do(req)
+// post sends one message, carrying the Mcp-Session-Id the server issued
+func (t *HTTPTransport) post(ctx context.Context, data []byte, sessionID string) (json.RawMessage, error) {
+	t.mutex.RLock()
+	baseURL := t.baseURL
+	client := t.client
+	headers := t.headers
+	tokens := t.tokens
+	retry := t.retry
+	t.mutex.RUnlock()
+
+	newRequest := func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", baseURL+"/rpc", bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		applyHeaders(req, headers)
+		tracing.Inject(ctx, req.Header)
+		req.Header.Set("Content-Type", "application/json")
+		if sessionID != "" {
+			req.Header.Set(SessionHeader, sessionID)
+		}
+		return req, nil
+	}
+
+	resp, err := doWithRetry(ctx, retry, func() (*http.Response, error) {
+		return doAuthorized(client, tokens, newRequest)
+	})
 	if err != nil {
-		return nil, fmt.Errorf("http request failed: %w", err)
+		return nil, err
 	}
+	t.sent(len(data))
 	defer func() {
 		if err := resp.Body.Close(); err != nil {
-			log.Printf("Error closing response body: %v", err)
+			slog.WarnContext(ctx, "Error closing response body", logging.Err(err))
 		}
 	}()
 
+	if id := resp.Header.Get(SessionHeader); id != "" {
+		t.session.set(id)
+	}
+
+	if resp.StatusCode == http.StatusNotFound && sessionID != "" {
+		t.session.expire(sessionID)
+		return nil, fmt.Errorf("session %s: %w", sessionID, errSessionExpired)
+	}
+	if resp.StatusCode == http.StatusAccepted {
+		// Notifications are acknowledged without a body
+		return nil, nil
+	}
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
 		body, _ := io.ReadAll(resp.Body)
 		return nil, fmt.Errorf("http error %d: %s", resp.StatusCode, string(body))
@@ -116,6 +198,7 @@ func (t *HTTPTransport) SendRequest(ctx context.Context, request interface{}) (j
 	if err != nil {
 		return nil, fmt.Errorf("failed to read response: %w", err)
 	}
+	t.received(len(body))
 
 	return json.RawMessage(body), nil
 }
@@ -0,0 +1,65 @@
+package transport
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Metrics is a snapshot of a transport's traffic since it was created
+type Metrics struct {
+	BytesSent     int64         // Bytes of JSON-RPC messages written
+	BytesReceived int64         // Bytes of JSON-RPC messages read, notifications included
+	Requests      int64         // Messages sent through SendRequest
+	Errors        int64         // SendRequest calls that returned an error
+	Dropped       int64         // Responses discarded because the response buffer overflowed
+	LastLatency   time.Duration // Duration of the most recent SendRequest
+}
+
+// MetricsSource is implemented by transports that count their traffic
+type MetricsSource interface {
+	// Metrics returns the transport's current counters
+	Metrics() Metrics
+}
+
+// connMetrics holds a transport's traffic counters. Transports embed it and
+// so implement MetricsSource; the counters survive reconnects.
+type connMetrics struct {
+	bytesSent     atomic.Int64
+	bytesReceived atomic.Int64
+	requests      atomic.Int64
+	errors        atomic.Int64
+	dropped       atomic.Int64
+	lastLatency   atomic.Int64
+}
+
+// Metrics returns the current counters
+func (m *connMetrics) Metrics() Metrics {
+	return Metrics{
+		BytesSent:     m.bytesSent.Load(),
+		BytesReceived: m.bytesReceived.Load(),
+		Requests:      m.requests.Load(),
+		Errors:        m.errors.Load(),
+		Dropped:       m.dropped.Load(),
+		LastLatency:   time.Duration(m.lastLatency.Load()),
+	}
+}
+
+// sent counts n bytes written to the upstream
+func (m *connMetrics) sent(n int) {
+	m.bytesSent.Add(int64(n))
+}
+
+// received counts n bytes read from the upstream
+func (m *connMetrics) received(n int) {
+	m.bytesReceived.Add(int64(n))
+}
+
+// finish records a SendRequest call that started at start; call it deferred
+// with a pointer to the named error result
+func (m *connMetrics) finish(start time.Time, err *error) {
+	m.requests.Add(1)
+	if *err != nil {
+		m.errors.Add(1)
+	}
+	m.lastLatency.Store(int64(time.Since(start)))
+}
@@ -0,0 +1,183 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/j4ng5y/mcpgate/logging"
+)
+
+// tokenExpiryLeeway refreshes tokens slightly before they expire
+const tokenExpiryLeeway = 30 * time.Second
+
+// oauth2TokenSource fetches and caches access tokens using the OAuth2
+// client-credentials grant
+type oauth2TokenSource struct {
+	tokenURL     string
+	clientID     string
+	clientSecret string
+	scopes       []string
+	audience     string
+	client       *http.Client
+
+	mutex  sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// newOAuth2TokenSource builds a token source from the "oauth2" config map.
+// It returns nil when no OAuth2 configuration is present.
+func newOAuth2TokenSource(config map[string]interface{}, client *http.Client) (*oauth2TokenSource, error) {
+	oauthConfig, ok := config["oauth2"].(map[string]interface{})
+	if !ok || len(oauthConfig) == 0 {
+		return nil, nil
+	}
+
+	source := &oauth2TokenSource{client: client}
+	source.tokenURL, _ = oauthConfig["token_url"].(string)
+	source.clientID, _ = oauthConfig["client_id"].(string)
+	source.clientSecret, _ = oauthConfig["client_secret"].(string)
+	source.audience, _ = oauthConfig["audience"].(string)
+	source.clientSecret = os.ExpandEnv(source.clientSecret)
+
+	switch scopes := oauthConfig["scopes"].(type) {
+	case []string:
+		source.scopes = scopes
+	case []interface{}:
+		for _, scope := range scopes {
+			if s, ok := scope.(string); ok {
+				source.scopes = append(source.scopes, s)
+			}
+		}
+	}
+
+	if source.tokenURL == "" || source.clientID == "" {
+		return nil, fmt.Errorf("oauth2 requires 'token_url' and 'client_id'")
+	}
+
+	return source, nil
+}
+
+// Token returns a valid access token, fetching a new one when needed
+func (s *oauth2TokenSource) Token(ctx context.Context) (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.token != "" && time.Now().Add(tokenExpiryLeeway).Before(s.expiry) {
+		return s.token, nil
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	if len(s.scopes) > 0 {
+		form.Set("scope", strings.Join(s.scopes, " "))
+	}
+	if s.audience != "" {
+		form.Set("audience", s.audience)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(s.clientID), url.QueryEscape(s.clientSecret))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("token request failed: %w", err)
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			slog.Warn("Error closing response body", logging.Err(err))
+		}
+	}()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint returned %d: %s", resp.StatusCode, string(body))
+	}
+
+	var tokenResp struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &tokenResp); err != nil {
+		return "", fmt.Errorf("failed to parse token response: %w", err)
+	}
+	if tokenResp.AccessToken == "" {
+		return "", fmt.Errorf("token response has no access_token")
+	}
+
+	s.token = tokenResp.AccessToken
+	s.expiry = time.Now().Add(time.Hour)
+	if tokenResp.ExpiresIn > 0 {
+		s.expiry = time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second)
+	}
+
+	return s.token, nil
+}
+
+// Invalidate discards the cached token so the next call fetches a new one
+func (s *oauth2TokenSource) Invalidate() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.token = ""
+	s.expiry = time.Time{}
+}
+
+// authorize sets the bearer token on an outgoing request
+func (s *oauth2TokenSource) authorize(req *http.Request) error {
+	token, err := s.Token(req.Context())
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+// doAuthorized sends the request built by newRequest, attaching an OAuth2
+// bearer token when tokens is set. A 401 invalidates the cached token and the
+// request is retried once with a freshly fetched one.
+func doAuthorized(client *http.Client, tokens *oauth2TokenSource, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := newRequest()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+
+		if tokens != nil {
+			if err := tokens.authorize(req); err != nil {
+				return nil, fmt.Errorf("failed to obtain oauth2 token: %w", err)
+			}
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("http request failed: %w", err)
+		}
+
+		if resp.StatusCode != http.StatusUnauthorized || tokens == nil || attempt > 0 {
+			return resp, nil
+		}
+
+		if err := resp.Body.Close(); err != nil {
+			slog.Warn("Error closing response body", logging.Err(err))
+		}
+		tokens.Invalidate()
+	}
+}
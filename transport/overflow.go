@@ -0,0 +1,76 @@
+package transport
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+)
+
+// Overflow policies for when responses arrive faster than they are consumed
+const (
+	OverflowBlock      = "block"       // Stop reading until there is room (default)
+	OverflowDropOldest = "drop-oldest" // Discard the oldest buffered response
+	OverflowError      = "error"       // Fail the connection so it can be re-established
+)
+
+// DefaultResponseBuffer is how many responses are buffered by default
+const DefaultResponseBuffer = 100
+
+// errResponseOverflow fails a connection whose response buffer overflowed
+var errResponseOverflow = errors.New("response buffer overflow")
+
+// responseBufferFromConfig reads response_buffer and overflow_policy
+func responseBufferFromConfig(config map[string]interface{}) (int, string, error) {
+	size := DefaultResponseBuffer
+	if n, ok := config["response_buffer"].(int); ok && n > 0 {
+		size = n
+	}
+
+	policy, _ := config["overflow_policy"].(string)
+	switch policy {
+	case "":
+		policy = OverflowBlock
+	case OverflowBlock, OverflowDropOldest, OverflowError:
+	default:
+		return 0, "", fmt.Errorf("invalid overflow_policy %q (must be %q, %q or %q)",
+			policy, OverflowBlock, OverflowDropOldest, OverflowError)
+	}
+	return size, policy, nil
+}
+
+// enqueueResponse buffers msg for the waiting request according to policy.
+// It gives up without error once done is closed.
+func (m *connMetrics) enqueueResponse(ch chan json.RawMessage, msg json.RawMessage, policy string, done <-chan struct{}) error {
+	select {
+	case ch <- msg:
+		return nil
+	default:
+	}
+
+	switch policy {
+	case OverflowDropOldest:
+		for {
+			select {
+			case <-ch:
+				m.dropped.Add(1)
+				slog.Warn("Response buffer full, dropped the oldest response")
+			default:
+			}
+			select {
+			case ch <- msg:
+				return nil
+			default:
+			}
+		}
+	case OverflowError:
+		m.dropped.Add(1)
+		return errResponseOverflow
+	}
+
+	select {
+	case ch <- msg:
+	case <-done:
+	}
+	return nil
+}
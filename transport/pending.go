@@ -0,0 +1,175 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+// pendingRequests correlates responses with in-flight requests by JSON-RPC id.
+// Outgoing ids are replaced with ids unique to the connection, so concurrent
+// callers that happen to reuse an id never receive each other's responses;
+// the caller's id is restored on the response. Each request remembers the
+// client session it was sent for, so a cancellation names only its own.
+type pendingRequests struct {
+	mutex   sync.Mutex
+	nextID  int64
+	waiters map[string]*pendingRequest
+}
+
+// pendingRequest is a single caller waiting for its response
+type pendingRequest struct {
+	session    string
+	originalID json.RawMessage
+	resp       chan json.RawMessage
+	stream     *ResultStream // Relays a large result, when the caller can take it
+}
+
+// register rewrites the id of msg, sent under ctx, and records a waiter for
+// its response. Messages without an id are returned unchanged with a nil
+// channel, as no response is expected.
+func (p *pendingRequests) register(ctx context.Context, msg []byte) ([]byte, string, <-chan json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(msg, &fields); err != nil {
+		return nil, "", nil, fmt.Errorf("failed to parse request: %w", err)
+	}
+
+	originalID, ok := fields["id"]
+	if !ok || string(originalID) == "null" {
+		return msg, "", nil, nil
+	}
+
+	p.mutex.Lock()
+	p.nextID++
+	key := strconv.FormatInt(p.nextID, 10)
+	if p.waiters == nil {
+		p.waiters = make(map[string]*pendingRequest)
+	}
+	waiter := &pendingRequest{
+		session:    SessionFromContext(ctx),
+		originalID: originalID,
+		resp:       make(chan json.RawMessage, 1),
+	}
+	if stream := ResultStreamFromContext(ctx); stream != nil && string(fields["method"]) == strconv.Quote(stream.method) {
+		waiter.stream = stream
+	}
+	p.waiters[key] = waiter
+	p.mutex.Unlock()
+
+	fields["id"] = json.RawMessage(key)
+	data, err := json.Marshal(fields)
+	if err != nil {
+		p.cancel(key)
+		return nil, "", nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	return data, key, waiter.resp, nil
+}
+
+// deliver hands a response to the request waiting for its id, restoring the
+// caller's original id. It reports whether a waiter was found; messages that
+// are not responses are never delivered.
+func (p *pendingRequests) deliver(msg []byte) bool {
+	if !isResponse(msg) {
+		return false
+	}
+	key := messageID(msg)
+	if key == "" {
+		return false
+	}
+
+	p.mutex.Lock()
+	waiter, ok := p.waiters[key]
+	delete(p.waiters, key)
+	p.mutex.Unlock()
+
+	if !ok {
+		return false
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(msg, &fields); err == nil {
+		fields["id"] = waiter.originalID
+		if data, err := json.Marshal(fields); err == nil {
+			msg = data
+		}
+	}
+
+	waiter.resp <- json.RawMessage(msg)
+	return true
+}
+
+// rewriteCancellation points a notifications/cancelled message, sent under
+// ctx, at the id the cancelled request of the same session was sent upstream
+// with. Other messages, and cancellations of requests no longer in flight,
+// are returned unchanged.
+func (p *pendingRequests) rewriteCancellation(ctx context.Context, msg []byte) []byte {
+	session := SessionFromContext(ctx)
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(msg, &fields); err != nil || string(fields["method"]) != `"notifications/cancelled"` {
+		return msg
+	}
+	var params map[string]json.RawMessage
+	if err := json.Unmarshal(fields["params"], &params); err != nil || len(params["requestId"]) == 0 {
+		return msg
+	}
+
+	key := ""
+	p.mutex.Lock()
+	for k, waiter := range p.waiters {
+		if waiter.session == session && string(waiter.originalID) == string(params["requestId"]) {
+			key = k
+			break
+		}
+	}
+	p.mutex.Unlock()
+	if key == "" {
+		return msg
+	}
+
+	params["requestId"] = json.RawMessage(key)
+	data, err := json.Marshal(params)
+	if err != nil {
+		return msg
+	}
+	fields["params"] = data
+	if data, err = json.Marshal(fields); err != nil {
+		return msg
+	}
+	return data
+}
+
+// streamThreshold returns the smallest size above which a waiting request
+// takes its result streamed, or 0 when none does
+func (p *pendingRequests) streamThreshold() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	threshold := 0
+	for _, waiter := range p.waiters {
+		if waiter.stream != nil && (threshold == 0 || waiter.stream.threshold < threshold) {
+			threshold = waiter.stream.threshold
+		}
+	}
+	return threshold
+}
+
+// cancel forgets a request whose caller stopped waiting
+func (p *pendingRequests) cancel(key string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	delete(p.waiters, key)
+}
+
+// closeAll wakes every waiting caller when the connection goes away
+func (p *pendingRequests) closeAll() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for key, waiter := range p.waiters {
+		close(waiter.resp)
+		delete(p.waiters, key)
+	}
+}
@@ -0,0 +1,73 @@
+package transport
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+// processOptions are the optional settings for a spawned subprocess
+type processOptions struct {
+	cwd   string
+	uid   int // -1 keeps the gateway's user
+	gid   int // -1 keeps the gateway's group
+	umask int // -1 keeps the gateway's umask
+}
+
+// processOptionsFromConfig reads cwd, uid, gid and umask from config. umask
+// is an octal string such as "077".
+func processOptionsFromConfig(config map[string]interface{}) (processOptions, error) {
+	opts := processOptions{uid: -1, gid: -1, umask: -1}
+
+	if cwd, _ := config["cwd"].(string); cwd != "" {
+		opts.cwd = os.ExpandEnv(cwd)
+		info, err := os.Stat(opts.cwd)
+		if err != nil {
+			return opts, fmt.Errorf("invalid cwd: %w", err)
+		}
+		if !info.IsDir() {
+			return opts, fmt.Errorf("invalid cwd: %s is not a directory", opts.cwd)
+		}
+	}
+
+	if uid, ok := config["uid"].(int); ok {
+		if uid < 0 {
+			return opts, fmt.Errorf("invalid uid %d", uid)
+		}
+		opts.uid = uid
+	}
+	if gid, ok := config["gid"].(int); ok {
+		if gid < 0 {
+			return opts, fmt.Errorf("invalid gid %d", gid)
+		}
+		opts.gid = gid
+	}
+
+	if umask, _ := config["umask"].(string); umask != "" {
+		value, err := strconv.ParseUint(umask, 8, 32)
+		if err != nil || value > 0o777 {
+			return opts, fmt.Errorf("invalid umask %q (must be octal, e.g. \"077\")", umask)
+		}
+		opts.umask = int(value)
+	}
+
+	return opts, nil
+}
+
+// apply sets the working directory and credentials on cmd
+func (o processOptions) apply(cmd *exec.Cmd) error {
+	cmd.Dir = o.cwd
+	if o.uid < 0 && o.gid < 0 {
+		return nil
+	}
+	return setCredential(cmd, o.uid, o.gid)
+}
+
+// start starts cmd, with the configured umask if any
+func (o processOptions) start(cmd *exec.Cmd) error {
+	if o.umask < 0 {
+		return cmd.Start()
+	}
+	return startWithUmask(cmd, o.umask)
+}
@@ -0,0 +1,18 @@
+//go:build !unix
+
+package transport
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// setCredential is not supported on this platform
+func setCredential(cmd *exec.Cmd, uid, gid int) error {
+	return fmt.Errorf("uid and gid are only supported on Unix")
+}
+
+// startWithUmask is not supported on this platform
+func startWithUmask(cmd *exec.Cmd, umask int) error {
+	return fmt.Errorf("umask is only supported on Unix")
+}
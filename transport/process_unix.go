@@ -0,0 +1,46 @@
+//go:build unix
+
+package transport
+
+import (
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+)
+
+// umaskMutex serializes starts that change the umask. The umask is
+// process-wide, so it is swapped only for the instant the child is forked.
+var umaskMutex sync.Mutex
+
+// setCredential runs cmd as uid and gid; an unset one keeps the gateway's.
+// Switching users requires the gateway to run with sufficient privilege.
+func setCredential(cmd *exec.Cmd, uid, gid int) error {
+	if uid < 0 {
+		uid = os.Getuid()
+	}
+	if gid < 0 {
+		gid = os.Getgid()
+	}
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Credential = &syscall.Credential{
+		Uid: uint32(uid),
+		Gid: uint32(gid),
+		// Only root may drop supplementary groups
+		NoSetGroups: os.Getuid() != 0,
+	}
+	return nil
+}
+
+// startWithUmask starts cmd so that it inherits umask
+func startWithUmask(cmd *exec.Cmd, umask int) error {
+	umaskMutex.Lock()
+	defer umaskMutex.Unlock()
+
+	old := syscall.Umask(umask)
+	defer syscall.Umask(old)
+	return cmd.Start()
+}
@@ -0,0 +1,61 @@
+package transport
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// proxySchemes are the proxy URL schemes supported by the remote transports
+var proxySchemes = map[string]bool{
+	"http":    true,
+	"https":   true,
+	"socks5":  true,
+	"socks5h": true,
+}
+
+// proxyFunc returns the proxy selector for a remote transport. A per-server
+// "proxy_url" takes precedence; otherwise HTTP_PROXY, HTTPS_PROXY and
+// NO_PROXY are honored.
+func proxyFunc(config map[string]interface{}) (func(*http.Request) (*url.URL, error), error) {
+	raw, _ := config["proxy_url"].(string)
+	if raw == "" {
+		return http.ProxyFromEnvironment, nil
+	}
+
+	proxyURL, err := url.Parse(os.ExpandEnv(raw))
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy_url: %w", err)
+	}
+	if !proxySchemes[proxyURL.Scheme] || proxyURL.Host == "" {
+		return nil, fmt.Errorf("invalid proxy_url %q: must be an http, https or socks5 URL", proxyURL.Redacted())
+	}
+
+	return http.ProxyURL(proxyURL), nil
+}
+
+// newHTTPClient builds the HTTP client used by the http and streamable-http transports
+func newHTTPClient(config map[string]interface{}, timeout time.Duration) (*http.Client, error) {
+	proxy, err := proxyFunc(config)
+	if err != nil {
+		return nil, err
+	}
+
+	dial, err := dialFunc(config)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = proxy
+	if dial != nil {
+		transport.DialContext = dial
+	}
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+	}, nil
+}
@@ -0,0 +1,92 @@
+package transport
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Constructor creates a transport from its configuration map
+type Constructor func(config map[string]interface{}) (Transport, error)
+
+// constructors holds every transport compiled into this build. Optional
+// transports register themselves from init functions in files behind build
+// tags, so minimal builds leave out the code and dependencies they pull in.
+var (
+	constructorsMutex sync.RWMutex
+	constructors      = map[string]Constructor{}
+)
+
+// optionalTransports maps transports that can be compiled out to the build tag
+// that removes them, so a config naming one gets a helpful error
+var optionalTransports = map[string]string{
+	"websocket": "nowebsocket",
+	"docker":    "nodocker",
+	"ssh":       "nossh",
+}
+
+func init() {
+	register("stdio", NewStdioTransport)
+	register("http", NewHTTPTransport)
+	register("unix", NewUnixSocketTransport)
+	register("streamable-http", NewStreamableHTTPTransport)
+}
+
+// Register makes a custom transport available to Factory.Create under name,
+// so applications embedding mcpgate can add transports of their own. Servers
+// select it with `transport = "<name>"` and the constructor receives the same
+// configuration map as the built-in transports. Call it before starting the
+// manager, typically from an init function. Names already in use, including
+// those of built-in transports, are rejected.
+func Register(name string, constructor Constructor) error {
+	if name == "" {
+		return fmt.Errorf("transport name is required")
+	}
+	if constructor == nil {
+		return fmt.Errorf("transport %s: constructor is nil", name)
+	}
+
+	constructorsMutex.Lock()
+	defer constructorsMutex.Unlock()
+	if _, exists := constructors[name]; exists {
+		return fmt.Errorf("transport %s already registered", name)
+	}
+	constructors[name] = constructor
+	return nil
+}
+
+// register adds a transport constructor under name, replacing any existing one
+func register(name string, constructor Constructor) {
+	constructorsMutex.Lock()
+	defer constructorsMutex.Unlock()
+	constructors[name] = constructor
+}
+
+// lookup returns the constructor registered under name
+func lookup(name string) (Constructor, error) {
+	constructorsMutex.RLock()
+	constructor, ok := constructors[name]
+	constructorsMutex.RUnlock()
+
+	if ok {
+		return constructor, nil
+	}
+	if tag, optional := optionalTransports[name]; optional {
+		return nil, fmt.Errorf("transport type %s is not included in this build (built with -tags %s or minimal)", name, tag)
+	}
+	return nil, fmt.Errorf("unknown transport type: %s (available: %s)", name, strings.Join(Available(), ", "))
+}
+
+// Available returns the names of the transports compiled into this build
+func Available() []string {
+	constructorsMutex.RLock()
+	defer constructorsMutex.RUnlock()
+
+	names := make([]string, 0, len(constructors))
+	for name := range constructors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
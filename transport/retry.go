@@ -0,0 +1,99 @@
+package transport
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/j4ng5y/mcpgate/logging"
+)
+
+// Defaults for retrying rate-limited and unavailable responses
+const (
+	DefaultMaxRetries    = 3
+	DefaultMaxRetryDelay = 60 * time.Second
+)
+
+// retryPolicy controls how 429 and 503 responses are retried
+type retryPolicy struct {
+	maxRetries int
+	maxDelay   time.Duration
+}
+
+// retryPolicyFromConfig reads max_retries (-1 disables) and max_retry_delay
+// in seconds from config
+func retryPolicyFromConfig(config map[string]interface{}) retryPolicy {
+	policy := retryPolicy{maxRetries: DefaultMaxRetries, maxDelay: DefaultMaxRetryDelay}
+	if retries, ok := config["max_retries"].(int); ok && retries != 0 {
+		policy.maxRetries = max(retries, 0)
+	}
+	if seconds, ok := config["max_retry_delay"].(int); ok && seconds > 0 {
+		policy.maxDelay = time.Duration(seconds) * time.Second
+	}
+	return policy
+}
+
+// doWithRetry calls do and retries while the server answers 429 or 503,
+// waiting as long as Retry-After asks, or backing off exponentially from one
+// second without it. The last response is returned as is when retries run
+// out, when the server asks for longer than maxDelay, or when the wait would
+// outlast ctx.
+func doWithRetry(ctx context.Context, policy retryPolicy, do func() (*http.Response, error)) (*http.Response, error) {
+	backoff := time.Second
+	for attempt := 1; ; attempt++ {
+		resp, err := do()
+		if err != nil || !retryableStatus(resp.StatusCode) || attempt > policy.maxRetries {
+			return resp, err
+		}
+
+		delay, ok := retryAfter(resp.Header.Get("Retry-After"), time.Now())
+		if !ok {
+			delay = backoff
+			backoff *= 2
+		}
+		if delay > policy.maxDelay {
+			return resp, nil
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return resp, nil
+		}
+
+		if err := resp.Body.Close(); err != nil {
+			slog.WarnContext(ctx, "Error closing response body", logging.Err(err))
+		}
+		slog.InfoContext(ctx, "Server asked to retry", "status", resp.StatusCode, "delay", delay, "attempt", attempt, "max_retries", policy.maxRetries)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// retryableStatus reports whether a status asks the client to come back later
+func retryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable
+}
+
+// retryAfter parses a Retry-After header, given either in seconds or as an
+// HTTP date
+func retryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0), true
+	}
+	return 0, false
+}
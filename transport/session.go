@@ -0,0 +1,134 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+)
+
+// SessionHeader carries the MCP session id on HTTP requests
+const SessionHeader = "Mcp-Session-Id"
+
+// errSessionExpired reports that the server no longer recognizes the session
+var errSessionExpired = errors.New("session expired")
+
+// initializedNotification completes the handshake after a replayed initialize
+var initializedNotification = []byte(`{"jsonrpc":"2.0","method":"notifications/initialized"}`)
+
+// postFunc sends one message with the given session id. It records any
+// session id the server returns and reports a rejected session as
+// errSessionExpired.
+type postFunc func(ctx context.Context, data []byte, sessionID string) (json.RawMessage, error)
+
+// mcpSession tracks the Mcp-Session-Id issued by a remote server together
+// with the initialize request that opened it, so an expired session can be
+// re-established without the caller noticing
+type mcpSession struct {
+	mutex      sync.Mutex
+	renewMutex sync.Mutex
+	id         string
+	initialize []byte
+}
+
+// ID returns the current session id, if any
+func (s *mcpSession) ID() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.id
+}
+
+// set records the session id returned by the server
+func (s *mcpSession) set(id string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.id = id
+}
+
+// expire forgets id unless the session has already moved on
+func (s *mcpSession) expire(id string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.id == id {
+		s.id = ""
+	}
+}
+
+// reset forgets the session and its initialize request
+func (s *mcpSession) reset() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.id = ""
+	s.initialize = nil
+}
+
+// send posts data in the current session. When the server has invalidated
+// the session, the last initialize request is replayed to open a new one and
+// data is sent once more.
+func (s *mcpSession) send(ctx context.Context, data []byte, post postFunc) (json.RawMessage, error) {
+	isInitialize := messageMethod(data) == "initialize"
+	if isInitialize {
+		s.mutex.Lock()
+		s.initialize = data
+		s.mutex.Unlock()
+	}
+
+	sessionID := s.ID()
+	resp, err := post(ctx, data, sessionID)
+	if !errors.Is(err, errSessionExpired) || isInitialize {
+		return resp, err
+	}
+
+	if err := s.renew(ctx, sessionID, post); err != nil {
+		return nil, fmt.Errorf("failed to re-initialize expired session: %w", err)
+	}
+	return post(ctx, data, s.ID())
+}
+
+// renew replays the initialize handshake after expired was rejected. Requests
+// that fail together renew once; the others reuse the new session.
+func (s *mcpSession) renew(ctx context.Context, expired string, post postFunc) error {
+	s.renewMutex.Lock()
+	defer s.renewMutex.Unlock()
+
+	s.mutex.Lock()
+	current := s.id
+	initialize := s.initialize
+	s.mutex.Unlock()
+
+	if current != "" && current != expired {
+		return nil
+	}
+	if initialize == nil {
+		return fmt.Errorf("no initialize request to replay")
+	}
+
+	slog.InfoContext(ctx, "Session expired, re-initializing", "session", expired)
+	resp, err := post(ctx, initialize, "")
+	if err != nil {
+		return err
+	}
+
+	var result struct {
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(resp, &result); err == nil && result.Error != nil {
+		return fmt.Errorf("initialize failed: %s", result.Error.Message)
+	}
+
+	_, err = post(ctx, initializedNotification, s.ID())
+	return err
+}
+
+// messageMethod extracts the method of a JSON-RPC message
+func messageMethod(msg []byte) string {
+	var probe struct {
+		Method string `json:"method"`
+	}
+	_ = json.Unmarshal(msg, &probe)
+	return probe.Method
+}
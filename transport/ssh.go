@@ -0,0 +1,152 @@
+//go:build !nossh && !minimal
+
+package transport
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultSSHClient is the ssh binary used when ssh.client is unset
+const DefaultSSHClient = "ssh"
+
+func init() {
+	register("ssh", NewSSHTransport)
+}
+
+// NewSSHTransport creates a new SSH transport
+func NewSSHTransport(config map[string]interface{}) (Transport, error) {
+	return &SSHTransport{
+		StdioTransport: &StdioTransport{config: map[string]interface{}{}},
+		config:         config,
+	}, nil
+}
+
+// SSHTransport runs an upstream server's command on a remote host through
+// the system ssh client and bridges its stdio. Using the ssh binary keeps
+// ~/.ssh/config, known_hosts, agents and jump hosts working as they do in a
+// terminal.
+type SSHTransport struct {
+	*StdioTransport
+
+	config map[string]interface{}
+}
+
+// Connect opens the SSH session and starts the remote command
+func (t *SSHTransport) Connect(ctx context.Context) error {
+	if t.StdioTransport.IsConnected() {
+		return nil
+	}
+
+	stdioConfig, err := sshStdioConfig(t.config)
+	if err != nil {
+		return err
+	}
+
+	t.StdioTransport.mutex.Lock()
+	t.StdioTransport.config = stdioConfig
+	t.StdioTransport.mutex.Unlock()
+
+	return t.StdioTransport.Connect(ctx)
+}
+
+// Name returns transport type name
+func (t *SSHTransport) Name() string {
+	return "ssh"
+}
+
+// sshStdioConfig derives the stdio configuration that runs the ssh client
+func sshStdioConfig(config map[string]interface{}) (map[string]interface{}, error) {
+	sshConfig, _ := config["ssh"].(map[string]interface{})
+	host, _ := sshConfig["host"].(string)
+	if host == "" {
+		return nil, fmt.Errorf("ssh transport requires 'ssh.host' configuration")
+	}
+	command, _ := config["command"].(string)
+	if command == "" {
+		return nil, fmt.Errorf("ssh transport requires 'command' configuration")
+	}
+
+	client, _ := sshConfig["client"].(string)
+	if client == "" {
+		client = DefaultSSHClient
+	}
+
+	stdioConfig := make(map[string]interface{}, len(config))
+	for key, value := range config {
+		stdioConfig[key] = value
+	}
+	stdioConfig["command"] = client
+	stdioConfig["args"] = sshArgs(sshConfig, host, remoteCommand(config))
+	// The environment applies on the remote side, not to the local ssh client
+	delete(stdioConfig, "env")
+	return stdioConfig, nil
+}
+
+// sshArgs builds the ssh client arguments. BatchMode stops ssh from prompting
+// for passwords or host keys on a terminal nobody is watching, and -T with
+// "-e none" keeps the channel a clean byte stream.
+func sshArgs(sshConfig map[string]interface{}, host, command string) []string {
+	args := []string{"-T", "-e", "none", "-o", "BatchMode=yes"}
+
+	if port, ok := sshConfig["port"].(int); ok && port > 0 {
+		args = append(args, "-p", strconv.Itoa(port))
+	}
+	if user, _ := sshConfig["user"].(string); user != "" {
+		args = append(args, "-l", user)
+	}
+	if identity, _ := sshConfig["identity_file"].(string); identity != "" {
+		args = append(args, "-i", os.ExpandEnv(identity), "-o", "IdentitiesOnly=yes")
+	}
+	// An empty agent uses SSH_AUTH_SOCK as usual
+	if agent, _ := sshConfig["agent"].(string); agent != "" {
+		args = append(args, "-o", "IdentityAgent="+os.ExpandEnv(agent))
+	}
+	if knownHosts, _ := sshConfig["known_hosts_file"].(string); knownHosts != "" {
+		args = append(args, "-o", "UserKnownHostsFile="+os.ExpandEnv(knownHosts))
+	}
+	for _, option := range stringList(sshConfig, "options") {
+		args = append(args, "-o", option)
+	}
+
+	return append(args, "--", host, command)
+}
+
+// remoteCommand builds the shell command line run on the remote host. The
+// remote shell parses it, so every word is quoted.
+func remoteCommand(config map[string]interface{}) string {
+	var words []string
+
+	env := stringMap(config, "env")
+	if len(env) > 0 {
+		keys := make([]string, 0, len(env))
+		for key := range env {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		words = append(words, "env")
+		for _, key := range keys {
+			words = append(words, shellQuote(key+"="+env[key]))
+		}
+	}
+
+	command, _ := config["command"].(string)
+	words = append(words, shellQuote(command))
+	for _, arg := range stringList(config, "args") {
+		words = append(words, shellQuote(arg))
+	}
+	return strings.Join(words, " ")
+}
+
+// shellQuote quotes s for a POSIX shell, leaving plain words readable
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./=:,@+%") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+}
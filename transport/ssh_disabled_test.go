@@ -0,0 +1,18 @@
+//go:build nossh || minimal
+
+package transport
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTransportFactory_SSHCompiledOut(t *testing.T) {
+	_, err := NewFactory().Create("ssh", map[string]interface{}{"command": "mcp-server"})
+	if err == nil {
+		t.Fatal("Expected error when ssh is compiled out")
+	}
+	if !strings.Contains(err.Error(), "not included in this build") {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
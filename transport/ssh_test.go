@@ -0,0 +1,137 @@
+//go:build !nossh && !minimal
+
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/j4ng5y/mcpgate/internal/mcptest"
+)
+
+func TestSSHTransport_RequiresHostAndCommand(t *testing.T) {
+	tests := []map[string]interface{}{
+		{"command": "mcp-server"},
+		{"command": "mcp-server", "ssh": map[string]interface{}{"user": "deploy"}},
+		{"ssh": map[string]interface{}{"host": "example.com"}},
+	}
+
+	for _, config := range tests {
+		transport, err := NewFactory().Create("ssh", config)
+		if err != nil {
+			t.Fatalf("Failed to create ssh transport: %v", err)
+		}
+		if err := transport.Connect(context.Background()); err == nil {
+			_ = transport.Disconnect(context.Background())
+			t.Errorf("Expected error for config %v", config)
+		}
+	}
+}
+
+func TestSSHArgs(t *testing.T) {
+	sshConfig := map[string]interface{}{
+		"port":             2222,
+		"user":             "deploy",
+		"identity_file":    "/keys/id_ed25519",
+		"agent":            "none",
+		"known_hosts_file": "/keys/known_hosts",
+		"options":          []string{"ProxyJump=bastion"},
+	}
+
+	got := sshArgs(sshConfig, "build.example.com", "mcp-server --stdio")
+	want := []string{
+		"-T", "-e", "none", "-o", "BatchMode=yes",
+		"-p", "2222",
+		"-l", "deploy",
+		"-i", "/keys/id_ed25519", "-o", "IdentitiesOnly=yes",
+		"-o", "IdentityAgent=none",
+		"-o", "UserKnownHostsFile=/keys/known_hosts",
+		"-o", "ProxyJump=bastion",
+		"--", "build.example.com", "mcp-server --stdio",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("sshArgs() =\n  %v\nwant\n  %v", got, want)
+	}
+}
+
+func TestRemoteCommand_Quotes(t *testing.T) {
+	got := remoteCommand(map[string]interface{}{
+		"command": "/opt/mcp/server",
+		"args":    []string{"--root", "/srv/my files", "it's"},
+		"env":     map[string]string{"TOKEN": "a b", "DEBUG": "1"},
+	})
+	want := `env DEBUG=1 'TOKEN=a b' /opt/mcp/server --root '/srv/my files' 'it'"'"'s'`
+	if got != want {
+		t.Errorf("remoteCommand() = %s, want %s", got, want)
+	}
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+	// The remote shell must see the original words
+	out, err := exec.Command("sh", "-c", "printf '%s|' "+got[strings.Index(got, "/opt"):]).Output()
+	if err != nil {
+		t.Fatalf("sh failed: %v", err)
+	}
+	if string(out) != "/opt/mcp/server|--root|/srv/my files|it's|" {
+		t.Errorf("Remote shell saw %q", out)
+	}
+}
+
+func TestSSHTransport_BridgesStdio(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ssh client is a shell script")
+	}
+
+	// A fake client that runs the remote command locally, as sshd would
+	dir := t.TempDir()
+	fakeSSH := filepath.Join(dir, "ssh")
+	script := "#!/bin/sh\nfor arg; do last=$arg; done\nexec sh -c \"$last\"\n"
+	if err := os.WriteFile(fakeSSH, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write fake ssh: %v", err)
+	}
+
+	transport, _ := NewSSHTransport(map[string]interface{}{
+		"name":    "remote",
+		"command": "sh",
+		"args":    []string{"-c", `echo "$GREETING" >&2` + "\n" + mcptest.EchoScript},
+		"env":     map[string]string{"GREETING": "hello from remote"},
+		"ssh":     map[string]interface{}{"host": "example.com", "client": fakeSSH},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := transport.Connect(ctx); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer func() {
+		_ = transport.Disconnect(ctx)
+	}()
+
+	resp, err := transport.SendRequest(ctx, map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  "ping",
+	})
+	if err != nil {
+		t.Fatalf("SendRequest failed: %v", err)
+	}
+	var msg map[string]interface{}
+	if err := json.Unmarshal(resp, &msg); err != nil || msg["id"] != float64(1) {
+		t.Fatalf("Unexpected response %s: %v", resp, err)
+	}
+
+	waitForStderr(ctx, t, transport)
+	if tail := transport.(StderrSource).StderrTail(); tail[0] != "hello from remote" {
+		t.Errorf("Expected remote environment to be set, got stderr %v", tail)
+	}
+}
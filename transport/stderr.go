@@ -0,0 +1,82 @@
+package transport
+
+import (
+	"bytes"
+	"log/slog"
+	"sync"
+
+	"github.com/j4ng5y/mcpgate/logging"
+)
+
+// DefaultStderrLines is how many recent stderr lines a stdio transport keeps
+const DefaultStderrLines = 20
+
+// maxStderrLine caps a single buffered line so a process that never writes a
+// newline cannot grow the buffer without bound
+const maxStderrLine = 64 * 1024
+
+// StderrSource is implemented by transports that capture an upstream process's stderr
+type StderrSource interface {
+	// StderrTail returns the most recent stderr lines, oldest first
+	StderrTail() []string
+}
+
+// stderrLog is the io.Writer given to a subprocess as its stderr. Each line is
+// written to the gateway log, tagged with the server's name, and the last few
+// are kept.
+type stderrLog struct {
+	name    string
+	limit   int
+	mutex   sync.Mutex
+	partial []byte
+	lines   []string
+}
+
+// newStderrLog creates a stderr log keeping up to limit lines
+func newStderrLog(name string, limit int) *stderrLog {
+	if limit <= 0 {
+		limit = DefaultStderrLines
+	}
+	return &stderrLog{name: name, limit: limit}
+}
+
+// Write splits p into lines, logging and recording each complete one
+func (l *stderrLog) Write(p []byte) (int, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.partial = append(l.partial, p...)
+	for {
+		idx := bytes.IndexByte(l.partial, '\n')
+		if idx < 0 {
+			break
+		}
+		l.addLocked(string(bytes.TrimRight(l.partial[:idx], "\r")))
+		l.partial = l.partial[idx+1:]
+	}
+
+	if len(l.partial) > maxStderrLine {
+		l.addLocked(string(l.partial))
+		l.partial = nil
+	}
+
+	return len(p), nil
+}
+
+// addLocked logs a line and appends it, dropping the oldest once the limit is reached
+func (l *stderrLog) addLocked(line string) {
+	slog.Info(line, logging.Server(l.name), "stream", "stderr")
+
+	if len(l.lines) == l.limit {
+		copy(l.lines, l.lines[1:])
+		l.lines = l.lines[:l.limit-1]
+	}
+	l.lines = append(l.lines, line)
+}
+
+// tail returns a copy of the recorded lines
+func (l *stderrLog) tail() []string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return append([]string(nil), l.lines...)
+}
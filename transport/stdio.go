@@ -6,22 +6,39 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
-	"os"
 	"os/exec"
 	"sync"
+	"syscall"
+	"time"
+
+	"github.com/j4ng5y/mcpgate/logging"
 )
 
+// DefaultShutdownGrace is how long a subprocess gets to exit on its own after
+// stdin is closed and SIGTERM is sent, before it is killed
+const DefaultShutdownGrace = 5 * time.Second
+
+// exitWait is how long a subprocess that closed its stdout gets to exit on its
+// own before it is killed, so its exit code can be reported
+const exitWait = time.Second
+
 // StdioTransport communicates with a subprocess via stdio
 type StdioTransport struct {
-	config    map[string]interface{}
-	cmd       *exec.Cmd
-	stdin     io.WriteCloser
-	stdout    *bufio.Reader
-	mutex     sync.RWMutex
-	connected bool
-	respChan  chan json.RawMessage
-	done      chan struct{}
+	connMetrics
+
+	config        map[string]interface{}
+	cmd           *exec.Cmd
+	stdin         io.WriteCloser
+	stdout        *bufio.Reader
+	framing       string
+	mutex         sync.RWMutex
+	writeMutex    sync.Mutex
+	connected     bool
+	pending       *pendingRequests
+	done          chan struct{}
+	notifyHandler NotificationHandler
+	lostHandler   DisconnectHandler
+	stderr        *stderrLog
 }
 
 // Connect starts the subprocess and establishes communication
@@ -38,28 +55,38 @@ func (t *StdioTransport) Connect(ctx context.Context) error {
 		return fmt.Errorf("stdio transport requires 'command' configuration")
 	}
 
-	args := []string{}
-	if argsList, ok := t.config["args"].([]interface{}); ok {
-		for _, arg := range argsList {
-			if s, ok := arg.(string); ok {
-				args = append(args, s)
-			}
-		}
+	framing, err := framingFromConfig(t.config)
+	if err != nil {
+		return err
 	}
 
-	t.cmd = exec.CommandContext(ctx, command, args...)
+	procOpts, err := processOptionsFromConfig(t.config)
+	if err != nil {
+		return err
+	}
+
+	// The subprocess must outlive ctx, which only bounds connection setup
+	t.cmd = exec.Command(command, stringList(t.config, "args")...)
+
+	t.cmd.Env = subprocessEnv(t.config)
+
+	if err := procOpts.apply(t.cmd); err != nil {
+		return err
+	}
 
-	// Set up environment variables
-	t.cmd.Env = os.Environ()
-	if envMap, ok := t.config["env"].(map[string]interface{}); ok {
-		for key, val := range envMap {
-			if str, ok := val.(string); ok {
-				t.cmd.Env = append(t.cmd.Env, key+"="+str)
-			}
+	// Kept across restarts so the output of a crashed process stays visible
+	if t.stderr == nil {
+		name, _ := t.config["name"].(string)
+		if name == "" {
+			name = command
 		}
+		limit, _ := t.config["stderr_lines"].(int)
+		t.stderr = newStderrLog(name, limit)
 	}
+	t.cmd.Stderr = t.stderr
+	// A grandchild holding stderr open must not block Wait after the process exits
+	t.cmd.WaitDelay = time.Second
 
-	var err error
 	t.stdin, err = t.cmd.StdinPipe()
 	if err != nil {
 		return fmt.Errorf("failed to create stdin pipe: %w", err)
@@ -70,40 +97,53 @@ func (t *StdioTransport) Connect(ctx context.Context) error {
 		return fmt.Errorf("failed to create stdout pipe: %w", err)
 	}
 
-	if err := t.cmd.Start(); err != nil {
+	if err := procOpts.start(t.cmd); err != nil {
 		return fmt.Errorf("failed to start subprocess: %w", err)
 	}
 
 	t.stdout = bufio.NewReader(stdout)
+	t.framing = framing
 	t.connected = true
-	t.respChan = make(chan json.RawMessage, 100)
 	t.done = make(chan struct{})
+	t.pending = &pendingRequests{}
 
 	// Start reading responses in background
-	go t.readResponses()
+	go t.readResponses(t.stdout, framing, t.done, t.pending)
 
 	return nil
 }
 
-// readResponses reads JSON responses from subprocess
-func (t *StdioTransport) readResponses() {
-	defer close(t.respChan)
+// readResponses reads JSON messages in the given framing from the subprocess
+// of the connection identified by done and hands responses to the request
+// waiting for their id. Everything it reads belongs to that connection, as a
+// reconnect replaces the transport's fields while it may still be running.
+func (t *StdioTransport) readResponses(stdout *bufio.Reader, framing string, done chan struct{}, pending *pendingRequests) {
+	defer pending.closeAll()
 	for {
 		select {
-		case <-t.done:
+		case <-done:
 			return
 		default:
 		}
 
-		line, err := t.stdout.ReadBytes('\n')
+		msg, size, err := readMessage(stdout, framing, pending)
+		t.received(size)
 		if err != nil {
-			t.mutex.Lock()
-			t.connected = false
-			t.mutex.Unlock()
+			t.connectionLost(done, err)
 			return
 		}
+		if msg == nil {
+			// A large result went straight to the request waiting for it
+			continue
+		}
+
+		if t.dispatchNotification(msg) {
+			continue
+		}
 
-		t.respChan <- json.RawMessage(line)
+		if !pending.deliver(msg) {
+			logger(t.config).Warn("Dropping unmatched message from subprocess", "message", string(msg))
+		}
 	}
 }
 
@@ -120,45 +160,226 @@ func (t *StdioTransport) Disconnect(ctx context.Context) error {
 	t.connected = false
 
 	if t.cmd != nil && t.cmd.Process != nil {
-		if err := t.cmd.Process.Kill(); err != nil {
-			log.Printf("Error killing process: %v", err)
-		}
-		if err := t.cmd.Wait(); err != nil {
-			log.Printf("Error waiting for process: %v", err)
-		}
+		t.terminate(ctx)
 	}
 
 	return nil
 }
 
-// SendRequest sends a request to the subprocess
-func (t *StdioTransport) SendRequest(ctx context.Context, request interface{}) (json.RawMessage, error) {
+// terminate asks the subprocess to exit by closing stdin and sending SIGTERM,
+// giving it the grace period (bounded by ctx) to flush state before SIGKILL
+func (t *StdioTransport) terminate(ctx context.Context) {
+	grace := shutdownGrace(t.config)
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < grace {
+		grace = time.Until(deadline)
+	}
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- t.cmd.Wait()
+	}()
+
+	if grace > 0 {
+		_ = t.stdin.Close()
+		// Not supported on Windows, where closing stdin is the only request to exit
+		_ = t.cmd.Process.Signal(syscall.SIGTERM)
+
+		timer := time.NewTimer(grace)
+		defer timer.Stop()
+
+		select {
+		case <-exited:
+			return
+		case <-timer.C:
+			logger(t.config).Warn("Subprocess did not exit in time, killing it", "pid", t.cmd.Process.Pid, "grace", grace)
+		}
+	}
+
+	if err := t.cmd.Process.Kill(); err != nil {
+		logger(t.config).Warn("Error killing process", logging.Err(err))
+	}
+	if err := <-exited; err != nil {
+		logger(t.config).Warn("Error waiting for process", logging.Err(err))
+	}
+}
+
+// shutdownGrace returns the configured grace period; -1 kills immediately
+func shutdownGrace(config map[string]interface{}) time.Duration {
+	seconds, ok := config["shutdown_grace"].(int)
+	if !ok || seconds == 0 {
+		return DefaultShutdownGrace
+	}
+	if seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// SendRequest sends a request to the subprocess and waits for the response
+// carrying the same id. Requests may be sent concurrently.
+func (t *StdioTransport) SendRequest(ctx context.Context, request interface{}) (_ json.RawMessage, err error) {
+	defer t.finish(time.Now(), &err)
+
 	t.mutex.RLock()
 	if !t.connected {
 		t.mutex.RUnlock()
 		return nil, fmt.Errorf("not connected")
 	}
+	stdin := t.stdin
+	framing := t.framing
+	pending := t.pending
 	t.mutex.RUnlock()
 
-	// Send request
 	data, err := json.Marshal(request)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	if _, err := t.stdin.Write(append(data, '\n')); err != nil {
+	data, key, respChan, err := pending.register(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+
+	t.writeMutex.Lock()
+	err = writeFrame(stdin, framing, data)
+	t.writeMutex.Unlock()
+	if err != nil {
+		pending.cancel(key)
 		return nil, fmt.Errorf("failed to write to subprocess: %w", err)
 	}
+	t.sent(len(data))
+
+	// Notifications have no response to wait for
+	if respChan == nil {
+		return nil, nil
+	}
 
-	// Wait for response with timeout
 	select {
-	case resp := <-t.respChan:
+	case resp, ok := <-respChan:
+		if !ok {
+			return nil, fmt.Errorf("subprocess connection closed")
+		}
 		return resp, nil
 	case <-ctx.Done():
+		pending.cancel(key)
 		return nil, ctx.Err()
 	}
 }
 
+// SendNotification writes a notification to the subprocess. A cancellation
+// is rewritten to name the id the request was actually sent with.
+func (t *StdioTransport) SendNotification(ctx context.Context, notification interface{}) error {
+	t.mutex.RLock()
+	if !t.connected {
+		t.mutex.RUnlock()
+		return fmt.Errorf("not connected")
+	}
+	stdin := t.stdin
+	framing := t.framing
+	pending := t.pending
+	t.mutex.RUnlock()
+
+	data, err := json.Marshal(notification)
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification: %w", err)
+	}
+	data = pending.rewriteCancellation(ctx, data)
+
+	t.writeMutex.Lock()
+	err = writeFrame(stdin, framing, data)
+	t.writeMutex.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to write to subprocess: %w", err)
+	}
+	t.sent(len(data))
+	return nil
+}
+
+// SetNotificationHandler sets the handler for server-initiated notifications
+func (t *StdioTransport) SetNotificationHandler(handler NotificationHandler) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.notifyHandler = handler
+}
+
+// SetDisconnectHandler sets the handler called when the connection is lost unexpectedly
+func (t *StdioTransport) SetDisconnectHandler(handler DisconnectHandler) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.lostHandler = handler
+}
+
+// connectionLost marks the transport disconnected, reaps the subprocess and
+// reports the loss unless it was caused by Disconnect. done identifies the
+// connection that was lost, so a reader outliving its connection leaves a
+// newer one alone.
+func (t *StdioTransport) connectionLost(done chan struct{}, err error) {
+	t.mutex.Lock()
+	if t.done != done {
+		t.mutex.Unlock()
+		return
+	}
+	wasConnected := t.connected
+	t.connected = false
+	handler := t.lostHandler
+	cmd := t.cmd
+	t.mutex.Unlock()
+
+	if !wasConnected {
+		return
+	}
+
+	// Reap the subprocess so it does not linger as a zombie
+	if cmd != nil && cmd.Process != nil {
+		exited := make(chan error, 1)
+		go func() {
+			exited <- cmd.Wait()
+		}()
+
+		select {
+		case <-exited:
+		case <-time.After(exitWait):
+			_ = cmd.Process.Kill()
+			<-exited
+		}
+		if cmd.ProcessState != nil {
+			err = &ExitError{ExitCode: cmd.ProcessState.ExitCode(), Err: err}
+		}
+	}
+
+	if handler != nil {
+		handler(err)
+	}
+}
+
+// dispatchNotification hands msg to the notification handler if it is a notification
+func (t *StdioTransport) dispatchNotification(msg []byte) bool {
+	if !isNotification(msg) {
+		return false
+	}
+
+	t.mutex.RLock()
+	handler := t.notifyHandler
+	t.mutex.RUnlock()
+
+	if handler != nil {
+		handler(json.RawMessage(msg))
+	}
+	return true
+}
+
+// StderrTail returns the most recent lines the subprocess wrote to stderr
+func (t *StdioTransport) StderrTail() []string {
+	t.mutex.RLock()
+	stderr := t.stderr
+	t.mutex.RUnlock()
+
+	if stderr == nil {
+		return nil
+	}
+	return stderr.tail()
+}
+
 // IsConnected returns connection status
 func (t *StdioTransport) IsConnected() bool {
 	t.mutex.RLock()
@@ -0,0 +1,351 @@
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// streamChunkSize is the size of each chunk a streamed result is relayed in
+const streamChunkSize = 64 * 1024
+
+// ResultStream relays the result of a request from the upstream connection
+// while it is read, so a result larger than its threshold is never held whole
+// in memory. It applies to the requests sent with its method under a context
+// carrying it; the response of a request whose result was streamed carries a
+// null result in its place. The upstream reads nothing else until the result
+// is read to the end or the stream is closed, so its owner must close it.
+type ResultStream struct {
+	method    string
+	threshold int
+
+	mutex  sync.Mutex
+	reader *io.PipeReader
+	closed bool
+}
+
+// NewResultStream creates a stream for results of method larger than
+// threshold bytes
+func NewResultStream(method string, threshold int) *ResultStream {
+	return &ResultStream{method: method, threshold: threshold}
+}
+
+// resultStreamKey is the context key for the stream of a request's result
+type resultStreamKey struct{}
+
+// WithResultStream returns a context whose requests stream large results
+// through stream
+func WithResultStream(ctx context.Context, stream *ResultStream) context.Context {
+	return context.WithValue(ctx, resultStreamKey{}, stream)
+}
+
+// ResultStreamFromContext returns the stream stored in ctx, or nil
+func ResultStreamFromContext(ctx context.Context) *ResultStream {
+	stream, _ := ctx.Value(resultStreamKey{}).(*ResultStream)
+	return stream
+}
+
+// Reader returns the result being relayed, or nil when the response carried
+// its result whole
+func (s *ResultStream) Reader() io.Reader {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.reader == nil {
+		return nil
+	}
+	return s.reader
+}
+
+// Close releases the upstream connection from a result not read to the end
+func (s *ResultStream) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.closed = true
+	if s.reader != nil {
+		return s.reader.Close()
+	}
+	return nil
+}
+
+// open returns the writer the result is relayed through, or nil when the
+// stream was closed or already used
+func (s *ResultStream) open() *io.PipeWriter {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed || s.reader != nil {
+		return nil
+	}
+	reader, writer := io.Pipe()
+	s.reader = reader
+	return writer
+}
+
+// errNotStreamable reports a large message that is not a response whose id
+// comes before its result, so it is read whole instead
+var errNotStreamable = errors.New("message cannot be streamed")
+
+// responseHead finds the id of a response and where its result starts in
+// the beginning of the message. The id must come first, as it decides where
+// the result goes.
+func responseHead(prefix []byte) (id []byte, resultStart int, err error) {
+	i := skipSpace(prefix, 0)
+	if i >= len(prefix) || prefix[i] != '{' {
+		return nil, 0, errNotStreamable
+	}
+	i++
+
+	for {
+		i = skipSpace(prefix, i)
+		if i >= len(prefix) || prefix[i] != '"' {
+			return nil, 0, errNotStreamable
+		}
+		end := valueEnd(prefix, i)
+		if end < 0 {
+			return nil, 0, errNotStreamable
+		}
+		key := string(prefix[i:end])
+
+		i = skipSpace(prefix, end)
+		if i >= len(prefix) || prefix[i] != ':' {
+			return nil, 0, errNotStreamable
+		}
+		i = skipSpace(prefix, i+1)
+
+		switch key {
+		case `"result"`:
+			if id == nil {
+				return nil, 0, errNotStreamable
+			}
+			return id, i, nil
+		case `"method"`, `"error"`:
+			return nil, 0, errNotStreamable
+		}
+
+		end = valueEnd(prefix, i)
+		if end < 0 {
+			return nil, 0, errNotStreamable
+		}
+		if key == `"id"` {
+			id = prefix[i:end]
+		}
+
+		i = skipSpace(prefix, end)
+		if i >= len(prefix) || prefix[i] != ',' {
+			return nil, 0, errNotStreamable
+		}
+		i++
+	}
+}
+
+// skipSpace returns the index of the first byte from i that is not JSON
+// whitespace
+func skipSpace(data []byte, i int) int {
+	for i < len(data) && isSpace(data[i]) {
+		i++
+	}
+	return i
+}
+
+// isSpace reports whether c is JSON whitespace
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
+
+// valueEnd returns the index just past the JSON value starting at i, or -1
+// when the value does not end within data
+func valueEnd(data []byte, i int) int {
+	var scan valueScanner
+	for ; i < len(data); i++ {
+		if done, _ := scan.next(data[i]); done {
+			if scan.delimited {
+				return i
+			}
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// valueScanner finds the end of a single JSON value fed to it a byte at a
+// time
+type valueScanner struct {
+	started   bool
+	depth     int
+	inString  bool
+	escaped   bool
+	scalar    bool
+	delimited bool // The value ended at a byte that follows it
+}
+
+// next feeds c to the scanner, reporting whether the value is complete and
+// whether c belongs to it
+func (s *valueScanner) next(c byte) (done, inValue bool) {
+	if !s.started {
+		if isSpace(c) {
+			return false, false
+		}
+		s.started = true
+	}
+
+	switch {
+	case s.inString:
+		if s.escaped {
+			s.escaped = false
+		} else if c == '\\' {
+			s.escaped = true
+		} else if c == '"' {
+			s.inString = false
+			return s.depth == 0, true
+		}
+		return false, true
+	case s.scalar:
+		if isSpace(c) || c == ',' || c == '}' || c == ']' {
+			s.delimited = true
+			return true, false
+		}
+		return false, true
+	}
+
+	switch c {
+	case '"':
+		s.inString = true
+	case '{', '[':
+		s.depth++
+	case '}', ']':
+		s.depth--
+		return s.depth == 0, true
+	default:
+		if s.depth == 0 && !isSpace(c) {
+			s.scalar = true
+		}
+	}
+	return false, true
+}
+
+// copyValue copies the JSON value at the start of r to w in chunks. When w
+// fails, such as when the client stopped reading, the rest of the value is
+// still read, so the connection stays in step with the upstream.
+func copyValue(w io.Writer, r io.ByteReader) error {
+	var scan valueScanner
+	chunk := make([]byte, 0, streamChunkSize)
+	flush := func() {
+		if w != nil && len(chunk) > 0 {
+			if _, err := w.Write(chunk); err != nil {
+				w = nil
+			}
+		}
+		chunk = chunk[:0]
+	}
+
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		done, inValue := scan.next(c)
+		if inValue {
+			chunk = append(chunk, c)
+			if len(chunk) == streamChunkSize {
+				flush()
+			}
+		}
+		if done {
+			flush()
+			return nil
+		}
+	}
+}
+
+// readMessage reads the next message from an upstream connection. A result
+// larger than the waiting request's stream threshold is relayed to it while
+// it is read, and no message is returned. size counts every byte read.
+func readMessage(r *bufio.Reader, framing string, pending *pendingRequests) (msg []byte, size int, err error) {
+	msg, rest, err := readFramePrefix(r, framing, pending.streamThreshold)
+	if err != nil || rest == nil {
+		return msg, len(msg), err
+	}
+
+	counted := &countingReader{r: rest}
+	err = pending.relayResult(msg, counted)
+	if err == nil {
+		return nil, len(msg) + counted.n, nil
+	}
+	if !errors.Is(err, errNotStreamable) {
+		return nil, len(msg) + counted.n, err
+	}
+
+	tail, err := io.ReadAll(rest)
+	if err != nil {
+		return nil, len(msg) + len(tail), err
+	}
+	msg = append(msg, tail...)
+	return msg, len(msg), nil
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+// Read reads from the underlying reader
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
+
+// relayResult streams the result of a response too large to read whole to
+// the request waiting for it. prefix is the beginning of the message and
+// rest the remainder of its frame. When the response cannot be streamed it
+// returns errNotStreamable having read nothing from rest.
+func (p *pendingRequests) relayResult(prefix []byte, rest io.Reader) error {
+	id, resultStart, err := responseHead(prefix)
+	if err != nil {
+		return err
+	}
+	key := string(id)
+
+	p.mutex.Lock()
+	waiter, ok := p.waiters[key]
+	if !ok || waiter.stream == nil {
+		p.mutex.Unlock()
+		return errNotStreamable
+	}
+	delete(p.waiters, key)
+	p.mutex.Unlock()
+
+	writer := waiter.stream.open()
+	if writer != nil {
+		waiter.resp <- json.RawMessage(fmt.Sprintf(`{"jsonrpc":"2.0","id":%s,"result":null}`, waiter.originalID))
+	} else {
+		close(waiter.resp)
+	}
+
+	r := bufio.NewReaderSize(io.MultiReader(bytes.NewReader(prefix[resultStart:]), rest), streamChunkSize)
+	var dst io.Writer
+	if writer != nil {
+		dst = writer
+	}
+	if err := copyValue(dst, r); err != nil {
+		if writer != nil {
+			_ = writer.CloseWithError(err)
+		}
+		return err
+	}
+	if writer != nil {
+		_ = writer.Close()
+	}
+
+	// The rest of the frame closes the response
+	_, err = io.Copy(io.Discard, r)
+	return err
+}
@@ -0,0 +1,123 @@
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// frame encodes msg with the given framing
+func frame(framing string, msg string) string {
+	var buf bytes.Buffer
+	_ = writeFrame(&buf, framing, []byte(msg))
+	return buf.String()
+}
+
+func TestReadMessage_RelaysLargeResult(t *testing.T) {
+	text := strings.Repeat("a\\\"b ", 50000)
+	for _, framing := range []string{FramingNewline, FramingContentLength} {
+		t.Run(framing, func(t *testing.T) {
+			var pending pendingRequests
+			stream := NewResultStream("resources/read", 4096)
+			defer stream.Close()
+			_, bigKey, bigResp, _ := pending.register(WithResultStream(context.Background(), stream), []byte(`{"jsonrpc":"2.0","id":"big","method":"resources/read"}`))
+			_, smallKey, smallResp, _ := pending.register(context.Background(), []byte(`{"jsonrpc":"2.0","id":"small","method":"ping"}`))
+
+			input := frame(framing, fmt.Sprintf(`{"jsonrpc":"2.0", "id":%s, "result":{"contents":[{"text":"%s"}]}, "extra":true}`, bigKey, text)) +
+				frame(framing, fmt.Sprintf(`{"jsonrpc":"2.0","id":%s,"result":{}}`, smallKey))
+			reader := bufio.NewReader(strings.NewReader(input))
+
+			relayed := make(chan error, 1)
+			go func() {
+				msg, _, err := readMessage(reader, framing, &pending)
+				if err == nil && msg != nil {
+					err = fmt.Errorf("expected the result to be relayed, got %s", msg)
+				}
+				relayed <- err
+			}()
+
+			resp := <-bigResp
+			if string(resp) != `{"jsonrpc":"2.0","id":"big","result":null}` {
+				t.Fatalf("Expected a response with the result left out, got %s", resp)
+			}
+			result, err := io.ReadAll(stream.Reader())
+			if err != nil {
+				t.Fatalf("Failed to read the streamed result: %v", err)
+			}
+			if want := `{"contents":[{"text":"` + text + `"}]}`; string(result) != want {
+				t.Errorf("Expected the result of %d bytes, got %d bytes", len(want), len(result))
+			}
+			if err := <-relayed; err != nil {
+				t.Fatalf("Relaying failed: %v", err)
+			}
+
+			// The connection stays in step with the upstream
+			msg, _, err := readMessage(reader, framing, &pending)
+			if err != nil || !pending.deliver(msg) {
+				t.Fatalf("Expected the next response to be delivered, got %s: %v", msg, err)
+			}
+			if resp := <-smallResp; !strings.Contains(string(resp), `"small"`) {
+				t.Errorf("Unexpected response %s", resp)
+			}
+		})
+	}
+}
+
+func TestReadMessage_ClosedStreamDiscardsResult(t *testing.T) {
+	var pending pendingRequests
+	stream := NewResultStream("resources/read", 4096)
+	_, key, respChan, _ := pending.register(WithResultStream(context.Background(), stream), []byte(`{"jsonrpc":"2.0","id":1,"method":"resources/read"}`))
+	_ = stream.Close()
+
+	input := fmt.Sprintf("{\"jsonrpc\":\"2.0\",\"id\":%s,\"result\":\"%s\"}\n{\"jsonrpc\":\"2.0\",\"method\":\"ping\"}\n", key, strings.Repeat("x", 10000))
+	reader := bufio.NewReader(strings.NewReader(input))
+
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := readMessage(reader, FramingNewline, &pending)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Expected the result to be discarded, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected a closed stream not to block the connection")
+	}
+	if _, ok := <-respChan; ok {
+		t.Error("Expected the caller to be told the result is gone")
+	}
+
+	msg, _, err := readMessage(reader, FramingNewline, &pending)
+	if err != nil || !strings.Contains(string(msg), "ping") {
+		t.Errorf("Expected the next message, got %s: %v", msg, err)
+	}
+}
+
+func TestReadMessage_ReadsWholeWhenNotStreamable(t *testing.T) {
+	var pending pendingRequests
+	stream := NewResultStream("resources/read", 16)
+	defer stream.Close()
+	_, key, _, _ := pending.register(WithResultStream(context.Background(), stream), []byte(`{"jsonrpc":"2.0","id":1,"method":"resources/read"}`))
+
+	// The id comes after the result, so where the result goes is not known
+	// until it was read
+	input := fmt.Sprintf("{\"jsonrpc\":\"2.0\",\"result\":{\"text\":\"%s\"},\"id\":%s}\n", strings.Repeat("x", 1000), key)
+	msg, size, err := readMessage(bufio.NewReader(strings.NewReader(input)), FramingNewline, &pending)
+	if err != nil {
+		t.Fatalf("readMessage failed: %v", err)
+	}
+	if string(msg) != input || size != len(input) {
+		t.Errorf("Expected the whole message, got %d bytes", len(msg))
+	}
+	if !json.Valid(msg) || stream.Reader() != nil {
+		t.Error("Expected the result not to be streamed")
+	}
+}
@@ -0,0 +1,318 @@
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/j4ng5y/mcpgate/logging"
+	"github.com/j4ng5y/mcpgate/tracing"
+)
+
+// StreamableHTTPTransport implements the MCP Streamable HTTP transport: every
+// message is POSTed to a single endpoint and the server answers with either a
+// JSON body or an SSE stream carrying the response and any notifications
+type StreamableHTTPTransport struct {
+	connMetrics
+
+	config        map[string]interface{}
+	client        *http.Client
+	url           string
+	session       mcpSession
+	mutex         sync.RWMutex
+	connected     bool
+	timeout       time.Duration
+	headers       http.Header
+	tokens        *oauth2TokenSource
+	retry         retryPolicy
+	notifyHandler NotificationHandler
+}
+
+// Connect prepares the HTTP client; the session is established by initialize
+func (t *StreamableHTTPTransport) Connect(ctx context.Context) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.connected {
+		return nil
+	}
+
+	url, ok := t.config["url"].(string)
+	if !ok || url == "" {
+		return fmt.Errorf("streamable-http transport requires 'url' configuration")
+	}
+
+	timeoutSec := 30
+	if timeout, ok := t.config["timeout"].(int); ok && timeout > 0 {
+		timeoutSec = timeout
+	}
+
+	t.url = url
+	t.timeout = time.Duration(timeoutSec) * time.Second
+	t.headers = requestHeaders(t.config)
+	client, err := newHTTPClient(t.config, t.timeout)
+	if err != nil {
+		return err
+	}
+	t.client = client
+
+	tokens, err := newOAuth2TokenSource(t.config, t.client)
+	if err != nil {
+		return err
+	}
+	t.tokens = tokens
+	t.retry = retryPolicyFromConfig(t.config)
+	t.session.reset()
+	t.connected = true
+	return nil
+}
+
+// Disconnect terminates the session on the server and closes idle connections
+func (t *StreamableHTTPTransport) Disconnect(ctx context.Context) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if !t.connected {
+		return nil
+	}
+
+	if sessionID := t.session.ID(); sessionID != "" {
+		req, err := http.NewRequestWithContext(ctx, http.MethodDelete, t.url, nil)
+		if err == nil {
+			applyHeaders(req, t.headers)
+			req.Header.Set(SessionHeader, sessionID)
+			if t.tokens != nil {
+				_ = t.tokens.authorize(req)
+			}
+			if resp, err := t.client.Do(req); err == nil {
+				if err := resp.Body.Close(); err != nil {
+					slog.WarnContext(ctx, "Error closing response body", logging.Err(err))
+				}
+			}
+		}
+	}
+	t.session.reset()
+
+	t.client.CloseIdleConnections()
+	t.connected = false
+	return nil
+}
+
+// SendRequest POSTs a message and waits for the matching response. An
+// expired session is re-initialized transparently.
+func (t *StreamableHTTPTransport) SendRequest(ctx context.Context, request interface{}) (_ json.RawMessage, err error) {
+	defer t.finish(time.Now(), &err)
+
+	if !t.IsConnected() {
+		return nil, fmt.Errorf("not connected")
+	}
+
+	data, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	return t.session.send(ctx, data, t.post)
+}
+
+// SendNotification POSTs a notification in the current session. Any body
+// the server answers with is discarded.
+func (t *StreamableHTTPTransport) SendNotification(ctx context.Context, notification interface{}) error {
+	if !t.IsConnected() {
+		return fmt.Errorf("not connected")
+	}
+
+	data, err := json.Marshal(notification)
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification: %w", err)
+	}
+
+	_, err = t.session.send(ctx, data, t.post)
+	return err
+}
+
+// post sends one message in the given session
+func (t *StreamableHTTPTransport) post(ctx context.Context, data []byte, sessionID string) (json.RawMessage, error) {
+	t.mutex.RLock()
+	url := t.url
+	client := t.client
+	headers := t.headers
+	tokens := t.tokens
+	retry := t.retry
+	t.mutex.RUnlock()
+
+	newRequest := func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		applyHeaders(req, headers)
+		tracing.Inject(ctx, req.Header)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json, text/event-stream")
+		if sessionID != "" {
+			req.Header.Set(SessionHeader, sessionID)
+		}
+		return req, nil
+	}
+
+	resp, err := doWithRetry(ctx, retry, func() (*http.Response, error) {
+		return doAuthorized(client, tokens, newRequest)
+	})
+	if err != nil {
+		return nil, err
+	}
+	t.sent(len(data))
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			slog.WarnContext(ctx, "Error closing response body", logging.Err(err))
+		}
+	}()
+
+	if id := resp.Header.Get(SessionHeader); id != "" {
+		t.session.set(id)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusAccepted:
+		// Notifications and responses are acknowledged without a body
+		return nil, nil
+	case resp.StatusCode == http.StatusNotFound && sessionID != "":
+		t.session.expire(sessionID)
+		return nil, fmt.Errorf("session %s: %w", sessionID, errSessionExpired)
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("http error %d: %s", resp.StatusCode, string(body))
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType == "text/event-stream" {
+		return t.readStream(resp.Body, messageID(data))
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	t.received(len(body))
+
+	return json.RawMessage(body), nil
+}
+
+// readStream consumes an SSE response until the message answering id arrives,
+// dispatching any notifications sent before it
+func (t *StreamableHTTPTransport) readStream(body io.Reader, id string) (json.RawMessage, error) {
+	var result json.RawMessage
+	err := readSSE(body, func(_ string, data []byte) bool {
+		t.received(len(data))
+		if isNotification(data) {
+			t.mutex.RLock()
+			handler := t.notifyHandler
+			t.mutex.RUnlock()
+			if handler != nil {
+				handler(append(json.RawMessage(nil), data...))
+			}
+			return true
+		}
+
+		if isResponse(data) && messageID(data) == id {
+			result = append(json.RawMessage(nil), data...)
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read event stream: %w", err)
+	}
+	if result == nil {
+		return nil, fmt.Errorf("event stream closed before response")
+	}
+	return result, nil
+}
+
+// SessionID returns the current MCP session id, if any
+func (t *StreamableHTTPTransport) SessionID() string {
+	return t.session.ID()
+}
+
+// SetNotificationHandler sets the handler for server-initiated notifications
+func (t *StreamableHTTPTransport) SetNotificationHandler(handler NotificationHandler) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.notifyHandler = handler
+}
+
+// IsConnected returns connection status
+func (t *StreamableHTTPTransport) IsConnected() bool {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return t.connected
+}
+
+// Name returns transport type name
+func (t *StreamableHTTPTransport) Name() string {
+	return "streamable-http"
+}
+
+// readSSE parses a server-sent event stream, calling fn with the event name
+// and data of each event until fn returns false or the stream ends
+func readSSE(r io.Reader, fn func(event string, data []byte) bool) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	var event string
+	var data bytes.Buffer
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if line == "" {
+			if data.Len() > 0 {
+				if !fn(event, bytes.TrimSuffix(data.Bytes(), []byte("\n"))) {
+					return nil
+				}
+			}
+			event = ""
+			data.Reset()
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			event = value
+		case "data":
+			data.WriteString(value)
+			data.WriteByte('\n')
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if data.Len() > 0 {
+		fn(event, bytes.TrimSuffix(data.Bytes(), []byte("\n")))
+	}
+	return nil
+}
+
+// messageID extracts the JSON-RPC id of a message as a comparable string
+func messageID(msg []byte) string {
+	var probe struct {
+		ID json.RawMessage `json:"id"`
+	}
+	if err := json.Unmarshal(msg, &probe); err != nil {
+		return ""
+	}
+	return string(probe.ID)
+}
@@ -4,6 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"github.com/j4ng5y/mcpgate/logging"
 )
 
 // Transport defines the interface for communication with upstream MCP servers
@@ -17,6 +22,10 @@ type Transport interface {
 	// SendRequest sends a JSON-RPC request and waits for response
 	SendRequest(ctx context.Context, request interface{}) (json.RawMessage, error)
 
+	// SendNotification sends a JSON-RPC notification without waiting, as
+	// notifications have no response
+	SendNotification(ctx context.Context, notification interface{}) error
+
 	// IsConnected returns whether the transport is currently connected
 	IsConnected() bool
 
@@ -24,6 +33,172 @@ type Transport interface {
 	Name() string
 }
 
+// sessionKey is the context key for the client session a request is sent for
+type sessionKey struct{}
+
+// WithSession returns a context whose requests are sent on behalf of the
+// client session id. Clients of one upstream reuse the same request ids, so a
+// cancellation only names a request sent for its own session.
+func WithSession(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, sessionKey{}, id)
+}
+
+// SessionFromContext returns the session stored in ctx, or ""
+func SessionFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(sessionKey{}).(string)
+	return id
+}
+
+// NotificationHandler receives JSON-RPC notifications sent by an upstream server
+type NotificationHandler func(notification json.RawMessage)
+
+// NotificationSource is implemented by transports that can receive
+// server-initiated notifications in addition to responses
+type NotificationSource interface {
+	// SetNotificationHandler sets the handler for incoming notifications
+	SetNotificationHandler(handler NotificationHandler)
+}
+
+// isNotification reports whether a raw message is a JSON-RPC notification (a method without an id)
+func isNotification(msg []byte) bool {
+	var probe struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+	}
+	if err := json.Unmarshal(msg, &probe); err != nil {
+		return false
+	}
+	return probe.Method != "" && len(probe.ID) == 0
+}
+
+// isResponse reports whether a raw message is a JSON-RPC response: an id
+// with a result or error and no method. A request the upstream sends itself,
+// such as ping, also carries an id that may collide with the gateway's.
+func isResponse(msg []byte) bool {
+	var probe struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+		Result json.RawMessage `json:"result"`
+		Error  json.RawMessage `json:"error"`
+	}
+	if err := json.Unmarshal(msg, &probe); err != nil {
+		return false
+	}
+	return probe.Method == "" && len(probe.ID) > 0 && (len(probe.Result) > 0 || len(probe.Error) > 0)
+}
+
+// DisconnectHandler is called when a transport loses its connection without
+// Disconnect having been called, e.g. because the upstream process exited
+type DisconnectHandler func(err error)
+
+// ExitError is reported to the DisconnectHandler when the upstream subprocess
+// exited. ExitCode is -1 when the process was killed by a signal.
+type ExitError struct {
+	ExitCode int
+	Err      error // Why the connection was seen to drop, usually io.EOF
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("subprocess exited with code %d: %v", e.ExitCode, e.Err)
+}
+
+// Unwrap returns the underlying connection error
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// DisconnectSource is implemented by transports that can report an unexpected loss of connection
+type DisconnectSource interface {
+	SetDisconnectHandler(handler DisconnectHandler)
+}
+
+// requestHeaders builds the headers configured for remote transports from the
+// "headers" map and "auth_token". Values may reference environment variables.
+func requestHeaders(config map[string]interface{}) http.Header {
+	headers := http.Header{}
+
+	switch h := config["headers"].(type) {
+	case map[string]string:
+		for key, value := range h {
+			headers.Set(key, os.ExpandEnv(value))
+		}
+	case map[string]interface{}:
+		for key, value := range h {
+			if str, ok := value.(string); ok {
+				headers.Set(key, os.ExpandEnv(str))
+			}
+		}
+	}
+
+	if token, ok := config["auth_token"].(string); ok && token != "" && headers.Get("Authorization") == "" {
+		headers.Set("Authorization", "Bearer "+os.ExpandEnv(token))
+	}
+
+	return headers
+}
+
+// stringList reads a list of strings from config, accepting both the
+// []string built from ServerConfig and the []interface{} decoded from TOML
+func stringList(config map[string]interface{}, key string) []string {
+	switch list := config[key].(type) {
+	case []string:
+		return append([]string(nil), list...)
+	case []interface{}:
+		values := make([]string, 0, len(list))
+		for _, item := range list {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// stringMap reads a string map from config, accepting both map[string]string
+// and map[string]interface{}
+func stringMap(config map[string]interface{}, key string) map[string]string {
+	switch m := config[key].(type) {
+	case map[string]string:
+		values := make(map[string]string, len(m))
+		for k, v := range m {
+			values[k] = v
+		}
+		return values
+	case map[string]interface{}:
+		values := make(map[string]string, len(m))
+		for k, v := range m {
+			if s, ok := v.(string); ok {
+				values[k] = s
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// applyHeaders copies configured headers onto an outgoing request
+func applyHeaders(req *http.Request, headers http.Header) {
+	for key, values := range headers {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+}
+
+// logger returns the logger for records about the server a transport
+// connects to, named in its configuration
+func logger(config map[string]interface{}) *slog.Logger {
+	name, _ := config["name"].(string)
+	if name == "" {
+		return slog.Default()
+	}
+	return slog.Default().With(logging.KeyServer, name)
+}
+
 // Factory creates transports based on type
 type Factory struct{}
 
@@ -32,20 +207,13 @@ func NewFactory() *Factory {
 	return &Factory{}
 }
 
-// Create creates a new transport instance
+// Create creates a new transport instance from the registered constructors
 func (f *Factory) Create(transportType string, config map[string]interface{}) (Transport, error) {
-	switch transportType {
-	case "stdio":
-		return NewStdioTransport(config)
-	case "http":
-		return NewHTTPTransport(config)
-	case "websocket":
-		return NewWebSocketTransport(config)
-	case "unix":
-		return NewUnixSocketTransport(config)
-	default:
-		return nil, fmt.Errorf("unknown transport type: %s", transportType)
+	constructor, err := lookup(transportType)
+	if err != nil {
+		return nil, err
 	}
+	return constructor(config)
 }
 
 // NewStdioTransport creates a new stdio transport
@@ -62,16 +230,16 @@ func NewHTTPTransport(config map[string]interface{}) (Transport, error) {
 	}, nil
 }
 
-// NewWebSocketTransport creates a new WebSocket transport
-func NewWebSocketTransport(config map[string]interface{}) (Transport, error) {
-	return &WebSocketTransport{
+// NewUnixSocketTransport creates a new Unix socket transport
+func NewUnixSocketTransport(config map[string]interface{}) (Transport, error) {
+	return &UnixSocketTransport{
 		config: config,
 	}, nil
 }
 
-// NewUnixSocketTransport creates a new Unix socket transport
-func NewUnixSocketTransport(config map[string]interface{}) (Transport, error) {
-	return &UnixSocketTransport{
+// NewStreamableHTTPTransport creates a new Streamable HTTP transport
+func NewStreamableHTTPTransport(config map[string]interface{}) (Transport, error) {
+	return &StreamableHTTPTransport{
 		config: config,
 	}, nil
 }
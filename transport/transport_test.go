@@ -1,9 +1,24 @@
 package transport
 
 import (
+	"bufio"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/j4ng5y/mcpgate/internal/mcptest"
 )
 
 func TestTransportFactory_CreateStdio(t *testing.T) {
@@ -47,26 +62,6 @@ func TestTransportFactory_CreateHTTP(t *testing.T) {
 	}
 }
 
-func TestTransportFactory_CreateWebSocket(t *testing.T) {
-	factory := NewFactory()
-	config := map[string]interface{}{
-		"url": "ws://localhost:9000",
-	}
-
-	transport, err := factory.Create("websocket", config)
-	if err != nil {
-		t.Fatalf("Failed to create WebSocket transport: %v", err)
-	}
-
-	if transport.Name() != "websocket" {
-		t.Errorf("Expected transport name 'websocket', got '%s'", transport.Name())
-	}
-
-	if transport.IsConnected() {
-		t.Error("Transport should not be connected initially")
-	}
-}
-
 func TestTransportFactory_CreateUnixSocket(t *testing.T) {
 	factory := NewFactory()
 	config := map[string]interface{}{
@@ -118,7 +113,8 @@ func TestStdioTransport_MissingCommand(t *testing.T) {
 
 func TestStdioTransport_ValidCommand(t *testing.T) {
 	config := map[string]interface{}{
-		"command": "cat",
+		"command": mcptest.EchoCommand,
+		"args":    mcptest.EchoArgs(),
 	}
 
 	transport, err := NewStdioTransport(config)
@@ -182,28 +178,10 @@ func TestUnixSocketTransport_MissingSocketPath(t *testing.T) {
 	}
 }
 
-func TestWebSocketTransport_MissingURL(t *testing.T) {
-	config := map[string]interface{}{
-		// No URL specified
-	}
-
-	transport, err := NewWebSocketTransport(config)
-	if err != nil {
-		t.Fatalf("Failed to create transport: %v", err)
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
-	defer cancel()
-
-	err = transport.Connect(ctx)
-	if err == nil {
-		t.Fatal("Expected error for missing URL")
-	}
-}
-
 func TestStdioTransport_Disconnect(t *testing.T) {
 	config := map[string]interface{}{
-		"command": "cat",
+		"command": mcptest.EchoCommand,
+		"args":    mcptest.EchoArgs(),
 	}
 
 	transport, err := NewStdioTransport(config)
@@ -250,3 +228,1523 @@ func TestHTTPTransport_Disconnect(t *testing.T) {
 		t.Error("Transport should not be connected")
 	}
 }
+
+func TestStdioTransport_NotificationHandler(t *testing.T) {
+	transport, err := NewStdioTransport(map[string]interface{}{
+		"command": mcptest.EchoCommand,
+		"args":    mcptest.EchoArgs(),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create transport: %v", err)
+	}
+
+	received := make(chan json.RawMessage, 1)
+	transport.(NotificationSource).SetNotificationHandler(func(n json.RawMessage) {
+		received <- n
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if err := transport.Connect(ctx); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer func() {
+		_ = transport.Disconnect(ctx)
+	}()
+
+	// The echo sends the notification back, which must bypass the response channel
+	sendCtx, sendCancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer sendCancel()
+	_, _ = transport.SendRequest(sendCtx, map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "notifications/resources/updated",
+	})
+
+	select {
+	case <-received:
+	case <-ctx.Done():
+		t.Fatal("Expected notification to be delivered to handler")
+	}
+}
+
+func TestStreamableHTTPTransport_JSONAndSession(t *testing.T) {
+	var sawSession string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		sawSession = r.Header.Get(SessionHeader)
+		w.Header().Set(SessionHeader, "session-1")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":{}}`))
+	}))
+	defer server.Close()
+
+	transport, err := NewFactory().Create("streamable-http", map[string]interface{}{"url": server.URL})
+	if err != nil {
+		t.Fatalf("Failed to create transport: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if err := transport.Connect(ctx); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+
+	req := map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": "initialize"}
+	if _, err := transport.SendRequest(ctx, req); err != nil {
+		t.Fatalf("First request failed: %v", err)
+	}
+	if sawSession != "" {
+		t.Errorf("Expected no session on first request, got %q", sawSession)
+	}
+
+	if _, err := transport.SendRequest(ctx, req); err != nil {
+		t.Fatalf("Second request failed: %v", err)
+	}
+	if sawSession != "session-1" {
+		t.Errorf("Expected session id to be replayed, got %q", sawSession)
+	}
+
+	if err := transport.Disconnect(ctx); err != nil {
+		t.Fatalf("Failed to disconnect: %v", err)
+	}
+}
+
+func TestStreamableHTTPTransport_EventStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("event: message\ndata: {\"jsonrpc\":\"2.0\",\"method\":\"notifications/progress\"}\n\n"))
+		_, _ = w.Write([]byte("event: message\ndata: {\"jsonrpc\":\"2.0\",\"id\":7,\"result\":{\"ok\":true}}\n\n"))
+	}))
+	defer server.Close()
+
+	transport, err := NewStreamableHTTPTransport(map[string]interface{}{"url": server.URL})
+	if err != nil {
+		t.Fatalf("Failed to create transport: %v", err)
+	}
+
+	var notifications int
+	transport.(NotificationSource).SetNotificationHandler(func(json.RawMessage) {
+		notifications++
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if err := transport.Connect(ctx); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+
+	resp, err := transport.SendRequest(ctx, map[string]interface{}{"jsonrpc": "2.0", "id": 7, "method": "tools/list"})
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+
+	if messageID(resp) != "7" {
+		t.Errorf("Expected response with id 7, got %s", string(resp))
+	}
+	if notifications != 1 {
+		t.Errorf("Expected 1 notification, got %d", notifications)
+	}
+}
+
+func TestStreamableHTTPTransport_MissingURL(t *testing.T) {
+	transport, _ := NewStreamableHTTPTransport(map[string]interface{}{})
+	if err := transport.Connect(context.Background()); err == nil {
+		t.Fatal("Expected error for missing URL")
+	}
+}
+
+func TestRequestHeaders(t *testing.T) {
+	t.Setenv("MCPGATE_TEST_TOKEN", "secret")
+
+	headers := requestHeaders(map[string]interface{}{
+		"headers":    map[string]string{"X-Team": "platform"},
+		"auth_token": "${MCPGATE_TEST_TOKEN}",
+	})
+
+	if headers.Get("X-Team") != "platform" {
+		t.Errorf("Expected X-Team header, got %q", headers.Get("X-Team"))
+	}
+	if headers.Get("Authorization") != "Bearer secret" {
+		t.Errorf("Expected expanded bearer token, got %q", headers.Get("Authorization"))
+	}
+
+	// An explicit Authorization header wins over auth_token
+	headers = requestHeaders(map[string]interface{}{
+		"headers":    map[string]string{"Authorization": "Basic abc"},
+		"auth_token": "ignored",
+	})
+	if headers.Get("Authorization") != "Basic abc" {
+		t.Errorf("Expected explicit Authorization header, got %q", headers.Get("Authorization"))
+	}
+}
+
+func TestHTTPTransport_SendsHeaders(t *testing.T) {
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/rpc" {
+			authorization = r.Header.Get("Authorization")
+		}
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":{}}`))
+	}))
+	defer server.Close()
+
+	transport, _ := NewHTTPTransport(map[string]interface{}{
+		"url":        server.URL,
+		"auth_token": "token-123",
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if err := transport.Connect(ctx); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+
+	if _, err := transport.SendRequest(ctx, map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": "ping"}); err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+
+	if authorization != "Bearer token-123" {
+		t.Errorf("Expected bearer token on request, got %q", authorization)
+	}
+}
+
+func TestHTTPTransport_HealthProbe(t *testing.T) {
+	var up atomic.Bool
+	up.Store(true)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ready" && r.Method == http.MethodHead && up.Load() {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	probeConfig := map[string]interface{}{
+		"url": server.URL,
+		"health_probe": map[string]interface{}{
+			"path":            "/ready",
+			"method":          "head",
+			"expected_status": http.StatusNoContent,
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	transport, _ := NewHTTPTransport(probeConfig)
+	if err := transport.Connect(ctx); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	prober, ok := transport.(HealthProber)
+	if !ok {
+		t.Fatal("Expected the http transport to be a HealthProber")
+	}
+	if err := prober.Probe(ctx); err != nil {
+		t.Errorf("Expected the probe to pass, got %v", err)
+	}
+
+	up.Store(false)
+	if err := prober.Probe(ctx); err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("Expected the probe to fail with the status, got %v", err)
+	}
+
+	down, _ := NewHTTPTransport(probeConfig)
+	if err := down.Connect(ctx); err == nil {
+		t.Error("Expected connecting to fail while the probe fails")
+	}
+}
+
+func TestHTTPTransport_OAuth2(t *testing.T) {
+	var tokenRequests, rpcRequests int
+	var grantType, scope string
+	var rejectFirst = true
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			tokenRequests++
+			_ = r.ParseForm()
+			grantType = r.Form.Get("grant_type")
+			scope = r.Form.Get("scope")
+			if id, secret, ok := r.BasicAuth(); !ok || id != "client" || secret != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"Bearer","expires_in":3600}`, tokenRequests)
+		case "/rpc":
+			rpcRequests++
+			if rejectFirst {
+				rejectFirst = false
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if r.Header.Get("Authorization") != "Bearer token-2" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":{}}`))
+		}
+	}))
+	defer server.Close()
+
+	transport, _ := NewHTTPTransport(map[string]interface{}{
+		"url": server.URL,
+		"oauth2": map[string]interface{}{
+			"token_url":     server.URL + "/token",
+			"client_id":     "client",
+			"client_secret": "secret",
+			"scopes":        []string{"mcp.read", "mcp.write"},
+		},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if err := transport.Connect(ctx); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+
+	if _, err := transport.SendRequest(ctx, map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": "ping"}); err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+
+	if tokenRequests != 2 || rpcRequests != 2 {
+		t.Errorf("Expected a token refresh and one retry, got %d token and %d rpc requests", tokenRequests, rpcRequests)
+	}
+	if grantType != "client_credentials" || scope != "mcp.read mcp.write" {
+		t.Errorf("Unexpected token request: grant_type=%q scope=%q", grantType, scope)
+	}
+
+	// The cached token is reused while valid
+	if _, err := transport.SendRequest(ctx, map[string]interface{}{"jsonrpc": "2.0", "id": 2, "method": "ping"}); err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	if tokenRequests != 2 {
+		t.Errorf("Expected cached token to be reused, got %d token requests", tokenRequests)
+	}
+}
+
+func TestHTTPTransport_OAuth2RequiresTokenURL(t *testing.T) {
+	transport, _ := NewHTTPTransport(map[string]interface{}{
+		"url":    "http://localhost:1",
+		"oauth2": map[string]interface{}{"client_id": "client"},
+	})
+
+	if err := transport.Connect(context.Background()); err == nil {
+		t.Error("Expected error for oauth2 without token_url")
+	}
+}
+
+func TestHTTPTransport_ProxyURL(t *testing.T) {
+	var proxiedHost string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxiedHost = r.URL.Host
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":{}}`))
+	}))
+	defer proxy.Close()
+
+	transport, _ := NewHTTPTransport(map[string]interface{}{
+		"url":       "http://upstream.invalid",
+		"proxy_url": proxy.URL,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if err := transport.Connect(ctx); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+
+	if _, err := transport.SendRequest(ctx, map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": "ping"}); err != nil {
+		t.Fatalf("Request through proxy failed: %v", err)
+	}
+
+	if proxiedHost != "upstream.invalid" {
+		t.Errorf("Expected request to be sent through the proxy, got host %q", proxiedHost)
+	}
+}
+
+func TestProxyFunc_InvalidURL(t *testing.T) {
+	for _, proxyURL := range []string{"ftp://proxy:21", "http://", "://bad"} {
+		if _, err := proxyFunc(map[string]interface{}{"proxy_url": proxyURL}); err == nil {
+			t.Errorf("Expected error for proxy_url %q", proxyURL)
+		}
+	}
+}
+
+func TestStdioTransport_DisconnectHandler(t *testing.T) {
+	transport, _ := NewStdioTransport(map[string]interface{}{
+		"command": mcptest.EchoCommand,
+		"args":    mcptest.EchoArgs(),
+	})
+
+	lost := make(chan error, 1)
+	transport.(DisconnectSource).SetDisconnectHandler(func(err error) {
+		lost <- err
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if err := transport.Connect(ctx); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+
+	// Closing stdin makes cat exit, which must be reported as a lost connection
+	if err := transport.(*StdioTransport).stdin.Close(); err != nil {
+		t.Fatalf("Failed to close stdin: %v", err)
+	}
+
+	select {
+	case <-lost:
+	case <-ctx.Done():
+		t.Fatal("Expected disconnect handler to be called")
+	}
+	if transport.IsConnected() {
+		t.Error("Expected transport to be disconnected")
+	}
+
+	// An explicit Disconnect is not reported
+	if err := transport.Connect(ctx); err != nil {
+		t.Fatalf("Failed to reconnect: %v", err)
+	}
+	if err := transport.Disconnect(ctx); err != nil {
+		t.Fatalf("Failed to disconnect: %v", err)
+	}
+	select {
+	case <-lost:
+		t.Error("Expected no disconnect handler call after Disconnect")
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestHTTPTransport_HostOverride(t *testing.T) {
+	t.Setenv("HTTP_PROXY", "")
+	t.Setenv("NO_PROXY", "*")
+
+	var host string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host = r.Host
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":{}}`))
+	}))
+	defer server.Close()
+
+	_, port, _ := strings.Cut(strings.TrimPrefix(server.URL, "http://"), ":")
+	transport, _ := NewHTTPTransport(map[string]interface{}{
+		"url":   "http://mcp.corp.invalid:" + port,
+		"hosts": map[string]string{"mcp.corp.invalid": "127.0.0.1"},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if err := transport.Connect(ctx); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+
+	if _, err := transport.SendRequest(ctx, map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": "ping"}); err != nil {
+		t.Fatalf("Request with host override failed: %v", err)
+	}
+
+	if host != "mcp.corp.invalid:"+port {
+		t.Errorf("Expected original Host header to be kept, got %q", host)
+	}
+}
+
+func TestDialFunc(t *testing.T) {
+	if dial, err := dialFunc(map[string]interface{}{}); dial != nil || err != nil {
+		t.Errorf("Expected default dialer without hosts or dns_server, got %v", err)
+	}
+
+	for _, server := range []string{"10.0.0.53", "10.0.0.53:5353", "[fd00::53]:53", "fd00::53"} {
+		if _, err := dialFunc(map[string]interface{}{"dns_server": server}); err != nil {
+			t.Errorf("Unexpected error for dns_server %q: %v", server, err)
+		}
+	}
+
+	if _, err := dialFunc(map[string]interface{}{"dns_server": "dns.example.com"}); err == nil {
+		t.Error("Expected error for non-IP dns_server")
+	}
+}
+
+func TestStdioTransport_ConcurrentRequestsCorrelatedByID(t *testing.T) {
+	transport, _ := NewStdioTransport(map[string]interface{}{
+		"command": mcptest.EchoCommand,
+		"args":    mcptest.EchoArgs(),
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := transport.Connect(ctx); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer func() {
+		_ = transport.Disconnect(ctx)
+	}()
+
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		go func(i int) {
+			// Callers reuse ids; each must still get its own response back
+			id := i % 3
+			resp, err := transport.SendRequest(ctx, map[string]interface{}{
+				"jsonrpc": "2.0",
+				"id":      id,
+				"method":  "ping",
+				"params":  map[string]interface{}{"caller": i},
+			})
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			var echoed struct {
+				ID     int `json:"id"`
+				Params struct {
+					Caller int `json:"caller"`
+				} `json:"params"`
+			}
+			if err := json.Unmarshal(resp, &echoed); err != nil {
+				errs <- err
+				return
+			}
+			if echoed.ID != id || echoed.Params.Caller != i {
+				errs <- fmt.Errorf("caller %d got response for caller %d with id %d", i, echoed.Params.Caller, echoed.ID)
+				return
+			}
+			errs <- nil
+		}(i)
+	}
+
+	for i := 0; i < 20; i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestStdioTransport_UpstreamRequestWithPendingID(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("upstream is a shell script")
+	}
+
+	// Pings the gateway with the id of its pending request before answering it
+	script := `IFS= read -r request
+echo '{"jsonrpc":"2.0","id":1,"method":"ping"}'
+echo '{"jsonrpc":"2.0","id":1,"result":{"answered":true}}'
+cat >/dev/null`
+	transport, _ := NewStdioTransport(map[string]interface{}{
+		"command": "sh",
+		"args":    []string{"-c", script},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if err := transport.Connect(ctx); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer func() {
+		_ = transport.Disconnect(ctx)
+	}()
+
+	resp, err := transport.SendRequest(ctx, map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  "tools/list",
+	})
+	if err != nil {
+		t.Fatalf("SendRequest failed: %v", err)
+	}
+
+	var msg struct {
+		Method string `json:"method"`
+		Result struct {
+			Answered bool `json:"answered"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(resp, &msg); err != nil || msg.Method != "" || !msg.Result.Answered {
+		t.Errorf("Expected the response rather than the upstream's ping, got %s", resp)
+	}
+}
+
+func TestPendingRequests_OutOfOrder(t *testing.T) {
+	var pending pendingRequests
+
+	first, firstKey, firstChan, err := pending.register(context.Background(), []byte(`{"jsonrpc":"2.0","id":"a","method":"x"}`))
+	if err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+	_, secondKey, secondChan, _ := pending.register(context.Background(), []byte(`{"jsonrpc":"2.0","id":"a","method":"y"}`))
+
+	if firstKey == secondKey || messageID(first) != firstKey {
+		t.Fatalf("Expected unique rewritten ids, got %s and %s", firstKey, secondKey)
+	}
+
+	// Answer the second request first
+	if !pending.deliver([]byte(`{"jsonrpc":"2.0","id":` + secondKey + `,"result":"second"}`)) {
+		t.Fatal("Expected second response to be delivered")
+	}
+	if !pending.deliver([]byte(`{"jsonrpc":"2.0","id":` + firstKey + `,"result":"first"}`)) {
+		t.Fatal("Expected first response to be delivered")
+	}
+	if pending.deliver([]byte(`{"jsonrpc":"2.0","id":999,"result":"stray"}`)) {
+		t.Error("Expected unmatched response to be rejected")
+	}
+	_, thirdKey, _, _ := pending.register(context.Background(), []byte(`{"jsonrpc":"2.0","id":"b","method":"z"}`))
+	if pending.deliver([]byte(`{"jsonrpc":"2.0","id":` + thirdKey + `,"method":"ping"}`)) {
+		t.Error("Expected an upstream request with a pending id to be rejected")
+	}
+
+	var resp struct {
+		ID     string `json:"id"`
+		Result string `json:"result"`
+	}
+	_ = json.Unmarshal(<-firstChan, &resp)
+	if resp.ID != "a" || resp.Result != "first" {
+		t.Errorf("Unexpected first response %+v", resp)
+	}
+	_ = json.Unmarshal(<-secondChan, &resp)
+	if resp.ID != "a" || resp.Result != "second" {
+		t.Errorf("Unexpected second response %+v", resp)
+	}
+
+	_, _, notifyChan, _ := pending.register(context.Background(), []byte(`{"jsonrpc":"2.0","method":"notifications/initialized"}`))
+	if notifyChan != nil {
+		t.Error("Expected no waiter for a notification")
+	}
+}
+
+func TestStdioTransport_CapturesStderr(t *testing.T) {
+	transport, _ := NewStdioTransport(map[string]interface{}{
+		"name":    "noisy",
+		"command": "sh",
+		"args":    []interface{}{"-c", "echo starting >&2; echo ready >&2; cat"},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if err := transport.Connect(ctx); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer func() {
+		_ = transport.Disconnect(ctx)
+	}()
+
+	source := transport.(StderrSource)
+	for len(source.StderrTail()) < 2 {
+		select {
+		case <-ctx.Done():
+			t.Fatalf("Expected stderr lines, got %v", source.StderrTail())
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	tail := source.StderrTail()
+	if tail[0] != "starting" || tail[1] != "ready" {
+		t.Errorf("Unexpected stderr tail %v", tail)
+	}
+}
+
+func TestStderrLog_KeepsLastLines(t *testing.T) {
+	stderr := newStderrLog("test", 2)
+
+	_, _ = stderr.Write([]byte("one\ntw"))
+	_, _ = stderr.Write([]byte("o\r\nthree\nfour"))
+
+	tail := stderr.tail()
+	if len(tail) != 2 || tail[0] != "two" || tail[1] != "three" {
+		t.Errorf("Expected last two complete lines, got %v", tail)
+	}
+}
+
+func TestStdioTransport_DisconnectSendsSIGTERM(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("SIGTERM is not supported on Windows")
+	}
+
+	transport, _ := NewStdioTransport(map[string]interface{}{
+		"name":    "flusher",
+		"command": "sh",
+		"args":    []interface{}{"-c", "trap 'echo flushed >&2; exit 0' TERM; echo ready >&2; while :; do sleep 0.1; done"},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := transport.Connect(ctx); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	waitForStderr(ctx, t, transport)
+	if err := transport.Disconnect(ctx); err != nil {
+		t.Fatalf("Failed to disconnect: %v", err)
+	}
+
+	tail := transport.(StderrSource).StderrTail()
+	if len(tail) == 0 || tail[len(tail)-1] != "flushed" {
+		t.Errorf("Expected subprocess to flush on SIGTERM, got stderr %v", tail)
+	}
+}
+
+func TestStdioTransport_DisconnectKillsAfterGrace(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("SIGTERM is not supported on Windows")
+	}
+
+	transport, _ := NewStdioTransport(map[string]interface{}{
+		"command":        "sh",
+		"args":           []interface{}{"-c", "trap '' TERM; echo ready >&2; while :; do sleep 0.1; done"},
+		"shutdown_grace": 1,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := transport.Connect(ctx); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	waitForStderr(ctx, t, transport)
+
+	start := time.Now()
+	if err := transport.Disconnect(ctx); err != nil {
+		t.Fatalf("Failed to disconnect: %v", err)
+	}
+	elapsed := time.Since(start)
+
+	if elapsed < time.Second {
+		t.Errorf("Expected Disconnect to wait for the grace period, took %s", elapsed)
+	}
+	if elapsed > 4*time.Second {
+		t.Errorf("Expected subprocess to be killed after the grace period, took %s", elapsed)
+	}
+}
+
+// waitForStderr waits until the subprocess has written to stderr, signalling
+// that its signal handlers are installed
+func waitForStderr(ctx context.Context, t *testing.T, transport Transport) {
+	t.Helper()
+	for len(transport.(StderrSource).StderrTail()) == 0 {
+		select {
+		case <-ctx.Done():
+			t.Fatal("Timed out waiting for subprocess to start")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestShutdownGrace(t *testing.T) {
+	tests := []struct {
+		config map[string]interface{}
+		want   time.Duration
+	}{
+		{map[string]interface{}{}, DefaultShutdownGrace},
+		{map[string]interface{}{"shutdown_grace": 0}, DefaultShutdownGrace},
+		{map[string]interface{}{"shutdown_grace": 2}, 2 * time.Second},
+		{map[string]interface{}{"shutdown_grace": -1}, 0},
+	}
+
+	for _, tt := range tests {
+		if got := shutdownGrace(tt.config); got != tt.want {
+			t.Errorf("shutdownGrace(%v) = %s, want %s", tt.config, got, tt.want)
+		}
+	}
+}
+
+func TestFraming_ContentLengthRoundTrip(t *testing.T) {
+	var buf strings.Builder
+	messages := []string{`{"jsonrpc":"2.0","id":1}`, `{"jsonrpc":"2.0","method":"a\nb"}`}
+	for _, msg := range messages {
+		if err := writeFrame(&buf, FramingContentLength, []byte(msg)); err != nil {
+			t.Fatalf("writeFrame failed: %v", err)
+		}
+	}
+
+	reader := bufio.NewReader(strings.NewReader(buf.String()))
+	for _, want := range messages {
+		got, err := readFrame(reader, FramingContentLength)
+		if err != nil {
+			t.Fatalf("readFrame failed: %v", err)
+		}
+		if string(got) != want {
+			t.Errorf("Expected %s, got %s", want, got)
+		}
+	}
+}
+
+func TestFraming_ContentLengthHeaders(t *testing.T) {
+	input := "\r\ncontent-length: 2\r\nContent-Type: application/vscode-jsonrpc; charset=utf-8\r\n\r\n{}"
+	got, err := readFrame(bufio.NewReader(strings.NewReader(input)), FramingContentLength)
+	if err != nil {
+		t.Fatalf("readFrame failed: %v", err)
+	}
+	if string(got) != "{}" {
+		t.Errorf("Expected {}, got %s", got)
+	}
+
+	for _, bad := range []string{
+		"Content-Type: application/json\r\n\r\n{}",
+		"Content-Length: nope\r\n\r\n{}",
+		"garbage\r\n\r\n",
+	} {
+		if _, err := readFrame(bufio.NewReader(strings.NewReader(bad)), FramingContentLength); err == nil {
+			t.Errorf("Expected error for %q", bad)
+		}
+	}
+}
+
+func TestStdioTransport_ContentLengthFraming(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("upstream is a shell script")
+	}
+
+	// Answers one framed request with a framed response carrying it as the result
+	script := `IFS= read -r header; read -r blank
+length=${header#Content-Length: }
+body=$(dd bs=1 count=${length%?} 2>/dev/null)
+id=${body#*'"id":'}
+reply='{"jsonrpc":"2.0","id":'${id%%,*}',"result":'$body'}'
+printf 'Content-Length: %d\r\n\r\n%s' ${#reply} "$reply"
+cat >/dev/null`
+	transport, _ := NewStdioTransport(map[string]interface{}{
+		"command": "sh",
+		"args":    []string{"-c", script},
+		"framing": FramingContentLength,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if err := transport.Connect(ctx); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer func() {
+		_ = transport.Disconnect(ctx)
+	}()
+
+	resp, err := transport.SendRequest(ctx, map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      7,
+		"method":  "ping",
+	})
+	if err != nil {
+		t.Fatalf("SendRequest failed: %v", err)
+	}
+
+	var msg struct {
+		ID     int                    `json:"id"`
+		Result map[string]interface{} `json:"result"`
+	}
+	if err := json.Unmarshal(resp, &msg); err != nil {
+		t.Fatalf("Invalid response: %v", err)
+	}
+	if msg.ID != 7 || msg.Result["method"] != "ping" {
+		t.Errorf("Unexpected response %s", resp)
+	}
+}
+
+func TestStdioTransport_InvalidFraming(t *testing.T) {
+	transport, _ := NewStdioTransport(map[string]interface{}{
+		"command": mcptest.EchoCommand,
+		"args":    mcptest.EchoArgs(),
+		"framing": "xml",
+	})
+
+	if err := transport.Connect(context.Background()); err == nil {
+		_ = transport.Disconnect(context.Background())
+		t.Fatal("Expected error for invalid framing")
+	}
+}
+
+func TestTransportFactory_UnknownType(t *testing.T) {
+	_, err := NewFactory().Create("carrier-pigeon", map[string]interface{}{})
+	if err == nil {
+		t.Fatal("Expected error for unknown transport type")
+	}
+	if !strings.Contains(err.Error(), "stdio") {
+		t.Errorf("Expected error to list available transports, got %v", err)
+	}
+}
+
+func TestAvailable_IncludesCoreTransports(t *testing.T) {
+	available := Available()
+	for _, name := range []string{"http", "stdio", "streamable-http", "unix"} {
+		found := false
+		for _, got := range available {
+			if got == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("Expected %s in available transports %v", name, available)
+		}
+	}
+}
+
+// inMemoryTransport is a custom transport registered by TestRegister
+type inMemoryTransport struct {
+	config map[string]interface{}
+}
+
+func (m *inMemoryTransport) Connect(ctx context.Context) error    { return nil }
+func (m *inMemoryTransport) Disconnect(ctx context.Context) error { return nil }
+func (m *inMemoryTransport) IsConnected() bool                    { return true }
+func (m *inMemoryTransport) Name() string                         { return "in-memory" }
+func (m *inMemoryTransport) SendRequest(ctx context.Context, request interface{}) (json.RawMessage, error) {
+	return json.RawMessage(`{"jsonrpc":"2.0","id":1,"result":{}}`), nil
+}
+func (m *inMemoryTransport) SendNotification(ctx context.Context, notification interface{}) error {
+	return nil
+}
+
+func TestRegister(t *testing.T) {
+	constructor := func(config map[string]interface{}) (Transport, error) {
+		return &inMemoryTransport{config: config}, nil
+	}
+
+	if err := Register("in-memory", constructor); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	if err := Register("in-memory", constructor); err == nil {
+		t.Error("Expected a duplicate registration to fail")
+	}
+	if err := Register("stdio", constructor); err == nil {
+		t.Error("Expected registering over a built-in transport to fail")
+	}
+	if err := Register("", constructor); err == nil {
+		t.Error("Expected an empty name to fail")
+	}
+	if err := Register("no-constructor", nil); err == nil {
+		t.Error("Expected a nil constructor to fail")
+	}
+
+	transport, err := NewFactory().Create("in-memory", map[string]interface{}{"url": "mem://x"})
+	if err != nil {
+		t.Fatalf("Failed to create registered transport: %v", err)
+	}
+	if custom, ok := transport.(*inMemoryTransport); !ok || custom.config["url"] != "mem://x" {
+		t.Errorf("Expected the constructor to receive the config, got %#v", transport)
+	}
+
+	found := false
+	for _, name := range Available() {
+		found = found || name == "in-memory"
+	}
+	if !found {
+		t.Errorf("Expected in-memory in available transports %v", Available())
+	}
+}
+
+func TestStringListAndMap(t *testing.T) {
+	config := map[string]interface{}{
+		"typed":     []string{"a", "b"},
+		"decoded":   []interface{}{"a", 1, "b"},
+		"typed_env": map[string]string{"K": "v"},
+		"toml_env":  map[string]interface{}{"K": "v", "N": 1},
+	}
+
+	for _, key := range []string{"typed", "decoded"} {
+		if got := stringList(config, key); strings.Join(got, ",") != "a,b" {
+			t.Errorf("stringList(%s) = %v, want [a b]", key, got)
+		}
+	}
+	for _, key := range []string{"typed_env", "toml_env"} {
+		if got := stringMap(config, key); len(got) != 1 || got["K"] != "v" {
+			t.Errorf("stringMap(%s) = %v, want map[K:v]", key, got)
+		}
+	}
+	if stringList(config, "missing") != nil || stringMap(config, "missing") != nil {
+		t.Error("Expected nil for missing keys")
+	}
+}
+
+func TestStdioTransport_Metrics(t *testing.T) {
+	transport, _ := NewStdioTransport(map[string]interface{}{"command": mcptest.EchoCommand, "args": mcptest.EchoArgs()})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if err := transport.Connect(ctx); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+
+	resp, err := transport.SendRequest(ctx, map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": "ping"})
+	if err != nil {
+		t.Fatalf("SendRequest failed: %v", err)
+	}
+
+	metrics := transport.(MetricsSource).Metrics()
+	if metrics.Requests != 1 || metrics.Errors != 0 {
+		t.Errorf("Expected 1 request and no errors, got %+v", metrics)
+	}
+	if metrics.BytesSent == 0 || metrics.BytesReceived < int64(len(resp)) {
+		t.Errorf("Expected bytes sent and at least %d bytes received, got %+v", len(resp), metrics)
+	}
+	if metrics.LastLatency <= 0 {
+		t.Errorf("Expected a latency, got %s", metrics.LastLatency)
+	}
+
+	_ = transport.Disconnect(ctx)
+	if _, err := transport.SendRequest(ctx, map[string]interface{}{"jsonrpc": "2.0", "id": 2, "method": "ping"}); err == nil {
+		t.Fatal("Expected error after disconnect")
+	}
+	if metrics := transport.(MetricsSource).Metrics(); metrics.Requests != 2 || metrics.Errors != 1 {
+		t.Errorf("Expected 2 requests and 1 error, got %+v", metrics)
+	}
+}
+
+func TestProcessOptionsFromConfig(t *testing.T) {
+	dir := t.TempDir()
+	opts, err := processOptionsFromConfig(map[string]interface{}{"cwd": dir, "uid": 1000, "umask": "027"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if opts.cwd != dir || opts.uid != 1000 || opts.gid != -1 || opts.umask != 0o027 {
+		t.Errorf("Unexpected options %+v", opts)
+	}
+
+	for _, config := range []map[string]interface{}{
+		{"cwd": filepath.Join(dir, "missing")},
+		{"uid": -5},
+		{"umask": "999"},
+		{"umask": "1777"},
+	} {
+		if _, err := processOptionsFromConfig(config); err == nil {
+			t.Errorf("Expected error for %v", config)
+		}
+	}
+}
+
+func TestStdioTransport_ProcessOptions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh, umask and id")
+	}
+
+	dir, _ := filepath.EvalSymlinks(t.TempDir())
+	transport, _ := NewStdioTransport(map[string]interface{}{
+		"name":    "sh",
+		"command": "sh",
+		"args":    []string{"-c", `echo "$(pwd) $(umask) $(id -u)" >&2; exec cat`},
+		"cwd":     dir,
+		"uid":     os.Getuid(),
+		"gid":     os.Getgid(),
+		"umask":   "027",
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if err := transport.Connect(ctx); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer func() {
+		_ = transport.Disconnect(ctx)
+	}()
+
+	waitForStderr(ctx, t, transport)
+	want := fmt.Sprintf("%s 0027 %d", dir, os.Getuid())
+	if got := transport.(StderrSource).StderrTail()[0]; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestSubprocessEnv(t *testing.T) {
+	t.Setenv("MCPGATE_TEST_SECRET", "hunter2")
+	t.Setenv("MCPGATE_TEST_ALLOWED", "yes")
+	t.Setenv("PATH", "/usr/bin")
+
+	has := func(env []string, kv string) bool {
+		for _, e := range env {
+			if e == kv {
+				return true
+			}
+		}
+		return false
+	}
+
+	env := subprocessEnv(map[string]interface{}{"env": map[string]string{"EXTRA": "1"}})
+	if !has(env, "MCPGATE_TEST_SECRET=hunter2") || !has(env, "EXTRA=1") {
+		t.Error("Expected the full environment plus env by default")
+	}
+
+	env = subprocessEnv(map[string]interface{}{
+		"inherit_env": false,
+		"env":         map[string]string{"EXTRA": "1"},
+	})
+	if has(env, "MCPGATE_TEST_SECRET=hunter2") || has(env, "MCPGATE_TEST_ALLOWED=yes") {
+		t.Error("Expected gateway variables to be scrubbed")
+	}
+	if !has(env, "PATH=/usr/bin") || !has(env, "EXTRA=1") {
+		t.Error("Expected PATH and env to survive scrubbing")
+	}
+
+	env = subprocessEnv(map[string]interface{}{"env_allowlist": []interface{}{"MCPGATE_TEST_ALL*"}})
+	if has(env, "MCPGATE_TEST_SECRET=hunter2") || !has(env, "MCPGATE_TEST_ALLOWED=yes") {
+		t.Error("Expected the allowlist alone to scrub everything else")
+	}
+
+	env = subprocessEnv(map[string]interface{}{"inherit_env": true, "env_allowlist": []string{"NOTHING"}})
+	if !has(env, "MCPGATE_TEST_SECRET=hunter2") {
+		t.Error("Expected an explicit inherit_env = true to inherit everything")
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"", 0, false},
+		{"7", 7 * time.Second, true},
+		{"-1", 0, false},
+		{now.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second, true},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0, true},
+		{"soon", 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := retryAfter(tt.value, now)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("retryAfter(%q) = %s, %v, want %s, %v", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestHTTPTransport_RetriesAfterRateLimit(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/rpc" {
+			return
+		}
+		calls.Add(1)
+		if calls.Load() <= 2 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":{}}`))
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	transport, _ := NewHTTPTransport(map[string]interface{}{"url": srv.URL})
+	if err := transport.Connect(ctx); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+
+	if _, err := transport.SendRequest(ctx, map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": "ping"}); err != nil {
+		t.Fatalf("Expected retries to succeed, got %v", err)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("Expected 3 attempts, got %d", calls.Load())
+	}
+}
+
+func TestHTTPTransport_RetryLimits(t *testing.T) {
+	var calls atomic.Int32
+	var retryAfterHeader atomic.Value
+	retryAfterHeader.Store("0")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/rpc" {
+			return
+		}
+		calls.Add(1)
+		w.Header().Set("Retry-After", retryAfterHeader.Load().(string))
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	request := map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": "ping"}
+
+	// Retries disabled
+	transport, _ := NewHTTPTransport(map[string]interface{}{"url": srv.URL, "max_retries": -1})
+	_ = transport.Connect(ctx)
+	if _, err := transport.SendRequest(ctx, request); err == nil || calls.Load() != 1 {
+		t.Errorf("Expected one failed attempt, got %d attempts and error %v", calls.Load(), err)
+	}
+
+	// Retries exhausted
+	calls.Store(0)
+	transport, _ = NewHTTPTransport(map[string]interface{}{"url": srv.URL, "max_retries": 2})
+	_ = transport.Connect(ctx)
+	if _, err := transport.SendRequest(ctx, request); err == nil || calls.Load() != 3 {
+		t.Errorf("Expected three failed attempts, got %d attempts and error %v", calls.Load(), err)
+	}
+
+	// Asked to wait longer than max_retry_delay
+	calls.Store(0)
+	retryAfterHeader.Store("3600")
+	if _, err := transport.SendRequest(ctx, request); err == nil || calls.Load() != 1 {
+		t.Errorf("Expected no retry for a long Retry-After, got %d attempts and error %v", calls.Load(), err)
+	}
+}
+
+// sessionServer issues a new Mcp-Session-Id on every initialize and rejects
+// requests for sessions it has expired
+type sessionServer struct {
+	mutex    sync.Mutex
+	sessions int
+	current  string
+	log      []string
+}
+
+func (s *sessionServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		return
+	}
+	var msg struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&msg)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	session := r.Header.Get(SessionHeader)
+	s.log = append(s.log, msg.Method+"@"+session)
+
+	if msg.Method == "initialize" {
+		s.sessions++
+		s.current = fmt.Sprintf("s%d", s.sessions)
+		w.Header().Set(SessionHeader, s.current)
+	} else if session != s.current {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if len(msg.ID) == 0 {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"result":{}}`, msg.ID)
+}
+
+// expire invalidates the current session
+func (s *sessionServer) expire() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.current = "gone"
+}
+
+func TestHTTPTransports_ReinitializeExpiredSession(t *testing.T) {
+	for _, transportType := range []string{"http", "streamable-http"} {
+		t.Run(transportType, func(t *testing.T) {
+			upstream := &sessionServer{}
+			srv := httptest.NewServer(upstream)
+			defer srv.Close()
+
+			transport, _ := NewFactory().Create(transportType, map[string]interface{}{"url": srv.URL})
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			if err := transport.Connect(ctx); err != nil {
+				t.Fatalf("Failed to connect: %v", err)
+			}
+
+			send := func(id int, method string) error {
+				_, err := transport.SendRequest(ctx, map[string]interface{}{"jsonrpc": "2.0", "id": id, "method": method})
+				return err
+			}
+
+			if err := send(1, "initialize"); err != nil {
+				t.Fatalf("initialize failed: %v", err)
+			}
+			if err := send(2, "tools/list"); err != nil {
+				t.Fatalf("tools/list failed: %v", err)
+			}
+
+			upstream.expire()
+			if err := send(3, "tools/list"); err != nil {
+				t.Fatalf("Expected transparent re-initialization, got %v", err)
+			}
+
+			want := []string{
+				"initialize@", "tools/list@s1",
+				"tools/list@s1", "initialize@", "notifications/initialized@s2", "tools/list@s2",
+			}
+			upstream.mutex.Lock()
+			defer upstream.mutex.Unlock()
+			if strings.Join(upstream.log, " ") != strings.Join(want, " ") {
+				t.Errorf("Expected requests %v, got %v", want, upstream.log)
+			}
+		})
+	}
+}
+
+func TestHTTPTransport_ExpiredSessionWithoutInitialize(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(SessionHeader) != "" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set(SessionHeader, "s1")
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":{}}`))
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	transport, _ := NewHTTPTransport(map[string]interface{}{"url": srv.URL})
+	_ = transport.Connect(ctx)
+
+	request := map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": "ping"}
+	if _, err := transport.SendRequest(ctx, request); err != nil {
+		t.Fatalf("First request failed: %v", err)
+	}
+	if _, err := transport.SendRequest(ctx, request); err == nil || !strings.Contains(err.Error(), "re-initialize") {
+		t.Errorf("Expected a re-initialization error, got %v", err)
+	}
+}
+
+func TestUnixSocketTransport_WaitForSocket(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix sockets")
+	}
+
+	// Socket paths are limited to about 100 bytes, too short for t.TempDir
+	dir, err := os.MkdirTemp("", "mcpgate")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	socketPath := filepath.Join(dir, "late.sock")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	transport, _ := NewUnixSocketTransport(map[string]interface{}{"socket_path": socketPath})
+	if err := transport.Connect(ctx); err == nil {
+		t.Fatal("Expected error without wait_for_socket")
+	}
+
+	transport, _ = NewUnixSocketTransport(map[string]interface{}{"socket_path": socketPath, "wait_for_socket": 1})
+	start := time.Now()
+	if err := transport.Connect(ctx); err == nil || !strings.Contains(err.Error(), "within 1s") {
+		t.Fatalf("Expected timeout error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("Expected to wait 1s, waited %s", elapsed)
+	}
+
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		listener, err := net.Listen("unix", socketPath)
+		if err != nil {
+			return
+		}
+		defer func() {
+			_ = listener.Close()
+		}()
+		if conn, err := listener.Accept(); err == nil {
+			<-ctx.Done()
+			_ = conn.Close()
+		}
+	}()
+
+	transport, _ = NewUnixSocketTransport(map[string]interface{}{"socket_path": socketPath, "wait_for_socket": 3})
+	if err := transport.Connect(ctx); err != nil {
+		t.Fatalf("Expected to connect once the socket appeared, got %v", err)
+	}
+	_ = transport.Disconnect(ctx)
+}
+
+func TestResponseBufferFromConfig(t *testing.T) {
+	size, policy, err := responseBufferFromConfig(map[string]interface{}{})
+	if err != nil || size != DefaultResponseBuffer || policy != OverflowBlock {
+		t.Errorf("Unexpected defaults %d, %q, %v", size, policy, err)
+	}
+
+	size, policy, err = responseBufferFromConfig(map[string]interface{}{"response_buffer": 5, "overflow_policy": OverflowDropOldest})
+	if err != nil || size != 5 || policy != OverflowDropOldest {
+		t.Errorf("Unexpected settings %d, %q, %v", size, policy, err)
+	}
+
+	if _, _, err := responseBufferFromConfig(map[string]interface{}{"overflow_policy": "panic"}); err == nil {
+		t.Error("Expected error for invalid overflow_policy")
+	}
+}
+
+func TestEnqueueResponse_OverflowPolicies(t *testing.T) {
+	done := make(chan struct{})
+
+	var m connMetrics
+	ch := make(chan json.RawMessage, 2)
+	for _, msg := range []string{"1", "2", "3"} {
+		if err := m.enqueueResponse(ch, json.RawMessage(msg), OverflowDropOldest, done); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if first, second := string(<-ch), string(<-ch); first != "2" || second != "3" {
+		t.Errorf("Expected the oldest response to be dropped, got %s %s", first, second)
+	}
+	if m.Metrics().Dropped != 1 {
+		t.Errorf("Expected 1 dropped response, got %d", m.Metrics().Dropped)
+	}
+
+	ch = make(chan json.RawMessage, 1)
+	_ = m.enqueueResponse(ch, json.RawMessage("1"), OverflowError, done)
+	if err := m.enqueueResponse(ch, json.RawMessage("2"), OverflowError, done); err == nil {
+		t.Error("Expected overflow error")
+	}
+
+	// Blocking gives up once the transport is done
+	close(done)
+	if err := m.enqueueResponse(ch, json.RawMessage("3"), OverflowBlock, done); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestStdioTransport_SendNotification(t *testing.T) {
+	transport, _ := NewStdioTransport(map[string]interface{}{"command": mcptest.EchoCommand, "args": mcptest.EchoArgs()})
+
+	received := make(chan json.RawMessage, 1)
+	transport.(NotificationSource).SetNotificationHandler(func(n json.RawMessage) {
+		received <- n
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := transport.Connect(ctx); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer func() {
+		_ = transport.Disconnect(ctx)
+	}()
+
+	err := transport.SendNotification(ctx, map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "notifications/initialized",
+	})
+	if err != nil {
+		t.Fatalf("SendNotification failed: %v", err)
+	}
+
+	// The echo sends the notification back
+	select {
+	case n := <-received:
+		if !strings.Contains(string(n), "notifications/initialized") {
+			t.Errorf("Unexpected notification %s", n)
+		}
+	case <-ctx.Done():
+		t.Fatal("Expected the notification to reach the subprocess")
+	}
+
+	metrics := transport.(MetricsSource).Metrics()
+	if metrics.Requests != 0 || metrics.BytesSent == 0 {
+		t.Errorf("Expected bytes sent without a request, got %+v", metrics)
+	}
+}
+
+func TestPendingRequests_RewriteCancellation(t *testing.T) {
+	var pending pendingRequests
+	_, key, _, _ := pending.register(context.Background(), []byte(`{"jsonrpc":"2.0","id":"a","method":"tools/call"}`))
+
+	rewritten := pending.rewriteCancellation(context.Background(), []byte(`{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":"a","reason":"user"}}`))
+	var msg struct {
+		Params struct {
+			RequestID json.RawMessage `json:"requestId"`
+			Reason    string          `json:"reason"`
+		} `json:"params"`
+	}
+	if err := json.Unmarshal(rewritten, &msg); err != nil {
+		t.Fatalf("Invalid rewritten message %s: %v", rewritten, err)
+	}
+	if string(msg.Params.RequestID) != key || msg.Params.Reason != "user" {
+		t.Errorf("Expected requestId %s, got %s", key, rewritten)
+	}
+
+	unknown := `{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":"b"}}`
+	if got := string(pending.rewriteCancellation(context.Background(), []byte(unknown))); got != unknown {
+		t.Errorf("Expected cancellation of an unknown request unchanged, got %s", got)
+	}
+}
+
+func TestPendingRequests_RewriteCancellation_PerSession(t *testing.T) {
+	var pending pendingRequests
+	_, _, _, _ = pending.register(WithSession(context.Background(), "one"), []byte(`{"jsonrpc":"2.0","id":1,"method":"tools/call"}`))
+	_, key, _, _ := pending.register(WithSession(context.Background(), "two"), []byte(`{"jsonrpc":"2.0","id":1,"method":"tools/call"}`))
+	_, _, _, _ = pending.register(WithSession(context.Background(), "three"), []byte(`{"jsonrpc":"2.0","id":1,"method":"tools/call"}`))
+
+	rewritten := pending.rewriteCancellation(WithSession(context.Background(), "two"), []byte(`{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":1}}`))
+	if want := `"requestId":` + key; !strings.Contains(string(rewritten), want) {
+		t.Errorf("Expected the cancellation to name the session's own request %s, got %s", want, rewritten)
+	}
+}
+
+func TestHTTPTransports_SendNotification(t *testing.T) {
+	for _, transportType := range []string{"http", "streamable-http"} {
+		t.Run(transportType, func(t *testing.T) {
+			upstream := &sessionServer{}
+			srv := httptest.NewServer(upstream)
+			defer srv.Close()
+
+			transport, _ := NewFactory().Create(transportType, map[string]interface{}{"url": srv.URL})
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			if err := transport.Connect(ctx); err != nil {
+				t.Fatalf("Failed to connect: %v", err)
+			}
+
+			if _, err := transport.SendRequest(ctx, map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": "initialize"}); err != nil {
+				t.Fatalf("initialize failed: %v", err)
+			}
+			if err := transport.SendNotification(ctx, map[string]interface{}{"jsonrpc": "2.0", "method": "notifications/initialized"}); err != nil {
+				t.Fatalf("SendNotification failed: %v", err)
+			}
+
+			upstream.mutex.Lock()
+			defer upstream.mutex.Unlock()
+			if got := strings.Join(upstream.log, " "); got != "initialize@ notifications/initialized@s1" {
+				t.Errorf("Unexpected requests %s", got)
+			}
+		})
+	}
+}
+
+func TestStdioTransport_ReportsExitCode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+
+	transport, _ := NewStdioTransport(map[string]interface{}{
+		"command": "sh",
+		"args":    []string{"-c", "exit 3"},
+	})
+
+	lost := make(chan error, 1)
+	transport.(DisconnectSource).SetDisconnectHandler(func(err error) {
+		lost <- err
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := transport.Connect(ctx); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+
+	select {
+	case err := <-lost:
+		var exitErr *ExitError
+		if !errors.As(err, &exitErr) || exitErr.ExitCode != 3 {
+			t.Errorf("Expected exit code 3, got %v", err)
+		}
+	case <-ctx.Done():
+		t.Fatal("Expected disconnect handler to be called")
+	}
+}
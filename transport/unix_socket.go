@@ -5,20 +5,31 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net"
 	"sync"
+	"time"
+
+	"github.com/j4ng5y/mcpgate/logging"
 )
 
+// socketPollInterval is how often wait_for_socket retries the socket
+const socketPollInterval = 100 * time.Millisecond
+
 // UnixSocketTransport communicates via Unix domain socket
 type UnixSocketTransport struct {
-	config    map[string]interface{}
-	conn      net.Conn
-	reader    *bufio.Reader
-	mutex     sync.RWMutex
-	connected bool
-	respChan  chan json.RawMessage
-	done      chan struct{}
+	connMetrics
+
+	config        map[string]interface{}
+	conn          net.Conn
+	reader        *bufio.Reader
+	mutex         sync.RWMutex
+	connected     bool
+	respChan      chan json.RawMessage
+	overflow      string
+	done          chan struct{}
+	notifyHandler NotificationHandler
+	lostHandler   DisconnectHandler
 }
 
 // Connect establishes a Unix socket connection
@@ -35,8 +46,13 @@ func (t *UnixSocketTransport) Connect(ctx context.Context) error {
 		return fmt.Errorf("unix socket transport requires 'socket_path' configuration")
 	}
 
-	dialer := net.Dialer{}
-	conn, err := dialer.DialContext(ctx, "unix", socketPath)
+	bufferSize, overflow, err := responseBufferFromConfig(t.config)
+	if err != nil {
+		return err
+	}
+
+	wait, _ := t.config["wait_for_socket"].(int)
+	conn, err := dialSocket(ctx, socketPath, time.Duration(wait)*time.Second)
 	if err != nil {
 		return fmt.Errorf("failed to connect to unix socket: %w", err)
 	}
@@ -44,34 +60,78 @@ func (t *UnixSocketTransport) Connect(ctx context.Context) error {
 	t.conn = conn
 	t.reader = bufio.NewReader(conn)
 	t.connected = true
-	t.respChan = make(chan json.RawMessage, 100)
+	t.respChan = make(chan json.RawMessage, bufferSize)
+	t.overflow = overflow
 	t.done = make(chan struct{})
 
 	// Start reading responses in background
-	go t.readResponses()
+	go t.readResponses(t.reader, t.respChan, t.done)
 
 	return nil
 }
 
-// readResponses reads JSON responses from Unix socket
-func (t *UnixSocketTransport) readResponses() {
-	defer close(t.respChan)
+// readResponses reads JSON responses from the Unix socket connection
+// identified by done
+func (t *UnixSocketTransport) readResponses(reader *bufio.Reader, respChan chan json.RawMessage, done chan struct{}) {
+	defer close(respChan)
 	for {
 		select {
-		case <-t.done:
+		case <-done:
 			return
 		default:
 		}
 
-		line, err := t.reader.ReadBytes('\n')
+		line, err := reader.ReadBytes('\n')
 		if err != nil {
-			t.mutex.Lock()
-			t.connected = false
-			t.mutex.Unlock()
+			t.connectionLost(done, err)
 			return
 		}
+		t.received(len(line))
 
-		t.respChan <- json.RawMessage(line)
+		if t.dispatchNotification(line) {
+			continue
+		}
+		if !isResponse(line) {
+			logger(t.config).Warn("Dropping unexpected message from socket", "message", string(line))
+			continue
+		}
+
+		if err := t.enqueueResponse(respChan, json.RawMessage(line), t.overflow, done); err != nil {
+			logger(t.config).Warn("Dropping unix socket connection", "socket", t.config["socket_path"], logging.Err(err))
+			t.connectionLost(done, err)
+			return
+		}
+	}
+}
+
+// dialSocket connects to socketPath, retrying for up to wait while the socket
+// does not exist yet or nothing is listening on it. Servers started alongside
+// the gateway often create their socket after it first tries to connect.
+func dialSocket(ctx context.Context, socketPath string, wait time.Duration) (net.Conn, error) {
+	dialer := net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "unix", socketPath)
+	if err == nil || wait <= 0 {
+		return conn, err
+	}
+
+	slog.InfoContext(ctx, "Waiting for unix socket", "socket", socketPath, "timeout", wait)
+	deadline := time.NewTimer(wait)
+	defer deadline.Stop()
+	ticker := time.NewTicker(socketPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%w (last error: %v)", ctx.Err(), err)
+		case <-deadline.C:
+			return nil, fmt.Errorf("socket did not become available within %s: %w", wait, err)
+		case <-ticker.C:
+		}
+
+		if conn, err = dialer.DialContext(ctx, "unix", socketPath); err == nil {
+			return conn, nil
+		}
 	}
 }
 
@@ -89,7 +149,7 @@ func (t *UnixSocketTransport) Disconnect(ctx context.Context) error {
 
 	if t.conn != nil {
 		if err := t.conn.Close(); err != nil {
-			log.Printf("Error closing connection: %v", err)
+			logger(t.config).Warn("Error closing connection", logging.Err(err))
 		}
 	}
 
@@ -97,7 +157,9 @@ func (t *UnixSocketTransport) Disconnect(ctx context.Context) error {
 }
 
 // SendRequest sends a request via Unix socket
-func (t *UnixSocketTransport) SendRequest(ctx context.Context, request interface{}) (json.RawMessage, error) {
+func (t *UnixSocketTransport) SendRequest(ctx context.Context, request interface{}) (_ json.RawMessage, err error) {
+	defer t.finish(time.Now(), &err)
+
 	t.mutex.RLock()
 	if !t.connected {
 		t.mutex.RUnlock()
@@ -114,6 +176,7 @@ func (t *UnixSocketTransport) SendRequest(ctx context.Context, request interface
 	if _, err := conn.Write(append(data, '\n')); err != nil {
 		return nil, fmt.Errorf("failed to write to socket: %w", err)
 	}
+	t.sent(len(data))
 
 	// Wait for response with timeout
 	select {
@@ -124,6 +187,77 @@ func (t *UnixSocketTransport) SendRequest(ctx context.Context, request interface
 	}
 }
 
+// SendNotification writes a notification to the socket
+func (t *UnixSocketTransport) SendNotification(ctx context.Context, notification interface{}) error {
+	t.mutex.RLock()
+	if !t.connected {
+		t.mutex.RUnlock()
+		return fmt.Errorf("not connected")
+	}
+	conn := t.conn
+	t.mutex.RUnlock()
+
+	data, err := json.Marshal(notification)
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification: %w", err)
+	}
+
+	if _, err := conn.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write to socket: %w", err)
+	}
+	t.sent(len(data))
+	return nil
+}
+
+// SetNotificationHandler sets the handler for server-initiated notifications
+func (t *UnixSocketTransport) SetNotificationHandler(handler NotificationHandler) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.notifyHandler = handler
+}
+
+// SetDisconnectHandler sets the handler called when the connection is lost unexpectedly
+func (t *UnixSocketTransport) SetDisconnectHandler(handler DisconnectHandler) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.lostHandler = handler
+}
+
+// connectionLost marks the transport disconnected and reports the loss unless
+// it was caused by Disconnect. done identifies the connection that was lost,
+// so a reader outliving its connection leaves a newer one alone.
+func (t *UnixSocketTransport) connectionLost(done chan struct{}, err error) {
+	t.mutex.Lock()
+	if t.done != done {
+		t.mutex.Unlock()
+		return
+	}
+	wasConnected := t.connected
+	t.connected = false
+	handler := t.lostHandler
+	t.mutex.Unlock()
+
+	if wasConnected && handler != nil {
+		handler(err)
+	}
+}
+
+// dispatchNotification hands msg to the notification handler if it is a notification
+func (t *UnixSocketTransport) dispatchNotification(msg []byte) bool {
+	if !isNotification(msg) {
+		return false
+	}
+
+	t.mutex.RLock()
+	handler := t.notifyHandler
+	t.mutex.RUnlock()
+
+	if handler != nil {
+		handler(json.RawMessage(msg))
+	}
+	return true
+}
+
 // IsConnected returns connection status
 func (t *UnixSocketTransport) IsConnected() bool {
 	t.mutex.RLock()
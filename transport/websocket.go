@@ -1,26 +1,85 @@
+//go:build !nowebsocket && !minimal
+
 package transport
 
 import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"os"
 	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/j4ng5y/mcpgate/logging"
 )
 
+func init() {
+	register("websocket", NewWebSocketTransport)
+}
+
+// NewWebSocketTransport creates a new WebSocket transport
+func NewWebSocketTransport(config map[string]interface{}) (Transport, error) {
+	return &WebSocketTransport{
+		config: config,
+	}, nil
+}
+
 // WebSocketTransport communicates with a remote MCP server via WebSocket
 type WebSocketTransport struct {
-	config    map[string]interface{}
-	conn      *websocket.Conn
-	url       string
-	mutex     sync.RWMutex
-	connected bool
-	respChan  chan json.RawMessage
-	done      chan struct{}
-	timeout   time.Duration
+	connMetrics
+
+	config        map[string]interface{}
+	conn          *websocket.Conn
+	url           string
+	mutex         sync.RWMutex
+	writeMutex    sync.Mutex
+	connected     bool
+	respChan      chan json.RawMessage
+	overflow      string
+	done          chan struct{}
+	notifyHandler NotificationHandler
+	lostHandler   DisconnectHandler
+	timeout       time.Duration
+	pingInterval  time.Duration
+	readTimeout   time.Duration
+}
+
+// DefaultWebSocketPingInterval is how often ping frames are sent on idle connections
+const DefaultWebSocketPingInterval = 30 * time.Second
+
+// keepaliveSettings reads "ping_interval" and "read_timeout" (seconds) from
+// config. A negative value disables the setting. The read timeout defaults to
+// twice the ping interval so a missed pong is tolerated, and to no deadline
+// when pings are disabled.
+func keepaliveSettings(config map[string]interface{}) (pingInterval, readTimeout time.Duration) {
+	pingInterval = DefaultWebSocketPingInterval
+	if seconds, ok := config["ping_interval"].(int); ok && seconds != 0 {
+		pingInterval = time.Duration(seconds) * time.Second
+	}
+	if pingInterval < 0 {
+		pingInterval = 0
+	}
+
+	readTimeout = 2 * pingInterval
+	if seconds, ok := config["read_timeout"].(int); ok && seconds != 0 {
+		readTimeout = time.Duration(seconds) * time.Second
+	}
+	if readTimeout < 0 {
+		readTimeout = 0
+	}
+
+	return pingInterval, readTimeout
+}
+
+// handshakeSubprotocols reads the Sec-WebSocket-Protocol values to offer.
+// ${VAR} references are expanded, for servers that take a token this way.
+func handshakeSubprotocols(config map[string]interface{}) []string {
+	subprotocols := stringList(config, "subprotocols")
+	for i, subprotocol := range subprotocols {
+		subprotocols[i] = os.ExpandEnv(subprotocol)
+	}
+	return subprotocols
 }
 
 // Connect establishes a WebSocket connection
@@ -44,59 +103,134 @@ func (t *WebSocketTransport) Connect(ctx context.Context) error {
 
 	t.url = url
 	t.timeout = time.Duration(timeoutSec) * time.Second
+	t.pingInterval, t.readTimeout = keepaliveSettings(t.config)
+
+	bufferSize, overflow, err := responseBufferFromConfig(t.config)
+	if err != nil {
+		return err
+	}
+
+	proxy, err := proxyFunc(t.config)
+	if err != nil {
+		return err
+	}
 
+	dial, err := dialFunc(t.config)
+	if err != nil {
+		return err
+	}
+
+	subprotocols := handshakeSubprotocols(t.config)
 	dialer := websocket.Dialer{
 		HandshakeTimeout: t.timeout,
+		Proxy:            proxy,
+		NetDialContext:   dial,
+		Subprotocols:     subprotocols,
 	}
 
-	conn, _, err := dialer.DialContext(ctx, t.url, nil)
+	conn, resp, err := dialer.DialContext(ctx, t.url, requestHeaders(t.config))
 	if err != nil {
+		// A rejected handshake is usually an auth or subprotocol problem
+		if resp != nil {
+			return fmt.Errorf("failed to connect to websocket: handshake rejected with HTTP %d: %w", resp.StatusCode, err)
+		}
 		return fmt.Errorf("failed to connect to websocket: %w", err)
 	}
+	if len(subprotocols) > 0 && conn.Subprotocol() == "" {
+		logger(t.config).Warn("WebSocket server did not select any of the subprotocols", "url", t.url, "subprotocols", subprotocols)
+	}
 
 	t.conn = conn
 	t.connected = true
-	t.respChan = make(chan json.RawMessage, 100)
+	t.respChan = make(chan json.RawMessage, bufferSize)
+	t.overflow = overflow
 	t.done = make(chan struct{})
 
+	// Any pong proves the connection is alive and extends the read deadline
+	readTimeout := t.readTimeout
+	conn.SetPongHandler(func(string) error {
+		return extendReadDeadline(conn, readTimeout)
+	})
+
 	// Start reading responses in background
-	go t.readResponses()
+	go t.readResponses(conn, t.respChan, t.done)
+
+	if t.pingInterval > 0 {
+		go t.keepalive(conn, t.pingInterval, t.done)
+	}
 
 	return nil
 }
 
-// readResponses reads JSON responses from WebSocket
-func (t *WebSocketTransport) readResponses() {
-	defer close(t.respChan)
+// readResponses reads JSON responses from the WebSocket connection
+// identified by done
+func (t *WebSocketTransport) readResponses(conn *websocket.Conn, respChan chan json.RawMessage, done chan struct{}) {
+	defer close(respChan)
 	for {
 		select {
-		case <-t.done:
+		case <-done:
 			return
 		default:
 		}
 
-		if err := t.conn.SetReadDeadline(time.Now().Add(t.timeout)); err != nil {
+		if err := extendReadDeadline(conn, t.readTimeout); err != nil {
 			t.mutex.Lock()
 			t.connected = false
 			t.mutex.Unlock()
-			log.Printf("Error setting read deadline: %v", err)
+			logger(t.config).Warn("Error setting read deadline", logging.Err(err))
 			return
 		}
 
-		messageType, data, err := t.conn.ReadMessage()
+		messageType, data, err := conn.ReadMessage()
 		if err != nil {
-			t.mutex.Lock()
-			t.connected = false
-			t.mutex.Unlock()
+			t.connectionLost(done, err)
 			return
 		}
+		t.received(len(data))
 
 		if messageType == websocket.TextMessage {
-			t.respChan <- json.RawMessage(data)
+			if t.dispatchNotification(data) {
+				continue
+			}
+			if !isResponse(data) {
+				logger(t.config).Warn("Dropping unexpected message from server", "message", string(data))
+				continue
+			}
+			if err := t.enqueueResponse(respChan, json.RawMessage(data), t.overflow, done); err != nil {
+				t.connectionLost(done, err)
+				return
+			}
+		}
+	}
+}
+
+// keepalive sends ping frames until done is closed or a ping cannot be written
+func (t *WebSocketTransport) keepalive(conn *websocket.Conn, interval time.Duration, done chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			// WriteControl is safe to call concurrently with WriteMessage
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(t.timeout)); err != nil {
+				logger(t.config).Warn("Error sending websocket ping", "url", t.url, logging.Err(err))
+				return
+			}
+		case <-done:
+			return
 		}
 	}
 }
 
+// extendReadDeadline pushes the read deadline out by timeout, or clears it when timeout is zero
+func extendReadDeadline(conn *websocket.Conn, timeout time.Duration) error {
+	if timeout <= 0 {
+		return conn.SetReadDeadline(time.Time{})
+	}
+	return conn.SetReadDeadline(time.Now().Add(timeout))
+}
+
 // Disconnect closes the WebSocket connection
 func (t *WebSocketTransport) Disconnect(ctx context.Context) error {
 	t.mutex.Lock()
@@ -111,7 +245,7 @@ func (t *WebSocketTransport) Disconnect(ctx context.Context) error {
 
 	if t.conn != nil {
 		if err := t.conn.Close(); err != nil {
-			log.Printf("Error closing connection: %v", err)
+			logger(t.config).Warn("Error closing connection", logging.Err(err))
 		}
 	}
 
@@ -119,7 +253,9 @@ func (t *WebSocketTransport) Disconnect(ctx context.Context) error {
 }
 
 // SendRequest sends a request via WebSocket
-func (t *WebSocketTransport) SendRequest(ctx context.Context, request interface{}) (json.RawMessage, error) {
+func (t *WebSocketTransport) SendRequest(ctx context.Context, request interface{}) (_ json.RawMessage, err error) {
+	defer t.finish(time.Now(), &err)
+
 	t.mutex.RLock()
 	if !t.connected {
 		t.mutex.RUnlock()
@@ -133,12 +269,8 @@ func (t *WebSocketTransport) SendRequest(ctx context.Context, request interface{
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	if err := conn.SetWriteDeadline(time.Now().Add(t.timeout)); err != nil {
-		return nil, fmt.Errorf("failed to set write deadline: %w", err)
-	}
-
-	if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
-		return nil, fmt.Errorf("failed to write to websocket: %w", err)
+	if err := t.write(conn, data); err != nil {
+		return nil, err
 	}
 
 	// Wait for response with timeout
@@ -150,6 +282,95 @@ func (t *WebSocketTransport) SendRequest(ctx context.Context, request interface{
 	}
 }
 
+// SendNotification writes a notification as a single text message
+func (t *WebSocketTransport) SendNotification(ctx context.Context, notification interface{}) error {
+	t.mutex.RLock()
+	if !t.connected {
+		t.mutex.RUnlock()
+		return fmt.Errorf("not connected")
+	}
+	conn := t.conn
+	t.mutex.RUnlock()
+
+	data, err := json.Marshal(notification)
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification: %w", err)
+	}
+
+	return t.write(conn, data)
+}
+
+// write sends data as a single text message. Writes are serialized because
+// the connection allows only one concurrent writer.
+func (t *WebSocketTransport) write(conn *websocket.Conn, data []byte) error {
+	t.writeMutex.Lock()
+	defer t.writeMutex.Unlock()
+
+	if err := conn.SetWriteDeadline(time.Now().Add(t.timeout)); err != nil {
+		return fmt.Errorf("failed to set write deadline: %w", err)
+	}
+
+	if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		return fmt.Errorf("failed to write to websocket: %w", err)
+	}
+	t.sent(len(data))
+	return nil
+}
+
+// SetNotificationHandler sets the handler for server-initiated notifications
+func (t *WebSocketTransport) SetNotificationHandler(handler NotificationHandler) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.notifyHandler = handler
+}
+
+// SetDisconnectHandler sets the handler called when the connection is lost unexpectedly
+func (t *WebSocketTransport) SetDisconnectHandler(handler DisconnectHandler) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.lostHandler = handler
+}
+
+// connectionLost marks the transport disconnected and reports the loss unless
+// it was caused by Disconnect. done identifies the connection that was lost,
+// so a reader outliving its connection leaves a newer one alone.
+func (t *WebSocketTransport) connectionLost(done chan struct{}, err error) {
+	t.mutex.Lock()
+	if t.done != done {
+		t.mutex.Unlock()
+		return
+	}
+	wasConnected := t.connected
+	t.connected = false
+	handler := t.lostHandler
+	t.mutex.Unlock()
+
+	if !wasConnected {
+		return
+	}
+
+	logger(t.config).Warn("WebSocket connection lost", "url", t.url, logging.Err(err))
+	if handler != nil {
+		handler(err)
+	}
+}
+
+// dispatchNotification hands msg to the notification handler if it is a notification
+func (t *WebSocketTransport) dispatchNotification(msg []byte) bool {
+	if !isNotification(msg) {
+		return false
+	}
+
+	t.mutex.RLock()
+	handler := t.notifyHandler
+	t.mutex.RUnlock()
+
+	if handler != nil {
+		handler(json.RawMessage(msg))
+	}
+	return true
+}
+
 // IsConnected returns connection status
 func (t *WebSocketTransport) IsConnected() bool {
 	t.mutex.RLock()
@@ -0,0 +1,18 @@
+//go:build nowebsocket || minimal
+
+package transport
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTransportFactory_WebSocketCompiledOut(t *testing.T) {
+	_, err := NewFactory().Create("websocket", map[string]interface{}{"url": "ws://localhost:9000"})
+	if err == nil {
+		t.Fatal("Expected error when websocket is compiled out")
+	}
+	if !strings.Contains(err.Error(), "not included in this build") {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,209 @@
+//go:build !nowebsocket && !minimal
+
+package transport
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestTransportFactory_CreateWebSocket(t *testing.T) {
+	factory := NewFactory()
+	config := map[string]interface{}{
+		"url": "ws://localhost:9000",
+	}
+
+	transport, err := factory.Create("websocket", config)
+	if err != nil {
+		t.Fatalf("Failed to create WebSocket transport: %v", err)
+	}
+
+	if transport.Name() != "websocket" {
+		t.Errorf("Expected transport name 'websocket', got '%s'", transport.Name())
+	}
+
+	if transport.IsConnected() {
+		t.Error("Transport should not be connected initially")
+	}
+}
+
+func TestWebSocketTransport_MissingURL(t *testing.T) {
+	config := map[string]interface{}{
+		// No URL specified
+	}
+
+	transport, err := NewWebSocketTransport(config)
+	if err != nil {
+		t.Fatalf("Failed to create transport: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	err = transport.Connect(ctx)
+	if err == nil {
+		t.Fatal("Expected error for missing URL")
+	}
+}
+
+func TestWebSocketTransport_HandshakeHeaders(t *testing.T) {
+	handshake := make(chan string, 1)
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handshake <- r.Header.Get("Authorization")
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		_ = conn.Close()
+	}))
+	defer server.Close()
+
+	transport, _ := NewWebSocketTransport(map[string]interface{}{
+		"url":        "ws" + strings.TrimPrefix(server.URL, "http"),
+		"auth_token": "ws-token",
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if err := transport.Connect(ctx); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer func() {
+		_ = transport.Disconnect(ctx)
+	}()
+
+	if got := <-handshake; got != "Bearer ws-token" {
+		t.Errorf("Expected bearer token on handshake, got %q", got)
+	}
+}
+
+func TestKeepaliveSettings(t *testing.T) {
+	tests := []struct {
+		config       map[string]interface{}
+		pingInterval time.Duration
+		readTimeout  time.Duration
+	}{
+		{map[string]interface{}{}, DefaultWebSocketPingInterval, 2 * DefaultWebSocketPingInterval},
+		{map[string]interface{}{"ping_interval": 10}, 10 * time.Second, 20 * time.Second},
+		{map[string]interface{}{"ping_interval": 10, "read_timeout": 45}, 10 * time.Second, 45 * time.Second},
+		{map[string]interface{}{"ping_interval": -1}, 0, 0},
+		{map[string]interface{}{"read_timeout": -1}, DefaultWebSocketPingInterval, 0},
+	}
+
+	for _, tt := range tests {
+		pingInterval, readTimeout := keepaliveSettings(tt.config)
+		if pingInterval != tt.pingInterval || readTimeout != tt.readTimeout {
+			t.Errorf("keepaliveSettings(%v) = %v, %v; want %v, %v",
+				tt.config, pingInterval, readTimeout, tt.pingInterval, tt.readTimeout)
+		}
+	}
+}
+
+func TestWebSocketTransport_KeepaliveSurvivesIdle(t *testing.T) {
+	pings := make(chan struct{}, 10)
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+
+		conn.SetPingHandler(func(data string) error {
+			pings <- struct{}{}
+			return conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+		})
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	defer server.Close()
+
+	transport, _ := NewWebSocketTransport(map[string]interface{}{
+		"url":           "ws" + strings.TrimPrefix(server.URL, "http"),
+		"ping_interval": 1,
+		"read_timeout":  2,
+	})
+
+	ctx := context.Background()
+	if err := transport.Connect(ctx); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer func() {
+		_ = transport.Disconnect(ctx)
+	}()
+
+	// Stay idle past the read timeout; pongs must keep the connection open
+	time.Sleep(3 * time.Second)
+
+	if len(pings) == 0 {
+		t.Error("Expected ping frames on an idle connection")
+	}
+	if !transport.IsConnected() {
+		t.Error("Expected idle connection to stay open")
+	}
+}
+
+func TestWebSocketTransport_Subprotocols(t *testing.T) {
+	t.Setenv("MCPGATE_TEST_WS_TOKEN", "abc123")
+
+	offered := make(chan []string, 1)
+	upgrader := websocket.Upgrader{Subprotocols: []string{"mcp"}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		offered <- websocket.Subprotocols(r)
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		_ = conn.Close()
+	}))
+	defer server.Close()
+
+	transport, _ := NewWebSocketTransport(map[string]interface{}{
+		"url":          "ws" + strings.TrimPrefix(server.URL, "http"),
+		"subprotocols": []string{"mcp", "token.${MCPGATE_TEST_WS_TOKEN}"},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if err := transport.Connect(ctx); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer func() {
+		_ = transport.Disconnect(ctx)
+	}()
+
+	if got := <-offered; strings.Join(got, ",") != "mcp,token.abc123" {
+		t.Errorf("Expected expanded subprotocols, got %v", got)
+	}
+	if selected := transport.(*WebSocketTransport).conn.Subprotocol(); selected != "mcp" {
+		t.Errorf("Expected mcp to be selected, got %q", selected)
+	}
+}
+
+func TestWebSocketTransport_RejectedHandshake(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	transport, _ := NewWebSocketTransport(map[string]interface{}{
+		"url": "ws" + strings.TrimPrefix(server.URL, "http"),
+	})
+
+	err := transport.Connect(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "HTTP 403") {
+		t.Errorf("Expected the handshake status in the error, got %v", err)
+	}
+}